@@ -0,0 +1,59 @@
+// Package admin contains the subcommands operators use to manage an identity server.
+// The subcommands work directly on the database through the same managers as the http handlers.
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/itsyouonline/identityserver/config"
+	"github.com/itsyouonline/identityserver/db"
+)
+
+// Commands returns the admin subcommands, the configuration is only read when a subcommand is executed
+func Commands(settings *config.Config) []cli.Command {
+	connectionString := &settings.ConnectionString
+	return []cli.Command{
+		userCommand(connectionString),
+		organizationCommand(connectionString),
+		jwtKeyCommand(connectionString),
+		globalConfigCommand(connectionString),
+		tokensCommand(connectionString),
+		migrationsCommand(connectionString),
+		jobsCommand(connectionString),
+		configCommand(settings),
+	}
+}
+
+// connectAttempts is the number of times a subcommand tries to connect to the database before it fails
+const connectAttempts = 3
+
+// action creates a cli action that connects to the db and passes a request with the backend opened to f,
+// the managers get their storage from the request
+func action(connectionString *string, f func(c *cli.Context, r *http.Request) error) func(c *cli.Context) {
+	return func(c *cli.Context) {
+		if err := db.ConnectAttempts(*connectionString, connectAttempts); err != nil {
+			log.Fatal("Failed to connect to the database: ", err)
+		}
+		r, release, err := db.NewBackgroundRequest(db.DefaultBackend(), "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = f(c, r)
+		release()
+		db.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// checkArgs makes sure the right number of arguments is passed to a subcommand
+func checkArgs(c *cli.Context, count int) error {
+	if len(c.Args()) != count {
+		return fmt.Errorf("Expected arguments: %s", c.Command.ArgsUsage)
+	}
+	return nil
+}
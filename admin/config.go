@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/itsyouonline/identityserver/config"
+	"gopkg.in/yaml.v2"
+)
+
+func configCommand(settings *config.Config) cli.Command {
+	return cli.Command{
+		Name:  "config",
+		Usage: "Inspect the configuration",
+		Subcommands: []cli.Command{
+			{
+				Name:  "print",
+				Usage: "Print the configuration the server would use, with the secrets redacted",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "format",
+						Usage: "yaml or toml",
+						Value: "yaml",
+					},
+				},
+				Action: func(c *cli.Context) {
+					if err := printConfig(settings.Redacted(), c.String("format")); err != nil {
+						log.Fatal(err)
+					}
+				},
+			},
+		},
+	}
+}
+
+func printConfig(settings *config.Config, format string) error {
+	switch format {
+	case "yaml":
+		data, err := yaml.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	case "toml":
+		return toml.NewEncoder(os.Stdout).Encode(settings)
+	default:
+		return fmt.Errorf("Unknown format %s, use yaml or toml", format)
+	}
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/codegangsta/cli"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/globalconfig"
+)
+
+func globalConfigCommand(connectionString *string) cli.Command {
+	return cli.Command{
+		Name:  "globalconfig",
+		Usage: "Manage the global configuration stored in the database",
+		Subcommands: []cli.Command{
+			{
+				Name:      "get",
+				Usage:     "Print the value of a key",
+				ArgsUsage: "<key>",
+				Action:    action(connectionString, getGlobalConfig),
+			},
+			{
+				Name:      "set",
+				Usage:     "Set the value of a key",
+				ArgsUsage: "<key> <value>",
+				Action:    action(connectionString, setGlobalConfig),
+			},
+		},
+	}
+}
+
+func getGlobalConfig(c *cli.Context, r *http.Request) (err error) {
+	if err = checkArgs(c, 1); err != nil {
+		return
+	}
+	config, err := globalconfig.NewManager().GetByKey(c.Args().First())
+	if db.IsNotFound(err) {
+		return fmt.Errorf("Key %s does not exist", c.Args().First())
+	}
+	if err != nil {
+		return
+	}
+	fmt.Println(config.Value)
+	return
+}
+
+func setGlobalConfig(c *cli.Context, r *http.Request) (err error) {
+	if err = checkArgs(c, 2); err != nil {
+		return
+	}
+	config := &globalconfig.GlobalConfig{Key: c.Args().Get(0), Value: c.Args().Get(1)}
+	if err = globalconfig.NewManager().Set(config); err != nil {
+		return
+	}
+	fmt.Println("Stored", config.Key)
+	return
+}
@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/job"
+	"github.com/itsyouonline/identityserver/jobs"
+)
+
+func jobsCommand(connectionString *string) cli.Command {
+	return cli.Command{
+		Name:  "jobs",
+		Usage: "Manage the maintenance jobs",
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List the jobs and their last run",
+				Action: action(connectionString, listJobs),
+			},
+			{
+				Name:      "history",
+				Usage:     "List the last runs of all jobs or of one job",
+				ArgsUsage: "[job]",
+				Flags: []cli.Flag{
+					cli.IntFlag{Name: "limit", Value: 20, Usage: "Number of runs to list"},
+				},
+				Action: action(connectionString, jobHistory),
+			},
+			{
+				Name:      "run",
+				Usage:     "Run a job now, unless it is already running",
+				ArgsUsage: "<job>",
+				Action:    action(connectionString, runJob),
+			},
+		},
+	}
+}
+
+func listJobs(c *cli.Context, r *http.Request) error {
+	mgr := job.NewManager(r)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tINTERVAL\tLAST RUN\tRESULT\tDESCRIPTION")
+	for _, j := range jobs.Registered() {
+		lastRun, result := "never", ""
+		last, err := mgr.LastRun(j.Name)
+		if err != nil && !db.IsNotFound(err) {
+			return err
+		}
+		if err == nil {
+			lastRun, result = last.StartedAt.Format(time.RFC3339), runResult(last)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", j.Name, j.Interval, lastRun, result, j.Description)
+	}
+	return w.Flush()
+}
+
+func jobHistory(c *cli.Context, r *http.Request) error {
+	if len(c.Args()) > 1 {
+		return fmt.Errorf("Expected arguments: %s", c.Command.ArgsUsage)
+	}
+	name := c.Args().First()
+	if _, found := jobs.Find(name); name != "" && !found {
+		return fmt.Errorf("Unknown job %s", name)
+	}
+	runs, err := job.NewManager(r).ListRuns(name, c.Int("limit"))
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tSTARTED\tDURATION\tTRIGGER\tINSTANCE\tRESULT")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", run.Job, run.StartedAt.Format(time.RFC3339),
+			run.FinishedAt.Sub(run.StartedAt), run.Trigger, run.Instance, runResult(&run))
+	}
+	return w.Flush()
+}
+
+func runJob(c *cli.Context, r *http.Request) error {
+	if err := checkArgs(c, 1); err != nil {
+		return err
+	}
+	j, found := jobs.Find(c.Args().First())
+	if !found {
+		return fmt.Errorf("Unknown job %s", c.Args().First())
+	}
+	run, err := jobs.RunNow(db.GetBackend(r), j, "admin-"+jobs.Instance())
+	if err == jobs.ErrJobRunning {
+		return fmt.Errorf("Job %s is already running, try again when it finished", j.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if run.Error != "" {
+		return errors.New(run.Error)
+	}
+	fmt.Printf("Removed %d\n", run.Removed)
+	return nil
+}
+
+// runResult describes the outcome of a run
+func runResult(run *job.Run) string {
+	if run.Error != "" {
+		return "failed: " + run.Error
+	}
+	return fmt.Sprintf("removed %d", run.Removed)
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/codegangsta/cli"
+	"github.com/itsyouonline/identityserver/globalconfig"
+)
+
+const jwtKeyConfigKey = "jwtkey"
+
+func jwtKeyCommand(connectionString *string) cli.Command {
+	return cli.Command{
+		Name:  "jwtkey",
+		Usage: "Manage the key used to sign JWT's",
+		Subcommands: []cli.Command{
+			{
+				Name:   "generate",
+				Usage:  "Generate and store the key used to sign JWT's if there is none yet",
+				Action: action(connectionString, generateJWTKey),
+			},
+			{
+				Name:   "rotate",
+				Usage:  "Replace the key used to sign JWT's, JWT's signed with the old key are no longer valid",
+				Action: action(connectionString, rotateJWTKey),
+			},
+		},
+	}
+}
+
+func generateJWTKey(c *cli.Context, r *http.Request) (err error) {
+	config := globalconfig.NewManager()
+	exists, err := config.Exists(jwtKeyConfigKey)
+	if err != nil {
+		return
+	}
+	if exists {
+		return errors.New("A JWT signing key already exists, use rotate to replace it")
+	}
+	return storeNewJWTKey(config)
+}
+
+func rotateJWTKey(c *cli.Context, r *http.Request) (err error) {
+	return storeNewJWTKey(globalconfig.NewManager())
+}
+
+func storeNewJWTKey(config globalconfig.Manager) (err error) {
+	key, err := newJWTKey()
+	if err != nil {
+		return
+	}
+	if err = config.Set(&globalconfig.GlobalConfig{Key: jwtKeyConfigKey, Value: string(key)}); err != nil {
+		return
+	}
+	fmt.Println("Stored a new JWT signing key, restart the identity servers to start using it")
+	return
+}
+
+// newJWTKey generates a PEM encoded P-384 private key for the ES384 signing method
+func newJWTKey() ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,23 @@
+package admin
+
+import (
+	"crypto/elliptic"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJWTKey(t *testing.T) {
+	pemKey, err := newJWTKey()
+	assert.NoError(t, err)
+
+	// The server loads the key the same way at startup
+	key, err := jwt.ParseECPrivateKeyFromPEM(pemKey)
+	assert.NoError(t, err)
+	assert.Equal(t, elliptic.P384(), key.Curve)
+
+	token := jwt.New(jwt.SigningMethodES384)
+	_, err = token.SignedString(key)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/itsyouonline/identityserver/db/migrations"
+)
+
+func migrationsCommand(connectionString *string) cli.Command {
+	return cli.Command{
+		Name:  "migrations",
+		Usage: "Manage the database migrations",
+		Subcommands: []cli.Command{
+			{
+				Name:   "status",
+				Usage:  "List the migrations and when they were applied",
+				Action: action(connectionString, migrationStatus),
+			},
+			{
+				Name:   "up",
+				Usage:  "Apply the pending migrations, the server also does this when it starts",
+				Action: action(connectionString, applyMigrations),
+			},
+		},
+	}
+}
+
+func migrationStatus(c *cli.Context, r *http.Request) (err error) {
+	status, err := migrations.GetStatusFor(r)
+	if err != nil {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+	for _, s := range status {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, applied, s.Description)
+	}
+	return w.Flush()
+}
+
+func applyMigrations(c *cli.Context, r *http.Request) (err error) {
+	if err = migrations.RunFor(r); err != nil {
+		return
+	}
+	fmt.Println("The database is up to date")
+	return
+}
@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/itsyouonline/identityserver/db"
+	organizationdb "github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/user"
+)
+
+func organizationCommand(connectionString *string) cli.Command {
+	return cli.Command{
+		Name:  "org",
+		Usage: "Manage organizations",
+		Subcommands: []cli.Command{
+			{
+				Name:      "create",
+				Usage:     "Create an organization, this also allows creating the root organization",
+				ArgsUsage: "<globalid> <owner>",
+				Action:    action(connectionString, createOrganization),
+			},
+			{
+				Name:      "add-owner",
+				Usage:     "Make a user owner of an organization",
+				ArgsUsage: "<globalid> <username>",
+				Action:    action(connectionString, addOrganizationOwner),
+			},
+		},
+	}
+}
+
+func createOrganization(c *cli.Context, r *http.Request) (err error) {
+	if err = checkArgs(c, 2); err != nil {
+		return
+	}
+	org := &organizationdb.Organization{
+		Globalid:         strings.TrimSpace(c.Args().Get(0)),
+		Owners:           []string{c.Args().Get(1)},
+		Members:          []string{},
+		OrgOwners:        []string{},
+		OrgMembers:       []string{},
+		DNS:              []string{},
+		PublicKeys:       []string{},
+		RequiredScopes:   []organizationdb.RequiredScope{},
+		IncludeSubOrgsOf: []string{},
+	}
+	orgMgr := organizationdb.NewManager(r)
+	if i := strings.LastIndex(org.Globalid, "."); i >= 0 {
+		if !org.IsValidSubOrganization() {
+			return fmt.Errorf("Invalid globalid %s", org.Globalid)
+		}
+		if parent := org.Globalid[:i]; !orgMgr.Exists(parent) {
+			return fmt.Errorf("Parent organization %s does not exist", parent)
+		}
+	} else if !org.IsValid() {
+		return fmt.Errorf("Invalid globalid %s", org.Globalid)
+	}
+	if _, err = getUser(r, org.Owners[0]); err != nil {
+		return
+	}
+	exists, err := user.NewManager(r).Exists(org.Globalid)
+	if err != nil {
+		return
+	}
+	if exists {
+		return fmt.Errorf("A user %s exists", org.Globalid)
+	}
+
+	err = orgMgr.Create(org)
+	if err == db.ErrDuplicate {
+		return fmt.Errorf("Organization %s already exists", org.Globalid)
+	}
+	if err != nil {
+		return
+	}
+	if err = organizationdb.NewLogoManager(r).Create(org); err != nil && err != db.ErrDuplicate {
+		return
+	}
+	fmt.Println("Created organization", org.Globalid, "owned by", org.Owners[0])
+	return nil
+}
+
+func addOrganizationOwner(c *cli.Context, r *http.Request) (err error) {
+	if err = checkArgs(c, 2); err != nil {
+		return
+	}
+	globalid, username := c.Args().Get(0), c.Args().Get(1)
+	orgMgr := organizationdb.NewManager(r)
+	if !orgMgr.Exists(globalid) {
+		return fmt.Errorf("Organization %s does not exist", globalid)
+	}
+	if _, err = getUser(r, username); err != nil {
+		return
+	}
+	// A member is promoted, the user can not be both member and owner
+	if err = orgMgr.UpdateMembership(globalid, username, "members", "owners"); err != nil {
+		return
+	}
+	fmt.Println("Added", username, "as owner of", globalid)
+	return
+}
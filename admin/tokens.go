@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/codegangsta/cli"
+	"github.com/itsyouonline/identityserver/oauthservice"
+)
+
+func tokensCommand(connectionString *string) cli.Command {
+	return cli.Command{
+		Name:  "tokens",
+		Usage: "Manage oauth tokens",
+		Subcommands: []cli.Command{
+			{
+				Name:  "purge",
+				Usage: "Revoke the oauth tokens of a user, of an organization or all of them",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "user", Usage: "Revoke the access tokens, refresh tokens and pending authorizations of this user"},
+					cli.StringFlag{Name: "organization", Usage: "Revoke the access tokens of this organization"},
+					cli.BoolFlag{Name: "all", Usage: "Revoke all access tokens and refresh tokens"},
+				},
+				Action: action(connectionString, purgeTokens),
+			},
+		},
+	}
+}
+
+func purgeTokens(c *cli.Context, r *http.Request) (err error) {
+	mgr := oauthservice.NewManager(r)
+	username, globalid := c.String("user"), c.String("organization")
+	switch {
+	case username != "" && globalid == "" && !c.Bool("all"):
+		err = mgr.RemoveTokensByUser(username)
+	case globalid != "" && username == "" && !c.Bool("all"):
+		err = mgr.RemoveTokensByGlobalID(globalid)
+	case c.Bool("all") && username == "" && globalid == "":
+		err = mgr.RemoveAllTokens()
+	default:
+		return errors.New("Specify exactly one of --user, --organization or --all")
+	}
+	if err != nil {
+		return
+	}
+	fmt.Println("Revoked the tokens")
+	return
+}
@@ -0,0 +1,237 @@
+package admin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/itsyouonline/identityserver/credentials/password"
+	"github.com/itsyouonline/identityserver/credentials/totp"
+	"github.com/itsyouonline/identityserver/db"
+	organizationdb "github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/user"
+	validationdb "github.com/itsyouonline/identityserver/db/validation"
+	"github.com/itsyouonline/identityserver/oauthservice"
+	"github.com/itsyouonline/identityserver/tools"
+)
+
+func userCommand(connectionString *string) cli.Command {
+	return cli.Command{
+		Name:  "user",
+		Usage: "Manage users",
+		Subcommands: []cli.Command{
+			{
+				Name:      "create",
+				Usage:     "Create a user, a random password is generated if none is given",
+				ArgsUsage: "<username>",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "firstname", Usage: "First name of the user"},
+					cli.StringFlag{Name: "lastname", Usage: "Last name of the user"},
+					cli.StringFlag{Name: "email", Usage: "Validated email address of the user"},
+					cli.StringFlag{Name: "phone", Usage: "Validated phone number of the user"},
+					cli.BoolFlag{Name: "password-stdin", Usage: "Read the password of the user from the standard input"},
+				},
+				Action: action(connectionString, createUser),
+			},
+			{
+				Name:      "reset-password",
+				Usage:     "Set the password of a user, a random password is generated if none is given",
+				ArgsUsage: "<username>",
+				Flags: []cli.Flag{
+					cli.BoolFlag{Name: "password-stdin", Usage: "Read the new password of the user from the standard input"},
+				},
+				Action: action(connectionString, resetPassword),
+			},
+			{
+				Name:      "disable-2fa",
+				Usage:     "Remove the authenticator application of a user",
+				ArgsUsage: "<username>",
+				Action:    action(connectionString, disableTOTP),
+			},
+			{
+				Name:      "suspend",
+				Usage:     "Suspend a user so the user can no longer log in, all oauth tokens of the user are revoked",
+				ArgsUsage: "<username>",
+				Action:    action(connectionString, suspendUser),
+			},
+			{
+				Name:      "unsuspend",
+				Usage:     "Reinstate a suspended user",
+				ArgsUsage: "<username>",
+				Action:    action(connectionString, unsuspendUser),
+			},
+		},
+	}
+}
+
+func createUser(c *cli.Context, r *http.Request) (err error) {
+	if err = checkArgs(c, 1); err != nil {
+		return
+	}
+	username := c.Args().First()
+	if !user.ValidateUsername(username) {
+		return fmt.Errorf("Invalid username %s", username)
+	}
+	userMgr := user.NewManager(r)
+	exists, err := userMgr.Exists(username)
+	if err != nil {
+		return
+	}
+	if exists || organizationdb.NewManager(r).Exists(username) {
+		return fmt.Errorf("A user or organization %s already exists", username)
+	}
+
+	userobj := &user.User{
+		Username:  username,
+		Firstname: c.String("firstname"),
+		Lastname:  c.String("lastname"),
+	}
+	if email := c.String("email"); email != "" {
+		userobj.EmailAddresses = []user.EmailAddress{{Label: "main", EmailAddress: email}}
+	}
+	if phone := c.String("phone"); phone != "" {
+		userobj.Phonenumbers = []user.Phonenumber{{Label: "main", Phonenumber: phone}}
+	}
+	passwd, generated, err := newPassword(c, password.UserInfoFromUser(userobj))
+	if err != nil {
+		return
+	}
+
+	if err = userMgr.Save(userobj); err != nil {
+		return
+	}
+	if err = password.NewManager(r).Save(username, passwd); err != nil {
+		return
+	}
+	valMgr := validationdb.NewManager(r)
+	for _, email := range userobj.EmailAddresses {
+		if err = valMgr.SaveValidatedEmailAddress(valMgr.NewValidatedEmailAddress(username, email.EmailAddress)); err != nil {
+			return
+		}
+	}
+	for _, phone := range userobj.Phonenumbers {
+		if err = valMgr.SaveValidatedPhonenumber(valMgr.NewValidatedPhonenumber(username, phone.Phonenumber)); err != nil {
+			return
+		}
+	}
+	fmt.Println("Created user", username)
+	if generated {
+		fmt.Println("Password:", passwd)
+	}
+	return
+}
+
+func resetPassword(c *cli.Context, r *http.Request) (err error) {
+	if err = checkArgs(c, 1); err != nil {
+		return
+	}
+	userobj, err := getUser(r, c.Args().First())
+	if err != nil {
+		return
+	}
+	passwd, generated, err := newPassword(c, password.UserInfoFromUser(userobj))
+	if err != nil {
+		return
+	}
+	if err = password.NewManager(r).Save(userobj.Username, passwd); err != nil {
+		return
+	}
+	fmt.Println("Changed the password of", userobj.Username)
+	if generated {
+		fmt.Println("Password:", passwd)
+	}
+	return
+}
+
+func disableTOTP(c *cli.Context, r *http.Request) (err error) {
+	if err = checkArgs(c, 1); err != nil {
+		return
+	}
+	userobj, err := getUser(r, c.Args().First())
+	if err != nil {
+		return
+	}
+	err = totp.NewManager(r).Remove(userobj.Username)
+	if db.IsNotFound(err) {
+		return fmt.Errorf("User %s has no authenticator application", userobj.Username)
+	}
+	if err != nil {
+		return
+	}
+	fmt.Println("Removed the authenticator application of", userobj.Username)
+	return
+}
+
+func suspendUser(c *cli.Context, r *http.Request) (err error) {
+	if err = checkArgs(c, 1); err != nil {
+		return
+	}
+	userobj, err := getUser(r, c.Args().First())
+	if err != nil {
+		return
+	}
+	if err = user.NewManager(r).SetSuspended(userobj.Username, true); err != nil {
+		return
+	}
+	if err = oauthservice.NewManager(r).RemoveTokensByUser(userobj.Username); err != nil {
+		return
+	}
+	fmt.Println("Suspended", userobj.Username)
+	return
+}
+
+func unsuspendUser(c *cli.Context, r *http.Request) (err error) {
+	if err = checkArgs(c, 1); err != nil {
+		return
+	}
+	userobj, err := getUser(r, c.Args().First())
+	if err != nil {
+		return
+	}
+	if err = user.NewManager(r).SetSuspended(userobj.Username, false); err != nil {
+		return
+	}
+	fmt.Println("Reinstated", userobj.Username)
+	return
+}
+
+func getUser(r *http.Request, username string) (userobj *user.User, err error) {
+	userobj, err = user.NewManager(r).GetByName(username)
+	if db.IsNotFound(err) {
+		err = fmt.Errorf("User %s does not exist", username)
+	}
+	return
+}
+
+// newPassword reads a password from the standard input and checks it against the password policy if
+// --password-stdin is given, or generates a random password otherwise.
+// The password is not taken from a flag, it would show up in the process list and the shell history.
+func newPassword(c *cli.Context, userInfo password.UserInfo) (string, bool, error) {
+	if c.Bool("password-stdin") {
+		passwd, err := readPassword(os.Stdin)
+		if err != nil {
+			return "", false, err
+		}
+		return passwd, false, password.Check(passwd, userInfo)
+	}
+	generated, err := tools.GenerateRandomString()
+	return generated, true, err
+}
+
+// readPassword reads the first line of in, without the line ending
+func readPassword(in io.Reader) (string, error) {
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	passwd := strings.TrimRight(line, "\r\n")
+	if passwd == "" {
+		return "", errors.New("No password on the standard input")
+	}
+	return passwd, nil
+}
@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPassword(t *testing.T) {
+	passwd, err := readPassword(strings.NewReader("correct horse battery staple\r\nignored\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "correct horse battery staple", passwd)
+
+	passwd, err = readPassword(strings.NewReader("without line ending"))
+	assert.NoError(t, err)
+	assert.Equal(t, "without line ending", passwd)
+
+	_, err = readPassword(strings.NewReader(""))
+	assert.Error(t, err)
+}
@@ -0,0 +1,209 @@
+// Package cache keeps short lived copies of lookups that are done on every api request, like access tokens.
+// Entries are tagged with what they depend on, like the user or organization they belong to,
+// so a change can invalidate all entries that depend on it. Invalidate only removes the entries of this instance,
+// the db/invalidation package publishes the invalidations to the other instances.
+//
+// A lookup takes the Generation of the cache before it reads the value from the database and passes it to Set,
+// a value read before an invalidation of one of its tags is then not stored.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/metrics"
+)
+
+const (
+	// DefaultSize is the default maximum number of entries of a cache
+	DefaultSize = 10000
+	// DefaultTTL is the default time an entry is used before it is looked up again
+	DefaultTTL = 30 * time.Second
+)
+
+// Cache is a least recently used cache whose entries expire after a time to live
+type Cache struct {
+	name    string
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	// order has the most recently used entry at the front
+	order *list.List
+	// generation is incremented by every invalidation
+	generation uint64
+	// invalidated has the generation of the last invalidation of each tag
+	invalidated map[string]uint64
+	// cleared is the generation of the last invalidation of all entries, the invalidated tags are
+	// forgotten then since nothing read before it can be stored anyway
+	cleared uint64
+}
+
+type entry struct {
+	key       string
+	value     interface{}
+	tags      []string
+	expiresAt time.Time
+}
+
+var (
+	cachesMutex sync.Mutex
+	caches      []*Cache
+)
+
+// New creates a cache with the default size and time to live and registers it so it can be invalidated and configured.
+// The name is used as the label of the metrics, invalidating the name removes all entries of the cache.
+func New(name string) *Cache {
+	c := &Cache{name: name, size: DefaultSize, ttl: DefaultTTL, entries: make(map[string]*list.Element), order: list.New(),
+		invalidated: make(map[string]uint64)}
+	cachesMutex.Lock()
+	defer cachesMutex.Unlock()
+	caches = append(caches, c)
+	return c
+}
+
+// registered returns the caches created with New
+func registered() []*Cache {
+	cachesMutex.Lock()
+	defer cachesMutex.Unlock()
+	return append([]*Cache{}, caches...)
+}
+
+// Configure changes the size and time to live of all caches, a ttl of 0 disables them
+func Configure(size int, ttl time.Duration) {
+	for _, c := range registered() {
+		c.mutex.Lock()
+		c.size, c.ttl = size, ttl
+		c.evict()
+		c.mutex.Unlock()
+	}
+}
+
+// Invalidate removes the entries with one of the tags from all caches
+func Invalidate(tags ...string) {
+	for _, c := range registered() {
+		c.Invalidate(tags...)
+	}
+}
+
+// Purge removes all entries from all caches
+func Purge() {
+	for _, c := range registered() {
+		c.Invalidate(c.name)
+	}
+}
+
+// Get returns the value of a key if it is cached and did not expire
+func (c *Cache) Get(key string) (value interface{}, found bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, found := c.entries[key]
+	if found && time.Now().After(element.Value.(*entry).expiresAt) {
+		c.remove(element)
+		found = false
+	}
+	if !found {
+		metrics.CacheLookups.Inc(c.name, "miss")
+		return nil, false
+	}
+	metrics.CacheLookups.Inc(c.name, "hit")
+	c.order.MoveToFront(element)
+	return element.Value.(*entry).value, true
+}
+
+// Generation returns the current generation of the cache, it must be taken before the value that is passed to Set is read
+func (c *Cache) Generation() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.generation
+}
+
+// Set caches a value with the tags it depends on, unless the cache or one of the tags was invalidated
+// after the generation the value was read in. It expires after the ttl of the cache,
+// or earlier when maxAge is shorter, like for an access token that expires soon. A maxAge of 0 uses the ttl of the cache.
+func (c *Cache) Set(key string, value interface{}, generation uint64, maxAge time.Duration, tags ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cleared > generation {
+		return
+	}
+	for _, tag := range tags {
+		if c.invalidated[tag] > generation {
+			return
+		}
+	}
+	ttl := c.ttl
+	if maxAge > 0 && maxAge < ttl {
+		ttl = maxAge
+	}
+	if ttl <= 0 || c.size <= 0 {
+		return
+	}
+	if element, found := c.entries[key]; found {
+		c.remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, tags: tags, expiresAt: time.Now().Add(ttl)})
+	c.evict()
+}
+
+// Invalidate removes the entries with one of the tags, or all entries if one of the tags is the name of the cache
+func (c *Cache) Invalidate(tags ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	invalidated := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag == c.name {
+			c.clear()
+			return
+		}
+		invalidated[tag] = true
+	}
+	if len(c.invalidated)+len(tags) > c.size {
+		// Keep the memory bounded, clearing everything also refuses the values read before this invalidation
+		c.clear()
+		return
+	}
+	for tag := range invalidated {
+		c.invalidated[tag] = c.generation
+	}
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		for _, tag := range element.Value.(*entry).tags {
+			if invalidated[tag] {
+				c.remove(element)
+				break
+			}
+		}
+		element = next
+	}
+}
+
+// Len returns the number of cached entries, including the expired ones that were not removed yet
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// clear removes all entries and refuses the values read before the current generation, the caller must hold the mutex
+func (c *Cache) clear() {
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.invalidated = make(map[string]uint64)
+	c.cleared = c.generation
+}
+
+// remove removes an entry, the caller must hold the mutex
+func (c *Cache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry).key)
+}
+
+// evict removes the least recently used entries until the cache fits its size, the caller must hold the mutex
+func (c *Cache) evict() {
+	for c.order.Len() > c.size && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
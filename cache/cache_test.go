@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	c := New("test")
+	c.Set("token", "alice", c.Generation(), 0, "user:alice", "client:myorg")
+	c.Set("other", "bob", c.Generation(), 0, "user:bob")
+
+	value, found := c.Get("token")
+	assert.True(t, found)
+	assert.Equal(t, "alice", value)
+
+	Invalidate("client:myorg")
+	_, found = c.Get("token")
+	assert.False(t, found, "an entry is invalidated by any of its tags")
+	_, found = c.Get("other")
+	assert.True(t, found)
+
+	Invalidate("test")
+	assert.Equal(t, 0, c.Len(), "invalidating the name of the cache removes all entries")
+}
+
+func TestCacheExpiration(t *testing.T) {
+	c := New("expiration")
+	c.Set("short", 1, c.Generation(), time.Millisecond)
+	c.Set("long", 2, c.Generation(), time.Hour)
+	time.Sleep(5 * time.Millisecond)
+	_, found := c.Get("short")
+	assert.False(t, found)
+	_, found = c.Get("long")
+	assert.True(t, found)
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := New("eviction")
+	defer Configure(DefaultSize, DefaultTTL)
+	Configure(2, time.Minute)
+	c.Set("a", 1, c.Generation(), 0)
+	c.Set("b", 2, c.Generation(), 0)
+	c.Get("a")
+	c.Set("c", 3, c.Generation(), 0)
+	_, found := c.Get("b")
+	assert.False(t, found, "the least recently used entry is evicted")
+	_, found = c.Get("a")
+	assert.True(t, found)
+
+	Configure(2, 0)
+	c.Set("d", 4, c.Generation(), 0)
+	_, found = c.Get("d")
+	assert.False(t, found, "a ttl of 0 disables the cache")
+}
+
+func TestCacheInvalidationDuringLookup(t *testing.T) {
+	c := New("lookup")
+	generation := c.Generation()
+	// The value is read from the database, then it is changed and invalidated before it is cached
+	c.Invalidate("user:alice")
+	c.Set("token", "alice", generation, 0, "user:alice")
+	_, found := c.Get("token")
+	assert.False(t, found, "a value read before an invalidation of its tags is not cached")
+
+	c.Set("other", "bob", generation, 0, "user:bob")
+	_, found = c.Get("other")
+	assert.True(t, found, "an invalidation of other tags does not refuse the value")
+
+	generation = c.Generation()
+	c.Invalidate("lookup")
+	c.Set("other", "bob", generation, 0, "user:bob")
+	_, found = c.Get("other")
+	assert.False(t, found, "a value read before the cache was cleared is not cached")
+
+	c.Set("token", "alice", c.Generation(), 0, "user:alice")
+	_, found = c.Get("token")
+	assert.True(t, found, "a value read after the invalidation is cached")
+}
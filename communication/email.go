@@ -3,42 +3,52 @@ package communication
 import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/go-gomail/gomail"
+	"github.com/itsyouonline/identityserver/metrics"
 )
 
-//EmailService defines an email communication channel
+//EmailService defines an email communication channel, an email has a plain text and an html body
 type EmailService interface {
-	Send(recipients []string, subject string, message string) (err error)
+	Send(recipients []string, subject string, text string, html string) (err error)
 }
 
 //DevEmailService is the implementation of an EmailService suitable for use in local development environments
 type DevEmailService struct{}
 
 //Send sends an Email
-func (s *DevEmailService) Send(recipients []string, subject string, message string) (err error) {
-	log.Infof("In production an email would be sent to %s with the following content:\n%s", recipients, message)
+func (s *DevEmailService) Send(recipients []string, subject string, text string, html string) (err error) {
+	log.Infof("In production an email would be sent to %s with the following content:\n%s", recipients, text)
+	metrics.EmailsSent.Inc("dev", metrics.Result(nil))
 	return
 }
 
 //SMTPEmailService implements an email service using plain old SMTP
 type SMTPEmailService struct {
-	dialer *gomail.Dialer
+	dialer  *gomail.Dialer
+	from    string
+	replyTo string
 }
 
-//NewSMTPEmailService creates a nes SMTPEmailService
-func NewSMTPEmailService(host string, port int, user string, password string) (service *SMTPEmailService) {
+//NewSMTPEmailService creates a new SMTPEmailService, the emails are sent from the from address
+//and the answers go to replyTo if it is not empty
+func NewSMTPEmailService(host string, port int, user string, password string, from string, replyTo string) (service *SMTPEmailService) {
 	dialer := gomail.NewDialer(host, port, user, password)
-	service = &SMTPEmailService{dialer: dialer}
+	service = &SMTPEmailService{dialer: dialer, from: from, replyTo: replyTo}
 	return
 }
 
-//Send sends an Email
-func (s *SMTPEmailService) Send(recipients []string, subject string, message string) (err error) {
+//Send sends an Email as a multipart message with the text and the html alternatives
+func (s *SMTPEmailService) Send(recipients []string, subject string, text string, html string) (err error) {
 	gomsg := gomail.NewMessage()
 	gomsg.SetHeader("Subject", subject)
-	gomsg.SetHeader("From", "noreply@itsyou.online")
+	gomsg.SetHeader("From", s.from)
+	if s.replyTo != "" {
+		gomsg.SetHeader("Reply-To", s.replyTo)
+	}
 	gomsg.SetHeader("To", recipients...)
-	gomsg.SetBody("text/html", message)
+	gomsg.SetBody("text/plain", text)
+	gomsg.AddAlternative("text/html", html)
 	err = s.dialer.DialAndSend(gomsg)
+	metrics.EmailsSent.Inc("smtp", metrics.Result(err))
 	if err != nil {
 		log.Error("Failed to send email ", err)
 	}
@@ -0,0 +1,144 @@
+package communication
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/emailoutbox"
+)
+
+const (
+	// EmailDeliveryInterval is how often the outbox is checked for due emails
+	EmailDeliveryInterval = 10 * time.Second
+	// MaxEmailAttempts is the number of times an email is sent before it fails
+	MaxEmailAttempts = 10
+	// emailRetryDelay is the delay after the first failed attempt, it doubles after every attempt up to maxEmailRetryDelay
+	emailRetryDelay    = 30 * time.Second
+	maxEmailRetryDelay = time.Hour
+	// emailClaimDuration is how long the claimed emails are postponed, sending a batch takes less
+	emailClaimDuration = 10 * time.Minute
+	// emailBatchSize is the number of emails claimed at once
+	emailBatchSize = 20
+)
+
+// EmailRetention is how long an email is kept in the outbox, whatever its status
+var EmailRetention = 7 * 24 * time.Hour
+
+// OutboxEmailService is an EmailService that stores the emails in the outbox,
+// Deliver hands them to the service that actually sends them
+type OutboxEmailService struct {
+	backend db.Backend
+	// due wakes up Deliver when an email is stored, so it does not wait for the next interval
+	due chan struct{}
+}
+
+// NewOutboxEmailService creates an OutboxEmailService storing the emails in the database of a backend
+func NewOutboxEmailService(backend db.Backend) *OutboxEmailService {
+	return &OutboxEmailService{backend: backend, due: make(chan struct{}, 1)}
+}
+
+// Send stores an email in the outbox, it is sent in the background
+func (s *OutboxEmailService) Send(recipients []string, subject string, text string, html string) (err error) {
+	r, release, err := db.NewBackgroundRequest(s.backend, "")
+	if err != nil {
+		return
+	}
+	defer release()
+	now := time.Now()
+	email := &emailoutbox.Email{
+		Recipients:  recipients,
+		Subject:     subject,
+		Text:        text,
+		HTML:        html,
+		Status:      emailoutbox.StatusPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(EmailRetention),
+	}
+	if err = emailoutbox.NewManager(r).Save(email); err != nil {
+		log.Error("Failed to store the email in the outbox: ", err)
+		return
+	}
+	select {
+	case s.due <- struct{}{}:
+	default:
+	}
+	return
+}
+
+// Deliver sends the due emails of the outbox with the sender until stop is closed
+func (s *OutboxEmailService) Deliver(sender EmailService, stop <-chan struct{}) {
+	ticker := time.NewTicker(EmailDeliveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-s.due:
+		}
+		s.deliverDue(sender)
+	}
+}
+
+// deliverDue sends the emails that are due until none are left
+func (s *OutboxEmailService) deliverDue(sender EmailService) {
+	r, release, err := db.NewBackgroundRequest(s.backend, "")
+	if err != nil {
+		log.Error("Failed to send the emails: ", err)
+		return
+	}
+	defer release()
+	mgr := emailoutbox.NewManager(r)
+	for {
+		// The claimed emails are sent again if this instance stops before it stored the result
+		emails, err := mgr.Claim(time.Now().Add(emailClaimDuration), emailBatchSize)
+		if err != nil {
+			log.Error("Failed to claim the due emails: ", err)
+			return
+		}
+		for i := range emails {
+			email := &emails[i]
+			attemptEmail(sender, email)
+			if err = mgr.Update(email); err != nil {
+				log.Error("Failed to store the result of email ", email.ID.Hex(), ": ", err)
+			}
+		}
+		if len(emails) < emailBatchSize {
+			return
+		}
+	}
+}
+
+// attemptEmail sends an email and updates it with the result, a failed email is retried with a growing delay
+func attemptEmail(sender EmailService, email *emailoutbox.Email) {
+	email.Attempts++
+	err := sender.Send(email.Recipients, email.Subject, email.Text, email.HTML)
+	if err == nil {
+		email.Status = emailoutbox.StatusSent
+		email.SentAt = time.Now()
+		email.LastError = ""
+		email.Text = ""
+		email.HTML = ""
+		return
+	}
+	email.LastError = err.Error()
+	if email.Attempts >= MaxEmailAttempts {
+		log.Errorf("Giving up on email %s to %s after %d attempts: %v", email.ID.Hex(), email.Recipients, email.Attempts, err)
+		email.Status = emailoutbox.StatusFailed
+		email.Text = ""
+		email.HTML = ""
+		return
+	}
+	email.NextAttempt = time.Now().Add(emailBackoff(email.Attempts))
+}
+
+// emailBackoff returns the delay before the next attempt after a number of failed attempts
+func emailBackoff(attempts int) time.Duration {
+	delay := emailRetryDelay << uint(attempts-1)
+	if delay <= 0 || delay > maxEmailRetryDelay {
+		return maxEmailRetryDelay
+	}
+	return delay
+}
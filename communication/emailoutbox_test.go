@@ -0,0 +1,163 @@
+package communication
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/emailoutbox"
+	"github.com/stretchr/testify/assert"
+)
+
+// smtpStandIn is a local smtp server that accepts every message, or rejects them while failing is set
+type smtpStandIn struct {
+	sync.Mutex
+	listener net.Listener
+	failing  bool
+	messages []string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) setFailing(failing bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.failing = failing
+}
+
+func (s *smtpStandIn) received() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string{}, s.messages...)
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL"):
+			s.Lock()
+			failing := s.failing
+			s.Unlock()
+			if failing {
+				reply("451 try again later")
+				continue
+			}
+			reply("250 OK")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 go ahead")
+			message := ""
+			for {
+				line, err = reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				message += line
+			}
+			s.Lock()
+			s.messages = append(s.messages, message)
+			s.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, emailBackoff(1))
+	assert.Equal(t, 2*time.Minute, emailBackoff(3))
+	assert.Equal(t, maxEmailRetryDelay, emailBackoff(MaxEmailAttempts))
+}
+
+func TestOutboxEmailService(t *testing.T) {
+	server := newSMTPStandIn(t)
+	defer server.listener.Close()
+	server.setFailing(true)
+	sender := NewSMTPEmailService("127.0.0.1", server.port(), "", "", "noreply@example.com", "support@example.com")
+
+	backend := db.NewMemoryBackend()
+	outbox := NewOutboxEmailService(backend)
+	assert.NoError(t, outbox.Send([]string{"bob@example.com"}, "Welcome", "Hello bob", "<p>Hello bob</p>"))
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	mgr := emailoutbox.NewManager(r)
+	pending, err := mgr.Claim(time.Now(), 10)
+	if !assert.NoError(t, err) || !assert.Len(t, pending, 1) {
+		return
+	}
+
+	outbox.deliverDue(sender)
+	email, err := mgr.Get(pending[0].ID.Hex())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, emailoutbox.StatusPending, email.Status, "a failed email is retried")
+	assert.Equal(t, 1, email.Attempts)
+	assert.NotEmpty(t, email.LastError)
+	assert.True(t, email.NextAttempt.After(time.Now()))
+	assert.Empty(t, server.received())
+
+	server.setFailing(false)
+	attemptEmail(sender, email)
+	assert.Equal(t, emailoutbox.StatusSent, email.Status)
+	assert.Equal(t, 2, email.Attempts)
+	assert.Empty(t, email.HTML, "the body is not kept once the email is sent")
+	if messages := server.received(); assert.Len(t, messages, 1) {
+		message := messages[0]
+		assert.Contains(t, message, "From: noreply@example.com")
+		assert.Contains(t, message, "Reply-To: support@example.com")
+		assert.Contains(t, message, "Content-Type: multipart/alternative")
+		assert.Contains(t, message, "Hello bob")
+		assert.Contains(t, message, "<p>Hello bob</p>")
+	}
+
+	email.Status = emailoutbox.StatusPending
+	email.Attempts = MaxEmailAttempts - 1
+	server.setFailing(true)
+	attemptEmail(sender, email)
+	assert.Equal(t, emailoutbox.StatusFailed, email.Status, "the email fails when the attempts run out")
+}
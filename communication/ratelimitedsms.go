@@ -7,6 +7,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/itsyouonline/identityserver/db"
 	"github.com/itsyouonline/identityserver/db/smshistory"
+	"github.com/itsyouonline/identityserver/metrics"
 )
 
 var (
@@ -33,12 +34,13 @@ func NewRateLimitedSMSService(window int, maxSMS int, actualService SMSService)
 // Send checksif the message can be send according to the rate limiting rules, and then
 // deligates the acutal sender to the wrapped service. This uses a sliding window approach
 func (s *RateLimitedSMSService) Send(phonenumber string, message string) (err error) {
-	conn := db.NewSession()
-	if conn == nil {
-		return errors.New("Failed to get DB connection")
+	r, release, err := db.NewBackgroundRequest(db.DefaultBackend(), "")
+	if err != nil {
+		return err
 	}
+	defer release()
 
-	mgr := smshistory.NewManager(conn)
+	mgr := smshistory.NewManager(r)
 
 	sendCount, err := mgr.CountSMSHistorySince(phonenumber, time.Now().Add(-s.window))
 	if err != nil && !db.IsNotFound(err) {
@@ -49,6 +51,7 @@ func (s *RateLimitedSMSService) Send(phonenumber string, message string) (err er
 	// if we've send more or equal than max sms count msges already return an error
 	if sendCount >= s.maxSMS {
 		log.Info("Rate limiting sms sending to ", phonenumber, ", already sent ", sendCount, " SMS in the last ", s.window)
+		metrics.SMSRateLimited.Inc()
 		return ErrMaxSMS
 	}
 
@@ -58,6 +61,24 @@ func (s *RateLimitedSMSService) Send(phonenumber string, message string) (err er
 		return err
 	}
 
-	// Send the actual sms
-	return s.actualService.Send(phonenumber, message)
+	router, routed := s.actualService.(*RoutingSMSService)
+	if !routed {
+		// Send the actual sms
+		return s.actualService.Send(phonenumber, message)
+	}
+	// Record which providers were tried and the status of the sms
+	routing, err := router.SendRouted(phonenumber, message, record.ID.Hex())
+	record.Route = routing.Route
+	record.Provider = routing.Provider
+	record.FailedProviders = routing.Failed
+	record.MessageID = routing.MessageID
+	if err != nil {
+		record.SetStatus(smshistory.StatusFailed, err.Error())
+	} else if routing.MessageID != "" {
+		record.SetStatus(smshistory.StatusSent, "")
+	}
+	if updateErr := mgr.UpdateSMSHistory(record); updateErr != nil {
+		log.Error("Failed to record the routing of the sms: ", updateErr)
+	}
+	return err
 }
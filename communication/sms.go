@@ -1,13 +1,23 @@
 package communication
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/db/smshistory"
+	"github.com/itsyouonline/identityserver/metrics"
 )
 
 //SMSService defines an sms communication channel
@@ -15,15 +25,35 @@ type SMSService interface {
 	Send(phonenumber string, message string) (err error)
 }
 
+//TrackedSMSService is an SMSService of which the delivery of the sms can be followed
+type TrackedSMSService interface {
+	SMSService
+	// SendTracked sends an sms and returns the id the provider gave it,
+	// the status callbacks of the provider refer to the sms with the reference
+	SendTracked(phonenumber string, message string, reference string) (messageID string, err error)
+}
+
 //TwilioSMSService is an SMS communication channel using Twilio
 type TwilioSMSService struct {
 	AccountSID          string
 	AuthToken           string
 	MessagingServiceSID string
+	// StatusCallbackURL is where twilio posts the delivery status of the sms, the delivery is not followed if it is empty
+	StatusCallbackURL string
 }
 
+// TwilioSignatureHeader holds the signature of the requests twilio makes to the status callback
+const TwilioSignatureHeader = "X-Twilio-Signature"
+
 //Send sends an SMS
 func (s *TwilioSMSService) Send(phonenumber string, message string) (err error) {
+	_, err = s.SendTracked(phonenumber, message, "")
+	return
+}
+
+//SendTracked sends an SMS and asks twilio to report its delivery status
+func (s *TwilioSMSService) SendTracked(phonenumber string, message string, reference string) (messageID string, err error) {
+	defer func() { metrics.SMSSent.Inc("twilio", metrics.Result(err)) }()
 	client := &http.Client{}
 
 	data := url.Values{
@@ -31,6 +61,9 @@ func (s *TwilioSMSService) Send(phonenumber string, message string) (err error)
 		"To":   {phonenumber},
 		"Body": {message},
 	}
+	if s.StatusCallbackURL != "" && reference != "" {
+		data.Set("StatusCallback", s.StatusCallbackURL+"?reference="+url.QueryEscape(reference))
+	}
 
 	req, err := http.NewRequest("POST", "https://api.twilio.com/2010-04-01/Accounts/"+s.AccountSID+"/Messages.json", strings.NewReader(data.Encode()))
 	if err != nil {
@@ -46,22 +79,92 @@ func (s *TwilioSMSService) Send(phonenumber string, message string) (err error)
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
 	if resp.StatusCode != http.StatusCreated {
 		log.Error("Problem when sending sms via Twilio: ", resp.StatusCode, "\n", string(body))
 		err = errors.New("Error sending sms")
+		return
+	}
+	created := struct {
+		Sid string `json:"sid"`
+	}{}
+	if err = json.Unmarshal(body, &created); err != nil {
+		log.Error("Failed to read the id of the sms sent via Twilio: ", err)
+		err = nil
 	}
+	messageID = created.Sid
 	log.Infof("SMS: sms sent to %s", phonenumber)
 	return
 }
 
+//ParseStatusCallback checks the signature of a status callback of twilio and returns the status it reports
+func (s *TwilioSMSService) ParseStatusCallback(r *http.Request) (update SMSStatusUpdate, err error) {
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+	// Twilio signs the url it posted to, with the query, followed by the posted parameters
+	signedURL := s.StatusCallbackURL
+	if r.URL.RawQuery != "" {
+		signedURL += "?" + r.URL.RawQuery
+	}
+	expected := TwilioSignature(s.AuthToken, signedURL, r.PostForm)
+	if s.StatusCallbackURL == "" || !hmac.Equal([]byte(expected), []byte(r.Header.Get(TwilioSignatureHeader))) {
+		err = ErrInvalidSignature
+		return
+	}
+	update.Reference = r.URL.Query().Get("reference")
+	update.MessageID = r.PostForm.Get("MessageSid")
+	switch r.PostForm.Get("MessageStatus") {
+	case "delivered":
+		update.Status = smshistory.StatusDelivered
+	case "undelivered", "failed":
+		update.Status = smshistory.StatusFailed
+		if code := r.PostForm.Get("ErrorCode"); code != "" {
+			update.Detail = "Twilio error " + code
+		}
+	default:
+		update.Status = smshistory.StatusSent
+	}
+	return
+}
+
+//TwilioSignature returns the signature twilio adds to a request: the base64 encoded HMAC-SHA1 with the auth token
+// of the url followed by the names and values of the posted parameters sorted by name
+func TwilioSignature(authToken string, url string, params url.Values) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(url))
+	for _, name := range names {
+		for _, value := range params[name] {
+			mac.Write([]byte(name + value))
+		}
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
 // SmsAeroSMSService is an SMS communication channel using smsaero
 type SmsAeroSMSService struct {
 	Username string
 	Password string
 	SenderId string
+	// StatusCallbackURL is where smsaero posts the delivery status of the sms, the delivery is not followed if it is empty
+	StatusCallbackURL string
 }
 
 func (s *SmsAeroSMSService) Send(phonenumber string, message string) (err error) {
+	_, err = s.SendTracked(phonenumber, message, "")
+	return
+}
+
+// SendTracked sends an sms and asks smsaero to report its delivery status
+func (s *SmsAeroSMSService) SendTracked(phonenumber string, message string, reference string) (messageID string, err error) {
+	defer func() { metrics.SMSSent.Inc("smsaero", metrics.Result(err)) }()
 	// remove the leading + from E.164 format for this provider
 	phonenumber = strings.TrimPrefix(phonenumber, "+")
 	client := &http.Client{}
@@ -78,6 +181,10 @@ func (s *SmsAeroSMSService) Send(phonenumber string, message string) (err error)
 	q.Add("from", s.SenderId)
 	q.Add("answer", "json")
 	q.Add("type", "6") // Indicate an "international" message
+	if s.StatusCallbackURL != "" && reference != "" {
+		// smsaero does not sign its callbacks, the reference is signed in the callback url instead
+		q.Add("callbackUrl", s.StatusCallbackURL+"?reference="+url.QueryEscape(reference)+"&signature="+s.sign(reference))
+	}
 	req.URL.RawQuery = q.Encode()
 
 	resp, err := client.Do(req)
@@ -87,29 +194,61 @@ func (s *SmsAeroSMSService) Send(phonenumber string, message string) (err error)
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
 	if resp.StatusCode != http.StatusOK {
 		log.Error("Problem when sending sms via SmsAero: ", resp.StatusCode, "\n", string(body))
 		err = errors.New("Error sending sms")
-	} else {
-		log.Debug("Sms areo response body:", "\n", string(body))
+		return
+	}
+	log.Debug("Sms areo response body:", "\n", string(body))
+	answer := struct {
+		Result string      `json:"result"`
+		ID     interface{} `json:"id"`
+	}{}
+	if json.Unmarshal(body, &answer) == nil {
+		if answer.Result != "" && answer.Result != "accepted" {
+			log.Error("SmsAero did not accept the sms: ", string(body))
+			err = errors.New("Error sending sms")
+			return
+		}
+		if answer.ID != nil {
+			messageID = fmt.Sprint(answer.ID)
+		}
 	}
 	log.Infof("SMS: sms sent to %s", phonenumber)
 	return
 }
 
-// TODO: Make more generic
-
-// SMSServiceProxySeparateRussia is an SMS communication channel that uses a separate
-// provider for russian phone numbers
-type SMSServiceProxySeparateRussia struct {
-	RussianSMSService SMSService
-	DefaultSMSService SMSService
+// sign returns the signature of the reference of an sms in the status callback url
+func (s *SmsAeroSMSService) sign(reference string) string {
+	mac := hmac.New(sha256.New, []byte(s.Password))
+	mac.Write([]byte(reference))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
-// Send proxies the send call to the right provider based on the phonenumber
-func (s *SMSServiceProxySeparateRussia) Send(phonenumber string, message string) (err error) {
-	if IsRussianMobileNumber(phonenumber) {
-		return s.RussianSMSService.Send(phonenumber, message)
+// ParseStatusCallback checks the signature of a status callback of smsaero and returns the status it reports
+func (s *SmsAeroSMSService) ParseStatusCallback(r *http.Request) (update SMSStatusUpdate, err error) {
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+	query := r.URL.Query()
+	update.Reference = query.Get("reference")
+	if s.StatusCallbackURL == "" || update.Reference == "" || !hmac.Equal([]byte(s.sign(update.Reference)), []byte(query.Get("signature"))) {
+		err = ErrInvalidSignature
+		return
 	}
-	return s.DefaultSMSService.Send(phonenumber, message)
+	update.MessageID = r.PostForm.Get("id")
+	// The status is a code in the current api and a text in the older one
+	switch status := r.PostForm.Get("status"); status {
+	case "1", "delivery success":
+		update.Status = smshistory.StatusDelivered
+	case "2", "6", "delivery failure", "smsc reject":
+		update.Status = smshistory.StatusFailed
+		update.Detail = "SmsAero status " + status
+	default:
+		update.Status = smshistory.StatusSent
+	}
+	return
 }
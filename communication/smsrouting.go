@@ -0,0 +1,100 @@
+package communication
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// SMSRouting describes how an sms was sent
+type SMSRouting struct {
+	// Route is the phone number prefix of the route that matched, empty if the default providers were used
+	Route string
+	// Provider accepted the sms, it is empty if every provider failed
+	Provider string
+	// Failed lists the providers that returned an error, in the order they were tried
+	Failed []string
+	// MessageID is the id the provider gave the sms, it is empty if the provider does not report the status
+	MessageID string
+}
+
+// RoutingSMSService sends an sms with the providers of the route with the longest prefix of the phone number,
+// or with the default providers if no route matches. When a provider fails the next one is tried.
+type RoutingSMSService struct {
+	providers        map[string]SMSService
+	defaultProviders []string
+	routes           map[string][]string
+	// prefixes of the routes, the longest first
+	prefixes []string
+}
+
+// NewRoutingSMSService creates a RoutingSMSService, providers holds the registered sms services by name.
+// Every provider the default providers and the routes use must be registered.
+func NewRoutingSMSService(providers map[string]SMSService, defaultProviders []string, routes map[string][]string) (*RoutingSMSService, error) {
+	if len(defaultProviders) == 0 {
+		return nil, errors.New("No default sms providers")
+	}
+	s := &RoutingSMSService{providers: providers, defaultProviders: defaultProviders, routes: routes}
+	check := func(names []string) error {
+		for _, name := range names {
+			if _, registered := providers[name]; !registered {
+				return fmt.Errorf("The sms provider %s is not configured", name)
+			}
+		}
+		return nil
+	}
+	if err := check(defaultProviders); err != nil {
+		return nil, err
+	}
+	for prefix, names := range routes {
+		if len(names) == 0 {
+			return nil, fmt.Errorf("The sms route %s has no providers", prefix)
+		}
+		if err := check(names); err != nil {
+			return nil, err
+		}
+		s.prefixes = append(s.prefixes, prefix)
+	}
+	sort.Slice(s.prefixes, func(i, j int) bool { return len(s.prefixes[i]) > len(s.prefixes[j]) })
+	return s, nil
+}
+
+// Route returns the prefix of the route of a phone number and its providers in the order they are tried
+func (s *RoutingSMSService) Route(phonenumber string) (prefix string, providers []string) {
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(phonenumber, prefix) {
+			return prefix, s.routes[prefix]
+		}
+	}
+	return "", s.defaultProviders
+}
+
+// Send sends an SMS
+func (s *RoutingSMSService) Send(phonenumber string, message string) (err error) {
+	_, err = s.SendRouted(phonenumber, message, "")
+	return
+}
+
+// SendRouted sends an sms and returns how it was routed, the error of the last provider is returned if they all fail.
+// The providers that report the delivery status pass the reference back to the status callback.
+func (s *RoutingSMSService) SendRouted(phonenumber string, message string, reference string) (routing SMSRouting, err error) {
+	route, providers := s.Route(phonenumber)
+	routing.Route = route
+	for _, name := range providers {
+		if tracked, ok := s.providers[name].(TrackedSMSService); ok && reference != "" {
+			routing.MessageID, err = tracked.SendTracked(phonenumber, message, reference)
+		} else {
+			err = s.providers[name].Send(phonenumber, message)
+		}
+		if err == nil {
+			routing.Provider = name
+			return
+		}
+		routing.Failed = append(routing.Failed, name)
+		log.Warnf("SMS: %s failed to send an sms to %s: %v", name, phonenumber, err)
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package communication
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/smshistory"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMSService records the phone numbers it sent an sms to, or fails if err is set
+type fakeSMSService struct {
+	err  error
+	sent []string
+}
+
+func (s *fakeSMSService) Send(phonenumber string, message string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, phonenumber)
+	return nil
+}
+
+func TestRoutingSMSService(t *testing.T) {
+	twilio, smsaero, dev := &fakeSMSService{}, &fakeSMSService{}, &fakeSMSService{}
+	providers := map[string]SMSService{"twilio": twilio, "smsaero": smsaero, "dev": dev}
+	router, err := NewRoutingSMSService(providers, []string{"twilio"},
+		map[string][]string{"+7": {"smsaero", "twilio"}, "+79": {"dev"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	prefix, route := router.Route("+32492440022")
+	assert.Equal(t, "", prefix)
+	assert.Equal(t, []string{"twilio"}, route)
+	prefix, route = router.Route("+79412651619")
+	assert.Equal(t, "+79", prefix, "the longest prefix is used")
+	assert.Equal(t, []string{"dev"}, route)
+
+	smsaero.err = errors.New("gateway unavailable")
+	routing, err := router.SendRouted("+72891254882", "code", "")
+	assert.NoError(t, err)
+	assert.Equal(t, SMSRouting{Route: "+7", Provider: "twilio", Failed: []string{"smsaero"}}, routing)
+	assert.Equal(t, []string{"+72891254882"}, twilio.sent, "the next provider is tried when one fails")
+
+	twilio.err = errors.New("invalid number")
+	routing, err = router.SendRouted("+72891254882", "code", "")
+	assert.EqualError(t, err, "invalid number")
+	assert.Empty(t, routing.Provider)
+	assert.Equal(t, []string{"smsaero", "twilio"}, routing.Failed)
+
+	_, err = NewRoutingSMSService(providers, []string{"nexmo"}, nil)
+	assert.Error(t, err, "every provider must be registered")
+	_, err = NewRoutingSMSService(providers, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestRateLimitedSMSServiceRecordsRouting(t *testing.T) {
+	twilio, smsaero := &fakeSMSService{}, &fakeSMSService{err: errors.New("gateway unavailable")}
+	router, err := NewRoutingSMSService(map[string]SMSService{"twilio": twilio, "smsaero": smsaero},
+		[]string{"twilio"}, map[string][]string{"+7": {"smsaero", "twilio"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	backend := db.NewMemoryBackend()
+	defaultBackend := db.DefaultBackend()
+	db.SetDefaultBackend(backend)
+	defer db.SetDefaultBackend(defaultBackend)
+
+	assert.NoError(t, NewRateLimitedSMSService(600, 5, router).Send("+72891254882", "code"))
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	history, err := smshistory.NewManager(r).GetByPhonenumbers([]string{"+72891254882"})
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "+7", history[0].Route)
+		assert.Equal(t, "twilio", history[0].Provider)
+		assert.Equal(t, []string{"smsaero"}, history[0].FailedProviders)
+	}
+}
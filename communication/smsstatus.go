@@ -0,0 +1,84 @@
+package communication
+
+import (
+	"errors"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/smshistory"
+	"github.com/itsyouonline/identityserver/metrics"
+)
+
+var (
+	// ErrInvalidSignature indicates that a status callback was not signed by the provider
+	ErrInvalidSignature = errors.New("invalid_signature")
+	// ErrUnknownSMSProvider indicates a status callback of a provider that is not configured or does not report the status
+	ErrUnknownSMSProvider = errors.New("unknown_provider")
+)
+
+// SMSStatusUpdate is a delivery status a provider reports
+type SMSStatusUpdate struct {
+	// Reference is the id of the sms in the sms history, it is part of the callback url
+	Reference string
+	MessageID string
+	// Status is one of the statuses of the sms history
+	Status string
+	Detail string
+}
+
+// SMSStatusCallbackProvider is a provider that reports the delivery status of the sms to a callback url
+type SMSStatusCallbackProvider interface {
+	// ParseStatusCallback checks the signature of a status callback and returns the status it reports
+	ParseStatusCallback(r *http.Request) (SMSStatusUpdate, error)
+}
+
+// SMSStatusReceiver is implemented by the sms services that store the delivery status the providers report
+type SMSStatusReceiver interface {
+	ReceiveStatus(provider string, r *http.Request) error
+}
+
+// ReceiveStatus stores the delivery status a provider reports in the sms history
+func (s *RoutingSMSService) ReceiveStatus(provider string, r *http.Request) error {
+	callbacks, ok := s.providers[provider].(SMSStatusCallbackProvider)
+	if !ok {
+		return ErrUnknownSMSProvider
+	}
+	update, err := callbacks.ParseStatusCallback(r)
+	if err != nil {
+		return err
+	}
+	metrics.SMSStatus.Inc(provider, update.Status)
+	return recordSMSStatus(r, provider, update)
+}
+
+// ReceiveStatus passes the status callbacks on to the actual service
+func (s *RateLimitedSMSService) ReceiveStatus(provider string, r *http.Request) error {
+	receiver, ok := s.actualService.(SMSStatusReceiver)
+	if !ok {
+		return ErrUnknownSMSProvider
+	}
+	return receiver.ReceiveStatus(provider, r)
+}
+
+// recordSMSStatus stores a delivery status in the sms history, the status of an unknown sms is ignored
+func recordSMSStatus(r *http.Request, provider string, update SMSStatusUpdate) error {
+	mgr := smshistory.NewManager(r)
+	sh, err := mgr.Get(update.Reference)
+	if db.IsNotFound(err) {
+		log.Debugf("SMS: ignoring the status of unknown sms %q of %s", update.Reference, provider)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The status can arrive before the provider and the message id are recorded
+	if (sh.Provider != "" && sh.Provider != provider) || (sh.MessageID != "" && update.MessageID != "" && sh.MessageID != update.MessageID) {
+		log.Debugf("SMS: ignoring the status of sms %s, it was sent by another provider or with another id", update.Reference)
+		return nil
+	}
+	if !sh.SetStatus(update.Status, update.Detail) {
+		return nil
+	}
+	return mgr.UpdateSMSHistory(sh)
+}
@@ -0,0 +1,119 @@
+package communication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/smshistory"
+	"github.com/stretchr/testify/assert"
+)
+
+// trackedSMSService is a fakeSMSService that gives the sms an id and parses the status callbacks like twilio
+type trackedSMSService struct {
+	*TwilioSMSService
+	fakeSMSService
+}
+
+func (s *trackedSMSService) Send(phonenumber string, message string) error {
+	return s.fakeSMSService.Send(phonenumber, message)
+}
+
+func (s *trackedSMSService) SendTracked(phonenumber string, message string, reference string) (string, error) {
+	return "SM" + reference, s.fakeSMSService.Send(phonenumber, message)
+}
+
+func twilioCallback(authToken string, target string, form url.Values) *http.Request {
+	r := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set(TwilioSignatureHeader, TwilioSignature(authToken, target, form))
+	return r
+}
+
+func TestTwilioSignature(t *testing.T) {
+	// The example of the twilio documentation
+	params := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	assert.Equal(t, "0/KCTR6DLpKmkAf8muzZqo1nDgQ=", TwilioSignature("12345", "https://mycompany.com/myapp.php?foo=1&bar=2", params))
+}
+
+func TestTwilioParseStatusCallback(t *testing.T) {
+	twilio := &TwilioSMSService{AuthToken: "token", StatusCallbackURL: "https://itsyou.online/sms/callback/twilio"}
+	form := url.Values{"MessageSid": {"SM123"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30003"}}
+	update, err := twilio.ParseStatusCallback(twilioCallback("token", twilio.StatusCallbackURL+"?reference=abc", form))
+	assert.NoError(t, err)
+	assert.Equal(t, SMSStatusUpdate{Reference: "abc", MessageID: "SM123", Status: smshistory.StatusFailed, Detail: "Twilio error 30003"}, update)
+
+	_, err = twilio.ParseStatusCallback(twilioCallback("other", twilio.StatusCallbackURL+"?reference=abc", form))
+	assert.Equal(t, ErrInvalidSignature, err)
+	tampered := twilioCallback("token", twilio.StatusCallbackURL+"?reference=abc", form)
+	tampered.URL.RawQuery = "reference=def"
+	_, err = twilio.ParseStatusCallback(tampered)
+	assert.Equal(t, ErrInvalidSignature, err, "the reference is signed")
+}
+
+func TestSmsAeroParseStatusCallback(t *testing.T) {
+	smsaero := &SmsAeroSMSService{Password: "password", StatusCallbackURL: "https://itsyou.online/sms/callback/smsaero"}
+	callback := func(reference string, signature string, status string) *http.Request {
+		query := url.Values{"reference": {reference}, "signature": {signature}}
+		r := httptest.NewRequest("POST", smsaero.StatusCallbackURL+"?"+query.Encode(), strings.NewReader(url.Values{"id": {"42"}, "status": {status}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	update, err := smsaero.ParseStatusCallback(callback("abc", smsaero.sign("abc"), "1"))
+	assert.NoError(t, err)
+	assert.Equal(t, SMSStatusUpdate{Reference: "abc", MessageID: "42", Status: smshistory.StatusDelivered}, update)
+
+	_, err = smsaero.ParseStatusCallback(callback("def", smsaero.sign("abc"), "1"))
+	assert.Equal(t, ErrInvalidSignature, err)
+}
+
+func TestReceiveStatus(t *testing.T) {
+	twilio := &trackedSMSService{TwilioSMSService: &TwilioSMSService{AuthToken: "token", StatusCallbackURL: "https://itsyou.online/sms/callback/twilio"}}
+	router, err := NewRoutingSMSService(map[string]SMSService{"twilio": twilio, "dev": &fakeSMSService{}}, []string{"twilio"}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	backend := db.NewMemoryBackend()
+	defaultBackend := db.DefaultBackend()
+	db.SetDefaultBackend(backend)
+	defer db.SetDefaultBackend(defaultBackend)
+
+	service := NewRateLimitedSMSService(600, 5, router).(*RateLimitedSMSService)
+	assert.NoError(t, service.Send("+32492440022", "code"))
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	mgr := smshistory.NewManager(r)
+	history, err := mgr.GetByPhonenumbers([]string{"+32492440022"})
+	if !assert.NoError(t, err) || !assert.Len(t, history, 1) {
+		return
+	}
+	sms := history[0]
+	assert.Equal(t, "SM"+sms.ID.Hex(), sms.MessageID)
+	assert.Equal(t, smshistory.StatusSent, sms.Status)
+
+	callback := func(status string) *http.Request {
+		form := url.Values{"MessageSid": {sms.MessageID}, "MessageStatus": {status}}
+		request := twilioCallback("token", twilio.StatusCallbackURL+"?reference="+sms.ID.Hex(), form)
+		db.OpenBackend(backend, request)
+		return request
+	}
+	assert.NoError(t, service.ReceiveStatus("twilio", callback("delivered")))
+	assert.NoError(t, service.ReceiveStatus("twilio", callback("sent")), "a late status is acknowledged")
+	stored, err := mgr.Get(sms.ID.Hex())
+	if assert.NoError(t, err) {
+		assert.Equal(t, smshistory.StatusDelivered, stored.Status, "a late status does not replace the delivery")
+	}
+	assert.Equal(t, ErrUnknownSMSProvider, service.ReceiveStatus("dev", callback("delivered")))
+}
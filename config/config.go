@@ -0,0 +1,421 @@
+// Package config contains the settings of the identity server.
+// The settings are read from a YAML or TOML file and the IYO_* environment variables,
+// the command line flags override both.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/itsyouonline/identityserver/cache"
+	"github.com/itsyouonline/identityserver/credentials/password"
+	"github.com/itsyouonline/identityserver/credentials/password/keyderivation"
+	"github.com/itsyouonline/identityserver/db/audit"
+	"github.com/itsyouonline/identityserver/https"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds all settings of the identity server
+type Config struct {
+	Debug            bool   `yaml:"debug" toml:"debug"`
+	BindAddress      string `yaml:"bind" toml:"bind"`
+	ConnectionString string `yaml:"connectionstring" toml:"connectionstring" secret:"true"`
+	// TestEnv enables the endpoints to forget accounts, it must never be set in production
+	TestEnv               bool   `yaml:"testenv" toml:"testenv"`
+	UpstreamProvidersFile string `yaml:"upstreamprovidersfile" toml:"upstreamprovidersfile"`
+	// ShutdownTimeout is how long the requests that are in progress get to finish when the server is stopped
+	ShutdownTimeout Duration `yaml:"shutdowntimeout" toml:"shutdowntimeout"`
+
+	TLS       TLSConfig       `yaml:"tls" toml:"tls"`
+	Twilio    TwilioConfig    `yaml:"twilio" toml:"twilio"`
+	SmsAero   SmsAeroConfig   `yaml:"smsaero" toml:"smsaero"`
+	SMS       SMSConfig       `yaml:"sms" toml:"sms"`
+	SMTP      SMTPConfig      `yaml:"smtp" toml:"smtp"`
+	Password  PasswordConfig  `yaml:"password" toml:"password"`
+	OAuth     OAuthConfig     `yaml:"oauth" toml:"oauth"`
+	Sessions  SessionsConfig  `yaml:"sessions" toml:"sessions"`
+	RateLimit RateLimitConfig `yaml:"ratelimit" toml:"ratelimit"`
+	Cache     CacheConfig     `yaml:"cache" toml:"cache"`
+	Audit     AuditConfig     `yaml:"audit" toml:"audit"`
+	Metrics   MetricsConfig   `yaml:"metrics" toml:"metrics"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+}
+
+// TLSConfig holds the certificate the server listens with, the development certificate is used if they are empty
+type TLSConfig struct {
+	Cert          string `yaml:"cert" toml:"cert"`
+	Key           string `yaml:"key" toml:"key"`
+	IgnoreDevcert bool   `yaml:"ignoredevcert" toml:"ignoredevcert"`
+	// ReloadInterval is how often the certificate files are checked for changes, 0 only reloads them on SIGHUP
+	ReloadInterval Duration `yaml:"reloadinterval" toml:"reloadinterval"`
+	// MinVersion is the lowest TLS version that is accepted: 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `yaml:"minversion" toml:"minversion"`
+	// CipherSuites limits the cipher suites of TLS 1.0 - 1.2 by name, like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	CipherSuites []string `yaml:"ciphersuites" toml:"ciphersuites"`
+	// RedirectBind is the address of a plain http listener that redirects to https, like :80
+	RedirectBind string `yaml:"redirectbind" toml:"redirectbind"`
+}
+
+// TwilioConfig holds the twilio account used to send sms
+type TwilioConfig struct {
+	AccountSID          string `yaml:"accountsid" toml:"accountsid"`
+	AuthToken           string `yaml:"authtoken" toml:"authtoken" secret:"true"`
+	MessagingServiceSID string `yaml:"messagingservicesid" toml:"messagingservicesid"`
+}
+
+// SmsAeroConfig holds the SmsAero account used to send sms to russian phone numbers
+type SmsAeroConfig struct {
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password" secret:"true"`
+	SenderID string `yaml:"senderid" toml:"senderid"`
+}
+
+// SMSConfig holds the routing of the sms to the twilio, smsaero and dev providers
+type SMSConfig struct {
+	// Providers are tried in order until one of them sends the sms, for the phone numbers no route matches
+	Providers []string `yaml:"providers" toml:"providers"`
+	// Routes maps a phone number prefix like +7 to the providers of the numbers starting with it,
+	// the longest matching prefix is used
+	Routes map[string][]string `yaml:"routes" toml:"routes"`
+	// CallbackURL is the public url of the server the providers report the delivery status of the sms to,
+	// the status is not tracked if it is empty
+	CallbackURL string `yaml:"callbackurl" toml:"callbackurl"`
+}
+
+// SMTPConfig holds the smtp server used to send emails
+type SMTPConfig struct {
+	Server   string `yaml:"server" toml:"server"`
+	Port     int    `yaml:"port" toml:"port"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password" secret:"true"`
+	// From is the sender of the emails, ReplyTo is where the answers go if it is set
+	From    string `yaml:"from" toml:"from"`
+	ReplyTo string `yaml:"replyto" toml:"replyto"`
+}
+
+// PasswordConfig holds the password policy and hashing settings
+type PasswordConfig struct {
+	HashCost  int `yaml:"hashcost" toml:"hashcost"`
+	MinLength int `yaml:"minlength" toml:"minlength"`
+	// MinScore is the minimum strength score, from 0 (very weak) to 4 (very strong)
+	MinScore int `yaml:"minscore" toml:"minscore"`
+	// BreachedPasswordsFile contains sha1 hashes of breached passwords that are not allowed
+	BreachedPasswordsFile string `yaml:"breachedpasswordsfile" toml:"breachedpasswordsfile"`
+}
+
+// OAuthConfig holds the lifetime of the issued tokens
+type OAuthConfig struct {
+	AccessTokenExpiration Duration `yaml:"accesstokenexpiration" toml:"accesstokenexpiration"`
+}
+
+// SessionsConfig holds the lifetimes of the website sessions
+type SessionsConfig struct {
+	Registration Duration `yaml:"registration" toml:"registration"`
+	Interactive  Duration `yaml:"interactive" toml:"interactive"`
+	Login        Duration `yaml:"login" toml:"login"`
+	OAuth        Duration `yaml:"oauth" toml:"oauth"`
+	Upstream     Duration `yaml:"upstream" toml:"upstream"`
+}
+
+// RateLimitConfig holds the limits of the endpoints that send sms or emails
+type RateLimitConfig struct {
+	// Period and Limit apply per ip address to the rate limited endpoints like the sms code and magic link requests
+	Period Duration `yaml:"period" toml:"period"`
+	Limit  int      `yaml:"limit" toml:"limit"`
+	// SMSWindow and SMSMax apply per phone number to all sms that are sent
+	SMSWindow Duration `yaml:"smswindow" toml:"smswindow"`
+	SMSMax    int      `yaml:"smsmax" toml:"smsmax"`
+	// Store is where the requests are counted: database shares the counters between all instances, memory keeps them per instance
+	Store string `yaml:"store" toml:"store"`
+	// Login applies per ip address to the login and registration forms
+	Login RateConfig `yaml:"login" toml:"login"`
+	// Token applies per oauth client and per ip address to the token endpoints
+	Token RateConfig `yaml:"token" toml:"token"`
+	// API applies per user and per organization to the api
+	API RateConfig `yaml:"api" toml:"api"`
+}
+
+// RateConfig allows Limit requests per Period
+type RateConfig struct {
+	Period Duration `yaml:"period" toml:"period"`
+	Limit  int      `yaml:"limit" toml:"limit"`
+}
+
+// CacheConfig holds the limits of the caches of the access tokens, memberships and authorizations the api checks
+type CacheConfig struct {
+	// Size is the maximum number of entries of each cache
+	Size int `yaml:"size" toml:"size"`
+	// TTL is how long an entry is used, it bounds how long a change is missed when an invalidation is lost. 0 disables the caches.
+	TTL Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// AuditConfig holds the retention policies of the audit log
+type AuditConfig struct {
+	// Retention is how long the events are kept
+	Retention Duration `yaml:"retention" toml:"retention"`
+	// FailureRetention is how long the failed actions, like logins with a wrong password, are kept
+	FailureRetention Duration `yaml:"failureretention" toml:"failureretention"`
+}
+
+// MetricsConfig holds the listener of the Prometheus metrics endpoint
+type MetricsConfig struct {
+	// Bind is the address /metrics is served on, the metrics are not exposed if it is empty.
+	// It is a separate plain http listener so the metrics are not reachable through the public address.
+	Bind string `yaml:"bind" toml:"bind"`
+}
+
+// LogConfig holds the format of the log entries
+type LogConfig struct {
+	// Format is text or json, json is easier to index for log aggregators
+	Format string `yaml:"format" toml:"format"`
+}
+
+// Duration is a time.Duration written as a string like "10m" or "24h" in the configuration file
+type Duration time.Duration
+
+// UnmarshalText parses a duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default returns the settings used when nothing is configured
+func Default() *Config {
+	return &Config{
+		BindAddress:      ":8443",
+		ConnectionString: "127.0.0.1:27017",
+		ShutdownTimeout:  Duration(30 * time.Second),
+		TLS: TLSConfig{
+			ReloadInterval: Duration(time.Minute),
+			MinVersion:     "1.2",
+		},
+		SMTP: SMTPConfig{
+			Port: 587,
+			From: "noreply@itsyou.online",
+		},
+		Password: PasswordConfig{
+			HashCost:  keyderivation.DefaultCost,
+			MinLength: password.DefaultMinLength,
+			MinScore:  password.DefaultMinScore,
+		},
+		OAuth: OAuthConfig{
+			AccessTokenExpiration: Duration(24 * time.Hour),
+		},
+		Sessions: SessionsConfig{
+			Registration: Duration(10 * time.Minute),
+			Interactive:  Duration(10 * time.Minute),
+			Login:        Duration(5 * time.Minute),
+			OAuth:        Duration(10 * time.Minute),
+			Upstream:     Duration(10 * time.Minute),
+		},
+		RateLimit: RateLimitConfig{
+			Period:    Duration(10 * time.Minute),
+			Limit:     50,
+			SMSWindow: Duration(10 * time.Minute),
+			SMSMax:    5,
+			Store:     "database",
+			Login:     RateConfig{Period: Duration(time.Minute), Limit: 30},
+			Token:     RateConfig{Period: Duration(time.Minute), Limit: 300},
+			API:       RateConfig{Period: Duration(time.Minute), Limit: 600},
+		},
+		Cache: CacheConfig{
+			Size: cache.DefaultSize,
+			TTL:  Duration(cache.DefaultTTL),
+		},
+		Audit: AuditConfig{
+			Retention:        Duration(audit.Retention),
+			FailureRetention: Duration(audit.FailureRetention),
+		},
+		Log: LogConfig{
+			Format: "text",
+		},
+	}
+}
+
+// Load returns the default settings overridden by the configuration file, if any, and the environment
+func Load(file string) (c *Config, err error) {
+	c = Default()
+	if file != "" {
+		if err = c.loadFile(file); err != nil {
+			return
+		}
+	}
+	err = c.loadEnvironment()
+	return
+}
+
+// loadFile reads a .toml file as TOML and anything else as YAML
+func (c *Config) loadFile(file string) (err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if strings.ToLower(filepath.Ext(file)) == ".toml" {
+		_, err = toml.Decode(string(data), c)
+	} else {
+		err = yaml.UnmarshalStrict(data, c)
+	}
+	if err != nil {
+		err = fmt.Errorf("Invalid configuration file %s: %s", file, err)
+	}
+	return
+}
+
+// smsProviders are the names of the sms providers that can be routed to
+var smsProviders = []string{"twilio", "smsaero", "dev"}
+
+// SMSAccountConfigured checks if a twilio or smsaero account is configured,
+// the dev provider can only be used without one so the sms codes never end up in the logs in production
+func (c *Config) SMSAccountConfigured() bool {
+	return c.Twilio.AccountSID != "" || c.SmsAero.User != ""
+}
+
+// SMSRouting returns the providers of the phone numbers no route matches and the routes of the sms.
+// If no providers are configured, they are derived from the accounts: smsaero for the russian numbers
+// and twilio for the others, or the dev provider that logs the sms if there are no accounts.
+func (c *Config) SMSRouting() (providers []string, routes map[string][]string) {
+	if len(c.SMS.Providers) > 0 {
+		return c.SMS.Providers, c.SMS.Routes
+	}
+	routes = c.SMS.Routes
+	switch {
+	case c.Twilio.AccountSID != "" && c.SmsAero.User != "":
+		providers = []string{"twilio"}
+		if routes == nil {
+			routes = map[string][]string{"+7": {"smsaero", "twilio"}}
+		}
+	case c.Twilio.AccountSID != "":
+		providers = []string{"twilio"}
+	case c.SmsAero.User != "":
+		providers = []string{"smsaero"}
+	default:
+		providers = []string{"dev"}
+	}
+	return
+}
+
+// validateSMS checks that the sms routes have valid prefixes and only use known providers with an account
+func (c *Config) validateSMS(check func(ok bool, format string, args ...interface{})) {
+	known := func(provider string) bool {
+		for _, name := range smsProviders {
+			if name == provider {
+				return true
+			}
+		}
+		return false
+	}
+	checkProviders := func(setting string, providers []string) {
+		for _, provider := range providers {
+			check(known(provider), "%s: unknown sms provider %s, use %s", setting, provider, strings.Join(smsProviders, ", "))
+			check(provider != "twilio" || c.Twilio.AccountSID != "", "%s: twilio.accountsid is required to use twilio", setting)
+			check(provider != "smsaero" || c.SmsAero.User != "", "%s: smsaero.user is required to use smsaero", setting)
+			check(provider != "dev" || !c.SMSAccountConfigured(), "%s: dev can not be used when a twilio or smsaero account is configured", setting)
+		}
+	}
+	checkProviders("sms.providers", c.SMS.Providers)
+	prefixes := make([]string, 0, len(c.SMS.Routes))
+	for prefix := range c.SMS.Routes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		check(smsPrefix.MatchString(prefix), "sms.routes: %q is not a phone number prefix like +7", prefix)
+		check(len(c.SMS.Routes[prefix]) > 0, "sms.routes.%s has no providers", prefix)
+		checkProviders("sms.routes."+prefix, c.SMS.Routes[prefix])
+	}
+	if c.SMS.CallbackURL != "" {
+		callbackURL, err := url.Parse(c.SMS.CallbackURL)
+		check(err == nil && (callbackURL.Scheme == "https" || callbackURL.Scheme == "http") && callbackURL.Host != "",
+			"sms.callbackurl %q is not an absolute http or https url", c.SMS.CallbackURL)
+	}
+}
+
+// smsPrefix matches the start of a phone number in E.164 format
+var smsPrefix = regexp.MustCompile(`^\+[0-9]{1,15}$`)
+
+// Validate checks that the settings are usable, the server refuses to start otherwise
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.BindAddress != "", "bind can not be empty")
+	check(c.Metrics.Bind == "" || c.Metrics.Bind != c.BindAddress, "metrics.bind must differ from bind")
+	check(c.ConnectionString != "", "connectionstring can not be empty")
+	check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls.cert and tls.key must be set together")
+	_, err := https.ParseTLSVersion(c.TLS.MinVersion)
+	check(err == nil, "tls.minversion must be 1.0, 1.1, 1.2 or 1.3")
+	_, err = https.ParseCipherSuites(c.TLS.CipherSuites)
+	check(err == nil, "tls.ciphersuites: %v", err)
+	check(c.TLS.ReloadInterval >= 0, "tls.reloadinterval can not be negative")
+	check(c.TLS.RedirectBind == "" || c.TLS.RedirectBind != c.BindAddress, "tls.redirectbind must differ from bind")
+	check(c.ShutdownTimeout >= 0, "shutdowntimeout can not be negative")
+	check(c.Twilio.AccountSID == "" || c.Twilio.AuthToken != "", "twilio.authtoken is required with twilio.accountsid")
+	check(c.SmsAero.User == "" || c.SmsAero.Password != "", "smsaero.password is required with smsaero.user")
+	c.validateSMS(check)
+	check(c.SMTP.Server == "" || (c.SMTP.Port > 0 && c.SMTP.Port < 65536), "smtp.port %d is not a valid port", c.SMTP.Port)
+	_, err = mail.ParseAddress(c.SMTP.From)
+	check(err == nil, "smtp.from %q is not a valid email address", c.SMTP.From)
+	if c.SMTP.ReplyTo != "" {
+		_, err = mail.ParseAddress(c.SMTP.ReplyTo)
+		check(err == nil, "smtp.replyto %q is not a valid email address", c.SMTP.ReplyTo)
+	}
+	check(c.Password.MinLength > 0, "password.minlength must be at least 1")
+	check(c.Password.MinScore >= 0 && c.Password.MinScore <= 4, "password.minscore must be between 0 and 4")
+	check(c.OAuth.AccessTokenExpiration > 0, "oauth.accesstokenexpiration must be positive")
+	sessions := []struct {
+		name     string
+		lifetime Duration
+	}{
+		{"registration", c.Sessions.Registration},
+		{"interactive", c.Sessions.Interactive},
+		{"login", c.Sessions.Login},
+		{"oauth", c.Sessions.OAuth},
+		{"upstream", c.Sessions.Upstream},
+	}
+	for _, session := range sessions {
+		// The cookie max age is in seconds
+		check(session.lifetime >= Duration(time.Second), "sessions.%s must be at least 1s", session.name)
+	}
+	check(c.RateLimit.Period > 0 && c.RateLimit.Limit > 0, "ratelimit.period and ratelimit.limit must be positive")
+	check(c.RateLimit.SMSWindow > 0 && c.RateLimit.SMSMax > 0, "ratelimit.smswindow and ratelimit.smsmax must be positive")
+	check(c.RateLimit.Store == "database" || c.RateLimit.Store == "memory", "ratelimit.store must be database or memory")
+	rates := []struct {
+		name string
+		rate RateConfig
+	}{
+		{"login", c.RateLimit.Login},
+		{"token", c.RateLimit.Token},
+		{"api", c.RateLimit.API},
+	}
+	for _, r := range rates {
+		check(r.rate.Period > 0 && r.rate.Limit > 0, "ratelimit.%s.period and ratelimit.%s.limit must be positive", r.name, r.name)
+	}
+	check(c.Cache.Size >= 0 && c.Cache.TTL >= 0, "cache.size and cache.ttl can not be negative")
+	check(c.Audit.Retention > 0 && c.Audit.FailureRetention > 0, "audit.retention and audit.failureretention must be positive")
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format must be text or json")
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("Invalid configuration: " + strings.Join(problems, ", "))
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setEnv sets environment variables and returns a function that unsets them
+func setEnv(values map[string]string) func() {
+	for name, value := range values {
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name := range values {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func tempDir(t *testing.T) (dir string, remove func()) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	assert.NoError(t, Default().Validate())
+}
+
+func TestLoadYAML(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+	file := writeFile(t, dir, "identityserver.yaml", `
+bind: ":9000"
+smtp:
+  server: mail.example.com
+  port: 25
+oauth:
+  accesstokenexpiration: 2h
+`)
+	c, err := Load(file)
+	assert.NoError(t, err)
+	assert.Equal(t, ":9000", c.BindAddress)
+	assert.Equal(t, "mail.example.com", c.SMTP.Server)
+	assert.Equal(t, 25, c.SMTP.Port)
+	assert.Equal(t, Duration(2*time.Hour), c.OAuth.AccessTokenExpiration)
+	// Settings that are not in the file keep their default
+	assert.Equal(t, Default().Sessions, c.Sessions)
+
+	_, err = Load(writeFile(t, dir, "typo.yaml", "smtp:\n  sever: mail.example.com\n"))
+	assert.Error(t, err, "unknown settings are rejected")
+}
+
+func TestLoadTOML(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+	file := writeFile(t, dir, "identityserver.toml", `
+bind = ":9000"
+
+[sessions]
+login = "2m"
+
+[ratelimit]
+smsmax = 3
+`)
+	c, err := Load(file)
+	assert.NoError(t, err)
+	assert.Equal(t, ":9000", c.BindAddress)
+	assert.Equal(t, Duration(2*time.Minute), c.Sessions.Login)
+	assert.Equal(t, 3, c.RateLimit.SMSMax)
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+	file := writeFile(t, dir, "identityserver.yaml", "bind: \":9000\"\nsmtp:\n  port: 25\n")
+	secret := writeFile(t, dir, "smtppassword", "s3cret\n")
+	defer setEnv(map[string]string{
+		"IYO_SMTP_PORT":          "2525",
+		"IYO_SMTP_PASSWORD_FILE": secret,
+		"IYO_TESTENV":            "true",
+		"IYO_SESSIONS_LOGIN":     "1m",
+	})()
+
+	c, err := Load(file)
+	assert.NoError(t, err)
+	assert.Equal(t, ":9000", c.BindAddress)
+	assert.Equal(t, 2525, c.SMTP.Port, "the environment overrides the file")
+	assert.Equal(t, "s3cret", c.SMTP.Password)
+	assert.True(t, c.TestEnv)
+	assert.Equal(t, Duration(time.Minute), c.Sessions.Login)
+}
+
+func TestLoadEnvironmentErrors(t *testing.T) {
+	unset := setEnv(map[string]string{"IYO_SMTP_PORT": "smtp"})
+	_, err := Load("")
+	assert.Error(t, err)
+	unset()
+
+	defer setEnv(map[string]string{"IYO_SMTP_PASSWORD": "a", "IYO_SMTP_PASSWORD_FILE": "/nonexisting"})()
+	_, err = Load("")
+	assert.Error(t, err, "a secret can not be set twice")
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.TLS.Cert = "cert.pem"
+	c.Password.MinScore = 5
+	c.Sessions.Login = 0
+	c.Log.Format = "xml"
+	c.TLS.MinVersion = "1.4"
+	c.SMTP.ReplyTo = "support"
+	err := c.Validate()
+	assert.EqualError(t, err, "Invalid configuration: tls.cert and tls.key must be set together, "+
+		"tls.minversion must be 1.0, 1.1, 1.2 or 1.3, smtp.replyto \"support\" is not a valid email address, password.minscore must be between 0 and 4, sessions.login must be at least 1s, log.format must be text or json")
+}
+
+func TestSMSRouting(t *testing.T) {
+	c := Default()
+	providers, routes := c.SMSRouting()
+	assert.Equal(t, []string{"dev"}, providers)
+	assert.Empty(t, routes)
+
+	c.Twilio.AccountSID = "AC123"
+	c.Twilio.AuthToken = "token"
+	c.SmsAero.User = "user"
+	c.SmsAero.Password = "password"
+	providers, routes = c.SMSRouting()
+	assert.Equal(t, []string{"twilio"}, providers)
+	assert.Equal(t, map[string][]string{"+7": {"smsaero", "twilio"}}, routes, "the russian numbers go to smsaero like before")
+
+	c.SMS.Providers = []string{"smsaero", "twilio"}
+	c.SMS.Routes = map[string][]string{"+32": {"twilio"}}
+	providers, routes = c.SMSRouting()
+	assert.Equal(t, []string{"smsaero", "twilio"}, providers)
+	assert.Equal(t, map[string][]string{"+32": {"twilio"}}, routes)
+	assert.NoError(t, c.Validate())
+
+	c.SMS.CallbackURL = "https://itsyou.online"
+	assert.NoError(t, c.Validate())
+
+	c.SMS.Providers = []string{"twilio", "dev"}
+	assert.EqualError(t, c.Validate(), "Invalid configuration: sms.providers: dev can not be used when a twilio or smsaero account is configured",
+		"the sms codes are not logged in production")
+	c.SMS.Providers = []string{"smsaero", "twilio"}
+
+	c.SMS.Routes = map[string][]string{"32": {"nexmo"}, "+1": {}}
+	c.SMS.CallbackURL = "itsyou.online"
+	c.SmsAero.User = ""
+	assert.EqualError(t, c.Validate(), "Invalid configuration: sms.providers: smsaero.user is required to use smsaero, "+
+		"sms.routes.+1 has no providers, sms.routes: \"32\" is not a phone number prefix like +7, "+
+		"sms.routes.32: unknown sms provider nexmo, use twilio, smsaero, dev, "+
+		"sms.callbackurl \"itsyou.online\" is not an absolute http or https url")
+}
+
+func TestSet(t *testing.T) {
+	c := Default()
+	assert.NoError(t, c.Set("tls.ignoredevcert", "true"))
+	assert.NoError(t, c.Set("password.minlength", "12"))
+	assert.NoError(t, c.Set("ratelimit.period", "1m"))
+	assert.NoError(t, c.Set("tls.ciphersuites", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"))
+	assert.True(t, c.TLS.IgnoreDevcert)
+	assert.Equal(t, 12, c.Password.MinLength)
+	assert.Equal(t, Duration(time.Minute), c.RateLimit.Period)
+	assert.Equal(t, []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}, c.TLS.CipherSuites)
+	assert.NoError(t, c.Validate())
+	assert.Error(t, c.Set("password.minlength", "twelve"))
+	assert.Error(t, c.Set("nonexisting", "1"))
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.SMTP.Password = "s3cret"
+	c.Twilio.AccountSID = "AC123"
+
+	redactedConfig := c.Redacted()
+	assert.Equal(t, redacted, redactedConfig.SMTP.Password)
+	assert.Equal(t, redacted, redactedConfig.ConnectionString)
+	assert.Equal(t, "", redactedConfig.SmsAero.Password, "empty secrets show that they are not set")
+	assert.Equal(t, "AC123", redactedConfig.Twilio.AccountSID)
+	assert.Equal(t, "s3cret", c.SMTP.Password, "the original is not changed")
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EnvironmentPrefix is the prefix of the environment variables, IYO_SMTP_PASSWORD sets the password of the smtp section
+	EnvironmentPrefix = "IYO_"
+	// fileSuffix marks an environment variable with the path of a file containing a secret, like IYO_SMTP_PASSWORD_FILE
+	fileSuffix = "_FILE"
+	redacted   = "********"
+)
+
+// setting is a single value in the configuration
+type setting struct {
+	// path is the name of the setting in the configuration file, like smtp.password
+	path   string
+	secret bool
+	value  reflect.Value
+}
+
+// environmentVariable returns the name of the environment variable that overrides the setting
+func (s setting) environmentVariable() string {
+	return EnvironmentPrefix + strings.ToUpper(strings.Replace(s.path, ".", "_", -1))
+}
+
+// settings lists all values of a configuration in the order they are declared
+func settings(value reflect.Value, prefix string) (result []setting) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		path := prefix + field.Tag.Get("yaml")
+		fieldValue := value.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			result = append(result, settings(fieldValue, path+".")...)
+			continue
+		}
+		result = append(result, setting{path: path, secret: field.Tag.Get("secret") == "true", value: fieldValue})
+	}
+	return
+}
+
+// loadEnvironment overrides the settings with the IYO_* environment variables,
+// secrets can also be read from the file an IYO_*_FILE variable points to
+func (c *Config) loadEnvironment() error {
+	for _, s := range settings(reflect.ValueOf(c).Elem(), "") {
+		name := s.environmentVariable()
+		value, found := os.LookupEnv(name)
+		if s.secret {
+			if file, fileFound := os.LookupEnv(name + fileSuffix); fileFound {
+				if found {
+					return fmt.Errorf("Both %s and %s are set", name, name+fileSuffix)
+				}
+				data, err := ioutil.ReadFile(file)
+				if err != nil {
+					return fmt.Errorf("Failed to read %s: %s", name+fileSuffix, err)
+				}
+				value, found = strings.TrimRight(string(data), "\r\n"), true
+			}
+		}
+		if !found {
+			continue
+		}
+		if err := setValue(s.value, value); err != nil {
+			return fmt.Errorf("Invalid value for %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// setValue parses a string into a setting
+func setValue(value reflect.Value, text string) error {
+	if unmarshaler, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(text))
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int:
+		i, err := strconv.Atoi(text)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(i))
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", value.Type())
+		}
+		// Lists are written comma separated
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with the secrets replaced, so it can be printed or logged
+func (c *Config) Redacted() *Config {
+	copied := *c
+	for _, s := range settings(reflect.ValueOf(&copied).Elem(), "") {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString(redacted)
+		}
+	}
+	return &copied
+}
+
+// Set changes a setting by its name in the configuration file, like smtp.port
+func (c *Config) Set(path string, value string) error {
+	for _, s := range settings(reflect.ValueOf(c).Elem(), "") {
+		if s.path == path {
+			return setValue(s.value, value)
+		}
+	}
+	return fmt.Errorf("Unknown setting %s", path)
+}
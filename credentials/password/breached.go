@@ -0,0 +1,192 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// prefixLength is the number of hex characters of the sha1 hash used as the lookup bucket,
+// the same range size as used by the k-anonymity api of haveibeenpwned.com
+const prefixLength = 5
+
+// sortedCheckLines is the number of lines at the start of a list that are checked to be ordered by hash
+const sortedCheckLines = 1000
+
+// ErrBreachedPasswordsNotSorted is returned when a breached password list is not ordered by hash
+var ErrBreachedPasswordsNotSorted = errors.New("the breached password list is not ordered by hash")
+
+// BreachedPasswords is a list of sha1 hashes of passwords that are known to be breached.
+// The list is far too large to keep in memory, the hashes are looked up in the sorted file
+// with a binary search on the byte offsets instead.
+type BreachedPasswords struct {
+	file io.ReaderAt
+	size int64
+}
+
+// LoadBreachedPasswords opens a breached password list, the file stays open to look up the hashes.
+// The file contains one uppercase or lowercase hex encoded sha1 hash per line,
+// optionally followed by a colon and the number of occurrences, ordered by hash,
+// like the "ordered by hash" lists distributed by haveibeenpwned.com.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	breached := NewBreachedPasswords(f, info.Size())
+	if err = breached.checkSorted(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	log.Infof("Using the breached password list %s of %d bytes", path, info.Size())
+	return breached, nil
+}
+
+// NewBreachedPasswords returns the breached password list of size bytes read from r,
+// in the format described in LoadBreachedPasswords
+func NewBreachedPasswords(r io.ReaderAt, size int64) *BreachedPasswords {
+	return &BreachedPasswords{file: r, size: size}
+}
+
+// checkSorted checks that the first lines of the list are ordered by hash,
+// a list ordered by the number of occurrences would make the lookups miss most hashes
+func (b *BreachedPasswords) checkSorted() error {
+	reader := bufio.NewReader(io.NewSectionReader(b.file, 0, b.size))
+	previous := ""
+	for i := 0; i < sortedCheckLines; i++ {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			hash := parseBreachedHash(line)
+			if hash < previous {
+				return ErrBreachedPasswordsNotSorted
+			}
+			previous = hash
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseBreachedHash returns the uppercase hash of a line of the list, without the number of occurrences
+func parseBreachedHash(line string) string {
+	line = strings.TrimSpace(line)
+	if i := strings.Index(line, ":"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.ToUpper(line)
+}
+
+// isSHA1 checks if a parsed line is a hex encoded sha1 hash
+func isSHA1(hash string) bool {
+	if len(hash) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// lineAt returns the offset and the hash of the first line that starts at or after offset.
+// The returned offset is the size of the list if there is no such line.
+func (b *BreachedPasswords) lineAt(offset int64) (start int64, hash string, err error) {
+	if offset >= b.size {
+		return b.size, "", nil
+	}
+	start = offset
+	var reader *bufio.Reader
+	if offset == 0 {
+		reader = bufio.NewReaderSize(io.NewSectionReader(b.file, 0, b.size), 256)
+	} else {
+		// The line starts at offset if the previous byte ends a line
+		reader = bufio.NewReaderSize(io.NewSectionReader(b.file, offset-1, b.size-offset+1), 256)
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return b.size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start = offset - 1 + int64(len(skipped))
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, parseBreachedHash(line), nil
+}
+
+// search returns the offset of the first line with a hash that is not smaller than hash
+func (b *BreachedPasswords) search(hash string) (int64, error) {
+	low, high := int64(0), b.size
+	for low < high {
+		middle := low + (high-low)/2
+		start, lineHash, err := b.lineAt(middle)
+		if err != nil {
+			return 0, err
+		}
+		if start >= b.size || lineHash >= hash {
+			high = middle
+		} else {
+			low = middle + 1
+		}
+	}
+	start, _, err := b.lineAt(low)
+	return start, err
+}
+
+// Range returns the hash suffixes of all breached passwords with the given hash prefix
+func (b *BreachedPasswords) Range(prefix string) (suffixes []string, err error) {
+	prefix = strings.ToUpper(prefix)
+	start, err := b.search(prefix)
+	if err != nil {
+		return
+	}
+	reader := bufio.NewReader(io.NewSectionReader(b.file, start, b.size-start))
+	for {
+		line, readErr := reader.ReadString('\n')
+		hash := parseBreachedHash(line)
+		if line != "" && !strings.HasPrefix(hash, prefix) {
+			return
+		}
+		if isSHA1(hash) {
+			suffixes = append(suffixes, hash[len(prefix):])
+		}
+		if readErr == io.EOF {
+			return
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+}
+
+// Contains checks if a password is in the breached password list.
+// A failure to read the list is logged and the password is not considered breached.
+func (b *BreachedPasswords) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	start, err := b.search(hash)
+	if err == nil {
+		var lineHash string
+		if _, lineHash, err = b.lineAt(start); err == nil {
+			return lineHash == hash
+		}
+	}
+	log.Error("Failed to look up a password in the breached password list: ", err)
+	return false
+}
@@ -15,20 +15,16 @@ import (
 	"github.com/itsyouonline/identityserver/tools"
 )
 
-var (
-	// ErrInvalidPassword is returned when an invalid password is passed
-	ErrInvalidPassword = errors.New("Invalid password")
-)
-
 const (
 	mongoCollectionName           = "password"
 	mongoCollectionNameResetToken = "passwordresetoken"
-	passwordMinLength             = 6
 )
 
 type userPass struct {
 	Username string
 	Password string
+	// ChangeRequired is set when the user needs to choose a new password, it is cleared when a password is saved
+	ChangeRequired bool
 }
 
 type ResetToken struct {
@@ -37,32 +33,28 @@ type ResetToken struct {
 	CreatedAt time.Time
 }
 
-//InitModels initializes models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:      []string{"username"},
-		Unique:   true,
-		DropDups: true,
-	}
-	db.EnsureIndex(mongoCollectionName, index)
-
-	index = mgo.Index{
-		Key:      []string{"username", "token"},
-		Unique:   true,
-		DropDups: true,
-	}
-	db.EnsureIndex(mongoCollectionNameResetToken, index)
-
-	automaticExpiration := mgo.Index{
-		Key:         []string{"createdat"},
-		ExpireAfter: time.Minute * 10,
-		Background:  true,
-	}
-	db.EnsureIndex(mongoCollectionNameResetToken, automaticExpiration)
+//Manager stores and validates passwords
+type Manager interface {
+	//Validate checks the password for a specific username
+	Validate(username, password string) (bool, error)
+	// Save stores a password for a specific username.
+	Save(username, password string) error
+	// NewResetToken get new reset token
+	NewResetToken(username string) (token *ResetToken, err error)
+	// SaveResetToken save reset token
+	SaveResetToken(token *ResetToken) (err error)
+	// FindResetToken find reset token by token
+	FindResetToken(token string) (tokenobj *ResetToken, err error)
+	// DeleteResetToken delete reset token by token
+	DeleteResetToken(token string) (err error)
+	// RemoveByUser removes the password and the reset tokens of a user
+	RemoveByUser(username string) (err error)
+	// ChangeRequired checks if the user needs to choose a new password
+	ChangeRequired(username string) (bool, error)
 }
 
-//Manager stores and validates passwords
-type Manager struct {
+//mongoManager stores the passwords in mongo
+type mongoManager struct {
 	session         *mgo.Session
 	collection      *mgo.Collection
 	tokencollection *mgo.Collection
@@ -77,9 +69,15 @@ func getPasswordResetTokenCollection(session *mgo.Session) *mgo.Collection {
 }
 
 //NewManager creates a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session:         session,
 		collection:      getPasswordCollection(session),
 		tokencollection: getPasswordResetTokenCollection(session),
@@ -87,7 +85,7 @@ func NewManager(r *http.Request) *Manager {
 }
 
 //Validate checks the password for a specific username
-func (pwm *Manager) Validate(username, password string) (bool, error) {
+func (pwm *mongoManager) Validate(username, password string) (bool, error) {
 	var storedPassword userPass
 	if err := pwm.collection.Find(bson.M{"username": username}).One(&storedPassword); err != nil {
 		if err == mgo.ErrNotFound {
@@ -98,20 +96,61 @@ func (pwm *Manager) Validate(username, password string) (bool, error) {
 		return false, err
 	}
 	match := keyderivation.Check(password, storedPassword.Password)
+	if match && keyderivation.NeedsRehash(storedPassword.Password) {
+		// Transparently upgrade keys created with a legacy algorithm or cost,
+		// a failure here should not prevent the user from logging in
+		if !canRehash(password) {
+			if !storedPassword.ChangeRequired {
+				log.Info("The password of ", username, " is too long to upgrade its hash, a new password is required")
+				if err := pwm.collection.Update(bson.M{"username": username}, bson.M{"$set": bson.M{"changerequired": true}}); err != nil {
+					log.Error("Failed to require a new password for ", username, ": ", err)
+				}
+			}
+		} else if err := pwm.rehash(username, password, storedPassword.Password); err != nil {
+			log.Error("Failed to upgrade the password hash of ", username, ": ", err)
+		}
+	}
 	return match, nil
 }
 
+// canRehash checks if the key of a password can be upgraded to the current key derivation,
+// legacy keys of passwords longer than MaxLength bytes can not and the user needs to choose a new password
+func canRehash(password string) bool {
+	return len(password) <= MaxLength
+}
+
+// ChangeRequired checks if the user needs to choose a new password
+func (pwm *mongoManager) ChangeRequired(username string) (bool, error) {
+	var storedPassword userPass
+	err := pwm.collection.Find(bson.M{"username": username}).One(&storedPassword)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return storedPassword.ChangeRequired, err
+}
+
+//rehash replaces the stored key with a key using the current key derivation settings,
+// provided the stored key was not changed in the meantime
+func (pwm *mongoManager) rehash(username, password, oldKey string) error {
+	newKey, err := keyderivation.Hash(password)
+	if err != nil {
+		return err
+	}
+	err = pwm.collection.Update(
+		bson.M{"username": username, "password": oldKey},
+		bson.M{"$set": bson.M{"password": newKey}})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
 // Save stores a password for a specific username.
-func (pwm *Manager) Save(username, password string) error {
+func (pwm *mongoManager) Save(username, password string) error {
 	//TODO: username and password validation
-	passwordHash, err := keyderivation.Hash(password)
+	passwordHash, err := hashPassword(password)
 	if err != nil {
-		log.Error("ERROR hashing password")
-		log.Debug("ERROR hashing password: ", err)
-		return errors.New("internal_error")
-	}
-	if len(password) < passwordMinLength {
-		return errors.New("invalid_password")
+		return err
 	}
 	storedPassword := userPass{Username: username, Password: passwordHash}
 
@@ -120,21 +159,27 @@ func (pwm *Manager) Save(username, password string) error {
 	return err
 }
 
-// Check to see if a password is valid for a user.
-func Check(password string) error {
-	if len(password) < passwordMinLength {
-		return ErrInvalidPassword
+// hashPassword derives the key that is stored for a password, the length is checked first
+// so a refused password does not cost a key derivation
+func hashPassword(password string) (string, error) {
+	if err := currentPolicy.checkLength(password); err != nil {
+		return "", err
 	}
-	_, err := keyderivation.Hash(password)
+	passwordHash, err := keyderivation.Hash(password)
 	if err != nil {
-		log.Debug("Failed to hash password: ", err)
-		return err
+		log.Error("ERROR hashing password")
+		log.Debug("ERROR hashing password: ", err)
+		return "", errors.New("internal_error")
 	}
-	return nil
+	return passwordHash, nil
 }
 
 // NewResetToken get new reset token
-func (pwm *Manager) NewResetToken(username string) (token *ResetToken, err error) {
+func (pwm *mongoManager) NewResetToken(username string) (token *ResetToken, err error) {
+	return newResetToken(username)
+}
+
+func newResetToken(username string) (token *ResetToken, err error) {
 	tokenstring, err := tools.GenerateRandomString()
 	if err != nil {
 		return
@@ -144,20 +189,29 @@ func (pwm *Manager) NewResetToken(username string) (token *ResetToken, err error
 }
 
 // SaveResetToken save reset token
-func (pwm *Manager) SaveResetToken(token *ResetToken) (err error) {
+func (pwm *mongoManager) SaveResetToken(token *ResetToken) (err error) {
 	err = pwm.tokencollection.Insert(token)
 	return
 }
 
 // FindResetToken find reset token by token
-func (pwm *Manager) FindResetToken(token string) (tokenobj *ResetToken, err error) {
+func (pwm *mongoManager) FindResetToken(token string) (tokenobj *ResetToken, err error) {
 	tokenobj = &ResetToken{}
 	err = pwm.tokencollection.Find(bson.M{"token": token}).One(tokenobj)
 	return
 }
 
 // DeleteResetToken delete reset token by token
-func (pwm *Manager) DeleteResetToken(token string) (err error) {
+func (pwm *mongoManager) DeleteResetToken(token string) (err error) {
 	_, err = pwm.tokencollection.RemoveAll(bson.M{"token": token})
 	return
 }
+
+// RemoveByUser removes the password and the reset tokens of a user
+func (pwm *mongoManager) RemoveByUser(username string) (err error) {
+	if _, err = pwm.collection.RemoveAll(bson.M{"username": username}); err != nil {
+		return
+	}
+	_, err = pwm.tokencollection.RemoveAll(bson.M{"username": username})
+	return
+}
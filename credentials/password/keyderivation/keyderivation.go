@@ -1,21 +1,81 @@
 package keyderivation
 
-import "github.com/itsyouonline/identityserver/credentials/password/keyderivation/crypt/sha512crypt"
+import (
+	"errors"
+	"strings"
 
-//Hash creates a random 16 character salt and creates a key using this salt
-//Key generation function: SHA512 with 5000 iterations
-// If you want to generate the same key on the commandline:
-// `echo "user:password" | chpasswd -c SHA512 -S | cut -d: -f 2`
-func Hash(password string) (key string, err error) {
-	c := sha512crypt.New()
-	key, err = c.Generate([]byte(password), []byte(""))
+	"github.com/itsyouonline/identityserver/credentials/password/keyderivation/crypt/sha512crypt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// DefaultCost is the default bcrypt cost used for new keys
+	DefaultCost = 12
+
+	// MaxPasswordLength is the number of bytes of a password bcrypt uses, the bytes after it are ignored
+	MaxPasswordLength = 72
+
+	sha512cryptPrefix = "$6$"
+)
 
+var (
+	// ErrInvalidCost is returned when a cost outside of the supported bcrypt range is configured
+	ErrInvalidCost = errors.New("Invalid key derivation cost")
+	// ErrPasswordTooLong is returned when a password is longer than MaxPasswordLength bytes
+	ErrPasswordTooLong = errors.New("Password too long")
+)
+
+var cost = DefaultCost
+
+// SetCost configures the bcrypt cost used for new keys.
+// Existing keys with a different cost are reported by NeedsRehash.
+func SetCost(c int) error {
+	if c < bcrypt.MinCost || c > bcrypt.MaxCost {
+		return ErrInvalidCost
+	}
+	cost = c
+	return nil
+}
+
+//Hash creates a key using bcrypt with the configured cost.
+// The encoded key contains the algorithm version, the cost and a random salt:
+// `$2a$<cost>$<salt><hash>`
+// Passwords longer than MaxPasswordLength bytes are refused,
+// bcrypt would give them the same key as every password with the same first 72 bytes.
+func Hash(password string) (key string, err error) {
+	if len(password) > MaxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	key = string(hashed)
 	return
 }
 
 //Check takes the password and the encoded key
-// and checks if the combination matches
+// and checks if the combination matches.
+// Both bcrypt keys and legacy sha512crypt (`$6$`) keys are supported.
 func Check(password, key string) bool {
-	err := sha512crypt.New().Verify(key, []byte(password))
+	if isSha512crypt(key) {
+		err := sha512crypt.New().Verify(key, []byte(password))
+		return err == nil
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(key), []byte(password))
 	return err == nil
 }
+
+//NeedsRehash checks if a key was created with a legacy algorithm or with a different cost
+// than the one currently configured, and should be replaced after a successful Check.
+func NeedsRehash(key string) bool {
+	if isSha512crypt(key) {
+		return true
+	}
+	keyCost, err := bcrypt.Cost([]byte(key))
+	if err != nil {
+		return true
+	}
+	return keyCost != cost
+}
+
+func isSha512crypt(key string) bool {
+	return strings.HasPrefix(key, sha512cryptPrefix)
+}
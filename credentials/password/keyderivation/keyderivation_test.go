@@ -2,7 +2,10 @@ package keyderivation
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHash(t *testing.T) {
@@ -15,6 +18,16 @@ func TestHash(t *testing.T) {
 	fmt.Println("Key: ", key)
 }
 
+func TestHashTooLong(t *testing.T) {
+	_, err := Hash(strings.Repeat("a", MaxPasswordLength))
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err = Hash(strings.Repeat("a", MaxPasswordLength+1)); err != ErrPasswordTooLong {
+		t.Error("A password bcrypt would truncate should be refused")
+	}
+}
+
 func TestCheck(t *testing.T) {
 	password := "demo"
 	key := "$6$Iu14DOBmK4/JqCTd$E67.yXll739DjVacyQjulJ6bjN1GIwkHfd/Er4HpABMvpq4x0fpH8aOdOmUjVZSmr8tUhkVxDoX685KJSXfgg1"
@@ -22,3 +35,47 @@ func TestCheck(t *testing.T) {
 		t.Error("Password and salt should match the given key")
 	}
 }
+
+func TestCheckBcrypt(t *testing.T) {
+	key, err := Hash("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, "$2a$") {
+		t.Error("New keys should be bcrypt keys, got ", key)
+	}
+	if !Check("demo", key) {
+		t.Error("Password should match the generated key")
+	}
+	if Check("notdemo", key) {
+		t.Error("A different password should not match the generated key")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	legacyKey := "$6$Iu14DOBmK4/JqCTd$E67.yXll739DjVacyQjulJ6bjN1GIwkHfd/Er4HpABMvpq4x0fpH8aOdOmUjVZSmr8tUhkVxDoX685KJSXfgg1"
+	if !NeedsRehash(legacyKey) {
+		t.Error("sha512crypt keys should be rehashed")
+	}
+
+	defer SetCost(DefaultCost)
+	if err := SetCost(bcrypt.MinCost); err != nil {
+		t.Fatal(err)
+	}
+	key, err := Hash("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(key) {
+		t.Error("Keys with the configured cost should not be rehashed")
+	}
+	if err := SetCost(bcrypt.MinCost + 1); err != nil {
+		t.Fatal(err)
+	}
+	if !NeedsRehash(key) {
+		t.Error("Keys with a different cost should be rehashed")
+	}
+	if SetCost(bcrypt.MaxCost+1) != ErrInvalidCost {
+		t.Error("Costs above the maximum should be rejected")
+	}
+}
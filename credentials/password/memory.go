@@ -0,0 +1,114 @@
+package password
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/credentials/password/keyderivation"
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+)
+
+// resetTokenValidity is the expiration of the reset tokens in mongo
+const resetTokenValidity = 10 * time.Minute
+
+type memoryStore struct {
+	sync.Mutex
+	passwords      map[string]string
+	changeRequired map[string]bool
+	resetTokens    map[string]ResetToken
+}
+
+//memoryManager keeps the passwords in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoCollectionName, func() interface{} {
+		return &memoryStore{passwords: make(map[string]string), changeRequired: make(map[string]bool), resetTokens: make(map[string]ResetToken)}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) Validate(username, password string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	storedPassword, ok := m.store.passwords[username]
+	if !ok {
+		log.Debug("No password found for this user")
+		return false, nil
+	}
+	match := keyderivation.Check(password, storedPassword)
+	if match && keyderivation.NeedsRehash(storedPassword) {
+		if !canRehash(password) {
+			m.store.changeRequired[username] = true
+		} else if newKey, err := keyderivation.Hash(password); err == nil {
+			m.store.passwords[username] = newKey
+		}
+	}
+	return match, nil
+}
+
+func (m *memoryManager) ChangeRequired(username string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	return m.store.changeRequired[username], nil
+}
+
+func (m *memoryManager) Save(username, password string) error {
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.passwords[username] = passwordHash
+	delete(m.store.changeRequired, username)
+	return nil
+}
+
+func (m *memoryManager) NewResetToken(username string) (token *ResetToken, err error) {
+	return newResetToken(username)
+}
+
+func (m *memoryManager) SaveResetToken(token *ResetToken) (err error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.resetTokens[token.Token]; exists {
+		return db.ErrDuplicate
+	}
+	m.store.resetTokens[token.Token] = *token
+	return
+}
+
+func (m *memoryManager) FindResetToken(token string) (tokenobj *ResetToken, err error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	stored, ok := m.store.resetTokens[token]
+	if !ok || time.Since(stored.CreatedAt) > resetTokenValidity {
+		return &ResetToken{}, mgo.ErrNotFound
+	}
+	return &stored, nil
+}
+
+func (m *memoryManager) DeleteResetToken(token string) (err error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	delete(m.store.resetTokens, token)
+	return
+}
+
+func (m *memoryManager) RemoveByUser(username string) (err error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	delete(m.store.passwords, username)
+	delete(m.store.changeRequired, username)
+	for key, token := range m.store.resetTokens {
+		if token.Username == username {
+			delete(m.store.resetTokens, key)
+		}
+	}
+	return
+}
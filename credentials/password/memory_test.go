@@ -0,0 +1,44 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/itsyouonline/identityserver/credentials/password/keyderivation"
+	"github.com/itsyouonline/identityserver/credentials/password/keyderivation/crypt/sha512crypt"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateUpgradesLegacyKeys(t *testing.T) {
+	m := newMemoryManager(db.NewMemoryBackend())
+	longPassword := strings.Repeat("a", MaxLength+1)
+	for username, password := range map[string]string{"alice": "correct horse", "bob": longPassword} {
+		key, err := sha512crypt.New().Generate([]byte(password), []byte("$6$saltsalt"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		m.store.passwords[username] = key
+	}
+
+	valid, err := m.Validate("alice", "correct horse")
+	assert.True(t, valid)
+	assert.NoError(t, err)
+	assert.False(t, keyderivation.NeedsRehash(m.store.passwords["alice"]), "the key is upgraded")
+	changeRequired, err := m.ChangeRequired("alice")
+	assert.NoError(t, err)
+	assert.False(t, changeRequired)
+
+	valid, err = m.Validate("bob", longPassword)
+	assert.True(t, valid, "the legacy key still matches")
+	assert.NoError(t, err)
+	assert.True(t, keyderivation.NeedsRehash(m.store.passwords["bob"]), "the password is too long for the current key derivation")
+	changeRequired, err = m.ChangeRequired("bob")
+	assert.NoError(t, err)
+	assert.True(t, changeRequired)
+
+	assert.NoError(t, m.Save("bob", "a new password"))
+	changeRequired, err = m.ChangeRequired("bob")
+	assert.NoError(t, err)
+	assert.False(t, changeRequired, "saving a new password clears the flag")
+}
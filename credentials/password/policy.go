@@ -0,0 +1,285 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/itsyouonline/identityserver/credentials/password/keyderivation"
+	"github.com/itsyouonline/identityserver/db/user"
+)
+
+const (
+	// DefaultMinLength is the default minimum length of a password
+	DefaultMinLength = 6
+	// MaxLength is the maximum length of a password in bytes, the key derivation ignores the bytes after it
+	MaxLength = keyderivation.MaxPasswordLength
+	// DefaultMinScore is the default minimum strength score of a password, 0 accepts every score
+	DefaultMinScore = 0
+
+	// minUserInfoLength is the minimum length of a username, name or email part
+	// before it is considered when checking if a password contains user information
+	minUserInfoLength = 3
+)
+
+// PolicyError is returned when a password does not satisfy the password policy.
+// The error message is the name of the rule that failed and can be passed to the client.
+type PolicyError struct {
+	Rule string
+}
+
+func (err *PolicyError) Error() string {
+	return err.Rule
+}
+
+var (
+	// ErrPasswordTooShort is returned when a password is shorter than the minimum length
+	ErrPasswordTooShort = &PolicyError{Rule: "password_too_short"}
+	// ErrPasswordTooLong is returned when a password is longer than MaxLength bytes
+	ErrPasswordTooLong = &PolicyError{Rule: "password_too_long"}
+	// ErrPasswordTooWeak is returned when the strength score of a password is too low
+	ErrPasswordTooWeak = &PolicyError{Rule: "password_too_weak"}
+	// ErrPasswordContainsUserInfo is returned when a password contains the username, name or email address
+	ErrPasswordContainsUserInfo = &PolicyError{Rule: "password_contains_user_info"}
+	// ErrPasswordBreached is returned when a password is present in the breached password list
+	ErrPasswordBreached = &PolicyError{Rule: "password_breached"}
+)
+
+// IsPolicyError checks if an error is caused by a password policy violation
+func IsPolicyError(err error) bool {
+	_, ok := err.(*PolicyError)
+	return ok
+}
+
+// UserInfo contains the information about a user that should not be used in their password
+type UserInfo struct {
+	Username       string
+	Firstname      string
+	Lastname       string
+	EmailAddresses []string
+}
+
+// UserInfoFromUser collects the UserInfo of an existing user
+func UserInfoFromUser(u *user.User) UserInfo {
+	info := UserInfo{
+		Username:  u.Username,
+		Firstname: u.Firstname,
+		Lastname:  u.Lastname,
+	}
+	for _, email := range u.EmailAddresses {
+		info.EmailAddresses = append(info.EmailAddresses, email.EmailAddress)
+	}
+	return info
+}
+
+// Policy describes the requirements a password has to meet
+type Policy struct {
+	// MinLength is the minimum number of characters
+	MinLength int
+	// MinScore is the minimum strength score from 0 (very weak) to 4 (very strong)
+	MinScore int
+	// Breached is an optional list of known breached passwords
+	Breached *BreachedPasswords
+}
+
+var currentPolicy = DefaultPolicy()
+
+// DefaultPolicy returns the policy used when none is configured
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength: DefaultMinLength,
+		MinScore:  DefaultMinScore,
+	}
+}
+
+// SetPolicy configures the password policy applied by Check
+func SetPolicy(policy *Policy) {
+	currentPolicy = policy
+}
+
+// GetPolicy returns the configured password policy
+func GetPolicy() *Policy {
+	return currentPolicy
+}
+
+// Check to see if a password is valid for a user according to the configured policy.
+func Check(password string, userInfo UserInfo) error {
+	return currentPolicy.Check(password, userInfo)
+}
+
+// Check to see if a password is valid for a user.
+// The returned error is a *PolicyError indicating the first rule that failed.
+func (p *Policy) Check(password string, userInfo UserInfo) error {
+	if err := p.checkLength(password); err != nil {
+		return err
+	}
+	if containsUserInfo(password, userInfo) {
+		return ErrPasswordContainsUserInfo
+	}
+	if Score(password) < p.MinScore {
+		return ErrPasswordTooWeak
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+// checkLength checks the minimum length in characters and the maximum length in bytes
+func (p *Policy) checkLength(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > MaxLength {
+		return ErrPasswordTooLong
+	}
+	return nil
+}
+
+func containsUserInfo(password string, userInfo UserInfo) bool {
+	lowered := strings.ToLower(password)
+	parts := []string{userInfo.Username, userInfo.Firstname, userInfo.Lastname}
+	for _, email := range userInfo.EmailAddresses {
+		// Check both the full address and the local part
+		parts = append(parts, email)
+		if at := strings.LastIndex(email, "@"); at > 0 {
+			parts = append(parts, email[:at])
+		}
+	}
+	for _, part := range parts {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if len([]rune(part)) >= minUserInfoLength && strings.Contains(lowered, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// Score estimates the strength of a password on the zxcvbn scale:
+//  0: too guessable (< 10^3 guesses)
+//  1: very guessable (< 10^6 guesses)
+//  2: somewhat guessable (< 10^8 guesses)
+//  3: safely unguessable (< 10^10 guesses)
+//  4: very unguessable (>= 10^10 guesses)
+// The number of guesses is estimated from the character classes used and the
+// length of the password after discounting repeated characters, sequences and keyboard patterns.
+func Score(password string) int {
+	if isCommonPassword(password) {
+		return 0
+	}
+	guesses := log10Guesses(password)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// commonPasswords are some of the most used passwords, they are also rejected
+// when followed by digits or symbols like "password1" or "welcome!"
+var commonPasswords = map[string]bool{
+	"password": true, "passw0rd": true, "qwerty": true, "azerty": true, "letmein": true,
+	"welcome": true, "admin": true, "iloveyou": true, "monkey": true, "dragon": true,
+	"football": true, "baseball": true, "master": true, "sunshine": true, "princess": true,
+	"shadow": true, "trustno1": true, "superman": true, "starwars": true, "secret": true,
+}
+
+func isCommonPassword(password string) bool {
+	base := strings.TrimRightFunc(strings.ToLower(password), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return commonPasswords[base] || commonPasswords[strings.ToLower(password)]
+}
+
+// keyboardRows are used to detect keyboard walks such as "qwerty" or "asdf"
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+	"azertyuiop",
+	"qsdfghjklm",
+	"wxcvbn",
+}
+
+func log10Guesses(password string) float64 {
+	runes := []rune(strings.ToLower(password))
+	if len(runes) == 0 {
+		return 0
+	}
+
+	var pool int
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+
+	// A character that continues a repetition, a sequence or a keyboard walk does not
+	// add a full pool of possibilities, a whole run only multiplies the guesses by its length
+	effective := 1.0
+	predictable := 0.0
+	run := 0
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		if cur == prev || cur == prev+1 || cur == prev-1 || adjacentOnKeyboard(prev, cur) {
+			run++
+			continue
+		}
+		if run > 0 {
+			predictable += math.Log10(float64(run + 1))
+			run = 0
+		}
+		effective++
+	}
+	if run > 0 {
+		predictable += math.Log10(float64(run + 1))
+	}
+	return effective*math.Log10(float64(pool)) + predictable
+}
+
+func adjacentOnKeyboard(a, b rune) bool {
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		if i < 0 {
+			continue
+		}
+		j := strings.IndexRune(row, b)
+		if j >= 0 && (j == i+1 || j == i-1) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.MinScore = 1
+	info := UserInfo{
+		Username:       "john_doe",
+		Firstname:      "John",
+		Lastname:       "Doe",
+		EmailAddresses: []string{"johnny.d@example.com"},
+	}
+
+	assert.Equal(t, ErrPasswordTooShort, policy.Check("a1b2", info))
+	assert.Equal(t, ErrPasswordTooLong, policy.Check(strings.Repeat("correct horse battery ", 4), info))
+	assert.Equal(t, ErrPasswordContainsUserInfo, policy.Check("xJohn#42tree", info))
+	assert.Equal(t, ErrPasswordContainsUserInfo, policy.Check("my-johnny.d-pass", info))
+	assert.Equal(t, ErrPasswordTooWeak, policy.Check("aaaaaaaa", info))
+	assert.Equal(t, ErrPasswordTooWeak, policy.Check("qwertyuiop", info))
+	assert.Equal(t, ErrPasswordTooWeak, policy.Check("Password1", info))
+	assert.NoError(t, policy.Check("correct horse battery", info))
+
+	assert.NoError(t, DefaultPolicy().Check("qwertyuiop", info), "the score is not checked by default")
+
+	// Short names are not considered
+	assert.NoError(t, policy.Check("tidoe-is-ok", UserInfo{Lastname: "Do"}))
+}
+
+func TestScore(t *testing.T) {
+	assert.Equal(t, 0, Score(""))
+	assert.Equal(t, 0, Score("abcdefgh"))
+	assert.Equal(t, 0, Score("123456789"))
+	assert.Equal(t, 0, Score("welcome!"))
+	assert.True(t, Score("Tr0ub4dor&3") >= 3)
+	assert.Equal(t, 4, Score("correct horse battery staple"))
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	// sha1("hunter2") and some unrelated hashes in the haveibeenpwned format, ordered by hash
+	list := "A1D9C31F5A0B8D0D8A4A2B5B2FC0F8A2C5BA7E41\r\n" +
+		"e8a3e5e4c9e7fb7b0f3b9e35c8b2a5d3c6d1e4f0\r\n" +
+		"F3BBBD66A63D4BF1747940578EC3D0103530E21D:17\r\n" +
+		"F3BBBF0000000000000000000000000000000000:2\r\n" +
+		"not a hash"
+	breached := NewBreachedPasswords(strings.NewReader(list), int64(len(list)))
+	assert.NoError(t, breached.checkSorted())
+	assert.True(t, breached.Contains("hunter2"))
+	assert.False(t, breached.Contains("hunter3"))
+	for _, password := range []string{"a", "b", "c", "password", "123456"} {
+		assert.False(t, breached.Contains(password), password)
+	}
+	suffixes, err := breached.Range("f3bbb")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"D66A63D4BF1747940578EC3D0103530E21D", "F0000000000000000000000000000000000"}, suffixes)
+	suffixes, err = breached.Range("A1D9C")
+	assert.NoError(t, err)
+	assert.Len(t, suffixes, 1, "the first line is found")
+	suffixes, err = breached.Range("00000")
+	assert.NoError(t, err)
+	assert.Empty(t, suffixes)
+
+	// Every password of a larger list is found
+	hashes := []string{}
+	for i := 0; i < 2000; i++ {
+		sum := sha1.Sum([]byte(strconv.Itoa(i)))
+		hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:]))+":"+strconv.Itoa(i))
+	}
+	sort.Strings(hashes)
+	large := strings.Join(hashes, "\n") + "\n"
+	largeBreached := NewBreachedPasswords(strings.NewReader(large), int64(len(large)))
+	for i := 0; i < 2000; i++ {
+		assert.True(t, largeBreached.Contains(strconv.Itoa(i)), i)
+	}
+	assert.False(t, largeBreached.Contains("2000"))
+
+	unsorted := "F3BBBD66A63D4BF1747940578EC3D0103530E21D:17\nA1D9C31F5A0B8D0D8A4A2B5B2FC0F8A2C5BA7E41:20\n"
+	assert.Equal(t, ErrBreachedPasswordsNotSorted, NewBreachedPasswords(strings.NewReader(unsorted), int64(len(unsorted))).checkSorted())
+
+	policy := DefaultPolicy()
+	policy.Breached = breached
+	assert.Equal(t, ErrPasswordBreached, policy.Check("hunter2", UserInfo{}))
+	assert.True(t, IsPolicyError(policy.Check("hunter2", UserInfo{})))
+}
@@ -0,0 +1,142 @@
+package password
+
+import (
+	"database/sql"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/credentials/password/keyderivation"
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+)
+
+var postgresPasswords = &db.PostgresCollection{
+	Table: "passwords",
+	Columns: func(document interface{}) map[string]interface{} {
+		return map[string]interface{}{"username": document.(*userPass).Username}
+	},
+}
+
+var postgresResetTokens = &db.PostgresCollection{
+	Table: "passwordresettokens",
+	Columns: func(document interface{}) map[string]interface{} {
+		token := document.(*ResetToken)
+		return map[string]interface{}{
+			"username":   token.Username,
+			"token":      token.Token,
+			"expires_at": token.CreatedAt.Add(resetTokenValidity),
+		}
+	},
+}
+
+//postgresManager stores the passwords in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) Validate(username, password string) (bool, error) {
+	var storedPassword userPass
+	if err := postgresPasswords.FindOne(m.db, &storedPassword, "username = $1", username); err != nil {
+		if err == mgo.ErrNotFound {
+			log.Debug("No password found for this user")
+			return false, nil
+		}
+		log.Debug(err)
+		return false, err
+	}
+	match := keyderivation.Check(password, storedPassword.Password)
+	if match && keyderivation.NeedsRehash(storedPassword.Password) {
+		if !canRehash(password) {
+			if !storedPassword.ChangeRequired {
+				log.Info("The password of ", username, " is too long to upgrade its hash, a new password is required")
+				if err := m.requireChange(username); err != nil {
+					log.Error("Failed to require a new password for ", username, ": ", err)
+				}
+			}
+		} else if err := m.rehash(username, password, storedPassword.Password); err != nil {
+			log.Error("Failed to upgrade the password hash of ", username, ": ", err)
+		}
+	}
+	return match, nil
+}
+
+//requireChange flags the password of a user as one that needs to be changed
+func (m *postgresManager) requireChange(username string) error {
+	_, err := postgresPasswords.Update(m.db, "username = $1", []interface{}{username},
+		func() interface{} { return &userPass{} },
+		func(document interface{}) error {
+			document.(*userPass).ChangeRequired = true
+			return nil
+		})
+	return err
+}
+
+func (m *postgresManager) ChangeRequired(username string) (bool, error) {
+	var storedPassword userPass
+	err := postgresPasswords.FindOne(m.db, &storedPassword, "username = $1", username)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return storedPassword.ChangeRequired, err
+}
+
+//rehash replaces the stored key with a key using the current key derivation settings,
+// provided the stored key was not changed in the meantime
+func (m *postgresManager) rehash(username, password, oldKey string) error {
+	newKey, err := keyderivation.Hash(password)
+	if err != nil {
+		return err
+	}
+	_, err = postgresPasswords.Update(m.db, "username = $1", []interface{}{username},
+		func() interface{} { return &userPass{} },
+		func(document interface{}) error {
+			if stored := document.(*userPass); stored.Password == oldKey {
+				stored.Password = newKey
+			}
+			return nil
+		})
+	return err
+}
+
+func (m *postgresManager) Save(username, password string) error {
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return postgresPasswords.Upsert(m.db, "username = $1", []interface{}{username},
+		func() interface{} { return &userPass{} },
+		func(document interface{}) error {
+			*document.(*userPass) = userPass{Username: username, Password: passwordHash}
+			return nil
+		})
+}
+
+func (m *postgresManager) NewResetToken(username string) (token *ResetToken, err error) {
+	return newResetToken(username)
+}
+
+func (m *postgresManager) SaveResetToken(token *ResetToken) (err error) {
+	return postgresResetTokens.Insert(m.db, token)
+}
+
+func (m *postgresManager) FindResetToken(token string) (tokenobj *ResetToken, err error) {
+	tokenobj = &ResetToken{}
+	err = postgresResetTokens.FindOne(m.db, tokenobj, "token = $1", token)
+	return
+}
+
+func (m *postgresManager) DeleteResetToken(token string) (err error) {
+	_, err = postgresResetTokens.Remove(m.db, "token = $1", token)
+	return
+}
+
+func (m *postgresManager) RemoveByUser(username string) (err error) {
+	if _, err = postgresPasswords.Remove(m.db, "username = $1", username); err != nil {
+		return
+	}
+	_, err = postgresResetTokens.Remove(m.db, "username = $1", username)
+	return
+}
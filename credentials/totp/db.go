@@ -2,6 +2,7 @@ package totp
 
 import (
 	"net/http"
+	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -15,23 +16,32 @@ const (
 )
 
 type userSecret struct {
-	Username string
-	Secret   string
+	Username  string
+	Secret    string
+	Algorithm Algorithm
+	Digits    int
+	// LastStep is the last time step for which a code was accepted, used to prevent replays
+	LastStep int64
 }
 
-// InitModels initializes models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:      []string{"username"},
-		Unique:   true,
-		DropDups: true,
-	}
-
-	db.EnsureIndex(mongoCollectionName, index)
+//Manager stores and validates totp secrets
+type Manager interface {
+	//Validate checks the totp code for a specific username
+	Validate(username, securityCode string) (bool, error)
+	HasTOTP(username string) (hastoken bool, err error)
+	// Save stores a secret for a specific username.
+	// An empty algorithm or 0 digits fall back to the defaults.
+	Save(username, secret string, algorithm Algorithm, digits int) error
+	Remove(username string) error
+	GetSecret(username string) (err error, secret userSecret)
+	// IsErrNotFound checks if an error is a mgo.ErrNotFound
+	IsErrNotFound(err error) bool
+	// RemoveByUser removes the totp secret of a user, it is no error if the user has none
+	RemoveByUser(username string) error
 }
 
-//Manager stores and validates passwords
-type Manager struct {
+//mongoManager stores the totp secrets in mongo
+type mongoManager struct {
 	session    *mgo.Session
 	collection *mgo.Collection
 }
@@ -41,16 +51,54 @@ func getTotpCollection(session *mgo.Session) *mgo.Collection {
 }
 
 //NewManager creates a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session:    session,
 		collection: getTotpCollection(session),
 	}
 }
 
+// newUserSecret applies the defaults and validates the algorithm and digits of a secret
+func newUserSecret(username, secret string, algorithm Algorithm, digits int) (storedSecret userSecret, err error) {
+	if algorithm == "" {
+		algorithm = DefaultAlgorithm
+	}
+	if digits == 0 {
+		digits = DefaultDigits
+	}
+	if !ValidAlgorithm(algorithm) {
+		err = ErrInvalidAlgorithm
+		return
+	}
+	if !ValidDigits(digits) {
+		err = ErrInvalidDigits
+		return
+	}
+	storedSecret = userSecret{Username: username, Secret: secret, Algorithm: algorithm, Digits: digits}
+	return
+}
+
+// matchCode checks a code against a stored secret and returns the time step it matched
+func matchCode(storedSecret userSecret, securityCode string) (step int64, match bool) {
+	token := TokenFromSecret(storedSecret.Secret)
+	if storedSecret.Algorithm != "" {
+		token.Algorithm = storedSecret.Algorithm
+	}
+	if storedSecret.Digits != 0 {
+		token.Digits = storedSecret.Digits
+	}
+	return token.ValidateAt(securityCode, time.Now(), storedSecret.LastStep)
+}
+
 //Validate checks the totp code for a specific username
-func (pwm *Manager) Validate(username, securityCode string) (bool, error) {
+func (pwm *mongoManager) Validate(username, securityCode string) (bool, error) {
 
 	var storedSecret userSecret
 	if err := pwm.collection.Find(bson.M{"username": username}).One(&storedSecret); err != nil {
@@ -61,12 +109,32 @@ func (pwm *Manager) Validate(username, securityCode string) (bool, error) {
 		log.Debug(err)
 		return false, err
 	}
-	token := TokenFromSecret(storedSecret.Secret)
-	match := token.Validate(securityCode)
-	return match, nil
+	step, match := matchCode(storedSecret, securityCode)
+	if !match {
+		return false, nil
+	}
+	// Only accept the code if no other request used this or a later time step in the meantime
+	err := pwm.collection.Update(
+		bson.M{
+			"username": username,
+			"$or": []bson.M{
+				{"laststep": bson.M{"$lt": step}},
+				{"laststep": bson.M{"$exists": false}},
+			},
+		},
+		bson.M{"$set": bson.M{"laststep": step}})
+	if err == mgo.ErrNotFound {
+		log.Debug("Replayed totp code for user ", username)
+		return false, nil
+	}
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+	return true, nil
 }
 
-func (pwm *Manager) HasTOTP(username string) (hastoken bool, err error) {
+func (pwm *mongoManager) HasTOTP(username string) (hastoken bool, err error) {
 	hastoken = false
 	count, err := pwm.collection.Find(bson.M{"username": username}).Count()
 	if err != nil {
@@ -78,26 +146,35 @@ func (pwm *Manager) HasTOTP(username string) (hastoken bool, err error) {
 }
 
 // Save stores a secret for a specific username.
-func (pwm *Manager) Save(username, secret string) error {
+// An empty algorithm or 0 digits fall back to the defaults.
+func (pwm *mongoManager) Save(username, secret string, algorithm Algorithm, digits int) error {
 	//TODO: username and secret validation
+	storedSecret, err := newUserSecret(username, secret, algorithm, digits)
+	if err != nil {
+		return err
+	}
 
-	storedSecret := userSecret{Username: username, Secret: secret}
-
-	_, err := pwm.collection.Upsert(bson.M{"username": username}, storedSecret)
+	_, err = pwm.collection.Upsert(bson.M{"username": username}, storedSecret)
 
 	return err
 }
 
-func (pwm *Manager) Remove(username string) error {
+func (pwm *mongoManager) Remove(username string) error {
 	return pwm.collection.Remove(bson.M{"username": username})
 }
 
-func (pwm *Manager) GetSecret(username string) (err error, secret userSecret) {
+func (pwm *mongoManager) GetSecret(username string) (err error, secret userSecret) {
 	err = pwm.collection.Find(bson.M{"username": username}).One(&secret)
 	return err, secret
 }
 
 // IsErrNotFound checks if an error is a mgo.ErrNotFound
-func (pwm *Manager) IsErrNotFound(err error) bool {
+func (pwm *mongoManager) IsErrNotFound(err error) bool {
 	return err == mgo.ErrNotFound
 }
+
+// RemoveByUser removes the totp secret of a user, it is no error if the user has none
+func (pwm *mongoManager) RemoveByUser(username string) error {
+	_, err := pwm.collection.RemoveAll(bson.M{"username": username})
+	return err
+}
@@ -0,0 +1,90 @@
+package totp
+
+import (
+	"sync"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	secrets map[string]userSecret
+}
+
+//memoryManager keeps the totp secrets in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoCollectionName, func() interface{} {
+		return &memoryStore{secrets: make(map[string]userSecret)}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) Validate(username, securityCode string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	storedSecret, ok := m.store.secrets[username]
+	if !ok {
+		return false, nil
+	}
+	step, match := matchCode(storedSecret, securityCode)
+	if !match {
+		return false, nil
+	}
+	storedSecret.LastStep = step
+	m.store.secrets[username] = storedSecret
+	return true, nil
+}
+
+func (m *memoryManager) HasTOTP(username string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	_, ok := m.store.secrets[username]
+	return ok, nil
+}
+
+func (m *memoryManager) Save(username, secret string, algorithm Algorithm, digits int) error {
+	storedSecret, err := newUserSecret(username, secret, algorithm, digits)
+	if err != nil {
+		return err
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.secrets[username] = storedSecret
+	return nil
+}
+
+func (m *memoryManager) Remove(username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, ok := m.store.secrets[username]; !ok {
+		return mgo.ErrNotFound
+	}
+	delete(m.store.secrets, username)
+	return nil
+}
+
+func (m *memoryManager) GetSecret(username string) (err error, secret userSecret) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	secret, ok := m.store.secrets[username]
+	if !ok {
+		err = mgo.ErrNotFound
+	}
+	return
+}
+
+func (m *memoryManager) IsErrNotFound(err error) bool {
+	return err == mgo.ErrNotFound
+}
+
+func (m *memoryManager) RemoveByUser(username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	delete(m.store.secrets, username)
+	return nil
+}
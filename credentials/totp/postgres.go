@@ -0,0 +1,86 @@
+package totp
+
+import (
+	"database/sql"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+)
+
+var postgresSecrets = &db.PostgresCollection{
+	Table: "totp",
+	Columns: func(document interface{}) map[string]interface{} {
+		return map[string]interface{}{"username": document.(*userSecret).Username}
+	},
+}
+
+func newSecret() interface{} {
+	return &userSecret{}
+}
+
+//postgresManager stores the totp secrets in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) Validate(username, securityCode string) (bool, error) {
+	valid := false
+	// The row is locked while the code is checked so a code can not be used twice by concurrent requests
+	_, err := postgresSecrets.Update(m.db, "username = $1", []interface{}{username}, newSecret, func(document interface{}) error {
+		storedSecret := document.(*userSecret)
+		step, match := matchCode(*storedSecret, securityCode)
+		if match {
+			storedSecret.LastStep = step
+			valid = true
+		}
+		return nil
+	})
+	if err != nil {
+		log.Debug(err)
+		return false, err
+	}
+	return valid, nil
+}
+
+func (m *postgresManager) HasTOTP(username string) (bool, error) {
+	count, err := postgresSecrets.Count(m.db, "username = $1", username)
+	return count != 0, err
+}
+
+func (m *postgresManager) Save(username, secret string, algorithm Algorithm, digits int) error {
+	storedSecret, err := newUserSecret(username, secret, algorithm, digits)
+	if err != nil {
+		return err
+	}
+	return postgresSecrets.Upsert(m.db, "username = $1", []interface{}{username}, newSecret, func(document interface{}) error {
+		*document.(*userSecret) = storedSecret
+		return nil
+	})
+}
+
+func (m *postgresManager) Remove(username string) error {
+	removed, err := postgresSecrets.Remove(m.db, "username = $1", username)
+	if err == nil && removed == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) GetSecret(username string) (err error, secret userSecret) {
+	err = postgresSecrets.FindOne(m.db, &secret, "username = $1", username)
+	return
+}
+
+func (m *postgresManager) IsErrNotFound(err error) bool {
+	return err == mgo.ErrNotFound
+}
+
+func (m *postgresManager) RemoveByUser(username string) error {
+	_, err := postgresSecrets.Remove(m.db, "username = $1", username)
+	return err
+}
@@ -1,67 +1,190 @@
 package totp
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/base32"
+	"encoding/binary"
+	"errors"
 	"fmt"
-
-	"github.com/hgfischer/go-otp"
+	"hash"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
-const tokenLength = sha1.Size
 const provider = "ItsYou.Online"
 
+//Algorithm is the hmac hash function used to generate the totp codes
+type Algorithm string
+
+const (
+	//AlgorithmSHA1 is the default algorithm, supported by all authenticator applications
+	AlgorithmSHA1 Algorithm = "SHA1"
+	//AlgorithmSHA256 uses HMAC-SHA256
+	AlgorithmSHA256 Algorithm = "SHA256"
+	//AlgorithmSHA512 uses HMAC-SHA512
+	AlgorithmSHA512 Algorithm = "SHA512"
+)
+
+const (
+	//DefaultAlgorithm is used when no algorithm is specified
+	DefaultAlgorithm = AlgorithmSHA1
+	//DefaultDigits is the default length of a totp code
+	DefaultDigits = 6
+	//Period is the time step in seconds
+	Period = 30
+	//Window is the number of time steps before and after the current one that are accepted to allow for clock drift
+	Window = 1
+)
+
+//ErrInvalidAlgorithm is returned when an unsupported algorithm is requested
+var ErrInvalidAlgorithm = errors.New("Invalid totp algorithm")
+
+//ErrInvalidDigits is returned when an unsupported code length is requested
+var ErrInvalidDigits = errors.New("Invalid number of totp digits")
+
 //Token represents a totp token with a base32 encoded secret
 type Token struct {
-	Provider string
-	User     string
-	Secret   string
+	Provider  string
+	User      string
+	Secret    string
+	Algorithm Algorithm
+	Digits    int
 }
 
-//NewToken creates a new totp token with a random base32 encoded secret
-func NewToken() (*Token, error) {
-	byteSecret, err := generateRandomBytes(tokenLength)
-	secret := base32.StdEncoding.EncodeToString(byteSecret)
-	return &Token{
-		Provider: provider,
-		User:     "",
-		Secret:   secret,
-	}, err
+//ValidAlgorithm checks if an algorithm is supported
+func ValidAlgorithm(algorithm Algorithm) bool {
+	return algorithm == AlgorithmSHA1 || algorithm == AlgorithmSHA256 || algorithm == AlgorithmSHA512
+}
+
+//ValidDigits checks if a code length is supported
+func ValidDigits(digits int) bool {
+	return digits == 6 || digits == 8
+}
+
+//NewToken creates a new totp token with a random base32 encoded secret.
+// An empty algorithm or 0 digits fall back to the defaults.
+func NewToken(algorithm Algorithm, digits int) (*Token, error) {
+	token := &Token{
+		Provider:  provider,
+		User:      "",
+		Algorithm: algorithm,
+		Digits:    digits,
+	}
+	token.setDefaults()
+	if !ValidAlgorithm(token.Algorithm) {
+		return nil, ErrInvalidAlgorithm
+	}
+	if !ValidDigits(token.Digits) {
+		return nil, ErrInvalidDigits
+	}
+	// The secret length matches the output size of the hash function as recommended in RFC 4226
+	byteSecret, err := generateRandomBytes(token.hashFunction()().Size())
+	token.Secret = base32.StdEncoding.EncodeToString(byteSecret)
+	return token, err
 }
 
 //TokenFromSecret creates a totp token from an existing base32 encoded secret
+// using the default algorithm and number of digits
 func TokenFromSecret(secret string) *Token {
 	return &Token{
-		Provider: provider,
-		User:     "",
-		Secret:   secret,
+		Provider:  provider,
+		User:      "",
+		Secret:    secret,
+		Algorithm: DefaultAlgorithm,
+		Digits:    DefaultDigits,
+	}
+}
+
+func (token *Token) setDefaults() {
+	if token.Algorithm == "" {
+		token.Algorithm = DefaultAlgorithm
+	}
+	if token.Digits == 0 {
+		token.Digits = DefaultDigits
+	}
+}
+
+func (token *Token) hashFunction() func() hash.Hash {
+	switch token.Algorithm {
+	case AlgorithmSHA256:
+		return sha256.New
+	case AlgorithmSHA512:
+		return sha512.New
+	default:
+		return sha1.New
 	}
 }
 
 //Validate checks a securityCode against a totp token
 func (token *Token) Validate(securityCode string) (valid bool) {
+	_, valid = token.ValidateAt(securityCode, time.Now(), 0)
+	return
+}
 
-	totp := otp.TOTP{
-		Secret:         token.Secret,
-		IsBase32Secret: true,
+//ValidateAt checks a securityCode against the time steps surrounding t within the allowed Window.
+// Time steps lower than or equal to lastUsedStep are rejected to prevent the replay of a code.
+// The matching time step is returned so it can be stored as the new last used step.
+func (token *Token) ValidateAt(securityCode string, t time.Time, lastUsedStep int64) (step int64, valid bool) {
+	token.setDefaults()
+	if len(securityCode) != token.Digits {
+		return 0, false
 	}
-	valid = totp.Now().Verify(securityCode)
-	return
+	secret, err := base32.StdEncoding.DecodeString(token.Secret)
+	if err != nil {
+		return 0, false
+	}
+	current := t.Unix() / Period
+	for i := -Window; i <= Window; i++ {
+		candidate := current + int64(i)
+		if candidate <= lastUsedStep {
+			continue
+		}
+		code := token.generate(secret, uint64(candidate))
+		if subtle.ConstantTimeCompare([]byte(code), []byte(securityCode)) == 1 {
+			return candidate, true
+		}
+	}
+	return 0, false
+}
+
+//generate calculates the code for a specific counter as described in RFC 4226 and RFC 6238
+func (token *Token) generate(secret []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(token.hashFunction(), secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
 
+	offset := sum[len(sum)-1] & 0x0f
+	value := int64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	modulo := int64(1)
+	for i := 0; i < token.Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", token.Digits, value%modulo)
 }
 
 //URL creates a the Key Uri Format url (otpauth://... )to enable users to pick this up in the totp applications
 func (token *Token) URL() string {
-
+	token.setDefaults()
+	params := url.Values{}
+	params.Set("secret", token.Secret)
+	params.Set("issuer", token.Provider)
+	params.Set("algorithm", string(token.Algorithm))
+	params.Set("digits", fmt.Sprint(token.Digits))
+	params.Set("period", fmt.Sprint(Period))
 	return fmt.Sprintf(
-		"otpauth://totp/%s:%s?secret=%s&issuer=%s",
-		token.Provider,
-		token.User,
-		token.Secret,
-		token.Provider,
+		"otpauth://totp/%s:%s?%s",
+		url.PathEscape(token.Provider),
+		url.PathEscape(token.User),
+		params.Encode(),
 	)
 }
 
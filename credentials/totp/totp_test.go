@@ -1,13 +1,16 @@
 package totp
 
 import (
+	"encoding/base32"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestTOTP(t *testing.T) {
-	token, err := NewToken()
+	token, err := NewToken(DefaultAlgorithm, DefaultDigits)
 	assert.NoError(t, err)
 	assert.NotNil(t, token)
 	assert.NotEmpty(t, token.Secret)
@@ -16,3 +19,82 @@ func TestTOTP(t *testing.T) {
 	assert.NotNil(t, fromSecret)
 	assert.NotEmpty(t, fromSecret.Secret)
 }
+
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	secrets := map[Algorithm]string{
+		AlgorithmSHA1:   "12345678901234567890",
+		AlgorithmSHA256: "12345678901234567890123456789012",
+		AlgorithmSHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	vectors := []struct {
+		Time      int64
+		Algorithm Algorithm
+		Code      string
+	}{
+		{59, AlgorithmSHA1, "94287082"},
+		{59, AlgorithmSHA256, "46119246"},
+		{59, AlgorithmSHA512, "90693936"},
+		{1111111109, AlgorithmSHA1, "07081804"},
+		{1111111109, AlgorithmSHA256, "68084774"},
+		{1111111109, AlgorithmSHA512, "25091201"},
+		{20000000000, AlgorithmSHA1, "65353130"},
+		{20000000000, AlgorithmSHA256, "77737706"},
+		{20000000000, AlgorithmSHA512, "47863826"},
+	}
+	for _, v := range vectors {
+		token := &Token{
+			Secret:    base32.StdEncoding.EncodeToString([]byte(secrets[v.Algorithm])),
+			Algorithm: v.Algorithm,
+			Digits:    8,
+		}
+		step, valid := token.ValidateAt(v.Code, time.Unix(v.Time, 0), 0)
+		assert.True(t, valid, "%s at %d", v.Algorithm, v.Time)
+		assert.Equal(t, v.Time/Period, step)
+	}
+}
+
+func TestTOTPWindowAndReplay(t *testing.T) {
+	token, err := NewToken(AlgorithmSHA256, 8)
+	assert.NoError(t, err)
+	secret, err := base32.StdEncoding.DecodeString(token.Secret)
+	assert.NoError(t, err)
+
+	now := time.Unix(1500000000, 0)
+	current := now.Unix() / Period
+
+	// one step of clock drift in either direction is accepted, two is not
+	for drift, expected := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		code := token.generate(secret, uint64(current+drift))
+		_, valid := token.ValidateAt(code, now, 0)
+		assert.Equal(t, expected, valid, "drift %d", drift)
+	}
+
+	// a code can not be used again once its time step has been used
+	code := token.generate(secret, uint64(current))
+	step, valid := token.ValidateAt(code, now, 0)
+	assert.True(t, valid)
+	_, valid = token.ValidateAt(code, now, step)
+	assert.False(t, valid)
+	// nor can an older code
+	_, valid = token.ValidateAt(token.generate(secret, uint64(current-1)), now, step)
+	assert.False(t, valid)
+}
+
+func TestTOTPInvalidParameters(t *testing.T) {
+	_, err := NewToken("MD5", 6)
+	assert.Equal(t, ErrInvalidAlgorithm, err)
+	_, err = NewToken(AlgorithmSHA1, 7)
+	assert.Equal(t, ErrInvalidDigits, err)
+}
+
+func TestTOTPURL(t *testing.T) {
+	token, err := NewToken(AlgorithmSHA512, 8)
+	assert.NoError(t, err)
+	token.User = "bob"
+	u, err := url.Parse(token.URL())
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "SHA512", u.Query().Get("algorithm"))
+	assert.Equal(t, "8", u.Query().Get("digits"))
+	assert.Equal(t, token.Secret, u.Query().Get("secret"))
+}
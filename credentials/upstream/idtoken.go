@@ -0,0 +1,222 @@
+package upstream
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	// ErrInvalidIDToken is returned when the id token of an OpenID Connect provider is missing or does not
+	// belong to the authorization request
+	ErrInvalidIDToken = errors.New("Invalid upstream id token")
+	// ErrSubjectMismatch is returned when the userinfo is about another user than the id token
+	ErrSubjectMismatch = errors.New("The upstream userinfo subject does not match the id token")
+)
+
+// idTokenMethods are the signing algorithms accepted for id tokens, the symmetric ones would need the client secret
+var idTokenMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+// AuthRequest holds the random values that tie an authorization at a provider to the browser that started it,
+// they are kept in the session until the provider redirects back
+type AuthRequest struct {
+	State string
+	// Nonce is checked against the id token of OpenID Connect providers
+	Nonce string
+	// CodeVerifier is the PKCE secret, its S256 challenge is sent with the authorization
+	// and the verifier itself with the code exchange
+	CodeVerifier string
+}
+
+// NewAuthRequest generates the values of a new authorization request
+func NewAuthRequest() (authRequest AuthRequest, err error) {
+	if authRequest.State, err = randomValue(); err != nil {
+		return
+	}
+	if authRequest.Nonce, err = randomValue(); err != nil {
+		return
+	}
+	authRequest.CodeVerifier, err = randomValue()
+	return
+}
+
+// randomValue returns 32 random bytes encoded as 43 url safe characters, long enough for a PKCE verifier
+func randomValue() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallenge returns the S256 PKCE challenge of a verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// IsOpenIDConnect checks if the provider is asked for an id token, which it is when the openid scope is requested
+func (p *Provider) IsOpenIDConnect() bool {
+	for _, scope := range p.Scopes {
+		if scope == "openid" {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiration and nonce of an id token and returns its subject
+func (p *Provider) verifyIDToken(idToken, clientID, nonce string) (subject string, err error) {
+	parser := &jwt.Parser{ValidMethods: idTokenMethods}
+	token, err := parser.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(kid)
+	})
+	if err != nil {
+		return "", fmt.Errorf("Id token of %s: %s", p.Name, err)
+	}
+	issuer, _ := token.Claims["iss"].(string)
+	tokenNonce, _ := token.Claims["nonce"].(string)
+	subject, _ = token.Claims["sub"].(string)
+	if strings.TrimRight(issuer, "/") != strings.TrimRight(p.Issuer, "/") || !hasAudience(token.Claims["aud"], clientID) ||
+		nonce == "" || tokenNonce != nonce || subject == "" {
+		return "", ErrInvalidIDToken
+	}
+	if _, expires := token.Claims["exp"]; !expires {
+		return "", ErrInvalidIDToken
+	}
+	return subject, nil
+}
+
+// hasAudience checks if the aud claim, a string or an array of strings, contains the client id
+func hasAudience(audience interface{}, clientID string) bool {
+	switch aud := audience.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonWebKey is a public key of the json web key set of a provider
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey returns the rsa or ecdsa public key
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	decode := func(value string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+		return new(big.Int).SetBytes(b), err
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, found := curves[k.Crv]
+		if !found {
+			return nil, fmt.Errorf("Unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("Unsupported key type %s", k.Kty)
+}
+
+// signingKey returns the key of the provider with the key id, the keys are fetched again when the key id
+// is unknown since providers rotate them
+func (p *Provider) signingKey(kid string) (interface{}, error) {
+	p.keysMutex.Lock()
+	defer p.keysMutex.Unlock()
+	if key, found := p.keys[kid]; found {
+		return key, nil
+	}
+	keys, err := p.fetchKeys()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	key, found := keys[kid]
+	if !found && kid == "" && len(keys) == 1 {
+		// A token without key id is signed with the only key
+		for _, key = range keys {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("Unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// fetchKeys gets the signing keys from the json web key set of the provider
+func (p *Provider) fetchKeys() (map[string]interface{}, error) {
+	if p.JWKSURI == "" {
+		return nil, fmt.Errorf("No jwks uri for %s", p.Name)
+	}
+	response, err := httpClient.Get(p.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Fetching the keys of %s failed: %s", p.Name, response.Status)
+	}
+	keySet := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err = json.NewDecoder(response.Body).Decode(&keySet); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
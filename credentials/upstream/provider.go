@@ -0,0 +1,328 @@
+package upstream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidProvider is returned when a provider configuration is incomplete
+	ErrInvalidProvider = errors.New("Invalid upstream identity provider")
+	// ErrNoSubject is returned when the userinfo of a provider does not contain the subject claim
+	ErrNoSubject = errors.New("No subject in the upstream userinfo")
+)
+
+var validProviderName = regexp.MustCompile(`^[a-z0-9\-]{2,30}$`)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// CredentialsLoader is used to get the client id and secret of providers that do not have them configured
+var CredentialsLoader func(name string) (clientID, clientSecret string, err error)
+
+// ClaimMapping maps the claims of the userinfo of a provider on the fields of an Identity.
+// Nested claims can be addressed with a dotted path like `picture.data.url`.
+type ClaimMapping struct {
+	Subject string `json:"subject"`
+	Name    string `json:"name"`
+	Login   string `json:"login"`
+	Email   string `json:"email"`
+	Picture string `json:"picture"`
+	Link    string `json:"link"`
+}
+
+// DefaultClaimMapping contains the standard OpenID Connect claims
+var DefaultClaimMapping = ClaimMapping{
+	Subject: "sub",
+	Name:    "name",
+	Login:   "preferred_username",
+	Email:   "email",
+	Picture: "picture",
+	Link:    "profile",
+}
+
+// Provider is an upstream OpenID Connect or OAuth2 identity provider
+type Provider struct {
+	// Name identifies the provider in the urls and in the linked accounts of the users
+	Name        string `json:"name"`
+	DisplayName string `json:"displayname"`
+	// Issuer is used to discover the endpoints that are not configured explicitly
+	Issuer                string       `json:"issuer"`
+	AuthorizationEndpoint string       `json:"authorizationendpoint"`
+	TokenEndpoint         string       `json:"tokenendpoint"`
+	UserInfoEndpoint      string       `json:"userinfoendpoint"`
+	ClientID              string       `json:"clientid"`
+	ClientSecret          string       `json:"clientsecret"`
+	Scopes                []string     `json:"scopes"`
+	Claims                ClaimMapping `json:"claims"`
+	// JWKSURI is the json web key set the id tokens of OpenID Connect providers are signed with,
+	// it is discovered from the issuer if it is not configured
+	JWKSURI string `json:"jwksuri"`
+	// CallbackPath is the path of the redirect uri, registered at the provider
+	CallbackPath string `json:"callbackpath"`
+
+	discovery sync.Mutex
+	keys      map[string]interface{}
+	keysMutex sync.Mutex
+}
+
+// Identity is the identity of a user at an upstream provider
+type Identity struct {
+	Subject string
+	Name    string
+	Login   string
+	Email   string
+	Picture string
+	Link    string
+}
+
+// Validate checks if the configuration of a provider is complete and fills in the defaults
+func (p *Provider) Validate() error {
+	if !validProviderName.MatchString(p.Name) {
+		return ErrInvalidProvider
+	}
+	if p.Issuer == "" && (p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.UserInfoEndpoint == "") {
+		return ErrInvalidProvider
+	}
+	// The issuer of the id tokens is checked
+	if p.IsOpenIDConnect() && p.Issuer == "" {
+		return ErrInvalidProvider
+	}
+	if p.DisplayName == "" {
+		p.DisplayName = p.Name
+	}
+	if p.CallbackPath == "" {
+		p.CallbackPath = "/upstream/" + p.Name + "/callback"
+	}
+	if p.Claims.Subject == "" {
+		p.Claims = DefaultClaimMapping
+	}
+	return nil
+}
+
+// credentials returns the configured client id and secret or the ones from the CredentialsLoader
+func (p *Provider) credentials() (clientID, clientSecret string, err error) {
+	if p.ClientID != "" || CredentialsLoader == nil {
+		return p.ClientID, p.ClientSecret, nil
+	}
+	return CredentialsLoader(p.Name)
+}
+
+// Available checks if the client credentials of the provider are known
+func (p *Provider) Available() bool {
+	clientID, _, err := p.credentials()
+	return err == nil && clientID != ""
+}
+
+// RedirectURI returns the redirect uri for a host
+func (p *Provider) RedirectURI(host string) string {
+	return "https://" + host + p.CallbackPath
+}
+
+// discover fetches the endpoints that are not configured from the openid configuration of the issuer
+func (p *Provider) discover() error {
+	p.discovery.Lock()
+	defer p.discovery.Unlock()
+	if p.AuthorizationEndpoint != "" && p.TokenEndpoint != "" && p.UserInfoEndpoint != "" &&
+		(p.JWKSURI != "" || !p.IsOpenIDConnect()) {
+		return nil
+	}
+	response, err := httpClient.Get(strings.TrimRight(p.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Discovery of %s failed: %s", p.Name, response.Status)
+	}
+	configuration := struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}{}
+	if err = json.NewDecoder(response.Body).Decode(&configuration); err != nil {
+		return err
+	}
+	if p.AuthorizationEndpoint == "" {
+		p.AuthorizationEndpoint = configuration.AuthorizationEndpoint
+	}
+	if p.TokenEndpoint == "" {
+		p.TokenEndpoint = configuration.TokenEndpoint
+	}
+	if p.UserInfoEndpoint == "" {
+		p.UserInfoEndpoint = configuration.UserInfoEndpoint
+	}
+	if p.JWKSURI == "" {
+		p.JWKSURI = configuration.JWKSURI
+	}
+	return nil
+}
+
+// Token is the result of a code exchange
+type Token struct {
+	AccessToken string
+	// Subject is the subject of the verified id token of an OpenID Connect provider, the userinfo needs to match it
+	Subject string
+}
+
+// AuthCodeURL returns the url of the provider to start an authorization code flow with PKCE,
+// OpenID Connect providers get the nonce as well
+func (p *Provider) AuthCodeURL(redirectURI string, authRequest AuthRequest) (string, error) {
+	if err := p.discover(); err != nil {
+		return "", err
+	}
+	clientID, _, err := p.credentials()
+	if err != nil {
+		return "", err
+	}
+	parameters := url.Values{}
+	parameters.Set("client_id", clientID)
+	parameters.Set("redirect_uri", redirectURI)
+	parameters.Set("response_type", "code")
+	parameters.Set("state", authRequest.State)
+	parameters.Set("code_challenge", codeChallenge(authRequest.CodeVerifier))
+	parameters.Set("code_challenge_method", "S256")
+	if p.IsOpenIDConnect() {
+		parameters.Set("nonce", authRequest.Nonce)
+	}
+	if len(p.Scopes) > 0 {
+		parameters.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + parameters.Encode(), nil
+}
+
+// Exchange exchanges an authorization code for an access token.
+// The id token of an OpenID Connect provider is required and verified against the authorization request.
+func (p *Provider) Exchange(code, redirectURI string, authRequest AuthRequest) (token Token, err error) {
+	if err = p.discover(); err != nil {
+		return
+	}
+	clientID, clientSecret, err := p.credentials()
+	if err != nil {
+		return
+	}
+	parameters := url.Values{}
+	parameters.Set("grant_type", "authorization_code")
+	parameters.Set("code", code)
+	parameters.Set("redirect_uri", redirectURI)
+	parameters.Set("client_id", clientID)
+	parameters.Set("client_secret", clientSecret)
+	parameters.Set("code_verifier", authRequest.CodeVerifier)
+	req, err := http.NewRequest("POST", p.TokenEndpoint, strings.NewReader(parameters.Encode()))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	response, err := httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	tokenResponse := struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		// Error is a string in the OAuth2 spec but an object for some providers
+		Error json.RawMessage `json:"error"`
+	}{}
+	if err = json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		return
+	}
+	if len(tokenResponse.Error) > 0 || response.StatusCode != http.StatusOK || tokenResponse.AccessToken == "" {
+		err = fmt.Errorf("Token exchange at %s failed: %s %s", p.Name, response.Status, tokenResponse.Error)
+		return
+	}
+	token.AccessToken = tokenResponse.AccessToken
+	if p.IsOpenIDConnect() {
+		if tokenResponse.IDToken == "" {
+			err = ErrInvalidIDToken
+			return
+		}
+		token.Subject, err = p.verifyIDToken(tokenResponse.IDToken, clientID, authRequest.Nonce)
+	}
+	return
+}
+
+// UserInfo gets the identity of the user the access token belongs to,
+// for OpenID Connect providers it has to be the subject of the id token
+func (p *Provider) UserInfo(token Token) (identity *Identity, err error) {
+	if err = p.discover(); err != nil {
+		return
+	}
+	req, err := http.NewRequest("GET", p.UserInfoEndpoint, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+	response, err := httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("Userinfo request at %s failed: %s", p.Name, response.Status)
+		return
+	}
+	decoder := json.NewDecoder(response.Body)
+	// Keep numeric ids like the github user id as they are
+	decoder.UseNumber()
+	claims := map[string]interface{}{}
+	if err = decoder.Decode(&claims); err != nil {
+		return
+	}
+	if token.Subject != "" && claim(claims, "sub") != token.Subject {
+		err = ErrSubjectMismatch
+		return
+	}
+	return p.mapClaims(claims)
+}
+
+func (p *Provider) mapClaims(claims map[string]interface{}) (*Identity, error) {
+	identity := &Identity{
+		Subject: claim(claims, p.Claims.Subject),
+		Name:    claim(claims, p.Claims.Name),
+		Login:   claim(claims, p.Claims.Login),
+		Email:   claim(claims, p.Claims.Email),
+		Picture: claim(claims, p.Claims.Picture),
+		Link:    claim(claims, p.Claims.Link),
+	}
+	if identity.Subject == "" {
+		return nil, ErrNoSubject
+	}
+	return identity, nil
+}
+
+// claim looks up a dotted path in the claims and returns it as a string
+func claim(claims map[string]interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+	var value interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[part]
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
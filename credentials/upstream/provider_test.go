@@ -0,0 +1,160 @@
+package upstream
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderFlow(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err) {
+		return
+	}
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	// The provider remembers the challenge of the authorization and puts idTokenNonce in the id token
+	var challenge, idTokenNonce string
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"userinfo_endpoint":      server.URL + "/userinfo",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "thekey",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "thecode" || r.Form.Get("client_secret") != "secret" || codeChallenge(r.Form.Get("code_verifier")) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		idToken := jwt.New(jwt.SigningMethodRS256)
+		idToken.Header["kid"] = "thekey"
+		idToken.Claims["iss"] = server.URL
+		idToken.Claims["aud"] = []string{"client"}
+		idToken.Claims["sub"] = "1234"
+		idToken.Claims["nonce"] = idTokenNonce
+		idToken.Claims["exp"] = time.Now().Add(time.Minute).Unix()
+		signed, _ := idToken.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "thetoken", "token_type": "bearer", "id_token": signed})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer thetoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"sub": "1234", "id": 1234, "name": "Bob", "picture": {"data": {"url": "https://example.com/bob.png"}}}`))
+	})
+
+	p := &Provider{
+		Name:         "example",
+		Issuer:       server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"openid", "profile"},
+		Claims:       ClaimMapping{Subject: "id", Name: "name", Picture: "picture.data.url"},
+	}
+	assert.NoError(t, p.Validate())
+	assert.Equal(t, "/upstream/example/callback", p.CallbackPath)
+	assert.Equal(t, "https://itsyou.online/upstream/example/callback", p.RedirectURI("itsyou.online"))
+	redirectURI := "https://itsyou.online/upstream/example/callback"
+	authRequest, err := NewAuthRequest()
+	assert.NoError(t, err)
+	authorizeURL, err := p.AuthCodeURL(redirectURI, authRequest)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(authorizeURL, server.URL+"/authorize?"))
+	parsed, _ := url.Parse(authorizeURL)
+	assert.Equal(t, "client", parsed.Query().Get("client_id"))
+	assert.Equal(t, authRequest.State, parsed.Query().Get("state"))
+	assert.Equal(t, authRequest.Nonce, parsed.Query().Get("nonce"))
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+	assert.NotContains(t, authorizeURL, authRequest.CodeVerifier, "only the challenge is sent to the browser")
+	assert.Equal(t, "openid profile", parsed.Query().Get("scope"))
+	challenge = parsed.Query().Get("code_challenge")
+	idTokenNonce = authRequest.Nonce
+
+	_, err = p.Exchange("wrongcode", redirectURI, authRequest)
+	assert.Error(t, err)
+	_, err = p.Exchange("thecode", redirectURI, AuthRequest{State: authRequest.State, Nonce: authRequest.Nonce, CodeVerifier: "other"})
+	assert.Error(t, err, "the code can only be exchanged with the verifier of the authorization")
+	token, err := p.Exchange("thecode", redirectURI, authRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, Token{AccessToken: "thetoken", Subject: "1234"}, token)
+
+	identity, err := p.UserInfo(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", identity.Subject)
+	assert.Equal(t, "Bob", identity.Name)
+	assert.Equal(t, "https://example.com/bob.png", identity.Picture)
+	assert.Equal(t, "", identity.Email)
+	_, err = p.UserInfo(Token{AccessToken: "othertoken"})
+	assert.Error(t, err)
+	_, err = p.UserInfo(Token{AccessToken: "thetoken", Subject: "5678"})
+	assert.Equal(t, ErrSubjectMismatch, err)
+
+	idTokenNonce = "othernonce"
+	_, err = p.Exchange("thecode", redirectURI, authRequest)
+	assert.Equal(t, ErrInvalidIDToken, err, "the id token was issued for another authorization")
+	idTokenNonce = authRequest.Nonce
+	p.ClientID = "otherclient"
+	_, err = p.Exchange("thecode", redirectURI, authRequest)
+	assert.Error(t, err, "the id token was issued for another client")
+}
+
+func TestProviderValidate(t *testing.T) {
+	assert.Equal(t, ErrInvalidProvider, (&Provider{Name: "Invalid Name", Issuer: "https://example.com"}).Validate())
+	assert.Equal(t, ErrInvalidProvider, (&Provider{Name: "example"}).Validate())
+
+	p := &Provider{Name: "example", Issuer: "https://example.com"}
+	assert.NoError(t, p.Validate())
+	assert.Equal(t, "example", p.DisplayName)
+	assert.Equal(t, ErrInvalidProvider, (&Provider{Name: "example", AuthorizationEndpoint: "https://example.com/authorize",
+		TokenEndpoint: "https://example.com/token", UserInfoEndpoint: "https://example.com/userinfo", Scopes: []string{"openid"}}).Validate(),
+		"the issuer of the id tokens is needed")
+	assert.Equal(t, DefaultClaimMapping, p.Claims)
+
+	assert.NoError(t, Facebook().Validate())
+	assert.NoError(t, GitHub().Validate())
+}
+
+func TestCredentialsLoader(t *testing.T) {
+	defer func() { CredentialsLoader = nil }()
+	p := GitHub()
+	assert.False(t, p.Available())
+
+	CredentialsLoader = func(name string) (string, string, error) {
+		return name + "-clientid", name + "-secret", nil
+	}
+	assert.True(t, p.Available())
+	authorizeURL, err := p.AuthCodeURL(p.RedirectURI("itsyou.online"), AuthRequest{State: "thestate", Nonce: "thenonce", CodeVerifier: "theverifier"})
+	assert.NoError(t, err)
+	parsed, _ := url.Parse(authorizeURL)
+	assert.Equal(t, "github-clientid", parsed.Query().Get("client_id"))
+	assert.Equal(t, codeChallenge("theverifier"), parsed.Query().Get("code_challenge"))
+	assert.Empty(t, parsed.Query().Get("nonce"), "github is not an OpenID Connect provider")
+	assert.Equal(t, "https://itsyou.online/github_callback", parsed.Query().Get("redirect_uri"))
+}
@@ -0,0 +1,107 @@
+package upstream
+
+import (
+	"encoding/json"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	providers     = map[string]*Provider{}
+	providerNames []string
+)
+
+// Facebook returns the builtin facebook provider.
+// The client id and secret are configured in the globalconfig with keys facebook-clientid and facebook-secret.
+func Facebook() *Provider {
+	return &Provider{
+		Name:                  "facebook",
+		DisplayName:           "Facebook",
+		AuthorizationEndpoint: "https://www.facebook.com/dialog/oauth",
+		TokenEndpoint:         "https://graph.facebook.com/v2.6/oauth/access_token",
+		UserInfoEndpoint:      "https://graph.facebook.com/v2.6/me?fields=id,picture,link,name",
+		Claims: ClaimMapping{
+			Subject: "id",
+			Name:    "name",
+			Picture: "picture.data.url",
+			Link:    "link",
+		},
+		CallbackPath: "/facebook_callback",
+	}
+}
+
+// GitHub returns the builtin github provider.
+// The client id and secret are configured in the globalconfig with keys github-clientid and github-secret.
+func GitHub() *Provider {
+	return &Provider{
+		Name:                  "github",
+		DisplayName:           "GitHub",
+		AuthorizationEndpoint: "https://github.com/login/oauth/authorize",
+		TokenEndpoint:         "https://github.com/login/oauth/access_token",
+		UserInfoEndpoint:      "https://api.github.com/user",
+		Claims: ClaimMapping{
+			Subject: "id",
+			Name:    "name",
+			Login:   "login",
+			Email:   "email",
+			Picture: "avatar_url",
+			Link:    "html_url",
+		},
+		CallbackPath: "/github_callback",
+	}
+}
+
+// Register adds a provider, a provider with the same name is replaced
+func Register(p *Provider) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if _, exists := providers[p.Name]; !exists {
+		providerNames = append(providerNames, p.Name)
+	}
+	providers[p.Name] = p
+	return nil
+}
+
+// RegisterDefaults adds the builtin facebook and github providers
+func RegisterDefaults() {
+	Register(Facebook())
+	Register(GitHub())
+}
+
+// LoadProviders reads a json file with a list of providers and registers them
+func LoadProviders(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var configured []*Provider
+	if err = json.NewDecoder(f).Decode(&configured); err != nil {
+		return err
+	}
+	for _, p := range configured {
+		if err = Register(p); err != nil {
+			log.Errorf("Invalid upstream identity provider %q in %s", p.Name, path)
+			return err
+		}
+	}
+	log.Infof("Loaded %d upstream identity providers from %s", len(configured), path)
+	return nil
+}
+
+// Get returns the provider with the given name
+func Get(name string) (p *Provider, found bool) {
+	p, found = providers[name]
+	return
+}
+
+// List returns all providers in the order they were registered
+func List() []*Provider {
+	list := make([]*Provider, 0, len(providerNames))
+	for _, name := range providerNames {
+		list = append(list, providers[name])
+	}
+	return list
+}
@@ -0,0 +1,76 @@
+// Package audit stores the security relevant actions of users, like logins, password changes and changes of
+// the organizations, authorizations and api keys. The log is append only, events are removed when their retention ends.
+package audit
+
+import (
+	"net/http"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	mongoAuditCollectionName = "auditlog"
+)
+
+// Manager is used to store and query the audit log
+type Manager interface {
+	Save(event *Event) error
+	// ListByUser returns the events the user did or that are about the user
+	ListByUser(username string, query Query) ([]Event, error)
+	// ListByOrganization returns the events about an organization
+	ListByOrganization(globalID string, query Query) ([]Event, error)
+}
+
+// mongoManager stores the audit log in mongo, a TTL index removes the expired events
+type mongoManager struct {
+	collection *mgo.Collection
+}
+
+// NewManager creates and initializes a new Manager
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
+	return &mongoManager{collection: db.GetCollection(db.GetDBSession(r), mongoAuditCollectionName)}
+}
+
+// Save stores a new event
+func (m *mongoManager) Save(event *Event) error {
+	if event.ID == "" {
+		event.ID = bson.NewObjectId()
+	}
+	return m.collection.Insert(event)
+}
+
+func (m *mongoManager) ListByUser(username string, query Query) ([]Event, error) {
+	return m.find(bson.M{"$or": []bson.M{{"actor": username}, {"subject": username}}}, query)
+}
+
+func (m *mongoManager) ListByOrganization(globalID string, query Query) ([]Event, error) {
+	return m.find(bson.M{"organization": globalID}, query)
+}
+
+// find adds the conditions of the query to a selector and returns the matching events, newest first
+func (m *mongoManager) find(selector bson.M, query Query) ([]Event, error) {
+	period := bson.M{}
+	if !query.Since.IsZero() {
+		period["$gte"] = query.Since
+	}
+	if !query.Before.IsZero() {
+		period["$lt"] = query.Before
+	}
+	if len(period) > 0 {
+		selector["timestamp"] = period
+	}
+	if query.Action != "" {
+		selector["action"] = query.Action
+	}
+	events := []Event{}
+	err := m.collection.Find(selector).Sort("-timestamp").Limit(query.limit()).All(&events)
+	return events, err
+}
@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	events []Event
+}
+
+// memoryManager keeps the audit log in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoAuditCollectionName, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) Save(event *Event) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if event.ID == "" {
+		event.ID = bson.NewObjectId()
+	}
+	m.store.events = append(m.store.events, *event)
+	return nil
+}
+
+func (m *memoryManager) ListByUser(username string, query Query) ([]Event, error) {
+	return m.find(func(e *Event) bool { return e.Actor == username || e.Subject == username }, query), nil
+}
+
+func (m *memoryManager) ListByOrganization(globalID string, query Query) ([]Event, error) {
+	return m.find(func(e *Event) bool { return e.Organization == globalID }, query), nil
+}
+
+// find returns the events that did not expire and match the query, newest first
+func (m *memoryManager) find(selector func(e *Event) bool, query Query) []Event {
+	m.store.Lock()
+	defer m.store.Unlock()
+	now := time.Now()
+	events := []Event{}
+	for i := range m.store.events {
+		e := &m.store.events[i]
+		if now.Before(e.ExpiresAt) && selector(e) && query.matches(e) {
+			events = append(events, *e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.After(events[j].Timestamp) })
+	if len(events) > query.limit() {
+		events = events[:query.limit()]
+	}
+	return events
+}
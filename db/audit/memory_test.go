@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryQuery(t *testing.T) {
+	m := newMemoryManager(db.NewMemoryBackend())
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	events := []Event{
+		{Timestamp: now.Add(-3 * time.Minute), Action: ActionLogin, Actor: "alice", ExpiresAt: expiresAt},
+		{Timestamp: now.Add(-2 * time.Minute), Action: ActionMemberAdded, Actor: "alice", Subject: "bob", Organization: "myorg", ExpiresAt: expiresAt},
+		{Timestamp: now.Add(-time.Minute), Action: ActionAPIKeyCreated, Actor: "alice", Organization: "myorg", ExpiresAt: expiresAt},
+		{Timestamp: now.Add(-4 * time.Minute), Action: ActionLogin, Actor: "alice", ExpiresAt: now.Add(-time.Second)},
+	}
+	for i := range events {
+		assert.NoError(t, m.Save(&events[i]))
+	}
+
+	found, err := m.ListByUser("alice", Query{})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 3, "expired events are not listed") {
+		assert.Equal(t, ActionAPIKeyCreated, found[0].Action, "newest first")
+		assert.Equal(t, ActionLogin, found[2].Action)
+	}
+
+	found, err = m.ListByUser("bob", Query{})
+	assert.NoError(t, err)
+	assert.Len(t, found, 1, "events about a user are listed for the user")
+
+	found, err = m.ListByOrganization("myorg", Query{Before: events[2].Timestamp})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, ActionMemberAdded, found[0].Action)
+	}
+
+	found, err = m.ListByUser("alice", Query{Since: events[1].Timestamp, Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	found, err = m.ListByUser("alice", Query{Action: ActionLogin})
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+}
+
+func TestParseQuery(t *testing.T) {
+	query, err := ParseQuery(url.Values{"since": {"2017-04-18T10:00:00Z"}, "action": {ActionLogin}, "limit": {"5000"}})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2017, 4, 18, 10, 0, 0, 0, time.UTC), query.Since.UTC())
+	assert.Equal(t, ActionLogin, query.Action)
+	assert.Equal(t, MaxLimit, query.limit())
+	assert.Equal(t, DefaultLimit, Query{}.limit())
+
+	_, err = ParseQuery(url.Values{"before": {"yesterday"}})
+	assert.EqualError(t, err, "invalid_before")
+	_, err = ParseQuery(url.Values{"limit": {"0"}})
+	assert.EqualError(t, err, "invalid_limit")
+}
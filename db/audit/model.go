@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The actions that are recorded in the audit log
+const (
+	// ActionLogin is a login step, Detail is the factor that was checked
+	ActionLogin = "login"
+	// ActionPasswordChanged is recorded when a user changes the password
+	ActionPasswordChanged = "password_changed"
+	// ActionPasswordReset is recorded when a user resets the password with a reset token
+	ActionPasswordReset = "password_reset"
+	// ActionTOTPSet and ActionTOTPRemoved are recorded when the authenticator application is set up or removed
+	ActionTOTPSet     = "totp_set"
+	ActionTOTPRemoved = "totp_removed"
+	// ActionAuthorizationGranted is recorded when a user authorizes an organization or changes the authorization,
+	// Detail holds the authorized scopes
+	ActionAuthorizationGranted = "authorization_granted"
+	// ActionAuthorizationRemoved is recorded when an authorization is revoked
+	ActionAuthorizationRemoved = "authorization_removed"
+	// ActionMemberAdded and ActionOwnerAdded are recorded when a user or an organization joins an organization,
+	// Detail is DetailInvitation if it accepted an invitation
+	ActionMemberAdded = "member_added"
+	ActionOwnerAdded  = "owner_added"
+	// ActionMemberRemoved is recorded when a member or owner leaves or is removed from an organization,
+	// Detail is the role it had
+	ActionMemberRemoved = "member_removed"
+	// ActionRoleChanged is recorded when a member becomes an owner or the other way around, Detail is the new role
+	ActionRoleChanged = "role_changed"
+	// ActionAPIKeyCreated and ActionAPIKeyRemoved are recorded for the api keys of users and organizations,
+	// Detail is the label of the key
+	ActionAPIKeyCreated = "apikey_created"
+	ActionAPIKeyRemoved = "apikey_removed"
+	// ActionGrantAdded, ActionGrantUpdated and ActionGrantRemoved are recorded when an organization changes
+	// the grants of a user, Detail is the grant
+	ActionGrantAdded   = "grant_added"
+	ActionGrantUpdated = "grant_updated"
+	ActionGrantRemoved = "grant_removed"
+)
+
+// DetailInvitation is the Detail of the events of members that joined by accepting an invitation
+const DetailInvitation = "invitation"
+
+// Outcomes of an action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is an entry in the audit log, events are never changed once they are stored
+type Event struct {
+	ID        bson.ObjectId `json:"id" bson:"_id,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+	Action    string        `json:"action"`
+	Outcome   string        `json:"outcome"`
+	// Actor is the user that did the action
+	Actor string `json:"actor,omitempty"`
+	// Subject is the user the action is about
+	Subject string `json:"subject,omitempty"`
+	// Organization is the organization the action is about
+	Organization string `json:"organization,omitempty"`
+	// MemberOrganization is the organization that joined, left or changed its role in Organization
+	MemberOrganization string `json:"memberorganization,omitempty"`
+	// ClientID is the client the action was done through
+	ClientID  string `json:"clientid,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	RequestID string `json:"requestid,omitempty"`
+	// Detail describes the action further, like the label of an api key
+	Detail string `json:"detail,omitempty"`
+	// ExpiresAt is the moment the event is removed, it depends on the retention policy
+	ExpiresAt time.Time `json:"-"`
+}
+
+const (
+	// DefaultLimit is the number of events returned if the query has no limit
+	DefaultLimit = 100
+	// MaxLimit is the maximum number of events returned by a query
+	MaxLimit = 1000
+)
+
+// Query selects the events of a log, newest first
+type Query struct {
+	// Since and Before limit the events to a period, Before is exclusive so it can be set to the timestamp
+	// of the last event of the previous page. They are ignored if they are zero.
+	Since  time.Time
+	Before time.Time
+	// Action limits the events to one action if it is set
+	Action string
+	Limit  int
+}
+
+// limit returns the number of events the query returns at most
+func (q Query) limit() int {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+// matches checks if an event is in the period and has the action of the query
+func (q Query) matches(e *Event) bool {
+	return (q.Since.IsZero() || !e.Timestamp.Before(q.Since)) &&
+		(q.Before.IsZero() || e.Timestamp.Before(q.Before)) &&
+		(q.Action == "" || e.Action == q.Action)
+}
+
+// ParseQuery reads a query from the since, before, action and limit parameters of a request,
+// since and before are RFC 3339 timestamps
+func ParseQuery(values url.Values) (query Query, err error) {
+	if since := values.Get("since"); since != "" {
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return query, errors.New("invalid_since")
+		}
+	}
+	if before := values.Get("before"); before != "" {
+		if query.Before, err = time.Parse(time.RFC3339, before); err != nil {
+			return query, errors.New("invalid_before")
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, errors.New("invalid_limit")
+		}
+	}
+	query.Action = values.Get("action")
+	return query, nil
+}
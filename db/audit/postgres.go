@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var postgresEvents = &db.PostgresCollection{
+	Table: "auditlog",
+	Columns: func(document interface{}) map[string]interface{} {
+		event := document.(*Event)
+		return map[string]interface{}{
+			"actor":        event.Actor,
+			"subject":      event.Subject,
+			"organization": event.Organization,
+			"action":       event.Action,
+			"occurred_at":  event.Timestamp,
+			"expires_at":   event.ExpiresAt,
+		}
+	},
+}
+
+// postgresManager stores the audit log in a postgres database, the expired rows are removed by the backend
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) Save(event *Event) error {
+	if event.ID == "" {
+		event.ID = bson.NewObjectId()
+	}
+	return postgresEvents.Insert(m.db, event)
+}
+
+func (m *postgresManager) ListByUser(username string, query Query) ([]Event, error) {
+	return m.find("(actor = $1 OR subject = $1)", []interface{}{username}, query)
+}
+
+func (m *postgresManager) ListByOrganization(globalID string, query Query) ([]Event, error) {
+	return m.find("organization = $1", []interface{}{globalID}, query)
+}
+
+// find adds the conditions of the query to a where clause and returns the matching events, newest first
+func (m *postgresManager) find(where string, args []interface{}, query Query) ([]Event, error) {
+	if !query.Since.IsZero() {
+		args = append(args, query.Since)
+		where += fmt.Sprintf(" AND occurred_at >= $%d", len(args))
+	}
+	if !query.Before.IsZero() {
+		args = append(args, query.Before)
+		where += fmt.Sprintf(" AND occurred_at < $%d", len(args))
+	}
+	if query.Action != "" {
+		args = append(args, query.Action)
+		where += fmt.Sprintf(" AND action = $%d", len(args))
+	}
+	args = append(args, query.limit())
+	where += fmt.Sprintf(" ORDER BY occurred_at DESC, seq DESC LIMIT $%d", len(args))
+	events := []Event{}
+	err := postgresEvents.Find(m.db, &events, where, args...)
+	return events, err
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/itsyouonline/identityserver/logging"
+)
+
+// The retention policies, they can be changed before the server starts
+var (
+	// Retention is how long the events are kept
+	Retention = 365 * 24 * time.Hour
+	// FailureRetention is how long the failed actions are kept, like wrong passwords. They are far more common
+	// than the other events and only matter to investigate recent attacks.
+	FailureRetention = 90 * 24 * time.Hour
+)
+
+// listeners are called with every recorded event
+var listeners []func(r *http.Request, event Event)
+
+// Subscribe adds a function that is called with every recorded event, like the webhooks that forward them.
+// Listeners are added before the server starts.
+func Subscribe(listener func(r *http.Request, event Event)) {
+	listeners = append(listeners, listener)
+}
+
+// Record stores an event of a request. The actor, client, ip address and request id are taken from the request
+// if the event does not have them and the outcome is a success if it is not set.
+// A failure to store the event is logged, it does not fail the action that is recorded.
+func Record(r *http.Request, event Event) {
+	event.Timestamp = time.Now()
+	if event.Outcome == "" {
+		event.Outcome = OutcomeSuccess
+	}
+	retention := Retention
+	if event.Outcome == OutcomeFailure {
+		retention = FailureRetention
+	}
+	event.ExpiresAt = event.Timestamp.Add(retention)
+	if event.Actor == "" {
+		event.Actor = logging.Username(r)
+	}
+	if event.ClientID == "" {
+		event.ClientID = logging.ClientID(r)
+	}
+	event.IP = logging.ClientIP(r)
+	event.RequestID = logging.RequestID(r)
+	if err := NewManager(r).Save(&event); err != nil {
+		logging.FromRequest(r).WithField("action", event.Action).Error("Failed to record the audit event: ", err)
+	}
+	for _, listener := range listeners {
+		listener(r, event)
+	}
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/context"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Backend is the storage used by the managers.
+// Managers are created from a request and use the backend that was opened for the request.
+type Backend interface {
+	// Open makes the storage available to the managers created from the request,
+	// the returned function releases it when the request is handled
+	Open(r *http.Request) (release func(), err error)
+}
+
+var defaultBackend Backend = MongoBackend{}
+
+// SetDefaultBackend sets the backend used by the http handlers and background work
+func SetDefaultBackend(backend Backend) {
+	defaultBackend = backend
+}
+
+// DefaultBackend returns the backend used by the http handlers and background work, mongo unless configured otherwise
+func DefaultBackend() Backend {
+	return defaultBackend
+}
+
+// OpenBackend opens a backend for a request
+func OpenBackend(backend Backend, r *http.Request) (release func(), err error) {
+	release, err = backend.Open(r)
+	if err != nil {
+		return
+	}
+	context.Set(r, DB_BACKEND, backend)
+	return
+}
+
+// GetBackend returns the backend that was opened for a request
+func GetBackend(r *http.Request) Backend {
+	backend := context.Get(r, DB_BACKEND)
+	if backend == nil {
+		return nil
+	}
+	return backend.(Backend)
+}
+
+// NewBackgroundRequest creates a request with the backend opened for work that is done outside of an http request,
+// the managers get their storage from the request. The returned function releases the backend.
+func NewBackgroundRequest(backend Backend, host string) (r *http.Request, release func(), err error) {
+	r = &http.Request{Host: host}
+	release, err = OpenBackgroundRequest(backend, r)
+	return
+}
+
+// OpenBackgroundRequest opens the backend for a request created for background work, like NewBackgroundRequest
+// but for a request that carries a context. The returned function releases the backend.
+func OpenBackgroundRequest(backend Backend, r *http.Request) (release func(), err error) {
+	releaseBackend, err := OpenBackend(backend, r)
+	if err != nil {
+		return
+	}
+	release = func() {
+		releaseBackend()
+		context.Clear(r)
+	}
+	return
+}
+
+// MongoBackend stores everything in the mongo database Connect connected to
+type MongoBackend struct{}
+
+// Open copies the mongo session for the request
+func (MongoBackend) Open(r *http.Request) (release func(), err error) {
+	session := SetDBSession(r)
+	if session == nil {
+		err = errors.New("Failed to retrieve a DB session!")
+		return
+	}
+	release = session.Close
+	return
+}
+
+// MemoryBackend keeps everything in memory, so the http handlers can be tested without a database.
+// Every package keeps its data in its own store.
+type MemoryBackend struct {
+	lock   sync.Mutex
+	stores map[string]interface{}
+}
+
+// NewMemoryBackend creates an empty MemoryBackend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{stores: make(map[string]interface{})}
+}
+
+// Open does nothing, the memory is shared by all requests
+func (b *MemoryBackend) Open(r *http.Request) (release func(), err error) {
+	release = func() {}
+	return
+}
+
+// Store returns the store with a name, it is created the first time it is requested
+func (b *MemoryBackend) Store(name string, create func() interface{}) interface{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	store, ok := b.stores[name]
+	if !ok {
+		store = create()
+		b.stores[name] = store
+	}
+	return store
+}
+
+// GetMemoryBackend returns the memory backend of a request, or nil if the request uses another backend
+func GetMemoryBackend(r *http.Request) *MemoryBackend {
+	backend, _ := GetBackend(r).(*MemoryBackend)
+	return backend
+}
+
+// CopyDocument copies src into dst the way it would be stored in and loaded from mongo,
+// the memory stores use it so callers never share data with the store
+func CopyDocument(dst interface{}, src interface{}) error {
+	data, err := bson.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, dst)
+}
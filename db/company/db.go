@@ -14,18 +14,17 @@ const (
 	COLLECTION_COMPANIES = "companies" // name of the company collection in mongodb
 )
 
-//InitModels initializes models in DB, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:      []string{"globalid"},
-		Unique:   true,
-		DropDups: true,
-	}
-
-	db.EnsureIndex(COLLECTION_COMPANIES, index)
+// CompanyManager is used to store companies
+type CompanyManager interface {
+	Get(id string) (*Company, error)
+	GetByName(globalId string) (*Company, error)
+	Exists(globalId string) bool
+	Create(company *Company) error
+	Save(company *Company) error
+	Delete(company *Company) error
 }
 
-type CompanyManager struct {
+type mongoCompanyManager struct {
 	session    *mgo.Session
 	collection *mgo.Collection
 }
@@ -34,16 +33,22 @@ func getCompanyCollection(session *mgo.Session) *mgo.Collection {
 	return db.GetCollection(session, COLLECTION_COMPANIES)
 }
 
-func NewCompanyManager(r *http.Request) *CompanyManager {
+func NewCompanyManager(r *http.Request) CompanyManager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryCompanyManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresCompanyManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &CompanyManager{
+	return &mongoCompanyManager{
 		session:    session,
 		collection: getCompanyCollection(session),
 	}
 }
 
 // Get company by ID.
-func (cm *CompanyManager) Get(id string) (*Company, error) {
+func (cm *mongoCompanyManager) Get(id string) (*Company, error) {
 	var company Company
 
 	objectId := bson.ObjectIdHex(id)
@@ -56,7 +61,7 @@ func (cm *CompanyManager) Get(id string) (*Company, error) {
 }
 
 //GetByName get a company by globalid.
-func (cm *CompanyManager) GetByName(globalId string) (*Company, error) {
+func (cm *mongoCompanyManager) GetByName(globalId string) (*Company, error) {
 	var company Company
 
 	err := cm.collection.Find(bson.M{"globalid": globalId}).One(&company)
@@ -65,7 +70,7 @@ func (cm *CompanyManager) GetByName(globalId string) (*Company, error) {
 }
 
 //Exists checks if a company exists.
-func (cm *CompanyManager) Exists(globalId string) bool {
+func (cm *mongoCompanyManager) Exists(globalId string) bool {
 	count, _ := cm.collection.Find(bson.M{"globalid": globalId}).Count()
 
 	return count != 1
@@ -76,7 +81,7 @@ func (c *Company) GetId() string {
 }
 
 // Create a company.
-func (cm *CompanyManager) Create(company *Company) error {
+func (cm *mongoCompanyManager) Create(company *Company) error {
 	// TODO: Validation!
 
 	company.ID = bson.NewObjectId()
@@ -88,14 +93,14 @@ func (cm *CompanyManager) Create(company *Company) error {
 }
 
 // Save a company.
-func (cm *CompanyManager) Save(company *Company) error {
+func (cm *mongoCompanyManager) Save(company *Company) error {
 	// TODO: Validation!
 	// TODO: save
 	return errors.New("Save is not implemented for a company")
 }
 
 // Delete a company.
-func (cm *CompanyManager) Delete(company *Company) error {
+func (cm *mongoCompanyManager) Delete(company *Company) error {
 	//TODO: implement delete company
 	return errors.New("Not implemented")
 }
@@ -0,0 +1,92 @@
+package company
+
+import (
+	"errors"
+	"sync"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	companies []Company
+}
+
+type memoryCompanyManager struct {
+	store *memoryStore
+}
+
+func newMemoryCompanyManager(backend *db.MemoryBackend) *memoryCompanyManager {
+	store := backend.Store(COLLECTION_COMPANIES, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryCompanyManager{store: store}
+}
+
+// find returns a copy of the first company that matches or mgo.ErrNotFound
+func (cm *memoryCompanyManager) find(match func(company *Company) bool) (*Company, error) {
+	cm.store.Lock()
+	defer cm.store.Unlock()
+	for _, company := range cm.store.companies {
+		if match(&company) {
+			var copied Company
+			err := db.CopyDocument(&copied, &company)
+			return &copied, err
+		}
+	}
+	return nil, mgo.ErrNotFound
+}
+
+func (cm *memoryCompanyManager) Get(id string) (*Company, error) {
+	objectId := bson.ObjectIdHex(id)
+	return cm.find(func(company *Company) bool { return company.ID == objectId })
+}
+
+func (cm *memoryCompanyManager) GetByName(globalId string) (*Company, error) {
+	company, err := cm.find(func(company *Company) bool { return company.Globalid == globalId })
+	if company == nil {
+		company = &Company{}
+	}
+	return company, err
+}
+
+// Exists mirrors the mongo implementation, which reports false for exactly one match
+func (cm *memoryCompanyManager) Exists(globalId string) bool {
+	cm.store.Lock()
+	defer cm.store.Unlock()
+	count := 0
+	for _, company := range cm.store.companies {
+		if company.Globalid == globalId {
+			count++
+		}
+	}
+	return count != 1
+}
+
+func (cm *memoryCompanyManager) Create(company *Company) error {
+	company.ID = bson.NewObjectId()
+	var stored Company
+	if err := db.CopyDocument(&stored, company); err != nil {
+		return err
+	}
+	cm.store.Lock()
+	defer cm.store.Unlock()
+	for _, existing := range cm.store.companies {
+		if existing.Globalid == company.Globalid {
+			return db.ErrDuplicate
+		}
+	}
+	cm.store.companies = append(cm.store.companies, stored)
+	return nil
+}
+
+func (cm *memoryCompanyManager) Save(company *Company) error {
+	return errors.New("Save is not implemented for a company")
+}
+
+func (cm *memoryCompanyManager) Delete(company *Company) error {
+	return errors.New("Not implemented")
+}
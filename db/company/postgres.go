@@ -0,0 +1,58 @@
+package company
+
+import (
+	"database/sql"
+	"errors"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+var postgresCompanies = &db.PostgresCollection{
+	Table: COLLECTION_COMPANIES,
+	Columns: func(document interface{}) map[string]interface{} {
+		return map[string]interface{}{"globalid": document.(*Company).Globalid}
+	},
+}
+
+type postgresCompanyManager struct {
+	db *sql.DB
+}
+
+func newPostgresCompanyManager(pg *sql.DB) *postgresCompanyManager {
+	return &postgresCompanyManager{db: pg}
+}
+
+func (cm *postgresCompanyManager) Get(id string) (*Company, error) {
+	var company Company
+	if err := postgresCompanies.FindOne(cm.db, &company, "id = $1", bson.ObjectIdHex(id).Hex()); err != nil {
+		return nil, err
+	}
+	return &company, nil
+}
+
+func (cm *postgresCompanyManager) GetByName(globalId string) (*Company, error) {
+	var company Company
+	err := postgresCompanies.FindOne(cm.db, &company, "globalid = $1", globalId)
+	return &company, err
+}
+
+// Exists mirrors the mongo implementation, which reports false for exactly one match
+func (cm *postgresCompanyManager) Exists(globalId string) bool {
+	count, _ := postgresCompanies.Count(cm.db, "globalid = $1", globalId)
+	return count != 1
+}
+
+func (cm *postgresCompanyManager) Create(company *Company) error {
+	company.ID = bson.NewObjectId()
+	return postgresCompanies.Insert(cm.db, company)
+}
+
+func (cm *postgresCompanyManager) Save(company *Company) error {
+	return errors.New("Save is not implemented for a company")
+}
+
+func (cm *postgresCompanyManager) Delete(company *Company) error {
+	return errors.New("Not implemented")
+}
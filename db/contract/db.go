@@ -15,33 +15,42 @@ const (
 	mongoCollectionName = "contracts"
 )
 
-//InitModels initialize models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:    []string{"contractid"},
-		Unique: true,
-	}
-
-	db.EnsureIndex(mongoCollectionName, index)
+//Manager is used to store contracts
+type Manager interface {
+	Save(contract *Contract) (err error)
+	Exists(contractID string) (bool, error)
+	AddSignature(contractID string, signature Signature) (err error)
+	Get(contractid string) (contract *Contract, err error)
+	Delete(contractid string) (err error)
+	IsParticipant(contractID string, name string) (isparticipant bool, err error)
+	GetByIncludedParty(party *Party, start int, max int, includeExpired bool) (contracts []Contract, err error)
+	// RemoveExpired removes the contracts that expired before a moment, contracts without expiration are kept
+	RemoveExpired(before time.Time) (removed int, err error)
 }
 
-//Manager is used to store organizations
-type Manager struct {
+//mongoManager stores the contracts in mongo
+type mongoManager struct {
 	session    *mgo.Session
 	collection *mgo.Collection
 }
 
 //NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session:    session,
 		collection: db.GetCollection(session, mongoCollectionName),
 	}
 }
 
 //Save contract
-func (m *Manager) Save(contract *Contract) (err error) {
+func (m *mongoManager) Save(contract *Contract) (err error) {
 	if contract.ContractId == "" {
 		err = errors.New("Contractid can not be empty")
 		return
@@ -57,32 +66,42 @@ func (m *Manager) Save(contract *Contract) (err error) {
 }
 
 //Exists checks if a contract with this contractId already exists.
-func (m *Manager) Exists(contractID string) (bool, error) {
+func (m *mongoManager) Exists(contractID string) (bool, error) {
 	count, err := m.collection.Find(bson.M{"contractid": contractID}).Count()
 	return count >= 1, err
 }
 
 //AddSignature adds a signature to a contract
-func (m *Manager) AddSignature(contractID string, signature Signature) (err error) {
+func (m *mongoManager) AddSignature(contractID string, signature Signature) (err error) {
 	err = m.collection.Update(bson.M{"contractid": contractID}, bson.M{"$push": bson.M{"signatures": signature}})
 	return
 }
 
 //Get contract
-func (m *Manager) Get(contractid string) (contract *Contract, err error) {
+func (m *mongoManager) Get(contractid string) (contract *Contract, err error) {
 	contract = &Contract{}
 	err = m.collection.Find(bson.M{"contractid": contractid}).One(contract)
 	return
 }
 
 //Delete  contract
-func (m *Manager) Delete(contractid string) (err error) {
+func (m *mongoManager) Delete(contractid string) (err error) {
 	_, err = m.collection.RemoveAll(bson.M{"contractid": contractid})
 	return
 }
 
+// RemoveExpired removes the contracts that expired before a moment
+func (m *mongoManager) RemoveExpired(before time.Time) (int, error) {
+	// Contracts without expiration have the zero time
+	info, err := m.collection.RemoveAll(bson.M{"expires": bson.M{"$lt": before, "$gt": time.Time{}}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Removed, nil
+}
+
 //IsParticipant check if name is participant in contract with id contractID
-func (m *Manager) IsParticipant(contractID string, name string) (isparticipant bool, err error) {
+func (m *mongoManager) IsParticipant(contractID string, name string) (isparticipant bool, err error) {
 	count, err := m.collection.Find(bson.M{"contractid": contractID, "parties.name": name}).Count()
 	if err != nil {
 		return
@@ -93,7 +112,7 @@ func (m *Manager) IsParticipant(contractID string, name string) (isparticipant b
 }
 
 //GetByIncludedParty Get contracts that include the included party
-func (m *Manager) GetByIncludedParty(party *Party, start int, max int, includeExpired bool) (contracts []Contract, err error) {
+func (m *mongoManager) GetByIncludedParty(party *Party, start int, max int, includeExpired bool) (contracts []Contract, err error) {
 	contracts = make([]Contract, 0)
 	query := bson.M{"parties.type": party.Type, "parties.name": party.Name}
 	if !includeExpired {
@@ -0,0 +1,178 @@
+package contract
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	contracts []Contract
+}
+
+//memoryManager keeps the contracts in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoCollectionName, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+// find returns copies of the contracts that match, the caller holds the lock
+func (m *memoryManager) find(match func(contract *Contract) bool) (contracts []Contract, err error) {
+	contracts = make([]Contract, 0)
+	for _, contract := range m.store.contracts {
+		if !match(&contract) {
+			continue
+		}
+		var copied Contract
+		if err = db.CopyDocument(&copied, &contract); err != nil {
+			return
+		}
+		contracts = append(contracts, copied)
+	}
+	return
+}
+
+// index returns the position of a contract in the store or -1, the caller holds the lock
+func (m *memoryManager) index(contractID string) int {
+	for i, contract := range m.store.contracts {
+		if contract.ContractId == contractID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memoryManager) Save(contract *Contract) error {
+	if contract.ContractId == "" {
+		return errors.New("Contractid can not be empty")
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	i := m.index(contract.ContractId)
+	if contract.ID == "" {
+		if i != -1 {
+			return db.ErrDuplicate
+		}
+		contract.ID = bson.NewObjectId()
+	}
+	var stored Contract
+	if err := db.CopyDocument(&stored, contract); err != nil {
+		return err
+	}
+	if i == -1 {
+		m.store.contracts = append(m.store.contracts, stored)
+	} else {
+		m.store.contracts[i] = stored
+	}
+	return nil
+}
+
+func (m *memoryManager) Exists(contractID string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	return m.index(contractID) != -1, nil
+}
+
+func (m *memoryManager) AddSignature(contractID string, signature Signature) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	i := m.index(contractID)
+	if i == -1 {
+		return mgo.ErrNotFound
+	}
+	contract := &m.store.contracts[i]
+	contract.Signatures = append(append([]Signature{}, contract.Signatures...), signature)
+	return nil
+}
+
+func (m *memoryManager) Get(contractid string) (*Contract, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	contracts, err := m.find(func(contract *Contract) bool { return contract.ContractId == contractid })
+	if err != nil {
+		return &Contract{}, err
+	}
+	if len(contracts) == 0 {
+		return &Contract{}, mgo.ErrNotFound
+	}
+	return &contracts[0], nil
+}
+
+func (m *memoryManager) Delete(contractid string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if i := m.index(contractid); i != -1 {
+		m.store.contracts = append(m.store.contracts[:i:i], m.store.contracts[i+1:]...)
+	}
+	return nil
+}
+
+func (m *memoryManager) RemoveExpired(before time.Time) (int, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	remaining := []Contract{}
+	for _, contract := range m.store.contracts {
+		expires := time.Time(contract.Expires)
+		if expires.IsZero() || !expires.Before(before) {
+			remaining = append(remaining, contract)
+		}
+	}
+	removed := len(m.store.contracts) - len(remaining)
+	m.store.contracts = remaining
+	return removed, nil
+}
+
+// isParty checks if a party with a name and, if it is not empty, a type signs a contract
+func isParty(contract *Contract, partyType string, name string) bool {
+	for _, party := range contract.Parties {
+		if party.Name == name && (partyType == "" || party.Type == partyType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryManager) IsParticipant(contractID string, name string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	contracts, err := m.find(func(contract *Contract) bool {
+		return contract.ContractId == contractID && isParty(contract, "", name)
+	})
+	return len(contracts) != 0, err
+}
+
+func (m *memoryManager) GetByIncludedParty(party *Party, start int, max int, includeExpired bool) ([]Contract, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	now := time.Now()
+	contracts, err := m.find(func(contract *Contract) bool {
+		if !includeExpired && time.Time(contract.Expires).Before(now) {
+			return false
+		}
+		// Like mongo, the type and name can match different parties
+		return isParty(contract, party.Type, "") && isParty(contract, "", party.Name)
+	})
+	if err != nil {
+		return contracts, err
+	}
+	if start > len(contracts) {
+		start = len(contracts)
+	}
+	contracts = contracts[start:]
+	if max > 0 && max < len(contracts) {
+		contracts = contracts[:max]
+	}
+	return contracts, nil
+}
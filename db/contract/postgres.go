@@ -0,0 +1,115 @@
+package contract
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/lib/pq"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var postgresContracts = &db.PostgresCollection{
+	Table: "contracts",
+	Columns: func(document interface{}) map[string]interface{} {
+		contract := document.(*Contract)
+		partyTypes := []string{}
+		partyNames := []string{}
+		for _, party := range contract.Parties {
+			partyTypes = append(partyTypes, party.Type)
+			partyNames = append(partyNames, party.Name)
+		}
+		return map[string]interface{}{
+			"contractid": contract.ContractId,
+			"partytypes": pq.StringArray(partyTypes),
+			"partynames": pq.StringArray(partyNames),
+			"expires":    time.Time(contract.Expires),
+		}
+	},
+}
+
+//postgresManager stores the contracts in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func newContract() interface{} {
+	return &Contract{}
+}
+
+func (m *postgresManager) Save(contract *Contract) error {
+	if contract.ContractId == "" {
+		return errors.New("Contractid can not be empty")
+	}
+	if contract.ID == "" {
+		contract.ID = bson.NewObjectId()
+		return postgresContracts.Insert(m.db, contract)
+	}
+	return postgresContracts.Upsert(m.db, "contractid = $1", []interface{}{contract.ContractId}, newContract,
+		func(document interface{}) error { return db.CopyDocument(document, contract) })
+}
+
+func (m *postgresManager) Exists(contractID string) (bool, error) {
+	count, err := postgresContracts.Count(m.db, "contractid = $1", contractID)
+	return count >= 1, err
+}
+
+func (m *postgresManager) AddSignature(contractID string, signature Signature) error {
+	updated, err := postgresContracts.Update(m.db, "contractid = $1", []interface{}{contractID}, newContract,
+		func(document interface{}) error {
+			contract := document.(*Contract)
+			contract.Signatures = append(contract.Signatures, signature)
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) Get(contractid string) (*Contract, error) {
+	contract := &Contract{}
+	err := postgresContracts.FindOne(m.db, contract, "contractid = $1", contractid)
+	return contract, err
+}
+
+func (m *postgresManager) Delete(contractid string) error {
+	_, err := postgresContracts.Remove(m.db, "contractid = $1", contractid)
+	return err
+}
+
+func (m *postgresManager) RemoveExpired(before time.Time) (int, error) {
+	return postgresContracts.Remove(m.db, "expires < $1 AND expires > $2", before, time.Time{})
+}
+
+func (m *postgresManager) IsParticipant(contractID string, name string) (bool, error) {
+	count, err := postgresContracts.Count(m.db, "contractid = $1 AND partynames @> ARRAY[$2::text]", contractID, name)
+	return err == nil && count != 0, err
+}
+
+func (m *postgresManager) GetByIncludedParty(party *Party, start int, max int, includeExpired bool) ([]Contract, error) {
+	contracts := make([]Contract, 0)
+	// Like mongo, the type and name can match different parties
+	where := "partytypes @> ARRAY[$1::text] AND partynames @> ARRAY[$2::text]"
+	args := []interface{}{party.Type, party.Name}
+	if !includeExpired {
+		where += " AND expires >= $3"
+		args = append(args, time.Now())
+	}
+	where += " ORDER BY seq"
+	if max > 0 {
+		where += fmt.Sprintf(" LIMIT %d", max)
+	}
+	if start > 0 {
+		where += fmt.Sprintf(" OFFSET %d", start)
+	}
+	err := postgresContracts.Find(m.db, &contracts, where, args...)
+	return contracts, err
+}
@@ -0,0 +1,107 @@
+package dataexport
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	mongoDataExportCollectionName = "dataexports"
+)
+
+// Manager is used to store data exports
+type Manager interface {
+	Create(export *DataExport) error
+	ListByUser(username string) (exports []DataExport, err error)
+	Get(username string, id string) (export *DataExport, err error)
+	SetReady(id bson.ObjectId, archive []byte) error
+	SetFailed(id bson.ObjectId) error
+	// ClaimPending returns at most limit pending exports that are not claimed by another instance and claims them
+	// until the given moment, their number of attempts is incremented
+	ClaimPending(until time.Time, limit int) ([]DataExport, error)
+	RemoveByUser(username string) error
+}
+
+// mongoManager stores the data exports in mongo
+type mongoManager struct {
+	session    *mgo.Session
+	collection *mgo.Collection
+}
+
+// NewManager creates and initializes a new Manager
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
+	session := db.GetDBSession(r)
+	return &mongoManager{
+		session:    session,
+		collection: db.GetCollection(session, mongoDataExportCollectionName),
+	}
+}
+
+// Create stores a new data export
+func (m *mongoManager) Create(export *DataExport) error {
+	return m.collection.Insert(export)
+}
+
+// ListByUser lists the data exports of a user without the archives, the newest first
+func (m *mongoManager) ListByUser(username string) (exports []DataExport, err error) {
+	err = m.collection.Find(bson.M{"username": username}).Select(bson.M{"archive": 0}).Sort("-createdat").All(&exports)
+	if exports == nil {
+		exports = []DataExport{}
+	}
+	return
+}
+
+// Get gets a data export of a user including the archive
+func (m *mongoManager) Get(username string, id string) (export *DataExport, err error) {
+	if !bson.IsObjectIdHex(id) {
+		err = mgo.ErrNotFound
+		return
+	}
+	export = &DataExport{}
+	err = m.collection.Find(bson.M{"_id": bson.ObjectIdHex(id), "username": username}).One(export)
+	return
+}
+
+// SetReady stores the archive of a data export
+func (m *mongoManager) SetReady(id bson.ObjectId, archive []byte) error {
+	return m.collection.UpdateId(id, bson.M{"$set": bson.M{"status": StatusReady, "archive": archive, "size": len(archive)}})
+}
+
+// SetFailed marks a data export as failed
+func (m *mongoManager) SetFailed(id bson.ObjectId) error {
+	return m.collection.UpdateId(id, bson.M{"$set": bson.M{"status": StatusFailed}})
+}
+
+// ClaimPending claims pending exports one by one, so an export is only claimed by one instance
+func (m *mongoManager) ClaimPending(until time.Time, limit int) ([]DataExport, error) {
+	claimed := []DataExport{}
+	for len(claimed) < limit {
+		export := DataExport{}
+		_, err := m.collection.Find(bson.M{"status": StatusPending, "claimeduntil": bson.M{"$lte": time.Now()}}).
+			Apply(mgo.Change{Update: bson.M{"$set": bson.M{"claimeduntil": until}, "$inc": bson.M{"attempts": 1}}, ReturnNew: true}, &export)
+		if err == mgo.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, export)
+	}
+	return claimed, nil
+}
+
+// RemoveByUser removes the data exports of a user
+func (m *mongoManager) RemoveByUser(username string) error {
+	_, err := m.collection.RemoveAll(bson.M{"username": username})
+	return err
+}
@@ -0,0 +1,133 @@
+package dataexport
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	exports map[bson.ObjectId]DataExport
+}
+
+// memoryManager keeps the data exports in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoDataExportCollectionName, func() interface{} {
+		return &memoryStore{exports: make(map[bson.ObjectId]DataExport)}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+// get returns a data export that did not expire, the caller holds the lock
+func (m *memoryManager) get(id bson.ObjectId) (DataExport, bool) {
+	export, ok := m.store.exports[id]
+	if !ok || time.Now().After(export.ExpiresAt) {
+		return DataExport{}, false
+	}
+	return export, true
+}
+
+func (m *memoryManager) Create(export *DataExport) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if export.ID == "" {
+		export.ID = bson.NewObjectId()
+	}
+	if _, exists := m.store.exports[export.ID]; exists {
+		return db.ErrDuplicate
+	}
+	stored := *export
+	stored.Archive = append([]byte(nil), export.Archive...)
+	m.store.exports[export.ID] = stored
+	return nil
+}
+
+func (m *memoryManager) ListByUser(username string) ([]DataExport, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	exports := []DataExport{}
+	for id := range m.store.exports {
+		if export, ok := m.get(id); ok && export.Username == username {
+			export.Archive = nil
+			exports = append(exports, export)
+		}
+	}
+	sort.Slice(exports, func(i, j int) bool { return exports[i].CreatedAt.After(exports[j].CreatedAt) })
+	return exports, nil
+}
+
+func (m *memoryManager) Get(username string, id string) (*DataExport, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, mgo.ErrNotFound
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	export, ok := m.get(bson.ObjectIdHex(id))
+	if !ok || export.Username != username {
+		return &DataExport{}, mgo.ErrNotFound
+	}
+	export.Archive = append([]byte(nil), export.Archive...)
+	return &export, nil
+}
+
+// update applies a change to a data export, mgo.ErrNotFound is returned if it does not exist
+func (m *memoryManager) update(id bson.ObjectId, change func(export *DataExport)) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	export, ok := m.get(id)
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	change(&export)
+	m.store.exports[id] = export
+	return nil
+}
+
+func (m *memoryManager) SetReady(id bson.ObjectId, archive []byte) error {
+	return m.update(id, func(export *DataExport) {
+		export.Status = StatusReady
+		export.Archive = append([]byte(nil), archive...)
+		export.Size = len(archive)
+	})
+}
+
+func (m *memoryManager) SetFailed(id bson.ObjectId) error {
+	return m.update(id, func(export *DataExport) { export.Status = StatusFailed })
+}
+
+func (m *memoryManager) ClaimPending(until time.Time, limit int) ([]DataExport, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	claimed := []DataExport{}
+	for id := range m.store.exports {
+		export, ok := m.get(id)
+		if !ok || export.Status != StatusPending || export.ClaimedUntil.After(time.Now()) || len(claimed) == limit {
+			continue
+		}
+		export.ClaimedUntil = until
+		export.Attempts++
+		m.store.exports[id] = export
+		claimed = append(claimed, export)
+	}
+	return claimed, nil
+}
+
+func (m *memoryManager) RemoveByUser(username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for id, export := range m.store.exports {
+		if export.Username == username {
+			delete(m.store.exports, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package dataexport
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Status of a data export
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// DataExport is an archive with all information stored about a user
+type DataExport struct {
+	ID        bson.ObjectId `json:"id" bson:"_id,omitempty"`
+	Username  string        `json:"-"`
+	Status    string        `json:"status"`
+	CreatedAt time.Time     `json:"createdat"`
+	// ExpiresAt is the moment the archive is removed
+	ExpiresAt time.Time `json:"expiresat"`
+	Size      int       `json:"size"`
+	Archive   []byte    `json:"-"`
+	// Host and Lang are the host the export was requested on and the language of the email sent when it is ready
+	Host string `json:"-"`
+	Lang string `json:"-"`
+	// ClaimedUntil is the moment another instance can retry the export if it is still pending
+	ClaimedUntil time.Time `json:"-"`
+	// Attempts is the number of times the export was claimed
+	Attempts int `json:"-"`
+}
+
+// New creates a new pending DataExport
+func New(username string, validity time.Duration, host string, lang string) *DataExport {
+	now := time.Now()
+	return &DataExport{
+		ID:        bson.NewObjectId(),
+		Username:  username,
+		Status:    StatusPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(validity),
+		Host:      host,
+		Lang:      lang,
+	}
+}
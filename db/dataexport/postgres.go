@@ -0,0 +1,107 @@
+package dataexport
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var postgresExports = &db.PostgresCollection{
+	Table: "dataexports",
+	Columns: func(document interface{}) map[string]interface{} {
+		export := document.(*DataExport)
+		return map[string]interface{}{
+			"username":      export.Username,
+			"status":        export.Status,
+			"claimed_until": export.ClaimedUntil,
+			"expires_at":    export.ExpiresAt,
+		}
+	},
+}
+
+// postgresManager stores the data exports in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) Create(export *DataExport) error {
+	return postgresExports.Insert(m.db, export)
+}
+
+func (m *postgresManager) ListByUser(username string) ([]DataExport, error) {
+	exports := []DataExport{}
+	if err := postgresExports.Find(m.db, &exports, "username = $1 ORDER BY seq DESC", username); err != nil {
+		return exports, err
+	}
+	for i := range exports {
+		exports[i].Archive = nil
+	}
+	return exports, nil
+}
+
+func (m *postgresManager) Get(username string, id string) (*DataExport, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, mgo.ErrNotFound
+	}
+	export := &DataExport{}
+	err := postgresExports.FindOne(m.db, export, "id = $1 AND username = $2", bson.ObjectIdHex(id).Hex(), username)
+	return export, err
+}
+
+// update applies a change to a data export, mgo.ErrNotFound is returned if it does not exist
+func (m *postgresManager) update(id bson.ObjectId, change func(export *DataExport)) error {
+	updated, err := postgresExports.Update(m.db, "id = $1", []interface{}{id.Hex()},
+		func() interface{} { return &DataExport{} },
+		func(document interface{}) error {
+			change(document.(*DataExport))
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) SetReady(id bson.ObjectId, archive []byte) error {
+	return m.update(id, func(export *DataExport) {
+		export.Status = StatusReady
+		export.Archive = archive
+		export.Size = len(archive)
+	})
+}
+
+func (m *postgresManager) SetFailed(id bson.ObjectId) error {
+	return m.update(id, func(export *DataExport) { export.Status = StatusFailed })
+}
+
+func (m *postgresManager) ClaimPending(until time.Time, limit int) ([]DataExport, error) {
+	claimed := []DataExport{}
+	// The rows are locked while they are claimed, an instance claiming at the same time skips them
+	// because they no longer match once it can lock them
+	_, err := postgresExports.Update(m.db, "status = $1 AND claimed_until <= $2 ORDER BY seq LIMIT $3",
+		[]interface{}{StatusPending, time.Now(), limit},
+		func() interface{} { return &DataExport{} },
+		func(document interface{}) error {
+			export := document.(*DataExport)
+			export.ClaimedUntil = until
+			export.Attempts++
+			claimed = append(claimed, *export)
+			return nil
+		})
+	if err != nil {
+		return []DataExport{}, err
+	}
+	return claimed, nil
+}
+
+func (m *postgresManager) RemoveByUser(username string) error {
+	_, err := postgresExports.Remove(m.db, "username = $1", username)
+	return err
+}
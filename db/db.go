@@ -5,6 +5,7 @@ import "errors"
 const (
 	DB_NAME    = "itsyouonline-idserver-db"
 	DB_SESSION = "itsyouonline/identityserver/dbconnection"
+	DB_BACKEND = "itsyouonline/identityserver/dbbackend"
 )
 
 var (
@@ -0,0 +1,78 @@
+// Package emailoutbox stores the emails until they are handed to the smtp server
+package emailoutbox
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const mongoOutboxCollectionName = "emailoutbox"
+
+// Manager is used to store the emails in the outbox
+type Manager interface {
+	Save(email *Email) error
+	// Update stores the result of an attempt
+	Update(email *Email) error
+	Get(id string) (*Email, error)
+	// Claim returns at most limit pending emails of which the next attempt is due and postpones
+	// their next attempt to until, so other instances do not send them at the same time
+	Claim(until time.Time, limit int) ([]Email, error)
+}
+
+// mongoManager stores the emails in mongo, a TTL index removes the expired emails
+type mongoManager struct {
+	collection *mgo.Collection
+}
+
+// NewManager creates and initializes a new Manager
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
+	return &mongoManager{collection: db.GetCollection(db.GetDBSession(r), mongoOutboxCollectionName)}
+}
+
+func (m *mongoManager) Save(email *Email) error {
+	if email.ID == "" {
+		email.ID = bson.NewObjectId()
+	}
+	return m.collection.Insert(email)
+}
+
+func (m *mongoManager) Update(email *Email) error {
+	return m.collection.UpdateId(email.ID, email)
+}
+
+func (m *mongoManager) Get(id string) (*Email, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, mgo.ErrNotFound
+	}
+	email := &Email{}
+	err := m.collection.FindId(bson.ObjectIdHex(id)).One(email)
+	return email, err
+}
+
+func (m *mongoManager) Claim(until time.Time, limit int) ([]Email, error) {
+	claimed := []Email{}
+	for len(claimed) < limit {
+		email := Email{}
+		_, err := m.collection.Find(bson.M{"status": StatusPending, "nextattempt": bson.M{"$lte": time.Now()}}).
+			Sort("nextattempt").
+			Apply(mgo.Change{Update: bson.M{"$set": bson.M{"nextattempt": until}}, ReturnNew: true}, &email)
+		if err == mgo.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, email)
+	}
+	return claimed, nil
+}
@@ -0,0 +1,85 @@
+package emailoutbox
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	emails map[bson.ObjectId]Email
+}
+
+// memoryManager keeps the emails in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoOutboxCollectionName, func() interface{} {
+		return &memoryStore{emails: make(map[bson.ObjectId]Email)}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) Save(email *Email) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if email.ID == "" {
+		email.ID = bson.NewObjectId()
+	}
+	if _, exists := m.store.emails[email.ID]; exists {
+		return db.ErrDuplicate
+	}
+	m.store.emails[email.ID] = *email
+	return nil
+}
+
+func (m *memoryManager) Update(email *Email) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.emails[email.ID]; !exists {
+		return mgo.ErrNotFound
+	}
+	m.store.emails[email.ID] = *email
+	return nil
+}
+
+func (m *memoryManager) Get(id string) (*Email, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if !bson.IsObjectIdHex(id) {
+		return nil, mgo.ErrNotFound
+	}
+	email, ok := m.store.emails[bson.ObjectIdHex(id)]
+	if !ok || !time.Now().Before(email.ExpiresAt) {
+		return nil, mgo.ErrNotFound
+	}
+	return &email, nil
+}
+
+func (m *memoryManager) Claim(until time.Time, limit int) ([]Email, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	now := time.Now()
+	claimed := []Email{}
+	for _, email := range m.store.emails {
+		if email.Status == StatusPending && !email.NextAttempt.After(now) && now.Before(email.ExpiresAt) {
+			claimed = append(claimed, email)
+		}
+	}
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].NextAttempt.Before(claimed[j].NextAttempt) })
+	if len(claimed) > limit {
+		claimed = claimed[:limit]
+	}
+	for i := range claimed {
+		claimed[i].NextAttempt = until
+		m.store.emails[claimed[i].ID] = claimed[i]
+	}
+	return claimed, nil
+}
@@ -0,0 +1,34 @@
+package emailoutbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryClaim(t *testing.T) {
+	m := newMemoryManager(db.NewMemoryBackend())
+	now := time.Now()
+	due := &Email{Status: StatusPending, NextAttempt: now, ExpiresAt: now.Add(time.Hour)}
+	later := &Email{Status: StatusPending, NextAttempt: now.Add(time.Hour), ExpiresAt: now.Add(time.Hour)}
+	sent := &Email{Status: StatusSent, NextAttempt: now, ExpiresAt: now.Add(time.Hour)}
+	for _, email := range []*Email{due, later, sent} {
+		assert.NoError(t, m.Save(email))
+	}
+
+	claimed, err := m.Claim(now.Add(time.Minute), 10)
+	assert.NoError(t, err)
+	if assert.Len(t, claimed, 1) {
+		assert.Equal(t, due.ID, claimed[0].ID)
+	}
+	claimed, err = m.Claim(now.Add(time.Minute), 10)
+	assert.NoError(t, err)
+	assert.Empty(t, claimed, "a claimed email is not claimed again until the claim expires")
+
+	stored, err := m.Get(due.ID.Hex())
+	if assert.NoError(t, err) {
+		assert.Equal(t, now.Add(time.Minute).Unix(), stored.NextAttempt.Unix())
+	}
+}
@@ -0,0 +1,35 @@
+package emailoutbox
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Status of an email
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+)
+
+// Email is a message in the outbox, it is sent until the smtp server accepts it or the attempts run out
+type Email struct {
+	ID         bson.ObjectId `json:"id" bson:"_id,omitempty"`
+	Recipients []string      `json:"recipients"`
+	Subject    string        `json:"subject"`
+	// Text and HTML are the alternative bodies of the email, they are cleared once the email is sent or failed
+	// because they can contain secrets like the link to reset a password
+	Text     string `json:"text"`
+	HTML     string `json:"html"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// NextAttempt is the moment the email is sent again if it is pending
+	NextAttempt time.Time `json:"nextattempt"`
+	// LastError describes why the last attempt failed
+	LastError string    `json:"lasterror,omitempty"`
+	CreatedAt time.Time `json:"createdat"`
+	SentAt    time.Time `json:"sentat"`
+	// ExpiresAt is the moment the email is removed from the outbox, whatever its status
+	ExpiresAt time.Time `json:"-"`
+}
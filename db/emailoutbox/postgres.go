@@ -0,0 +1,79 @@
+package emailoutbox
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var postgresOutbox = &db.PostgresCollection{
+	Table: "emailoutbox",
+	Columns: func(document interface{}) map[string]interface{} {
+		email := document.(*Email)
+		return map[string]interface{}{
+			"status":       email.Status,
+			"next_attempt": email.NextAttempt,
+			"expires_at":   email.ExpiresAt,
+		}
+	},
+}
+
+// postgresManager stores the emails in a postgres database, the expired emails are removed by the backend
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) Save(email *Email) error {
+	if email.ID == "" {
+		email.ID = bson.NewObjectId()
+	}
+	return postgresOutbox.Insert(m.db, email)
+}
+
+func (m *postgresManager) Update(email *Email) error {
+	updated, err := postgresOutbox.Update(m.db, "id = $1", []interface{}{email.ID.Hex()},
+		func() interface{} { return &Email{} },
+		func(document interface{}) error {
+			*document.(*Email) = *email
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) Get(id string) (*Email, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, mgo.ErrNotFound
+	}
+	email := &Email{}
+	err := postgresOutbox.FindOne(m.db, email, "id = $1", bson.ObjectIdHex(id).Hex())
+	return email, err
+}
+
+func (m *postgresManager) Claim(until time.Time, limit int) ([]Email, error) {
+	claimed := []Email{}
+	// The rows are locked while they are postponed, an instance claiming at the same time skips them
+	// because they no longer match once it can lock them
+	_, err := postgresOutbox.Update(m.db, "status = $1 AND next_attempt <= $2 ORDER BY next_attempt LIMIT $3",
+		[]interface{}{StatusPending, time.Now(), limit},
+		func() interface{} { return &Email{} },
+		func(document interface{}) error {
+			email := document.(*Email)
+			email.NextAttempt = until
+			claimed = append(claimed, *email)
+			return nil
+		})
+	if err != nil {
+		return []Email{}, err
+	}
+	return claimed, nil
+}
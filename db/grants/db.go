@@ -19,30 +19,21 @@ var (
 	ErrGrantLimitReached = errors.New("Max amount of grants reached for this user by this organization")
 )
 
-// InitModels initialize models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:    []string{"username", "globalid"},
-		Unique: true,
-	}
-
-	db.EnsureIndex(grantCollectionName, index)
-
-	index = mgo.Index{
-		Key: []string{"grants"},
-	}
-
-	db.EnsureIndex(grantCollectionName, index)
-
-	index = mgo.Index{
-		Key: []string{"grants", "globalid"},
-	}
-
-	db.EnsureIndex(grantCollectionName, index)
+// Manager is used to store grants
+type Manager interface {
+	GetGrantsForUser(username string, globalID string) (*SavedGrants, error)
+	GetByUser(username string) ([]SavedGrants, error)
+	GetByGrant(grant Grant, globalID string) ([]SavedGrants, error)
+	UpserGrant(username, globalID string, grant Grant) error
+	UpdateGrant(username, globalID string, oldgrant, newgrant Grant) error
+	DeleteUserGrant(username, globalID string, grant Grant) error
+	DeleteUserGrants(username, globalID string) error
+	DeleteOrgGrants(globalID string) error
+	DeleteAllUserGrants(username string) error
 }
 
-// Manager is used to store grants
-type Manager struct {
+// mongoManager stores the grants in mongo
+type mongoManager struct {
 	session    *mgo.Session
 	collection *mgo.Collection
 }
@@ -52,16 +43,22 @@ func getCollection(session *mgo.Session) *mgo.Collection {
 }
 
 // NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session:    session,
 		collection: getCollection(session),
 	}
 }
 
 // GetGrantsForUser gets all the saved grants for a user and globalID
-func (m *Manager) GetGrantsForUser(username string, globalID string) (*SavedGrants, error) {
+func (m *mongoManager) GetGrantsForUser(username string, globalID string) (*SavedGrants, error) {
 	var sg SavedGrants
 
 	err := m.collection.Find(bson.M{"username": username, "globalid": globalID}).One(&sg)
@@ -69,8 +66,15 @@ func (m *Manager) GetGrantsForUser(username string, globalID string) (*SavedGran
 	return &sg, err
 }
 
+// GetByUser gets the grants given to a user by all organizations
+func (m *mongoManager) GetByUser(username string) ([]SavedGrants, error) {
+	var savedGrants []SavedGrants
+	err := m.collection.Find(bson.M{"username": username}).All(&savedGrants)
+	return savedGrants, err
+}
+
 // GetByGrant returns all SavedGrants where the given grant is in the list of grants
-func (m *Manager) GetByGrant(grant Grant, globalID string) ([]SavedGrants, error) {
+func (m *mongoManager) GetByGrant(grant Grant, globalID string) ([]SavedGrants, error) {
 	var usersWithGrant []SavedGrants
 
 	if err := m.collection.Find(bson.M{"grants": grant, "globalid": globalID}).All(&usersWithGrant); err != nil {
@@ -81,8 +85,18 @@ func (m *Manager) GetByGrant(grant Grant, globalID string) ([]SavedGrants, error
 }
 
 // UpserGrant adds a new grent for a user by an organization
-func (m *Manager) UpserGrant(username, globalID string, grant Grant) error {
+func (m *mongoManager) UpserGrant(username, globalID string, grant Grant) error {
 	// Count the amount of grants we already have first
+	if err := checkGrantLimit(m, username, globalID); err != nil {
+		return err
+	}
+
+	_, err := m.collection.Upsert(bson.M{"username": username, "globalid": globalID}, bson.M{"$addToSet": bson.M{"grants": grant}})
+	return err
+}
+
+// checkGrantLimit returns ErrGrantLimitReached if an organization can not add another grant for a user
+func checkGrantLimit(m Manager, username, globalID string) error {
 	sg, err := m.GetGrantsForUser(username, globalID)
 	if err != nil && !db.IsNotFound(err) {
 		return err
@@ -93,13 +107,11 @@ func (m *Manager) UpserGrant(username, globalID string, grant Grant) error {
 	if len(sg.Grants) >= maxGrants {
 		return ErrGrantLimitReached
 	}
-
-	_, err = m.collection.Upsert(bson.M{"username": username, "globalid": globalID}, bson.M{"$addToSet": bson.M{"grants": grant}})
-	return err
+	return nil
 }
 
 // UpdateGrant updates an old grant to a new one
-func (m *Manager) UpdateGrant(username, globalID string, oldgrant, newgrant Grant) error {
+func (m *mongoManager) UpdateGrant(username, globalID string, oldgrant, newgrant Grant) error {
 	// First remove the old grant
 	err := m.collection.Update(bson.M{"username": username, "globalid": globalID}, bson.M{"$pull": bson.M{"grants": oldgrant}})
 	if err != nil {
@@ -110,17 +122,23 @@ func (m *Manager) UpdateGrant(username, globalID string, oldgrant, newgrant Gran
 }
 
 // DeleteUserGrant removes a single grant from a user for an organization
-func (m *Manager) DeleteUserGrant(username, globalID string, grant Grant) error {
+func (m *mongoManager) DeleteUserGrant(username, globalID string, grant Grant) error {
 	return m.collection.Update(bson.M{"username": username, "globalid": globalID}, bson.M{"$pull": bson.M{"grants": grant}})
 }
 
 // DeleteUserGrants removes all grants given to a user by an organization
-func (m *Manager) DeleteUserGrants(username, globalID string) error {
+func (m *mongoManager) DeleteUserGrants(username, globalID string) error {
 	return m.collection.Remove(bson.M{"username": username, "globalid": globalID})
 }
 
 // DeleteOrgGrants remooves all grants given by an organization
-func (m *Manager) DeleteOrgGrants(globalID string) error {
+func (m *mongoManager) DeleteOrgGrants(globalID string) error {
 	_, err := m.collection.RemoveAll(bson.M{"globalid": globalID})
 	return err
 }
+
+// DeleteAllUserGrants removes all grants given to a user by any organization
+func (m *mongoManager) DeleteAllUserGrants(username string) error {
+	_, err := m.collection.RemoveAll(bson.M{"username": username})
+	return err
+}
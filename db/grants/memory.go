@@ -0,0 +1,153 @@
+package grants
+
+import (
+	"sync"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	savedGrants []SavedGrants
+}
+
+// memoryManager keeps the grants in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(grantCollectionName, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+// find returns copies of the saved grants that match, the caller holds the lock
+func (m *memoryManager) find(match func(sg *SavedGrants) bool) (savedGrants []SavedGrants) {
+	for _, sg := range m.store.savedGrants {
+		if match(&sg) {
+			sg.Grants = append([]Grant(nil), sg.Grants...)
+			savedGrants = append(savedGrants, sg)
+		}
+	}
+	return
+}
+
+// update changes the grants given to a user by an organization, mgo.ErrNotFound is returned if there are none
+func (m *memoryManager) update(username, globalID string, change func(grants []Grant) []Grant) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for i, sg := range m.store.savedGrants {
+		if sg.Username == username && sg.GlobalID == globalID {
+			m.store.savedGrants[i].Grants = change(append([]Grant(nil), sg.Grants...))
+			return nil
+		}
+	}
+	return mgo.ErrNotFound
+}
+
+func containsGrant(grants []Grant, grant Grant) bool {
+	for _, g := range grants {
+		if g == grant {
+			return true
+		}
+	}
+	return false
+}
+
+func pullGrant(grants []Grant, grant Grant) []Grant {
+	result := []Grant{}
+	for _, g := range grants {
+		if g != grant {
+			result = append(result, g)
+		}
+	}
+	return result
+}
+
+func addGrant(grants []Grant, grant Grant) []Grant {
+	if containsGrant(grants, grant) {
+		return grants
+	}
+	return append(grants, grant)
+}
+
+func (m *memoryManager) GetGrantsForUser(username string, globalID string) (*SavedGrants, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	savedGrants := m.find(func(sg *SavedGrants) bool { return sg.Username == username && sg.GlobalID == globalID })
+	if len(savedGrants) == 0 {
+		return &SavedGrants{}, mgo.ErrNotFound
+	}
+	return &savedGrants[0], nil
+}
+
+func (m *memoryManager) GetByUser(username string) ([]SavedGrants, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	return m.find(func(sg *SavedGrants) bool { return sg.Username == username }), nil
+}
+
+func (m *memoryManager) GetByGrant(grant Grant, globalID string) ([]SavedGrants, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	return m.find(func(sg *SavedGrants) bool { return sg.GlobalID == globalID && containsGrant(sg.Grants, grant) }), nil
+}
+
+func (m *memoryManager) UpserGrant(username, globalID string, grant Grant) error {
+	if err := checkGrantLimit(m, username, globalID); err != nil {
+		return err
+	}
+	err := m.update(username, globalID, func(grants []Grant) []Grant { return addGrant(grants, grant) })
+	if err != mgo.ErrNotFound {
+		return err
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.savedGrants = append(m.store.savedGrants, SavedGrants{Username: username, GlobalID: globalID, Grants: []Grant{grant}})
+	return nil
+}
+
+func (m *memoryManager) UpdateGrant(username, globalID string, oldgrant, newgrant Grant) error {
+	return m.update(username, globalID, func(grants []Grant) []Grant {
+		return addGrant(pullGrant(grants, oldgrant), newgrant)
+	})
+}
+
+func (m *memoryManager) DeleteUserGrant(username, globalID string, grant Grant) error {
+	return m.update(username, globalID, func(grants []Grant) []Grant { return pullGrant(grants, grant) })
+}
+
+// remove removes the saved grants that match, mgo.ErrNotFound is returned if none matched
+func (m *memoryManager) remove(match func(sg *SavedGrants) bool) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	remaining := []SavedGrants{}
+	for _, sg := range m.store.savedGrants {
+		if !match(&sg) {
+			remaining = append(remaining, sg)
+		}
+	}
+	removed := len(m.store.savedGrants) - len(remaining)
+	m.store.savedGrants = remaining
+	if removed == 0 {
+		return mgo.ErrNotFound
+	}
+	return nil
+}
+
+func (m *memoryManager) DeleteUserGrants(username, globalID string) error {
+	return m.remove(func(sg *SavedGrants) bool { return sg.Username == username && sg.GlobalID == globalID })
+}
+
+func (m *memoryManager) DeleteOrgGrants(globalID string) error {
+	m.remove(func(sg *SavedGrants) bool { return sg.GlobalID == globalID })
+	return nil
+}
+
+func (m *memoryManager) DeleteAllUserGrants(username string) error {
+	m.remove(func(sg *SavedGrants) bool { return sg.Username == username })
+	return nil
+}
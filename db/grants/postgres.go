@@ -0,0 +1,112 @@
+package grants
+
+import (
+	"database/sql"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/lib/pq"
+	mgo "gopkg.in/mgo.v2"
+)
+
+var postgresGrants = &db.PostgresCollection{
+	Table: "grants",
+	Columns: func(document interface{}) map[string]interface{} {
+		sg := document.(*SavedGrants)
+		grants := make([]string, len(sg.Grants))
+		for i, grant := range sg.Grants {
+			grants[i] = string(grant)
+		}
+		return map[string]interface{}{
+			"username": sg.Username,
+			"globalid": sg.GlobalID,
+			"grants":   pq.StringArray(grants),
+		}
+	},
+}
+
+// postgresManager stores the grants in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func newSavedGrants() interface{} {
+	return &SavedGrants{}
+}
+
+// update changes the grants given to a user by an organization, mgo.ErrNotFound is returned if there are none
+func (m *postgresManager) update(username, globalID string, change func(grants []Grant) []Grant) error {
+	updated, err := postgresGrants.Update(m.db, "username = $1 AND globalid = $2", []interface{}{username, globalID}, newSavedGrants,
+		func(document interface{}) error {
+			sg := document.(*SavedGrants)
+			sg.Grants = change(sg.Grants)
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) GetGrantsForUser(username string, globalID string) (*SavedGrants, error) {
+	var sg SavedGrants
+	err := postgresGrants.FindOne(m.db, &sg, "username = $1 AND globalid = $2", username, globalID)
+	return &sg, err
+}
+
+func (m *postgresManager) GetByUser(username string) (savedGrants []SavedGrants, err error) {
+	err = postgresGrants.Find(m.db, &savedGrants, "username = $1", username)
+	return
+}
+
+func (m *postgresManager) GetByGrant(grant Grant, globalID string) ([]SavedGrants, error) {
+	var usersWithGrant []SavedGrants
+	if err := postgresGrants.Find(m.db, &usersWithGrant, "grants @> ARRAY[$1::text] AND globalid = $2", string(grant), globalID); err != nil {
+		return nil, err
+	}
+	return usersWithGrant, nil
+}
+
+func (m *postgresManager) UpserGrant(username, globalID string, grant Grant) error {
+	if err := checkGrantLimit(m, username, globalID); err != nil {
+		return err
+	}
+	return postgresGrants.Upsert(m.db, "username = $1 AND globalid = $2", []interface{}{username, globalID},
+		func() interface{} { return &SavedGrants{Username: username, GlobalID: globalID} },
+		func(document interface{}) error {
+			sg := document.(*SavedGrants)
+			sg.Grants = addGrant(sg.Grants, grant)
+			return nil
+		})
+}
+
+func (m *postgresManager) UpdateGrant(username, globalID string, oldgrant, newgrant Grant) error {
+	return m.update(username, globalID, func(grants []Grant) []Grant {
+		return addGrant(pullGrant(grants, oldgrant), newgrant)
+	})
+}
+
+func (m *postgresManager) DeleteUserGrant(username, globalID string, grant Grant) error {
+	return m.update(username, globalID, func(grants []Grant) []Grant { return pullGrant(grants, grant) })
+}
+
+func (m *postgresManager) DeleteUserGrants(username, globalID string) error {
+	removed, err := postgresGrants.Remove(m.db, "username = $1 AND globalid = $2", username, globalID)
+	if err == nil && removed == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) DeleteOrgGrants(globalID string) error {
+	_, err := postgresGrants.Remove(m.db, "globalid = $1", globalID)
+	return err
+}
+
+func (m *postgresManager) DeleteAllUserGrants(username string) error {
+	_, err := postgresGrants.Remove(m.db, "username = $1", username)
+	return err
+}
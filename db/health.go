@@ -0,0 +1,22 @@
+package db
+
+import (
+	"github.com/itsyouonline/identityserver/health"
+)
+
+func init() {
+	health.Register("database", true, Ping)
+}
+
+// Ping checks that the database answers
+func Ping() error {
+	switch {
+	case postgresDB != nil:
+		return postgresDB.Ping()
+	case dbSession != nil:
+		session := dbSession.Copy()
+		defer session.Close()
+		return session.Ping()
+	}
+	return errNotConnected
+}
@@ -27,25 +27,50 @@ func initializeDB(url string) error {
 	return nil
 }
 
+// connectRetryInterval is the time between two attempts to connect to the database
+const connectRetryInterval = 5 * time.Second
+
 // Connect ensures a mongo DB connection is initialized.
+// A postgres connection string makes postgres the default backend instead.
+// It retries until the database can be reached.
 func Connect(url string) {
-	if dbSession != nil {
+	connect(url, 0)
+}
+
+// ConnectAttempts is like Connect but gives up after attempts failed connections,
+// for the commands that should fail instead of hang when the database is down
+func ConnectAttempts(url string, attempts int) error {
+	return connect(url, attempts)
+}
+
+// connect retries until the connection is made, or until attempts connections failed if attempts is positive
+func connect(url string, attempts int) (err error) {
+	if dbSession != nil || postgresDB != nil {
 		return
 	}
+	if IsPostgresURL(url) {
+		return connectPostgres(url, attempts)
+	}
 
-	for {
-		err := initializeDB(url)
-		if err == nil {
+	for attempt := 1; ; attempt++ {
+		if err = initializeDB(url); err == nil {
 			break
 		}
+		if attempt == attempts {
+			return
+		}
 		log.Debugf("Failed to connect to DB (%s), retrying in 5 seconds...", url)
-		time.Sleep(5 * time.Second)
+		time.Sleep(connectRetryInterval)
 	}
 
 	log.Info("Initialized mongo connection")
+	return
 }
 
 func Close() {
+	if postgresDB != nil {
+		postgresDB.Close()
+	}
 	if dbSession == nil {
 		return
 	}
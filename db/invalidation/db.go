@@ -0,0 +1,89 @@
+// Package invalidation publishes the invalidations of the cached lookups to all instances of the identity server.
+// In mongo they are stored in a capped collection that the instances follow with a tailable cursor.
+package invalidation
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// CollectionName is the name of the capped collection, it is created by a migration
+	CollectionName = "cacheinvalidations"
+	// tailTimeout is how long a tailable cursor waits for new invalidations before checking if it has to stop
+	tailTimeout = 5 * time.Second
+	// pollInterval is how long to wait before looking for new invalidations when there were none
+	pollInterval = time.Second
+)
+
+// Manager publishes invalidations and follows the ones published by all instances
+type Manager interface {
+	// Publish stores an invalidation of the tags for all instances
+	Publish(tags []string) error
+	// Follow calls handle with the tags of every invalidation published after Follow started, until stop is closed
+	Follow(handle func(tags []string), stop <-chan struct{}) error
+}
+
+type invalidation struct {
+	ID          bson.ObjectId `bson:"_id"`
+	Tags        []string      `bson:"tags"`
+	PublishedAt time.Time     `bson:"publishedat"`
+}
+
+// mongoManager stores the invalidations in a capped collection, the oldest ones are removed when it is full
+type mongoManager struct {
+	collection *mgo.Collection
+}
+
+// NewManager creates a Manager for the backend of the request
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return memoryManager{}
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
+	return &mongoManager{collection: db.GetCollection(db.GetDBSession(r), CollectionName)}
+}
+
+// Publish inserts an invalidation in the capped collection
+func (m *mongoManager) Publish(tags []string) error {
+	return m.collection.Insert(&invalidation{ID: bson.NewObjectId(), Tags: tags, PublishedAt: time.Now()})
+}
+
+// Follow tails the capped collection. Invalidations can be handled twice when the cursor is recreated,
+// that does no harm since invalidating twice has the same result.
+func (m *mongoManager) Follow(handle func(tags []string), stop <-chan struct{}) error {
+	since := time.Now()
+	for {
+		iter := m.collection.Find(bson.M{"publishedat": bson.M{"$gte": since}}).Tail(tailTimeout)
+		var i invalidation
+		for {
+			for iter.Next(&i) {
+				handle(i.Tags)
+				since = i.PublishedAt
+			}
+			if !iter.Timeout() {
+				break
+			}
+			select {
+			case <-stop:
+				return iter.Close()
+			default:
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+		// The cursor is closed by mongo when the query had no results, it is recreated after a while
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package invalidation
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/cache"
+	"github.com/itsyouonline/identityserver/db"
+)
+
+// retryInterval is how long Follow waits after an error before it follows the invalidations again
+const retryInterval = 5 * time.Second
+
+// Invalidate removes the cached entries with one of the tags from this instance and publishes the invalidation
+// to the other instances. A failure to publish is only logged, the entries of the other instances expire with their ttl.
+func Invalidate(r *http.Request, tags ...string) {
+	cache.Invalidate(tags...)
+	if err := NewManager(r).Publish(tags); err != nil {
+		log.Error("Failed to publish the cache invalidation of ", tags, ": ", err)
+	}
+}
+
+// Follow applies the invalidations published by all instances to the caches of this instance until stop is closed
+func Follow(backend db.Backend, stop <-chan struct{}) {
+	for {
+		err := follow(backend, stop)
+		if err == nil {
+			return
+		}
+		log.Error("Failed to follow the cache invalidations: ", err)
+		// Invalidations published while not following are missed, start over with empty caches
+		cache.Purge()
+		select {
+		case <-stop:
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func follow(backend db.Backend, stop <-chan struct{}) error {
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if err != nil {
+		return err
+	}
+	defer release()
+	return NewManager(r).Follow(func(tags []string) { cache.Invalidate(tags...) }, stop)
+}
@@ -0,0 +1,13 @@
+package invalidation
+
+// memoryManager publishes nothing, a db.MemoryBackend is only used by a single instance
+type memoryManager struct{}
+
+func (memoryManager) Publish(tags []string) error {
+	return nil
+}
+
+func (memoryManager) Follow(handle func(tags []string), stop <-chan struct{}) error {
+	<-stop
+	return nil
+}
@@ -0,0 +1,58 @@
+package invalidation
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// retention is how long the invalidations are kept in postgres, the cached entries expire long before
+const retention = time.Hour
+
+// postgresManager stores the invalidations in the cacheinvalidations table, the instances poll it for new rows
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+// Publish inserts an invalidation, the expired rows are removed by the backend
+func (m *postgresManager) Publish(tags []string) error {
+	_, err := m.db.Exec("INSERT INTO cacheinvalidations (tags, expires_at) VALUES ($1, $2)",
+		pq.Array(tags), time.Now().Add(retention))
+	return err
+}
+
+// Follow polls for the rows with a higher id than the last one it handled
+func (m *postgresManager) Follow(handle func(tags []string), stop <-chan struct{}) error {
+	var last int64
+	if err := m.db.QueryRow("SELECT COALESCE(max(id), 0) FROM cacheinvalidations").Scan(&last); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(pollInterval):
+		}
+		rows, err := m.db.Query("SELECT id, tags FROM cacheinvalidations WHERE id > $1 ORDER BY id", last)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var tags []string
+			if err = rows.Scan(&last, pq.Array(&tags)); err != nil {
+				rows.Close()
+				return err
+			}
+			handle(tags)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+	}
+}
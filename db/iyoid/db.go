@@ -19,49 +19,42 @@ var (
 	ErrIDLimitReached = errors.New("Max amount of iyoids reached for this username and azp")
 )
 
-//InitModels initialize models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:    []string{"username", "azp"},
-		Unique: true,
-	}
-
-	db.EnsureIndex(mongoIdentifierCollectionName, index)
-
-	index = mgo.Index{
-		Key:    []string{"iyoids"},
-		Unique: true,
-	}
-
-	db.EnsureIndex(mongoIdentifierCollectionName, index)
-
-	index = mgo.Index{
-		Key:    []string{"iyoids", "azp"},
-		Unique: true,
-	}
-
-	db.EnsureIndex(mongoIdentifierCollectionName, index)
+// Manager is used to store the iyoids generated for users
+type Manager interface {
+	GetByIDAndAZP(iyoid, azp string) (*Identifier, error)
+	GetByUsernameAndAZP(username, azp string) (*Identifier, error)
+	GetByUsername(username string) ([]Identifier, error)
+	GetByID(iyoid string) (*Identifier, error)
+	UpsertIdentifier(username, azp, iyoid string) error
+	DeleteForClient(azp string) error
+	RemoveByUser(username string) error
 }
 
-// Manager represents the database session
-type Manager struct {
+// mongoManager represents the database session
+type mongoManager struct {
 	session *mgo.Session
 }
 
 //NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session: session,
 	}
 }
 
-func (m *Manager) getIdentifierCollection() *mgo.Collection {
+func (m *mongoManager) getIdentifierCollection() *mgo.Collection {
 	return db.GetCollection(m.session, mongoIdentifierCollectionName)
 }
 
 // GetByIDAndAZP gets an Identifier object by IyoID.
-func (m *Manager) GetByIDAndAZP(iyoid, azp string) (*Identifier, error) {
+func (m *mongoManager) GetByIDAndAZP(iyoid, azp string) (*Identifier, error) {
 	var idObj Identifier
 
 	if err := m.getIdentifierCollection().Find(bson.M{"iyoids": iyoid, "azp": azp}).One(&idObj); err != nil {
@@ -72,7 +65,7 @@ func (m *Manager) GetByIDAndAZP(iyoid, azp string) (*Identifier, error) {
 }
 
 // GetByUsernameAndAZP returns the Identifier object for this username and azp combo
-func (m *Manager) GetByUsernameAndAZP(username, azp string) (*Identifier, error) {
+func (m *mongoManager) GetByUsernameAndAZP(username, azp string) (*Identifier, error) {
 	var idObj Identifier
 
 	if err := m.getIdentifierCollection().Find(bson.M{"username": username, "azp": azp}).One(&idObj); err != nil {
@@ -82,8 +75,15 @@ func (m *Manager) GetByUsernameAndAZP(username, azp string) (*Identifier, error)
 	return &idObj, nil
 }
 
+// GetByUsername returns the identifiers generated for a user by all authorized parties
+func (m *mongoManager) GetByUsername(username string) ([]Identifier, error) {
+	var identifiers []Identifier
+	err := m.getIdentifierCollection().Find(bson.M{"username": username}).All(&identifiers)
+	return identifiers, err
+}
+
 // GetByID returns the full identifier object for this iyoid
-func (m *Manager) GetByID(iyoid string) (*Identifier, error) {
+func (m *mongoManager) GetByID(iyoid string) (*Identifier, error) {
 	var idObj Identifier
 
 	if err := m.getIdentifierCollection().Find(bson.M{"iyoids": iyoid}).One(&idObj); err != nil {
@@ -94,7 +94,7 @@ func (m *Manager) GetByID(iyoid string) (*Identifier, error) {
 }
 
 // UpsertIdentifier adds a new iyoid to a mapping or creates a new mapping
-func (m *Manager) UpsertIdentifier(username, azp, iyoid string) error {
+func (m *mongoManager) UpsertIdentifier(username, azp, iyoid string) error {
 	// Count the amount of iyoids we already have first
 	idObj, err := m.GetByUsernameAndAZP(username, azp)
 	if err != nil && !db.IsNotFound(err) {
@@ -112,7 +112,13 @@ func (m *Manager) UpsertIdentifier(username, azp, iyoid string) error {
 }
 
 // DeleteForClient deletes all iyoids for a client id
-func (m *Manager) DeleteForClient(azp string) error {
+func (m *mongoManager) DeleteForClient(azp string) error {
 	_, err := m.getIdentifierCollection().RemoveAll(bson.M{"azp": azp})
 	return err
 }
+
+// RemoveByUser deletes all iyoids generated for a user
+func (m *mongoManager) RemoveByUser(username string) error {
+	_, err := m.getIdentifierCollection().RemoveAll(bson.M{"username": username})
+	return err
+}
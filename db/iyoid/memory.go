@@ -0,0 +1,111 @@
+package iyoid
+
+import (
+	"sync"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	identifiers []Identifier
+}
+
+// memoryManager keeps the iyoids in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoIdentifierCollectionName, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+// find returns copies of the identifiers that match
+func (m *memoryManager) find(match func(idObj *Identifier) bool) []Identifier {
+	m.store.Lock()
+	defer m.store.Unlock()
+	var identifiers []Identifier
+	for _, idObj := range m.store.identifiers {
+		if match(&idObj) {
+			idObj.IyoIDs = append([]string(nil), idObj.IyoIDs...)
+			identifiers = append(identifiers, idObj)
+		}
+	}
+	return identifiers
+}
+
+// findOne returns the first identifier that matches or mgo.ErrNotFound
+func (m *memoryManager) findOne(match func(idObj *Identifier) bool) (*Identifier, error) {
+	identifiers := m.find(match)
+	if len(identifiers) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return &identifiers[0], nil
+}
+
+func hasIyoID(idObj *Identifier, iyoid string) bool {
+	for _, id := range idObj.IyoIDs {
+		if id == iyoid {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memoryManager) GetByIDAndAZP(iyoid, azp string) (*Identifier, error) {
+	return m.findOne(func(idObj *Identifier) bool { return idObj.Azp == azp && hasIyoID(idObj, iyoid) })
+}
+
+func (m *memoryManager) GetByUsernameAndAZP(username, azp string) (*Identifier, error) {
+	return m.findOne(func(idObj *Identifier) bool { return idObj.Username == username && idObj.Azp == azp })
+}
+
+func (m *memoryManager) GetByUsername(username string) ([]Identifier, error) {
+	return m.find(func(idObj *Identifier) bool { return idObj.Username == username }), nil
+}
+
+func (m *memoryManager) GetByID(iyoid string) (*Identifier, error) {
+	return m.findOne(func(idObj *Identifier) bool { return hasIyoID(idObj, iyoid) })
+}
+
+func (m *memoryManager) UpsertIdentifier(username, azp, iyoid string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for i, idObj := range m.store.identifiers {
+		if idObj.Username == username && idObj.Azp == azp {
+			if len(idObj.IyoIDs) >= maxIdentifiers {
+				return ErrIDLimitReached
+			}
+			m.store.identifiers[i].IyoIDs = append(append([]string{}, idObj.IyoIDs...), iyoid)
+			return nil
+		}
+	}
+	m.store.identifiers = append(m.store.identifiers, Identifier{Username: username, Azp: azp, IyoIDs: []string{iyoid}})
+	return nil
+}
+
+// remove removes the identifiers that match
+func (m *memoryManager) remove(match func(idObj *Identifier) bool) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	remaining := []Identifier{}
+	for _, idObj := range m.store.identifiers {
+		if !match(&idObj) {
+			remaining = append(remaining, idObj)
+		}
+	}
+	m.store.identifiers = remaining
+	return nil
+}
+
+func (m *memoryManager) DeleteForClient(azp string) error {
+	return m.remove(func(idObj *Identifier) bool { return idObj.Azp == azp })
+}
+
+func (m *memoryManager) RemoveByUser(username string) error {
+	return m.remove(func(idObj *Identifier) bool { return idObj.Username == username })
+}
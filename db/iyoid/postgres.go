@@ -0,0 +1,82 @@
+package iyoid
+
+import (
+	"database/sql"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/lib/pq"
+)
+
+var postgresIdentifiers = &db.PostgresCollection{
+	Table: "iyoids",
+	Columns: func(document interface{}) map[string]interface{} {
+		identifier := document.(*Identifier)
+		iyoids := identifier.IyoIDs
+		if iyoids == nil {
+			iyoids = []string{}
+		}
+		return map[string]interface{}{
+			"username": identifier.Username,
+			"azp":      identifier.Azp,
+			"iyoids":   pq.StringArray(iyoids),
+		}
+	},
+}
+
+// postgresManager stores the iyoids in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) findOne(where string, args ...interface{}) (*Identifier, error) {
+	var idObj Identifier
+	if err := postgresIdentifiers.FindOne(m.db, &idObj, where, args...); err != nil {
+		return nil, err
+	}
+	return &idObj, nil
+}
+
+func (m *postgresManager) GetByIDAndAZP(iyoid, azp string) (*Identifier, error) {
+	return m.findOne("iyoids @> ARRAY[$1::text] AND azp = $2", iyoid, azp)
+}
+
+func (m *postgresManager) GetByUsernameAndAZP(username, azp string) (*Identifier, error) {
+	return m.findOne("username = $1 AND azp = $2", username, azp)
+}
+
+func (m *postgresManager) GetByUsername(username string) (identifiers []Identifier, err error) {
+	err = postgresIdentifiers.Find(m.db, &identifiers, "username = $1", username)
+	return
+}
+
+func (m *postgresManager) GetByID(iyoid string) (*Identifier, error) {
+	return m.findOne("iyoids @> ARRAY[$1::text]", iyoid)
+}
+
+func (m *postgresManager) UpsertIdentifier(username, azp, iyoid string) error {
+	return postgresIdentifiers.Upsert(m.db, "username = $1 AND azp = $2", []interface{}{username, azp},
+		func() interface{} { return &Identifier{Username: username, Azp: azp} },
+		func(document interface{}) error {
+			identifier := document.(*Identifier)
+			// The limit is checked on the locked row so concurrent requests can not exceed it
+			if len(identifier.IyoIDs) >= maxIdentifiers {
+				return ErrIDLimitReached
+			}
+			identifier.IyoIDs = append(identifier.IyoIDs, iyoid)
+			return nil
+		})
+}
+
+func (m *postgresManager) DeleteForClient(azp string) error {
+	_, err := postgresIdentifiers.Remove(m.db, "azp = $1", azp)
+	return err
+}
+
+func (m *postgresManager) RemoveByUser(username string) error {
+	_, err := postgresIdentifiers.Remove(m.db, "username = $1", username)
+	return err
+}
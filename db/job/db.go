@@ -0,0 +1,95 @@
+// Package job stores the run history of the background jobs and the lease of the instance that schedules them
+package job
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	mongoLeasesCollectionName = "jobleases"
+	mongoRunsCollectionName   = "jobruns"
+)
+
+// Manager is used to store the leases and the runs of the jobs
+type Manager interface {
+	// AcquireLease takes or renews a lease until expiresAt, it returns false if another owner holds a lease that did not expire
+	AcquireLease(name string, owner string, expiresAt time.Time) (bool, error)
+	// ReleaseLease gives up a lease if it is held by owner
+	ReleaseLease(name string, owner string) error
+	SaveRun(run *Run) error
+	// ListRuns returns the last runs of a job, newest first, or of all jobs if job is empty
+	ListRuns(job string, limit int) ([]Run, error)
+	// LastRun returns the last run of a job, mgo.ErrNotFound is returned if it never ran
+	LastRun(job string) (*Run, error)
+}
+
+// mongoManager stores the leases and runs in mongo, a TTL index removes the expired runs
+type mongoManager struct {
+	leases *mgo.Collection
+	runs   *mgo.Collection
+}
+
+// NewManager creates and initializes a new Manager
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
+	session := db.GetDBSession(r)
+	return &mongoManager{
+		leases: db.GetCollection(session, mongoLeasesCollectionName),
+		runs:   db.GetCollection(session, mongoRunsCollectionName),
+	}
+}
+
+func (m *mongoManager) AcquireLease(name string, owner string, expiresAt time.Time) (bool, error) {
+	err := m.leases.Insert(&lease{Name: name, Owner: owner, ExpiresAt: expiresAt})
+	if !mgo.IsDup(err) {
+		return err == nil, err
+	}
+	err = m.leases.Update(
+		bson.M{"_id": name, "$or": []bson.M{{"owner": owner}, {"expiresat": bson.M{"$lt": time.Now()}}}},
+		bson.M{"$set": bson.M{"owner": owner, "expiresat": expiresAt}})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m *mongoManager) ReleaseLease(name string, owner string) error {
+	err := m.leases.Remove(bson.M{"_id": name, "owner": owner})
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	return err
+}
+
+func (m *mongoManager) SaveRun(run *Run) error {
+	if run.ID == "" {
+		run.ID = bson.NewObjectId()
+	}
+	return m.runs.Insert(run)
+}
+
+func (m *mongoManager) ListRuns(job string, limit int) ([]Run, error) {
+	runs := []Run{}
+	query := bson.M{}
+	if job != "" {
+		query["job"] = job
+	}
+	err := m.runs.Find(query).Sort("-startedat").Limit(limit).All(&runs)
+	return runs, err
+}
+
+func (m *mongoManager) LastRun(job string) (*Run, error) {
+	run := &Run{}
+	err := m.runs.Find(bson.M{"job": job}).Sort("-startedat").One(run)
+	return run, err
+}
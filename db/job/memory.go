@@ -0,0 +1,83 @@
+package job
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	leases map[string]lease
+	runs   []Run
+}
+
+// memoryManager keeps the leases and runs in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoRunsCollectionName, func() interface{} {
+		return &memoryStore{leases: make(map[string]lease)}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) AcquireLease(name string, owner string, expiresAt time.Time) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if held, ok := m.store.leases[name]; ok && held.Owner != owner && held.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+	m.store.leases[name] = lease{Name: name, Owner: owner, ExpiresAt: expiresAt}
+	return true, nil
+}
+
+func (m *memoryManager) ReleaseLease(name string, owner string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if held, ok := m.store.leases[name]; ok && held.Owner == owner {
+		delete(m.store.leases, name)
+	}
+	return nil
+}
+
+func (m *memoryManager) SaveRun(run *Run) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if run.ID == "" {
+		run.ID = bson.NewObjectId()
+	}
+	m.store.runs = append(m.store.runs, *run)
+	return nil
+}
+
+func (m *memoryManager) ListRuns(job string, limit int) ([]Run, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	runs := []Run{}
+	now := time.Now()
+	for _, run := range m.store.runs {
+		if (job == "" || run.Job == job) && run.ExpiresAt.After(now) {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func (m *memoryManager) LastRun(job string) (*Run, error) {
+	runs, _ := m.ListRuns(job, 1)
+	if len(runs) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return &runs[0], nil
+}
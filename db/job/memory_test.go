@@ -0,0 +1,57 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLease(t *testing.T) {
+	m := newMemoryManager(db.NewMemoryBackend())
+	now := time.Now()
+
+	acquired, err := m.AcquireLease("scheduler", "a", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = m.AcquireLease("scheduler", "b", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, acquired, "the lease is held by another owner")
+	acquired, err = m.AcquireLease("scheduler", "a", now.Add(2*time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, acquired, "the owner renews the lease")
+
+	assert.NoError(t, m.ReleaseLease("scheduler", "b"))
+	acquired, _ = m.AcquireLease("scheduler", "b", now.Add(time.Minute))
+	assert.False(t, acquired, "only the owner releases the lease")
+	assert.NoError(t, m.ReleaseLease("scheduler", "a"))
+	acquired, _ = m.AcquireLease("scheduler", "b", now.Add(-time.Second))
+	assert.True(t, acquired, "a released lease is taken")
+	acquired, _ = m.AcquireLease("scheduler", "a", now.Add(time.Minute))
+	assert.True(t, acquired, "an expired lease is taken over")
+}
+
+func TestMemoryRuns(t *testing.T) {
+	m := newMemoryManager(db.NewMemoryBackend())
+	now := time.Now()
+	for i, name := range []string{"a", "b", "a"} {
+		assert.NoError(t, m.SaveRun(&Run{Job: name, StartedAt: now.Add(time.Duration(i) * time.Minute), ExpiresAt: now.Add(time.Hour)}))
+	}
+	assert.NoError(t, m.SaveRun(&Run{Job: "a", StartedAt: now.Add(time.Hour), ExpiresAt: now.Add(-time.Second)}))
+
+	runs, err := m.ListRuns("", 10)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 3, "expired runs are not listed")
+	runs, err = m.ListRuns("a", 1)
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, now.Add(2*time.Minute), runs[0].StartedAt, "newest first")
+	}
+
+	last, err := m.LastRun("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", last.Job)
+	_, err = m.LastRun("c")
+	assert.True(t, db.IsNotFound(err))
+}
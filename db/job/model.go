@@ -0,0 +1,38 @@
+package job
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The ways a run is started
+const (
+	// TriggerSchedule is a run started by the scheduler because the interval of the job passed
+	TriggerSchedule = "schedule"
+	// TriggerManual is a run started by an operator
+	TriggerManual = "manual"
+)
+
+// Run is an execution of a job, the runs are kept as the history of the jobs
+type Run struct {
+	ID      bson.ObjectId `json:"id" bson:"_id,omitempty"`
+	Job     string        `json:"job"`
+	Trigger string        `json:"trigger"`
+	// Instance identifies the server or the admin command that ran the job
+	Instance   string    `json:"instance"`
+	StartedAt  time.Time `json:"startedat"`
+	FinishedAt time.Time `json:"finishedat"`
+	// Removed is the number of documents the job removed
+	Removed int `json:"removed"`
+	// Error is set if the run failed
+	Error     string    `json:"error,omitempty"`
+	ExpiresAt time.Time `json:"-"`
+}
+
+// lease is held by the instance that schedules the jobs
+type lease struct {
+	Name      string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expiresat"`
+}
@@ -0,0 +1,67 @@
+package job
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+var postgresRuns = &db.PostgresCollection{
+	Table: "jobruns",
+	Columns: func(document interface{}) map[string]interface{} {
+		run := document.(*Run)
+		return map[string]interface{}{
+			"job":        run.Job,
+			"started_at": run.StartedAt,
+			"expires_at": run.ExpiresAt,
+		}
+	},
+}
+
+// postgresManager stores the runs in a postgres database and the leases in the jobleases table,
+// the expired rows are removed by the backend
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+// AcquireLease takes the lease in a single statement, so only one of the instances that try at the same time gets it
+func (m *postgresManager) AcquireLease(name string, owner string, expiresAt time.Time) (bool, error) {
+	result, err := m.db.Exec(`INSERT INTO jobleases (name, owner, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+		WHERE jobleases.owner = EXCLUDED.owner OR jobleases.expires_at < $4`, name, owner, expiresAt, time.Now())
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (m *postgresManager) ReleaseLease(name string, owner string) error {
+	_, err := m.db.Exec("DELETE FROM jobleases WHERE name = $1 AND owner = $2", name, owner)
+	return err
+}
+
+func (m *postgresManager) SaveRun(run *Run) error {
+	return postgresRuns.Insert(m.db, run)
+}
+
+func (m *postgresManager) ListRuns(job string, limit int) ([]Run, error) {
+	runs := []Run{}
+	if job == "" {
+		err := postgresRuns.Find(m.db, &runs, "TRUE ORDER BY started_at DESC LIMIT $1", limit)
+		return runs, err
+	}
+	err := postgresRuns.Find(m.db, &runs, "job = $1 ORDER BY started_at DESC LIMIT $2", job, limit)
+	return runs, err
+}
+
+func (m *postgresManager) LastRun(job string) (*Run, error) {
+	run := &Run{}
+	err := postgresRuns.FindOne(m.db, run, "job = $1 ORDER BY started_at DESC", job)
+	return run, err
+}
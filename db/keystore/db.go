@@ -12,36 +12,40 @@ const (
 	mongoKeyStoreCollectionName = "keystore"
 )
 
-//InitModels initialize models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:      []string{"label", "username", "globalid"},
-		Unique:   true,
-		DropDups: true,
-	}
-
-	db.EnsureIndex(mongoKeyStoreCollectionName, index)
+//Manager is used to store keystore keys
+type Manager interface {
+	Create(key *KeyStoreKey) error
+	ListKeyStoreKeys(username string, globalid string) ([]KeyStoreKey, error)
+	GetKeyStoreKey(username string, globalid string, label string) (*KeyStoreKey, error)
+	RemoveByUser(username string) error
+	ListByUser(username string) ([]KeyStoreKey, error)
 }
 
-//Manager is used to store users
-type Manager struct {
+//mongoManager stores the keystore keys in mongo
+type mongoManager struct {
 	session *mgo.Session
 }
 
 //NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session: session,
 	}
 }
 
-func (m *Manager) getKeyStoreCollection() *mgo.Collection {
+func (m *mongoManager) getKeyStoreCollection() *mgo.Collection {
 	return db.GetCollection(m.session, mongoKeyStoreCollectionName)
 }
 
 // Create a new KeyStore key entry.
-func (m *Manager) Create(key *KeyStoreKey) error {
+func (m *mongoManager) Create(key *KeyStoreKey) error {
 	err := m.getKeyStoreCollection().Insert(key)
 	if mgo.IsDup(err) {
 		return db.ErrDuplicate
@@ -49,7 +53,7 @@ func (m *Manager) Create(key *KeyStoreKey) error {
 	return err
 }
 
-func (m *Manager) ListKeyStoreKeys(username string, globalid string) ([]KeyStoreKey, error) {
+func (m *mongoManager) ListKeyStoreKeys(username string, globalid string) ([]KeyStoreKey, error) {
 	keys := make([]KeyStoreKey, 0)
 	condition := []interface{}{
 		bson.M{"globalid": globalid},
@@ -59,7 +63,7 @@ func (m *Manager) ListKeyStoreKeys(username string, globalid string) ([]KeyStore
 	return keys, err
 }
 
-func (m *Manager) GetKeyStoreKey(username string, globalid string, label string) (*KeyStoreKey, error) {
+func (m *mongoManager) GetKeyStoreKey(username string, globalid string, label string) (*KeyStoreKey, error) {
 	qry := bson.M{
 		"globalid": globalid,
 		"username": username,
@@ -70,3 +74,16 @@ func (m *Manager) GetKeyStoreKey(username string, globalid string, label string)
 	err := m.getKeyStoreCollection().Find(qry).One(key)
 	return key, err
 }
+
+// RemoveByUser removes all keys stored for a user by any organization
+func (m *mongoManager) RemoveByUser(username string) error {
+	_, err := m.getKeyStoreCollection().RemoveAll(bson.M{"username": username})
+	return err
+}
+
+// ListByUser lists all keys stored for a user by any organization
+func (m *mongoManager) ListByUser(username string) ([]KeyStoreKey, error) {
+	var keys []KeyStoreKey
+	err := m.getKeyStoreCollection().Find(bson.M{"username": username}).All(&keys)
+	return keys, err
+}
@@ -0,0 +1,90 @@
+package keystore
+
+import (
+	"sync"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	keys []KeyStoreKey
+}
+
+//memoryManager keeps the keystore keys in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoKeyStoreCollectionName, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+// find returns the keys that match, the caller holds the lock
+func (m *memoryManager) find(match func(key *KeyStoreKey) bool) []KeyStoreKey {
+	keys := make([]KeyStoreKey, 0)
+	for _, key := range m.store.keys {
+		if match(&key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (m *memoryManager) Create(key *KeyStoreKey) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	existing := m.find(func(k *KeyStoreKey) bool {
+		return k.Label == key.Label && k.Username == key.Username && k.Globalid == key.Globalid
+	})
+	if len(existing) > 0 {
+		return db.ErrDuplicate
+	}
+	m.store.keys = append(m.store.keys, *key)
+	return nil
+}
+
+func (m *memoryManager) ListKeyStoreKeys(username string, globalid string) ([]KeyStoreKey, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	return m.find(func(key *KeyStoreKey) bool { return key.Username == username && key.Globalid == globalid }), nil
+}
+
+func (m *memoryManager) GetKeyStoreKey(username string, globalid string, label string) (*KeyStoreKey, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	keys := m.find(func(key *KeyStoreKey) bool {
+		return key.Username == username && key.Globalid == globalid && key.Label == label
+	})
+	if len(keys) == 0 {
+		return &KeyStoreKey{}, mgo.ErrNotFound
+	}
+	return &keys[0], nil
+}
+
+func (m *memoryManager) RemoveByUser(username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	remaining := []KeyStoreKey{}
+	for _, key := range m.store.keys {
+		if key.Username != username {
+			remaining = append(remaining, key)
+		}
+	}
+	m.store.keys = remaining
+	return nil
+}
+
+func (m *memoryManager) ListByUser(username string) ([]KeyStoreKey, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	keys := m.find(func(key *KeyStoreKey) bool { return key.Username == username })
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return keys, nil
+}
@@ -0,0 +1,54 @@
+package keystore
+
+import (
+	"database/sql"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+var postgresKeys = &db.PostgresCollection{
+	Table: "keystore",
+	Columns: func(document interface{}) map[string]interface{} {
+		key := document.(*KeyStoreKey)
+		return map[string]interface{}{
+			"username": key.Username,
+			"globalid": key.Globalid,
+			"label":    key.Label,
+		}
+	},
+}
+
+//postgresManager stores the keystore keys in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) Create(key *KeyStoreKey) error {
+	return postgresKeys.Insert(m.db, key)
+}
+
+func (m *postgresManager) ListKeyStoreKeys(username string, globalid string) ([]KeyStoreKey, error) {
+	keys := make([]KeyStoreKey, 0)
+	err := postgresKeys.Find(m.db, &keys, "globalid = $1 AND username = $2", globalid, username)
+	return keys, err
+}
+
+func (m *postgresManager) GetKeyStoreKey(username string, globalid string, label string) (*KeyStoreKey, error) {
+	key := &KeyStoreKey{}
+	err := postgresKeys.FindOne(m.db, key, "globalid = $1 AND username = $2 AND label = $3", globalid, username, label)
+	return key, err
+}
+
+func (m *postgresManager) RemoveByUser(username string) error {
+	_, err := postgresKeys.Remove(m.db, "username = $1", username)
+	return err
+}
+
+func (m *postgresManager) ListByUser(username string) (keys []KeyStoreKey, err error) {
+	err = postgresKeys.Find(m.db, &keys, "username = $1", username)
+	return
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/itsyouonline/identityserver/metrics"
+	"gopkg.in/mgo.v2"
+)
+
+var errNotConnected = errors.New("Not connected to a database")
+
+func init() {
+	// mgo only keeps the socket statistics when asked to
+	mgo.SetStats(true)
+
+	metrics.NewGaugeFunc("iyo_mongo_sockets_alive", "Sockets to mongo that are open", func() (float64, error) {
+		if dbSession == nil {
+			return 0, errNotConnected
+		}
+		return float64(mgo.GetStats().SocketsAlive), nil
+	})
+	metrics.NewGaugeFunc("iyo_mongo_sockets_in_use", "Sockets to mongo that are used by a session", func() (float64, error) {
+		if dbSession == nil {
+			return 0, errNotConnected
+		}
+		return float64(mgo.GetStats().SocketsInUse), nil
+	})
+	metrics.NewGaugeFunc("iyo_postgres_open_connections", "Connections to postgres that are open", func() (float64, error) {
+		if postgresDB == nil {
+			return 0, errNotConnected
+		}
+		return float64(postgresDB.Stats().OpenConnections), nil
+	})
+	metrics.NewGaugeFunc("iyo_db_ping_seconds", "Round trip time of a ping to the database, measured when the metrics are scraped", pingDuration)
+}
+
+// pingDuration measures how long the database takes to answer a ping
+func pingDuration() (float64, error) {
+	start := time.Now()
+	err := Ping()
+	return time.Since(start).Seconds(), err
+}
@@ -1,32 +1,34 @@
 package db
 
 import (
-	"errors"
 	"net/http"
 )
 
 type DBHandler struct {
 	handler http.Handler
+	backend Backend
 }
 
 func (d *DBHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	session := SetDBSession(r)
+	release, err := OpenBackend(d.backend, r)
 
-	if session == nil {
-		panic(errors.New("Failed to retrieve a DB session!"))
+	if err != nil {
+		panic(err)
 	}
 
 	defer func() {
-		session.Close()
+		release()
 	}()
 
 	d.handler.ServeHTTP(w, r)
 }
 
-func DBMiddleware() func(h http.Handler) http.Handler {
+// DBMiddleware opens the backend for every request, the managers created from the request use it
+func DBMiddleware(backend Backend) func(h http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return &DBHandler{
 			handler: h,
+			backend: backend,
 		}
 	}
 }
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// indexAuditLog indexes the audit log by user and organization and removes the events when their retention ends
+func indexAuditLog(session *mgo.Session) error {
+	return ensureIndices(session, "auditlog",
+		mgo.Index{
+			Key: []string{"actor", "-timestamp"},
+		},
+		mgo.Index{
+			Key: []string{"subject", "-timestamp"},
+		},
+		mgo.Index{
+			Key: []string{"organization", "-timestamp"},
+		},
+		mgo.Index{
+			Key:         []string{"expiresat"},
+			ExpireAfter: time.Second, // Remove once the retention ended, mongo ignores an expiration of 0
+			Background:  true,
+		},
+	)
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"strings"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+)
+
+// cacheInvalidationsSize is the size in bytes of the capped collection, enough for many minutes of invalidations
+const cacheInvalidationsSize = 1 << 20
+
+// createCacheInvalidations creates the capped collection the instances tail to invalidate their caches
+func createCacheInvalidations(session *mgo.Session) error {
+	err := db.GetCollection(session, "cacheinvalidations").Create(&mgo.CollectionInfo{
+		Capped:   true,
+		MaxBytes: cacheInvalidationsSize,
+	})
+	// The collection already exists when the migration was interrupted before it was recorded
+	if err != nil && strings.Contains(err.Error(), "already exists") {
+		return nil
+	}
+	return err
+}
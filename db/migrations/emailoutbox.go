@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// indexEmailOutbox indexes the outbox by the next attempt and removes the emails when they expire
+func indexEmailOutbox(session *mgo.Session) error {
+	return ensureIndices(session, "emailoutbox",
+		mgo.Index{
+			Key: []string{"status", "nextattempt"},
+		},
+		mgo.Index{
+			Key:         []string{"expiresat"},
+			ExpireAfter: time.Second, // Remove once the email expired, mongo ignores an expiration of 0
+			Background:  true,
+		},
+	)
+}
@@ -0,0 +1,411 @@
+package migrations
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// createIndices creates the indices and the automatic expirations of all collections
+func createIndices(session *mgo.Session) (err error) {
+	for _, create := range []func(*mgo.Session) error{
+		createUserIndices,
+		createCredentialIndices,
+		createOrganizationIndices,
+		createValidationIndices,
+		createOauthIndices,
+		createLoginIndices,
+		createOtherIndices,
+	} {
+		if err = create(session); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func createUserIndices(session *mgo.Session) (err error) {
+	err = ensureIndices(session, "users",
+		mgo.Index{
+			Key:      []string{"username"},
+			Unique:   true,
+			DropDups: true,
+		},
+		// Removes users without valid 2 factor authentication after 3 days
+		mgo.Index{
+			Key:         []string{"expire"},
+			ExpireAfter: time.Second * 3600 * 24 * 3,
+			Background:  true,
+		},
+		mgo.Index{
+			Key: []string{"emailaddresses.emailaddress"},
+		},
+		mgo.Index{
+			Key: []string{"linkedaccounts.provider", "linkedaccounts.subject"},
+		},
+	)
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "avatarfiles", mgo.Index{
+		Key:      []string{"hash"},
+		Unique:   true,
+		DropDups: true,
+	})
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "registrationsinprogress",
+		mgo.Index{
+			Key:    []string{"sessionkey"},
+			Unique: true,
+		},
+		mgo.Index{
+			Key:    []string{"emailvalidationkey"},
+			Unique: false, // Uniqueness is enforced in the respective ongoing validation collection
+		},
+		mgo.Index{
+			Key:    []string{"phonevalidationkey"},
+			Unique: false, // Uniqueness is enforced in the respective ongoing validation collection
+		},
+		mgo.Index{
+			Key:         []string{"createdat"},
+			ExpireAfter: time.Second * 60 * 60 * 24, // Remove after one day
+			Background:  true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	return ensureIndices(session, "dataexports",
+		mgo.Index{
+			Key: []string{"username"},
+		},
+		mgo.Index{
+			Key:         []string{"expiresat"},
+			ExpireAfter: time.Second, // Remove once the export expired, mongo ignores an expiration of 0
+			Background:  true,
+		},
+	)
+}
+
+func createCredentialIndices(session *mgo.Session) (err error) {
+	err = ensureIndices(session, "totp", mgo.Index{
+		Key:      []string{"username"},
+		Unique:   true,
+		DropDups: true,
+	})
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "password", mgo.Index{
+		Key:      []string{"username"},
+		Unique:   true,
+		DropDups: true,
+	})
+	if err != nil {
+		return
+	}
+	return ensureIndices(session, "passwordresetoken",
+		mgo.Index{
+			Key:      []string{"username", "token"},
+			Unique:   true,
+			DropDups: true,
+		},
+		mgo.Index{
+			Key:         []string{"createdat"},
+			ExpireAfter: time.Minute * 10,
+			Background:  true,
+		},
+	)
+}
+
+func createOrganizationIndices(session *mgo.Session) (err error) {
+	err = ensureIndices(session, "organizations",
+		mgo.Index{
+			Key:    []string{"globalid"},
+			Unique: true,
+		},
+		// Search organizations based on user access
+		mgo.Index{
+			Key:        []string{"owners"},
+			Background: true,
+		},
+		mgo.Index{
+			Key:        []string{"members"},
+			Background: true,
+		},
+		mgo.Index{
+			Key:        []string{"orgowners"},
+			Background: true,
+		},
+		mgo.Index{
+			Key:        []string{"orgmembers"},
+			Background: true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "organizationLogos", mgo.Index{
+		Key:    []string{"globalid"},
+		Unique: true,
+	})
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "last2falogin",
+		mgo.Index{
+			Key:    []string{"globalid", "username"},
+			Unique: true,
+		},
+		// remove last2fa entries after 31 days
+		mgo.Index{
+			Key:         []string{"last2fa"},
+			ExpireAfter: time.Second * 3600 * 24 * 31,
+			Background:  true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "organizationdescriptions", mgo.Index{
+		Key:    []string{"globalid"},
+		Unique: true,
+	})
+	if err != nil {
+		return
+	}
+	return ensureIndices(session, "companies", mgo.Index{
+		Key:      []string{"globalid"},
+		Unique:   true,
+		DropDups: true,
+	})
+}
+
+func createValidationIndices(session *mgo.Session) (err error) {
+	key := mgo.Index{
+		Key:      []string{"key"},
+		Unique:   true,
+		DropDups: false,
+	}
+	err = ensureIndices(session, "ongoingphonenumbervalidations",
+		key,
+		mgo.Index{
+			Key:         []string{"createdat"},
+			ExpireAfter: time.Second * 60 * 10,
+			Background:  true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "ongoingemailaddressvalidations",
+		key,
+		mgo.Index{
+			Key:         []string{"createdat"},
+			ExpireAfter: time.Second * 3600 * 48,
+			Background:  true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "validatedphonenumbers",
+		mgo.Index{
+			Key:      []string{"username", "phonenumber"},
+			Unique:   true,
+			DropDups: true,
+		},
+		mgo.Index{
+			Key:      []string{"phonenumber"},
+			Unique:   true,
+			DropDups: true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	return ensureIndices(session, "validatedemailaddresses",
+		mgo.Index{
+			Key:      []string{"username", "emailaddress"},
+			Unique:   true,
+			DropDups: true,
+		},
+		mgo.Index{
+			Key:      []string{"emailaddress"},
+			Unique:   true,
+			DropDups: true,
+		},
+	)
+}
+
+func createOauthIndices(session *mgo.Session) (err error) {
+	err = ensureIndices(session, "oauth_authorizationrequests",
+		//Do not drop duplicates since it would hijack another authorizationrequest, better to error out
+		mgo.Index{
+			Key:    []string{"authorizationcode"},
+			Unique: true,
+		},
+		mgo.Index{
+			Key:         []string{"createdat"},
+			ExpireAfter: time.Second * 10,
+			Background:  true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "oauth_accesstokens",
+		mgo.Index{
+			Key:    []string{"accesstoken"},
+			Unique: true,
+		},
+		// The expiration of an access token, oauthservice.AccessTokenExpiration
+		mgo.Index{
+			Key:         []string{"createdat"},
+			ExpireAfter: time.Second * 3600 * 24,
+			Background:  true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "oauth_clients", mgo.Index{
+		Key:    []string{"clientid", "label"},
+		Unique: true,
+	})
+	if err != nil {
+		return
+	}
+	return ensureIndices(session, "oauth_refreshtokens",
+		//Do not drop duplicates since it would hijack another refreshtoken, better to error out
+		mgo.Index{
+			Key:    []string{"refreshtoken"},
+			Unique: true,
+		},
+		mgo.Index{
+			Key:         []string{"lastused"},
+			ExpireAfter: time.Second * 86400 * 30,
+			Background:  true,
+		},
+	)
+}
+
+func createLoginIndices(session *mgo.Session) (err error) {
+	err = ensureIndices(session, "loginsessions",
+		mgo.Index{
+			Key:      []string{"sessionkey"},
+			Unique:   true,
+			DropDups: false,
+		},
+		mgo.Index{
+			Key:         []string{"createdat"},
+			ExpireAfter: time.Second * 60 * 10,
+			Background:  true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	return ensureIndices(session, "loginmagiclinks",
+		mgo.Index{
+			Key:      []string{"key"},
+			Unique:   true,
+			DropDups: false,
+		},
+		// The time a magic link can be used
+		mgo.Index{
+			Key:         []string{"createdat"},
+			ExpireAfter: time.Minute * 10,
+			Background:  true,
+		},
+	)
+}
+
+func createOtherIndices(session *mgo.Session) (err error) {
+	err = ensureIndices(session, "see", mgo.Index{
+		Key:      []string{"username", "globalid", "uniqueid"},
+		Unique:   true,
+		DropDups: true,
+	})
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "iyoids",
+		mgo.Index{
+			Key:    []string{"username", "azp"},
+			Unique: true,
+		},
+		mgo.Index{
+			Key:    []string{"iyoids"},
+			Unique: true,
+		},
+		mgo.Index{
+			Key:    []string{"iyoids", "azp"},
+			Unique: true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "grants",
+		mgo.Index{
+			Key:    []string{"username", "globalid"},
+			Unique: true,
+		},
+		mgo.Index{
+			Key: []string{"grants"},
+		},
+		mgo.Index{
+			Key: []string{"grants", "globalid"},
+		},
+	)
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "contracts", mgo.Index{
+		Key:    []string{"contractid"},
+		Unique: true,
+	})
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "registry",
+		mgo.Index{
+			Key:    []string{"username"},
+			Unique: true,
+		},
+		mgo.Index{
+			Key:    []string{"globalid"},
+			Unique: true,
+		},
+		mgo.Index{
+			Key:    []string{"entries.key"},
+			Unique: true,
+		},
+	)
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "keystore", mgo.Index{
+		Key:      []string{"label", "username", "globalid"},
+		Unique:   true,
+		DropDups: true,
+	})
+	if err != nil {
+		return
+	}
+	err = ensureIndices(session, "persistentlogs", mgo.Index{
+		Key:    []string{"key"},
+		Unique: false,
+	})
+	if err != nil {
+		return
+	}
+	return ensureIndices(session, "globalconfig", mgo.Index{
+		Key:      []string{"key"},
+		Unique:   true,
+		DropDups: true,
+	})
+}
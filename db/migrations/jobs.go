@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// indexJobRuns indexes the run history of the jobs and removes the runs when they expire,
+// and indexes the avatar files by creation time for the cleanup of the orphaned files
+func indexJobRuns(session *mgo.Session) error {
+	if err := ensureIndices(session, "jobruns",
+		mgo.Index{
+			Key: []string{"job", "-startedat"},
+		},
+		mgo.Index{
+			Key: []string{"-startedat"},
+		},
+		mgo.Index{
+			Key:         []string{"expiresat"},
+			ExpireAfter: time.Second, // Remove once the run expired, mongo ignores an expiration of 0
+			Background:  true,
+		},
+	); err != nil {
+		return err
+	}
+	return ensureIndices(session, "avatarfiles",
+		mgo.Index{
+			Key:        []string{"createdat"},
+			Background: true,
+		},
+	)
+}
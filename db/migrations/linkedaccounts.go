@@ -0,0 +1,86 @@
+package migrations
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/user"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+//migrateLegacyAccounts moves the facebook and github accounts to the linked accounts
+func migrateLegacyAccounts(session *mgo.Session) error {
+	collection := db.GetCollection(session, "users")
+
+	legacy := struct {
+		Username string
+		Facebook user.FacebookAccount
+		Github   user.GithubAccount
+	}{}
+	iter := collection.Find(bson.M{"$or": []bson.M{
+		{"facebook.id": bson.M{"$exists": true}},
+		{"github.id": bson.M{"$exists": true}},
+	}}).Iter()
+	for iter.Next(&legacy) {
+		var accounts []user.LinkedAccount
+		if legacy.Facebook.Id != "" {
+			accounts = append(accounts, user.LinkedAccount{
+				Provider: "facebook",
+				Subject:  legacy.Facebook.Id,
+				Name:     legacy.Facebook.Name,
+				Picture:  legacy.Facebook.Picture,
+				Link:     legacy.Facebook.Link,
+				LinkedAt: db.DateTime(time.Now()),
+			})
+		}
+		if legacy.Github.Id != 0 {
+			accounts = append(accounts, user.LinkedAccount{
+				Provider: "github",
+				Subject:  strconv.Itoa(legacy.Github.Id),
+				Name:     legacy.Github.Name,
+				Login:    legacy.Github.Login,
+				Picture:  legacy.Github.Avatar_url,
+				Link:     legacy.Github.Html_url,
+				LinkedAt: db.DateTime(time.Now()),
+			})
+		}
+		// The legacy accounts are removed in the same update, so a user is not migrated twice
+		update := bson.M{"$unset": bson.M{"facebook": "", "github": ""}}
+		if len(accounts) > 0 {
+			update["$push"] = bson.M{"linkedaccounts": bson.M{"$each": accounts}}
+		}
+		if err := collection.Update(bson.M{"username": legacy.Username}, update); err != nil {
+			iter.Close()
+			return err
+		}
+		legacy.Facebook, legacy.Github = user.FacebookAccount{}, user.GithubAccount{}
+	}
+	return iter.Close()
+}
+
+//uniqueLinkedAccounts makes sure an upstream account is linked to one user at most.
+// The index only covers the users with linked accounts, mongo would index the others as duplicates.
+// It fails if an account is already linked to several users, they have to be unlinked first.
+func uniqueLinkedAccounts(session *mgo.Session) error {
+	collection := db.GetCollection(session, "users")
+	// The index of the first migration has the same keys, mongo does not allow both
+	if err := collection.DropIndex("linkedaccounts.provider", "linkedaccounts.subject"); err != nil && !isIndexNotFound(err) {
+		return err
+	}
+	return collection.Database.Run(bson.D{
+		{Name: "createIndexes", Value: collection.Name},
+		{Name: "indexes", Value: []bson.M{{
+			"name":                    "linkedaccounts_unique",
+			"key":                     bson.D{{Name: "linkedaccounts.provider", Value: 1}, {Name: "linkedaccounts.subject", Value: 1}},
+			"unique":                  true,
+			"partialFilterExpression": bson.M{"linkedaccounts.subject": bson.M{"$exists": true}},
+		}}},
+	}, nil)
+}
+
+func isIndexNotFound(err error) bool {
+	queryErr, ok := err.(*mgo.QueryError)
+	return ok && queryErr.Code == 27
+}
@@ -0,0 +1,167 @@
+// Package migrations keeps the schema and the data in the database up to date.
+// Migrations are applied in order of their version and are recorded in the schema_migrations collection,
+// a lock makes sure only one instance applies them.
+package migrations
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	mongoMigrationsCollectionName = "schema_migrations"
+	mongoLockCollectionName       = "schema_migrations_lock"
+	lockID                        = "migrations"
+	// lockTimeout is the time after which a lock is considered abandoned by an instance that stopped while migrating
+	lockTimeout       = 30 * time.Minute
+	lockRetryInterval = 5 * time.Second
+)
+
+// Migration is a change to the schema or the data in the database.
+// Up must be safe to run again, an instance can stop after the migration is applied but before it is recorded.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(session *mgo.Session) error
+}
+
+// migrations lists all migrations in order, new migrations are added at the end with the next version
+var migrations = []Migration{
+	{Version: 1, Description: "Create the indices", Up: createIndices},
+	{Version: 2, Description: "Move the facebook and github accounts to the linked accounts", Up: migrateLegacyAccounts},
+	{Version: 3, Description: "Index the sms history by phone number", Up: indexSMSHistory},
+	{Version: 4, Description: "Expire the rate limit counters", Up: expireRateLimits},
+	{Version: 5, Description: "Create the cache invalidations", Up: createCacheInvalidations},
+	{Version: 6, Description: "Index the audit log", Up: indexAuditLog},
+	{Version: 7, Description: "Index the webhooks and their deliveries", Up: indexWebhooks},
+	{Version: 8, Description: "Index the job runs", Up: indexJobRuns},
+	{Version: 9, Description: "Index the email outbox", Up: indexEmailOutbox},
+	{Version: 10, Description: "Make the linked accounts unique", Up: uniqueLinkedAccounts},
+	{Version: 11, Description: "Index the persistent logs by user", Up: indexPersistentLogsByUser},
+}
+
+// appliedMigration records an applied migration
+type appliedMigration struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedat"`
+}
+
+// Status is the state of a migration, AppliedAt is nil if the migration is pending
+type Status struct {
+	Version     int
+	Description string
+	AppliedAt   *time.Time
+}
+
+type migrationLock struct {
+	ID       string    `bson:"_id"`
+	Owner    string    `bson:"owner"`
+	LockedAt time.Time `bson:"lockedat"`
+}
+
+// Run applies the pending migrations, it waits until no other instance is applying migrations
+func Run(session *mgo.Session) (err error) {
+	owner, err := lock(session)
+	if err != nil {
+		return
+	}
+	defer unlock(session, owner)
+
+	applied, err := getApplied(session)
+	if err != nil {
+		return
+	}
+	collection := db.GetCollection(session, mongoMigrationsCollectionName)
+	for _, migration := range migrations {
+		if _, done := applied[migration.Version]; done {
+			continue
+		}
+		log.Infof("Applying migration %d: %s", migration.Version, migration.Description)
+		if err = migration.Up(session); err != nil {
+			return fmt.Errorf("Migration %d failed: %s", migration.Version, err)
+		}
+		record := &appliedMigration{Version: migration.Version, Description: migration.Description, AppliedAt: time.Now()}
+		if err = collection.Insert(record); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GetStatus lists all migrations and when they were applied
+func GetStatus(session *mgo.Session) (status []Status, err error) {
+	applied, err := getApplied(session)
+	if err != nil {
+		return
+	}
+	for _, migration := range migrations {
+		s := Status{Version: migration.Version, Description: migration.Description}
+		if record, done := applied[migration.Version]; done {
+			s.AppliedAt = &record.AppliedAt
+		}
+		status = append(status, s)
+	}
+	return
+}
+
+func getApplied(session *mgo.Session) (applied map[int]appliedMigration, err error) {
+	var records []appliedMigration
+	if err = db.GetCollection(session, mongoMigrationsCollectionName).Find(nil).All(&records); err != nil {
+		return
+	}
+	applied = make(map[int]appliedMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return
+}
+
+// lock waits until the migration lock is acquired and returns the owner needed to release it
+func lock(session *mgo.Session) (owner string, err error) {
+	hostname, _ := os.Hostname()
+	owner = fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())
+	collection := db.GetCollection(session, mongoLockCollectionName)
+	for {
+		err = collection.Insert(&migrationLock{ID: lockID, Owner: owner, LockedAt: time.Now()})
+		if !mgo.IsDup(err) {
+			return
+		}
+		err = collection.Update(
+			bson.M{"_id": lockID, "lockedat": bson.M{"$lt": time.Now().Add(-lockTimeout)}},
+			bson.M{"$set": bson.M{"owner": owner, "lockedat": time.Now()}})
+		if err == nil {
+			log.Warn("Took over an abandoned migration lock")
+			return
+		}
+		if err != mgo.ErrNotFound {
+			return
+		}
+		log.Info("Waiting for another instance to finish the migrations")
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func unlock(session *mgo.Session, owner string) {
+	err := db.GetCollection(session, mongoLockCollectionName).Remove(bson.M{"_id": lockID, "owner": owner})
+	if err != nil {
+		log.Error("Failed to release the migration lock: ", err)
+	}
+}
+
+// ensureIndices creates the indices on a collection if they do not exist yet
+func ensureIndices(session *mgo.Session, collectionName string, indices ...mgo.Index) error {
+	collection := db.GetCollection(session, collectionName)
+	for _, index := range indices {
+		if err := collection.EnsureIndex(index); err != nil {
+			return fmt.Errorf("Failed to create index on collection \"%s\": %s", collectionName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrationOrder(t *testing.T) {
+	for i, migration := range migrations {
+		// Versions are never reused or reordered, the applied versions are recorded in the database
+		assert.Equal(t, i+1, migration.Version, migration.Description)
+		assert.NotEmpty(t, migration.Description)
+		assert.NotNil(t, migration.Up, migration.Description)
+	}
+}
+
+func TestPostgresMigrationOrder(t *testing.T) {
+	for i, migration := range postgresMigrations {
+		assert.Equal(t, i+1, migration.Version, migration.Description)
+		assert.NotEmpty(t, migration.Description)
+		assert.NotNil(t, migration.Up, migration.Description)
+	}
+}
+
+func TestPostgresIndexName(t *testing.T) {
+	assert.Equal(t, "CREATE UNIQUE INDEX IF NOT EXISTS see_username_globalid_uniqueid_key ON see (username, globalid, uniqueid)",
+		postgresIndex(true, "see", "(username, globalid, uniqueid)"))
+	assert.Equal(t, "CREATE INDEX IF NOT EXISTS users_emailaddresses_idx ON users USING gin (emailaddresses)",
+		postgresIndex(false, "users", "USING gin (emailaddresses)"))
+}
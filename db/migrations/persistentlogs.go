@@ -0,0 +1,14 @@
+package migrations
+
+import "gopkg.in/mgo.v2"
+
+// indexPersistentLogsByUser indexes the persistent logs by the user the flow created,
+// the logs of unfinished flows have no user so the index is sparse
+func indexPersistentLogsByUser(session *mgo.Session) error {
+	return ensureIndices(session, "persistentlogs",
+		mgo.Index{
+			Key:    []string{"username"},
+			Sparse: true,
+		},
+	)
+}
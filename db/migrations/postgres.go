@@ -0,0 +1,356 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/db"
+)
+
+const (
+	postgresMigrationsTableName = "schema_migrations"
+	// postgresLockKey identifies the advisory lock taken while migrating
+	postgresLockKey = 7411893
+)
+
+// PostgresMigration is a change to the schema or the data in a postgres database, it runs in a transaction
+type PostgresMigration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+}
+
+// postgresMigrations lists all postgres migrations in order, new migrations are added at the end with the next version
+var postgresMigrations = []PostgresMigration{
+	{Version: 1, Description: "Create the tables", Up: execAll(postgresSchema...)},
+	{Version: 2, Description: "Create the rate limit counters", Up: execAll(
+		// The counters are updated in place, so they are not stored as documents
+		"CREATE TABLE IF NOT EXISTS ratelimits (key text PRIMARY KEY, count bigint NOT NULL, expires_at timestamptz NOT NULL)",
+		postgresIndex(false, "ratelimits", "(expires_at)"),
+	)},
+	{Version: 3, Description: "Create the cache invalidations", Up: execAll(
+		"CREATE TABLE IF NOT EXISTS cacheinvalidations (id bigserial PRIMARY KEY, tags text[] NOT NULL, expires_at timestamptz NOT NULL)",
+		postgresIndex(false, "cacheinvalidations", "(expires_at)"),
+	)},
+	{Version: 4, Description: "Create the audit log", Up: execAll(
+		postgresTable("auditlog", "actor text NOT NULL", "subject text NOT NULL", "organization text NOT NULL",
+			"action text NOT NULL", "occurred_at timestamptz NOT NULL", "expires_at timestamptz NOT NULL"),
+		postgresIndex(false, "auditlog", "(actor, occurred_at)"),
+		postgresIndex(false, "auditlog", "(subject, occurred_at)"),
+		postgresIndex(false, "auditlog", "(organization, occurred_at)"),
+		postgresIndex(false, "auditlog", "(expires_at)"),
+	)},
+	{Version: 5, Description: "Create the webhooks and their deliveries", Up: execAll(
+		postgresTable("webhooks", "globalid text NOT NULL"),
+		postgresIndex(false, "webhooks", "(globalid)"),
+		postgresTable("webhookdeliveries", "webhook_id text NOT NULL", "globalid text NOT NULL", "status text NOT NULL",
+			"next_attempt timestamptz NOT NULL", "expires_at timestamptz NOT NULL"),
+		postgresIndex(false, "webhookdeliveries", "(status, next_attempt)"),
+		postgresIndex(false, "webhookdeliveries", "(webhook_id)"),
+		postgresIndex(false, "webhookdeliveries", "(globalid)"),
+		postgresIndex(false, "webhookdeliveries", "(expires_at)"),
+	)},
+	{Version: 6, Description: "Create the job leases and runs", Up: execAll(
+		// The leases are updated in place, so they are not stored as documents
+		"CREATE TABLE IF NOT EXISTS jobleases (name text PRIMARY KEY, owner text NOT NULL, expires_at timestamptz NOT NULL)",
+		postgresTable("jobruns", "job text NOT NULL", "started_at timestamptz NOT NULL", "expires_at timestamptz NOT NULL"),
+		postgresIndex(false, "jobruns", "(job, started_at)"),
+		postgresIndex(false, "jobruns", "(started_at)"),
+		postgresIndex(false, "jobruns", "(expires_at)"),
+		// The avatar files that were stored before have no creation time
+		"ALTER TABLE avatarfiles ADD COLUMN IF NOT EXISTS created_at timestamptz",
+		postgresIndex(false, "avatarfiles", "(created_at)"),
+	)},
+	{Version: 7, Description: "Create the email outbox", Up: execAll(
+		postgresTable("emailoutbox", "status text NOT NULL", "next_attempt timestamptz NOT NULL", "expires_at timestamptz NOT NULL"),
+		postgresIndex(false, "emailoutbox", "(status, next_attempt)"),
+		postgresIndex(false, "emailoutbox", "(expires_at)"),
+	)},
+	{Version: 8, Description: "Make the linked accounts unique", Up: execAll(
+		// An array can not have a unique index, a trigger keeps the linked accounts of the users in a table with a primary key
+		// so linking an account that belongs to another user violates it in the transaction of the update
+		"CREATE TABLE IF NOT EXISTS userlinkedaccounts (key text PRIMARY KEY, user_id text NOT NULL REFERENCES users (id) ON DELETE CASCADE)",
+		postgresIndex(false, "userlinkedaccounts", "(user_id)"),
+		`CREATE OR REPLACE FUNCTION users_linkedaccounts() RETURNS trigger AS $$
+		BEGIN
+			DELETE FROM userlinkedaccounts WHERE user_id = NEW.id;
+			INSERT INTO userlinkedaccounts (key, user_id) SELECT DISTINCT unnest(NEW.linkedaccounts), NEW.id;
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS users_linkedaccounts ON users",
+		"CREATE TRIGGER users_linkedaccounts AFTER INSERT OR UPDATE OF linkedaccounts ON users FOR EACH ROW EXECUTE PROCEDURE users_linkedaccounts()",
+		// Fails if an account is already linked to several users, they have to be unlinked first
+		"INSERT INTO userlinkedaccounts (key, user_id) SELECT DISTINCT unnest(linkedaccounts), id FROM users",
+	)},
+	{Version: 9, Description: "Index the persistent logs by user", Up: execAll(
+		// The logs that were stored before are not linked to a user
+		"ALTER TABLE persistentlogs ADD COLUMN IF NOT EXISTS username text NOT NULL DEFAULT ''",
+		postgresIndex(false, "persistentlogs", "(username)"),
+	)},
+	{Version: 10, Description: "Claim the pending data exports", Up: execAll(
+		// The exports that were stored before are not claimed, they are shown as failed once they are pending for too long
+		"ALTER TABLE dataexports ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT ''",
+		"ALTER TABLE dataexports ADD COLUMN IF NOT EXISTS claimed_until timestamptz NOT NULL DEFAULT '-infinity'",
+		postgresIndex(false, "dataexports", "(status, claimed_until)"),
+	)},
+}
+
+// postgresTable returns the statement creating a table with the columns every PostgresCollection has,
+// the document itself and the extra columns used to query it
+func postgresTable(name string, columns ...string) string {
+	columns = append([]string{"id text PRIMARY KEY", "seq bigserial NOT NULL", "document bytea NOT NULL"}, columns...)
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", name, strings.Join(columns, ", "))
+}
+
+// postgresIndex returns the statement creating an index, the name is derived from the table and the indexed columns
+func postgresIndex(unique bool, table, definition string) string {
+	columns := definition[strings.Index(definition, "(")+1 : strings.Index(definition, ")")]
+	name := table + "_" + strings.Replace(strings.Replace(columns, " ", "", -1), ",", "_", -1)
+	uniqueKeyword := ""
+	if unique {
+		uniqueKeyword = "UNIQUE "
+		name += "_key"
+	} else {
+		name += "_idx"
+	}
+	return fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s %s", uniqueKeyword, name, table, definition)
+}
+
+// postgresSchema are the tables and indices matching the mongo collections and their indices,
+// the expires_at columns replace the TTL indices and are cleaned up by the expiry sweeper of the backend
+var postgresSchema = []string{
+	postgresTable("users", "username text NOT NULL", "emailaddresses text[] NOT NULL", "linkedaccounts text[] NOT NULL",
+		"deletionscheduled timestamptz", "expires_at timestamptz"),
+	postgresIndex(true, "users", "(username)"),
+	postgresIndex(false, "users", "USING gin (emailaddresses)"),
+	postgresIndex(false, "users", "USING gin (linkedaccounts)"),
+	postgresIndex(false, "users", "(expires_at)"),
+	postgresTable("authorizations", "username text NOT NULL", "grantedto text NOT NULL"),
+	postgresIndex(false, "authorizations", "(username)"),
+	postgresIndex(false, "authorizations", "(grantedto)"),
+	postgresTable("avatarfiles", "hash text NOT NULL"),
+	postgresIndex(true, "avatarfiles", "(hash)"),
+	postgresTable("apikeys", "username text NOT NULL", "label text NOT NULL", "applicationid text NOT NULL"),
+	postgresIndex(false, "apikeys", "(username)"),
+	postgresIndex(false, "apikeys", "(applicationid)"),
+
+	postgresTable("passwords", "username text NOT NULL"),
+	postgresIndex(true, "passwords", "(username)"),
+	postgresTable("passwordresettokens", "username text NOT NULL", "token text NOT NULL", "expires_at timestamptz NOT NULL"),
+	postgresIndex(true, "passwordresettokens", "(username, token)"),
+	postgresIndex(false, "passwordresettokens", "(token)"),
+	postgresIndex(false, "passwordresettokens", "(expires_at)"),
+	postgresTable("totp", "username text NOT NULL"),
+	postgresIndex(true, "totp", "(username)"),
+
+	postgresTable("registrationsinprogress", "sessionkey text NOT NULL", "expires_at timestamptz NOT NULL"),
+	postgresIndex(true, "registrationsinprogress", "(sessionkey)"),
+	postgresIndex(false, "registrationsinprogress", "(expires_at)"),
+	postgresTable("dataexports", "username text NOT NULL", "expires_at timestamptz NOT NULL"),
+	postgresIndex(false, "dataexports", "(username)"),
+	postgresIndex(false, "dataexports", "(expires_at)"),
+
+	postgresTable("organizations", "globalid text NOT NULL", "owners text[] NOT NULL", "members text[] NOT NULL",
+		"orgowners text[] NOT NULL", "orgmembers text[] NOT NULL"),
+	postgresIndex(true, "organizations", "(globalid)"),
+	postgresIndex(false, "organizations", "USING gin (owners)"),
+	postgresIndex(false, "organizations", "USING gin (members)"),
+	postgresIndex(false, "organizations", "USING gin (orgowners)"),
+	postgresIndex(false, "organizations", "USING gin (orgmembers)"),
+	postgresTable("organizationlogos", "globalid text NOT NULL"),
+	postgresIndex(true, "organizationlogos", "(globalid)"),
+	postgresTable("last2falogins", "globalid text NOT NULL", "username text NOT NULL", "expires_at timestamptz NOT NULL"),
+	postgresIndex(true, "last2falogins", "(globalid, username)"),
+	postgresIndex(false, "last2falogins", "(expires_at)"),
+	postgresTable("organizationdescriptions", "globalid text NOT NULL"),
+	postgresIndex(true, "organizationdescriptions", "(globalid)"),
+	postgresTable("companies", "globalid text NOT NULL"),
+	postgresIndex(true, "companies", "(globalid)"),
+	postgresTable("joinorganizationinvitations", "organization text NOT NULL", "role text NOT NULL", "username text NOT NULL",
+		"status text NOT NULL", "emailaddress text NOT NULL", "phonenumber text NOT NULL", "code text NOT NULL"),
+	postgresIndex(false, "joinorganizationinvitations", "(organization)"),
+	postgresIndex(false, "joinorganizationinvitations", "(username)"),
+	postgresIndex(false, "joinorganizationinvitations", "(code)"),
+
+	postgresTable("ongoingphonenumbervalidations", "key text NOT NULL", "username text NOT NULL", "phonenumber text NOT NULL",
+		"expires_at timestamptz NOT NULL"),
+	postgresIndex(true, "ongoingphonenumbervalidations", "(key)"),
+	postgresIndex(false, "ongoingphonenumbervalidations", "(expires_at)"),
+	postgresTable("ongoingemailaddressvalidations", "key text NOT NULL", "username text NOT NULL", "emailaddress text NOT NULL",
+		"expires_at timestamptz NOT NULL"),
+	postgresIndex(true, "ongoingemailaddressvalidations", "(key)"),
+	postgresIndex(false, "ongoingemailaddressvalidations", "(expires_at)"),
+	postgresTable("validatedphonenumbers", "username text NOT NULL", "phonenumber text NOT NULL"),
+	postgresIndex(true, "validatedphonenumbers", "(username, phonenumber)"),
+	postgresIndex(true, "validatedphonenumbers", "(phonenumber)"),
+	postgresTable("validatedemailaddresses", "username text NOT NULL", "emailaddress text NOT NULL"),
+	postgresIndex(true, "validatedemailaddresses", "(username, emailaddress)"),
+	postgresIndex(true, "validatedemailaddresses", "(emailaddress)"),
+
+	postgresTable("oauth_authorizationrequests", "authorizationcode text NOT NULL", "username text NOT NULL",
+		"expires_at timestamptz NOT NULL"),
+	postgresIndex(true, "oauth_authorizationrequests", "(authorizationcode)"),
+	postgresIndex(false, "oauth_authorizationrequests", "(expires_at)"),
+	postgresTable("oauth_accesstokens", "accesstoken text NOT NULL", "username text NOT NULL", "globalid text NOT NULL",
+		"clientid text NOT NULL", "expires_at timestamptz NOT NULL"),
+	postgresIndex(true, "oauth_accesstokens", "(accesstoken)"),
+	postgresIndex(false, "oauth_accesstokens", "(username)"),
+	postgresIndex(false, "oauth_accesstokens", "(globalid)"),
+	postgresIndex(false, "oauth_accesstokens", "(expires_at)"),
+	postgresTable("oauth_refreshtokens", "refreshtoken text NOT NULL", "subject text NOT NULL", "expires_at timestamptz NOT NULL"),
+	postgresIndex(true, "oauth_refreshtokens", "(refreshtoken)"),
+	postgresIndex(false, "oauth_refreshtokens", "(subject)"),
+	postgresIndex(false, "oauth_refreshtokens", "(expires_at)"),
+	postgresTable("oauth_clients", "clientid text NOT NULL", "label text NOT NULL"),
+	postgresIndex(true, "oauth_clients", "(clientid, label)"),
+	postgresTable("loginsessions", "sessionkey text NOT NULL", "expires_at timestamptz NOT NULL"),
+	postgresIndex(true, "loginsessions", "(sessionkey)"),
+	postgresIndex(false, "loginsessions", "(expires_at)"),
+	postgresTable("loginmagiclinks", "key text NOT NULL", "expires_at timestamptz NOT NULL"),
+	postgresIndex(true, "loginmagiclinks", "(key)"),
+	postgresIndex(false, "loginmagiclinks", "(expires_at)"),
+
+	postgresTable("see", "username text NOT NULL", "globalid text NOT NULL", "uniqueid text NOT NULL", "latestversion timestamptz"),
+	postgresIndex(true, "see", "(username, globalid, uniqueid)"),
+	postgresTable("iyoids", "username text NOT NULL", "azp text NOT NULL", "iyoids text[] NOT NULL"),
+	postgresIndex(true, "iyoids", "(username, azp)"),
+	postgresIndex(false, "iyoids", "USING gin (iyoids)"),
+	postgresTable("grants", "username text NOT NULL", "globalid text NOT NULL", "grants text[] NOT NULL"),
+	postgresIndex(true, "grants", "(username, globalid)"),
+	postgresIndex(false, "grants", "USING gin (grants)"),
+	postgresTable("contracts", "contractid text NOT NULL", "partytypes text[] NOT NULL", "partynames text[] NOT NULL",
+		"expires timestamptz"),
+	postgresIndex(true, "contracts", "(contractid)"),
+	postgresIndex(false, "contracts", "USING gin (partynames)"),
+	postgresTable("registry", "username text NOT NULL", "globalid text NOT NULL"),
+	postgresIndex(true, "registry", "(username) WHERE username <> ''"),
+	postgresIndex(true, "registry", "(globalid) WHERE globalid <> ''"),
+	postgresTable("keystore", "username text NOT NULL", "globalid text NOT NULL", "label text NOT NULL"),
+	postgresIndex(true, "keystore", "(label, username, globalid)"),
+	postgresTable("persistentlogs", "key text NOT NULL"),
+	postgresIndex(false, "persistentlogs", "(key)"),
+	postgresTable("smshistory", "phonenumber text NOT NULL", "createdat timestamptz NOT NULL"),
+	postgresIndex(false, "smshistory", "(phonenumber)"),
+	postgresIndex(false, "smshistory", "(createdat)"),
+	postgresTable("globalconfig", "key text NOT NULL"),
+	postgresIndex(true, "globalconfig", "(key)"),
+}
+
+// execAll returns a migration executing the statements in order
+func execAll(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("%s: %s", statement, err)
+			}
+		}
+		return nil
+	}
+}
+
+// RunFor applies the pending migrations of the database backing a request
+func RunFor(r *http.Request) error {
+	if pg := db.GetPostgres(r); pg != nil {
+		return RunPostgres(pg)
+	}
+	return Run(db.GetDBSession(r))
+}
+
+// GetStatusFor lists the migrations of the database backing a request
+func GetStatusFor(r *http.Request) ([]Status, error) {
+	if pg := db.GetPostgres(r); pg != nil {
+		return GetPostgresStatus(pg)
+	}
+	return GetStatus(db.GetDBSession(r))
+}
+
+// RunPostgres applies the pending postgres migrations, it waits until no other instance is applying migrations.
+// Every migration is applied and recorded in a single transaction.
+func RunPostgres(pg *sql.DB) (err error) {
+	// The advisory lock is released when the transaction ends, also when this instance stops while migrating
+	conn, err := pg.Begin()
+	if err != nil {
+		return
+	}
+	defer conn.Rollback()
+	log.Debug("Waiting for the migration lock")
+	if _, err = conn.Exec("SELECT pg_advisory_xact_lock($1)", postgresLockKey); err != nil {
+		return
+	}
+	if err = createPostgresMigrationsTable(conn); err != nil {
+		return
+	}
+	applied, err := getPostgresApplied(conn)
+	if err != nil {
+		return
+	}
+	for _, migration := range postgresMigrations {
+		if _, done := applied[migration.Version]; done {
+			continue
+		}
+		log.Infof("Applying migration %d: %s", migration.Version, migration.Description)
+		if err = migration.Up(conn); err != nil {
+			return fmt.Errorf("Migration %d failed: %s", migration.Version, err)
+		}
+		_, err = conn.Exec("INSERT INTO "+postgresMigrationsTableName+" (version, description, appliedat) VALUES ($1, $2, $3)",
+			migration.Version, migration.Description, time.Now())
+		if err != nil {
+			return
+		}
+	}
+	return conn.Commit()
+}
+
+// GetPostgresStatus lists all postgres migrations and when they were applied
+func GetPostgresStatus(pg *sql.DB) (status []Status, err error) {
+	tx, err := pg.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if err = createPostgresMigrationsTable(tx); err != nil {
+		return
+	}
+	applied, err := getPostgresApplied(tx)
+	if err != nil {
+		return
+	}
+	for _, migration := range postgresMigrations {
+		s := Status{Version: migration.Version, Description: migration.Description}
+		if appliedAt, done := applied[migration.Version]; done {
+			s.AppliedAt = &appliedAt
+		}
+		status = append(status, s)
+	}
+	return
+}
+
+func createPostgresMigrationsTable(tx *sql.Tx) error {
+	_, err := tx.Exec("CREATE TABLE IF NOT EXISTS " + postgresMigrationsTableName +
+		" (version integer PRIMARY KEY, description text NOT NULL, appliedat timestamptz NOT NULL)")
+	return err
+}
+
+func getPostgresApplied(tx *sql.Tx) (applied map[int]time.Time, err error) {
+	rows, err := tx.Query("SELECT version, appliedat FROM " + postgresMigrationsTableName)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	applied = make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return
+		}
+		applied[version] = appliedAt
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,17 @@
+package migrations
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// expireRateLimits removes the rate limit counters once their window ended
+func expireRateLimits(session *mgo.Session) error {
+	return ensureIndices(session, "ratelimits",
+		mgo.Index{
+			Key:         []string{"expiresat"},
+			ExpireAfter: time.Second, // Remove once the window ended, mongo ignores an expiration of 0
+		},
+	)
+}
@@ -0,0 +1,16 @@
+package migrations
+
+import "gopkg.in/mgo.v2"
+
+// indexSMSHistory indexes the sms history by phone number.
+// The index is not unique since every sms sent to a phone number is stored.
+func indexSMSHistory(session *mgo.Session) error {
+	return ensureIndices(session, "smshistory",
+		mgo.Index{
+			Key: []string{"phonenumber"},
+		},
+		mgo.Index{
+			Key: []string{"createdat"},
+		},
+	)
+}
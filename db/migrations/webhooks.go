@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// indexWebhooks indexes the webhooks by organization, the outbox by the next attempt
+// and removes the deliveries from the log when they expire
+func indexWebhooks(session *mgo.Session) error {
+	if err := ensureIndices(session, "webhooks",
+		mgo.Index{
+			Key: []string{"globalid"},
+		},
+	); err != nil {
+		return err
+	}
+	return ensureIndices(session, "webhookdeliveries",
+		mgo.Index{
+			Key: []string{"status", "nextattempt"},
+		},
+		mgo.Index{
+			Key: []string{"webhookid", "-createdat"},
+		},
+		mgo.Index{
+			Key: []string{"globalid"},
+		},
+		mgo.Index{
+			Key:         []string{"expiresat"},
+			ExpireAfter: time.Second, // Remove once the delivery expired, mongo ignores an expiration of 0
+			Background:  true,
+		},
+	)
+}
@@ -37,7 +37,7 @@ func (org *Organization) IsValidSubOrganization() bool {
 }
 
 // ConvertToView converts an organization from the DB to a view served by the API
-func (org *Organization) ConvertToView(usrMgr *user.Manager, valMgr *validation.Manager) (*OrganizationView, error) {
+func (org *Organization) ConvertToView(usrMgr user.Manager, valMgr validation.Manager) (*OrganizationView, error) {
 	view := &OrganizationView{}
 	view.DNS = org.DNS
 	view.Globalid = org.Globalid
@@ -59,7 +59,7 @@ func (org *Organization) ConvertToView(usrMgr *user.Manager, valMgr *validation.
 }
 
 // ConvertUsernamesToIdentifiers converts a list of usernames to a list of user identifiers
-func ConvertUsernamesToIdentifiers(usernames []string, valMgr *validation.Manager) ([]string, error) {
+func ConvertUsernamesToIdentifiers(usernames []string, valMgr validation.Manager) ([]string, error) {
 	identifiers := []string{}
 	checkedUsers := map[string]bool{}
 	for _, u := range usernames {
@@ -95,7 +95,7 @@ func ConvertUsernamesToIdentifiers(usernames []string, valMgr *validation.Manage
 }
 
 // MapUsernamesToIdentifiers returns a map with as key the validated information (identifier) and as value the username
-func MapUsernamesToIdentifiers(usernames []string, valMgr *validation.Manager) (map[string]string, error) {
+func MapUsernamesToIdentifiers(usernames []string, valMgr validation.Manager) (map[string]string, error) {
 	identifiers := map[string]string{}
 	emails, err := valMgr.GetValidatedEmailAddressesByUsernames(usernames)
 	if err != nil {
@@ -116,7 +116,7 @@ func MapUsernamesToIdentifiers(usernames []string, valMgr *validation.Manager) (
 
 // ConvertUsernameToIdentifier converts a username into an identifier. It tries validated email addresses first. If
 // there are none, attempt to use validated phone numbers. If the user also doesn't have any of those, keep the username
-func ConvertUsernameToIdentifier(username string, usrMgr *user.Manager, valMgr *validation.Manager) (string, error) {
+func ConvertUsernameToIdentifier(username string, usrMgr user.Manager, valMgr validation.Manager) (string, error) {
 	userIdentifier := username
 	usr, err := usrMgr.GetByName(username)
 	if err != nil {
@@ -147,7 +147,7 @@ func ConvertUsernameToIdentifier(username string, usrMgr *user.Manager, valMgr *
 }
 
 // ConvertIdentifierToUsername converts an identifier to a username.
-func ConvertIdentifierToUsername(identifier string, valMgr *validation.Manager) (string, error) {
+func ConvertIdentifierToUsername(identifier string, valMgr validation.Manager) (string, error) {
 	email, err := valMgr.GetByEmailAddress(identifier)
 	if err == nil {
 		return email.Username, err
@@ -0,0 +1,131 @@
+package organization
+
+import (
+	"net/http"
+
+	"github.com/itsyouonline/identityserver/cache"
+	"github.com/itsyouonline/identityserver/db/invalidation"
+)
+
+// membershipCache caches the ownership and membership checks. A change of one organization can change
+// the inherited relations of many others, so every change invalidates the complete cache.
+var membershipCache = cache.New(membershipTag)
+
+const membershipTag = "membership"
+
+//invalidatingManager invalidates the cached ownership and membership checks when the relations change
+type invalidatingManager struct {
+	Manager
+	r *http.Request
+}
+
+//invalidate invalidates the cache if a change succeeded and returns its error
+func (m invalidatingManager) invalidate(err error) error {
+	if err == nil {
+		invalidation.Invalidate(m.r, membershipTag)
+	}
+	return err
+}
+
+func (m invalidatingManager) Create(organization *Organization) error {
+	return m.invalidate(m.Manager.Create(organization))
+}
+
+func (m invalidatingManager) SaveMember(organization *Organization, username string) error {
+	return m.invalidate(m.Manager.SaveMember(organization, username))
+}
+
+func (m invalidatingManager) RemoveMember(organization *Organization, username string) error {
+	return m.invalidate(m.Manager.RemoveMember(organization, username))
+}
+
+func (m invalidatingManager) SaveOwner(organization *Organization, owner string) error {
+	return m.invalidate(m.Manager.SaveOwner(organization, owner))
+}
+
+func (m invalidatingManager) RemoveOwner(organization *Organization, owner string) error {
+	return m.invalidate(m.Manager.RemoveOwner(organization, owner))
+}
+
+func (m invalidatingManager) SaveOrgMember(organization *Organization, organizationID string) error {
+	return m.invalidate(m.Manager.SaveOrgMember(organization, organizationID))
+}
+
+func (m invalidatingManager) RemoveOrgMember(organization *Organization, organizationID string) error {
+	return m.invalidate(m.Manager.RemoveOrgMember(organization, organizationID))
+}
+
+func (m invalidatingManager) SaveOrgOwner(organization *Organization, organizationID string) error {
+	return m.invalidate(m.Manager.SaveOrgOwner(organization, organizationID))
+}
+
+func (m invalidatingManager) RemoveOrgOwner(organization *Organization, organizationID string) error {
+	return m.invalidate(m.Manager.RemoveOrgOwner(organization, organizationID))
+}
+
+func (m invalidatingManager) AddIncludeSubOrgOf(globalID, orgMemberID string) error {
+	return m.invalidate(m.Manager.AddIncludeSubOrgOf(globalID, orgMemberID))
+}
+
+func (m invalidatingManager) RemoveIncludeSubOrgOf(globalID, orgMemberID string) error {
+	return m.invalidate(m.Manager.RemoveIncludeSubOrgOf(globalID, orgMemberID))
+}
+
+func (m invalidatingManager) Remove(globalid string) error {
+	return m.invalidate(m.Manager.Remove(globalid))
+}
+
+func (m invalidatingManager) UpdateMembership(globalid string, username string, oldrole string, newrole string) error {
+	return m.invalidate(m.Manager.UpdateMembership(globalid, username, oldrole, newrole))
+}
+
+func (m invalidatingManager) UpdateOrgMembership(globalid string, organization string, oldrole string, newrole string) error {
+	return m.invalidate(m.Manager.UpdateOrgMembership(globalid, organization, oldrole, newrole))
+}
+
+func (m invalidatingManager) RemoveUser(globalID string, username string) error {
+	return m.invalidate(m.Manager.RemoveUser(globalID, username))
+}
+
+func (m invalidatingManager) RemoveUserFromAll(username string) error {
+	return m.invalidate(m.Manager.RemoveUserFromAll(username))
+}
+
+func (m invalidatingManager) RemoveOrganization(globalID string, organization string) error {
+	return m.invalidate(m.Manager.RemoveOrganization(globalID, organization))
+}
+
+//cachedManager looks up the ownership and membership checks in the cache first
+type cachedManager struct {
+	Manager
+}
+
+//NewCachedManager creates a Manager that caches IsOwner and IsMember for a short time.
+// Changed relations are invalidated right away, so it can be used to authorize the api requests.
+func NewCachedManager(r *http.Request) Manager {
+	return cachedManager{Manager: NewManager(r)}
+}
+
+//IsOwner checks if a user is an owner of an organization, directly or inherited
+func (m cachedManager) IsOwner(globalID, username string) (bool, error) {
+	return m.cached("owner", globalID, username, m.Manager.IsOwner)
+}
+
+//IsMember checks if a user is a member of an organization, directly or inherited
+func (m cachedManager) IsMember(globalID, username string) (bool, error) {
+	return m.cached("member", globalID, username, m.Manager.IsMember)
+}
+
+func (m cachedManager) cached(relation, globalID, username string, check func(globalID, username string) (bool, error)) (bool, error) {
+	key := relation + "\xff" + globalID + "\xff" + username
+	if result, found := membershipCache.Get(key); found {
+		return result.(bool), nil
+	}
+	generation := membershipCache.Generation()
+	result, err := check(globalID, username)
+	if err != nil {
+		return false, err
+	}
+	membershipCache.Set(key, result, generation, 0)
+	return result, nil
+}
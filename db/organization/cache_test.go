@@ -0,0 +1,29 @@
+package organization
+
+import (
+	"testing"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedManager(t *testing.T) {
+	r, release, err := db.NewBackgroundRequest(db.NewMemoryBackend(), "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	m := NewCachedManager(r)
+	assert.NoError(t, m.Create(&Organization{Globalid: "cached", Members: []string{"bob"}}))
+
+	isMember, err := m.IsMember("cached", "bob")
+	assert.NoError(t, err)
+	assert.True(t, isMember)
+
+	org, err := m.GetByName("cached")
+	assert.NoError(t, err)
+	assert.NoError(t, m.RemoveMember(org, "bob"))
+	isMember, err = m.IsMember("cached", "bob")
+	assert.NoError(t, err)
+	assert.False(t, isMember, "removing a member invalidates the cached membership")
+}
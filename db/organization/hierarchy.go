@@ -0,0 +1,536 @@
+package organization
+
+import (
+	"strings"
+	"sync"
+
+	"gopkg.in/mgo.v2"
+)
+
+// relationStore looks up the direct relations between users and organizations,
+// the hierarchy resolves the inherited ones on top of it
+type relationStore interface {
+	Exists(globalID string) bool
+	isDirectOwner(globalID, username string) (bool, error)
+	isDirectMember(globalID, username string) (bool, error)
+	isDirectOwnerOfOrgs(globalIDs []string, username string) ([]string, error)
+	// getRelations returns the organization with at least its orgowners, orgmembers and includesuborgsof
+	getRelations(globalID string) (Organization, error)
+	GetSubOrganizations(globalID string) ([]Organization, error)
+	GetSubOrganizationsMultiple(globalIDs []string) ([]Organization, error)
+	AllByUser(username string) ([]Organization, error)
+	AllByOrg(globalID string) ([]Organization, error)
+	AllByOrgs(globalIDs []string) ([]Organization, error)
+}
+
+// hierarchy resolves ownership and membership through parent organizations and owning or member organizations,
+// it is shared by the storage backends
+type hierarchy struct {
+	store relationStore
+}
+
+// IsInOrgs checks if a user is somehow in the provided orgs
+// returns a list of all the orgs where the user is an owner or member
+func (m hierarchy) IsInOrgs(username string, globalIDs ...string) ([]string, error) {
+	var wg sync.WaitGroup
+	passed := make([]bool, len(globalIDs))
+	errors := make([]error, len(globalIDs))
+	for i, globalID := range globalIDs {
+		wg.Add(1)
+		go func(index int, gID string) {
+			defer wg.Done()
+			passed[index], errors[index] = m.isOwnerOrMember(gID, username, make(map[string]bool))
+		}(i, globalID)
+	}
+	// Wait untill we are done
+	wg.Wait()
+	// Report if there was any error
+	for _, err := range errors {
+		if err != nil {
+			return nil, err
+		}
+	}
+	var result []string
+	for i, p := range passed {
+		if p {
+			result = append(result, globalIDs[i])
+		}
+	}
+	return result, nil
+}
+
+func (m hierarchy) isOwnerOrMember(globalID, username string, excludelist map[string]bool) (result bool, err error) {
+	result, err = m.store.isDirectOwner(globalID, username)
+	if result || err != nil {
+		return
+	}
+	result, err = m.store.isDirectMember(globalID, username)
+	if result || err != nil {
+		return
+	}
+	// If not a direct owner or member, iterate through the list of owner/member organizations
+	org, err := m.store.getRelations(globalID)
+	if err != nil {
+		return
+	}
+	excludelist[globalID] = true
+	// Add the suborganizations from the includelist
+	var includesuborgs []string
+	for _, owner := range append(org.OrgOwners, org.OrgMembers...) {
+		for _, include := range org.IncludeSubOrgsOf {
+			if owner == include {
+				includesuborgs = append(includesuborgs, include)
+			}
+		}
+	}
+	var subOrgs []Organization
+	for _, subOrg := range includesuborgs {
+		subOrganizations, err := m.store.GetSubOrganizations(subOrg)
+		if err != nil && err != mgo.ErrNotFound {
+			return false, err
+		}
+		subOrgs = append(subOrgs, subOrganizations...)
+	}
+	var orgs []string
+	for _, suborganization := range subOrgs {
+		orgs = append(orgs, suborganization.Globalid)
+	}
+	orgs = append(orgs, org.OrgMembers...)
+
+	for _, owningOrganization := range append(org.OrgOwners, orgs...) {
+		if _, excluded := excludelist[owningOrganization]; excluded {
+			continue
+		}
+		result, err = m.isOwnerOrMember(owningOrganization, username, excludelist)
+		if result || err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//IsOwner checks if a specific user is in the owners list of an organization
+// or belongs to an organization that is in the owner list
+// It also checks this for the parentorganizations
+func (m hierarchy) IsOwner(globalID, username string) (isowner bool, err error) {
+	if !m.store.Exists(globalID) {
+		return
+	}
+	isowner, err = m.store.isDirectOwner(globalID, username)
+	if isowner || err != nil {
+		return
+	}
+	// If not a direct owner, check the ownership in the parent organization
+	lastSubOrgSeparator := strings.LastIndex(globalID, ".")
+	if lastSubOrgSeparator > 0 {
+		isowner, err = m.IsOwner(globalID[:lastSubOrgSeparator], username)
+		if isowner || err != nil {
+			return
+		}
+	}
+	// If not a direct or inherited owner, iterate through the list of owning organizations
+	org, err := m.store.getRelations(globalID)
+	if err != nil {
+		if mgo.ErrNotFound == err {
+			err = nil
+		}
+		return
+	}
+	excludelist := make(map[string]bool)
+	excludelist[globalID] = true
+
+	// Also get the suborganizations if they have been added
+	var includesuborgs []string
+	for _, owner := range org.OrgOwners {
+		for _, include := range org.IncludeSubOrgsOf {
+			if owner == include {
+				includesuborgs = append(includesuborgs, include)
+			}
+		}
+	}
+	var subOrgs []Organization
+	for _, subOrg := range includesuborgs {
+		subOrganizations, err := m.store.GetSubOrganizations(subOrg)
+		if err != nil && err != mgo.ErrNotFound {
+			return false, err
+		}
+		subOrgs = append(subOrgs, subOrganizations...)
+	}
+	var orgs []string
+	for _, suborganization := range subOrgs {
+		orgs = append(orgs, suborganization.Globalid)
+	}
+
+	for _, owningOrganization := range append(orgs, org.OrgOwners...) {
+		isowner, err = m.isOwnerOrMember(owningOrganization, username, excludelist)
+		if isowner || err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// SplitOwnedOrgs removes the organizations of which the user is an owner from the input lists and moves them
+// into a separate list which is returned
+func (m hierarchy) SplitOwnedOrgs(globalIDs []string, username string) (ownedOrgs []string, memberOrgs []string, err error) {
+
+	// Backward loops here are so we can slice out the element in the globalIDs list without
+	// affecting the remainder of the elements
+
+	if len(globalIDs) == 0 {
+		return []string{}, []string{}, nil
+	}
+	// Find all orgs where we are a direct owner
+	ownedOrgs, err = m.store.isDirectOwnerOfOrgs(globalIDs, username)
+	if err != nil {
+		return
+	}
+
+	// Remove all orgs we already know to be owned by this user
+	for _, ownedOrg := range ownedOrgs {
+		for i := len(globalIDs) - 1; i >= 0; i-- {
+			if ownedOrg == globalIDs[i] {
+				globalIDs = append(globalIDs[:i], globalIDs[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// Now check all parent orgs
+	// TODO: sort and optimize this loop by manually iterating
+	parentOrgs := []string{}
+	for _, globalID := range globalIDs {
+		parents := findParentOrgs(globalID)
+		for _, parent := range parents {
+			alreadyKnown := false
+			for _, knownParent := range parentOrgs {
+				if parent == knownParent {
+					alreadyKnown = true
+					break
+				}
+			}
+			if !alreadyKnown {
+				parentOrgs = append(parentOrgs, parent)
+			}
+		}
+	}
+
+	ownedParentOrgs, parentOrgs, err := m.SplitOwnedOrgs(parentOrgs, username)
+	if err != nil {
+		return
+	}
+
+	for _, ownedParent := range ownedParentOrgs {
+		for i := len(globalIDs) - 1; i >= 0; i-- {
+			if strings.HasPrefix(globalIDs[i], ownedParent+".") {
+				ownedOrgs = append(ownedOrgs, globalIDs[i])
+				globalIDs = append(globalIDs[:i], globalIDs[i+1:]...)
+			}
+		}
+	}
+
+	// If not a direct or inherited owner, iterate through the list of owning organizations
+	// TODO: this can be fixed with a map imo, so we can keep the amount of db calls to a minimum
+	for i := len(globalIDs) - 1; i >= 0; i-- {
+		var owned bool
+		owned, err = m.orgIsOwned(globalIDs[i], username)
+		if err != nil {
+			return
+		}
+		if owned {
+			ownedOrgs = append(ownedOrgs, globalIDs[i])
+			globalIDs = append(globalIDs[:i], globalIDs[i+1:]...)
+		}
+	}
+	memberOrgs = globalIDs
+
+	return
+}
+
+// orgIsOwned checks if an organization is owned through organization ownership inclusion
+func (m hierarchy) orgIsOwned(globalID, username string) (isowner bool, err error) {
+	org, err := m.store.getRelations(globalID)
+	if err != nil {
+		if mgo.ErrNotFound == err {
+			err = nil
+		}
+		return
+	}
+	excludelist := make(map[string]bool)
+	excludelist[globalID] = true
+
+	// Also get the suborganizations if they have been added
+	var includesuborgs []string
+	for _, owner := range org.OrgOwners {
+		for _, include := range org.IncludeSubOrgsOf {
+			if owner == include {
+				includesuborgs = append(includesuborgs, include)
+			}
+		}
+	}
+	var subOrgs []Organization
+	for _, subOrg := range includesuborgs {
+		subOrganizations, err := m.store.GetSubOrganizations(subOrg)
+		if err != nil && err != mgo.ErrNotFound {
+			return false, err
+		}
+		subOrgs = append(subOrgs, subOrganizations...)
+	}
+	var orgs []string
+	for _, suborganization := range subOrgs {
+		orgs = append(orgs, suborganization.Globalid)
+	}
+
+	for _, owningOrganization := range append(orgs, org.OrgOwners...) {
+		isowner, err = m.isOwnerOrMember(owningOrganization, username, excludelist)
+		if isowner || err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//IsMember checks if a specific user is in the members list of an organization
+// or belongs to an organization that is in the member list
+// it also checks this for the parentorganization
+func (m hierarchy) IsMember(globalID, username string) (result bool, err error) {
+	if !m.store.Exists(globalID) {
+		return
+	}
+	result, err = m.store.isDirectMember(globalID, username)
+	if result || err != nil {
+		return
+	}
+	// If not a direct member, check the membership in the parent organization
+	lastSubOrgSeperator := strings.LastIndex(globalID, ".")
+	if lastSubOrgSeperator > 0 {
+		result, err = m.IsMember(globalID[:lastSubOrgSeperator], username)
+		if result || err != nil {
+			return
+		}
+	}
+	// If not a direct or inherited member, iterate through the list of member organizations
+	org, err := m.store.getRelations(globalID)
+	if err != nil {
+		if mgo.ErrNotFound == err {
+			err = nil
+		}
+		return
+	}
+	excludelist := make(map[string]bool)
+	excludelist[globalID] = true
+
+	// Also get the suborganizations if they have been added
+	var includesuborgs []string
+	for _, member := range org.OrgMembers {
+		for _, include := range org.IncludeSubOrgsOf {
+			if member == include {
+				includesuborgs = append(includesuborgs, include)
+			}
+		}
+	}
+	var subOrgs []Organization
+	for _, subOrg := range includesuborgs {
+		subOrganizations, err := m.store.GetSubOrganizations(subOrg)
+		if err != nil && err != mgo.ErrNotFound {
+			return false, err
+		}
+		subOrgs = append(subOrgs, subOrganizations...)
+	}
+	var orgs []string
+	for _, suborganization := range subOrgs {
+		orgs = append(orgs, suborganization.Globalid)
+	}
+	for _, owningOrganization := range append(org.OrgMembers, orgs...) {
+		result, err = m.isOwnerOrMember(owningOrganization, username, excludelist)
+		if result || err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// AllByUserChain returns all organizations where the user is involved, explicitly or implicit
+func (m hierarchy) AllByUserChain(username string) ([]string, error) {
+	var ownedOrgs []string
+
+	// Get organization names where this user is an explicit owner or member
+	userOrgs, err := m.store.AllByUser(username)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			return nil, err
+		}
+		err = nil
+	}
+
+	var orgIDs []string
+	for _, org := range userOrgs {
+		orgIDs = append(orgIDs, org.Globalid)
+	}
+
+	// Now load all suborganizations to account for owner- and member-heritance
+	// var suborganizations []Organization
+	suborganizations, err := m.store.GetSubOrganizationsMultiple(orgIDs)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			return nil, err
+		}
+		err = nil
+	}
+
+	newOrgsFound := true
+	var orgs []string
+
+	var parentOrgs []string
+
+	// We only want the globalids. Also remove possible duplicates
+	for _, org := range append(userOrgs, suborganizations...) {
+		exists := false
+		for _, value := range orgs {
+			if org.Globalid == value {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			orgs = append(orgs, org.Globalid)
+		}
+	}
+
+	// Copy the elements in the slice
+	for _, org := range orgs {
+		ownedOrgs = append(ownedOrgs, org)
+	}
+
+	var orgsFoundThisIteration []string
+
+	// while we find new organizations
+	for newOrgsFound {
+
+		// Get the organizations where our currently know organizations are owners or members.
+		ownedbyorgs, err := m.store.AllByOrgs(orgs)
+		if err != nil {
+			if err != mgo.ErrNotFound {
+				return nil, err
+			}
+			err = nil
+		}
+		for _, obOrg := range ownedbyorgs {
+			alreadyFound := false
+			for _, knownOrg := range ownedOrgs {
+				if obOrg.Globalid == knownOrg {
+					alreadyFound = true
+					break
+				}
+			}
+			if !alreadyFound {
+				ownedOrgs = append(ownedOrgs, obOrg.Globalid)
+				orgs = append(orgs, obOrg.Globalid)
+				orgsFoundThisIteration = append(orgsFoundThisIteration, obOrg.Globalid)
+			}
+		}
+
+		// Now get the subOrganizations we haven't discovered yet
+		subOrgs, err := m.store.GetSubOrganizationsMultiple(orgs)
+		if err != nil {
+			if err != mgo.ErrNotFound {
+				return nil, err
+			}
+			err = nil
+		}
+		for _, subOrg := range subOrgs {
+			alreadyFound := false
+			for _, knownOrg := range ownedOrgs {
+				if subOrg.Globalid == knownOrg {
+					alreadyFound = true
+					break
+				}
+			}
+			if !alreadyFound {
+				ownedOrgs = append(ownedOrgs, subOrg.Globalid)
+				orgs = append(orgs, subOrg.Globalid)
+				orgsFoundThisIteration = append(orgsFoundThisIteration, subOrg.Globalid)
+			}
+		}
+
+		// Get parent orgs
+		for _, possibleChild := range orgs {
+			subOrgSeperator := strings.LastIndex(possibleChild, ".")
+			for subOrgSeperator > 0 {
+				alreadyFoud := false
+				for _, parentOrg := range parentOrgs {
+					if parentOrg == possibleChild[:subOrgSeperator] {
+						alreadyFoud = true
+						break
+					}
+				}
+				if !alreadyFoud {
+					for _, knownOrg := range ownedOrgs {
+						if knownOrg == possibleChild[:subOrgSeperator] {
+							alreadyFoud = true
+							break
+						}
+					}
+				}
+				if !alreadyFoud {
+					parentOrgs = append(parentOrgs, possibleChild[:subOrgSeperator])
+				}
+				subOrgSeperator = strings.LastIndex(possibleChild[:subOrgSeperator], ".")
+			}
+		}
+
+		// Get orgs where parentorgs are owner or member and parentorgs are on the includechildren list.
+		for _, parentOrg := range parentOrgs {
+			includedOrgs, err := m.store.AllByOrg(parentOrg)
+			if err != nil {
+				if err != mgo.ErrNotFound {
+					return nil, err
+				}
+				err = nil
+			}
+			for _, includedOrg := range includedOrgs {
+				alreadyFound := false
+				for _, org := range ownedOrgs {
+					if includedOrg.Globalid == org {
+						alreadyFound = true
+						break
+					}
+				}
+				if alreadyFound {
+					break
+				}
+				for _, subOrgsIncludedOf := range includedOrg.IncludeSubOrgsOf {
+					if parentOrg == subOrgsIncludedOf {
+						ownedOrgs = append(ownedOrgs, includedOrg.Globalid)
+						orgs = append(orgs, includedOrg.Globalid)
+						orgsFoundThisIteration = append(orgsFoundThisIteration, includedOrg.Globalid)
+					}
+				}
+			}
+		}
+
+		newOrgsFound = len(orgsFoundThisIteration) > 0
+
+		// Copy orgsFoundThisIteration to orgs && clear orgsFoundThisIteration
+		orgs = []string{}
+		for _, org := range orgsFoundThisIteration {
+			orgs = append(orgs, org)
+		}
+		orgsFoundThisIteration = []string{}
+	}
+
+	return ownedOrgs, nil
+}
+
+func findParentOrgs(globalID string) []string {
+	parentOrgs := []string{}
+	parts := strings.Split(globalID, ".")
+	for i := 1; i < len(parts); i++ {
+		parentOrgs = append(parentOrgs, strings.Join(parts[:i], "."))
+	}
+	return parentOrgs
+}
@@ -0,0 +1,700 @@
+package organization
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+)
+
+// last2FAValidity is the expiration of the last 2FA entries in mongo
+const last2FAValidity = 31 * 24 * time.Hour
+
+type memoryStore struct {
+	sync.Mutex
+	organizations map[string]Organization
+}
+
+//memoryManager keeps the organizations in a db.MemoryBackend
+type memoryManager struct {
+	hierarchy
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoCollectionName, func() interface{} {
+		return &memoryStore{organizations: make(map[string]Organization)}
+	}).(*memoryStore)
+	m := &memoryManager{store: store}
+	m.hierarchy = hierarchy{store: m}
+	return m
+}
+
+// find returns copies of the organizations that match, sorted on globalid
+func (m *memoryManager) find(match func(org *Organization) bool) (organizations []Organization, err error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	globalIDs := make([]string, 0, len(m.store.organizations))
+	for globalID := range m.store.organizations {
+		globalIDs = append(globalIDs, globalID)
+	}
+	sort.Strings(globalIDs)
+	for _, globalID := range globalIDs {
+		org := m.store.organizations[globalID]
+		if !match(&org) {
+			continue
+		}
+		var copied Organization
+		if err = db.CopyDocument(&copied, &org); err != nil {
+			return
+		}
+		organizations = append(organizations, copied)
+	}
+	return
+}
+
+// update applies a change to an organization, mgo.ErrNotFound is returned if it does not exist
+func (m *memoryManager) update(globalID string, change func(org *Organization)) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	org, ok := m.store.organizations[globalID]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	var updated Organization
+	if err := db.CopyDocument(&updated, &org); err != nil {
+		return err
+	}
+	change(&updated)
+	m.store.organizations[globalID] = updated
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func addToSet(list []string, value string) []string {
+	if contains(list, value) {
+		return list
+	}
+	return append(list, value)
+}
+
+func pull(list []string, value string) []string {
+	result := []string{}
+	for _, item := range list {
+		if item != value {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// roleList returns the list of users or organizations for a role, nil for an unknown role
+func roleList(org *Organization, role string) *[]string {
+	switch role {
+	case "members":
+		return &org.Members
+	case "owners":
+		return &org.Owners
+	case "orgmembers":
+		return &org.OrgMembers
+	case "orgowners":
+		return &org.OrgOwners
+	}
+	return nil
+}
+
+func (m *memoryManager) GetOrganizations(organizationIDs []string) ([]Organization, error) {
+	return m.find(func(org *Organization) bool { return contains(organizationIDs, org.Globalid) })
+}
+
+func (m *memoryManager) GetSubOrganizations(globalID string) ([]Organization, error) {
+	organizations, err := m.find(func(org *Organization) bool { return strings.HasPrefix(org.Globalid, globalID+".") })
+	if organizations == nil {
+		organizations = []Organization{}
+	}
+	return organizations, err
+}
+
+func (m *memoryManager) GetSubOrganizationsMultiple(globalIDs []string) ([]Organization, error) {
+	organizations, err := m.find(func(org *Organization) bool {
+		for _, globalID := range globalIDs {
+			if strings.HasPrefix(org.Globalid, globalID+".") {
+				return true
+			}
+		}
+		return false
+	})
+	if organizations == nil {
+		organizations = []Organization{}
+	}
+	return organizations, err
+}
+
+func (m *memoryManager) count(match func(org *Organization) bool) (int, error) {
+	organizations, err := m.find(match)
+	return len(organizations), err
+}
+
+func (m *memoryManager) isDirectOwner(globalID, username string) (bool, error) {
+	matches, err := m.count(func(org *Organization) bool { return org.Globalid == globalID && contains(org.Owners, username) })
+	return matches > 0, err
+}
+
+func (m *memoryManager) isDirectMember(globalID, username string) (bool, error) {
+	matches, err := m.count(func(org *Organization) bool { return org.Globalid == globalID && contains(org.Members, username) })
+	return matches > 0, err
+}
+
+func (m *memoryManager) isDirectOwnerOfOrgs(globalIDs []string, username string) ([]string, error) {
+	organizations, err := m.find(func(org *Organization) bool {
+		return contains(globalIDs, org.Globalid) && contains(org.Owners, username)
+	})
+	ownedOrgs := make([]string, len(organizations))
+	for i, org := range organizations {
+		ownedOrgs[i] = org.Globalid
+	}
+	return ownedOrgs, err
+}
+
+func (m *memoryManager) getRelations(globalID string) (Organization, error) {
+	org, err := m.GetByName(globalID)
+	if err != nil {
+		return Organization{}, err
+	}
+	return *org, nil
+}
+
+func (m *memoryManager) OrganizationIsOwner(globalID, organization string) (bool, error) {
+	matches, err := m.count(func(org *Organization) bool { return org.Globalid == globalID && contains(org.OrgOwners, organization) })
+	return matches > 0, err
+}
+
+func (m *memoryManager) OrganizationIsMember(globalID, organization string) (bool, error) {
+	matches, err := m.count(func(org *Organization) bool { return org.Globalid == globalID && contains(org.OrgMembers, organization) })
+	return matches > 0, err
+}
+
+func (m *memoryManager) OrganizationIsPartOf(globalID, organization string) (bool, error) {
+	matches, err := m.count(func(org *Organization) bool {
+		return org.Globalid == globalID && (contains(org.OrgMembers, organization) || contains(org.OrgOwners, organization))
+	})
+	return matches == 1, err
+}
+
+func (m *memoryManager) AllByUser(username string) ([]Organization, error) {
+	return m.find(func(org *Organization) bool { return contains(org.Members, username) || contains(org.Owners, username) })
+}
+
+func (m *memoryManager) AllByOrg(globalID string) ([]Organization, error) {
+	return m.find(func(org *Organization) bool { return contains(org.OrgMembers, globalID) || contains(org.OrgOwners, globalID) })
+}
+
+func (m *memoryManager) AllByOrgs(globalIDs []string) ([]Organization, error) {
+	return m.find(func(org *Organization) bool {
+		for _, globalID := range globalIDs {
+			if contains(org.OrgMembers, globalID) || contains(org.OrgOwners, globalID) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Get always fails, the organizations in memory have no object id
+func (m *memoryManager) Get(id string) (*Organization, error) {
+	return nil, mgo.ErrNotFound
+}
+
+func (m *memoryManager) GetByName(globalID string) (*Organization, error) {
+	organizations, err := m.find(func(org *Organization) bool { return org.Globalid == globalID })
+	if err != nil {
+		return nil, err
+	}
+	if len(organizations) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	organization := &organizations[0]
+	if organization.RequiredScopes == nil {
+		organization.RequiredScopes = []RequiredScope{}
+	}
+	return organization, nil
+}
+
+func (m *memoryManager) Exists(globalID string) bool {
+	count, _ := m.count(func(org *Organization) bool { return org.Globalid == globalID })
+	return count == 1
+}
+
+func (m *memoryManager) Create(organization *Organization) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.organizations[organization.Globalid]; exists {
+		return db.ErrDuplicate
+	}
+	var stored Organization
+	if err := db.CopyDocument(&stored, organization); err != nil {
+		return err
+	}
+	m.store.organizations[organization.Globalid] = stored
+	return nil
+}
+
+func (m *memoryManager) SaveMember(organization *Organization, username string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.Members = addToSet(org.Members, username) })
+}
+
+func (m *memoryManager) RemoveMember(organization *Organization, username string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.Members = pull(org.Members, username) })
+}
+
+func (m *memoryManager) SaveOwner(organization *Organization, owner string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.Owners = addToSet(org.Owners, owner) })
+}
+
+func (m *memoryManager) RemoveOwner(organization *Organization, owner string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.Owners = pull(org.Owners, owner) })
+}
+
+func (m *memoryManager) SaveOrgMember(organization *Organization, organizationID string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.OrgMembers = addToSet(org.OrgMembers, organizationID) })
+}
+
+func (m *memoryManager) RemoveOrgMember(organization *Organization, organizationID string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.OrgMembers = pull(org.OrgMembers, organizationID) })
+}
+
+func (m *memoryManager) SaveOrgOwner(organization *Organization, organizationID string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.OrgOwners = addToSet(org.OrgOwners, organizationID) })
+}
+
+func (m *memoryManager) RemoveOrgOwner(organization *Organization, organizationID string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.OrgOwners = pull(org.OrgOwners, organizationID) })
+}
+
+func (m *memoryManager) AddIncludeSubOrgOf(globalId, orgMemberId string) error {
+	return m.update(globalId, func(org *Organization) { org.IncludeSubOrgsOf = addToSet(org.IncludeSubOrgsOf, orgMemberId) })
+}
+
+func (m *memoryManager) RemoveIncludeSubOrgOf(globalId, orgMemberId string) error {
+	return m.update(globalId, func(org *Organization) { org.IncludeSubOrgsOf = pull(org.IncludeSubOrgsOf, orgMemberId) })
+}
+
+func (m *memoryManager) AddDNS(organization *Organization, dnsName string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.DNS = addToSet(org.DNS, dnsName) })
+}
+
+func (m *memoryManager) UpdateDNS(organization *Organization, oldDNSName string, newDNSName string) error {
+	return m.update(organization.Globalid, func(org *Organization) {
+		org.DNS = addToSet(pull(org.DNS, oldDNSName), newDNSName)
+	})
+}
+
+func (m *memoryManager) RemoveDNS(organization *Organization, dns string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.DNS = pull(org.DNS, dns) })
+}
+
+func (m *memoryManager) Remove(globalid string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.organizations[globalid]; !exists {
+		return mgo.ErrNotFound
+	}
+	delete(m.store.organizations, globalid)
+	return nil
+}
+
+func (m *memoryManager) UpdateMembership(globalid string, username string, oldrole string, newrole string) error {
+	return m.update(globalid, func(org *Organization) {
+		if list := roleList(org, oldrole); list != nil {
+			*list = pull(*list, username)
+		}
+		if list := roleList(org, newrole); list != nil {
+			*list = addToSet(*list, username)
+		}
+	})
+}
+
+func (m *memoryManager) UpdateOrgMembership(globalid string, organization string, oldrole string, newrole string) error {
+	return m.UpdateMembership(globalid, organization, oldrole, newrole)
+}
+
+func (m *memoryManager) CountByUser(username string) (int, error) {
+	return m.count(func(org *Organization) bool { return contains(org.Owners, username) })
+}
+
+func (m *memoryManager) CountByOrganization(organization string) (int, error) {
+	return m.count(func(org *Organization) bool { return contains(org.OrgOwners, organization) })
+}
+
+func (m *memoryManager) RemoveUser(globalID string, username string) error {
+	return m.update(globalID, func(org *Organization) {
+		org.Owners = pull(org.Owners, username)
+		org.Members = pull(org.Members, username)
+	})
+}
+
+func (m *memoryManager) RemoveUserFromAll(username string) error {
+	organizations, err := m.AllByUser(username)
+	if err != nil {
+		return err
+	}
+	for _, org := range organizations {
+		if err = m.RemoveUser(org.Globalid, username); err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryManager) LastOwnerOf(username string) ([]string, error) {
+	organizations, err := m.find(func(org *Organization) bool {
+		return len(org.Owners) == 1 && org.Owners[0] == username
+	})
+	if err != nil {
+		return nil, err
+	}
+	globalIDs := []string{}
+	for _, org := range organizations {
+		if len(org.OrgOwners) == 0 && !strings.Contains(org.Globalid, ".") {
+			globalIDs = append(globalIDs, org.Globalid)
+		}
+	}
+	return globalIDs, nil
+}
+
+func (m *memoryManager) RemoveOrganization(globalID string, organization string) error {
+	return m.update(globalID, func(org *Organization) {
+		org.OrgOwners = pull(org.OrgOwners, organization)
+		org.OrgMembers = pull(org.OrgMembers, organization)
+	})
+}
+
+func (m *memoryManager) GetValidity(globalID string) (int, error) {
+	org, err := m.GetByName(globalID)
+	if err != nil {
+		return 0, err
+	}
+	switch org.SecondsValidity {
+	case -1:
+		return 0, nil
+	case 0:
+		return 3600 * 24 * 7, nil
+	}
+	return org.SecondsValidity, nil
+}
+
+func (m *memoryManager) SetValidity(globalID string, secondsDuration int) error {
+	if secondsDuration == 0 {
+		secondsDuration = -1
+	}
+	return m.update(globalID, func(org *Organization) { org.SecondsValidity = secondsDuration })
+}
+
+func (m *memoryManager) AddRequiredScope(globalId string, requiredScope RequiredScope) error {
+	return m.update(globalId, func(org *Organization) { org.RequiredScopes = append(org.RequiredScopes, requiredScope) })
+}
+
+func (m *memoryManager) UpdateRequiredScope(globalId string, oldRequiredScope string, newRequiredScope RequiredScope) error {
+	org, err := m.GetByName(globalId)
+	if err != nil {
+		return err
+	}
+	index := -1
+	for i, requiredScope := range org.RequiredScopes {
+		if requiredScope.Scope == oldRequiredScope {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return mgo.ErrNotFound
+	}
+	return m.update(globalId, func(org *Organization) { org.RequiredScopes[index] = newRequiredScope })
+}
+
+func (m *memoryManager) DeleteRequiredScope(globalId string, requiredScope string) error {
+	return m.update(globalId, func(org *Organization) {
+		requiredScopes := []RequiredScope{}
+		for _, scope := range org.RequiredScopes {
+			if scope.Scope != requiredScope {
+				requiredScopes = append(requiredScopes, scope)
+			}
+		}
+		org.RequiredScopes = requiredScopes
+	})
+}
+
+func (m *memoryManager) ListByUserOrGlobalID(username string, globalIds []string) (error, []Organization) {
+	organizations, err := m.find(func(org *Organization) bool {
+		return contains(org.Owners, username) || contains(org.Members, username) || contains(globalIds, org.Globalid)
+	})
+	return err, organizations
+}
+
+type memoryLogoStore struct {
+	sync.Mutex
+	logos map[string]OrganizationLogo
+}
+
+//memoryLogoManager keeps the organization logos in a db.MemoryBackend
+type memoryLogoManager struct {
+	store *memoryLogoStore
+}
+
+func newMemoryLogoManager(backend *db.MemoryBackend) *memoryLogoManager {
+	store := backend.Store(logoCollectionName, func() interface{} {
+		return &memoryLogoStore{logos: make(map[string]OrganizationLogo)}
+	}).(*memoryLogoStore)
+	return &memoryLogoManager{store: store}
+}
+
+func (m *memoryLogoManager) GetByName(globalID string) (*Organization, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.logos[globalID]; !exists {
+		return nil, mgo.ErrNotFound
+	}
+	return &Organization{Globalid: globalID}, nil
+}
+
+func (m *memoryLogoManager) Exists(globalID string) bool {
+	m.store.Lock()
+	defer m.store.Unlock()
+	_, exists := m.store.logos[globalID]
+	return exists
+}
+
+func (m *memoryLogoManager) Create(organization *Organization) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.logos[organization.Globalid]; exists {
+		return db.ErrDuplicate
+	}
+	m.store.logos[organization.Globalid] = OrganizationLogo{Globalid: organization.Globalid}
+	return nil
+}
+
+func (m *memoryLogoManager) Remove(globalid string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.logos[globalid]; !exists {
+		return mgo.ErrNotFound
+	}
+	delete(m.store.logos, globalid)
+	return nil
+}
+
+func (m *memoryLogoManager) SaveLogo(globalID string, logo string) (*mgo.ChangeInfo, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	info := &mgo.ChangeInfo{}
+	if _, exists := m.store.logos[globalID]; exists {
+		info.Updated = 1
+	} else {
+		info.UpsertedId = globalID
+	}
+	m.store.logos[globalID] = OrganizationLogo{Globalid: globalID, Logo: logo}
+	return info, nil
+}
+
+func (m *memoryLogoManager) GetLogo(globalID string) (string, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	orgLogo, exists := m.store.logos[globalID]
+	if !exists {
+		return "", mgo.ErrNotFound
+	}
+	return orgLogo.Logo, nil
+}
+
+func (m *memoryLogoManager) RemoveLogo(globalID string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.logos[globalID]; !exists {
+		return mgo.ErrNotFound
+	}
+	m.store.logos[globalID] = OrganizationLogo{Globalid: globalID}
+	return nil
+}
+
+type last2FAKey struct {
+	globalID string
+	username string
+}
+
+type memoryLast2FAStore struct {
+	sync.Mutex
+	logins map[last2FAKey]UserLast2FALogin
+}
+
+//memoryLast2FAManager keeps the last 2FA logins in a db.MemoryBackend
+type memoryLast2FAManager struct {
+	store *memoryLast2FAStore
+}
+
+func newMemoryLast2FAManager(backend *db.MemoryBackend) *memoryLast2FAManager {
+	store := backend.Store(last2FACollectionName, func() interface{} {
+		return &memoryLast2FAStore{logins: make(map[last2FAKey]UserLast2FALogin)}
+	}).(*memoryLast2FAStore)
+	return &memoryLast2FAManager{store: store}
+}
+
+// get returns a login that did not expire yet, the caller holds the lock
+func (m *memoryLast2FAManager) get(globalID string, username string) (UserLast2FALogin, bool) {
+	login, exists := m.store.logins[last2FAKey{globalID, username}]
+	if !exists || time.Since(time.Time(login.Last2FA)) > last2FAValidity {
+		return UserLast2FALogin{}, false
+	}
+	return login, true
+}
+
+func (m *memoryLast2FAManager) Exists(globalID string, username string) bool {
+	m.store.Lock()
+	defer m.store.Unlock()
+	_, exists := m.get(globalID, username)
+	return exists
+}
+
+func (m *memoryLast2FAManager) RemoveByOrganization(globalid string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for key := range m.store.logins {
+		if key.globalID == globalid {
+			delete(m.store.logins, key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryLast2FAManager) RemoveByUser(username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for key := range m.store.logins {
+		if key.username == username {
+			delete(m.store.logins, key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryLast2FAManager) SetLast2FA(globalID string, username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.logins[last2FAKey{globalID, username}] = UserLast2FALogin{
+		Globalid: globalID,
+		Username: username,
+		Last2FA:  db.DateTime(time.Now()),
+	}
+	return nil
+}
+
+func (m *memoryLast2FAManager) GetLast2FA(globalID string, username string) (db.DateTime, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	login, exists := m.get(globalID, username)
+	if !exists {
+		return db.DateTime{}, mgo.ErrNotFound
+	}
+	return login.Last2FA, nil
+}
+
+func (m *memoryLast2FAManager) RemoveLast2FA(globalID string, username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.get(globalID, username); !exists {
+		return mgo.ErrNotFound
+	}
+	delete(m.store.logins, last2FAKey{globalID, username})
+	return nil
+}
+
+type memoryDescriptionStore struct {
+	sync.Mutex
+	descriptions map[string][]LocalizedInfoText
+}
+
+//memoryDescriptionManager keeps the organization descriptions in a db.MemoryBackend
+type memoryDescriptionManager struct {
+	store *memoryDescriptionStore
+}
+
+func newMemoryDescriptionManager(backend *db.MemoryBackend) *memoryDescriptionManager {
+	store := backend.Store(descriptionCollectionName, func() interface{} {
+		return &memoryDescriptionStore{descriptions: make(map[string][]LocalizedInfoText)}
+	}).(*memoryDescriptionStore)
+	return &memoryDescriptionManager{store: store}
+}
+
+func (m *memoryDescriptionManager) Remove(globalid string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.descriptions[globalid]; !exists {
+		return mgo.ErrNotFound
+	}
+	delete(m.store.descriptions, globalid)
+	return nil
+}
+
+func (m *memoryDescriptionManager) SaveDescription(globalId string, text LocalizedInfoText) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	texts := m.store.descriptions[globalId]
+	for _, existing := range texts {
+		if existing == text {
+			return nil
+		}
+	}
+	m.store.descriptions[globalId] = append(append([]LocalizedInfoText{}, texts...), text)
+	return nil
+}
+
+func (m *memoryDescriptionManager) UpdateDescription(globalId string, text LocalizedInfoText) error {
+	m.store.Lock()
+	if _, exists := m.store.descriptions[globalId]; !exists {
+		m.store.Unlock()
+		return mgo.ErrNotFound
+	}
+	m.store.Unlock()
+	if err := m.DeleteDescription(globalId, text.LangKey); err != nil {
+		return err
+	}
+	return m.SaveDescription(globalId, text)
+}
+
+func (m *memoryDescriptionManager) DeleteDescription(globalId, langKey string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	texts, exists := m.store.descriptions[globalId]
+	if !exists {
+		return mgo.ErrNotFound
+	}
+	remaining := []LocalizedInfoText{}
+	for _, text := range texts {
+		if text.LangKey != langKey {
+			remaining = append(remaining, text)
+		}
+	}
+	m.store.descriptions[globalId] = remaining
+	return nil
+}
+
+func (m *memoryDescriptionManager) GetDescription(globalId string) (OrganizationInfoText, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	texts, exists := m.store.descriptions[globalId]
+	if !exists {
+		return OrganizationInfoText{}, mgo.ErrNotFound
+	}
+	return OrganizationInfoText{Globalid: globalId, InfoTexts: append([]LocalizedInfoText{}, texts...)}, nil
+}
@@ -0,0 +1,32 @@
+package organization
+
+import (
+	"testing"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryHierarchy(t *testing.T) {
+	m := newMemoryManager(db.NewMemoryBackend())
+	assert.NoError(t, m.Create(&Organization{Globalid: "parent", Owners: []string{"alice"}}))
+	assert.NoError(t, m.Create(&Organization{Globalid: "parent.child", Members: []string{"bob"}}))
+	assert.Equal(t, db.ErrDuplicate, m.Create(&Organization{Globalid: "parent"}))
+
+	isOwner, err := m.IsOwner("parent.child", "alice")
+	assert.NoError(t, err)
+	assert.True(t, isOwner, "owners of a parent organization own the suborganizations")
+
+	isMember, err := m.IsMember("parent", "bob")
+	assert.NoError(t, err)
+	assert.False(t, isMember, "members of a suborganization are not members of the parent")
+
+	suborganizations, err := m.GetSubOrganizations("parent")
+	assert.NoError(t, err)
+	assert.Len(t, suborganizations, 1)
+
+	assert.NoError(t, m.RemoveUserFromAll("alice"))
+	isOwner, err = m.IsOwner("parent.child", "alice")
+	assert.NoError(t, err)
+	assert.False(t, isOwner)
+}
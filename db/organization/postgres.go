@@ -0,0 +1,574 @@
+package organization
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/lib/pq"
+	"gopkg.in/mgo.v2"
+)
+
+var postgresOrganizations = &db.PostgresCollection{
+	Table: "organizations",
+	Columns: func(document interface{}) map[string]interface{} {
+		org := document.(*Organization)
+		return map[string]interface{}{
+			"globalid":   org.Globalid,
+			"owners":     pq.StringArray(nonNil(org.Owners)),
+			"members":    pq.StringArray(nonNil(org.Members)),
+			"orgowners":  pq.StringArray(nonNil(org.OrgOwners)),
+			"orgmembers": pq.StringArray(nonNil(org.OrgMembers)),
+		}
+	},
+}
+
+var postgresLogos = &db.PostgresCollection{
+	Table: "organizationlogos",
+	Columns: func(document interface{}) map[string]interface{} {
+		return map[string]interface{}{"globalid": document.(*OrganizationLogo).Globalid}
+	},
+}
+
+var postgresLast2FA = &db.PostgresCollection{
+	Table: "last2falogins",
+	Columns: func(document interface{}) map[string]interface{} {
+		login := document.(*UserLast2FALogin)
+		return map[string]interface{}{
+			"globalid":   login.Globalid,
+			"username":   login.Username,
+			"expires_at": time.Time(login.Last2FA).Add(last2FAValidity),
+		}
+	},
+}
+
+var postgresDescriptions = &db.PostgresCollection{
+	Table: "organizationdescriptions",
+	Columns: func(document interface{}) map[string]interface{} {
+		return map[string]interface{}{"globalid": document.(*OrganizationInfoText).Globalid}
+	},
+}
+
+// nonNil makes sure an empty list is stored as an empty array instead of NULL
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+func newOrganization() interface{} {
+	return &Organization{}
+}
+
+//postgresManager stores the organizations in a postgres database
+type postgresManager struct {
+	hierarchy
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	m := &postgresManager{db: pg}
+	m.hierarchy = hierarchy{store: m}
+	return m
+}
+
+// update applies a change to an organization, mgo.ErrNotFound is returned if it does not exist
+func (m *postgresManager) update(globalID string, change func(org *Organization)) error {
+	updated, err := postgresOrganizations.Update(m.db, "globalid = $1", []interface{}{globalID}, newOrganization, func(document interface{}) error {
+		change(document.(*Organization))
+		return nil
+	})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) find(where string, args ...interface{}) (organizations []Organization, err error) {
+	err = postgresOrganizations.Find(m.db, &organizations, where, args...)
+	return
+}
+
+func (m *postgresManager) count(where string, args ...interface{}) (int, error) {
+	return postgresOrganizations.Count(m.db, where, args...)
+}
+
+func (m *postgresManager) GetOrganizations(organizationIDs []string) ([]Organization, error) {
+	return m.find("globalid = ANY($1)", pq.StringArray(organizationIDs))
+}
+
+// subOrganizations matches the globalids that start with the globalid of one of the parents followed by a dot
+const subOrganizations = "EXISTS (SELECT 1 FROM unnest($1::text[]) AS parent WHERE left(globalid, length(parent) + 1) = parent || '.')"
+
+func (m *postgresManager) GetSubOrganizations(globalID string) ([]Organization, error) {
+	return m.GetSubOrganizationsMultiple([]string{globalID})
+}
+
+func (m *postgresManager) GetSubOrganizationsMultiple(globalIDs []string) ([]Organization, error) {
+	organizations, err := m.find(subOrganizations, pq.StringArray(globalIDs))
+	if err != nil {
+		return nil, err
+	}
+	if organizations == nil {
+		organizations = []Organization{}
+	}
+	return organizations, nil
+}
+
+func (m *postgresManager) isDirectOwner(globalID, username string) (bool, error) {
+	matches, err := m.count("globalid = $1 AND owners @> ARRAY[$2::text]", globalID, username)
+	return matches > 0, err
+}
+
+func (m *postgresManager) isDirectMember(globalID, username string) (bool, error) {
+	matches, err := m.count("globalid = $1 AND members @> ARRAY[$2::text]", globalID, username)
+	return matches > 0, err
+}
+
+func (m *postgresManager) isDirectOwnerOfOrgs(globalIDs []string, username string) ([]string, error) {
+	organizations, err := m.find("globalid = ANY($1) AND owners @> ARRAY[$2::text]", pq.StringArray(globalIDs), username)
+	ownedOrgs := make([]string, len(organizations))
+	for i, org := range organizations {
+		ownedOrgs[i] = org.Globalid
+	}
+	return ownedOrgs, err
+}
+
+func (m *postgresManager) getRelations(globalID string) (org Organization, err error) {
+	err = postgresOrganizations.FindOne(m.db, &org, "globalid = $1", globalID)
+	return
+}
+
+func (m *postgresManager) OrganizationIsOwner(globalID, organization string) (bool, error) {
+	matches, err := m.count("globalid = $1 AND orgowners @> ARRAY[$2::text]", globalID, organization)
+	return matches > 0, err
+}
+
+func (m *postgresManager) OrganizationIsMember(globalID, organization string) (bool, error) {
+	matches, err := m.count("globalid = $1 AND orgmembers @> ARRAY[$2::text]", globalID, organization)
+	return matches > 0, err
+}
+
+func (m *postgresManager) OrganizationIsPartOf(globalID, organization string) (bool, error) {
+	matches, err := m.count("globalid = $1 AND (orgmembers @> ARRAY[$2::text] OR orgowners @> ARRAY[$2::text])", globalID, organization)
+	return matches == 1, err
+}
+
+func (m *postgresManager) AllByUser(username string) ([]Organization, error) {
+	return m.find("members @> ARRAY[$1::text] OR owners @> ARRAY[$1::text]", username)
+}
+
+func (m *postgresManager) AllByOrg(globalID string) ([]Organization, error) {
+	return m.find("orgmembers @> ARRAY[$1::text] OR orgowners @> ARRAY[$1::text]", globalID)
+}
+
+func (m *postgresManager) AllByOrgs(globalIDs []string) ([]Organization, error) {
+	return m.find("orgmembers && $1::text[] OR orgowners && $1::text[]", pq.StringArray(globalIDs))
+}
+
+func (m *postgresManager) Get(id string) (*Organization, error) {
+	var organization Organization
+	if err := postgresOrganizations.FindOne(m.db, &organization, "id = $1", id); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func (m *postgresManager) GetByName(globalID string) (*Organization, error) {
+	var organization Organization
+	if err := postgresOrganizations.FindOne(m.db, &organization, "globalid = $1", globalID); err != nil {
+		return nil, err
+	}
+	if organization.RequiredScopes == nil {
+		organization.RequiredScopes = []RequiredScope{}
+	}
+	return &organization, nil
+}
+
+func (m *postgresManager) Exists(globalID string) bool {
+	count, _ := m.count("globalid = $1", globalID)
+	return count == 1
+}
+
+func (m *postgresManager) Create(organization *Organization) error {
+	return postgresOrganizations.Insert(m.db, organization)
+}
+
+func (m *postgresManager) SaveMember(organization *Organization, username string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.Members = addToSet(org.Members, username) })
+}
+
+func (m *postgresManager) RemoveMember(organization *Organization, username string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.Members = pull(org.Members, username) })
+}
+
+func (m *postgresManager) SaveOwner(organization *Organization, owner string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.Owners = addToSet(org.Owners, owner) })
+}
+
+func (m *postgresManager) RemoveOwner(organization *Organization, owner string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.Owners = pull(org.Owners, owner) })
+}
+
+func (m *postgresManager) SaveOrgMember(organization *Organization, organizationID string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.OrgMembers = addToSet(org.OrgMembers, organizationID) })
+}
+
+func (m *postgresManager) RemoveOrgMember(organization *Organization, organizationID string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.OrgMembers = pull(org.OrgMembers, organizationID) })
+}
+
+func (m *postgresManager) SaveOrgOwner(organization *Organization, organizationID string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.OrgOwners = addToSet(org.OrgOwners, organizationID) })
+}
+
+func (m *postgresManager) RemoveOrgOwner(organization *Organization, organizationID string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.OrgOwners = pull(org.OrgOwners, organizationID) })
+}
+
+func (m *postgresManager) AddIncludeSubOrgOf(globalId, orgMemberId string) error {
+	return m.update(globalId, func(org *Organization) { org.IncludeSubOrgsOf = addToSet(org.IncludeSubOrgsOf, orgMemberId) })
+}
+
+func (m *postgresManager) RemoveIncludeSubOrgOf(globalId, orgMemberId string) error {
+	return m.update(globalId, func(org *Organization) { org.IncludeSubOrgsOf = pull(org.IncludeSubOrgsOf, orgMemberId) })
+}
+
+func (m *postgresManager) AddDNS(organization *Organization, dnsName string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.DNS = addToSet(org.DNS, dnsName) })
+}
+
+func (m *postgresManager) UpdateDNS(organization *Organization, oldDNSName string, newDNSName string) error {
+	return m.update(organization.Globalid, func(org *Organization) {
+		org.DNS = addToSet(pull(org.DNS, oldDNSName), newDNSName)
+	})
+}
+
+func (m *postgresManager) RemoveDNS(organization *Organization, dns string) error {
+	return m.update(organization.Globalid, func(org *Organization) { org.DNS = pull(org.DNS, dns) })
+}
+
+// removeOne removes the row that matches, mgo.ErrNotFound is returned if there is none
+func removeOne(collection *db.PostgresCollection, pg *sql.DB, where string, args ...interface{}) error {
+	removed, err := collection.Remove(pg, where, args...)
+	if err == nil && removed == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) Remove(globalid string) error {
+	return removeOne(postgresOrganizations, m.db, "globalid = $1", globalid)
+}
+
+func (m *postgresManager) UpdateMembership(globalid string, username string, oldrole string, newrole string) error {
+	return m.update(globalid, func(org *Organization) {
+		if list := roleList(org, oldrole); list != nil {
+			*list = pull(*list, username)
+		}
+		if list := roleList(org, newrole); list != nil {
+			*list = addToSet(*list, username)
+		}
+	})
+}
+
+func (m *postgresManager) UpdateOrgMembership(globalid string, organization string, oldrole string, newrole string) error {
+	return m.UpdateMembership(globalid, organization, oldrole, newrole)
+}
+
+func (m *postgresManager) CountByUser(username string) (int, error) {
+	return m.count("owners @> ARRAY[$1::text]", username)
+}
+
+func (m *postgresManager) CountByOrganization(organization string) (int, error) {
+	return m.count("orgowners @> ARRAY[$1::text]", organization)
+}
+
+func (m *postgresManager) RemoveUser(globalID string, username string) error {
+	return m.update(globalID, func(org *Organization) {
+		org.Owners = pull(org.Owners, username)
+		org.Members = pull(org.Members, username)
+	})
+}
+
+func (m *postgresManager) RemoveUserFromAll(username string) error {
+	_, err := postgresOrganizations.Update(m.db, "owners @> ARRAY[$1::text] OR members @> ARRAY[$1::text]", []interface{}{username}, newOrganization,
+		func(document interface{}) error {
+			org := document.(*Organization)
+			org.Owners = pull(org.Owners, username)
+			org.Members = pull(org.Members, username)
+			return nil
+		})
+	return err
+}
+
+func (m *postgresManager) LastOwnerOf(username string) ([]string, error) {
+	organizations, err := m.find("owners = ARRAY[$1::text]", username)
+	if err != nil {
+		return nil, err
+	}
+	globalIDs := []string{}
+	for _, org := range organizations {
+		if len(org.OrgOwners) == 0 && !strings.Contains(org.Globalid, ".") {
+			globalIDs = append(globalIDs, org.Globalid)
+		}
+	}
+	return globalIDs, nil
+}
+
+func (m *postgresManager) RemoveOrganization(globalID string, organization string) error {
+	return m.update(globalID, func(org *Organization) {
+		org.OrgOwners = pull(org.OrgOwners, organization)
+		org.OrgMembers = pull(org.OrgMembers, organization)
+	})
+}
+
+func (m *postgresManager) GetValidity(globalID string) (int, error) {
+	org, err := m.GetByName(globalID)
+	if err != nil {
+		return 0, err
+	}
+	switch org.SecondsValidity {
+	case -1:
+		return 0, nil
+	case 0:
+		return 3600 * 24 * 7, nil
+	}
+	return org.SecondsValidity, nil
+}
+
+func (m *postgresManager) SetValidity(globalID string, secondsDuration int) error {
+	if secondsDuration == 0 {
+		secondsDuration = -1
+	}
+	return m.update(globalID, func(org *Organization) { org.SecondsValidity = secondsDuration })
+}
+
+func (m *postgresManager) AddRequiredScope(globalId string, requiredScope RequiredScope) error {
+	return m.update(globalId, func(org *Organization) { org.RequiredScopes = append(org.RequiredScopes, requiredScope) })
+}
+
+func (m *postgresManager) UpdateRequiredScope(globalId string, oldRequiredScope string, newRequiredScope RequiredScope) error {
+	found := false
+	err := m.update(globalId, func(org *Organization) {
+		for i, requiredScope := range org.RequiredScopes {
+			if requiredScope.Scope == oldRequiredScope {
+				org.RequiredScopes[i] = newRequiredScope
+				found = true
+				return
+			}
+		}
+	})
+	if err == nil && !found {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) DeleteRequiredScope(globalId string, requiredScope string) error {
+	return m.update(globalId, func(org *Organization) {
+		requiredScopes := []RequiredScope{}
+		for _, scope := range org.RequiredScopes {
+			if scope.Scope != requiredScope {
+				requiredScopes = append(requiredScopes, scope)
+			}
+		}
+		org.RequiredScopes = requiredScopes
+	})
+}
+
+func (m *postgresManager) ListByUserOrGlobalID(username string, globalIds []string) (error, []Organization) {
+	organizations, err := m.find("owners @> ARRAY[$1::text] OR members @> ARRAY[$1::text] OR globalid = ANY($2)",
+		username, pq.StringArray(globalIds))
+	return err, organizations
+}
+
+//postgresLogoManager stores the organization logos in a postgres database
+type postgresLogoManager struct {
+	db *sql.DB
+}
+
+func newPostgresLogoManager(pg *sql.DB) *postgresLogoManager {
+	return &postgresLogoManager{db: pg}
+}
+
+func newLogo() interface{} {
+	return &OrganizationLogo{}
+}
+
+func (m *postgresLogoManager) GetByName(globalID string) (*Organization, error) {
+	var orgLogo OrganizationLogo
+	if err := postgresLogos.FindOne(m.db, &orgLogo, "globalid = $1", globalID); err != nil {
+		return nil, err
+	}
+	return &Organization{Globalid: orgLogo.Globalid}, nil
+}
+
+func (m *postgresLogoManager) Exists(globalID string) bool {
+	count, _ := postgresLogos.Count(m.db, "globalid = $1", globalID)
+	return count == 1
+}
+
+func (m *postgresLogoManager) Create(organization *Organization) error {
+	return postgresLogos.Insert(m.db, &OrganizationLogo{Globalid: organization.Globalid})
+}
+
+func (m *postgresLogoManager) Remove(globalid string) error {
+	return removeOne(postgresLogos, m.db, "globalid = $1", globalid)
+}
+
+func (m *postgresLogoManager) SaveLogo(globalID string, logo string) (*mgo.ChangeInfo, error) {
+	setLogo := func(document interface{}) error {
+		orgLogo := document.(*OrganizationLogo)
+		orgLogo.Globalid = globalID
+		orgLogo.Logo = logo
+		return nil
+	}
+	updated, err := postgresLogos.Update(m.db, "globalid = $1", []interface{}{globalID}, newLogo, setLogo)
+	if err != nil {
+		return nil, err
+	}
+	info := &mgo.ChangeInfo{Updated: updated}
+	if updated == 0 {
+		orgLogo := &OrganizationLogo{}
+		setLogo(orgLogo)
+		if err = postgresLogos.Insert(m.db, orgLogo); err != nil {
+			return nil, err
+		}
+		info.UpsertedId = globalID
+	}
+	return info, nil
+}
+
+func (m *postgresLogoManager) GetLogo(globalID string) (string, error) {
+	var orgLogo OrganizationLogo
+	if err := postgresLogos.FindOne(m.db, &orgLogo, "globalid = $1", globalID); err != nil {
+		return "", err
+	}
+	return orgLogo.Logo, nil
+}
+
+func (m *postgresLogoManager) RemoveLogo(globalID string) error {
+	updated, err := postgresLogos.Update(m.db, "globalid = $1", []interface{}{globalID}, newLogo, func(document interface{}) error {
+		document.(*OrganizationLogo).Logo = ""
+		return nil
+	})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+//postgresLast2FAManager stores the last 2FA logins in a postgres database
+type postgresLast2FAManager struct {
+	db *sql.DB
+}
+
+func newPostgresLast2FAManager(pg *sql.DB) *postgresLast2FAManager {
+	return &postgresLast2FAManager{db: pg}
+}
+
+func (m *postgresLast2FAManager) Exists(globalID string, username string) bool {
+	count, _ := postgresLast2FA.Count(m.db, "globalid = $1 AND username = $2", globalID, username)
+	return count == 1
+}
+
+func (m *postgresLast2FAManager) RemoveByOrganization(globalid string) error {
+	_, err := postgresLast2FA.Remove(m.db, "globalid = $1", globalid)
+	return err
+}
+
+func (m *postgresLast2FAManager) RemoveByUser(username string) error {
+	_, err := postgresLast2FA.Remove(m.db, "username = $1", username)
+	return err
+}
+
+func (m *postgresLast2FAManager) SetLast2FA(globalID string, username string) error {
+	return postgresLast2FA.Upsert(m.db, "globalid = $1 AND username = $2", []interface{}{globalID, username},
+		func() interface{} { return &UserLast2FALogin{} },
+		func(document interface{}) error {
+			*document.(*UserLast2FALogin) = UserLast2FALogin{Globalid: globalID, Username: username, Last2FA: db.DateTime(time.Now())}
+			return nil
+		})
+}
+
+func (m *postgresLast2FAManager) GetLast2FA(globalID string, username string) (db.DateTime, error) {
+	var login UserLast2FALogin
+	err := postgresLast2FA.FindOne(m.db, &login, "globalid = $1 AND username = $2", globalID, username)
+	return login.Last2FA, err
+}
+
+func (m *postgresLast2FAManager) RemoveLast2FA(globalID string, username string) error {
+	return removeOne(postgresLast2FA, m.db, "globalid = $1 AND username = $2", globalID, username)
+}
+
+//postgresDescriptionManager stores the organization descriptions in a postgres database
+type postgresDescriptionManager struct {
+	db *sql.DB
+}
+
+func newPostgresDescriptionManager(pg *sql.DB) *postgresDescriptionManager {
+	return &postgresDescriptionManager{db: pg}
+}
+
+// changeDescription applies a change to the descriptions of an organization
+func (m *postgresDescriptionManager) changeDescription(globalId string, upsert bool, change func(info *OrganizationInfoText)) error {
+	newInfo := func() interface{} { return &OrganizationInfoText{Globalid: globalId} }
+	changeInfo := func(document interface{}) error {
+		change(document.(*OrganizationInfoText))
+		return nil
+	}
+	if upsert {
+		return postgresDescriptions.Upsert(m.db, "globalid = $1", []interface{}{globalId}, newInfo, changeInfo)
+	}
+	updated, err := postgresDescriptions.Update(m.db, "globalid = $1", []interface{}{globalId}, newInfo, changeInfo)
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func addInfoText(info *OrganizationInfoText, text LocalizedInfoText) {
+	for _, existing := range info.InfoTexts {
+		if existing == text {
+			return
+		}
+	}
+	info.InfoTexts = append(info.InfoTexts, text)
+}
+
+func removeInfoText(info *OrganizationInfoText, langKey string) {
+	remaining := []LocalizedInfoText{}
+	for _, text := range info.InfoTexts {
+		if text.LangKey != langKey {
+			remaining = append(remaining, text)
+		}
+	}
+	info.InfoTexts = remaining
+}
+
+func (m *postgresDescriptionManager) Remove(globalid string) error {
+	return removeOne(postgresDescriptions, m.db, "globalid = $1", globalid)
+}
+
+func (m *postgresDescriptionManager) SaveDescription(globalId string, text LocalizedInfoText) error {
+	return m.changeDescription(globalId, true, func(info *OrganizationInfoText) { addInfoText(info, text) })
+}
+
+func (m *postgresDescriptionManager) UpdateDescription(globalId string, text LocalizedInfoText) error {
+	return m.changeDescription(globalId, false, func(info *OrganizationInfoText) {
+		removeInfoText(info, text.LangKey)
+		addInfoText(info, text)
+	})
+}
+
+func (m *postgresDescriptionManager) DeleteDescription(globalId, langKey string) error {
+	return m.changeDescription(globalId, false, func(info *OrganizationInfoText) { removeInfoText(info, langKey) })
+}
+
+func (m *postgresDescriptionManager) GetDescription(globalId string) (info OrganizationInfoText, err error) {
+	err = postgresDescriptions.FindOne(m.db, &info, "globalid = $1", globalId)
+	return
+}
@@ -5,38 +5,56 @@ import (
 
 	"github.com/itsyouonline/identityserver/db"
 	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 const (
 	mongoPersistenLogCollectionName = "persistentlogs"
 )
 
-// InitModels intializes the mongo models
-func InitModels() {
-	index := mgo.Index{
-		Key:    []string{"key"},
-		Unique: false,
-	}
-
-	db.EnsureIndex(mongoPersistenLogCollectionName, index)
+// Manager is used to store logs
+type Manager interface {
+	SaveLog(log *PersistentLog) error
+	// SetUsername links the logs with a key to the user the flow created
+	SetUsername(key, username string) error
+	// RemoveByUser removes the logs linked to a user
+	RemoveByUser(username string) error
 }
 
-// Manager is used to store logs
-type Manager struct {
+// mongoManager stores the logs in mongo
+type mongoManager struct {
 	session    *mgo.Session
 	collection *mgo.Collection
 }
 
 //NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session:    session,
 		collection: db.GetCollection(session, mongoPersistenLogCollectionName),
 	}
 }
 
 // SaveLog stores a new PersistentLog entry
-func (m *Manager) SaveLog(log *PersistentLog) error {
+func (m *mongoManager) SaveLog(log *PersistentLog) error {
 	return m.collection.Insert(log)
 }
+
+// SetUsername links the logs with a key to the user the flow created
+func (m *mongoManager) SetUsername(key, username string) error {
+	_, err := m.collection.UpdateAll(bson.M{"key": key}, bson.M{"$set": bson.M{"username": username}})
+	return err
+}
+
+// RemoveByUser removes the logs linked to a user
+func (m *mongoManager) RemoveByUser(username string) error {
+	_, err := m.collection.RemoveAll(bson.M{"username": username})
+	return err
+}
@@ -0,0 +1,55 @@
+package persistentlog
+
+import (
+	"sync"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	logs []PersistentLog
+}
+
+// memoryManager keeps the logs in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoPersistenLogCollectionName, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) SaveLog(log *PersistentLog) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.logs = append(m.store.logs, *log)
+	return nil
+}
+
+func (m *memoryManager) SetUsername(key, username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for i := range m.store.logs {
+		if m.store.logs[i].Key == key {
+			m.store.logs[i].Username = username
+		}
+	}
+	return nil
+}
+
+func (m *memoryManager) RemoveByUser(username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	remaining := []PersistentLog{}
+	for _, log := range m.store.logs {
+		if log.Username != username {
+			remaining = append(remaining, log)
+		}
+	}
+	m.store.logs = remaining
+	return nil
+}
@@ -8,6 +8,8 @@ type PersistentLog struct {
 	Flow      FlowType
 	Key       string
 	Message   string
+	// Username is the user the flow created, it is set once the flow is finished
+	Username string `bson:",omitempty"`
 }
 
 // FlowType represents the flow we are in when creating the log
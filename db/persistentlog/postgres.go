@@ -0,0 +1,43 @@
+package persistentlog
+
+import (
+	"database/sql"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+var postgresLogs = &db.PostgresCollection{
+	Table: "persistentlogs",
+	Columns: func(document interface{}) map[string]interface{} {
+		log := document.(*PersistentLog)
+		return map[string]interface{}{"key": log.Key, "username": log.Username}
+	},
+}
+
+// postgresManager stores the logs in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) SaveLog(log *PersistentLog) error {
+	return postgresLogs.Insert(m.db, log)
+}
+
+func (m *postgresManager) SetUsername(key, username string) error {
+	_, err := postgresLogs.Update(m.db, "key = $1", []interface{}{key},
+		func() interface{} { return &PersistentLog{} },
+		func(document interface{}) error {
+			document.(*PersistentLog).Username = username
+			return nil
+		})
+	return err
+}
+
+func (m *postgresManager) RemoveByUser(username string) error {
+	_, err := postgresLogs.Remove(m.db, "username = $1", username)
+	return err
+}
@@ -0,0 +1,355 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// postgresUniqueViolation is the error code of a unique constraint violation
+	postgresUniqueViolation = "23505"
+	// expirySweepInterval is how often expired rows are removed, the mongo TTL monitor runs every minute as well
+	expirySweepInterval = time.Minute
+)
+
+var postgresDB *sql.DB
+
+// IsPostgresURL checks if a connection string points to a postgres database instead of mongo
+func IsPostgresURL(url string) bool {
+	return strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://")
+}
+
+// connectPostgres connects to a postgres database, makes it the default backend and starts removing the expired rows.
+// It gives up after attempts failed connections if attempts is positive.
+func connectPostgres(url string, attempts int) error {
+	for attempt := 1; ; attempt++ {
+		pg, err := sql.Open("postgres", url)
+		if err == nil {
+			if err = pg.Ping(); err == nil {
+				postgresDB = pg
+				break
+			}
+			pg.Close()
+		}
+		log.Errorf("Failed to initialize DB connection: %s", err)
+		if attempt == attempts {
+			return err
+		}
+		log.Debug("Retrying in 5 seconds...")
+		time.Sleep(connectRetryInterval)
+	}
+	backend := &PostgresBackend{DB: postgresDB}
+	SetDefaultBackend(backend)
+	go backend.sweepExpired()
+	log.Info("Initialized postgres connection")
+	return nil
+}
+
+// PostgresBackend stores everything in a postgres database
+type PostgresBackend struct {
+	DB *sql.DB
+}
+
+// Open does nothing, database/sql pools the connections itself
+func (b *PostgresBackend) Open(r *http.Request) (release func(), err error) {
+	release = func() {}
+	return
+}
+
+// GetPostgres returns the postgres database of a request, or nil if the request uses another backend
+func GetPostgres(r *http.Request) *sql.DB {
+	if backend, ok := GetBackend(r).(*PostgresBackend); ok {
+		return backend.DB
+	}
+	return nil
+}
+
+// sweepExpired removes the rows with an expires_at in the past from every table that has that column,
+// like the TTL indices do in mongo
+func (b *PostgresBackend) sweepExpired() {
+	for range time.Tick(expirySweepInterval) {
+		if err := b.RemoveExpired(); err != nil {
+			log.Error("Failed to remove the expired rows: ", err)
+		}
+	}
+}
+
+// RemoveExpired removes the rows with an expires_at in the past
+func (b *PostgresBackend) RemoveExpired() error {
+	rows, err := b.DB.Query(`SELECT table_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND column_name = 'expires_at'`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err = rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if _, err = b.DB.Exec(fmt.Sprintf("DELETE FROM %s WHERE expires_at < now()", pq.QuoteIdentifier(table))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PostgresCollection stores documents in a postgres table.
+// Like in mongo the complete document is stored, as bson in the document column and with its _id in the id column.
+// The fields that are queried on are copied into their own columns by Columns so they can be indexed.
+// Rows are returned in the order they were inserted unless the where clause has an ORDER BY.
+type PostgresCollection struct {
+	Table string
+	// Columns returns the values of the queried columns of a document
+	Columns func(document interface{}) map[string]interface{}
+}
+
+// encode marshals a document and extracts its columns, a new _id is generated if the document has none
+func (c *PostgresCollection) encode(document interface{}, id string) (data []byte, columns []string, values []interface{}, err error) {
+	data, err = bson.Marshal(document)
+	if err != nil {
+		return
+	}
+	var d bson.D
+	if err = bson.Unmarshal(data, &d); err != nil {
+		return
+	}
+	hasID := false
+	for _, elem := range d {
+		hasID = hasID || elem.Name == "_id"
+	}
+	if !hasID {
+		var docID interface{} = bson.NewObjectId()
+		if id != "" {
+			docID = id
+			if bson.IsObjectIdHex(id) {
+				docID = bson.ObjectIdHex(id)
+			}
+		}
+		if data, err = bson.Marshal(append(bson.D{{Name: "_id", Value: docID}}, d...)); err != nil {
+			return
+		}
+	}
+	fields := c.Columns(document)
+	for column := range fields {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		values = append(values, fields[column])
+	}
+	return
+}
+
+// documentID returns the _id of a stored document as it is kept in the id column
+func documentID(data []byte) (id string, err error) {
+	doc := struct {
+		ID interface{} `bson:"_id"`
+	}{}
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return
+	}
+	if objectID, ok := doc.ID.(bson.ObjectId); ok {
+		return objectID.Hex(), nil
+	}
+	return fmt.Sprint(doc.ID), nil
+}
+
+// postgresError converts unique constraint violations to ErrDuplicate
+func postgresError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == postgresUniqueViolation {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func placeholders(first, count int) string {
+	p := make([]string, count)
+	for i := range p {
+		p[i] = fmt.Sprintf("$%d", first+i)
+	}
+	return strings.Join(p, ", ")
+}
+
+// condition returns the where clause that matches all rows if it is empty
+func condition(where string) string {
+	if where == "" {
+		return "TRUE"
+	}
+	return where
+}
+
+func (c *PostgresCollection) query(where string) string {
+	where = condition(where)
+	if !strings.Contains(strings.ToUpper(where), "ORDER BY") {
+		where += " ORDER BY seq"
+	}
+	return fmt.Sprintf("SELECT document FROM %s WHERE %s", c.Table, where)
+}
+
+// Insert stores a new document, ErrDuplicate is returned if it violates a unique constraint
+func (c *PostgresCollection) Insert(pg *sql.DB, document interface{}) error {
+	data, columns, values, err := c.encode(document, "")
+	if err != nil {
+		return err
+	}
+	id, err := documentID(data)
+	if err != nil {
+		return err
+	}
+	columns = append([]string{"id", "document"}, columns...)
+	values = append([]interface{}{id, data}, values...)
+	_, err = pg.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		c.Table, strings.Join(columns, ", "), placeholders(1, len(columns))), values...)
+	return postgresError(err)
+}
+
+// Find unmarshals the documents that match the where clause into result, a pointer to a slice
+func (c *PostgresCollection) Find(pg *sql.DB, result interface{}, where string, args ...interface{}) error {
+	rows, err := pg.Query(c.query(where), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	slice := reflect.ValueOf(result).Elem()
+	slice.Set(slice.Slice(0, 0))
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return err
+		}
+		document := reflect.New(slice.Type().Elem())
+		if err = bson.Unmarshal(data, document.Interface()); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, document.Elem()))
+	}
+	return rows.Err()
+}
+
+// FindOne unmarshals the first document that matches the where clause into result, mgo.ErrNotFound is returned if there is none
+func (c *PostgresCollection) FindOne(pg *sql.DB, result interface{}, where string, args ...interface{}) error {
+	var data []byte
+	err := pg.QueryRow(c.query(where)+" LIMIT 1", args...).Scan(&data)
+	if err == sql.ErrNoRows {
+		return mgo.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, result)
+}
+
+// Count counts the documents that match the where clause
+func (c *PostgresCollection) Count(pg *sql.DB, where string, args ...interface{}) (count int, err error) {
+	err = pg.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", c.Table, condition(where)), args...).Scan(&count)
+	return
+}
+
+// Update changes the documents that match the where clause in a transaction and returns how many were updated.
+// newDocument creates the value the documents are unmarshalled into before they are passed to change.
+func (c *PostgresCollection) Update(pg *sql.DB, where string, args []interface{}, newDocument func() interface{}, change func(document interface{}) error) (updated int, err error) {
+	tx, err := pg.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = postgresError(tx.Commit())
+	}()
+	rows, err := tx.Query(fmt.Sprintf("SELECT id, document FROM %s WHERE %s FOR UPDATE", c.Table, condition(where)), args...)
+	if err != nil {
+		return
+	}
+	type row struct {
+		id   string
+		data []byte
+	}
+	var matches []row
+	for rows.Next() {
+		var r row
+		if err = rows.Scan(&r.id, &r.data); err != nil {
+			rows.Close()
+			return
+		}
+		matches = append(matches, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+	for _, match := range matches {
+		document := newDocument()
+		if err = bson.Unmarshal(match.data, document); err != nil {
+			return
+		}
+		if err = change(document); err != nil {
+			return
+		}
+		var data []byte
+		var columns []string
+		var values []interface{}
+		if data, columns, values, err = c.encode(document, match.id); err != nil {
+			return
+		}
+		assignments := []string{"document = $1"}
+		for i, column := range columns {
+			assignments = append(assignments, fmt.Sprintf("%s = $%d", column, i+2))
+		}
+		values = append([]interface{}{data}, values...)
+		values = append(values, match.id)
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d",
+			c.Table, strings.Join(assignments, ", "), len(values)), values...)
+		if err = postgresError(err); err != nil {
+			return
+		}
+		updated++
+	}
+	return
+}
+
+// Upsert changes the documents that match the where clause, or inserts a new one if none match.
+// The new document is created by newDocument and passed to change before it is inserted.
+func (c *PostgresCollection) Upsert(pg *sql.DB, where string, args []interface{}, newDocument func() interface{}, change func(document interface{}) error) error {
+	updated, err := c.Update(pg, where, args, newDocument, change)
+	if err != nil || updated > 0 {
+		return err
+	}
+	document := newDocument()
+	if err = change(document); err != nil {
+		return err
+	}
+	return c.Insert(pg, document)
+}
+
+// Remove removes the documents that match the where clause and returns how many were removed
+func (c *PostgresCollection) Remove(pg *sql.DB, where string, args ...interface{}) (removed int, err error) {
+	result, err := pg.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", c.Table, condition(where)), args...)
+	if err != nil {
+		return
+	}
+	count, err := result.RowsAffected()
+	removed = int(count)
+	return
+}
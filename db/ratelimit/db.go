@@ -0,0 +1,81 @@
+// Package ratelimit stores the request counters of the rate limits in the database,
+// so all instances of the identity server share them.
+package ratelimit
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	ratelimitCollectionName = "ratelimits"
+	// maxRetries bounds the attempts to start a new window when another instance starts it at the same time
+	maxRetries = 3
+)
+
+// Manager counts the requests per key in fixed windows
+type Manager interface {
+	// Increment counts a request for the key and returns the count in the current window and when the window ends.
+	// A new window of the given period starts when there is no current one.
+	Increment(key string, period time.Duration) (count int, expiresAt time.Time, err error)
+}
+
+// counter is the number of requests for a key in the window that ends at ExpiresAt
+type counter struct {
+	Key       string    `bson:"_id"`
+	Count     int       `bson:"count"`
+	ExpiresAt time.Time `bson:"expiresat"`
+}
+
+// mongoManager stores the counters in mongo, a TTL index removes them when the window ended
+type mongoManager struct {
+	collection *mgo.Collection
+}
+
+// NewManager creates a Manager for the backend of the request
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
+	return &mongoManager{collection: db.GetCollection(db.GetDBSession(r), ratelimitCollectionName)}
+}
+
+// Increment increments the counter of the current window, or starts a new window if it ended
+func (m *mongoManager) Increment(key string, period time.Duration) (count int, expiresAt time.Time, err error) {
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		now := time.Now()
+		var c counter
+		_, err = m.collection.Find(bson.M{"_id": key, "expiresat": bson.M{"$gt": now}}).Apply(mgo.Change{
+			Update:    bson.M{"$inc": bson.M{"count": 1}},
+			ReturnNew: true,
+		}, &c)
+		if err == nil {
+			return c.Count, c.ExpiresAt, nil
+		}
+		if err != mgo.ErrNotFound {
+			return
+		}
+		// No current window, replace the ended one. If another instance started a window in the meantime
+		// the upsert conflicts on the _id and the counter of that window is incremented instead.
+		c = counter{Key: key, Count: 1, ExpiresAt: now.Add(period)}
+		_, err = m.collection.Find(bson.M{"_id": key, "expiresat": bson.M{"$lte": now}}).Apply(mgo.Change{
+			Update:    c,
+			Upsert:    true,
+			ReturnNew: true,
+		}, &c)
+		if err == nil {
+			return c.Count, c.ExpiresAt, nil
+		}
+		if !db.IsDup(err) {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	counters map[string]counter
+}
+
+// memoryManager keeps the counters in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(ratelimitCollectionName, func() interface{} {
+		return &memoryStore{counters: make(map[string]counter)}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) Increment(key string, period time.Duration) (int, time.Time, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	now := time.Now()
+	c, found := m.store.counters[key]
+	if !found || !c.ExpiresAt.After(now) {
+		c = counter{Key: key, ExpiresAt: now.Add(period)}
+	}
+	c.Count++
+	m.store.counters[key] = c
+	return c.Count, c.ExpiresAt, nil
+}
@@ -0,0 +1,26 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"time"
+)
+
+// postgresManager stores the counters in the ratelimits table, the expired rows are removed by the backend
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+// Increment increments or restarts the counter in a single statement, so concurrent requests are counted correctly
+func (m *postgresManager) Increment(key string, period time.Duration) (count int, expiresAt time.Time, err error) {
+	now := time.Now()
+	err = m.db.QueryRow(`INSERT INTO ratelimits (key, count, expires_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN ratelimits.expires_at <= $3 THEN 1 ELSE ratelimits.count + 1 END,
+			expires_at = CASE WHEN ratelimits.expires_at <= $3 THEN EXCLUDED.expires_at ELSE ratelimits.expires_at END
+		RETURNING count, expires_at`, key, now.Add(period), now).Scan(&count, &expiresAt)
+	return
+}
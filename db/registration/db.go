@@ -2,7 +2,6 @@ package registration
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/itsyouonline/identityserver/db"
 	mgo "gopkg.in/mgo.v2"
@@ -13,62 +12,43 @@ const (
 	mongoRegistrationsInProgressCollectionName = "registrationsinprogress"
 )
 
-// InitModels intializes the mongo models
-func InitModels() {
-	index := mgo.Index{
-		Key:    []string{"sessionkey"},
-		Unique: true,
-	}
-
-	db.EnsureIndex(mongoRegistrationsInProgressCollectionName, index)
-
-	index = mgo.Index{
-		Key:    []string{"emailvalidationkey"},
-		Unique: false, // Uniqueness is enforced in the respective ongoing validation collection
-	}
-
-	db.EnsureIndex(mongoRegistrationsInProgressCollectionName, index)
-
-	index = mgo.Index{
-		Key:    []string{"phonevalidationkey"},
-		Unique: false, // Uniqueness is enforced in the respective ongoing validation collection
-	}
-
-	db.EnsureIndex(mongoRegistrationsInProgressCollectionName, index)
-
-	automaticExpiration := mgo.Index{
-		Key:         []string{"createdat"},
-		ExpireAfter: time.Second * 60 * 60 * 24, // Remove after one day
-		Background:  true,
-	}
-
-	db.EnsureIndex(mongoRegistrationsInProgressCollectionName, automaticExpiration)
+// Manager is used to store the registrations in progress
+type Manager interface {
+	UpsertRegisteringUser(ipr *InProgressRegistration) error
+	GetRegisteringUserBySessionKey(sessionKey string) (*InProgressRegistration, error)
+	DeleteRegisteringUser(sessionKey string) error
 }
 
-// Manager is used to store organizations
-type Manager struct {
+// mongoManager stores the registrations in progress in mongo
+type mongoManager struct {
 	session    *mgo.Session
 	collection *mgo.Collection
 }
 
 //NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session:    session,
 		collection: db.GetCollection(session, mongoRegistrationsInProgressCollectionName),
 	}
 }
 
 // UpsertRegisteringUser creates a new or updates an existing entry in the db for a user currenly registering
-func (m *Manager) UpsertRegisteringUser(ipr *InProgressRegistration) error {
+func (m *mongoManager) UpsertRegisteringUser(ipr *InProgressRegistration) error {
 	selector := bson.M{"sessionkey": ipr.SessionKey}
 	_, err := m.collection.Upsert(selector, ipr)
 	return err
 }
 
 // GetRegisteringUserBySessionKey returns a user object of an in progress registration
-func (m *Manager) GetRegisteringUserBySessionKey(sessionKey string) (*InProgressRegistration, error) {
+func (m *mongoManager) GetRegisteringUserBySessionKey(sessionKey string) (*InProgressRegistration, error) {
 	var ipr InProgressRegistration
 
 	err := m.collection.Find(bson.M{"sessionkey": sessionKey}).One(&ipr)
@@ -77,7 +57,7 @@ func (m *Manager) GetRegisteringUserBySessionKey(sessionKey string) (*InProgress
 }
 
 // DeleteRegisteringUser deletes a registering user
-func (m *Manager) DeleteRegisteringUser(sessionKey string) error {
+func (m *mongoManager) DeleteRegisteringUser(sessionKey string) error {
 	return m.collection.Remove(bson.M{"sessionkey": sessionKey})
 }
 
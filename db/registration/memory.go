@@ -0,0 +1,56 @@
+package registration
+
+import (
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// registrationValidity is the expiration of the registrations in progress in mongo
+const registrationValidity = 24 * time.Hour
+
+type memoryStore struct {
+	sync.Mutex
+	registrations map[string]InProgressRegistration
+}
+
+// memoryManager keeps the registrations in progress in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoRegistrationsInProgressCollectionName, func() interface{} {
+		return &memoryStore{registrations: make(map[string]InProgressRegistration)}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) UpsertRegisteringUser(ipr *InProgressRegistration) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.registrations[ipr.SessionKey] = *ipr
+	return nil
+}
+
+func (m *memoryManager) GetRegisteringUserBySessionKey(sessionKey string) (*InProgressRegistration, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	ipr, ok := m.store.registrations[sessionKey]
+	if !ok || time.Since(ipr.CreatedAt) > registrationValidity {
+		return &InProgressRegistration{}, mgo.ErrNotFound
+	}
+	return &ipr, nil
+}
+
+func (m *memoryManager) DeleteRegisteringUser(sessionKey string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, ok := m.store.registrations[sessionKey]; !ok {
+		return mgo.ErrNotFound
+	}
+	delete(m.store.registrations, sessionKey)
+	return nil
+}
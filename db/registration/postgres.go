@@ -0,0 +1,48 @@
+package registration
+
+import (
+	"database/sql"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+)
+
+var postgresRegistrations = &db.PostgresCollection{
+	Table: "registrationsinprogress",
+	Columns: func(document interface{}) map[string]interface{} {
+		ipr := document.(*InProgressRegistration)
+		return map[string]interface{}{
+			"sessionkey": ipr.SessionKey,
+			"expires_at": ipr.CreatedAt.Add(registrationValidity),
+		}
+	},
+}
+
+// postgresManager stores the registrations in progress in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) UpsertRegisteringUser(ipr *InProgressRegistration) error {
+	return postgresRegistrations.Upsert(m.db, "sessionkey = $1", []interface{}{ipr.SessionKey},
+		func() interface{} { return &InProgressRegistration{} },
+		func(document interface{}) error { return db.CopyDocument(document, ipr) })
+}
+
+func (m *postgresManager) GetRegisteringUserBySessionKey(sessionKey string) (*InProgressRegistration, error) {
+	var ipr InProgressRegistration
+	err := postgresRegistrations.FindOne(m.db, &ipr, "sessionkey = $1", sessionKey)
+	return &ipr, err
+}
+
+func (m *postgresManager) DeleteRegisteringUser(sessionKey string) error {
+	removed, err := postgresRegistrations.Remove(m.db, "sessionkey = $1", sessionKey)
+	if err == nil && removed == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
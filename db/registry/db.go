@@ -20,45 +20,35 @@ var ErrUsernameOrGlobalIDRequired = errors.New("Username or globalid is required
 //ErrUsernameAndGlobalIDAreMutuallyExclusive is the error given when both a username and a globalid were given
 var ErrUsernameAndGlobalIDAreMutuallyExclusive = errors.New("Username and globalid can not both be specified")
 
-//InitModels initialize models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:    []string{"username"},
-		Unique: true,
-	}
-
-	db.EnsureIndex(mongoRegistryCollectionName, index)
-
-	index = mgo.Index{
-		Key:    []string{"globalid"},
-		Unique: true,
-	}
-
-	db.EnsureIndex(mongoRegistryCollectionName, index)
-
-	index = mgo.Index{
-		Key:    []string{"entries.key"},
-		Unique: true,
-	}
-
-	db.EnsureIndex(mongoRegistryCollectionName, index)
-
+//Manager is used to store KeyValuePairs in a user or organization registry
+type Manager interface {
+	DeleteRegistryEntry(username string, globalid string, key string) (err error)
+	UpsertRegistryEntry(username string, globalid string, registryEntry RegistryEntry) (err error)
+	ListRegistryEntries(username string, globalid string) (registryEntries []RegistryEntry, err error)
+	GetRegistryEntry(username string, globalid string, key string) (registryEntry *RegistryEntry, err error)
+	RemoveByUser(username string) (err error)
 }
 
-//Manager is used to store KeyValuePairs in a user or organization registry
-type Manager struct {
+//mongoManager stores the registries in mongo
+type mongoManager struct {
 	session *mgo.Session
 }
 
 //NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session: session,
 	}
 }
 
-func (m *Manager) getRegistryCollection() *mgo.Collection {
+func (m *mongoManager) getRegistryCollection() *mgo.Collection {
 	return db.GetCollection(m.session, mongoRegistryCollectionName)
 }
 
@@ -88,7 +78,7 @@ func createSelector(username, globalid, key string) (selector bson.M, err error)
 //DeleteRegistryEntry deletes a registry entry
 // Either a username or a globalid needs to be given
 // If the key does not exist, no error is returned
-func (m *Manager) DeleteRegistryEntry(username string, globalid string, key string) (err error) {
+func (m *mongoManager) DeleteRegistryEntry(username string, globalid string, key string) (err error) {
 	selector, err := createSelector(username, globalid, key)
 	if err != nil {
 		return
@@ -103,7 +93,7 @@ func (m *Manager) DeleteRegistryEntry(username string, globalid string, key stri
 
 //UpsertRegistryEntry updates or inserts a registry entry
 // Either a username or a globalid needs to be given
-func (m *Manager) UpsertRegistryEntry(username string, globalid string, registryEntry RegistryEntry) (err error) {
+func (m *mongoManager) UpsertRegistryEntry(username string, globalid string, registryEntry RegistryEntry) (err error) {
 	selector, err := createSelector(username, globalid, registryEntry.Key)
 	if err != nil {
 		return
@@ -122,7 +112,7 @@ func (m *Manager) UpsertRegistryEntry(username string, globalid string, registry
 }
 
 //ListRegistryEntries gets all registry entries for a user or organization
-func (m *Manager) ListRegistryEntries(username string, globalid string) (registryEntries []RegistryEntry, err error) {
+func (m *mongoManager) ListRegistryEntries(username string, globalid string) (registryEntries []RegistryEntry, err error) {
 	var selector bson.M
 	if username != "" {
 		selector = bson.M{"username": username}
@@ -144,7 +134,7 @@ func (m *Manager) ListRegistryEntries(username string, globalid string) (registr
 
 // GetRegistryEntry gets a registryentry for a user or organization
 // If no such entry exists, nil is returned, both for the registryEntry and error
-func (m *Manager) GetRegistryEntry(username string, globalid string, key string) (registryEntry *RegistryEntry, err error) {
+func (m *mongoManager) GetRegistryEntry(username string, globalid string, key string) (registryEntry *RegistryEntry, err error) {
 	selector, err := createSelector(username, globalid, key)
 	result := struct {
 		Entries []RegistryEntry
@@ -160,3 +150,12 @@ func (m *Manager) GetRegistryEntry(username string, globalid string, key string)
 	return
 
 }
+
+//RemoveByUser removes the registry of a user
+func (m *mongoManager) RemoveByUser(username string) (err error) {
+	if err = validateUsernameAndGlobalID(username, ""); err != nil {
+		return
+	}
+	_, err = m.getRegistryCollection().RemoveAll(bson.M{"username": username})
+	return
+}
@@ -3,21 +3,46 @@ package registry
 import (
 	"testing"
 
+	"github.com/itsyouonline/identityserver/db"
 	"github.com/stretchr/testify/assert"
 )
 
+func testManagers() []Manager {
+	return []Manager{&mongoManager{}, newMemoryManager(db.NewMemoryBackend())}
+}
+
 func TestUpsertRegistryEntry(t *testing.T) {
-	m := &Manager{}
-	err := m.UpsertRegistryEntry("", "", RegistryEntry{})
-	assert.Equal(t, ErrUsernameOrGlobalIDRequired, err)
-	err = m.UpsertRegistryEntry("username", "globalid", RegistryEntry{})
-	assert.Equal(t, ErrUsernameAndGlobalIDAreMutuallyExclusive, err)
+	for _, m := range testManagers() {
+		err := m.UpsertRegistryEntry("", "", RegistryEntry{})
+		assert.Equal(t, ErrUsernameOrGlobalIDRequired, err)
+		err = m.UpsertRegistryEntry("username", "globalid", RegistryEntry{})
+		assert.Equal(t, ErrUsernameAndGlobalIDAreMutuallyExclusive, err)
+	}
 }
 
 func TestDeleteRegistryEntry(t *testing.T) {
-	m := &Manager{}
-	err := m.DeleteRegistryEntry("", "", "RegistryEntryKey")
-	assert.Equal(t, ErrUsernameOrGlobalIDRequired, err)
-	err = m.DeleteRegistryEntry("username", "globalid", "RegistryEntryKey")
-	assert.Equal(t, ErrUsernameAndGlobalIDAreMutuallyExclusive, err)
+	for _, m := range testManagers() {
+		err := m.DeleteRegistryEntry("", "", "RegistryEntryKey")
+		assert.Equal(t, ErrUsernameOrGlobalIDRequired, err)
+		err = m.DeleteRegistryEntry("username", "globalid", "RegistryEntryKey")
+		assert.Equal(t, ErrUsernameAndGlobalIDAreMutuallyExclusive, err)
+	}
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	m := newMemoryManager(db.NewMemoryBackend())
+	assert.NoError(t, m.UpsertRegistryEntry("alice", "", RegistryEntry{Key: "k", Value: "1"}))
+	assert.NoError(t, m.UpsertRegistryEntry("alice", "", RegistryEntry{Key: "k", Value: "2"}))
+	entries, err := m.ListRegistryEntries("alice", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []RegistryEntry{{Key: "k", Value: "2"}}, entries)
+
+	entry, err := m.GetRegistryEntry("", "alice", "k")
+	assert.NoError(t, err)
+	assert.Nil(t, entry)
+
+	assert.NoError(t, m.DeleteRegistryEntry("alice", "", "k"))
+	entry, err = m.GetRegistryEntry("alice", "", "k")
+	assert.NoError(t, err)
+	assert.Nil(t, entry)
 }
@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"sync"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+// registryOwner identifies the user or organization a registry belongs to
+type registryOwner struct {
+	username string
+	globalid string
+}
+
+type memoryStore struct {
+	sync.Mutex
+	registries map[registryOwner][]RegistryEntry
+}
+
+//memoryManager keeps the registries in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoRegistryCollectionName, func() interface{} {
+		return &memoryStore{registries: make(map[registryOwner][]RegistryEntry)}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) DeleteRegistryEntry(username string, globalid string, key string) (err error) {
+	if err = validateUsernameAndGlobalID(username, globalid); err != nil {
+		return
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	owner := registryOwner{username, globalid}
+	entries := []RegistryEntry{}
+	for _, entry := range m.store.registries[owner] {
+		if entry.Key != key {
+			entries = append(entries, entry)
+		}
+	}
+	if _, exists := m.store.registries[owner]; exists {
+		m.store.registries[owner] = entries
+	}
+	return
+}
+
+func (m *memoryManager) UpsertRegistryEntry(username string, globalid string, registryEntry RegistryEntry) (err error) {
+	if err = validateUsernameAndGlobalID(username, globalid); err != nil {
+		return
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	owner := registryOwner{username, globalid}
+	entries := append([]RegistryEntry{}, m.store.registries[owner]...)
+	for i, entry := range entries {
+		if entry.Key == registryEntry.Key {
+			entries[i].Value = registryEntry.Value
+			m.store.registries[owner] = entries
+			return
+		}
+	}
+	m.store.registries[owner] = append(entries, registryEntry)
+	return
+}
+
+func (m *memoryManager) ListRegistryEntries(username string, globalid string) (registryEntries []RegistryEntry, err error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	registryEntries = append([]RegistryEntry{}, m.store.registries[registryOwner{username, globalid}]...)
+	return
+}
+
+func (m *memoryManager) GetRegistryEntry(username string, globalid string, key string) (registryEntry *RegistryEntry, err error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for _, entry := range m.store.registries[registryOwner{username, globalid}] {
+		if entry.Key == key {
+			registryEntry = &entry
+			return
+		}
+	}
+	return
+}
+
+func (m *memoryManager) RemoveByUser(username string) (err error) {
+	if err = validateUsernameAndGlobalID(username, ""); err != nil {
+		return
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	delete(m.store.registries, registryOwner{username: username})
+	return
+}
@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"database/sql"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+)
+
+// registryDocument is the registry of a user or organization as it is stored in mongo
+type registryDocument struct {
+	Username string `bson:",omitempty"`
+	Globalid string `bson:",omitempty"`
+	Entries  []RegistryEntry
+}
+
+var postgresRegistries = &db.PostgresCollection{
+	Table: "registry",
+	Columns: func(document interface{}) map[string]interface{} {
+		registry := document.(*registryDocument)
+		return map[string]interface{}{
+			"username": registry.Username,
+			"globalid": registry.Globalid,
+		}
+	},
+}
+
+//postgresManager stores the registries in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+// ownerCondition selects the registry of a user or organization, the other one is empty
+const ownerCondition = "username = $1 AND globalid = $2"
+
+func (m *postgresManager) DeleteRegistryEntry(username string, globalid string, key string) (err error) {
+	if err = validateUsernameAndGlobalID(username, globalid); err != nil {
+		return
+	}
+	_, err = postgresRegistries.Update(m.db, ownerCondition, []interface{}{username, globalid},
+		func() interface{} { return &registryDocument{} },
+		func(document interface{}) error {
+			registry := document.(*registryDocument)
+			entries := []RegistryEntry{}
+			for _, entry := range registry.Entries {
+				if entry.Key != key {
+					entries = append(entries, entry)
+				}
+			}
+			registry.Entries = entries
+			return nil
+		})
+	return
+}
+
+func (m *postgresManager) UpsertRegistryEntry(username string, globalid string, registryEntry RegistryEntry) (err error) {
+	if err = validateUsernameAndGlobalID(username, globalid); err != nil {
+		return
+	}
+	return postgresRegistries.Upsert(m.db, ownerCondition, []interface{}{username, globalid},
+		func() interface{} { return &registryDocument{Username: username, Globalid: globalid} },
+		func(document interface{}) error {
+			registry := document.(*registryDocument)
+			for i, entry := range registry.Entries {
+				if entry.Key == registryEntry.Key {
+					registry.Entries[i].Value = registryEntry.Value
+					return nil
+				}
+			}
+			registry.Entries = append(registry.Entries, registryEntry)
+			return nil
+		})
+}
+
+func (m *postgresManager) ListRegistryEntries(username string, globalid string) ([]RegistryEntry, error) {
+	var registry registryDocument
+	err := postgresRegistries.FindOne(m.db, &registry, ownerCondition, username, globalid)
+	if err == mgo.ErrNotFound {
+		return []RegistryEntry{}, nil
+	}
+	return registry.Entries, err
+}
+
+func (m *postgresManager) GetRegistryEntry(username string, globalid string, key string) (*RegistryEntry, error) {
+	entries, err := m.ListRegistryEntries(username, globalid)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Key == key {
+			return &entry, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *postgresManager) RemoveByUser(username string) (err error) {
+	if err = validateUsernameAndGlobalID(username, ""); err != nil {
+		return
+	}
+	_, err = postgresRegistries.Remove(m.db, "username = $1", username)
+	return
+}
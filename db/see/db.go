@@ -13,19 +13,19 @@ const (
 	mongoCollectionName = "see"
 )
 
-//InitModels initialize models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:      []string{"username", "globalid", "uniqueid"},
-		Unique:   true,
-		DropDups: true,
-	}
-
-	db.EnsureIndex(mongoCollectionName, index)
+//Manager is used to store see objects
+type Manager interface {
+	GetSeeObjects(username string) (seeObjects []See, err error)
+	GetSeeObjectsByOrganization(username string, globalID string) (seeObjects []See, err error)
+	GetSeeObject(username string, globalID string, uniqueID string) (seeObject *See, err error)
+	Create(see *See) error
+	AddVersion(username string, globalID string, uniqueID string, seeVersion *SeeVersion) error
+	Update(see *See) error
+	RemoveByUser(username string) error
 }
 
-//Manager is used to store users
-type Manager struct {
+//mongoManager stores the see objects in mongo
+type mongoManager struct {
 	session    *mgo.Session
 	collection *mgo.Collection
 }
@@ -35,16 +35,22 @@ func getCollection(session *mgo.Session) *mgo.Collection {
 }
 
 //NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session:    session,
 		collection: getCollection(session),
 	}
 }
 
 // GetSeeObjects returns all see object for a specific username
-func (m *Manager) GetSeeObjects(username string) (seeObjects []See, err error) {
+func (m *mongoManager) GetSeeObjects(username string) (seeObjects []See, err error) {
 	qry := bson.M{"username": username}
 	err = m.collection.Find(qry).Sort("-versions.creationdate").All(&seeObjects)
 	if seeObjects == nil {
@@ -54,7 +60,7 @@ func (m *Manager) GetSeeObjects(username string) (seeObjects []See, err error) {
 }
 
 // GetSeeObjectsByOrganization returns all see object for a specific username / organization
-func (m *Manager) GetSeeObjectsByOrganization(username string, globalID string) (seeObjects []See, err error) {
+func (m *mongoManager) GetSeeObjectsByOrganization(username string, globalID string) (seeObjects []See, err error) {
 	qry := bson.M{"username": username, "globalid": globalID}
 	err = m.collection.Find(qry).Sort("-versions.creationdate").All(&seeObjects)
 	if seeObjects == nil {
@@ -64,14 +70,14 @@ func (m *Manager) GetSeeObjectsByOrganization(username string, globalID string)
 }
 
 // GetSeeObject returns a see object
-func (m *Manager) GetSeeObject(username string, globalID string, uniqueID string) (seeObject *See, err error) {
+func (m *mongoManager) GetSeeObject(username string, globalID string, uniqueID string) (seeObject *See, err error) {
 	qry := bson.M{"username": username, "globalid": globalID, "uniqueid": uniqueID}
 	err = m.collection.Find(qry).One(&seeObject)
 	return
 }
 
 // Create an object
-func (m *Manager) Create(see *See) error {
+func (m *mongoManager) Create(see *See) error {
 	see.ID = bson.NewObjectId()
 	err := m.collection.Insert(see)
 	if mgo.IsDup(err) {
@@ -81,12 +87,18 @@ func (m *Manager) Create(see *See) error {
 }
 
 // AddVersion adds a new version to the object
-func (m *Manager) AddVersion(username string, globalID string, uniqueID string, seeVersion *SeeVersion) error {
+func (m *mongoManager) AddVersion(username string, globalID string, uniqueID string, seeVersion *SeeVersion) error {
 	qry := bson.M{"username": username, "globalid": globalID, "uniqueid": uniqueID}
 	return m.collection.Update(qry, bson.M{"$push": bson.M{"versions": seeVersion}})
 }
 
 // Update adds a signature to an existing version
-func (m *Manager) Update(see *See) error {
+func (m *mongoManager) Update(see *See) error {
 	return m.collection.UpdateId(see.ID, see)
 }
+
+// RemoveByUser removes all see objects of a user
+func (m *mongoManager) RemoveByUser(username string) error {
+	_, err := m.collection.RemoveAll(bson.M{"username": username})
+	return err
+}
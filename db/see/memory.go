@@ -0,0 +1,142 @@
+package see
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	objects []See
+}
+
+//memoryManager keeps the see objects in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoCollectionName, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+// latestVersion returns the creation date of the newest version, see objects are sorted on it
+func latestVersion(see *See) (latest time.Time) {
+	for _, version := range see.Versions {
+		if version.CreationDate != nil && time.Time(*version.CreationDate).After(latest) {
+			latest = time.Time(*version.CreationDate)
+		}
+	}
+	return
+}
+
+// find returns copies of the see objects that match with the newest first
+func (m *memoryManager) find(match func(see *See) bool) (seeObjects []See, err error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	seeObjects = []See{}
+	for _, see := range m.store.objects {
+		if !match(&see) {
+			continue
+		}
+		var copied See
+		if err = db.CopyDocument(&copied, &see); err != nil {
+			return
+		}
+		seeObjects = append(seeObjects, copied)
+	}
+	sort.SliceStable(seeObjects, func(i, j int) bool {
+		return latestVersion(&seeObjects[i]).After(latestVersion(&seeObjects[j]))
+	})
+	return
+}
+
+func (m *memoryManager) GetSeeObjects(username string) ([]See, error) {
+	return m.find(func(see *See) bool { return see.Username == username })
+}
+
+func (m *memoryManager) GetSeeObjectsByOrganization(username string, globalID string) ([]See, error) {
+	return m.find(func(see *See) bool { return see.Username == username && see.Globalid == globalID })
+}
+
+func (m *memoryManager) GetSeeObject(username string, globalID string, uniqueID string) (*See, error) {
+	seeObjects, err := m.find(func(see *See) bool {
+		return see.Username == username && see.Globalid == globalID && see.Uniqueid == uniqueID
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(seeObjects) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return &seeObjects[0], nil
+}
+
+func (m *memoryManager) Create(see *See) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for _, existing := range m.store.objects {
+		if existing.Username == see.Username && existing.Globalid == see.Globalid && existing.Uniqueid == see.Uniqueid {
+			return db.ErrDuplicate
+		}
+	}
+	see.ID = bson.NewObjectId()
+	var stored See
+	if err := db.CopyDocument(&stored, see); err != nil {
+		return err
+	}
+	m.store.objects = append(m.store.objects, stored)
+	return nil
+}
+
+func (m *memoryManager) AddVersion(username string, globalID string, uniqueID string, seeVersion *SeeVersion) error {
+	var version SeeVersion
+	if err := db.CopyDocument(&version, seeVersion); err != nil {
+		return err
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	for i, see := range m.store.objects {
+		if see.Username == username && see.Globalid == globalID && see.Uniqueid == uniqueID {
+			m.store.objects[i].Versions = append(append([]SeeVersion{}, see.Versions...), version)
+			return nil
+		}
+	}
+	return mgo.ErrNotFound
+}
+
+func (m *memoryManager) Update(see *See) error {
+	var stored See
+	if err := db.CopyDocument(&stored, see); err != nil {
+		return err
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	for i, existing := range m.store.objects {
+		if existing.ID == see.ID {
+			m.store.objects[i] = stored
+			return nil
+		}
+	}
+	return mgo.ErrNotFound
+}
+
+func (m *memoryManager) RemoveByUser(username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	remaining := []See{}
+	for _, see := range m.store.objects {
+		if see.Username != username {
+			remaining = append(remaining, see)
+		}
+	}
+	m.store.objects = remaining
+	return nil
+}
@@ -0,0 +1,94 @@
+package see
+
+import (
+	"database/sql"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var postgresObjects = &db.PostgresCollection{
+	Table: "see",
+	Columns: func(document interface{}) map[string]interface{} {
+		see := document.(*See)
+		var latest interface{}
+		if latestVersion := latestVersion(see); !latestVersion.IsZero() {
+			latest = latestVersion
+		}
+		return map[string]interface{}{
+			"username":      see.Username,
+			"globalid":      see.Globalid,
+			"uniqueid":      see.Uniqueid,
+			"latestversion": latest,
+		}
+	},
+}
+
+// newestFirst sorts the see objects on the creation date of their newest version
+const newestFirst = " ORDER BY latestversion DESC NULLS LAST, seq"
+
+//postgresManager stores the see objects in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func newSee() interface{} {
+	return &See{}
+}
+
+func (m *postgresManager) GetSeeObjects(username string) ([]See, error) {
+	seeObjects := []See{}
+	err := postgresObjects.Find(m.db, &seeObjects, "username = $1"+newestFirst, username)
+	return seeObjects, err
+}
+
+func (m *postgresManager) GetSeeObjectsByOrganization(username string, globalID string) ([]See, error) {
+	seeObjects := []See{}
+	err := postgresObjects.Find(m.db, &seeObjects, "username = $1 AND globalid = $2"+newestFirst, username, globalID)
+	return seeObjects, err
+}
+
+func (m *postgresManager) GetSeeObject(username string, globalID string, uniqueID string) (*See, error) {
+	var see See
+	if err := postgresObjects.FindOne(m.db, &see, "username = $1 AND globalid = $2 AND uniqueid = $3", username, globalID, uniqueID); err != nil {
+		return nil, err
+	}
+	return &see, nil
+}
+
+func (m *postgresManager) Create(see *See) error {
+	see.ID = bson.NewObjectId()
+	return postgresObjects.Insert(m.db, see)
+}
+
+func (m *postgresManager) AddVersion(username string, globalID string, uniqueID string, seeVersion *SeeVersion) error {
+	updated, err := postgresObjects.Update(m.db, "username = $1 AND globalid = $2 AND uniqueid = $3", []interface{}{username, globalID, uniqueID}, newSee,
+		func(document interface{}) error {
+			see := document.(*See)
+			see.Versions = append(see.Versions, *seeVersion)
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) Update(see *See) error {
+	updated, err := postgresObjects.Update(m.db, "id = $1", []interface{}{see.ID.Hex()}, newSee,
+		func(document interface{}) error { return db.CopyDocument(document, see) })
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) RemoveByUser(username string) error {
+	_, err := postgresObjects.Remove(m.db, "username = $1", username)
+	return err
+}
@@ -1,6 +1,7 @@
 package smshistory
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/itsyouonline/identityserver/db"
@@ -12,18 +13,24 @@ const (
 	smshistoryCollectionName = "smshistory"
 )
 
-// InitModels initialize models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:    []string{"phonenumber"},
-		Unique: true,
-	}
-
-	db.EnsureIndex(smshistoryCollectionName, index)
+// Manager is used to store the history of sent sms
+type Manager interface {
+	AddSMSHistory(sh *SmsHistory) error
+	// UpdateSMSHistory stores how an sms that was added to the history was sent
+	UpdateSMSHistory(sh *SmsHistory) error
+	CountSMSHistorySince(phonenumber string, since time.Time) (int, error)
+	GetByPhonenumbers(phonenumbers []string) ([]SmsHistory, error)
+	Get(id string) (*SmsHistory, error)
+	// GetLastSince returns the last sms sent to a phone number since a moment, mgo.ErrNotFound if there is none
+	GetLastSince(phonenumber string, since time.Time) (*SmsHistory, error)
+	// RemoveBefore removes the history of the sms sent before a moment
+	RemoveBefore(before time.Time) (removed int, err error)
+	// RemoveByPhonenumbers removes the history of the sms sent to any of the phone numbers
+	RemoveByPhonenumbers(phonenumbers []string) error
 }
 
-// Manager is used to store grants
-type Manager struct {
+// mongoManager stores the sms history in mongo
+type mongoManager struct {
 	session    *mgo.Session
 	collection *mgo.Collection
 }
@@ -33,19 +40,74 @@ func getCollection(session *mgo.Session) *mgo.Collection {
 }
 
 // NewManager creates and initializes a new Manager
-func NewManager(sess *mgo.Session) *Manager {
-	return &Manager{
-		session:    sess,
-		collection: getCollection(sess),
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
+	session := db.GetDBSession(r)
+	return &mongoManager{
+		session:    session,
+		collection: getCollection(session),
 	}
 }
 
 // AddSMSHistory adds SmsHistory to the database
-func (m *Manager) AddSMSHistory(sh *SmsHistory) error {
+func (m *mongoManager) AddSMSHistory(sh *SmsHistory) error {
+	if sh.ID == "" {
+		sh.ID = bson.NewObjectId()
+	}
 	return m.collection.Insert(sh)
 }
 
+// UpdateSMSHistory stores how an sms that was added to the history was sent
+func (m *mongoManager) UpdateSMSHistory(sh *SmsHistory) error {
+	return m.collection.UpdateId(sh.ID, sh)
+}
+
 // CountSMSHistorySince counts the amount of sms sent to a phone number since a specific time
-func (m *Manager) CountSMSHistorySince(phonenumber string, since time.Time) (int, error) {
+func (m *mongoManager) CountSMSHistorySince(phonenumber string, since time.Time) (int, error) {
 	return m.collection.Find(bson.M{"createdat": bson.M{"$gte": since}}).Count()
 }
+
+// GetByPhonenumbers lists the sms sent to any of the phone numbers
+func (m *mongoManager) GetByPhonenumbers(phonenumbers []string) ([]SmsHistory, error) {
+	var history []SmsHistory
+	err := m.collection.Find(bson.M{"phonenumber": bson.M{"$in": phonenumbers}}).All(&history)
+	return history, err
+}
+
+// Get returns an sms by its id
+func (m *mongoManager) Get(id string) (*SmsHistory, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, mgo.ErrNotFound
+	}
+	sh := &SmsHistory{}
+	err := m.collection.FindId(bson.ObjectIdHex(id)).One(sh)
+	return sh, err
+}
+
+// GetLastSince returns the last sms sent to a phone number since a moment
+func (m *mongoManager) GetLastSince(phonenumber string, since time.Time) (*SmsHistory, error) {
+	sh := &SmsHistory{}
+	err := m.collection.Find(bson.M{"phonenumber": phonenumber, "createdat": bson.M{"$gte": since}}).
+		Sort("-createdat").One(sh)
+	return sh, err
+}
+
+// RemoveBefore removes the history of the sms sent before a moment
+func (m *mongoManager) RemoveBefore(before time.Time) (int, error) {
+	info, err := m.collection.RemoveAll(bson.M{"createdat": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Removed, nil
+}
+
+// RemoveByPhonenumbers removes the history of the sms sent to any of the phone numbers
+func (m *mongoManager) RemoveByPhonenumbers(phonenumbers []string) error {
+	_, err := m.collection.RemoveAll(bson.M{"phonenumber": bson.M{"$in": phonenumbers}})
+	return err
+}
@@ -0,0 +1,135 @@
+package smshistory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	history []SmsHistory
+}
+
+// memoryManager keeps the sms history in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(smshistoryCollectionName, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) AddSMSHistory(sh *SmsHistory) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if sh.ID == "" {
+		sh.ID = bson.NewObjectId()
+	}
+	m.store.history = append(m.store.history, *sh)
+	return nil
+}
+
+func (m *memoryManager) UpdateSMSHistory(sh *SmsHistory) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for i := range m.store.history {
+		if m.store.history[i].ID == sh.ID {
+			m.store.history[i] = *sh
+			return nil
+		}
+	}
+	return mgo.ErrNotFound
+}
+
+// CountSMSHistorySince counts like the mongo implementation, which does not filter on the phone number
+func (m *memoryManager) CountSMSHistorySince(phonenumber string, since time.Time) (int, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	count := 0
+	for _, sh := range m.store.history {
+		if !sh.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memoryManager) GetByPhonenumbers(phonenumbers []string) ([]SmsHistory, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	var history []SmsHistory
+	for _, sh := range m.store.history {
+		for _, phonenumber := range phonenumbers {
+			if sh.Phonenumber == phonenumber {
+				history = append(history, sh)
+				break
+			}
+		}
+	}
+	return history, nil
+}
+
+func (m *memoryManager) Get(id string) (*SmsHistory, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for _, sh := range m.store.history {
+		if sh.ID.Hex() == id {
+			return &sh, nil
+		}
+	}
+	return nil, mgo.ErrNotFound
+}
+
+func (m *memoryManager) GetLastSince(phonenumber string, since time.Time) (*SmsHistory, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	var last *SmsHistory
+	for i, sh := range m.store.history {
+		if sh.Phonenumber == phonenumber && !sh.CreatedAt.Before(since) && (last == nil || !sh.CreatedAt.Before(last.CreatedAt)) {
+			last = &m.store.history[i]
+		}
+	}
+	if last == nil {
+		return nil, mgo.ErrNotFound
+	}
+	found := *last
+	return &found, nil
+}
+
+func (m *memoryManager) RemoveBefore(before time.Time) (int, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	remaining := []SmsHistory{}
+	for _, sh := range m.store.history {
+		if !sh.CreatedAt.Before(before) {
+			remaining = append(remaining, sh)
+		}
+	}
+	removed := len(m.store.history) - len(remaining)
+	m.store.history = remaining
+	return removed, nil
+}
+
+func (m *memoryManager) RemoveByPhonenumbers(phonenumbers []string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	remove := map[string]bool{}
+	for _, phonenumber := range phonenumbers {
+		remove[phonenumber] = true
+	}
+	remaining := []SmsHistory{}
+	for _, sh := range m.store.history {
+		if !remove[sh.Phonenumber] {
+			remaining = append(remaining, sh)
+		}
+	}
+	m.store.history = remaining
+	return nil
+}
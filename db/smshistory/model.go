@@ -1,11 +1,38 @@
 package smshistory
 
-import "time"
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Delivery status of an sms, it stays empty if the provider does not report it
+const (
+	// StatusSent means the provider accepted the sms
+	StatusSent = "sent"
+	// StatusDelivered means the sms reached the phone
+	StatusDelivered = "delivered"
+	// StatusFailed means no provider accepted the sms or it could not be delivered to the phone
+	StatusFailed = "failed"
+)
 
 // SmsHistory represents an sms sent at a timestamp to a phonenumber
 type SmsHistory struct {
+	ID          bson.ObjectId `bson:"_id,omitempty" json:"-"`
 	Phonenumber string
 	CreatedAt   time.Time
+	// Route is the phone number prefix of the routing rule that was used, empty for the default providers
+	Route string
+	// Provider is the sms provider that accepted the sms, it is empty if every provider failed
+	Provider string
+	// FailedProviders are the providers that failed to send the sms before it, in the order they were tried
+	FailedProviders []string
+	// MessageID is the id the provider gave the sms, the status callbacks of the provider refer to it
+	MessageID string
+	Status    string
+	// StatusDetail is the error the provider reported when the sms failed
+	StatusDetail    string
+	StatusUpdatedAt time.Time
 }
 
 // New creates a new SmsHistory
@@ -15,3 +42,15 @@ func New(phonenumber string) *SmsHistory {
 		CreatedAt:   time.Now(),
 	}
 }
+
+// SetStatus changes the delivery status, a delivered or failed sms keeps its status
+// because the status callbacks of the providers can arrive out of order
+func (sh *SmsHistory) SetStatus(status string, detail string) bool {
+	if sh.Status == StatusDelivered || sh.Status == StatusFailed {
+		return false
+	}
+	sh.Status = status
+	sh.StatusDetail = detail
+	sh.StatusUpdatedAt = time.Now()
+	return true
+}
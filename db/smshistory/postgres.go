@@ -0,0 +1,85 @@
+package smshistory
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/lib/pq"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var postgresHistory = &db.PostgresCollection{
+	Table: smshistoryCollectionName,
+	Columns: func(document interface{}) map[string]interface{} {
+		sh := document.(*SmsHistory)
+		return map[string]interface{}{
+			"phonenumber": sh.Phonenumber,
+			"createdat":   sh.CreatedAt,
+		}
+	},
+}
+
+// postgresManager stores the sms history in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) AddSMSHistory(sh *SmsHistory) error {
+	if sh.ID == "" {
+		sh.ID = bson.NewObjectId()
+	}
+	return postgresHistory.Insert(m.db, sh)
+}
+
+func (m *postgresManager) UpdateSMSHistory(sh *SmsHistory) error {
+	updated, err := postgresHistory.Update(m.db, "id = $1", []interface{}{sh.ID.Hex()},
+		func() interface{} { return &SmsHistory{} },
+		func(document interface{}) error {
+			*document.(*SmsHistory) = *sh
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+// CountSMSHistorySince counts like the mongo implementation, which does not filter on the phone number
+func (m *postgresManager) CountSMSHistorySince(phonenumber string, since time.Time) (int, error) {
+	return postgresHistory.Count(m.db, "createdat >= $1", since)
+}
+
+func (m *postgresManager) GetByPhonenumbers(phonenumbers []string) (history []SmsHistory, err error) {
+	err = postgresHistory.Find(m.db, &history, "phonenumber = ANY($1)", pq.StringArray(phonenumbers))
+	return
+}
+
+func (m *postgresManager) Get(id string) (*SmsHistory, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, mgo.ErrNotFound
+	}
+	sh := &SmsHistory{}
+	err := postgresHistory.FindOne(m.db, sh, "id = $1", bson.ObjectIdHex(id).Hex())
+	return sh, err
+}
+
+func (m *postgresManager) GetLastSince(phonenumber string, since time.Time) (*SmsHistory, error) {
+	sh := &SmsHistory{}
+	err := postgresHistory.FindOne(m.db, sh, "phonenumber = $1 AND createdat >= $2 ORDER BY createdat DESC", phonenumber, since)
+	return sh, err
+}
+
+func (m *postgresManager) RemoveBefore(before time.Time) (int, error) {
+	return postgresHistory.Remove(m.db, "createdat < $1", before)
+}
+
+func (m *postgresManager) RemoveByPhonenumbers(phonenumbers []string) error {
+	_, err := postgresHistory.Remove(m.db, "phonenumber = ANY($1)", pq.StringArray(phonenumbers))
+	return err
+}
@@ -50,3 +50,20 @@ func TestScopesAreAuthorized(t *testing.T) {
 		assert.Equal(t, test.authorized, len(requestedScopes) == len(authorizedScopes), test.s)
 	}
 }
+
+func TestAuthorizationCopy(t *testing.T) {
+	authorization := &Authorization{
+		Organizations:  []string{"orgid"},
+		EmailAddresses: []AuthorizationMap{AuthorizationMap{RealLabel: "home", RequestedLabel: "main"}},
+		OwnerOf:        OwnerOf{EmailAddresses: []string{"alice@example.com"}},
+	}
+	copied := authorization.copy()
+	assert.Equal(t, authorization, copied)
+	copied.Organizations[0] = "other"
+	copied.EmailAddresses[0].RealLabel = "work"
+	copied.OwnerOf.EmailAddresses[0] = "eve@example.com"
+	assert.Equal(t, "orgid", authorization.Organizations[0], "the copy does not share its slices")
+	assert.Equal(t, "home", authorization.EmailAddresses[0].RealLabel)
+	assert.Equal(t, "alice@example.com", authorization.OwnerOf.EmailAddresses[0])
+	assert.Nil(t, copied.Addresses)
+}
@@ -0,0 +1,52 @@
+package user
+
+import (
+	"strconv"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+// LinkedAccount is an account of a user at an upstream identity provider
+type LinkedAccount struct {
+	Provider string      `json:"provider"`
+	Subject  string      `json:"subject"`
+	Name     string      `json:"name"`
+	Login    string      `json:"login"`
+	Email    string      `json:"email"`
+	Picture  string      `json:"picture"`
+	Link     string      `json:"link"`
+	LinkedAt db.DateTime `json:"linkedat"`
+}
+
+// GetLinkedAccount returns the account of a user at a provider
+func (u *User) GetLinkedAccount(provider string) (account LinkedAccount, found bool) {
+	for _, account = range u.LinkedAccounts {
+		if account.Provider == provider {
+			return account, true
+		}
+	}
+	return LinkedAccount{}, false
+}
+
+// fillLegacyAccounts sets the facebook and github properties from the linked accounts
+// so they are still available in the api
+func (u *User) fillLegacyAccounts() {
+	if account, found := u.GetLinkedAccount("facebook"); found {
+		u.Facebook = FacebookAccount{
+			Id:      account.Subject,
+			Name:    account.Name,
+			Picture: account.Picture,
+			Link:    account.Link,
+		}
+	}
+	if account, found := u.GetLinkedAccount("github"); found {
+		id, _ := strconv.Atoi(account.Subject)
+		u.Github = GithubAccount{
+			Login:      account.Login,
+			Id:         id,
+			Avatar_url: account.Picture,
+			Html_url:   account.Link,
+			Name:       account.Name,
+		}
+	}
+}
@@ -33,8 +33,9 @@ type User struct {
 	BankAccounts   []BankAccount         `json:"bankaccounts"`
 	EmailAddresses []EmailAddress        `json:"emailaddresses"`
 	Expire         db.DateTime           `json:"-" bson:"expire,omitempty"`
-	Facebook       FacebookAccount       `json:"facebook"`
-	Github         GithubAccount         `json:"github"`
+	Facebook       FacebookAccount       `json:"facebook" bson:"-"`
+	Github         GithubAccount         `json:"github" bson:"-"`
+	LinkedAccounts []LinkedAccount       `json:"linkedaccounts"`
 	Phonenumbers   []Phonenumber         `json:"phonenumbers"`
 	DigitalWallet  []DigitalAssetAddress `json:"digitalwallet"`
 	PublicKeys     []PublicKey           `json:"publicKeys"`
@@ -42,6 +43,10 @@ type User struct {
 	Firstname      string                `json:"firstname"`
 	Lastname       string                `json:"lastname"`
 	Avatars        []Avatar              `json:"avatars"`
+	// DeletionScheduled is the moment the account will be deleted, a deletion can be cancelled until then
+	DeletionScheduled *db.DateTime `json:"deletionscheduled,omitempty" bson:"deletionscheduled,omitempty"`
+	// Suspended users can not log in, an account can only be suspended and reinstated by an operator
+	Suspended bool `json:"-" bson:"suspended,omitempty"`
 }
 
 func (u *User) GetEmailAddressByLabel(label string) (email EmailAddress, err error) {
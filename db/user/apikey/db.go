@@ -13,25 +13,42 @@ const (
 	mongoCollectionName = "apikeys"
 )
 
-//Manager is used to store users
-type Manager struct {
+//Manager is used to store api keys
+type Manager interface {
+	Save(apikey *APIKey) (err error)
+	GetByUsernameAndLabel(username string, label string) (apikey *APIKey, err error)
+	Exists(username string, applicationid string) (bool, error)
+	GetByApplicationAndSecret(applicationid string, secret string) (apikey *APIKey, err error)
+	GetByUser(username string) (apikeys []APIKey, err error)
+	Delete(username string, label string) (err error)
+	RemoveByUser(username string) (err error)
+}
+
+//mongoManager stores the api keys in mongo
+type mongoManager struct {
 	session *mgo.Session
 }
 
 //NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session: session,
 	}
 }
 
-func (m *Manager) getCollection() *mgo.Collection {
+func (m *mongoManager) getCollection() *mgo.Collection {
 	return db.GetCollection(m.session, mongoCollectionName)
 }
 
 //Save ApplicationAPIKey
-func (m *Manager) Save(apikey *APIKey) (err error) {
+func (m *mongoManager) Save(apikey *APIKey) (err error) {
 	if apikey.ID == "" {
 		// New Doc!
 		apikey.ID = bson.NewObjectId()
@@ -42,7 +59,7 @@ func (m *Manager) Save(apikey *APIKey) (err error) {
 	return
 }
 
-func (m *Manager) GetByUsernameAndLabel(username string, label string) (apikey *APIKey, err error) {
+func (m *mongoManager) GetByUsernameAndLabel(username string, label string) (apikey *APIKey, err error) {
 	apikey = &APIKey{}
 	err = m.getCollection().Find(bson.M{"username": username, "label": label}).One(apikey)
 	if err == mgo.ErrNotFound {
@@ -54,25 +71,31 @@ func (m *Manager) GetByUsernameAndLabel(username string, label string) (apikey *
 }
 
 // Exists checks if an api key for a user exists
-func (m *Manager) Exists(username string, applicationid string) (bool, error) {
+func (m *mongoManager) Exists(username string, applicationid string) (bool, error) {
 	count, err := m.getCollection().Find(bson.M{"username": username, "applicationid": applicationid}).Count()
 
 	return count == 1, err
 }
 
-func (m *Manager) GetByApplicationAndSecret(applicationid string, secret string) (apikey *APIKey, err error) {
+func (m *mongoManager) GetByApplicationAndSecret(applicationid string, secret string) (apikey *APIKey, err error) {
 	apikey = &APIKey{}
 	err = m.getCollection().Find(bson.M{"applicationid": applicationid, "apikey": secret}).One(apikey)
 	return
 }
 
-func (m *Manager) GetByUser(username string) (apikeys []APIKey, err error) {
+func (m *mongoManager) GetByUser(username string) (apikeys []APIKey, err error) {
 	err = m.getCollection().Find(bson.M{"username": username}).All(&apikeys)
 	return
 }
 
 //Delete ApplicationAPIKey
-func (m *Manager) Delete(username string, label string) (err error) {
+func (m *mongoManager) Delete(username string, label string) (err error) {
 	_, err = m.getCollection().RemoveAll(bson.M{"username": username, "label": label})
 	return
 }
+
+//RemoveByUser deletes all ApplicationAPIKeys of a user
+func (m *mongoManager) RemoveByUser(username string) (err error) {
+	_, err = m.getCollection().RemoveAll(bson.M{"username": username})
+	return
+}
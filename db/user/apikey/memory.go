@@ -0,0 +1,110 @@
+package apikey
+
+import (
+	"sync"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	apikeys []APIKey
+}
+
+//memoryManager keeps the api keys in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoCollectionName, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+// find returns copies of the api keys that match, the caller holds the lock
+func (m *memoryManager) find(match func(apikey *APIKey) bool) (apikeys []APIKey) {
+	for _, apikey := range m.store.apikeys {
+		if match(&apikey) {
+			apikey.Scopes = append([]string(nil), apikey.Scopes...)
+			apikeys = append(apikeys, apikey)
+		}
+	}
+	return
+}
+
+func (m *memoryManager) Save(apikey *APIKey) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if apikey.ID == "" {
+		apikey.ID = bson.NewObjectId()
+	}
+	stored := *apikey
+	stored.Scopes = append([]string(nil), apikey.Scopes...)
+	for i, existing := range m.store.apikeys {
+		if existing.ID == apikey.ID {
+			m.store.apikeys[i] = stored
+			return nil
+		}
+	}
+	m.store.apikeys = append(m.store.apikeys, stored)
+	return nil
+}
+
+func (m *memoryManager) GetByUsernameAndLabel(username string, label string) (*APIKey, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	apikeys := m.find(func(apikey *APIKey) bool { return apikey.Username == username && apikey.Label == label })
+	if len(apikeys) == 0 {
+		return &APIKey{}, nil
+	}
+	return &apikeys[0], nil
+}
+
+func (m *memoryManager) Exists(username string, applicationid string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	apikeys := m.find(func(apikey *APIKey) bool { return apikey.Username == username && apikey.ApplicationID == applicationid })
+	return len(apikeys) == 1, nil
+}
+
+func (m *memoryManager) GetByApplicationAndSecret(applicationid string, secret string) (*APIKey, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	apikeys := m.find(func(apikey *APIKey) bool { return apikey.ApplicationID == applicationid && apikey.ApiKey == secret })
+	if len(apikeys) == 0 {
+		return &APIKey{}, mgo.ErrNotFound
+	}
+	return &apikeys[0], nil
+}
+
+func (m *memoryManager) GetByUser(username string) ([]APIKey, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	return m.find(func(apikey *APIKey) bool { return apikey.Username == username }), nil
+}
+
+// remove removes the api keys that match
+func (m *memoryManager) remove(match func(apikey *APIKey) bool) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	remaining := []APIKey{}
+	for _, apikey := range m.store.apikeys {
+		if !match(&apikey) {
+			remaining = append(remaining, apikey)
+		}
+	}
+	m.store.apikeys = remaining
+	return nil
+}
+
+func (m *memoryManager) Delete(username string, label string) error {
+	return m.remove(func(apikey *APIKey) bool { return apikey.Username == username && apikey.Label == label })
+}
+
+func (m *memoryManager) RemoveByUser(username string) error {
+	return m.remove(func(apikey *APIKey) bool { return apikey.Username == username })
+}
@@ -0,0 +1,84 @@
+package apikey
+
+import (
+	"database/sql"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var postgresAPIKeys = &db.PostgresCollection{
+	Table: "apikeys",
+	Columns: func(document interface{}) map[string]interface{} {
+		apikey := document.(*APIKey)
+		return map[string]interface{}{
+			"username":      apikey.Username,
+			"label":         apikey.Label,
+			"applicationid": apikey.ApplicationID,
+		}
+	},
+}
+
+//postgresManager stores the api keys in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) Save(apikey *APIKey) error {
+	if apikey.ID == "" {
+		apikey.ID = bson.NewObjectId()
+		return postgresAPIKeys.Insert(m.db, apikey)
+	}
+	return postgresAPIKeys.Upsert(m.db, "id = $1", []interface{}{apikey.ID.Hex()},
+		func() interface{} { return &APIKey{} },
+		func(document interface{}) error { return db.CopyDocument(document, apikey) })
+}
+
+func (m *postgresManager) GetByUsernameAndLabel(username string, label string) (*APIKey, error) {
+	apikey := &APIKey{}
+	err := postgresAPIKeys.FindOne(m.db, apikey, "username = $1 AND label = $2", username, label)
+	if err == mgo.ErrNotFound {
+		err = nil
+	} else if err != nil {
+		apikey = nil
+	}
+	return apikey, err
+}
+
+func (m *postgresManager) Exists(username string, applicationid string) (bool, error) {
+	count, err := postgresAPIKeys.Count(m.db, "username = $1 AND applicationid = $2", username, applicationid)
+	return count == 1, err
+}
+
+func (m *postgresManager) GetByApplicationAndSecret(applicationid string, secret string) (*APIKey, error) {
+	var apikeys []APIKey
+	if err := postgresAPIKeys.Find(m.db, &apikeys, "applicationid = $1", applicationid); err != nil {
+		return &APIKey{}, err
+	}
+	for _, apikey := range apikeys {
+		if apikey.ApiKey == secret {
+			return &apikey, nil
+		}
+	}
+	return &APIKey{}, mgo.ErrNotFound
+}
+
+func (m *postgresManager) GetByUser(username string) (apikeys []APIKey, err error) {
+	err = postgresAPIKeys.Find(m.db, &apikeys, "username = $1", username)
+	return
+}
+
+func (m *postgresManager) Delete(username string, label string) error {
+	_, err := postgresAPIKeys.Remove(m.db, "username = $1 AND label = $2", username, label)
+	return err
+}
+
+func (m *postgresManager) RemoveByUser(username string) error {
+	_, err := postgresAPIKeys.Remove(m.db, "username = $1", username)
+	return err
+}
@@ -0,0 +1,110 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/itsyouonline/identityserver/cache"
+	"github.com/itsyouonline/identityserver/db/invalidation"
+)
+
+// authorizationCache caches the authorizations by user and organization, nil if there is none.
+// The entries are tagged with the user and the organization.
+var authorizationCache = cache.New("authorizations")
+
+//invalidatingManager invalidates the cached authorizations when they are changed or removed
+type invalidatingManager struct {
+	Manager
+	r *http.Request
+}
+
+func (m invalidatingManager) UpdateAuthorization(authorization *Authorization) (err error) {
+	if err = m.Manager.UpdateAuthorization(authorization); err == nil {
+		invalidation.Invalidate(m.r, "user:"+authorization.Username)
+	}
+	return
+}
+
+func (m invalidatingManager) DeleteAuthorization(username, organization string) (err error) {
+	if err = m.Manager.DeleteAuthorization(username, organization); err == nil {
+		invalidation.Invalidate(m.r, "user:"+username)
+	}
+	return
+}
+
+func (m invalidatingManager) DeleteAllAuthorizations(organization string) (err error) {
+	if err = m.Manager.DeleteAllAuthorizations(organization); err == nil {
+		invalidation.Invalidate(m.r, "organization:"+organization)
+	}
+	return
+}
+
+func (m invalidatingManager) DeleteAuthorizationsByUser(username string) (err error) {
+	if err = m.Manager.DeleteAuthorizationsByUser(username); err == nil {
+		invalidation.Invalidate(m.r, "user:"+username)
+	}
+	return
+}
+
+//cachedManager looks up the authorizations in the cache first
+type cachedManager struct {
+	Manager
+}
+
+//NewCachedManager creates a Manager that caches the authorizations for a short time.
+// Changed authorizations are invalidated right away, so it can be used to authorize the api requests.
+func NewCachedManager(r *http.Request) Manager {
+	return cachedManager{Manager: NewManager(r)}
+}
+
+//GetAuthorization returns a copy of the cached authorization, nil if no such authorization exists
+func (m cachedManager) GetAuthorization(username, organization string) (*Authorization, error) {
+	key := username + "\xff" + organization
+	if cached, found := authorizationCache.Get(key); found {
+		if cached == nil {
+			return nil, nil
+		}
+		authorization := cached.(Authorization)
+		return authorization.copy(), nil
+	}
+	generation := authorizationCache.Generation()
+	authorization, err := m.Manager.GetAuthorization(username, organization)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if authorization != nil {
+		value = *authorization.copy()
+	}
+	authorizationCache.Set(key, value, generation, 0, "user:"+username, "organization:"+organization)
+	return authorization, nil
+}
+
+//copy returns a copy of the authorization that does not share its slices, so the callers can not change the cached one
+func (authorization *Authorization) copy() *Authorization {
+	copied := *authorization
+	copied.Addresses = copyAuthorizationMaps(authorization.Addresses)
+	copied.BankAccounts = copyAuthorizationMaps(authorization.BankAccounts)
+	copied.EmailAddresses = copyAuthorizationMaps(authorization.EmailAddresses)
+	copied.ValidatedEmailAddresses = copyAuthorizationMaps(authorization.ValidatedEmailAddresses)
+	copied.Phonenumbers = copyAuthorizationMaps(authorization.Phonenumbers)
+	copied.ValidatedPhonenumbers = copyAuthorizationMaps(authorization.ValidatedPhonenumbers)
+	copied.PublicKeys = copyAuthorizationMaps(authorization.PublicKeys)
+	copied.Avatars = copyAuthorizationMaps(authorization.Avatars)
+	if authorization.DigitalWallet != nil {
+		copied.DigitalWallet = append([]DigitalWalletAuthorization{}, authorization.DigitalWallet...)
+	}
+	if authorization.Organizations != nil {
+		copied.Organizations = append([]string{}, authorization.Organizations...)
+	}
+	if authorization.OwnerOf.EmailAddresses != nil {
+		copied.OwnerOf.EmailAddresses = append([]string{}, authorization.OwnerOf.EmailAddresses...)
+	}
+	return &copied
+}
+
+func copyAuthorizationMaps(maps []AuthorizationMap) []AuthorizationMap {
+	if maps == nil {
+		return nil
+	}
+	return append([]AuthorizationMap{}, maps...)
+}
@@ -0,0 +1,172 @@
+package user
+
+// The changes below are applied to a stored user by the memory and postgres managers,
+// they keep the lists the same way the $pull and $push updates of the mongo manager do
+
+// setEmailAddress replaces the EmailAddress with the same label, it is added at the end of the list
+func setEmailAddress(email EmailAddress) func(u *User) {
+	return func(u *User) {
+		removeEmailAddress(email.Label)(u)
+		u.EmailAddresses = append(u.EmailAddresses, email)
+	}
+}
+
+// removeEmailAddress removes the EmailAddress with a label
+func removeEmailAddress(label string) func(u *User) {
+	return func(u *User) {
+		kept := []EmailAddress{}
+		for _, existing := range u.EmailAddresses {
+			if existing.Label != label {
+				kept = append(kept, existing)
+			}
+		}
+		u.EmailAddresses = kept
+	}
+}
+
+// setPublicKey replaces the PublicKey with the same label, it is added at the end of the list
+func setPublicKey(key PublicKey) func(u *User) {
+	return func(u *User) {
+		removePublicKey(key.Label)(u)
+		u.PublicKeys = append(u.PublicKeys, key)
+	}
+}
+
+// removePublicKey removes the PublicKey with a label
+func removePublicKey(label string) func(u *User) {
+	return func(u *User) {
+		kept := []PublicKey{}
+		for _, existing := range u.PublicKeys {
+			if existing.Label != label {
+				kept = append(kept, existing)
+			}
+		}
+		u.PublicKeys = kept
+	}
+}
+
+// setPhonenumber replaces the Phonenumber with the same label, it is added at the end of the list
+func setPhonenumber(phonenumber Phonenumber) func(u *User) {
+	return func(u *User) {
+		removePhonenumber(phonenumber.Label)(u)
+		u.Phonenumbers = append(u.Phonenumbers, phonenumber)
+	}
+}
+
+// removePhonenumber removes the Phonenumber with a label
+func removePhonenumber(label string) func(u *User) {
+	return func(u *User) {
+		kept := []Phonenumber{}
+		for _, existing := range u.Phonenumbers {
+			if existing.Label != label {
+				kept = append(kept, existing)
+			}
+		}
+		u.Phonenumbers = kept
+	}
+}
+
+// setDigitalAssetAddress replaces the DigitalAssetAddress with the same label, it is added at the end of the list
+func setDigitalAssetAddress(currency DigitalAssetAddress) func(u *User) {
+	return func(u *User) {
+		removeDigitalAssetAddress(currency.Label)(u)
+		u.DigitalWallet = append(u.DigitalWallet, currency)
+	}
+}
+
+// removeDigitalAssetAddress removes the DigitalAssetAddress with a label
+func removeDigitalAssetAddress(label string) func(u *User) {
+	return func(u *User) {
+		kept := []DigitalAssetAddress{}
+		for _, existing := range u.DigitalWallet {
+			if existing.Label != label {
+				kept = append(kept, existing)
+			}
+		}
+		u.DigitalWallet = kept
+	}
+}
+
+// setAddress replaces the Address with the same label, it is added at the end of the list
+func setAddress(address Address) func(u *User) {
+	return func(u *User) {
+		removeAddress(address.Label)(u)
+		u.Addresses = append(u.Addresses, address)
+	}
+}
+
+// removeAddress removes the Address with a label
+func removeAddress(label string) func(u *User) {
+	return func(u *User) {
+		kept := []Address{}
+		for _, existing := range u.Addresses {
+			if existing.Label != label {
+				kept = append(kept, existing)
+			}
+		}
+		u.Addresses = kept
+	}
+}
+
+// setBankAccount replaces the BankAccount with the same label, it is added at the end of the list
+func setBankAccount(bank BankAccount) func(u *User) {
+	return func(u *User) {
+		removeBankAccount(bank.Label)(u)
+		u.BankAccounts = append(u.BankAccounts, bank)
+	}
+}
+
+// removeBankAccount removes the BankAccount with a label
+func removeBankAccount(label string) func(u *User) {
+	return func(u *User) {
+		kept := []BankAccount{}
+		for _, existing := range u.BankAccounts {
+			if existing.Label != label {
+				kept = append(kept, existing)
+			}
+		}
+		u.BankAccounts = kept
+	}
+}
+
+// setLinkedAccount replaces the LinkedAccount with the same provider, it is added at the end of the list
+func setLinkedAccount(account LinkedAccount) func(u *User) {
+	return func(u *User) {
+		removeLinkedAccount(account.Provider)(u)
+		u.LinkedAccounts = append(u.LinkedAccounts, account)
+	}
+}
+
+// removeLinkedAccount removes the LinkedAccount with a provider
+func removeLinkedAccount(provider string) func(u *User) {
+	return func(u *User) {
+		kept := []LinkedAccount{}
+		for _, existing := range u.LinkedAccounts {
+			if existing.Provider != provider {
+				kept = append(kept, existing)
+			}
+		}
+		u.LinkedAccounts = kept
+	}
+}
+
+// setAvatar replaces the Avatar with the same label, it is added at the end of the list
+func setAvatar(avatar Avatar) func(u *User) {
+	return func(u *User) {
+		removeAvatar(avatar.Label)(u)
+		u.Avatars = append(u.Avatars, avatar)
+	}
+}
+
+// removeAvatar removes the Avatar with a label
+func removeAvatar(label string) func(u *User) {
+	return func(u *User) {
+		kept := []Avatar{}
+		for _, existing := range u.Avatars {
+			if existing.Label != label {
+				kept = append(kept, existing)
+			}
+		}
+		u.Avatars = kept
+	}
+}
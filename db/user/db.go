@@ -18,64 +18,98 @@ const (
 	mongoAuthorizationsCollectionName = "authorizations"
 )
 
-//InitModels initialize models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:      []string{"username"},
-		Unique:   true,
-		DropDups: true,
-	}
-
-	db.EnsureIndex(mongoUsersCollectionName, index)
-
-	// Removes users without valid 2 factor authentication after 3 days
-	automaticUserExpiration := mgo.Index{
-		Key:         []string{"expire"},
-		ExpireAfter: time.Second * 3600 * 24 * 3,
-		Background:  true,
-	}
-	db.EnsureIndex(mongoUsersCollectionName, automaticUserExpiration)
-
-	avatarIndex := mgo.Index{
-		Key:      []string{"hash"},
-		Unique:   true,
-		DropDups: true,
-	}
-	db.EnsureIndex(mongoAvatarFileCollectionName, avatarIndex)
-
-	emailIndex := mgo.Index{
-		Key: []string{"emailaddresses.emailaddress"},
-	}
-	db.EnsureIndex(mongoUsersCollectionName, emailIndex)
-}
-
 //Manager is used to store users
-type Manager struct {
+type Manager interface {
+	Get(id string) (*User, error)
+	GetByName(username string) (*User, error)
+	GetByEmailAddress(email string) (users []string, err error)
+	Exists(username string) (bool, error)
+	Save(u *User) error
+	Delete(u *User) error
+	SaveEmail(username string, email EmailAddress) error
+	RemoveEmail(username string, label string) error
+	SavePublicKey(username string, key PublicKey) error
+	RemovePublicKey(username string, label string) error
+	SavePhone(username string, phonenumber Phonenumber) error
+	RemovePhone(username string, label string) error
+	SaveVirtualCurrency(username string, currency DigitalAssetAddress) error
+	RemoveVirtualCurrency(username string, label string) error
+	SaveAddress(username string, address Address) error
+	RemoveAddress(username, label string) error
+	SaveBank(u *User, bank BankAccount) error
+	RemoveBank(u *User, label string) error
+	// SaveLinkedAccount returns db.ErrDuplicate or a mongo duplicate key error, see db.IsDup,
+	// if the account is linked to another user
+	SaveLinkedAccount(username string, account LinkedAccount) error
+	RemoveLinkedAccount(username string, provider string) error
+	GetByLinkedAccount(provider string, subject string) (*User, error)
+	GetAuthorizationsByUser(username string) (authorizations []Authorization, err error)
+	GetOrganizationAuthorizations(globalId string) (authorizations []Authorization, err error)
+	GetAuthorization(username, organization string) (authorization *Authorization, err error)
+	FilterUsersWithAuthorizations(usernames []string, organization string) ([]string, error)
+	UpdateAuthorization(authorization *Authorization) (err error)
+	DeleteAuthorization(username, organization string) (err error)
+	DeleteAllAuthorizations(organization string) (err error)
+	DeleteAuthorizationsByUser(username string) (err error)
+	UpdateName(username string, firstname string, lastname string) (err error)
+	RemoveExpireDate(username string) (err error)
+	ScheduleDeletion(username string, at time.Time) error
+	CancelDeletion(username string) error
+	SetSuspended(username string, suspended bool) error
+	GetScheduledForDeletion(before time.Time) (usernames []string, err error)
+	GetPendingRegistrationsCount() (int, error)
+	// RemoveExpiredRegistrations removes the users that did not finish their registration in time
+	RemoveExpiredRegistrations() (removed int, err error)
+	SaveAvatar(username string, avatar Avatar) error
+	RemoveAvatar(username, label string) error
+	AvatarFileExists(hash string) (bool, error)
+	GetAvatarFile(hash string) ([]byte, error)
+	SaveAvatarFile(hash string, file []byte) error
+	RemoveAvatarFile(hash string) error
+	// GetAvatarFileHashes returns the hashes of the avatar files stored before a moment,
+	// files stored before their creation time was recorded are included
+	GetAvatarFileHashes(before time.Time) ([]string, error)
+	// GetAvatarSources returns the sources of the avatars of all users
+	GetAvatarSources() ([]string, error)
+}
+
+//mongoManager stores the users in mongo
+type mongoManager struct {
 	session *mgo.Session
 }
 
-//NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+//NewManager creates and initializes a new Manager, the cached authorizations are invalidated when they change
+func NewManager(r *http.Request) Manager {
+	return invalidatingManager{Manager: newManager(r), r: r}
+}
+
+func newManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session: session,
 	}
 }
 
-func (m *Manager) getUserCollection() *mgo.Collection {
+func (m *mongoManager) getUserCollection() *mgo.Collection {
 	return db.GetCollection(m.session, mongoUsersCollectionName)
 }
 
-func (m *Manager) getAuthorizationCollection() *mgo.Collection {
+func (m *mongoManager) getAuthorizationCollection() *mgo.Collection {
 	return db.GetCollection(m.session, mongoAuthorizationsCollectionName)
 }
 
-func (m *Manager) getAvatarFileCollection() *mgo.Collection {
+func (m *mongoManager) getAvatarFileCollection() *mgo.Collection {
 	return db.GetCollection(m.session, mongoAvatarFileCollectionName)
 }
 
 // Get user by ID.
-func (m *Manager) Get(id string) (*User, error) {
+func (m *mongoManager) Get(id string) (*User, error) {
 	var user User
 
 	objectID := bson.ObjectIdHex(id)
@@ -88,56 +122,29 @@ func (m *Manager) Get(id string) (*User, error) {
 }
 
 //GetByName gets a user by it's username.
-func (m *Manager) GetByName(username string) (*User, error) {
+func (m *mongoManager) GetByName(username string) (*User, error) {
 	var user User
 
 	err := m.getUserCollection().Find(bson.M{"username": username}).One(&user)
-	if user.Avatars == nil {
-		user.Avatars = []Avatar{}
-	}
-	// Get the facebook and github profile pictures if they are linked to the account
-	if user.Github.Avatar_url != "" {
-		user.Avatars = append(user.Avatars, Avatar{Label: "github", Source: user.Github.Avatar_url})
-	}
-	if user.Facebook.Link != "" {
-		user.Avatars = append(user.Avatars, Avatar{Label: "facebook", Source: user.Facebook.Picture})
-	}
-	if user.Addresses == nil {
-		user.Addresses = []Address{}
-	}
-	if user.BankAccounts == nil {
-		user.BankAccounts = []BankAccount{}
-	}
-	if user.Phonenumbers == nil {
-		user.Phonenumbers = []Phonenumber{}
-	}
-	if user.EmailAddresses == nil {
-		user.EmailAddresses = []EmailAddress{}
-	}
-	if user.DigitalWallet == nil {
-		user.DigitalWallet = []DigitalAssetAddress{}
-	}
-	if user.PublicKeys == nil {
-		user.PublicKeys = []PublicKey{}
-	}
+	user.fillLists()
 
 	return &user, err
 }
 
-func (m *Manager) GetByEmailAddress(email string) (users []string, err error) {
+func (m *mongoManager) GetByEmailAddress(email string) (users []string, err error) {
 	err = m.getUserCollection().Find(bson.M{"emailaddresses.emailaddress": email}).Distinct("username", &users)
 	return
 }
 
 //Exists checks if a user with this username already exists.
-func (m *Manager) Exists(username string) (bool, error) {
+func (m *mongoManager) Exists(username string) (bool, error) {
 	count, err := m.getUserCollection().Find(bson.M{"username": username}).Count()
 
 	return count >= 1, err
 }
 
 // Save a user.
-func (m *Manager) Save(u *User) error {
+func (m *mongoManager) Save(u *User) error {
 	// TODO: Validation!
 
 	if u.ID == "" {
@@ -153,7 +160,7 @@ func (m *Manager) Save(u *User) error {
 }
 
 // Delete a user.
-func (m *Manager) Delete(u *User) error {
+func (m *mongoManager) Delete(u *User) error {
 	if u.ID == "" {
 		return errors.New("User not stored")
 	}
@@ -162,7 +169,7 @@ func (m *Manager) Delete(u *User) error {
 }
 
 // SaveEmail save or update email along with its label
-func (m *Manager) SaveEmail(username string, email EmailAddress) error {
+func (m *mongoManager) SaveEmail(username string, email EmailAddress) error {
 	if err := m.RemoveEmail(username, email.Label); err != nil {
 		return err
 	}
@@ -172,14 +179,14 @@ func (m *Manager) SaveEmail(username string, email EmailAddress) error {
 }
 
 // RemoveEmail remove email associated with label
-func (m *Manager) RemoveEmail(username string, label string) error {
+func (m *mongoManager) RemoveEmail(username string, label string) error {
 	return m.getUserCollection().Update(
 		bson.M{"username": username},
 		bson.M{"$pull": bson.M{"emailaddresses": bson.M{"label": label}}})
 }
 
 // SavePublicKey save or update public key along with its label
-func (m *Manager) SavePublicKey(username string, key PublicKey) error {
+func (m *mongoManager) SavePublicKey(username string, key PublicKey) error {
 	if err := m.RemovePublicKey(username, key.Label); err != nil {
 		return err
 	}
@@ -189,14 +196,14 @@ func (m *Manager) SavePublicKey(username string, key PublicKey) error {
 }
 
 // RemovePublicKey remove public key associated with label
-func (m *Manager) RemovePublicKey(username string, label string) error {
+func (m *mongoManager) RemovePublicKey(username string, label string) error {
 	return m.getUserCollection().Update(
 		bson.M{"username": username},
 		bson.M{"$pull": bson.M{"publickeys": bson.M{"label": label}}})
 }
 
 // SavePhone save or update phone along with its label
-func (m *Manager) SavePhone(username string, phonenumber Phonenumber) error {
+func (m *mongoManager) SavePhone(username string, phonenumber Phonenumber) error {
 	if err := m.RemovePhone(username, phonenumber.Label); err != nil {
 		return err
 	}
@@ -206,14 +213,14 @@ func (m *Manager) SavePhone(username string, phonenumber Phonenumber) error {
 }
 
 // RemovePhone remove phone associated with label
-func (m *Manager) RemovePhone(username string, label string) error {
+func (m *mongoManager) RemovePhone(username string, label string) error {
 	return m.getUserCollection().Update(
 		bson.M{"username": username},
 		bson.M{"$pull": bson.M{"phonenumbers": bson.M{"label": label}}})
 }
 
 // SaveVirtualCurrency save or update virtualcurrency along with its label
-func (m *Manager) SaveVirtualCurrency(username string, currency DigitalAssetAddress) error {
+func (m *mongoManager) SaveVirtualCurrency(username string, currency DigitalAssetAddress) error {
 	if err := m.RemoveVirtualCurrency(username, currency.Label); err != nil {
 		return err
 	}
@@ -223,14 +230,14 @@ func (m *Manager) SaveVirtualCurrency(username string, currency DigitalAssetAddr
 }
 
 // RemoveVirtualCurrency remove phone associated with label
-func (m *Manager) RemoveVirtualCurrency(username string, label string) error {
+func (m *mongoManager) RemoveVirtualCurrency(username string, label string) error {
 	return m.getUserCollection().Update(
 		bson.M{"username": username},
 		bson.M{"$pull": bson.M{"digitalwallet": bson.M{"label": label}}})
 }
 
 // SaveAddress save or update address
-func (m *Manager) SaveAddress(username string, address Address) error {
+func (m *mongoManager) SaveAddress(username string, address Address) error {
 	if err := m.RemoveAddress(username, address.Label); err != nil {
 		return err
 	}
@@ -240,14 +247,14 @@ func (m *Manager) SaveAddress(username string, address Address) error {
 }
 
 // RemoveAddress remove address associated with label
-func (m *Manager) RemoveAddress(username, label string) error {
+func (m *mongoManager) RemoveAddress(username, label string) error {
 	return m.getUserCollection().Update(
 		bson.M{"username": username},
 		bson.M{"$pull": bson.M{"addresses": bson.M{"label": label}}})
 }
 
 // SaveBank save or update bank account
-func (m *Manager) SaveBank(u *User, bank BankAccount) error {
+func (m *mongoManager) SaveBank(u *User, bank BankAccount) error {
 	if err := m.RemoveBank(u, bank.Label); err != nil {
 		return err
 	}
@@ -257,34 +264,53 @@ func (m *Manager) SaveBank(u *User, bank BankAccount) error {
 }
 
 // RemoveBank remove bank associated with label
-func (m *Manager) RemoveBank(u *User, label string) error {
+func (m *mongoManager) RemoveBank(u *User, label string) error {
 	return m.getUserCollection().Update(
 		bson.M{"username": u.Username},
 		bson.M{"$pull": bson.M{"bankaccounts": bson.M{"label": label}}})
 }
 
-func (m *Manager) UpdateGithubAccount(username string, githubaccount GithubAccount) (err error) {
-	_, err = m.getUserCollection().UpdateAll(bson.M{"username": username}, bson.M{"$set": bson.M{"github": githubaccount}})
-	return
-}
-
-func (m *Manager) DeleteGithubAccount(username string) (err error) {
-	_, err = m.getUserCollection().UpdateAll(bson.M{"username": username}, bson.M{"$set": bson.M{"github": bson.M{}}})
-	return
+// SaveLinkedAccount links an upstream account to a user, replacing the account of the same provider.
+// The unique index on the linked accounts refuses an account that is linked to another user.
+func (m *mongoManager) SaveLinkedAccount(username string, account LinkedAccount) error {
+	// The account is added before the other account of the provider is removed,
+	// so the user keeps it if the new one belongs to another user
+	if err := m.getUserCollection().Update(
+		bson.M{"username": username},
+		bson.M{"$pull": bson.M{"linkedaccounts": bson.M{"provider": account.Provider, "subject": account.Subject}}}); err != nil {
+		return err
+	}
+	if err := m.getUserCollection().Update(
+		bson.M{"username": username},
+		bson.M{"$push": bson.M{"linkedaccounts": account}}); err != nil {
+		return err
+	}
+	return m.getUserCollection().Update(
+		bson.M{"username": username},
+		bson.M{"$pull": bson.M{"linkedaccounts": bson.M{"provider": account.Provider, "subject": bson.M{"$ne": account.Subject}}}})
 }
 
-func (m *Manager) UpdateFacebookAccount(username string, facebookaccount FacebookAccount) (err error) {
-	_, err = m.getUserCollection().UpdateAll(bson.M{"username": username}, bson.M{"$set": bson.M{"facebook": facebookaccount}})
-	return
+// RemoveLinkedAccount unlinks the account of a provider
+func (m *mongoManager) RemoveLinkedAccount(username string, provider string) error {
+	return m.getUserCollection().Update(
+		bson.M{"username": username},
+		bson.M{"$pull": bson.M{"linkedaccounts": bson.M{"provider": provider}}})
 }
 
-func (m *Manager) DeleteFacebookAccount(username string) (err error) {
-	_, err = m.getUserCollection().UpdateAll(bson.M{"username": username}, bson.M{"$set": bson.M{"facebook": bson.M{}}})
-	return
+// GetByLinkedAccount gets the user that linked an upstream account
+func (m *mongoManager) GetByLinkedAccount(provider string, subject string) (*User, error) {
+	var user User
+	err := m.getUserCollection().Find(bson.M{
+		"linkedaccounts": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}},
+	}).One(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
 // GetAuthorizationsByUser returns all authorizations for a specific user
-func (m *Manager) GetAuthorizationsByUser(username string) (authorizations []Authorization, err error) {
+func (m *mongoManager) GetAuthorizationsByUser(username string) (authorizations []Authorization, err error) {
 	err = m.getAuthorizationCollection().Find(bson.M{"username": username}).All(&authorizations)
 	if authorizations == nil {
 		authorizations = []Authorization{}
@@ -293,7 +319,7 @@ func (m *Manager) GetAuthorizationsByUser(username string) (authorizations []Aut
 }
 
 // GetOrganizationAuthorizations returns all authorizations for a specific organization
-func (m *Manager) GetOrganizationAuthorizations(globalId string) (authorizations []Authorization, err error) {
+func (m *mongoManager) GetOrganizationAuthorizations(globalId string) (authorizations []Authorization, err error) {
 	qry := bson.M{"grantedto": globalId}
 	err = m.getAuthorizationCollection().Find(qry).All(&authorizations)
 	if authorizations == nil {
@@ -303,7 +329,7 @@ func (m *Manager) GetOrganizationAuthorizations(globalId string) (authorizations
 }
 
 //GetAuthorization returns the authorization for a specific organization, nil if no such authorization exists
-func (m *Manager) GetAuthorization(username, organization string) (authorization *Authorization, err error) {
+func (m *mongoManager) GetAuthorization(username, organization string) (authorization *Authorization, err error) {
 	err = m.getAuthorizationCollection().Find(bson.M{"username": username, "grantedto": organization}).One(&authorization)
 	if err == mgo.ErrNotFound {
 		err = nil
@@ -314,7 +340,7 @@ func (m *Manager) GetAuthorization(username, organization string) (authorization
 }
 
 // FilterUsersWithAuthorizations returns the authorizations granted to an organization
-func (m *Manager) FilterUsersWithAuthorizations(usernames []string, organization string) ([]string, error) {
+func (m *mongoManager) FilterUsersWithAuthorizations(usernames []string, organization string) ([]string, error) {
 	var auths []Authorization
 	err := m.getAuthorizationCollection().Find(bson.M{"username": bson.M{"$in": usernames}, "grantedto": organization}).Select(bson.M{"username": 1}).All(&auths)
 	if err != nil {
@@ -328,28 +354,69 @@ func (m *Manager) FilterUsersWithAuthorizations(usernames []string, organization
 }
 
 //UpdateAuthorization inserts or updates an authorization
-func (m *Manager) UpdateAuthorization(authorization *Authorization) (err error) {
+func (m *mongoManager) UpdateAuthorization(authorization *Authorization) (err error) {
 	_, err = m.getAuthorizationCollection().Upsert(bson.M{"username": authorization.Username, "grantedto": authorization.GrantedTo}, authorization)
 	return
 }
 
 //DeleteAuthorization removes an authorization
-func (m *Manager) DeleteAuthorization(username, organization string) (err error) {
+func (m *mongoManager) DeleteAuthorization(username, organization string) (err error) {
 	_, err = m.getAuthorizationCollection().RemoveAll(bson.M{"username": username, "grantedto": organization})
 	return
 }
 
 //DeleteAllAuthorizations removes all authorizations from an organization
-func (m *Manager) DeleteAllAuthorizations(organization string) (err error) {
+func (m *mongoManager) DeleteAllAuthorizations(organization string) (err error) {
 	_, err = m.getAuthorizationCollection().RemoveAll(bson.M{"grantedto": organization})
 	return err
 }
 
+// DeleteAuthorizationsByUser removes all authorizations a user has given to organizations
+func (m *mongoManager) DeleteAuthorizationsByUser(username string) (err error) {
+	_, err = m.getAuthorizationCollection().RemoveAll(bson.M{"username": username})
+	return
+}
+
+// fillLists replaces the missing lists by empty ones and adds the avatars and legacy accounts of the linked accounts
+func (u *User) fillLists() {
+	if u.Avatars == nil {
+		u.Avatars = []Avatar{}
+	}
+	// Get the profile pictures of the linked accounts
+	for _, account := range u.LinkedAccounts {
+		if account.Picture != "" {
+			u.Avatars = append(u.Avatars, Avatar{Label: account.Provider, Source: account.Picture})
+		}
+	}
+	if u.LinkedAccounts == nil {
+		u.LinkedAccounts = []LinkedAccount{}
+	}
+	u.fillLegacyAccounts()
+	if u.Addresses == nil {
+		u.Addresses = []Address{}
+	}
+	if u.BankAccounts == nil {
+		u.BankAccounts = []BankAccount{}
+	}
+	if u.Phonenumbers == nil {
+		u.Phonenumbers = []Phonenumber{}
+	}
+	if u.EmailAddresses == nil {
+		u.EmailAddresses = []EmailAddress{}
+	}
+	if u.DigitalWallet == nil {
+		u.DigitalWallet = []DigitalAssetAddress{}
+	}
+	if u.PublicKeys == nil {
+		u.PublicKeys = []PublicKey{}
+	}
+}
+
 func (u *User) getID() string {
 	return u.ID.Hex()
 }
 
-func (m *Manager) UpdateName(username string, firstname string, lastname string) (err error) {
+func (m *mongoManager) UpdateName(username string, firstname string, lastname string) (err error) {
 	values := bson.M{
 		"firstname": firstname,
 		"lastname":  lastname,
@@ -358,14 +425,45 @@ func (m *Manager) UpdateName(username string, firstname string, lastname string)
 	return
 }
 
-func (m *Manager) RemoveExpireDate(username string) (err error) {
+func (m *mongoManager) RemoveExpireDate(username string) (err error) {
 	qry := bson.M{"username": username}
 	values := bson.M{"expire": bson.M{}}
 	_, err = m.getUserCollection().UpdateAll(qry, bson.M{"$set": values})
 	return
 }
 
-func (m *Manager) GetPendingRegistrationsCount() (int, error) {
+// ScheduleDeletion marks a user to be deleted at the given moment
+func (m *mongoManager) ScheduleDeletion(username string, at time.Time) error {
+	return m.getUserCollection().Update(
+		bson.M{"username": username},
+		bson.M{"$set": bson.M{"deletionscheduled": at}})
+}
+
+// CancelDeletion cancels a scheduled deletion of a user
+func (m *mongoManager) CancelDeletion(username string) error {
+	return m.getUserCollection().Update(
+		bson.M{"username": username},
+		bson.M{"$unset": bson.M{"deletionscheduled": ""}})
+}
+
+// SetSuspended suspends or reinstates a user
+func (m *mongoManager) SetSuspended(username string, suspended bool) error {
+	return m.getUserCollection().Update(
+		bson.M{"username": username},
+		bson.M{"$set": bson.M{"suspended": suspended}})
+}
+
+// GetScheduledForDeletion lists the usernames of the users that are scheduled to be deleted before a given moment
+func (m *mongoManager) GetScheduledForDeletion(before time.Time) (usernames []string, err error) {
+	var users []User
+	err = m.getUserCollection().Find(bson.M{"deletionscheduled": bson.M{"$lte": before}}).Select(bson.M{"username": 1}).All(&users)
+	for _, u := range users {
+		usernames = append(usernames, u.Username)
+	}
+	return
+}
+
+func (m *mongoManager) GetPendingRegistrationsCount() (int, error) {
 	qry := bson.M{
 		"expire": bson.M{
 			"$nin":    []interface{}{"", bson.M{}},
@@ -375,8 +473,19 @@ func (m *Manager) GetPendingRegistrationsCount() (int, error) {
 	return m.getUserCollection().Find(qry).Count()
 }
 
+func (m *mongoManager) RemoveExpiredRegistrations() (int, error) {
+	// Only dates are matched, the expire field of registered users is removed or an empty document
+	info, err := m.getUserCollection().RemoveAll(bson.M{
+		"expire": bson.M{"$type": 9, "$lt": time.Now().Add(-pendingUserValidity)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return info.Removed, nil
+}
+
 // SaveAvatar saves a new or updates an existing avatar
-func (m *Manager) SaveAvatar(username string, avatar Avatar) error {
+func (m *mongoManager) SaveAvatar(username string, avatar Avatar) error {
 	if err := m.RemoveAvatar(username, avatar.Label); err != nil {
 		return err
 	}
@@ -386,21 +495,21 @@ func (m *Manager) SaveAvatar(username string, avatar Avatar) error {
 }
 
 // RemoveAvatar removes an avatar
-func (m *Manager) RemoveAvatar(username, label string) error {
+func (m *mongoManager) RemoveAvatar(username, label string) error {
 	return m.getUserCollection().Update(
 		bson.M{"username": username},
 		bson.M{"$pull": bson.M{"avatars": bson.M{"label": label}}})
 }
 
 // AvatarFileExists checks if an avatarfile with a given hash already exists
-func (m *Manager) AvatarFileExists(hash string) (bool, error) {
+func (m *mongoManager) AvatarFileExists(hash string) (bool, error) {
 	count, err := m.getAvatarFileCollection().Find(bson.M{"hash": hash}).Count()
 
 	return count >= 1, err
 }
 
 // GetAvatarFile gets the avatar file associated with a hash
-func (m *Manager) GetAvatarFile(hash string) ([]byte, error) {
+func (m *mongoManager) GetAvatarFile(hash string) ([]byte, error) {
 	var file struct {
 		Hash string
 		File []byte
@@ -414,14 +523,34 @@ func (m *Manager) GetAvatarFile(hash string) ([]byte, error) {
 }
 
 // SaveAvatarFile saves a new avatar file
-func (m *Manager) SaveAvatarFile(hash string, file []byte) error {
+func (m *mongoManager) SaveAvatarFile(hash string, file []byte) error {
 	_, err := m.getAvatarFileCollection().Upsert(
 		bson.M{"hash": hash},
-		bson.M{"$set": bson.M{"file": file}})
+		bson.M{"$set": bson.M{"file": file, "createdat": time.Now()}})
 	return err
 }
 
 // RemoveAvatarFile removes an avatar file
-func (m *Manager) RemoveAvatarFile(hash string) error {
+func (m *mongoManager) RemoveAvatarFile(hash string) error {
 	return m.getAvatarFileCollection().Remove(bson.M{"hash": hash})
 }
+
+// GetAvatarFileHashes returns the hashes of the avatar files stored before a moment
+func (m *mongoManager) GetAvatarFileHashes(before time.Time) ([]string, error) {
+	var files []avatarFile
+	err := m.getAvatarFileCollection().Find(bson.M{"$or": []bson.M{
+		{"createdat": bson.M{"$lt": before}},
+		{"createdat": bson.M{"$exists": false}},
+	}}).Select(bson.M{"hash": 1}).All(&files)
+	hashes := make([]string, len(files))
+	for i, file := range files {
+		hashes[i] = file.Hash
+	}
+	return hashes, err
+}
+
+// GetAvatarSources returns the sources of the avatars of all users
+func (m *mongoManager) GetAvatarSources() (sources []string, err error) {
+	err = m.getUserCollection().Find(nil).Distinct("avatars.source", &sources)
+	return
+}
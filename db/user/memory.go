@@ -0,0 +1,490 @@
+package user
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type authorizationKey struct {
+	username  string
+	grantedTo string
+}
+
+type memoryStore struct {
+	sync.Mutex
+	users          map[string]User
+	authorizations map[authorizationKey]Authorization
+	avatarFiles    map[string]avatarFile
+}
+
+//memoryManager keeps the users in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoUsersCollectionName, func() interface{} {
+		return &memoryStore{
+			users:          make(map[string]User),
+			authorizations: make(map[authorizationKey]Authorization),
+			avatarFiles:    make(map[string]avatarFile),
+		}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+// findUsers returns copies of the users that match, sorted on username
+func (m *memoryManager) findUsers(match func(u *User) bool) (users []User, err error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	usernames := make([]string, 0, len(m.store.users))
+	for username := range m.store.users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	for _, username := range usernames {
+		u := m.store.users[username]
+		if !match(&u) {
+			continue
+		}
+		var copied User
+		if err = db.CopyDocument(&copied, &u); err != nil {
+			return
+		}
+		users = append(users, copied)
+	}
+	return
+}
+
+// updateUser applies a change to a user, mgo.ErrNotFound is returned if the user does not exist
+func (m *memoryManager) updateUser(username string, change func(u *User)) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	return m.updateLocked(username, change)
+}
+
+// updateLocked applies a change to a user while the store is locked
+func (m *memoryManager) updateLocked(username string, change func(u *User)) error {
+	u, ok := m.store.users[username]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	var updated User
+	if err := db.CopyDocument(&updated, &u); err != nil {
+		return err
+	}
+	change(&updated)
+	m.store.users[username] = updated
+	return nil
+}
+
+func (m *memoryManager) Get(id string) (*User, error) {
+	objectID := bson.ObjectIdHex(id)
+	users, err := m.findUsers(func(u *User) bool { return u.ID == objectID })
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return &users[0], nil
+}
+
+func (m *memoryManager) GetByName(username string) (*User, error) {
+	var user User
+	users, err := m.findUsers(func(u *User) bool { return u.Username == username })
+	if err == nil && len(users) == 0 {
+		err = mgo.ErrNotFound
+	}
+	if err == nil {
+		user = users[0]
+	}
+	user.fillLists()
+	return &user, err
+}
+
+func (m *memoryManager) GetByEmailAddress(email string) ([]string, error) {
+	users, err := m.findUsers(func(u *User) bool {
+		for _, address := range u.EmailAddresses {
+			if address.EmailAddress == email {
+				return true
+			}
+		}
+		return false
+	})
+	var usernames []string
+	for _, u := range users {
+		usernames = append(usernames, u.Username)
+	}
+	return usernames, err
+}
+
+func (m *memoryManager) Exists(username string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	_, exists := m.store.users[username]
+	return exists, nil
+}
+
+func (m *memoryManager) Save(u *User) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if u.ID == "" {
+		if _, exists := m.store.users[u.Username]; exists {
+			return db.ErrDuplicate
+		}
+		u.ID = bson.NewObjectId()
+	} else {
+		for username, stored := range m.store.users {
+			if stored.ID == u.ID {
+				delete(m.store.users, username)
+			}
+		}
+	}
+	var stored User
+	if err := db.CopyDocument(&stored, u); err != nil {
+		return err
+	}
+	m.store.users[u.Username] = stored
+	return nil
+}
+
+func (m *memoryManager) Delete(u *User) error {
+	if u.ID == "" {
+		return errors.New("User not stored")
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	for username, stored := range m.store.users {
+		if stored.ID == u.ID {
+			delete(m.store.users, username)
+			return nil
+		}
+	}
+	return mgo.ErrNotFound
+}
+
+func (m *memoryManager) SaveEmail(username string, email EmailAddress) error {
+	return m.updateUser(username, setEmailAddress(email))
+}
+
+func (m *memoryManager) RemoveEmail(username string, label string) error {
+	return m.updateUser(username, removeEmailAddress(label))
+}
+
+func (m *memoryManager) SavePublicKey(username string, key PublicKey) error {
+	return m.updateUser(username, setPublicKey(key))
+}
+
+func (m *memoryManager) RemovePublicKey(username string, label string) error {
+	return m.updateUser(username, removePublicKey(label))
+}
+
+func (m *memoryManager) SavePhone(username string, phonenumber Phonenumber) error {
+	return m.updateUser(username, setPhonenumber(phonenumber))
+}
+
+func (m *memoryManager) RemovePhone(username string, label string) error {
+	return m.updateUser(username, removePhonenumber(label))
+}
+
+func (m *memoryManager) SaveVirtualCurrency(username string, currency DigitalAssetAddress) error {
+	return m.updateUser(username, setDigitalAssetAddress(currency))
+}
+
+func (m *memoryManager) RemoveVirtualCurrency(username string, label string) error {
+	return m.updateUser(username, removeDigitalAssetAddress(label))
+}
+
+func (m *memoryManager) SaveAddress(username string, address Address) error {
+	return m.updateUser(username, setAddress(address))
+}
+
+func (m *memoryManager) RemoveAddress(username, label string) error {
+	return m.updateUser(username, removeAddress(label))
+}
+
+func (m *memoryManager) SaveBank(u *User, bank BankAccount) error {
+	return m.updateUser(u.Username, setBankAccount(bank))
+}
+
+func (m *memoryManager) RemoveBank(u *User, label string) error {
+	return m.updateUser(u.Username, removeBankAccount(label))
+}
+
+func (m *memoryManager) SaveLinkedAccount(username string, account LinkedAccount) error {
+	// The other users are checked in the same lock as the update, like the unique index of the other backends
+	m.store.Lock()
+	defer m.store.Unlock()
+	for _, u := range m.store.users {
+		if u.Username == username {
+			continue
+		}
+		for _, existing := range u.LinkedAccounts {
+			if existing.Provider == account.Provider && existing.Subject == account.Subject {
+				return db.ErrDuplicate
+			}
+		}
+	}
+	return m.updateLocked(username, setLinkedAccount(account))
+}
+
+func (m *memoryManager) RemoveLinkedAccount(username string, provider string) error {
+	return m.updateUser(username, removeLinkedAccount(provider))
+}
+
+func (m *memoryManager) GetByLinkedAccount(provider string, subject string) (*User, error) {
+	users, err := m.findUsers(func(u *User) bool {
+		for _, account := range u.LinkedAccounts {
+			if account.Provider == provider && account.Subject == subject {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+	return &users[0], nil
+}
+
+// findAuthorizations returns copies of the authorizations that match, sorted on username and organization
+func (m *memoryManager) findAuthorizations(match func(authorization *Authorization) bool) (authorizations []Authorization, err error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	authorizations = []Authorization{}
+	for _, authorization := range m.store.authorizations {
+		if !match(&authorization) {
+			continue
+		}
+		var copied Authorization
+		if err = db.CopyDocument(&copied, &authorization); err != nil {
+			return
+		}
+		authorizations = append(authorizations, copied)
+	}
+	sort.Slice(authorizations, func(i, j int) bool {
+		if authorizations[i].Username != authorizations[j].Username {
+			return authorizations[i].Username < authorizations[j].Username
+		}
+		return authorizations[i].GrantedTo < authorizations[j].GrantedTo
+	})
+	return
+}
+
+func (m *memoryManager) GetAuthorizationsByUser(username string) ([]Authorization, error) {
+	return m.findAuthorizations(func(authorization *Authorization) bool { return authorization.Username == username })
+}
+
+func (m *memoryManager) GetOrganizationAuthorizations(globalId string) ([]Authorization, error) {
+	return m.findAuthorizations(func(authorization *Authorization) bool { return authorization.GrantedTo == globalId })
+}
+
+func (m *memoryManager) GetAuthorization(username, organization string) (*Authorization, error) {
+	authorizations, err := m.findAuthorizations(func(authorization *Authorization) bool {
+		return authorization.Username == username && authorization.GrantedTo == organization
+	})
+	if err != nil || len(authorizations) == 0 {
+		return nil, err
+	}
+	return &authorizations[0], nil
+}
+
+func (m *memoryManager) FilterUsersWithAuthorizations(usernames []string, organization string) ([]string, error) {
+	authorizations, err := m.findAuthorizations(func(authorization *Authorization) bool {
+		if authorization.GrantedTo != organization {
+			return false
+		}
+		for _, username := range usernames {
+			if authorization.Username == username {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, authorization := range authorizations {
+		result = append(result, authorization.Username)
+	}
+	return result, nil
+}
+
+func (m *memoryManager) UpdateAuthorization(authorization *Authorization) error {
+	var stored Authorization
+	if err := db.CopyDocument(&stored, authorization); err != nil {
+		return err
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.authorizations[authorizationKey{authorization.Username, authorization.GrantedTo}] = stored
+	return nil
+}
+
+// removeAuthorizations removes the authorizations that match
+func (m *memoryManager) removeAuthorizations(match func(key authorizationKey) bool) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for key := range m.store.authorizations {
+		if match(key) {
+			delete(m.store.authorizations, key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryManager) DeleteAuthorization(username, organization string) error {
+	return m.removeAuthorizations(func(key authorizationKey) bool {
+		return key.username == username && key.grantedTo == organization
+	})
+}
+
+func (m *memoryManager) DeleteAllAuthorizations(organization string) error {
+	return m.removeAuthorizations(func(key authorizationKey) bool { return key.grantedTo == organization })
+}
+
+func (m *memoryManager) DeleteAuthorizationsByUser(username string) error {
+	return m.removeAuthorizations(func(key authorizationKey) bool { return key.username == username })
+}
+
+func (m *memoryManager) UpdateName(username string, firstname string, lastname string) error {
+	err := m.updateUser(username, func(u *User) {
+		u.Firstname = firstname
+		u.Lastname = lastname
+	})
+	if err == mgo.ErrNotFound {
+		// Like UpdateAll, updating no users is not an error
+		err = nil
+	}
+	return err
+}
+
+func (m *memoryManager) RemoveExpireDate(username string) error {
+	err := m.updateUser(username, func(u *User) { u.Expire = db.DateTime{} })
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	return err
+}
+
+func (m *memoryManager) ScheduleDeletion(username string, at time.Time) error {
+	return m.updateUser(username, func(u *User) {
+		scheduled := db.DateTime(at)
+		u.DeletionScheduled = &scheduled
+	})
+}
+
+func (m *memoryManager) CancelDeletion(username string) error {
+	return m.updateUser(username, func(u *User) { u.DeletionScheduled = nil })
+}
+
+func (m *memoryManager) SetSuspended(username string, suspended bool) error {
+	return m.updateUser(username, func(u *User) { u.Suspended = suspended })
+}
+
+func (m *memoryManager) GetScheduledForDeletion(before time.Time) ([]string, error) {
+	users, err := m.findUsers(func(u *User) bool {
+		return u.DeletionScheduled != nil && !time.Time(*u.DeletionScheduled).After(before)
+	})
+	var usernames []string
+	for _, u := range users {
+		usernames = append(usernames, u.Username)
+	}
+	return usernames, err
+}
+
+func (m *memoryManager) GetPendingRegistrationsCount() (int, error) {
+	users, err := m.findUsers(func(u *User) bool { return !time.Time(u.Expire).IsZero() })
+	return len(users), err
+}
+
+func (m *memoryManager) RemoveExpiredRegistrations() (int, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	removed := 0
+	expired := time.Now().Add(-pendingUserValidity)
+	for username, u := range m.store.users {
+		if !time.Time(u.Expire).IsZero() && time.Time(u.Expire).Before(expired) {
+			delete(m.store.users, username)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *memoryManager) SaveAvatar(username string, avatar Avatar) error {
+	return m.updateUser(username, setAvatar(avatar))
+}
+
+func (m *memoryManager) RemoveAvatar(username, label string) error {
+	return m.updateUser(username, removeAvatar(label))
+}
+
+func (m *memoryManager) AvatarFileExists(hash string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	_, exists := m.store.avatarFiles[hash]
+	return exists, nil
+}
+
+func (m *memoryManager) GetAvatarFile(hash string) ([]byte, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	file, exists := m.store.avatarFiles[hash]
+	if !exists {
+		return nil, nil
+	}
+	return append([]byte{}, file.File...), nil
+}
+
+func (m *memoryManager) SaveAvatarFile(hash string, file []byte) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.avatarFiles[hash] = avatarFile{Hash: hash, File: append([]byte{}, file...), CreatedAt: time.Now()}
+	return nil
+}
+
+func (m *memoryManager) RemoveAvatarFile(hash string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.avatarFiles[hash]; !exists {
+		return mgo.ErrNotFound
+	}
+	delete(m.store.avatarFiles, hash)
+	return nil
+}
+
+func (m *memoryManager) GetAvatarFileHashes(before time.Time) ([]string, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	hashes := []string{}
+	for hash, file := range m.store.avatarFiles {
+		if file.CreatedAt.Before(before) {
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+func (m *memoryManager) GetAvatarSources() ([]string, error) {
+	users, err := m.findUsers(func(u *User) bool { return len(u.Avatars) > 0 })
+	sources := []string{}
+	for _, u := range users {
+		for _, avatar := range u.Avatars {
+			sources = append(sources, avatar.Source)
+		}
+	}
+	return sources, err
+}
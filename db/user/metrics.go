@@ -0,0 +1,20 @@
+package user
+
+import (
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/metrics"
+)
+
+func init() {
+	metrics.NewGaugeFunc("iyo_pending_registrations", "Registrations that are not completed yet", pendingRegistrations)
+}
+
+func pendingRegistrations() (float64, error) {
+	r, release, err := db.NewBackgroundRequest(db.DefaultBackend(), "")
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	count, err := NewManager(r).GetPendingRegistrationsCount()
+	return float64(count), err
+}
@@ -0,0 +1,410 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/lib/pq"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// pendingUserValidity is the time after which a user without valid 2 factor authentication is removed
+const pendingUserValidity = 3 * 24 * time.Hour
+
+var postgresUsers = &db.PostgresCollection{
+	Table: "users",
+	Columns: func(document interface{}) map[string]interface{} {
+		u := document.(*User)
+		emails := []string{}
+		for _, email := range u.EmailAddresses {
+			emails = append(emails, email.EmailAddress)
+		}
+		accounts := []string{}
+		for _, account := range u.LinkedAccounts {
+			accounts = append(accounts, linkedAccountKey(account.Provider, account.Subject))
+		}
+		var deletionScheduled, expiresAt *time.Time
+		if u.DeletionScheduled != nil {
+			scheduled := time.Time(*u.DeletionScheduled)
+			deletionScheduled = &scheduled
+		}
+		if !time.Time(u.Expire).IsZero() {
+			expires := time.Time(u.Expire).Add(pendingUserValidity)
+			expiresAt = &expires
+		}
+		return map[string]interface{}{
+			"username":          u.Username,
+			"emailaddresses":    pq.StringArray(emails),
+			"linkedaccounts":    pq.StringArray(accounts),
+			"deletionscheduled": deletionScheduled,
+			"expires_at":        expiresAt,
+		}
+	},
+}
+
+var postgresAuthorizations = &db.PostgresCollection{
+	Table: "authorizations",
+	Columns: func(document interface{}) map[string]interface{} {
+		authorization := document.(*Authorization)
+		return map[string]interface{}{
+			"username":  authorization.Username,
+			"grantedto": authorization.GrantedTo,
+		}
+	},
+}
+
+type avatarFile struct {
+	Hash      string
+	File      []byte
+	CreatedAt time.Time
+}
+
+var postgresAvatarFiles = &db.PostgresCollection{
+	Table: "avatarfiles",
+	Columns: func(document interface{}) map[string]interface{} {
+		file := document.(*avatarFile)
+		return map[string]interface{}{"hash": file.Hash, "created_at": file.CreatedAt}
+	},
+}
+
+// linkedAccountKey is how a linked account is kept in the linkedaccounts column
+func linkedAccountKey(provider string, subject string) string {
+	return provider + ":" + subject
+}
+
+//postgresManager stores the users in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func newUser() interface{} {
+	return &User{}
+}
+
+// updateUser applies a change to a user, mgo.ErrNotFound is returned if the user does not exist
+func (m *postgresManager) updateUser(username string, change func(u *User)) error {
+	updated, err := postgresUsers.Update(m.db, "username = $1", []interface{}{username}, newUser, func(document interface{}) error {
+		change(document.(*User))
+		return nil
+	})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) Get(id string) (*User, error) {
+	var user User
+	if err := postgresUsers.FindOne(m.db, &user, "id = $1", bson.ObjectIdHex(id).Hex()); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (m *postgresManager) GetByName(username string) (*User, error) {
+	var user User
+	err := postgresUsers.FindOne(m.db, &user, "username = $1", username)
+	user.fillLists()
+	return &user, err
+}
+
+func (m *postgresManager) GetByEmailAddress(email string) (usernames []string, err error) {
+	var users []User
+	err = postgresUsers.Find(m.db, &users, "emailaddresses @> ARRAY[$1::text]", email)
+	for _, u := range users {
+		usernames = append(usernames, u.Username)
+	}
+	return
+}
+
+func (m *postgresManager) Exists(username string) (bool, error) {
+	count, err := postgresUsers.Count(m.db, "username = $1", username)
+	return count >= 1, err
+}
+
+func (m *postgresManager) Save(u *User) error {
+	if u.ID == "" {
+		u.ID = bson.NewObjectId()
+		return postgresUsers.Insert(m.db, u)
+	}
+	return postgresUsers.Upsert(m.db, "id = $1", []interface{}{u.ID.Hex()}, newUser, func(document interface{}) error {
+		return db.CopyDocument(document, u)
+	})
+}
+
+func (m *postgresManager) Delete(u *User) error {
+	if u.ID == "" {
+		return errors.New("User not stored")
+	}
+	removed, err := postgresUsers.Remove(m.db, "id = $1", u.ID.Hex())
+	if err == nil && removed == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) SaveEmail(username string, email EmailAddress) error {
+	return m.updateUser(username, setEmailAddress(email))
+}
+
+func (m *postgresManager) RemoveEmail(username string, label string) error {
+	return m.updateUser(username, removeEmailAddress(label))
+}
+
+func (m *postgresManager) SavePublicKey(username string, key PublicKey) error {
+	return m.updateUser(username, setPublicKey(key))
+}
+
+func (m *postgresManager) RemovePublicKey(username string, label string) error {
+	return m.updateUser(username, removePublicKey(label))
+}
+
+func (m *postgresManager) SavePhone(username string, phonenumber Phonenumber) error {
+	return m.updateUser(username, setPhonenumber(phonenumber))
+}
+
+func (m *postgresManager) RemovePhone(username string, label string) error {
+	return m.updateUser(username, removePhonenumber(label))
+}
+
+func (m *postgresManager) SaveVirtualCurrency(username string, currency DigitalAssetAddress) error {
+	return m.updateUser(username, setDigitalAssetAddress(currency))
+}
+
+func (m *postgresManager) RemoveVirtualCurrency(username string, label string) error {
+	return m.updateUser(username, removeDigitalAssetAddress(label))
+}
+
+func (m *postgresManager) SaveAddress(username string, address Address) error {
+	return m.updateUser(username, setAddress(address))
+}
+
+func (m *postgresManager) RemoveAddress(username, label string) error {
+	return m.updateUser(username, removeAddress(label))
+}
+
+func (m *postgresManager) SaveBank(u *User, bank BankAccount) error {
+	return m.updateUser(u.Username, setBankAccount(bank))
+}
+
+func (m *postgresManager) RemoveBank(u *User, label string) error {
+	return m.updateUser(u.Username, removeBankAccount(label))
+}
+
+func (m *postgresManager) SaveLinkedAccount(username string, account LinkedAccount) error {
+	return m.updateUser(username, setLinkedAccount(account))
+}
+
+func (m *postgresManager) RemoveLinkedAccount(username string, provider string) error {
+	return m.updateUser(username, removeLinkedAccount(provider))
+}
+
+func (m *postgresManager) GetByLinkedAccount(provider string, subject string) (*User, error) {
+	var user User
+	if err := postgresUsers.FindOne(m.db, &user, "linkedaccounts @> ARRAY[$1::text]", linkedAccountKey(provider, subject)); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (m *postgresManager) GetAuthorizationsByUser(username string) (authorizations []Authorization, err error) {
+	authorizations = []Authorization{}
+	err = postgresAuthorizations.Find(m.db, &authorizations, "username = $1", username)
+	return
+}
+
+func (m *postgresManager) GetOrganizationAuthorizations(globalId string) (authorizations []Authorization, err error) {
+	authorizations = []Authorization{}
+	err = postgresAuthorizations.Find(m.db, &authorizations, "grantedto = $1", globalId)
+	return
+}
+
+func (m *postgresManager) GetAuthorization(username, organization string) (*Authorization, error) {
+	var authorization Authorization
+	err := postgresAuthorizations.FindOne(m.db, &authorization, "username = $1 AND grantedto = $2", username, organization)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+func (m *postgresManager) FilterUsersWithAuthorizations(usernames []string, organization string) ([]string, error) {
+	var authorizations []Authorization
+	err := postgresAuthorizations.Find(m.db, &authorizations, "username = ANY($1) AND grantedto = $2", pq.StringArray(usernames), organization)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, authorization := range authorizations {
+		result = append(result, authorization.Username)
+	}
+	return result, nil
+}
+
+func (m *postgresManager) UpdateAuthorization(authorization *Authorization) error {
+	return postgresAuthorizations.Upsert(m.db, "username = $1 AND grantedto = $2",
+		[]interface{}{authorization.Username, authorization.GrantedTo},
+		func() interface{} { return &Authorization{} },
+		func(document interface{}) error { return db.CopyDocument(document, authorization) })
+}
+
+func (m *postgresManager) DeleteAuthorization(username, organization string) error {
+	_, err := postgresAuthorizations.Remove(m.db, "username = $1 AND grantedto = $2", username, organization)
+	return err
+}
+
+func (m *postgresManager) DeleteAllAuthorizations(organization string) error {
+	_, err := postgresAuthorizations.Remove(m.db, "grantedto = $1", organization)
+	return err
+}
+
+func (m *postgresManager) DeleteAuthorizationsByUser(username string) error {
+	_, err := postgresAuthorizations.Remove(m.db, "username = $1", username)
+	return err
+}
+
+func (m *postgresManager) UpdateName(username string, firstname string, lastname string) error {
+	err := m.updateUser(username, func(u *User) {
+		u.Firstname = firstname
+		u.Lastname = lastname
+	})
+	if err == mgo.ErrNotFound {
+		// Like UpdateAll, updating no users is not an error
+		err = nil
+	}
+	return err
+}
+
+func (m *postgresManager) RemoveExpireDate(username string) error {
+	err := m.updateUser(username, func(u *User) { u.Expire = db.DateTime{} })
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	return err
+}
+
+func (m *postgresManager) ScheduleDeletion(username string, at time.Time) error {
+	return m.updateUser(username, func(u *User) {
+		scheduled := db.DateTime(at)
+		u.DeletionScheduled = &scheduled
+	})
+}
+
+func (m *postgresManager) CancelDeletion(username string) error {
+	return m.updateUser(username, func(u *User) { u.DeletionScheduled = nil })
+}
+
+func (m *postgresManager) SetSuspended(username string, suspended bool) error {
+	return m.updateUser(username, func(u *User) { u.Suspended = suspended })
+}
+
+func (m *postgresManager) GetScheduledForDeletion(before time.Time) (usernames []string, err error) {
+	var users []User
+	err = postgresUsers.Find(m.db, &users, "deletionscheduled <= $1", before)
+	for _, u := range users {
+		usernames = append(usernames, u.Username)
+	}
+	return
+}
+
+func (m *postgresManager) GetPendingRegistrationsCount() (int, error) {
+	return postgresUsers.Count(m.db, "expires_at IS NOT NULL")
+}
+
+// RemoveExpiredRegistrations removes what the backend did not remove yet
+func (m *postgresManager) RemoveExpiredRegistrations() (int, error) {
+	return postgresUsers.Remove(m.db, "expires_at < $1", time.Now())
+}
+
+func (m *postgresManager) SaveAvatar(username string, avatar Avatar) error {
+	return m.updateUser(username, setAvatar(avatar))
+}
+
+func (m *postgresManager) RemoveAvatar(username, label string) error {
+	return m.updateUser(username, removeAvatar(label))
+}
+
+func (m *postgresManager) AvatarFileExists(hash string) (bool, error) {
+	count, err := postgresAvatarFiles.Count(m.db, "hash = $1", hash)
+	return count >= 1, err
+}
+
+func (m *postgresManager) GetAvatarFile(hash string) ([]byte, error) {
+	var file avatarFile
+	err := postgresAvatarFiles.FindOne(m.db, &file, "hash = $1", hash)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	return file.File, err
+}
+
+func (m *postgresManager) SaveAvatarFile(hash string, file []byte) error {
+	return postgresAvatarFiles.Upsert(m.db, "hash = $1", []interface{}{hash},
+		func() interface{} { return &avatarFile{Hash: hash} },
+		func(document interface{}) error {
+			document.(*avatarFile).File = file
+			document.(*avatarFile).CreatedAt = time.Now()
+			return nil
+		})
+}
+
+func (m *postgresManager) RemoveAvatarFile(hash string) error {
+	removed, err := postgresAvatarFiles.Remove(m.db, "hash = $1", hash)
+	if err == nil && removed == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) GetAvatarFileHashes(before time.Time) ([]string, error) {
+	rows, err := m.db.Query("SELECT hash FROM avatarfiles WHERE created_at IS NULL OR created_at < $1", before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err = rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// GetAvatarSources reads the avatars from the documents of the users, the sources are not kept in a column
+func (m *postgresManager) GetAvatarSources() ([]string, error) {
+	rows, err := m.db.Query("SELECT document FROM users")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sources := []string{}
+	for rows.Next() {
+		var document []byte
+		if err = rows.Scan(&document); err != nil {
+			return nil, err
+		}
+		u := struct {
+			Avatars []Avatar `bson:"avatars"`
+		}{}
+		if err = bson.Unmarshal(document, &u); err != nil {
+			return nil, err
+		}
+		for _, avatar := range u.Avatars {
+			sources = append(sources, avatar.Source)
+		}
+	}
+	return sources, rows.Err()
+}
@@ -1,7 +1,11 @@
 package user
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,3 +30,32 @@ func TestValidateName(t *testing.T) {
 		assert.Equal(t, test.valid, ValidateName(test.name))
 	}
 }
+
+func TestDeletionScheduledJSON(t *testing.T) {
+	u := User{Username: "bob"}
+	serialized, err := json.Marshal(&u)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(serialized), "deletionscheduled")
+
+	scheduled := db.DateTime(time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC))
+	u.DeletionScheduled = &scheduled
+	serialized, err = json.Marshal(&u)
+	assert.NoError(t, err)
+	assert.Contains(t, string(serialized), `"deletionscheduled":"2017-01-02T03:04:05Z"`)
+}
+
+func TestSaveLinkedAccountUnique(t *testing.T) {
+	m := newMemoryManager(db.NewMemoryBackend())
+	for _, username := range []string{"alice", "bob"} {
+		assert.NoError(t, m.Save(&User{Username: username}))
+	}
+	account := LinkedAccount{Provider: "github", Subject: "42"}
+	assert.NoError(t, m.SaveLinkedAccount("alice", account))
+	assert.NoError(t, m.SaveLinkedAccount("alice", account), "an account can be linked again by the same user")
+	assert.True(t, db.IsDup(m.SaveLinkedAccount("bob", account)))
+
+	linked, err := m.GetByLinkedAccount("github", "42")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", linked.Username)
+	}
+}
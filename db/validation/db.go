@@ -23,74 +23,63 @@ const (
 	mongoValidatedEmailAddresses                     = "validatedemailaddresses"
 )
 
-//InitModels initialize models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:      []string{"key"},
-		Unique:   true,
-		DropDups: false,
-	}
-
-	db.EnsureIndex(mongoOngoingPhonenumberValidationCollectionName, index)
-	db.EnsureIndex(mongoOngoingEmailAddressValidationCollectionName, index)
-
-	automaticExpiration := mgo.Index{
-		Key:         []string{"createdat"},
-		ExpireAfter: time.Second * 60 * 10,
-		Background:  true,
-	}
-	db.EnsureIndex(mongoOngoingPhonenumberValidationCollectionName, automaticExpiration)
-
-	automaticExpiration = mgo.Index{
-		Key:         []string{"createdat"},
-		ExpireAfter: time.Second * 3600 * 48,
-		Background:  true,
-	}
-	db.EnsureIndex(mongoOngoingEmailAddressValidationCollectionName, automaticExpiration)
-
-	index = mgo.Index{
-		Key:      []string{"username", "phonenumber"},
-		Unique:   true,
-		DropDups: true,
-	}
-	db.EnsureIndex(mongoValidatedPhonenumbers, index)
-
-	index = mgo.Index{
-		Key:      []string{"phonenumber"},
-		Unique:   true,
-		DropDups: true,
-	}
-	db.EnsureIndex(mongoValidatedPhonenumbers, index)
-
-	index = mgo.Index{
-		Key:      []string{"username", "emailaddress"},
-		Unique:   true,
-		DropDups: true,
-	}
-	db.EnsureIndex(mongoValidatedEmailAddresses, index)
-	index = mgo.Index{
-		Key:      []string{"emailaddress"},
-		Unique:   true,
-		DropDups: true,
-	}
-	db.EnsureIndex(mongoValidatedEmailAddresses, index)
-
+//Manager is used to store the validations of email addresses and phone numbers
+type Manager interface {
+	NewPhonenumberValidationInformation(username string, phonenumber user.Phonenumber) (info *PhonenumberValidationInformation, err error)
+	NewEmailAddressValidationInformation(username string, email string) (info *EmailAddressValidationInformation, err error)
+	SavePhonenumberValidationInformation(info *PhonenumberValidationInformation) (err error)
+	SaveEmailAddressValidationInformation(info *EmailAddressValidationInformation) (err error)
+	RemovePhonenumberValidationInformation(key string) (err error)
+	RemoveValidatedPhonenumber(username string, phonenumber string) (err error)
+	RemoveValidatedEmailAddress(username string, email string) (err error)
+	RemoveEmailAddressValidationInformation(key string) (err error)
+	UpdatePhonenumberValidationInformation(key string, confirmed bool) (err error)
+	UpdateEmailAddressValidationInformation(key string, confirmed bool) (err error)
+	GetByKeyPhonenumberValidationInformation(key string) (info *PhonenumberValidationInformation, err error)
+	GetByKeyEmailAddressValidationInformation(key string) (info *EmailAddressValidationInformation, err error)
+	GetOngoingEmailAddressValidationByUser(username string) (ongoingValidations []EmailAddressValidationInformation, err error)
+	NewValidatedPhonenumber(username string, phonenumber string) (validatedphonenumber *ValidatedPhonenumber)
+	NewValidatedEmailAddress(username string, email string) (validatedemail *ValidatedEmailAddress)
+	SaveValidatedPhonenumber(validated *ValidatedPhonenumber) (err error)
+	SaveValidatedEmailAddress(validated *ValidatedEmailAddress) (err error)
+	GetByUsernameValidatedPhonenumbers(username string) (validatednumbers []ValidatedPhonenumber, err error)
+	GetValidatedPhoneNumbersByUsernames(usernames []string) (validatedPhonenumbers []ValidatedPhonenumber, err error)
+	GetByEmailAddressValidatedEmailAddress(email string) (validatedemail *ValidatedEmailAddress, err error)
+	GetValidatedEmailAddressesByUsernames(usernames []string) (validatedEmails []ValidatedEmailAddress, err error)
+	GetByUsernameValidatedEmailAddress(username string) (validatedemails []ValidatedEmailAddress, err error)
+	IsEmailAddressValidated(username string, emailaddress string) (validated bool, err error)
+	IsPhonenumberValidated(username string, phonenumber string) (validated bool, err error)
+	HasValidatedPhones(username string) (hasValidatedPhones bool, err error)
+	GetByPhoneNumber(searchString string) (validatedPhonenumber ValidatedPhonenumber, err error)
+	GetByEmailAddress(searchString string) (validatedEmailaddress ValidatedEmailAddress, err error)
+	IsErrNotFound(err error) bool
+	RemoveByUser(username string) (err error)
 }
 
-//Manager is used to store users
-type Manager struct {
+//mongoManager stores the validations in mongo
+type mongoManager struct {
 	session *mgo.Session
 }
 
 //NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session: session,
 	}
 }
 
-func (manager *Manager) NewPhonenumberValidationInformation(username string, phonenumber user.Phonenumber) (info *PhonenumberValidationInformation, err error) {
+func (manager *mongoManager) NewPhonenumberValidationInformation(username string, phonenumber user.Phonenumber) (info *PhonenumberValidationInformation, err error) {
+	return newPhonenumberValidationInformation(username, phonenumber)
+}
+
+func newPhonenumberValidationInformation(username string, phonenumber user.Phonenumber) (info *PhonenumberValidationInformation, err error) {
 	info = &PhonenumberValidationInformation{CreatedAt: time.Now(), Username: username, Phonenumber: phonenumber.Phonenumber}
 	info.Key, err = tools.GenerateRandomString()
 	if err != nil {
@@ -104,7 +93,11 @@ func (manager *Manager) NewPhonenumberValidationInformation(username string, pho
 	return
 }
 
-func (manager *Manager) NewEmailAddressValidationInformation(username string, email string) (info *EmailAddressValidationInformation, err error) {
+func (manager *mongoManager) NewEmailAddressValidationInformation(username string, email string) (info *EmailAddressValidationInformation, err error) {
+	return newEmailAddressValidationInformation(username, email)
+}
+
+func newEmailAddressValidationInformation(username string, email string) (info *EmailAddressValidationInformation, err error) {
 	info = &EmailAddressValidationInformation{CreatedAt: time.Now(), Username: username, EmailAddress: email}
 	info.Key, err = tools.GenerateRandomString()
 	if err != nil {
@@ -118,56 +111,56 @@ func (manager *Manager) NewEmailAddressValidationInformation(username string, em
 }
 
 //SavePhonenumberValidationInformation stores a validated phonenumber.
-func (manager *Manager) SavePhonenumberValidationInformation(info *PhonenumberValidationInformation) (err error) {
+func (manager *mongoManager) SavePhonenumberValidationInformation(info *PhonenumberValidationInformation) (err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoOngoingPhonenumberValidationCollectionName)
 	_, err = mgoCollection.Upsert(bson.M{"phonenumber": info.Phonenumber}, info)
 	return
 }
 
 //SaveEmailAddressValidationInformation stores a validated emailaddress
-func (manager *Manager) SaveEmailAddressValidationInformation(info *EmailAddressValidationInformation) (err error) {
+func (manager *mongoManager) SaveEmailAddressValidationInformation(info *EmailAddressValidationInformation) (err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoOngoingEmailAddressValidationCollectionName)
 	_, err = mgoCollection.Upsert(bson.M{"emailaddress": info.EmailAddress}, info)
 	return
 }
 
-func (manager *Manager) RemovePhonenumberValidationInformation(key string) (err error) {
+func (manager *mongoManager) RemovePhonenumberValidationInformation(key string) (err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoOngoingPhonenumberValidationCollectionName)
 	_, err = mgoCollection.RemoveAll(bson.M{"key": key})
 	return
 }
 
-func (manager *Manager) RemoveValidatedPhonenumber(username string, phonenumber string) (err error) {
+func (manager *mongoManager) RemoveValidatedPhonenumber(username string, phonenumber string) (err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedPhonenumbers)
 	_, err = mgoCollection.RemoveAll(bson.M{"username": username, "phonenumber": phonenumber})
 	return
 }
 
-func (manager *Manager) RemoveValidatedEmailAddress(username string, email string) (err error) {
+func (manager *mongoManager) RemoveValidatedEmailAddress(username string, email string) (err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedEmailAddresses)
 	_, err = mgoCollection.RemoveAll(bson.M{"username": username, "emailaddress": email})
 	return
 }
 
-func (manager *Manager) RemoveEmailAddressValidationInformation(key string) (err error) {
+func (manager *mongoManager) RemoveEmailAddressValidationInformation(key string) (err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoOngoingEmailAddressValidationCollectionName)
 	_, err = mgoCollection.RemoveAll(bson.M{"key": key})
 	return
 }
 
-func (manager *Manager) UpdatePhonenumberValidationInformation(key string, confirmed bool) (err error) {
+func (manager *mongoManager) UpdatePhonenumberValidationInformation(key string, confirmed bool) (err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoOngoingPhonenumberValidationCollectionName)
 	err = mgoCollection.Update(bson.M{"key": key}, bson.M{"$set": bson.M{"confirmed": confirmed}})
 	return
 }
 
-func (manager *Manager) UpdateEmailAddressValidationInformation(key string, confirmed bool) (err error) {
+func (manager *mongoManager) UpdateEmailAddressValidationInformation(key string, confirmed bool) (err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoOngoingEmailAddressValidationCollectionName)
 	err = mgoCollection.Update(bson.M{"key": key}, bson.M{"$set": bson.M{"confirmed": confirmed}})
 	return
 }
 
-func (manager *Manager) GetByKeyPhonenumberValidationInformation(key string) (info *PhonenumberValidationInformation, err error) {
+func (manager *mongoManager) GetByKeyPhonenumberValidationInformation(key string) (info *PhonenumberValidationInformation, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoOngoingPhonenumberValidationCollectionName)
 	err = mgoCollection.Find(bson.M{"key": key}).One(&info)
 	if err == mgo.ErrNotFound {
@@ -177,7 +170,7 @@ func (manager *Manager) GetByKeyPhonenumberValidationInformation(key string) (in
 	return
 }
 
-func (manager *Manager) GetByKeyEmailAddressValidationInformation(key string) (info *EmailAddressValidationInformation, err error) {
+func (manager *mongoManager) GetByKeyEmailAddressValidationInformation(key string) (info *EmailAddressValidationInformation, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoOngoingEmailAddressValidationCollectionName)
 	err = mgoCollection.Find(bson.M{"key": key}).One(&info)
 	if err == mgo.ErrNotFound {
@@ -187,42 +180,50 @@ func (manager *Manager) GetByKeyEmailAddressValidationInformation(key string) (i
 	return
 }
 
-func (manager *Manager) GetOngoingEmailAddressValidationByUser(username string) (ongoingValidations []EmailAddressValidationInformation, err error) {
+func (manager *mongoManager) GetOngoingEmailAddressValidationByUser(username string) (ongoingValidations []EmailAddressValidationInformation, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoOngoingEmailAddressValidationCollectionName)
 	err = mgoCollection.Find(bson.M{"username": username}).All(&ongoingValidations)
 	return
 }
 
-func (manager *Manager) NewValidatedPhonenumber(username string, phonenumber string) (validatedphonenumber *ValidatedPhonenumber) {
+func (manager *mongoManager) NewValidatedPhonenumber(username string, phonenumber string) (validatedphonenumber *ValidatedPhonenumber) {
+	return newValidatedPhonenumber(username, phonenumber)
+}
+
+func newValidatedPhonenumber(username string, phonenumber string) (validatedphonenumber *ValidatedPhonenumber) {
 	validatedphonenumber = &ValidatedPhonenumber{CreatedAt: time.Now(), Username: username, Phonenumber: string(phonenumber)}
 	return
 }
 
-func (manager *Manager) NewValidatedEmailAddress(username string, email string) (validatedemail *ValidatedEmailAddress) {
+func (manager *mongoManager) NewValidatedEmailAddress(username string, email string) (validatedemail *ValidatedEmailAddress) {
+	return newValidatedEmailAddress(username, email)
+}
+
+func newValidatedEmailAddress(username string, email string) (validatedemail *ValidatedEmailAddress) {
 	validatedemail = &ValidatedEmailAddress{CreatedAt: time.Now(), Username: username, EmailAddress: email}
 	return
 }
 
-func (manager *Manager) SaveValidatedPhonenumber(validated *ValidatedPhonenumber) (err error) {
+func (manager *mongoManager) SaveValidatedPhonenumber(validated *ValidatedPhonenumber) (err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedPhonenumbers)
 	_, err = mgoCollection.Upsert(bson.M{"phonenumber": validated.Phonenumber}, validated)
 	return
 }
 
-func (manager *Manager) SaveValidatedEmailAddress(validated *ValidatedEmailAddress) (err error) {
+func (manager *mongoManager) SaveValidatedEmailAddress(validated *ValidatedEmailAddress) (err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedEmailAddresses)
 	_, err = mgoCollection.Upsert(bson.M{"emailaddress": validated.EmailAddress}, validated)
 	return
 }
 
-func (manager *Manager) GetByUsernameValidatedPhonenumbers(username string) (validatednumbers []ValidatedPhonenumber, err error) {
+func (manager *mongoManager) GetByUsernameValidatedPhonenumbers(username string) (validatednumbers []ValidatedPhonenumber, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedPhonenumbers)
 	err = mgoCollection.Find(bson.M{"username": username}).All(&validatednumbers)
 	return
 }
 
 // Returns all validated phone numbers for every username
-func (manager *Manager) GetValidatedPhoneNumbersByUsernames(usernames []string) (validatedPhonenumbers []ValidatedPhonenumber, err error) {
+func (manager *mongoManager) GetValidatedPhoneNumbersByUsernames(usernames []string) (validatedPhonenumbers []ValidatedPhonenumber, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedPhonenumbers)
 	qry := bson.M{
 		"username": bson.M{
@@ -233,7 +234,7 @@ func (manager *Manager) GetValidatedPhoneNumbersByUsernames(usernames []string)
 	return
 }
 
-func (manager *Manager) GetByEmailAddressValidatedEmailAddress(email string) (validatedemail *ValidatedEmailAddress, err error) {
+func (manager *mongoManager) GetByEmailAddressValidatedEmailAddress(email string) (validatedemail *ValidatedEmailAddress, err error) {
 	validatedemail = &ValidatedEmailAddress{}
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedEmailAddresses)
 	err = mgoCollection.Find(bson.M{"emailaddress": email}).One(validatedemail)
@@ -241,7 +242,7 @@ func (manager *Manager) GetByEmailAddressValidatedEmailAddress(email string) (va
 }
 
 // Returns all validated email addresses for every username
-func (manager *Manager) GetValidatedEmailAddressesByUsernames(usernames []string) (validatedEmails []ValidatedEmailAddress, err error) {
+func (manager *mongoManager) GetValidatedEmailAddressesByUsernames(usernames []string) (validatedEmails []ValidatedEmailAddress, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedEmailAddresses)
 	qry := bson.M{
 		"username": bson.M{
@@ -253,13 +254,13 @@ func (manager *Manager) GetValidatedEmailAddressesByUsernames(usernames []string
 	return
 }
 
-func (manager *Manager) GetByUsernameValidatedEmailAddress(username string) (validatedemails []ValidatedEmailAddress, err error) {
+func (manager *mongoManager) GetByUsernameValidatedEmailAddress(username string) (validatedemails []ValidatedEmailAddress, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedEmailAddresses)
 	err = mgoCollection.Find(bson.M{"username": username}).All(&validatedemails)
 	return
 }
 
-func (manager *Manager) IsEmailAddressValidated(username string, emailaddress string) (validated bool, err error) {
+func (manager *mongoManager) IsEmailAddressValidated(username string, emailaddress string) (validated bool, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedEmailAddresses)
 	count, err := mgoCollection.Find(bson.M{"username": username, "emailaddress": emailaddress}).Count()
 	validated = false
@@ -272,7 +273,7 @@ func (manager *Manager) IsEmailAddressValidated(username string, emailaddress st
 	return
 }
 
-func (manager *Manager) IsPhonenumberValidated(username string, phonenumber string) (validated bool, err error) {
+func (manager *mongoManager) IsPhonenumberValidated(username string, phonenumber string) (validated bool, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedPhonenumbers)
 	count, err := mgoCollection.Find(bson.M{"username": username, "phonenumber": phonenumber}).Count()
 	validated = false
@@ -285,24 +286,44 @@ func (manager *Manager) IsPhonenumberValidated(username string, phonenumber stri
 	return
 }
 
-func (manager *Manager) HasValidatedPhones(username string) (hasValidatedPhones bool, err error) {
+func (manager *mongoManager) HasValidatedPhones(username string) (hasValidatedPhones bool, err error) {
 	count, err := db.GetCollection(manager.session, mongoValidatedPhonenumbers).Find(bson.M{"username": username}).Count()
 	hasValidatedPhones = count > 0
 	return hasValidatedPhones, err
 }
 
-func (manager *Manager) GetByPhoneNumber(searchString string) (validatedPhonenumber ValidatedPhonenumber, err error) {
+func (manager *mongoManager) GetByPhoneNumber(searchString string) (validatedPhonenumber ValidatedPhonenumber, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedPhonenumbers)
 	err = mgoCollection.Find(bson.M{"phonenumber": searchString}).One(&validatedPhonenumber)
 	return validatedPhonenumber, err
 }
 
-func (manager *Manager) GetByEmailAddress(searchString string) (validatedEmailaddress ValidatedEmailAddress, err error) {
+func (manager *mongoManager) GetByEmailAddress(searchString string) (validatedEmailaddress ValidatedEmailAddress, err error) {
 	mgoCollection := db.GetCollection(manager.session, mongoValidatedEmailAddresses)
 	err = mgoCollection.Find(bson.M{"emailaddress": searchString}).One(&validatedEmailaddress)
 	return validatedEmailaddress, err
 }
 
-func (manager *Manager) IsErrNotFound(err error) bool {
+func (manager *mongoManager) IsErrNotFound(err error) bool {
+	return isErrNotFound(err)
+}
+
+func isErrNotFound(err error) bool {
 	return err == mgo.ErrNotFound
 }
+
+// RemoveByUser removes the validated and ongoing validations of the email addresses and phone numbers of a user
+func (manager *mongoManager) RemoveByUser(username string) (err error) {
+	collections := []string{
+		mongoValidatedPhonenumbers,
+		mongoValidatedEmailAddresses,
+		mongoOngoingPhonenumberValidationCollectionName,
+		mongoOngoingEmailAddressValidationCollectionName,
+	}
+	for _, collection := range collections {
+		if _, err = db.GetCollection(manager.session, collection).RemoveAll(bson.M{"username": username}); err != nil {
+			return
+		}
+	}
+	return
+}
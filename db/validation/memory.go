@@ -0,0 +1,391 @@
+package validation
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/user"
+	"gopkg.in/mgo.v2"
+)
+
+// The expiration of the ongoing validations in mongo
+const (
+	phonenumberValidationValidity  = 10 * time.Minute
+	emailAddressValidationValidity = 48 * time.Hour
+)
+
+type memoryStore struct {
+	sync.Mutex
+	// The ongoing and validated phone numbers and email addresses are keyed on the phone number or email address
+	ongoingPhonenumbers     map[string]PhonenumberValidationInformation
+	ongoingEmailAddresses   map[string]EmailAddressValidationInformation
+	validatedPhonenumbers   map[string]ValidatedPhonenumber
+	validatedEmailAddresses map[string]ValidatedEmailAddress
+}
+
+// memoryManager keeps the validations in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoValidatedPhonenumbers, func() interface{} {
+		return &memoryStore{
+			ongoingPhonenumbers:     make(map[string]PhonenumberValidationInformation),
+			ongoingEmailAddresses:   make(map[string]EmailAddressValidationInformation),
+			validatedPhonenumbers:   make(map[string]ValidatedPhonenumber),
+			validatedEmailAddresses: make(map[string]ValidatedEmailAddress),
+		}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+// sortedKeys returns the keys of a map with string keys in order
+func sortedKeys(keys func(add func(key string))) []string {
+	sorted := []string{}
+	keys(func(key string) { sorted = append(sorted, key) })
+	sort.Strings(sorted)
+	return sorted
+}
+
+// ongoingPhonenumbers returns the ongoing phone number validations that did not expire, the caller holds the lock
+func (manager *memoryManager) ongoingPhonenumbers() []PhonenumberValidationInformation {
+	keys := sortedKeys(func(add func(string)) {
+		for key := range manager.store.ongoingPhonenumbers {
+			add(key)
+		}
+	})
+	infos := []PhonenumberValidationInformation{}
+	for _, key := range keys {
+		info := manager.store.ongoingPhonenumbers[key]
+		if time.Since(info.CreatedAt) <= phonenumberValidationValidity {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// ongoingEmailAddresses returns the ongoing email address validations that did not expire, the caller holds the lock
+func (manager *memoryManager) ongoingEmailAddresses() []EmailAddressValidationInformation {
+	keys := sortedKeys(func(add func(string)) {
+		for key := range manager.store.ongoingEmailAddresses {
+			add(key)
+		}
+	})
+	infos := []EmailAddressValidationInformation{}
+	for _, key := range keys {
+		info := manager.store.ongoingEmailAddresses[key]
+		if time.Since(info.CreatedAt) <= emailAddressValidationValidity {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// validatedPhonenumbers returns the validated phone numbers that match, the caller holds the lock
+func (manager *memoryManager) validatedPhonenumbers(match func(validated ValidatedPhonenumber) bool) []ValidatedPhonenumber {
+	keys := sortedKeys(func(add func(string)) {
+		for key := range manager.store.validatedPhonenumbers {
+			add(key)
+		}
+	})
+	var result []ValidatedPhonenumber
+	for _, key := range keys {
+		if validated := manager.store.validatedPhonenumbers[key]; match(validated) {
+			result = append(result, validated)
+		}
+	}
+	return result
+}
+
+// validatedEmailAddresses returns the validated email addresses that match, the caller holds the lock
+func (manager *memoryManager) validatedEmailAddresses(match func(validated ValidatedEmailAddress) bool) []ValidatedEmailAddress {
+	keys := sortedKeys(func(add func(string)) {
+		for key := range manager.store.validatedEmailAddresses {
+			add(key)
+		}
+	})
+	var result []ValidatedEmailAddress
+	for _, key := range keys {
+		if validated := manager.store.validatedEmailAddresses[key]; match(validated) {
+			result = append(result, validated)
+		}
+	}
+	return result
+}
+
+func (manager *memoryManager) NewPhonenumberValidationInformation(username string, phonenumber user.Phonenumber) (*PhonenumberValidationInformation, error) {
+	return newPhonenumberValidationInformation(username, phonenumber)
+}
+
+func (manager *memoryManager) NewEmailAddressValidationInformation(username string, email string) (*EmailAddressValidationInformation, error) {
+	return newEmailAddressValidationInformation(username, email)
+}
+
+func (manager *memoryManager) SavePhonenumberValidationInformation(info *PhonenumberValidationInformation) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	for phonenumber, existing := range manager.store.ongoingPhonenumbers {
+		if existing.Key == info.Key && phonenumber != info.Phonenumber {
+			return db.ErrDuplicate
+		}
+	}
+	manager.store.ongoingPhonenumbers[info.Phonenumber] = *info
+	return nil
+}
+
+func (manager *memoryManager) SaveEmailAddressValidationInformation(info *EmailAddressValidationInformation) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	for email, existing := range manager.store.ongoingEmailAddresses {
+		if existing.Key == info.Key && email != info.EmailAddress {
+			return db.ErrDuplicate
+		}
+	}
+	manager.store.ongoingEmailAddresses[info.EmailAddress] = *info
+	return nil
+}
+
+func (manager *memoryManager) RemovePhonenumberValidationInformation(key string) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	for phonenumber, info := range manager.store.ongoingPhonenumbers {
+		if info.Key == key {
+			delete(manager.store.ongoingPhonenumbers, phonenumber)
+		}
+	}
+	return nil
+}
+
+func (manager *memoryManager) RemoveValidatedPhonenumber(username string, phonenumber string) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	if validated, ok := manager.store.validatedPhonenumbers[phonenumber]; ok && validated.Username == username {
+		delete(manager.store.validatedPhonenumbers, phonenumber)
+	}
+	return nil
+}
+
+func (manager *memoryManager) RemoveValidatedEmailAddress(username string, email string) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	if validated, ok := manager.store.validatedEmailAddresses[email]; ok && validated.Username == username {
+		delete(manager.store.validatedEmailAddresses, email)
+	}
+	return nil
+}
+
+func (manager *memoryManager) RemoveEmailAddressValidationInformation(key string) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	for email, info := range manager.store.ongoingEmailAddresses {
+		if info.Key == key {
+			delete(manager.store.ongoingEmailAddresses, email)
+		}
+	}
+	return nil
+}
+
+func (manager *memoryManager) UpdatePhonenumberValidationInformation(key string, confirmed bool) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	for _, info := range manager.ongoingPhonenumbers() {
+		if info.Key == key {
+			info.Confirmed = confirmed
+			manager.store.ongoingPhonenumbers[info.Phonenumber] = info
+			return nil
+		}
+	}
+	return mgo.ErrNotFound
+}
+
+func (manager *memoryManager) UpdateEmailAddressValidationInformation(key string, confirmed bool) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	for _, info := range manager.ongoingEmailAddresses() {
+		if info.Key == key {
+			info.Confirmed = confirmed
+			manager.store.ongoingEmailAddresses[info.EmailAddress] = info
+			return nil
+		}
+	}
+	return mgo.ErrNotFound
+}
+
+func (manager *memoryManager) GetByKeyPhonenumberValidationInformation(key string) (*PhonenumberValidationInformation, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	for _, info := range manager.ongoingPhonenumbers() {
+		if info.Key == key {
+			return &info, nil
+		}
+	}
+	return nil, nil
+}
+
+func (manager *memoryManager) GetByKeyEmailAddressValidationInformation(key string) (*EmailAddressValidationInformation, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	for _, info := range manager.ongoingEmailAddresses() {
+		if info.Key == key {
+			return &info, nil
+		}
+	}
+	return nil, nil
+}
+
+func (manager *memoryManager) GetOngoingEmailAddressValidationByUser(username string) ([]EmailAddressValidationInformation, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	var ongoingValidations []EmailAddressValidationInformation
+	for _, info := range manager.ongoingEmailAddresses() {
+		if info.Username == username {
+			ongoingValidations = append(ongoingValidations, info)
+		}
+	}
+	return ongoingValidations, nil
+}
+
+func (manager *memoryManager) NewValidatedPhonenumber(username string, phonenumber string) *ValidatedPhonenumber {
+	return newValidatedPhonenumber(username, phonenumber)
+}
+
+func (manager *memoryManager) NewValidatedEmailAddress(username string, email string) *ValidatedEmailAddress {
+	return newValidatedEmailAddress(username, email)
+}
+
+func (manager *memoryManager) SaveValidatedPhonenumber(validated *ValidatedPhonenumber) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	manager.store.validatedPhonenumbers[validated.Phonenumber] = *validated
+	return nil
+}
+
+func (manager *memoryManager) SaveValidatedEmailAddress(validated *ValidatedEmailAddress) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	manager.store.validatedEmailAddresses[validated.EmailAddress] = *validated
+	return nil
+}
+
+func (manager *memoryManager) GetByUsernameValidatedPhonenumbers(username string) ([]ValidatedPhonenumber, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	return manager.validatedPhonenumbers(func(validated ValidatedPhonenumber) bool {
+		return validated.Username == username
+	}), nil
+}
+
+func (manager *memoryManager) GetValidatedPhoneNumbersByUsernames(usernames []string) ([]ValidatedPhonenumber, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	return manager.validatedPhonenumbers(func(validated ValidatedPhonenumber) bool {
+		return containsUsername(usernames, validated.Username)
+	}), nil
+}
+
+func (manager *memoryManager) GetByEmailAddressValidatedEmailAddress(email string) (*ValidatedEmailAddress, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	validated, ok := manager.store.validatedEmailAddresses[email]
+	if !ok {
+		return &ValidatedEmailAddress{}, mgo.ErrNotFound
+	}
+	return &validated, nil
+}
+
+func (manager *memoryManager) GetValidatedEmailAddressesByUsernames(usernames []string) ([]ValidatedEmailAddress, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	return manager.validatedEmailAddresses(func(validated ValidatedEmailAddress) bool {
+		return containsUsername(usernames, validated.Username)
+	}), nil
+}
+
+func (manager *memoryManager) GetByUsernameValidatedEmailAddress(username string) ([]ValidatedEmailAddress, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	return manager.validatedEmailAddresses(func(validated ValidatedEmailAddress) bool {
+		return validated.Username == username
+	}), nil
+}
+
+func (manager *memoryManager) IsEmailAddressValidated(username string, emailaddress string) (bool, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	validated, ok := manager.store.validatedEmailAddresses[emailaddress]
+	return ok && validated.Username == username, nil
+}
+
+func (manager *memoryManager) IsPhonenumberValidated(username string, phonenumber string) (bool, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	validated, ok := manager.store.validatedPhonenumbers[phonenumber]
+	return ok && validated.Username == username, nil
+}
+
+func (manager *memoryManager) HasValidatedPhones(username string) (bool, error) {
+	numbers, err := manager.GetByUsernameValidatedPhonenumbers(username)
+	return len(numbers) > 0, err
+}
+
+func (manager *memoryManager) GetByPhoneNumber(searchString string) (ValidatedPhonenumber, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	validated, ok := manager.store.validatedPhonenumbers[searchString]
+	if !ok {
+		return ValidatedPhonenumber{}, mgo.ErrNotFound
+	}
+	return validated, nil
+}
+
+func (manager *memoryManager) GetByEmailAddress(searchString string) (ValidatedEmailAddress, error) {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	validated, ok := manager.store.validatedEmailAddresses[searchString]
+	if !ok {
+		return ValidatedEmailAddress{}, mgo.ErrNotFound
+	}
+	return validated, nil
+}
+
+func (manager *memoryManager) IsErrNotFound(err error) bool {
+	return isErrNotFound(err)
+}
+
+func (manager *memoryManager) RemoveByUser(username string) error {
+	manager.store.Lock()
+	defer manager.store.Unlock()
+	for key, validated := range manager.store.validatedPhonenumbers {
+		if validated.Username == username {
+			delete(manager.store.validatedPhonenumbers, key)
+		}
+	}
+	for key, validated := range manager.store.validatedEmailAddresses {
+		if validated.Username == username {
+			delete(manager.store.validatedEmailAddresses, key)
+		}
+	}
+	for key, info := range manager.store.ongoingPhonenumbers {
+		if info.Username == username {
+			delete(manager.store.ongoingPhonenumbers, key)
+		}
+	}
+	for key, info := range manager.store.ongoingEmailAddresses {
+		if info.Username == username {
+			delete(manager.store.ongoingEmailAddresses, key)
+		}
+	}
+	return nil
+}
+
+func containsUsername(usernames []string, username string) bool {
+	for _, u := range usernames {
+		if u == username {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package validation
+
+import (
+	"database/sql"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/user"
+	"github.com/lib/pq"
+	"gopkg.in/mgo.v2"
+)
+
+var postgresOngoingPhonenumberValidations = &db.PostgresCollection{
+	Table: "ongoingphonenumbervalidations",
+	Columns: func(document interface{}) map[string]interface{} {
+		info := document.(*PhonenumberValidationInformation)
+		return map[string]interface{}{
+			"key":         info.Key,
+			"username":    info.Username,
+			"phonenumber": info.Phonenumber,
+			"expires_at":  info.CreatedAt.Add(phonenumberValidationValidity),
+		}
+	},
+}
+
+var postgresOngoingEmailAddressValidations = &db.PostgresCollection{
+	Table: "ongoingemailaddressvalidations",
+	Columns: func(document interface{}) map[string]interface{} {
+		info := document.(*EmailAddressValidationInformation)
+		return map[string]interface{}{
+			"key":          info.Key,
+			"username":     info.Username,
+			"emailaddress": info.EmailAddress,
+			"expires_at":   info.CreatedAt.Add(emailAddressValidationValidity),
+		}
+	},
+}
+
+var postgresValidatedPhonenumbers = &db.PostgresCollection{
+	Table: "validatedphonenumbers",
+	Columns: func(document interface{}) map[string]interface{} {
+		validated := document.(*ValidatedPhonenumber)
+		return map[string]interface{}{
+			"username":    validated.Username,
+			"phonenumber": validated.Phonenumber,
+		}
+	},
+}
+
+var postgresValidatedEmailAddresses = &db.PostgresCollection{
+	Table: "validatedemailaddresses",
+	Columns: func(document interface{}) map[string]interface{} {
+		validated := document.(*ValidatedEmailAddress)
+		return map[string]interface{}{
+			"username":     validated.Username,
+			"emailaddress": validated.EmailAddress,
+		}
+	},
+}
+
+//postgresManager stores the validations in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+// replace returns a change that overwrites a document with value
+func replace(value interface{}) func(document interface{}) error {
+	return func(document interface{}) error {
+		return db.CopyDocument(document, value)
+	}
+}
+
+func (m *postgresManager) NewPhonenumberValidationInformation(username string, phonenumber user.Phonenumber) (*PhonenumberValidationInformation, error) {
+	return newPhonenumberValidationInformation(username, phonenumber)
+}
+
+func (m *postgresManager) NewEmailAddressValidationInformation(username string, email string) (*EmailAddressValidationInformation, error) {
+	return newEmailAddressValidationInformation(username, email)
+}
+
+func (m *postgresManager) SavePhonenumberValidationInformation(info *PhonenumberValidationInformation) error {
+	return postgresOngoingPhonenumberValidations.Upsert(m.db, "phonenumber = $1", []interface{}{info.Phonenumber},
+		func() interface{} { return &PhonenumberValidationInformation{} }, replace(info))
+}
+
+func (m *postgresManager) SaveEmailAddressValidationInformation(info *EmailAddressValidationInformation) error {
+	return postgresOngoingEmailAddressValidations.Upsert(m.db, "emailaddress = $1", []interface{}{info.EmailAddress},
+		func() interface{} { return &EmailAddressValidationInformation{} }, replace(info))
+}
+
+func (m *postgresManager) RemovePhonenumberValidationInformation(key string) error {
+	_, err := postgresOngoingPhonenumberValidations.Remove(m.db, "key = $1", key)
+	return err
+}
+
+func (m *postgresManager) RemoveValidatedPhonenumber(username string, phonenumber string) error {
+	_, err := postgresValidatedPhonenumbers.Remove(m.db, "username = $1 AND phonenumber = $2", username, phonenumber)
+	return err
+}
+
+func (m *postgresManager) RemoveValidatedEmailAddress(username string, email string) error {
+	_, err := postgresValidatedEmailAddresses.Remove(m.db, "username = $1 AND emailaddress = $2", username, email)
+	return err
+}
+
+func (m *postgresManager) RemoveEmailAddressValidationInformation(key string) error {
+	_, err := postgresOngoingEmailAddressValidations.Remove(m.db, "key = $1", key)
+	return err
+}
+
+func (m *postgresManager) UpdatePhonenumberValidationInformation(key string, confirmed bool) error {
+	updated, err := postgresOngoingPhonenumberValidations.Update(m.db, "key = $1", []interface{}{key},
+		func() interface{} { return &PhonenumberValidationInformation{} },
+		func(document interface{}) error {
+			document.(*PhonenumberValidationInformation).Confirmed = confirmed
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) UpdateEmailAddressValidationInformation(key string, confirmed bool) error {
+	updated, err := postgresOngoingEmailAddressValidations.Update(m.db, "key = $1", []interface{}{key},
+		func() interface{} { return &EmailAddressValidationInformation{} },
+		func(document interface{}) error {
+			document.(*EmailAddressValidationInformation).Confirmed = confirmed
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) GetByKeyPhonenumberValidationInformation(key string) (*PhonenumberValidationInformation, error) {
+	var info PhonenumberValidationInformation
+	err := postgresOngoingPhonenumberValidations.FindOne(m.db, &info, "key = $1", key)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			err = nil
+		}
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (m *postgresManager) GetByKeyEmailAddressValidationInformation(key string) (*EmailAddressValidationInformation, error) {
+	var info EmailAddressValidationInformation
+	err := postgresOngoingEmailAddressValidations.FindOne(m.db, &info, "key = $1", key)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			err = nil
+		}
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (m *postgresManager) GetOngoingEmailAddressValidationByUser(username string) (ongoingValidations []EmailAddressValidationInformation, err error) {
+	err = postgresOngoingEmailAddressValidations.Find(m.db, &ongoingValidations, "username = $1", username)
+	return
+}
+
+func (m *postgresManager) NewValidatedPhonenumber(username string, phonenumber string) *ValidatedPhonenumber {
+	return newValidatedPhonenumber(username, phonenumber)
+}
+
+func (m *postgresManager) NewValidatedEmailAddress(username string, email string) *ValidatedEmailAddress {
+	return newValidatedEmailAddress(username, email)
+}
+
+func (m *postgresManager) SaveValidatedPhonenumber(validated *ValidatedPhonenumber) error {
+	return postgresValidatedPhonenumbers.Upsert(m.db, "phonenumber = $1", []interface{}{validated.Phonenumber},
+		func() interface{} { return &ValidatedPhonenumber{} }, replace(validated))
+}
+
+func (m *postgresManager) SaveValidatedEmailAddress(validated *ValidatedEmailAddress) error {
+	return postgresValidatedEmailAddresses.Upsert(m.db, "emailaddress = $1", []interface{}{validated.EmailAddress},
+		func() interface{} { return &ValidatedEmailAddress{} }, replace(validated))
+}
+
+func (m *postgresManager) GetByUsernameValidatedPhonenumbers(username string) (validatednumbers []ValidatedPhonenumber, err error) {
+	err = postgresValidatedPhonenumbers.Find(m.db, &validatednumbers, "username = $1", username)
+	return
+}
+
+func (m *postgresManager) GetValidatedPhoneNumbersByUsernames(usernames []string) (validatedPhonenumbers []ValidatedPhonenumber, err error) {
+	err = postgresValidatedPhonenumbers.Find(m.db, &validatedPhonenumbers, "username = ANY($1)", pq.StringArray(usernames))
+	return
+}
+
+func (m *postgresManager) GetByEmailAddressValidatedEmailAddress(email string) (*ValidatedEmailAddress, error) {
+	validatedemail := &ValidatedEmailAddress{}
+	err := postgresValidatedEmailAddresses.FindOne(m.db, validatedemail, "emailaddress = $1", email)
+	return validatedemail, err
+}
+
+func (m *postgresManager) GetValidatedEmailAddressesByUsernames(usernames []string) (validatedEmails []ValidatedEmailAddress, err error) {
+	err = postgresValidatedEmailAddresses.Find(m.db, &validatedEmails, "username = ANY($1)", pq.StringArray(usernames))
+	return
+}
+
+func (m *postgresManager) GetByUsernameValidatedEmailAddress(username string) (validatedemails []ValidatedEmailAddress, err error) {
+	err = postgresValidatedEmailAddresses.Find(m.db, &validatedemails, "username = $1", username)
+	return
+}
+
+func (m *postgresManager) IsEmailAddressValidated(username string, emailaddress string) (bool, error) {
+	count, err := postgresValidatedEmailAddresses.Count(m.db, "username = $1 AND emailaddress = $2", username, emailaddress)
+	return err == nil && count != 0, err
+}
+
+func (m *postgresManager) IsPhonenumberValidated(username string, phonenumber string) (bool, error) {
+	count, err := postgresValidatedPhonenumbers.Count(m.db, "username = $1 AND phonenumber = $2", username, phonenumber)
+	return err == nil && count != 0, err
+}
+
+func (m *postgresManager) HasValidatedPhones(username string) (bool, error) {
+	count, err := postgresValidatedPhonenumbers.Count(m.db, "username = $1", username)
+	return count > 0, err
+}
+
+func (m *postgresManager) GetByPhoneNumber(searchString string) (validatedPhonenumber ValidatedPhonenumber, err error) {
+	err = postgresValidatedPhonenumbers.FindOne(m.db, &validatedPhonenumber, "phonenumber = $1", searchString)
+	return
+}
+
+func (m *postgresManager) GetByEmailAddress(searchString string) (validatedEmailaddress ValidatedEmailAddress, err error) {
+	err = postgresValidatedEmailAddresses.FindOne(m.db, &validatedEmailaddress, "emailaddress = $1", searchString)
+	return
+}
+
+func (m *postgresManager) IsErrNotFound(err error) bool {
+	return isErrNotFound(err)
+}
+
+func (m *postgresManager) RemoveByUser(username string) (err error) {
+	collections := []*db.PostgresCollection{
+		postgresValidatedPhonenumbers,
+		postgresValidatedEmailAddresses,
+		postgresOngoingPhonenumberValidations,
+		postgresOngoingEmailAddressValidations,
+	}
+	for _, collection := range collections {
+		if _, err = collection.Remove(m.db, "username = $1", username); err != nil {
+			return
+		}
+	}
+	return
+}
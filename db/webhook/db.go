@@ -0,0 +1,142 @@
+// Package webhook stores the webhooks of organizations and the outbox of their deliveries
+package webhook
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	mongoWebhooksCollectionName   = "webhooks"
+	mongoDeliveriesCollectionName = "webhookdeliveries"
+)
+
+// Manager is used to store the webhooks and their deliveries
+type Manager interface {
+	Create(webhook *Webhook) error
+	// Update changes the url and the events of a webhook
+	Update(webhook *Webhook) error
+	Get(globalID string, id string) (*Webhook, error)
+	ListByOrganization(globalID string) ([]Webhook, error)
+	// Delete removes a webhook and its deliveries
+	Delete(globalID string, id string) error
+	RemoveByOrganization(globalID string) error
+	SaveDelivery(delivery *Delivery) error
+	// UpdateDelivery stores the result of an attempt
+	UpdateDelivery(delivery *Delivery) error
+	// ClaimDeliveries returns at most limit pending deliveries of which the next attempt is due and postpones
+	// their next attempt to until, so other instances do not send them at the same time
+	ClaimDeliveries(until time.Time, limit int) ([]Delivery, error)
+	// ListDeliveries returns the last deliveries of a webhook, newest first
+	ListDeliveries(globalID string, webhookID string, limit int) ([]Delivery, error)
+}
+
+// mongoManager stores the webhooks and deliveries in mongo, a TTL index removes the expired deliveries
+type mongoManager struct {
+	webhooks   *mgo.Collection
+	deliveries *mgo.Collection
+}
+
+// NewManager creates and initializes a new Manager
+func NewManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
+	session := db.GetDBSession(r)
+	return &mongoManager{
+		webhooks:   db.GetCollection(session, mongoWebhooksCollectionName),
+		deliveries: db.GetCollection(session, mongoDeliveriesCollectionName),
+	}
+}
+
+func (m *mongoManager) Create(webhook *Webhook) error {
+	if webhook.ID == "" {
+		webhook.ID = bson.NewObjectId()
+	}
+	return m.webhooks.Insert(webhook)
+}
+
+func (m *mongoManager) Update(webhook *Webhook) error {
+	return m.webhooks.Update(bson.M{"_id": webhook.ID, "globalid": webhook.Globalid},
+		bson.M{"$set": bson.M{"url": webhook.URL, "events": webhook.Events}})
+}
+
+func (m *mongoManager) Get(globalID string, id string) (*Webhook, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, mgo.ErrNotFound
+	}
+	webhook := &Webhook{}
+	err := m.webhooks.Find(bson.M{"_id": bson.ObjectIdHex(id), "globalid": globalID}).One(webhook)
+	return webhook, err
+}
+
+func (m *mongoManager) ListByOrganization(globalID string) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := m.webhooks.Find(bson.M{"globalid": globalID}).Sort("createdat").All(&webhooks)
+	return webhooks, err
+}
+
+func (m *mongoManager) Delete(globalID string, id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return mgo.ErrNotFound
+	}
+	if err := m.webhooks.Remove(bson.M{"_id": bson.ObjectIdHex(id), "globalid": globalID}); err != nil {
+		return err
+	}
+	_, err := m.deliveries.RemoveAll(bson.M{"webhookid": bson.ObjectIdHex(id)})
+	return err
+}
+
+func (m *mongoManager) RemoveByOrganization(globalID string) error {
+	if _, err := m.webhooks.RemoveAll(bson.M{"globalid": globalID}); err != nil {
+		return err
+	}
+	_, err := m.deliveries.RemoveAll(bson.M{"globalid": globalID})
+	return err
+}
+
+func (m *mongoManager) SaveDelivery(delivery *Delivery) error {
+	if delivery.ID == "" {
+		delivery.ID = bson.NewObjectId()
+	}
+	return m.deliveries.Insert(delivery)
+}
+
+func (m *mongoManager) UpdateDelivery(delivery *Delivery) error {
+	return m.deliveries.UpdateId(delivery.ID, delivery)
+}
+
+func (m *mongoManager) ClaimDeliveries(until time.Time, limit int) ([]Delivery, error) {
+	claimed := []Delivery{}
+	for len(claimed) < limit {
+		delivery := Delivery{}
+		_, err := m.deliveries.Find(bson.M{"status": StatusPending, "nextattempt": bson.M{"$lte": time.Now()}}).
+			Sort("nextattempt").
+			Apply(mgo.Change{Update: bson.M{"$set": bson.M{"nextattempt": until}}, ReturnNew: true}, &delivery)
+		if err == mgo.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+func (m *mongoManager) ListDeliveries(globalID string, webhookID string, limit int) ([]Delivery, error) {
+	deliveries := []Delivery{}
+	if !bson.IsObjectIdHex(webhookID) {
+		return deliveries, nil
+	}
+	err := m.deliveries.Find(bson.M{"webhookid": bson.ObjectIdHex(webhookID), "globalid": globalID}).
+		Sort("-createdat").Limit(limit).All(&deliveries)
+	return deliveries, err
+}
@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	webhooks   map[bson.ObjectId]Webhook
+	deliveries map[bson.ObjectId]Delivery
+}
+
+// memoryManager keeps the webhooks and deliveries in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoWebhooksCollectionName, func() interface{} {
+		return &memoryStore{webhooks: make(map[bson.ObjectId]Webhook), deliveries: make(map[bson.ObjectId]Delivery)}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) Create(webhook *Webhook) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if webhook.ID == "" {
+		webhook.ID = bson.NewObjectId()
+	}
+	if _, exists := m.store.webhooks[webhook.ID]; exists {
+		return db.ErrDuplicate
+	}
+	m.store.webhooks[webhook.ID] = *webhook
+	return nil
+}
+
+func (m *memoryManager) Update(webhook *Webhook) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	stored, ok := m.store.webhooks[webhook.ID]
+	if !ok || stored.Globalid != webhook.Globalid {
+		return mgo.ErrNotFound
+	}
+	stored.URL = webhook.URL
+	stored.Events = webhook.Events
+	m.store.webhooks[webhook.ID] = stored
+	return nil
+}
+
+func (m *memoryManager) Get(globalID string, id string) (*Webhook, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if !bson.IsObjectIdHex(id) {
+		return nil, mgo.ErrNotFound
+	}
+	webhook, ok := m.store.webhooks[bson.ObjectIdHex(id)]
+	if !ok || webhook.Globalid != globalID {
+		return nil, mgo.ErrNotFound
+	}
+	return &webhook, nil
+}
+
+func (m *memoryManager) ListByOrganization(globalID string) ([]Webhook, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	webhooks := []Webhook{}
+	for _, webhook := range m.store.webhooks {
+		if webhook.Globalid == globalID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt) })
+	return webhooks, nil
+}
+
+func (m *memoryManager) Delete(globalID string, id string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if !bson.IsObjectIdHex(id) {
+		return mgo.ErrNotFound
+	}
+	webhook, ok := m.store.webhooks[bson.ObjectIdHex(id)]
+	if !ok || webhook.Globalid != globalID {
+		return mgo.ErrNotFound
+	}
+	delete(m.store.webhooks, webhook.ID)
+	for deliveryID, delivery := range m.store.deliveries {
+		if delivery.WebhookID == webhook.ID {
+			delete(m.store.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (m *memoryManager) RemoveByOrganization(globalID string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for id, webhook := range m.store.webhooks {
+		if webhook.Globalid == globalID {
+			delete(m.store.webhooks, id)
+		}
+	}
+	for id, delivery := range m.store.deliveries {
+		if delivery.Globalid == globalID {
+			delete(m.store.deliveries, id)
+		}
+	}
+	return nil
+}
+
+func (m *memoryManager) SaveDelivery(delivery *Delivery) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if delivery.ID == "" {
+		delivery.ID = bson.NewObjectId()
+	}
+	if _, exists := m.store.deliveries[delivery.ID]; exists {
+		return db.ErrDuplicate
+	}
+	m.store.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+func (m *memoryManager) UpdateDelivery(delivery *Delivery) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.deliveries[delivery.ID]; !exists {
+		return mgo.ErrNotFound
+	}
+	m.store.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+func (m *memoryManager) ClaimDeliveries(until time.Time, limit int) ([]Delivery, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	now := time.Now()
+	claimed := []Delivery{}
+	for _, delivery := range m.store.deliveries {
+		if delivery.Status == StatusPending && !delivery.NextAttempt.After(now) && now.Before(delivery.ExpiresAt) {
+			claimed = append(claimed, delivery)
+		}
+	}
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].NextAttempt.Before(claimed[j].NextAttempt) })
+	if len(claimed) > limit {
+		claimed = claimed[:limit]
+	}
+	for i := range claimed {
+		claimed[i].NextAttempt = until
+		m.store.deliveries[claimed[i].ID] = claimed[i]
+	}
+	return claimed, nil
+}
+
+func (m *memoryManager) ListDeliveries(globalID string, webhookID string, limit int) ([]Delivery, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	now := time.Now()
+	deliveries := []Delivery{}
+	for _, delivery := range m.store.deliveries {
+		if delivery.WebhookID.Hex() == webhookID && delivery.Globalid == globalID && now.Before(delivery.ExpiresAt) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt) })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
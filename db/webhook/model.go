@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The events a webhook can subscribe to
+const (
+	// EventMemberAdded is sent when a user or an organization becomes a member or owner of the organization
+	EventMemberAdded = "member_added"
+	// EventMemberRemoved is sent when a user or an organization leaves or is removed from the organization
+	EventMemberRemoved = "member_removed"
+	// EventRoleChanged is sent when a member becomes an owner or the other way around
+	EventRoleChanged = "role_changed"
+	// EventInvitationAccepted is sent when a user or an organization accepts an invitation of the organization
+	EventInvitationAccepted = "invitation_accepted"
+	// EventGrantChanged is sent when the organization adds, changes or removes a grant of a user
+	EventGrantChanged = "grant_changed"
+	// EventAuthorizationRevoked is sent when a user revokes the authorization of the organization
+	EventAuthorizationRevoked = "authorization_revoked"
+	// EventAPIKeyRotated is sent when an api key of the organization is created or removed
+	EventAPIKeyRotated = "apikey_rotated"
+)
+
+// Events lists all events a webhook can subscribe to
+var Events = []string{EventMemberAdded, EventMemberRemoved, EventRoleChanged, EventInvitationAccepted,
+	EventGrantChanged, EventAuthorizationRevoked, EventAPIKeyRotated}
+
+// Status of a delivery
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Webhook is an endpoint of an organization that receives the events it subscribed to
+type Webhook struct {
+	ID       bson.ObjectId `json:"id" bson:"_id,omitempty"`
+	Globalid string        `json:"globalid"`
+	URL      string        `json:"url"`
+	Events   []string      `json:"events"`
+	// Secret signs the deliveries, it is only returned when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdat"`
+}
+
+// nonPublicNetworks are the addresses a webhook can not be delivered to: loopback, private, link-local
+// (including the cloud metadata services on 169.254.169.254), carrier-grade NAT, multicast and reserved ranges
+var nonPublicNetworks = parseNetworks(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "64:ff9b::/96", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// IsPublicIP checks that an address is reachable on the internet, so a webhook can not be used to reach
+// the services on the network of the server. An ipv4 address mapped to ipv6 is checked as ipv4.
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks that the url is an absolute https url that does not point to a local or private address,
+// and that the webhook subscribes to known events.
+// A host name is checked again when a delivery connects to it, since it can resolve to another address by then.
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil || len(w.URL) > 1000 {
+		return errors.New("invalid_url")
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("invalid_url")
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublicIP(ip) {
+		return errors.New("invalid_url")
+	}
+	if len(w.Events) == 0 {
+		return errors.New("invalid_events")
+	}
+	for _, event := range w.Events {
+		if !isEvent(event) {
+			return errors.New("invalid_events")
+		}
+	}
+	return nil
+}
+
+// Subscribes checks if the webhook wants to receive an event
+func (w *Webhook) Subscribes(event string) bool {
+	for _, subscribed := range w.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+func isEvent(event string) bool {
+	for _, known := range Events {
+		if known == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is an event in the outbox of a webhook, it is sent until it is delivered or the attempts run out
+type Delivery struct {
+	ID        bson.ObjectId `json:"id" bson:"_id,omitempty"`
+	WebhookID bson.ObjectId `json:"webhookid"`
+	Globalid  string        `json:"-"`
+	Event     string        `json:"event"`
+	// Payload is the body that is posted to the webhook
+	Payload  string `json:"payload"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// NextAttempt is the moment the delivery is sent again if it is pending
+	NextAttempt time.Time `json:"nextattempt"`
+	// ResponseStatus and LastError describe the result of the last attempt
+	ResponseStatus int       `json:"responsestatus,omitempty"`
+	LastError      string    `json:"lasterror,omitempty"`
+	CreatedAt      time.Time `json:"createdat"`
+	// ExpiresAt is the moment the delivery is removed from the log
+	ExpiresAt time.Time `json:"-"`
+}
@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var postgresWebhooks = &db.PostgresCollection{
+	Table: "webhooks",
+	Columns: func(document interface{}) map[string]interface{} {
+		return map[string]interface{}{"globalid": document.(*Webhook).Globalid}
+	},
+}
+
+var postgresDeliveries = &db.PostgresCollection{
+	Table: "webhookdeliveries",
+	Columns: func(document interface{}) map[string]interface{} {
+		delivery := document.(*Delivery)
+		return map[string]interface{}{
+			"webhook_id":   delivery.WebhookID.Hex(),
+			"globalid":     delivery.Globalid,
+			"status":       delivery.Status,
+			"next_attempt": delivery.NextAttempt,
+			"expires_at":   delivery.ExpiresAt,
+		}
+	},
+}
+
+// postgresManager stores the webhooks and deliveries in a postgres database,
+// the expired deliveries are removed by the backend
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) Create(webhook *Webhook) error {
+	if webhook.ID == "" {
+		webhook.ID = bson.NewObjectId()
+	}
+	return postgresWebhooks.Insert(m.db, webhook)
+}
+
+func (m *postgresManager) Update(webhook *Webhook) error {
+	updated, err := postgresWebhooks.Update(m.db, "id = $1 AND globalid = $2", []interface{}{webhook.ID.Hex(), webhook.Globalid},
+		func() interface{} { return &Webhook{} },
+		func(document interface{}) error {
+			stored := document.(*Webhook)
+			stored.URL = webhook.URL
+			stored.Events = webhook.Events
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) Get(globalID string, id string) (*Webhook, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, mgo.ErrNotFound
+	}
+	webhook := &Webhook{}
+	err := postgresWebhooks.FindOne(m.db, webhook, "id = $1 AND globalid = $2", bson.ObjectIdHex(id).Hex(), globalID)
+	return webhook, err
+}
+
+func (m *postgresManager) ListByOrganization(globalID string) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := postgresWebhooks.Find(m.db, &webhooks, "globalid = $1", globalID)
+	return webhooks, err
+}
+
+func (m *postgresManager) Delete(globalID string, id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return mgo.ErrNotFound
+	}
+	removed, err := postgresWebhooks.Remove(m.db, "id = $1 AND globalid = $2", bson.ObjectIdHex(id).Hex(), globalID)
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return mgo.ErrNotFound
+	}
+	_, err = postgresDeliveries.Remove(m.db, "webhook_id = $1", bson.ObjectIdHex(id).Hex())
+	return err
+}
+
+func (m *postgresManager) RemoveByOrganization(globalID string) error {
+	if _, err := postgresWebhooks.Remove(m.db, "globalid = $1", globalID); err != nil {
+		return err
+	}
+	_, err := postgresDeliveries.Remove(m.db, "globalid = $1", globalID)
+	return err
+}
+
+func (m *postgresManager) SaveDelivery(delivery *Delivery) error {
+	if delivery.ID == "" {
+		delivery.ID = bson.NewObjectId()
+	}
+	return postgresDeliveries.Insert(m.db, delivery)
+}
+
+func (m *postgresManager) UpdateDelivery(delivery *Delivery) error {
+	updated, err := postgresDeliveries.Update(m.db, "id = $1", []interface{}{delivery.ID.Hex()},
+		func() interface{} { return &Delivery{} },
+		func(document interface{}) error {
+			*document.(*Delivery) = *delivery
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (m *postgresManager) ClaimDeliveries(until time.Time, limit int) ([]Delivery, error) {
+	claimed := []Delivery{}
+	// The rows are locked while they are postponed, an instance claiming at the same time skips them
+	// because they no longer match once it can lock them
+	_, err := postgresDeliveries.Update(m.db, "status = $1 AND next_attempt <= $2 ORDER BY next_attempt LIMIT $3",
+		[]interface{}{StatusPending, time.Now(), limit},
+		func() interface{} { return &Delivery{} },
+		func(document interface{}) error {
+			delivery := document.(*Delivery)
+			delivery.NextAttempt = until
+			claimed = append(claimed, *delivery)
+			return nil
+		})
+	if err != nil {
+		return []Delivery{}, err
+	}
+	return claimed, nil
+}
+
+func (m *postgresManager) ListDeliveries(globalID string, webhookID string, limit int) ([]Delivery, error) {
+	deliveries := []Delivery{}
+	if !bson.IsObjectIdHex(webhookID) {
+		return deliveries, nil
+	}
+	err := postgresDeliveries.Find(m.db, &deliveries, "webhook_id = $1 AND globalid = $2 ORDER BY seq DESC LIMIT $3",
+		bson.ObjectIdHex(webhookID).Hex(), globalID, limit)
+	return deliveries, err
+}
@@ -16,20 +16,17 @@ type GlobalConfig struct {
 	Value string `json:"value"`
 }
 
-// InitModels initialize models in mongo, if required
-func InitModels() {
-	// TODO: Use model tags to ensure indices/constraints
-	index := mgo.Index{
-		Key:      []string{"key"},
-		Unique:   true,
-		DropDups: true,
-	}
-
-	db.EnsureIndex(mongoCollectionName, index)
+// Manager is used to store settings
+type Manager interface {
+	GetByKey(key string) (*GlobalConfig, error)
+	Exists(key string) (bool, error)
+	Insert(c *GlobalConfig) error
+	Set(c *GlobalConfig) error
+	Delete(key string) error
 }
 
-// Manager is used to store settings
-type Manager struct {
+// mongoManager stores the settings in mongo
+type mongoManager struct {
 	session    *mgo.Session
 	collection *mgo.Collection
 }
@@ -38,17 +35,23 @@ func getConfigCollection(session *mgo.Session) *mgo.Collection {
 	return db.GetCollection(session, mongoCollectionName)
 }
 
-// NewManager creates and initializes a new Manager
-func NewManager() *Manager {
+// NewManager creates and initializes a new Manager for the default backend
+func NewManager() Manager {
+	if memory, ok := db.DefaultBackend().(*db.MemoryBackend); ok {
+		return newMemoryManager(memory)
+	}
+	if pg, ok := db.DefaultBackend().(*db.PostgresBackend); ok {
+		return newPostgresManager(pg.DB)
+	}
 	session := db.GetSession()
-	return &Manager{
+	return &mongoManager{
 		session:    session,
 		collection: getConfigCollection(session),
 	}
 }
 
 // GetByKey return a config key/value from key name
-func (m *Manager) GetByKey(key string) (*GlobalConfig, error) {
+func (m *mongoManager) GetByKey(key string) (*GlobalConfig, error) {
 	var config GlobalConfig
 
 	err := m.collection.Find(bson.M{"key": key}).One(&config)
@@ -56,21 +59,28 @@ func (m *Manager) GetByKey(key string) (*GlobalConfig, error) {
 	return &config, err
 }
 
-func (m *Manager) Exists(key string) (bool, error) {
+func (m *mongoManager) Exists(key string) (bool, error) {
 	count, err := m.collection.Find(bson.M{"key": key}).Count()
 
 	return count >= 1, err
 }
 
 // Insert a config key
-func (m *Manager) Insert(c *GlobalConfig) error {
+func (m *mongoManager) Insert(c *GlobalConfig) error {
 	err := m.collection.Insert(c)
 
 	return err
 }
 
+// Set inserts a config key or replaces its value
+func (m *mongoManager) Set(c *GlobalConfig) error {
+	_, err := m.collection.Upsert(bson.M{"key": c.Key}, c)
+
+	return err
+}
+
 // Delete a config key
-func (m *Manager) Delete(key string) error {
+func (m *mongoManager) Delete(key string) error {
 	config, err := m.GetByKey(key)
 
 	if err != nil {
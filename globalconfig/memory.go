@@ -0,0 +1,71 @@
+package globalconfig
+
+import (
+	"sync"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	configs map[string]string
+}
+
+// memoryManager keeps the settings in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(mongoCollectionName, func() interface{} {
+		return &memoryStore{configs: make(map[string]string)}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) GetByKey(key string) (*GlobalConfig, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	value, ok := m.store.configs[key]
+	if !ok {
+		return &GlobalConfig{}, mgo.ErrNotFound
+	}
+	return &GlobalConfig{Key: key, Value: value}, nil
+}
+
+func (m *memoryManager) Exists(key string) (bool, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	_, ok := m.store.configs[key]
+	return ok, nil
+}
+
+// Insert adds a config key, db.ErrDuplicate is returned if it exists like the unique index does in mongo
+func (m *memoryManager) Insert(c *GlobalConfig) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, ok := m.store.configs[c.Key]; ok {
+		return db.ErrDuplicate
+	}
+	m.store.configs[c.Key] = c.Value
+	return nil
+}
+
+func (m *memoryManager) Set(c *GlobalConfig) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.configs[c.Key] = c.Value
+	return nil
+}
+
+func (m *memoryManager) Delete(key string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, ok := m.store.configs[key]; !ok {
+		return mgo.ErrNotFound
+	}
+	delete(m.store.configs, key)
+	return nil
+}
@@ -0,0 +1,57 @@
+package globalconfig
+
+import (
+	"database/sql"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+var postgresConfigs = &db.PostgresCollection{
+	Table: mongoCollectionName,
+	Columns: func(document interface{}) map[string]interface{} {
+		return map[string]interface{}{"key": document.(*GlobalConfig).Key}
+	},
+}
+
+// postgresManager stores the settings in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) GetByKey(key string) (*GlobalConfig, error) {
+	var config GlobalConfig
+	err := postgresConfigs.FindOne(m.db, &config, "key = $1", key)
+	return &config, err
+}
+
+func (m *postgresManager) Exists(key string) (bool, error) {
+	count, err := postgresConfigs.Count(m.db, "key = $1", key)
+	return count >= 1, err
+}
+
+func (m *postgresManager) Insert(c *GlobalConfig) error {
+	return postgresConfigs.Insert(m.db, c)
+}
+
+func (m *postgresManager) Set(c *GlobalConfig) error {
+	return postgresConfigs.Upsert(m.db, "key = $1", []interface{}{c.Key},
+		func() interface{} { return &GlobalConfig{} },
+		func(document interface{}) error {
+			*document.(*GlobalConfig) = *c
+			return nil
+		})
+}
+
+func (m *postgresManager) Delete(key string) error {
+	removed, err := postgresConfigs.Remove(m.db, "key = $1", key)
+	if err == nil && removed == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
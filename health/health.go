@@ -0,0 +1,155 @@
+// Package health reports if the identity server is alive and ready to handle requests.
+// The packages and main register checks for the dependencies they need,
+// /readyz runs them and reports the result with json details.
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// The statuses of a check and of the server as a whole
+const (
+	// StatusOK means the dependency works
+	StatusOK = "ok"
+	// StatusDegraded means an optional dependency does not work or is not configured, the server still handles requests
+	StatusDegraded = "degraded"
+	// StatusDown means a required dependency does not work, the server can not handle requests
+	StatusDown = "down"
+)
+
+var (
+	// errStarting is reported until the startup is completed
+	errStarting = errors.New("The server is starting")
+	// errShuttingDown is reported while the requests in progress finish, so no new requests are sent
+	errShuttingDown = errors.New("The server is shutting down")
+)
+
+// Check returns an error if a dependency does not work
+type Check func() error
+
+type registeredCheck struct {
+	name     string
+	required bool
+	check    Check
+}
+
+var (
+	mutex        sync.Mutex
+	checks       []registeredCheck
+	started      bool
+	shuttingDown bool
+)
+
+// Register adds a check that is run by /readyz.
+// If a required check fails the server is down, if an optional one fails it is degraded.
+func Register(name string, required bool, check Check) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	checks = append(checks, registeredCheck{name: name, required: required, check: check})
+}
+
+// Started marks the end of the startup, the server is not ready before the database is migrated and the services are created
+func Started() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	started = true
+}
+
+// ShuttingDown makes the server not ready while it stops
+func ShuttingDown() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	shuttingDown = true
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the outcome of all checks
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Run executes all checks, the checks of dependencies are skipped during the startup
+func Run() Report {
+	mutex.Lock()
+	registered := append([]registeredCheck{}, checks...)
+	isStarted, isShuttingDown := started, shuttingDown
+	mutex.Unlock()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult)}
+	if !isStarted {
+		report.Status = StatusDown
+		report.Checks["startup"] = CheckResult{Status: StatusDown, Error: errStarting.Error()}
+		return report
+	}
+	if isShuttingDown {
+		report.Status = StatusDown
+		report.Checks["shutdown"] = CheckResult{Status: StatusDown, Error: errShuttingDown.Error()}
+		return report
+	}
+	sort.Slice(registered, func(i, j int) bool { return registered[i].name < registered[j].name })
+	for _, c := range registered {
+		err := c.check()
+		if err == nil {
+			report.Checks[c.name] = CheckResult{Status: StatusOK}
+			continue
+		}
+		status := StatusDegraded
+		if c.required {
+			status = StatusDown
+		}
+		report.Checks[c.name] = CheckResult{Status: status, Error: err.Error()}
+		if status == StatusDown || report.Status == StatusOK {
+			report.Status = status
+		}
+	}
+	return report
+}
+
+// LivenessHandler answers /healthz, it succeeds as long as the process can handle http requests
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+}
+
+// ReadinessHandler answers /readyz, it fails with 503 Service Unavailable while the server is starting
+// or when a required dependency is down. A degraded server is ready.
+func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := Run()
+	status := http.StatusOK
+	if report.Status == StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// Middleware answers /healthz and /readyz and passes the other requests to next.
+// The probes are answered before the other middleware, so they do not need a database session or a web session.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			LivenessHandler(w, r)
+		case "/readyz":
+			ReadinessHandler(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	// Probes must never see a cached answer
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reset forgets the registered checks and the startup
+func reset() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	checks = nil
+	started = false
+	shuttingDown = false
+}
+
+func probe(t *testing.T, path string) (int, Report) {
+	w := httptest.NewRecorder()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	Middleware(next).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	var report Report
+	if w.Code != http.StatusTeapot {
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	}
+	return w.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	reset()
+	defer reset()
+	var databaseErr error
+	Register("database", true, func() error { return databaseErr })
+	Register("sms", false, func() error { return errors.New("not configured") })
+
+	code, report := probe(t, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "not ready during the startup")
+	assert.Equal(t, StatusDown, report.Checks["startup"].Status)
+
+	Started()
+	code, report = probe(t, "/readyz")
+	assert.Equal(t, http.StatusOK, code, "a degraded server is ready")
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, CheckResult{Status: StatusOK}, report.Checks["database"])
+	assert.Equal(t, CheckResult{Status: StatusDegraded, Error: "not configured"}, report.Checks["sms"])
+
+	databaseErr = errors.New("no reachable servers")
+	code, report = probe(t, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, CheckResult{Status: StatusDown, Error: "no reachable servers"}, report.Checks["database"])
+
+	ShuttingDown()
+	code, report = probe(t, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "not ready while the requests in progress finish")
+	assert.Equal(t, StatusDown, report.Checks["shutdown"].Status)
+}
+
+func TestLiveness(t *testing.T) {
+	reset()
+	defer reset()
+	Register("database", true, func() error { return errors.New("down") })
+
+	code, report := probe(t, "/healthz")
+	assert.Equal(t, http.StatusOK, code, "the process is alive even if it is not ready")
+	assert.Equal(t, StatusOK, report.Status)
+
+	code, _ = probe(t, "/login")
+	assert.Equal(t, http.StatusTeapot, code, "other requests are passed on")
+}
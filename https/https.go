@@ -1,15 +1,63 @@
 package https
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"os"
+	"strings"
 
 	"crypto/tls"
-	"io/ioutil"
 	"net/http"
 
 	log "github.com/Sirupsen/logrus"
 )
 
+// TLSOptions holds the certificate and the protocol settings of the https listener
+type TLSOptions struct {
+	// Cert and Key are the paths of the certificate and private key, the development certificate is used if they are empty
+	Cert          string
+	Key           string
+	IgnoreDevcert bool
+	// MinVersion is the lowest TLS version that is accepted, like tls.VersionTLS12
+	MinVersion uint16
+	// CipherSuites limits the cipher suites of TLS 1.0 - 1.2, the defaults of Go are used if it is empty
+	CipherSuites []uint16
+}
+
+// tlsVersions are the TLS versions that can be configured as minimum
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion converts a version like 1.2 to its tls constant
+func ParseTLSVersion(version string) (uint16, error) {
+	if v, found := tlsVersions[version]; found {
+		return v, nil
+	}
+	return 0, fmt.Errorf("Unknown TLS version %q, use 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+// ParseCipherSuites converts cipher suite names like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 to their ids
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	var ids []uint16
+	for _, name := range names {
+		id, found := known[name]
+		if !found {
+			return nil, fmt.Errorf("Unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 func PrepareHTTP(bindAddress string, handler http.Handler) *http.Server {
 	s := &http.Server{
 		Addr:    bindAddress,
@@ -19,20 +67,21 @@ func PrepareHTTP(bindAddress string, handler http.Handler) *http.Server {
 	return s
 }
 
-func PrepareHTTPS(s *http.Server, cert string, key string, skipDev bool) error {
-	// Checking for TLS default keys
-	var certBytes, keyBytes []byte
+// PrepareHTTPS sets the TLS configuration of a server, the returned reloader serves the certificate
+// and can reload it when it is renewed
+func PrepareHTTPS(s *http.Server, options TLSOptions) (*CertificateReloader, error) {
+	cert, key := options.Cert, options.Key
 
 	devCert := "devcert/cert.pem"
 	devKey := "devcert/key.pem"
 
 	// If only a single argument is set
 	if (cert == "" || key == "") && (cert != "" || key != "") {
-		log.Panic("You cannot specify only key or certificate")
+		return nil, errors.New("You cannot specify only key or certificate")
 	}
 
 	// Using default certificate
-	if cert == "" && !skipDev {
+	if cert == "" && !options.IgnoreDevcert {
 		if _, err := os.Stat(devCert); err == nil {
 			if _, err := os.Stat(devKey); err == nil {
 				log.Warning("===============================================================================")
@@ -51,27 +100,57 @@ func PrepareHTTPS(s *http.Server, cert string, key string, skipDev bool) error {
 		}
 	}
 
-	if _, err := os.Stat(cert); err != nil {
-		if _, err := os.Stat(key); err != nil {
-			certBytes, keyBytes = GenerateDefaultTLS(cert, key)
+	var reloader *CertificateReloader
+	if cert == "" {
+		certBytes, keyBytes := GenerateDefaultTLS(cert, key)
+		certifs, err := tls.X509KeyPair(certBytes, keyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot parse the generated certificate: %s", err)
 		}
-
+		reloader = newStaticCertificate(certifs)
 	} else {
 		log.Info("Loading TLS Certificate: ", cert)
 		log.Info("Loading TLS Private key: ", key)
 
-		certBytes, err = ioutil.ReadFile(cert)
-		keyBytes, err = ioutil.ReadFile(key)
-	}
-
-	certifs, err := tls.X509KeyPair(certBytes, keyBytes)
-	if err != nil {
-		log.Panic("Cannot parse certificates")
+		var err error
+		if reloader, err = NewCertificateReloader(cert, key); err != nil {
+			return nil, fmt.Errorf("Cannot load the TLS certificate: %s", err)
+		}
 	}
 
 	s.TLSConfig = &tls.Config{
-		Certificates: []tls.Certificate{certifs},
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     options.MinVersion,
+		CipherSuites:   options.CipherSuites,
 	}
 
-	return nil
+	return reloader, nil
+}
+
+// RedirectHandler redirects plain http requests to the https listener on httpsAddress
+func RedirectHandler(httpsAddress string) http.Handler {
+	_, port, err := net.SplitHostPort(httpsAddress)
+	if err != nil || port == "443" {
+		port = ""
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			// An ipv6 address without a port
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		if port != "" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		status := http.StatusMovedPermanently
+		if r.Method != "GET" && r.Method != "HEAD" {
+			// Keeps the method and body
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
 }
@@ -0,0 +1,87 @@
+package https
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectHandler(t *testing.T) {
+	cases := []struct {
+		httpsAddress string
+		method       string
+		url          string
+		status       int
+		location     string
+	}{
+		{":443", "GET", "http://example.com/login?x=1", http.StatusMovedPermanently, "https://example.com/login?x=1"},
+		{":8443", "GET", "http://example.com:8080/", http.StatusMovedPermanently, "https://example.com:8443/"},
+		{":443", "POST", "http://example.com/v1/oauth/access_token", http.StatusPermanentRedirect, "https://example.com/v1/oauth/access_token"},
+		{":443", "GET", "http://[::1]/", http.StatusMovedPermanently, "https://[::1]/"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		RedirectHandler(c.httpsAddress).ServeHTTP(w, httptest.NewRequest(c.method, c.url, nil))
+		assert.Equal(t, c.status, w.Code, c.url)
+		assert.Equal(t, c.location, w.Header().Get("Location"), c.url)
+	}
+}
+
+func TestParse(t *testing.T) {
+	version, err := ParseTLSVersion("1.2")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), version)
+	_, err = ParseTLSVersion("1.4")
+	assert.Error(t, err)
+
+	suites, err := ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, suites)
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.Error(t, err, "insecure cipher suites are refused")
+}
+
+func writeCertificate(t *testing.T, certFile, keyFile string, modTime time.Time) {
+	cert, key := GenerateDefaultTLS(certFile, keyFile)
+	for file, data := range map[string][]byte{certFile: cert, keyFile: key} {
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		// The modification time has a coarse resolution on some file systems
+		os.Chtimes(file, modTime, modTime)
+	}
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "https")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, time.Now().Add(-time.Hour))
+
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	assert.NoError(t, err)
+	first, _ := reloader.GetCertificate(nil)
+	assert.False(t, reloader.changed())
+
+	writeCertificate(t, certFile, keyFile, time.Now())
+	assert.True(t, reloader.changed())
+	assert.NoError(t, reloader.Reload())
+	second, _ := reloader.GetCertificate(nil)
+	assert.NotEqual(t, first.Certificate, second.Certificate)
+
+	// An invalid certificate is not used
+	assert.NoError(t, ioutil.WriteFile(certFile, []byte("garbage"), 0600))
+	assert.Error(t, reloader.Reload())
+	current, _ := reloader.GetCertificate(nil)
+	assert.Equal(t, second, current)
+}
@@ -0,0 +1,110 @@
+package https
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// CertificateReloader serves the certificate of a server and reloads it when the files change,
+// so a renewed certificate is used without a restart
+type CertificateReloader struct {
+	certFile    string
+	keyFile     string
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// NewCertificateReloader loads the certificate and key from the files
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// newStaticCertificate serves a certificate that is not read from files, like a generated one
+func newStaticCertificate(certificate tls.Certificate) *CertificateReloader {
+	return &CertificateReloader{certificate: &certificate}
+}
+
+// Reload reads the certificate and key again, the current certificate is kept if they are not valid
+func (c *CertificateReloader) Reload() error {
+	if c.certFile == "" {
+		return nil
+	}
+	certModTime, keyModTime, err := c.modTimes()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.certificate = &certificate
+	c.certModTime, c.keyModTime = certModTime, keyModTime
+	return nil
+}
+
+func (c *CertificateReloader) modTimes() (certModTime, keyModTime time.Time, err error) {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// changed reports if the files were modified since they were loaded
+func (c *CertificateReloader) changed() bool {
+	certModTime, keyModTime, err := c.modTimes()
+	if err != nil {
+		// The files are probably being replaced, try again the next time
+		return false
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return !certModTime.Equal(c.certModTime) || !keyModTime.Equal(c.keyModTime)
+}
+
+// GetCertificate returns the current certificate, it is used as tls.Config.GetCertificate
+func (c *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.certificate, nil
+}
+
+// Watch checks every interval if the files changed and reloads them, until stop is closed
+func (c *CertificateReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	if c.certFile == "" || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !c.changed() {
+				continue
+			}
+			if err := c.Reload(); err != nil {
+				log.Error("Failed to reload the TLS certificate, the previous one is still used: ", err)
+				continue
+			}
+			log.Info("Reloaded the TLS certificate ", c.certFile)
+		}
+	}
+}
@@ -47,8 +47,7 @@ func (om *Oauth2oauth_2_0Middleware) Handler(next http.Handler) http.Handler {
 		var username string
 		accessToken := om.GetAccessToken(r)
 		if accessToken != "" {
-			//TODO: cache
-			oauthMgr := oauthservice.NewManager(r)
+			oauthMgr := oauthservice.NewCachedManager(r)
 			at, err := oauthMgr.GetAccessToken(accessToken)
 			if err != nil {
 				log.Error(err)
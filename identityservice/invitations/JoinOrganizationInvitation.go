@@ -86,7 +86,7 @@ type JoinOrganizationInvitationView struct {
 }
 
 // ConvertToView converts a JoinOrganizationInvitation to a JoinOrganizationInvitationView
-func (inv *JoinOrganizationInvitation) ConvertToView(usrMgr *user.Manager, valMgr *validation.Manager) (*JoinOrganizationInvitationView, error) {
+func (inv *JoinOrganizationInvitation) ConvertToView(usrMgr user.Manager, valMgr validation.Manager) (*JoinOrganizationInvitationView, error) {
 	vw := &JoinOrganizationInvitationView{}
 	vw.Organization = inv.Organization
 	vw.Role = inv.Role
@@ -2,6 +2,7 @@ package invitations
 
 import (
 	"net/http"
+	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -14,7 +15,35 @@ const (
 )
 
 //InvitationManager is used to store invitations
-type InvitationManager struct {
+type InvitationManager interface {
+	GetByUser(username string) ([]JoinOrganizationInvitation, error)
+	GetByEmail(email string) ([]JoinOrganizationInvitation, error)
+	GetByPhonenumber(phonenumber string) ([]JoinOrganizationInvitation, error)
+	FilterByUser(username string, status string) ([]JoinOrganizationInvitation, error)
+	FilterByEmail(email string, status string) ([]JoinOrganizationInvitation, error)
+	FilterByPhonenumber(phonenumber string, status string) ([]JoinOrganizationInvitation, error)
+	GetByOrganization(globalid string) ([]JoinOrganizationInvitation, error)
+	FilterByOrganization(globalID string, status string) ([]JoinOrganizationInvitation, error)
+	Get(username string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error)
+	GetWithEmail(email string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error)
+	GetWithPhonenumber(phonenumber string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error)
+	Save(invite *JoinOrganizationInvitation) error
+	RemoveAll(globalid string) error
+	HasInvite(globalid string, username string) (hasInvite bool, err error)
+	HasPhoneInvite(globalid string, phonenumber string) (hasInvite bool, err error)
+	HasEmailInvite(globalid string, email string) (hasInvite bool, err error)
+	CountByOrganization(globalid string) (int, error)
+	GetByCode(code string) (invite *JoinOrganizationInvitation, err error)
+	SetAcceptedByCode(code string) error
+	Remove(globalID string, username string, searchString string) error
+	RemoveByUser(username string) error
+	GetOpenOrganizationInvites(globalID string) ([]JoinOrganizationInvitation, error)
+	// RemovePendingBefore removes the pending invitations created before a moment
+	RemovePendingBefore(before time.Time) (removed int, err error)
+}
+
+//mongoInvitationManager stores the invitations in mongo
+type mongoInvitationManager struct {
 	session    *mgo.Session
 	collection *mgo.Collection
 }
@@ -24,37 +53,43 @@ func getOrganizationRequestCollection(session *mgo.Session) *mgo.Collection {
 }
 
 //NewInvitationManager creates and initializes a new InvitationManager
-func NewInvitationManager(r *http.Request) *InvitationManager {
+func NewInvitationManager(r *http.Request) InvitationManager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryInvitationManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresInvitationManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &InvitationManager{
+	return &mongoInvitationManager{
 		session:    session,
 		collection: getOrganizationRequestCollection(session),
 	}
 }
 
 // GetByUser gets all invitations for a user.
-func (o *InvitationManager) GetByUser(username string) ([]JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) GetByUser(username string) ([]JoinOrganizationInvitation, error) {
 	orgRequests := []JoinOrganizationInvitation{}
 	err := o.collection.Find(bson.M{"user": username}).All(&orgRequests)
 	return orgRequests, err
 }
 
 // GetByEmail gets all invitations for an email address.
-func (o *InvitationManager) GetByEmail(email string) ([]JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) GetByEmail(email string) ([]JoinOrganizationInvitation, error) {
 	orgRequests := []JoinOrganizationInvitation{}
 	err := o.collection.Find(bson.M{"emailaddress": email}).All(&orgRequests)
 	return orgRequests, err
 }
 
 // GetByPhonenumber gets all invitations for a phone number.
-func (o *InvitationManager) GetByPhonenumber(phonenumber string) ([]JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) GetByPhonenumber(phonenumber string) ([]JoinOrganizationInvitation, error) {
 	orgRequests := []JoinOrganizationInvitation{}
 	err := o.collection.Find(bson.M{"phonenumber": phonenumber}).All(&orgRequests)
 	return orgRequests, err
 }
 
 // FilterByUser gets all invitations for a user, filtered on status
-func (o *InvitationManager) FilterByUser(username string, status string) ([]JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) FilterByUser(username string, status string) ([]JoinOrganizationInvitation, error) {
 	orgRequests := []JoinOrganizationInvitation{}
 	if status == "" {
 		return o.GetByUser(username)
@@ -68,7 +103,7 @@ func (o *InvitationManager) FilterByUser(username string, status string) ([]Join
 }
 
 // FilterByEmail gets all invitations for an email address, filtered on status
-func (o *InvitationManager) FilterByEmail(email string, status string) ([]JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) FilterByEmail(email string, status string) ([]JoinOrganizationInvitation, error) {
 	orgRequests := []JoinOrganizationInvitation{}
 	if status == "" {
 		return o.GetByEmail(email)
@@ -82,7 +117,7 @@ func (o *InvitationManager) FilterByEmail(email string, status string) ([]JoinOr
 }
 
 // FilterByPhonenumber gets all invitations for a phone number, filtered on status
-func (o *InvitationManager) FilterByPhonenumber(phonenumber string, status string) ([]JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) FilterByPhonenumber(phonenumber string, status string) ([]JoinOrganizationInvitation, error) {
 	orgRequests := []JoinOrganizationInvitation{}
 	if status == "" {
 		return o.GetByPhonenumber(phonenumber)
@@ -96,14 +131,14 @@ func (o *InvitationManager) FilterByPhonenumber(phonenumber string, status strin
 }
 
 // GetByOrganization gets all invitations for an organization
-func (o *InvitationManager) GetByOrganization(globalid string) ([]JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) GetByOrganization(globalid string) ([]JoinOrganizationInvitation, error) {
 	orgRequests := []JoinOrganizationInvitation{}
 	err := o.collection.Find(bson.M{"organization": globalid}).All(&orgRequests)
 	return orgRequests, err
 }
 
 // FilterByOrganization gets all invitations for a user, filtered on status
-func (o *InvitationManager) FilterByOrganization(globalID string, status string) ([]JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) FilterByOrganization(globalID string, status string) ([]JoinOrganizationInvitation, error) {
 	orgRequests := []JoinOrganizationInvitation{}
 	if status == "" {
 		return o.GetByOrganization(globalID)
@@ -117,7 +152,7 @@ func (o *InvitationManager) FilterByOrganization(globalID string, status string)
 }
 
 //Get get an invitation by it's content, not really this usefull, TODO: just make an exists method
-func (o *InvitationManager) Get(username string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) Get(username string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
 	var orgRequest JoinOrganizationInvitation
 
 	query := bson.M{
@@ -136,7 +171,7 @@ func (o *InvitationManager) Get(username string, organization string, role strin
 }
 
 //GetWithEmail get an invitation by it's content, not really this usefull, TODO: just make an exists method
-func (o *InvitationManager) GetWithEmail(email string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) GetWithEmail(email string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
 	var orgRequest JoinOrganizationInvitation
 
 	query := bson.M{
@@ -155,7 +190,7 @@ func (o *InvitationManager) GetWithEmail(email string, organization string, role
 }
 
 //GetWithPhonenumber get an invitation by it's content, not really this usefull, TODO: just make an exists method
-func (o *InvitationManager) GetWithPhonenumber(phonenumber string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) GetWithPhonenumber(phonenumber string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
 	var orgRequest JoinOrganizationInvitation
 
 	query := bson.M{
@@ -174,7 +209,7 @@ func (o *InvitationManager) GetWithPhonenumber(phonenumber string, organization
 }
 
 // Save saves/updates an invitation
-func (o *InvitationManager) Save(invite *JoinOrganizationInvitation) error {
+func (o *mongoInvitationManager) Save(invite *JoinOrganizationInvitation) error {
 
 	_, err := o.collection.Upsert(
 		bson.M{
@@ -189,37 +224,46 @@ func (o *InvitationManager) Save(invite *JoinOrganizationInvitation) error {
 }
 
 // RemoveAll Removes all invitations linked to an organization
-func (o *InvitationManager) RemoveAll(globalid string) error {
+func (o *mongoInvitationManager) RemoveAll(globalid string) error {
 	_, err := o.collection.RemoveAll(bson.M{"organization": globalid})
 	return err
 }
 
+// RemovePendingBefore removes the pending invitations created before a moment
+func (o *mongoInvitationManager) RemovePendingBefore(before time.Time) (int, error) {
+	info, err := o.collection.RemoveAll(bson.M{"status": RequestPending, "created": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Removed, nil
+}
+
 // HasInvite Checks if a user has an invite for an organization
-func (o *InvitationManager) HasInvite(globalid string, username string) (hasInvite bool, err error) {
+func (o *mongoInvitationManager) HasInvite(globalid string, username string) (hasInvite bool, err error) {
 	count, err := o.collection.Find(bson.M{"organization": globalid, "user": username}).Count()
 	return count != 0, err
 }
 
 // HasPhoneInvite Checks if a phonenumber has an invite to an organization
-func (o *InvitationManager) HasPhoneInvite(globalid string, phonenumber string) (hasInvite bool, err error) {
+func (o *mongoInvitationManager) HasPhoneInvite(globalid string, phonenumber string) (hasInvite bool, err error) {
 	count, err := o.collection.Find(bson.M{"organization": globalid, "phonenumber": phonenumber}).Count()
 	return count != 0, err
 }
 
 // HasEmailInvite Checks if an emailaddress has an invite to an organization
-func (o *InvitationManager) HasEmailInvite(globalid string, email string) (hasInvite bool, err error) {
+func (o *mongoInvitationManager) HasEmailInvite(globalid string, email string) (hasInvite bool, err error) {
 	count, err := o.collection.Find(bson.M{"organization": globalid, "emailaddress": email}).Count()
 	return count != 0, err
 }
 
 // CountByOrganization Counts the amount of invitations, filtered by an organization
-func (o *InvitationManager) CountByOrganization(globalid string) (int, error) {
+func (o *mongoInvitationManager) CountByOrganization(globalid string) (int, error) {
 	count, err := o.collection.Find(bson.M{"organization": globalid}).Count()
 	return count, err
 }
 
 // GetByCode Gets an invite by code
-func (o *InvitationManager) GetByCode(code string) (invite *JoinOrganizationInvitation, err error) {
+func (o *mongoInvitationManager) GetByCode(code string) (invite *JoinOrganizationInvitation, err error) {
 	qry := bson.M{
 		"code": code,
 	}
@@ -228,7 +272,7 @@ func (o *InvitationManager) GetByCode(code string) (invite *JoinOrganizationInvi
 }
 
 // SetAcceptedByCode Sets an invite as "accepted"
-func (o *InvitationManager) SetAcceptedByCode(code string) error {
+func (o *mongoInvitationManager) SetAcceptedByCode(code string) error {
 	qry := bson.M{
 		"code": code,
 	}
@@ -241,7 +285,7 @@ func (o *InvitationManager) SetAcceptedByCode(code string) error {
 }
 
 // Remove removes an invitation
-func (o *InvitationManager) Remove(globalID string, username string, searchString string) error {
+func (o *mongoInvitationManager) Remove(globalID string, username string, searchString string) error {
 	qry := bson.M{
 		"organization": globalID,
 		"$or": []bson.M{
@@ -253,8 +297,14 @@ func (o *InvitationManager) Remove(globalID string, username string, searchStrin
 	return o.collection.Remove(qry)
 }
 
+// RemoveByUser removes all invitations of a user
+func (o *mongoInvitationManager) RemoveByUser(username string) error {
+	_, err := o.collection.RemoveAll(bson.M{"user": username})
+	return err
+}
+
 // GetInvites gets all invites where the organization is invited
-func (o *InvitationManager) GetOpenOrganizationInvites(globalID string) ([]JoinOrganizationInvitation, error) {
+func (o *mongoInvitationManager) GetOpenOrganizationInvites(globalID string) ([]JoinOrganizationInvitation, error) {
 	invites := []JoinOrganizationInvitation{}
 	qry := bson.M{
 		"user":   globalID,
@@ -0,0 +1,227 @@
+package invitations
+
+import (
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	invites []JoinOrganizationInvitation
+}
+
+//memoryInvitationManager keeps the invitations in a db.MemoryBackend
+type memoryInvitationManager struct {
+	store *memoryStore
+}
+
+func newMemoryInvitationManager(backend *db.MemoryBackend) *memoryInvitationManager {
+	store := backend.Store(mongoOrganizationRequestCollectionName, func() interface{} {
+		return &memoryStore{}
+	}).(*memoryStore)
+	return &memoryInvitationManager{store: store}
+}
+
+// find returns copies of the invitations that match
+func (o *memoryInvitationManager) find(match func(invite *JoinOrganizationInvitation) bool) []JoinOrganizationInvitation {
+	o.store.Lock()
+	defer o.store.Unlock()
+	invites := []JoinOrganizationInvitation{}
+	for _, invite := range o.store.invites {
+		if match(&invite) {
+			invites = append(invites, invite)
+		}
+	}
+	return invites
+}
+
+// findOne returns the first invitation that matches or nil
+func (o *memoryInvitationManager) findOne(match func(invite *JoinOrganizationInvitation) bool) *JoinOrganizationInvitation {
+	invites := o.find(match)
+	if len(invites) == 0 {
+		return nil
+	}
+	return &invites[0]
+}
+
+// hasStatus matches all invitations when status is empty
+func hasStatus(invite *JoinOrganizationInvitation, status string) bool {
+	return status == "" || string(invite.Status) == status
+}
+
+func (o *memoryInvitationManager) GetByUser(username string) ([]JoinOrganizationInvitation, error) {
+	return o.FilterByUser(username, "")
+}
+
+func (o *memoryInvitationManager) GetByEmail(email string) ([]JoinOrganizationInvitation, error) {
+	return o.FilterByEmail(email, "")
+}
+
+func (o *memoryInvitationManager) GetByPhonenumber(phonenumber string) ([]JoinOrganizationInvitation, error) {
+	return o.FilterByPhonenumber(phonenumber, "")
+}
+
+func (o *memoryInvitationManager) FilterByUser(username string, status string) ([]JoinOrganizationInvitation, error) {
+	return o.find(func(invite *JoinOrganizationInvitation) bool {
+		return invite.User == username && hasStatus(invite, status)
+	}), nil
+}
+
+func (o *memoryInvitationManager) FilterByEmail(email string, status string) ([]JoinOrganizationInvitation, error) {
+	return o.find(func(invite *JoinOrganizationInvitation) bool {
+		return invite.EmailAddress == email && hasStatus(invite, status)
+	}), nil
+}
+
+func (o *memoryInvitationManager) FilterByPhonenumber(phonenumber string, status string) ([]JoinOrganizationInvitation, error) {
+	return o.find(func(invite *JoinOrganizationInvitation) bool {
+		return invite.PhoneNumber == phonenumber && hasStatus(invite, status)
+	}), nil
+}
+
+func (o *memoryInvitationManager) GetByOrganization(globalid string) ([]JoinOrganizationInvitation, error) {
+	return o.FilterByOrganization(globalid, "")
+}
+
+func (o *memoryInvitationManager) FilterByOrganization(globalID string, status string) ([]JoinOrganizationInvitation, error) {
+	return o.find(func(invite *JoinOrganizationInvitation) bool {
+		return invite.Organization == globalID && hasStatus(invite, status)
+	}), nil
+}
+
+func (o *memoryInvitationManager) Get(username string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
+	return o.findOne(func(invite *JoinOrganizationInvitation) bool {
+		return invite.User == username && invite.Organization == organization && invite.Role == role && invite.Status == status
+	}), nil
+}
+
+func (o *memoryInvitationManager) GetWithEmail(email string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
+	return o.findOne(func(invite *JoinOrganizationInvitation) bool {
+		return invite.EmailAddress == email && invite.Organization == organization && invite.Role == role && invite.Status == status
+	}), nil
+}
+
+func (o *memoryInvitationManager) GetWithPhonenumber(phonenumber string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
+	return o.findOne(func(invite *JoinOrganizationInvitation) bool {
+		return invite.PhoneNumber == phonenumber && invite.Organization == organization && invite.Role == role && invite.Status == status
+	}), nil
+}
+
+func (o *memoryInvitationManager) Save(invite *JoinOrganizationInvitation) error {
+	o.store.Lock()
+	defer o.store.Unlock()
+	stored := *invite
+	for i, existing := range o.store.invites {
+		if existing.User == invite.User && existing.Organization == invite.Organization && existing.Role == invite.Role &&
+			existing.EmailAddress == invite.EmailAddress && existing.PhoneNumber == invite.PhoneNumber {
+			stored.ID = existing.ID
+			o.store.invites[i] = stored
+			return nil
+		}
+	}
+	if stored.ID == "" {
+		stored.ID = bson.NewObjectId()
+	}
+	o.store.invites = append(o.store.invites, stored)
+	return nil
+}
+
+// remove removes the invitations that match, only the first one if all is false, and returns how many were removed
+func (o *memoryInvitationManager) remove(all bool, match func(invite *JoinOrganizationInvitation) bool) (removed int) {
+	o.store.Lock()
+	defer o.store.Unlock()
+	remaining := []JoinOrganizationInvitation{}
+	for _, invite := range o.store.invites {
+		if (all || removed == 0) && match(&invite) {
+			removed++
+			continue
+		}
+		remaining = append(remaining, invite)
+	}
+	o.store.invites = remaining
+	return
+}
+
+func (o *memoryInvitationManager) RemoveAll(globalid string) error {
+	o.remove(true, func(invite *JoinOrganizationInvitation) bool { return invite.Organization == globalid })
+	return nil
+}
+
+func (o *memoryInvitationManager) RemovePendingBefore(before time.Time) (int, error) {
+	return o.remove(true, func(invite *JoinOrganizationInvitation) bool {
+		return invite.Status == RequestPending && time.Time(invite.Created).Before(before)
+	}), nil
+}
+
+func (o *memoryInvitationManager) count(match func(invite *JoinOrganizationInvitation) bool) int {
+	return len(o.find(match))
+}
+
+func (o *memoryInvitationManager) HasInvite(globalid string, username string) (hasInvite bool, err error) {
+	return o.count(func(invite *JoinOrganizationInvitation) bool {
+		return invite.Organization == globalid && invite.User == username
+	}) != 0, nil
+}
+
+func (o *memoryInvitationManager) HasPhoneInvite(globalid string, phonenumber string) (hasInvite bool, err error) {
+	return o.count(func(invite *JoinOrganizationInvitation) bool {
+		return invite.Organization == globalid && invite.PhoneNumber == phonenumber
+	}) != 0, nil
+}
+
+func (o *memoryInvitationManager) HasEmailInvite(globalid string, email string) (hasInvite bool, err error) {
+	return o.count(func(invite *JoinOrganizationInvitation) bool {
+		return invite.Organization == globalid && invite.EmailAddress == email
+	}) != 0, nil
+}
+
+func (o *memoryInvitationManager) CountByOrganization(globalid string) (int, error) {
+	return o.count(func(invite *JoinOrganizationInvitation) bool { return invite.Organization == globalid }), nil
+}
+
+func (o *memoryInvitationManager) GetByCode(code string) (invite *JoinOrganizationInvitation, err error) {
+	invite = o.findOne(func(invite *JoinOrganizationInvitation) bool { return invite.Code == code })
+	if invite == nil {
+		err = mgo.ErrNotFound
+	}
+	return
+}
+
+func (o *memoryInvitationManager) SetAcceptedByCode(code string) error {
+	o.store.Lock()
+	defer o.store.Unlock()
+	for i, invite := range o.store.invites {
+		if invite.Code == code {
+			o.store.invites[i].Status = RequestAccepted
+			return nil
+		}
+	}
+	return mgo.ErrNotFound
+}
+
+func (o *memoryInvitationManager) Remove(globalID string, username string, searchString string) error {
+	removed := o.remove(false, func(invite *JoinOrganizationInvitation) bool {
+		return invite.Organization == globalID &&
+			(invite.User == username || invite.EmailAddress == searchString || invite.PhoneNumber == searchString)
+	})
+	if removed == 0 {
+		return mgo.ErrNotFound
+	}
+	return nil
+}
+
+func (o *memoryInvitationManager) RemoveByUser(username string) error {
+	o.remove(true, func(invite *JoinOrganizationInvitation) bool { return invite.User == username })
+	return nil
+}
+
+func (o *memoryInvitationManager) GetOpenOrganizationInvites(globalID string) ([]JoinOrganizationInvitation, error) {
+	return o.find(func(invite *JoinOrganizationInvitation) bool {
+		return invite.User == globalID && invite.Status == RequestPending
+	}), nil
+}
@@ -0,0 +1,214 @@
+package invitations
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/lib/pq"
+	"gopkg.in/mgo.v2"
+)
+
+// The user field is kept in the username column since user is a reserved word in postgres
+var postgresInvitations = &db.PostgresCollection{
+	Table: "joinorganizationinvitations",
+	Columns: func(document interface{}) map[string]interface{} {
+		invite := document.(*JoinOrganizationInvitation)
+		return map[string]interface{}{
+			"organization": invite.Organization,
+			"role":         invite.Role,
+			"username":     invite.User,
+			"status":       string(invite.Status),
+			"emailaddress": invite.EmailAddress,
+			"phonenumber":  invite.PhoneNumber,
+			"code":         invite.Code,
+		}
+	},
+}
+
+//postgresInvitationManager stores the invitations in a postgres database
+type postgresInvitationManager struct {
+	db *sql.DB
+}
+
+func newPostgresInvitationManager(pg *sql.DB) *postgresInvitationManager {
+	return &postgresInvitationManager{db: pg}
+}
+
+func newInvitation() interface{} {
+	return &JoinOrganizationInvitation{}
+}
+
+func (o *postgresInvitationManager) find(where string, args ...interface{}) ([]JoinOrganizationInvitation, error) {
+	orgRequests := []JoinOrganizationInvitation{}
+	err := postgresInvitations.Find(o.db, &orgRequests, where, args...)
+	return orgRequests, err
+}
+
+// filter finds the invitations where column has value and optionally a status
+func (o *postgresInvitationManager) filter(column string, value string, status string) ([]JoinOrganizationInvitation, error) {
+	if status == "" {
+		return o.find(column+" = $1", value)
+	}
+	return o.find(column+" = $1 AND status = $2", value, status)
+}
+
+func (o *postgresInvitationManager) GetByUser(username string) ([]JoinOrganizationInvitation, error) {
+	return o.filter("username", username, "")
+}
+
+func (o *postgresInvitationManager) GetByEmail(email string) ([]JoinOrganizationInvitation, error) {
+	return o.filter("emailaddress", email, "")
+}
+
+func (o *postgresInvitationManager) GetByPhonenumber(phonenumber string) ([]JoinOrganizationInvitation, error) {
+	return o.filter("phonenumber", phonenumber, "")
+}
+
+func (o *postgresInvitationManager) FilterByUser(username string, status string) ([]JoinOrganizationInvitation, error) {
+	return o.filter("username", username, status)
+}
+
+func (o *postgresInvitationManager) FilterByEmail(email string, status string) ([]JoinOrganizationInvitation, error) {
+	return o.filter("emailaddress", email, status)
+}
+
+func (o *postgresInvitationManager) FilterByPhonenumber(phonenumber string, status string) ([]JoinOrganizationInvitation, error) {
+	return o.filter("phonenumber", phonenumber, status)
+}
+
+func (o *postgresInvitationManager) GetByOrganization(globalid string) ([]JoinOrganizationInvitation, error) {
+	return o.filter("organization", globalid, "")
+}
+
+func (o *postgresInvitationManager) FilterByOrganization(globalID string, status string) ([]JoinOrganizationInvitation, error) {
+	return o.filter("organization", globalID, status)
+}
+
+// get returns the first invitation for an invitee where column has value, nil if there is none
+func (o *postgresInvitationManager) get(column string, value string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
+	var orgRequest JoinOrganizationInvitation
+	err := postgresInvitations.FindOne(o.db, &orgRequest, column+" = $1 AND role = $2 AND organization = $3 AND status = $4",
+		value, role, organization, string(status))
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	return &orgRequest, err
+}
+
+func (o *postgresInvitationManager) Get(username string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
+	return o.get("username", username, organization, role, status)
+}
+
+func (o *postgresInvitationManager) GetWithEmail(email string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
+	return o.get("emailaddress", email, organization, role, status)
+}
+
+func (o *postgresInvitationManager) GetWithPhonenumber(phonenumber string, organization string, role string, status InvitationStatus) (*JoinOrganizationInvitation, error) {
+	return o.get("phonenumber", phonenumber, organization, role, status)
+}
+
+func (o *postgresInvitationManager) Save(invite *JoinOrganizationInvitation) error {
+	return postgresInvitations.Upsert(o.db,
+		"username = $1 AND organization = $2 AND role = $3 AND emailaddress = $4 AND phonenumber = $5",
+		[]interface{}{invite.User, invite.Organization, invite.Role, invite.EmailAddress, invite.PhoneNumber},
+		newInvitation,
+		func(document interface{}) error {
+			stored := document.(*JoinOrganizationInvitation)
+			id := stored.ID
+			if err := db.CopyDocument(stored, invite); err != nil {
+				return err
+			}
+			if id != "" {
+				stored.ID = id
+			}
+			return nil
+		})
+}
+
+func (o *postgresInvitationManager) RemoveAll(globalid string) error {
+	_, err := postgresInvitations.Remove(o.db, "organization = $1", globalid)
+	return err
+}
+
+func (o *postgresInvitationManager) count(where string, args ...interface{}) (int, error) {
+	return postgresInvitations.Count(o.db, where, args...)
+}
+
+func (o *postgresInvitationManager) HasInvite(globalid string, username string) (bool, error) {
+	count, err := o.count("organization = $1 AND username = $2", globalid, username)
+	return count != 0, err
+}
+
+func (o *postgresInvitationManager) HasPhoneInvite(globalid string, phonenumber string) (bool, error) {
+	count, err := o.count("organization = $1 AND phonenumber = $2", globalid, phonenumber)
+	return count != 0, err
+}
+
+func (o *postgresInvitationManager) HasEmailInvite(globalid string, email string) (bool, error) {
+	count, err := o.count("organization = $1 AND emailaddress = $2", globalid, email)
+	return count != 0, err
+}
+
+func (o *postgresInvitationManager) CountByOrganization(globalid string) (int, error) {
+	return o.count("organization = $1", globalid)
+}
+
+func (o *postgresInvitationManager) GetByCode(code string) (*JoinOrganizationInvitation, error) {
+	var invite JoinOrganizationInvitation
+	if err := postgresInvitations.FindOne(o.db, &invite, "code = $1", code); err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (o *postgresInvitationManager) SetAcceptedByCode(code string) error {
+	updated, err := postgresInvitations.Update(o.db, "id = (SELECT id FROM joinorganizationinvitations WHERE code = $1 ORDER BY seq LIMIT 1)",
+		[]interface{}{code}, newInvitation,
+		func(document interface{}) error {
+			document.(*JoinOrganizationInvitation).Status = RequestAccepted
+			return nil
+		})
+	if err == nil && updated == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+// Remove removes the first invitation that matches, like mongo does
+func (o *postgresInvitationManager) Remove(globalID string, username string, searchString string) error {
+	removed, err := postgresInvitations.Remove(o.db, `id = (SELECT id FROM joinorganizationinvitations
+		WHERE organization = $1 AND (username = $2 OR emailaddress = $3 OR phonenumber = $3) ORDER BY seq LIMIT 1)`,
+		globalID, username, searchString)
+	if err == nil && removed == 0 {
+		err = mgo.ErrNotFound
+	}
+	return err
+}
+
+func (o *postgresInvitationManager) RemoveByUser(username string) error {
+	_, err := postgresInvitations.Remove(o.db, "username = $1", username)
+	return err
+}
+
+func (o *postgresInvitationManager) GetOpenOrganizationInvites(globalID string) ([]JoinOrganizationInvitation, error) {
+	return o.find("username = $1 AND status = $2", globalID, "pending")
+}
+
+// RemovePendingBefore selects the invitations by their documents, the creation time is not kept in a column
+func (o *postgresInvitationManager) RemovePendingBefore(before time.Time) (int, error) {
+	pending, err := o.find("status = $1", string(RequestPending))
+	if err != nil {
+		return 0, err
+	}
+	ids := []string{}
+	for _, invite := range pending {
+		if time.Time(invite.Created).Before(before) {
+			ids = append(ids, invite.ID.Hex())
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return postgresInvitations.Remove(o.db, "id = ANY($1)", pq.StringArray(ids))
+}
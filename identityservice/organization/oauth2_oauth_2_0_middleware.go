@@ -81,8 +81,7 @@ func (om *Oauth2oauth_2_0Middleware) Handler(next http.Handler) http.Handler {
 			clientID = token.Claims["azp"].(string)
 			atscopestring = oauth2.GetScopestringFromJWT(token)
 		} else if accessToken != "" {
-			//TODO: cache
-			oauthMgr := oauthservice.NewManager(r)
+			oauthMgr := oauthservice.NewCachedManager(r)
 			at, err := oauthMgr.GetAccessToken(accessToken)
 			if err != nil {
 				log.Error("Error while getting access token: ", err)
@@ -116,7 +115,7 @@ func (om *Oauth2oauth_2_0Middleware) Handler(next http.Handler) http.Handler {
 		if len(globalID) > 0 && (globalID == protectedOrganization || strings.HasPrefix(protectedOrganization, globalID+".")) {
 			scopes = []string{atscopestring}
 		} else {
-			orgMgr := organization.NewManager(r)
+			orgMgr := organization.NewCachedManager(r)
 			isOwner, err := orgMgr.IsOwner(protectedOrganization, username)
 			if err != nil {
 				log.Error("Error while checking if user is owner of organization: ", err)
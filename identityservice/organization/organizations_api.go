@@ -2,6 +2,7 @@ package organization
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -20,10 +21,12 @@ import (
 
 	"github.com/gorilla/context"
 	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/audit"
 	contractdb "github.com/itsyouonline/identityserver/db/contract"
 	"github.com/itsyouonline/identityserver/db/organization"
 	"github.com/itsyouonline/identityserver/db/registry"
 	"github.com/itsyouonline/identityserver/db/user"
+	"github.com/itsyouonline/identityserver/db/webhook"
 	validationdb "github.com/itsyouonline/identityserver/db/validation"
 	"github.com/itsyouonline/identityserver/identityservice/contract"
 	"github.com/itsyouonline/identityserver/identityservice/invitations"
@@ -273,29 +276,68 @@ func (api OrganizationsAPI) inviteUser(w http.ResponseWriter, r *http.Request, r
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-	searchString := s.SearchString
 
+	orgReq, err := api.Invite(r, globalID, s.SearchString, role, invitenotification != "none")
+	switch {
+	case db.IsNotFound(err):
+		writeErrorResponse(w, http.StatusNotFound, "organization_not_found")
+		return
+	case err == ErrUserNotFound:
+		writeErrorResponse(w, http.StatusNotFound, "user_not_found")
+		return
+	case err == ErrAlreadyMember:
+		http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		return
+	case err == ErrMaxInvitations:
+		log.Error("Reached invitation limit for organization ", globalID)
+		writeErrorResponse(w, 422, "max_amount_of_invitations_reached")
+		return
+	case handleServerError(w, "inviting user", err):
+		return
+	}
+
+	usrMgr := user.NewManager(r)
+	valMgr := validationdb.NewManager(r)
+	reqView, err := orgReq.ConvertToView(usrMgr, valMgr)
+	if handleServerError(w, "converting invite to inviteview", err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reqView)
+}
+
+// The errors of Invite
+var (
+	// ErrUserNotFound is returned if no user has the username and it is not an email address or phone number
+	ErrUserNotFound = errors.New("user_not_found")
+	// ErrAlreadyMember is returned if the user already has the role in the organization
+	ErrAlreadyMember = errors.New("already_member")
+	// ErrMaxInvitations is returned if the organization has too many invitations
+	ErrMaxInvitations = errors.New("max_amount_of_invitations_reached")
+)
+
+// Invite invites a user to join an organization with a role, the user is searched by username, email address or
+// phone number. Email addresses and phone numbers of unknown users get an invitation code to register.
+// The invitation is accepted right away if the user is already part of a parent organization,
+// otherwise the user is notified if notify is set. mgo.ErrNotFound is returned if the organization does not exist.
+func (api OrganizationsAPI) Invite(r *http.Request, globalID string, searchString string, role string, notify bool) (*invitations.JoinOrganizationInvitation, error) {
 	orgMgr := organization.NewManager(r)
 	isEmailAddress := user.ValidateEmailAddress(searchString)
 	isPhoneNumber := user.ValidatePhoneNumber(searchString)
 	org, err := orgMgr.GetByName(globalID)
 	if err != nil {
-		if err == mgo.ErrNotFound {
-			writeErrorResponse(w, http.StatusNotFound, "organization_not_found")
-		} else {
-			handleServerError(w, "getting organization", err)
-		}
-		return
+		return nil, err
 	}
 
 	u, err := SearchUser(r, searchString)
 	if err == mgo.ErrNotFound {
 		if !isEmailAddress && !isPhoneNumber {
-			writeErrorResponse(w, http.StatusNotFound, "user_not_found")
-			return
+			return nil, ErrUserNotFound
 		}
-	} else if handleServerError(w, "searching for user", err) {
-		return
+	} else if err != nil {
+		return nil, err
 	}
 	username := ""
 	emailAddress := ""
@@ -318,15 +360,13 @@ func (api OrganizationsAPI) inviteUser(w http.ResponseWriter, r *http.Request, r
 		if role == invitations.RoleMember {
 			for _, membername := range org.Members {
 				if membername == u.Username {
-					http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
-					return
+					return nil, ErrAlreadyMember
 				}
 			}
 		}
 		for _, memberName := range org.Owners {
 			if memberName == username {
-				http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
-				return
+				return nil, ErrAlreadyMember
 			}
 		}
 		// if the user was invited based on email address, then set this email address in the message
@@ -337,9 +377,7 @@ func (api OrganizationsAPI) inviteUser(w http.ResponseWriter, r *http.Request, r
 			validatedEmails, err := valMgr.GetByUsernameValidatedEmailAddress(u.Username)
 			// No need to check for a not found error since we already established that the user exists
 			if err != nil {
-				log.Error("Failed to get validated email for user: ", err)
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-				return
+				return nil, err
 			}
 			if len(validatedEmails) > 0 {
 				emailAddress = validatedEmails[0].EmailAddress
@@ -350,14 +388,10 @@ func (api OrganizationsAPI) inviteUser(w http.ResponseWriter, r *http.Request, r
 	invitationMgr := invitations.NewInvitationManager(r)
 	count, err := invitationMgr.CountByOrganization(globalID)
 	if err != nil {
-		log.Error(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	if count >= maximumNumberOfInvitationsPerOrganization {
-		log.Error("Reached invitation limit for organization ", globalID)
-		writeErrorResponse(w, 422, "max_amount_of_invitations_reached")
-		return
+		return nil, ErrMaxInvitations
 	}
 
 	orgReq := &invitations.JoinOrganizationInvitation{
@@ -375,42 +409,30 @@ func (api OrganizationsAPI) inviteUser(w http.ResponseWriter, r *http.Request, r
 
 	autoAccepted, err := api.autoAcceptSubOrgInvite(orgReq, orgMgr)
 	if err != nil {
-		if db.IsNotFound(err) {
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-			return
+		return nil, err
+	}
+	if autoAccepted {
+		action := audit.ActionMemberAdded
+		if orgReq.Role == invitations.RoleOwner {
+			action = audit.ActionOwnerAdded
 		}
-		log.Error("Failure while trying to auto accept organization invite: ", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		audit.Record(r, audit.Event{Action: action, Subject: orgReq.User, Organization: globalID})
 	}
 
 	if err = invitationMgr.Save(orgReq); err != nil {
-		log.Error("Error inviting owner: ", err.Error())
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	if invitenotification != "none" && !autoAccepted {
-		err = api.sendInvite(r, orgReq)
-		if handleServerError(w, "sending organization invite", err) {
-			return
+	if notify && !autoAccepted {
+		if err = api.sendInvite(r, orgReq); err != nil {
+			return nil, err
 		}
 	}
-
-	usrMgr := user.NewManager(r)
-	valMgr := validationdb.NewManager(r)
-	reqView, err := orgReq.ConvertToView(usrMgr, valMgr)
-	if handleServerError(w, "converting invite to inviteview", err) {
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(reqView)
+	return orgReq, nil
 }
 
 // autoAcceptSubOrgInvite tries to auto accept an invitation if a user is already a member or owner in a parent organization
-func (api OrganizationsAPI) autoAcceptSubOrgInvite(invite *invitations.JoinOrganizationInvitation, mgr *organization.Manager) (bool, error) {
+func (api OrganizationsAPI) autoAcceptSubOrgInvite(invite *invitations.JoinOrganizationInvitation, mgr organization.Manager) (bool, error) {
 	globalid := invite.Organization
 
 	// If this is an invite for a root organization we obviously aren't a member of a parent yet
@@ -524,6 +546,7 @@ func (api OrganizationsAPI) UpdateOrganizationMemberShip(w http.ResponseWriter,
 		handleServerError(w, "updating organization membership", err)
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionRoleChanged, Subject: username, Organization: globalid, Detail: membership.Role})
 	org, err = orgMgr.GetByName(globalid)
 	if err != nil {
 		handleServerError(w, "getting organization", err)
@@ -586,6 +609,7 @@ func (api OrganizationsAPI) UpdateOrganizationOrgMemberShip(w http.ResponseWrite
 	if handleServerError(w, "updating organizations membership in another org", err) {
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionRoleChanged, Organization: globalid, MemberOrganization: body.Org, Detail: body.Role})
 	org, err = orgMgr.GetByName(globalid)
 	if handleServerError(w, "getting organization", err) {
 		return
@@ -631,7 +655,9 @@ func removeOrganizationMember(w http.ResponseWriter, r *http.Request, role strin
 	} else {
 		log.Errorf("Invalid role given to removeOrganizationMember: %s", role)
 		writeErrorResponse(w, http.StatusInternalServerError, "invalid_role")
+		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionMemberRemoved, Subject: username, Organization: globalID, Detail: role})
 
 	err = userMgr.DeleteAuthorization(username, globalID)
 	if handleServerError(w, "removing authorization", err) {
@@ -834,6 +860,7 @@ func (api OrganizationsAPI) CreateNewAPIKey(w http.ResponseWriter, r *http.Reque
 	}
 
 	apiKey.Secret = c.Secret
+	audit.Record(r, audit.Event{Action: audit.ActionAPIKeyCreated, Organization: globalID, Detail: apiKey.Label})
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -903,6 +930,7 @@ func (api OrganizationsAPI) DeleteAPIKey(w http.ResponseWriter, r *http.Request)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionAPIKeyRemoved, Organization: organization, Detail: label})
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -1129,6 +1157,9 @@ func (api OrganizationsAPI) actualOrganizationDeletion(r *http.Request, globalid
 	if grants.NewManager(r).DeleteOrgGrants(globalid); err != nil && !db.IsNotFound(err) {
 		return err
 	}
+	if err = webhook.NewManager(r).RemoveByOrganization(globalid); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1422,6 +1453,7 @@ func (api OrganizationsAPI) SetOrgMember(w http.ResponseWriter, r *http.Request)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionMemberAdded, Organization: globalid, MemberOrganization: body.OrgMember})
 
 	w.WriteHeader(http.StatusCreated)
 }
@@ -1458,6 +1490,7 @@ func (api OrganizationsAPI) DeleteOrgMember(w http.ResponseWriter, r *http.Reque
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionMemberRemoved, Organization: globalid, MemberOrganization: orgMember, Detail: "orgmember"})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1529,6 +1562,7 @@ func (api OrganizationsAPI) SetOrgOwner(w http.ResponseWriter, r *http.Request)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionOwnerAdded, Organization: globalid, MemberOrganization: body.OrgOwner})
 
 	w.WriteHeader(http.StatusCreated)
 }
@@ -1565,6 +1599,7 @@ func (api OrganizationsAPI) DeleteOrgOwner(w http.ResponseWriter, r *http.Reques
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionMemberRemoved, Organization: globalid, MemberOrganization: orgOwner, Detail: "orgowner"})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1962,12 +1997,14 @@ func (api OrganizationsAPI) AcceptOrganizationInvite(w http.ResponseWriter, r *h
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
+		audit.Record(r, audit.Event{Action: audit.ActionOwnerAdded, Organization: invitingorgname, MemberOrganization: invitedorgname, Detail: audit.DetailInvitation})
 	} else {
 		if err := orgMgr.SaveOrgMember(invitingorg, invitedorgname); err != nil {
 			log.Error("Failed to save organization member: ", invitedorgname)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
+		audit.Record(r, audit.Event{Action: audit.ActionMemberAdded, Organization: invitingorgname, MemberOrganization: invitedorgname, Detail: audit.DetailInvitation})
 	}
 
 	orgRequest.Status = invitations.RequestAccepted
@@ -2299,6 +2336,7 @@ func (api OrganizationsAPI) DeleteUserGrant(w http.ResponseWriter, r *http.Reque
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionGrantRemoved, Subject: userObj.Username, Organization: globalid, Detail: string(grant)})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -2339,6 +2377,7 @@ func (api OrganizationsAPI) DeleteAllUserGrants(w http.ResponseWriter, r *http.R
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionGrantRemoved, Subject: userObj.Username, Organization: globalid})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -2397,6 +2436,8 @@ func (api OrganizationsAPI) CreateUserGrant(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		log.Debug("Max amount of grants reached")
 		http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+	} else {
+		audit.Record(r, audit.Event{Action: audit.ActionGrantAdded, Subject: userObj.Username, Organization: globalid, Detail: string(body.Grant)})
 	}
 
 	grantObj, err := grantMgr.GetGrantsForUser(userObj.Username, globalid)
@@ -2493,6 +2534,7 @@ func (api OrganizationsAPI) UpdateUserGrant(w http.ResponseWriter, r *http.Reque
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionGrantUpdated, Subject: userObj.Username, Organization: globalid, Detail: string(body.NewGrant)})
 
 	grantObj, err := grantMgr.GetGrantsForUser(userObj.Username, globalid)
 	if err != nil {
@@ -2549,6 +2591,23 @@ func (api OrganizationsAPI) ListUsersWithGrant(w http.ResponseWriter, r *http.Re
 	json.NewEncoder(w).Encode(userIdentifiers)
 }
 
+// ListAuditLog is the handler for GET /organizations/{globalid}/auditlog
+// Lists the security relevant actions about the organization, like changes of the members and api keys, newest first
+func (api OrganizationsAPI) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+	query, err := audit.ParseQuery(r.URL.Query())
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	events, err := audit.NewManager(r).ListByOrganization(globalid, query)
+	if handleServerError(w, "listing the audit log", err) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&events)
+}
+
 func writeErrorResponse(responseWriter http.ResponseWriter, httpStatusCode int, message string) {
 	log.Debug(httpStatusCode, message)
 	errorResponse := struct {
@@ -0,0 +1,176 @@
+package organization
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/webhook"
+	"github.com/itsyouonline/identityserver/tools"
+)
+
+const (
+	maximumNumberOfWebhooksPerOrganization = 20
+	defaultNumberOfWebhookDeliveries       = 100
+	maximumNumberOfWebhookDeliveries       = 1000
+)
+
+// webhookBody is the body of the requests creating and updating a webhook
+type webhookBody struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// ListWebhooks is the handler for GET /organizations/{globalid}/webhooks
+// Lists the webhooks of the organization without their secrets
+func (api OrganizationsAPI) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+	webhooks, err := webhook.NewManager(r).ListByOrganization(globalid)
+	if handleServerError(w, "listing the webhooks", err) {
+		return
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&webhooks)
+}
+
+// CreateWebhook is the handler for POST /organizations/{globalid}/webhooks
+// Registers a webhook, the secret that signs the deliveries is generated and only returned in the response
+func (api OrganizationsAPI) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+	body := webhookBody{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Debug("Error decoding webhook: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	hook := &webhook.Webhook{Globalid: globalid, URL: body.URL, Events: body.Events, CreatedAt: time.Now()}
+	if err := hook.Validate(); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mgr := webhook.NewManager(r)
+	existing, err := mgr.ListByOrganization(globalid)
+	if handleServerError(w, "listing the webhooks", err) {
+		return
+	}
+	if len(existing) >= maximumNumberOfWebhooksPerOrganization {
+		writeErrorResponse(w, http.StatusConflict, "max_amount_of_webhooks_reached")
+		return
+	}
+	if hook.Secret, err = tools.GenerateRandomString(); handleServerError(w, "generating the webhook secret", err) {
+		return
+	}
+	if handleServerError(w, "creating the webhook", mgr.Create(hook)) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// GetWebhook is the handler for GET /organizations/{globalid}/webhooks/{id}
+func (api OrganizationsAPI) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+	id := mux.Vars(r)["id"]
+	hook, err := webhook.NewManager(r).Get(globalid, id)
+	if db.IsNotFound(err) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if handleServerError(w, "getting the webhook", err) {
+		return
+	}
+	hook.Secret = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// UpdateWebhook is the handler for PUT /organizations/{globalid}/webhooks/{id}
+// Changes the url and the events of a webhook, the secret stays the same
+func (api OrganizationsAPI) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+	id := mux.Vars(r)["id"]
+	body := webhookBody{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Debug("Error decoding webhook: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	mgr := webhook.NewManager(r)
+	hook, err := mgr.Get(globalid, id)
+	if db.IsNotFound(err) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if handleServerError(w, "getting the webhook", err) {
+		return
+	}
+	hook.URL = body.URL
+	hook.Events = body.Events
+	if err = hook.Validate(); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if handleServerError(w, "updating the webhook", mgr.Update(hook)) {
+		return
+	}
+	hook.Secret = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// DeleteWebhook is the handler for DELETE /organizations/{globalid}/webhooks/{id}
+// Removes a webhook and its pending deliveries
+func (api OrganizationsAPI) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+	id := mux.Vars(r)["id"]
+	err := webhook.NewManager(r).Delete(globalid, id)
+	if db.IsNotFound(err) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if handleServerError(w, "deleting the webhook", err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries is the handler for GET /organizations/{globalid}/webhooks/{id}/deliveries
+// Lists the last deliveries of a webhook, newest first
+func (api OrganizationsAPI) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+	id := mux.Vars(r)["id"]
+	limit := defaultNumberOfWebhookDeliveries
+	if rawLimit := r.FormValue("limit"); rawLimit != "" {
+		var err error
+		if limit, err = strconv.Atoi(rawLimit); err != nil || limit <= 0 {
+			writeErrorResponse(w, http.StatusBadRequest, "invalid_limit")
+			return
+		}
+		if limit > maximumNumberOfWebhookDeliveries {
+			limit = maximumNumberOfWebhookDeliveries
+		}
+	}
+	mgr := webhook.NewManager(r)
+	_, err := mgr.Get(globalid, id)
+	if db.IsNotFound(err) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if handleServerError(w, "getting the webhook", err) {
+		return
+	}
+	deliveries, err := mgr.ListDeliveries(globalid, id, limit)
+	if handleServerError(w, "listing the webhook deliveries", err) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&deliveries)
+}
@@ -176,6 +176,26 @@ type OrganizationsInterface interface { // CreateNewOrganization is the handler
 	// ListUsersWithGrant is the handler for GET /organization/{globalid}/grants/havegrant/{grant}
 	// Lists all users with a given grant
 	ListUsersWithGrant(w http.ResponseWriter, r *http.Request)
+	// ListAuditLog is the handler for GET /organizations/{globalid}/auditlog
+	// Lists the security relevant actions about the organization
+	ListAuditLog(w http.ResponseWriter, r *http.Request)
+	// ListWebhooks is the handler for GET /organizations/{globalid}/webhooks
+	// Lists the webhooks of the organization
+	ListWebhooks(w http.ResponseWriter, r *http.Request)
+	// CreateWebhook is the handler for POST /organizations/{globalid}/webhooks
+	// Registers a webhook
+	CreateWebhook(w http.ResponseWriter, r *http.Request)
+	// GetWebhook is the handler for GET /organizations/{globalid}/webhooks/{id}
+	GetWebhook(w http.ResponseWriter, r *http.Request)
+	// UpdateWebhook is the handler for PUT /organizations/{globalid}/webhooks/{id}
+	// Changes the url and the events of a webhook
+	UpdateWebhook(w http.ResponseWriter, r *http.Request)
+	// DeleteWebhook is the handler for DELETE /organizations/{globalid}/webhooks/{id}
+	// Removes a webhook
+	DeleteWebhook(w http.ResponseWriter, r *http.Request)
+	// ListWebhookDeliveries is the handler for GET /organizations/{globalid}/webhooks/{id}/deliveries
+	// Lists the last deliveries of a webhook
+	ListWebhookDeliveries(w http.ResponseWriter, r *http.Request)
 }
 
 // OrganizationsInterfaceRoutes is routing for /organizations root endpoint
@@ -238,4 +258,11 @@ func OrganizationsInterfaceRoutes(r *mux.Router, i OrganizationsInterface) {
 	r.Handle("/organizations/{globalid}/grants", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.CreateUserGrant))).Methods("POST")
 	r.Handle("/organizations/{globalid}/grants", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.UpdateUserGrant))).Methods("PUT")
 	r.Handle("/organizations/{globalid}/grants/havegrant/{grant}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.ListUsersWithGrant))).Methods("GET")
+	r.Handle("/organizations/{globalid}/auditlog", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.ListAuditLog))).Methods("GET")
+	r.Handle("/organizations/{globalid}/webhooks", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.ListWebhooks))).Methods("GET")
+	r.Handle("/organizations/{globalid}/webhooks", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.CreateWebhook))).Methods("POST")
+	r.Handle("/organizations/{globalid}/webhooks/{id}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.GetWebhook))).Methods("GET")
+	r.Handle("/organizations/{globalid}/webhooks/{id}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.UpdateWebhook))).Methods("PUT")
+	r.Handle("/organizations/{globalid}/webhooks/{id}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.DeleteWebhook))).Methods("DELETE")
+	r.Handle("/organizations/{globalid}/webhooks/{id}/deliveries", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.ListWebhookDeliveries))).Methods("GET")
 }
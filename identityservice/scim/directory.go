@@ -0,0 +1,270 @@
+package scim
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/itsyouonline/identityserver/db"
+	organizationdb "github.com/itsyouonline/identityserver/db/organization"
+	validationdb "github.com/itsyouonline/identityserver/db/validation"
+	"github.com/itsyouonline/identityserver/identityservice/invitations"
+)
+
+// directory is the SCIM view of an organization and its suborganizations
+type directory struct {
+	root string
+	// baseURL is the url of the SCIM api of the root organization, used for the locations of the resources
+	baseURL string
+	// organizations holds the root organization first and then its suborganizations
+	organizations []organizationdb.Organization
+	users         map[string]*User
+	// invitations holds the pending invitations of a user id
+	invitations map[string][]invitations.JoinOrganizationInvitation
+	// contacts holds the ids of the users of which the email addresses and phone numbers are loaded
+	contacts map[string]bool
+}
+
+// loadDirectory reads the organization tree and the pending invitations. A not found error is returned if the organization does not exist.
+// The validated email addresses and phone numbers of the members are only loaded by loadContacts, for the users that are returned.
+func loadDirectory(r *http.Request, globalID string) (*directory, error) {
+	orgMgr := organizationdb.NewManager(r)
+	root, err := orgMgr.GetByName(globalID)
+	if err != nil {
+		return nil, err
+	}
+	subOrganizations, err := orgMgr.GetSubOrganizations(globalID)
+	if err != nil {
+		return nil, err
+	}
+	d := &directory{
+		root:          globalID,
+		baseURL:       "https://" + r.Host + "/api/scim/v2/" + globalID,
+		organizations: append([]organizationdb.Organization{*root}, subOrganizations...),
+		users:         map[string]*User{},
+		invitations:   map[string][]invitations.JoinOrganizationInvitation{},
+		contacts:      map[string]bool{},
+	}
+
+	for _, org := range d.organizations {
+		for _, username := range append(append([]string{}, org.Members...), org.Owners...) {
+			u, found := d.users[username]
+			if !found {
+				u = d.newUser(username, true)
+			}
+			u.Groups = append(u.Groups, MultiValue{Value: org.Globalid, Display: org.Globalid, Ref: d.baseURL + "/Groups/" + org.Globalid})
+		}
+	}
+
+	invitationMgr := invitations.NewInvitationManager(r)
+	for _, org := range d.organizations {
+		pending, err := invitationMgr.FilterByOrganization(org.Globalid, string(invitations.RequestPending))
+		if err != nil {
+			return nil, err
+		}
+		for _, invitation := range pending {
+			if invitation.IsOrganization {
+				continue
+			}
+			id := invitationUserID(invitation)
+			d.invitations[id] = append(d.invitations[id], invitation)
+			if _, found := d.users[id]; found {
+				continue
+			}
+			u := d.newUser(id, false)
+			d.contacts[id] = true
+			if invitation.EmailAddress != "" {
+				u.Emails = []MultiValue{{Value: invitation.EmailAddress, Primary: true}}
+			}
+			if invitation.PhoneNumber != "" {
+				u.PhoneNumbers = []MultiValue{{Value: invitation.PhoneNumber, Primary: true}}
+			}
+		}
+	}
+	return d, nil
+}
+
+// loadContacts adds the validated email addresses and phone numbers to the members that do not have them yet
+func (d *directory) loadContacts(r *http.Request, users []*User) error {
+	usernames := []string{}
+	for _, u := range users {
+		if !d.contacts[u.ID] {
+			d.contacts[u.ID] = true
+			usernames = append(usernames, u.ID)
+		}
+	}
+	if len(usernames) == 0 {
+		return nil
+	}
+	valMgr := validationdb.NewManager(r)
+	emails, err := valMgr.GetValidatedEmailAddressesByUsernames(usernames)
+	if err != nil {
+		return err
+	}
+	for _, email := range emails {
+		if u, found := d.users[email.Username]; found {
+			u.Emails = append(u.Emails, MultiValue{Value: email.EmailAddress, Primary: len(u.Emails) == 0})
+		}
+	}
+	phonenumbers, err := valMgr.GetValidatedPhoneNumbersByUsernames(usernames)
+	if err != nil {
+		return err
+	}
+	for _, phonenumber := range phonenumbers {
+		if u, found := d.users[phonenumber.Username]; found {
+			u.PhoneNumbers = append(u.PhoneNumbers, MultiValue{Value: phonenumber.Phonenumber, Primary: len(u.PhoneNumbers) == 0})
+		}
+	}
+	return nil
+}
+
+// invitationUserID returns the id of an invited user, the email address or phone number is used if the user is unknown
+func invitationUserID(invitation invitations.JoinOrganizationInvitation) string {
+	if invitation.User != "" {
+		return invitation.User
+	}
+	if invitation.EmailAddress != "" {
+		return invitation.EmailAddress
+	}
+	return invitation.PhoneNumber
+}
+
+func (d *directory) newUser(id string, active bool) *User {
+	u := &User{
+		Schemas:  []string{SchemaUser},
+		ID:       id,
+		UserName: id,
+		Active:   active,
+		Meta:     Meta{ResourceType: "User", Location: d.baseURL + "/Users/" + id},
+	}
+	d.users[id] = u
+	return u
+}
+
+// find returns a user by id or by one of its email addresses or phone numbers with its contacts loaded,
+// nil is returned if the user is not in the directory
+func (d *directory) find(r *http.Request, id string) (*User, error) {
+	u := d.user(id)
+	if u == nil {
+		username, err := validatedUsername(r, id)
+		if err != nil {
+			return nil, err
+		}
+		u = d.users[username]
+	}
+	if u == nil {
+		return nil, nil
+	}
+	return u, d.loadContacts(r, []*User{u})
+}
+
+// validatedUsername returns the user that validated an email address or phone number, or "" if there is none
+func validatedUsername(r *http.Request, emailOrPhonenumber string) (string, error) {
+	valMgr := validationdb.NewManager(r)
+	email, err := valMgr.GetByEmailAddress(emailOrPhonenumber)
+	if err == nil {
+		return email.Username, nil
+	}
+	if !db.IsNotFound(err) {
+		return "", err
+	}
+	phonenumber, err := valMgr.GetByPhoneNumber(emailOrPhonenumber)
+	if err == nil {
+		return phonenumber.Username, nil
+	}
+	if db.IsNotFound(err) {
+		return "", nil
+	}
+	return "", err
+}
+
+// user returns a user by id or by one of its loaded email addresses or phone numbers
+func (d *directory) user(id string) *User {
+	if u, found := d.users[id]; found {
+		return u
+	}
+	for _, u := range d.users {
+		for _, identifier := range append(append([]MultiValue{}, u.Emails...), u.PhoneNumbers...) {
+			if identifier.Value == id {
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+// organization returns the organization of the tree with the globalid
+func (d *directory) organization(globalID string) *organizationdb.Organization {
+	for i := range d.organizations {
+		if d.organizations[i].Globalid == globalID {
+			return &d.organizations[i]
+		}
+	}
+	return nil
+}
+
+// group converts an organization of the tree to a group
+func (d *directory) group(org *organizationdb.Organization) *Group {
+	g := &Group{
+		Schemas:     []string{SchemaGroup},
+		ID:          org.Globalid,
+		DisplayName: org.Globalid,
+		Members:     []MultiValue{},
+		Meta:        Meta{ResourceType: "Group", Location: d.baseURL + "/Groups/" + org.Globalid},
+	}
+	for _, username := range append(append([]string{}, org.Members...), org.Owners...) {
+		g.Members = append(g.Members, MultiValue{Value: username, Display: username, Type: "User", Ref: d.baseURL + "/Users/" + username})
+	}
+	return g
+}
+
+// userList returns the users sorted by id
+func (d *directory) userList() []*User {
+	ids := make([]string, 0, len(d.users))
+	for id := range d.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	users := make([]*User, len(ids))
+	for i, id := range ids {
+		users[i] = d.users[id]
+	}
+	return users
+}
+
+// groupList returns the groups sorted by id
+func (d *directory) groupList() []interface{} {
+	resources := make([]interface{}, len(d.organizations))
+	for i := range d.organizations {
+		resources[i] = d.group(&d.organizations[i])
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].(*Group).ID < resources[j].(*Group).ID })
+	return resources
+}
+
+// isRootOwner checks if a user is an owner of the root organization, these can not be removed through SCIM
+func (d *directory) isRootOwner(username string) bool {
+	for _, owner := range d.organizations[0].Owners {
+		if owner == username {
+			return true
+		}
+	}
+	return false
+}
+
+// roles returns the organizations of the tree the user is a member or owner of, with the role
+func (d *directory) roles(username string) map[string]string {
+	roles := map[string]string{}
+	for _, org := range d.organizations {
+		for _, member := range org.Members {
+			if member == username {
+				roles[org.Globalid] = invitations.RoleMember
+			}
+		}
+		for _, owner := range org.Owners {
+			if owner == username {
+				roles[org.Globalid] = invitations.RoleOwner
+			}
+		}
+	}
+	return roles
+}
@@ -0,0 +1,302 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// errInvalidFilter is returned for a filter that can not be parsed
+var errInvalidFilter = errors.New("invalidFilter")
+
+// filter checks if a resource matches, the resource is its JSON representation
+type filter func(resource map[string]interface{}) bool
+
+// parseFilter parses a SCIM filter like `userName eq "bob" and active eq true`.
+// The comparison operators, and, or, not and parentheses are supported, value paths like emails[type eq "work"] are not.
+func parseFilter(expression string) (filter, error) {
+	f, _, err := parseFilterPaths(expression)
+	return f, err
+}
+
+// parseFilterPaths parses a filter like parseFilter and also returns the attribute paths it compares
+func parseFilterPaths(expression string) (filter, []string, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.or()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.position != len(p.tokens) {
+		return nil, nil, fmt.Errorf("%s: unexpected %q", errInvalidFilter, p.tokens[p.position])
+	}
+	return f, p.paths, nil
+}
+
+// tokenize splits a filter in words, quoted strings and parentheses
+func tokenize(expression string) (tokens []string, err error) {
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		switch {
+		case unicode.IsSpace(runes[i]):
+			i++
+		case runes[i] == '(' || runes[i] == ')':
+			tokens = append(tokens, string(runes[i]))
+			i++
+		case runes[i] == '"':
+			end := i + 1
+			for ; end < len(runes) && runes[end] != '"'; end++ {
+				if runes[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("%s: unterminated string", errInvalidFilter)
+			}
+			tokens = append(tokens, string(runes[i:end+1]))
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '(' && runes[end] != ')' && runes[end] != '"' {
+				end++
+			}
+			tokens = append(tokens, string(runes[i:end]))
+			i = end
+		}
+	}
+	return
+}
+
+type filterParser struct {
+	tokens   []string
+	position int
+	// paths holds the attribute paths of the comparisons
+	paths []string
+}
+
+// next returns the next token in lower case without consuming it, or "" at the end
+func (p *filterParser) next() string {
+	if p.position >= len(p.tokens) {
+		return ""
+	}
+	return strings.ToLower(p.tokens[p.position])
+}
+
+func (p *filterParser) take() (string, error) {
+	if p.position >= len(p.tokens) {
+		return "", fmt.Errorf("%s: unexpected end", errInvalidFilter)
+	}
+	p.position++
+	return p.tokens[p.position-1], nil
+}
+
+func (p *filterParser) or() (filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "or" {
+		p.position++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(resource map[string]interface{}) bool { return l(resource) || right(resource) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filter, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "and" {
+		p.position++
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(resource map[string]interface{}) bool { return l(resource) && right(resource) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) not() (filter, error) {
+	if p.next() != "not" {
+		return p.primary()
+	}
+	p.position++
+	if p.next() != "(" {
+		return nil, fmt.Errorf("%s: not must be followed by a parenthesis", errInvalidFilter)
+	}
+	f, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	return func(resource map[string]interface{}) bool { return !f(resource) }, nil
+}
+
+func (p *filterParser) primary() (filter, error) {
+	if p.next() == "(" {
+		p.position++
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("%s: missing closing parenthesis", errInvalidFilter)
+		}
+		p.position++
+		return f, nil
+	}
+	path, err := p.take()
+	if err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(path, "[]") {
+		return nil, fmt.Errorf("%s: value paths are not supported", errInvalidFilter)
+	}
+	p.paths = append(p.paths, path)
+	operator, err := p.take()
+	if err != nil {
+		return nil, err
+	}
+	operator = strings.ToLower(operator)
+	if operator == "pr" {
+		return func(resource map[string]interface{}) bool { return len(attributeValues(resource, path)) > 0 }, nil
+	}
+	compare, known := comparisons[operator]
+	if !known {
+		return nil, fmt.Errorf("%s: unknown operator %q", errInvalidFilter, operator)
+	}
+	rawValue, err := p.take()
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err = json.Unmarshal([]byte(rawValue), &value); err != nil {
+		return nil, fmt.Errorf("%s: invalid value %s", errInvalidFilter, rawValue)
+	}
+	if operator == "ne" {
+		// ne matches if no value is equal, also when the attribute is not present
+		return func(resource map[string]interface{}) bool {
+			for _, actual := range attributeValues(resource, path) {
+				if comparisons["eq"](actual, value) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	}
+	return func(resource map[string]interface{}) bool {
+		for _, actual := range attributeValues(resource, path) {
+			if compare(actual, value) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// comparisons compare an attribute value with the value of the filter, strings are compared case insensitive
+var comparisons = map[string]func(actual, expected interface{}) bool{
+	"eq": func(actual, expected interface{}) bool {
+		if a, e, ok := strs(actual, expected); ok {
+			return a == e
+		}
+		return actual == expected
+	},
+	"ne": nil, // handled by the parser
+	"co": stringComparison(strings.Contains),
+	"sw": stringComparison(strings.HasPrefix),
+	"ew": stringComparison(strings.HasSuffix),
+	"gt": ordered(func(c int) bool { return c > 0 }),
+	"ge": ordered(func(c int) bool { return c >= 0 }),
+	"lt": ordered(func(c int) bool { return c < 0 }),
+	"le": ordered(func(c int) bool { return c <= 0 }),
+}
+
+func strs(actual, expected interface{}) (string, string, bool) {
+	a, aok := actual.(string)
+	e, eok := expected.(string)
+	return strings.ToLower(a), strings.ToLower(e), aok && eok
+}
+
+func stringComparison(compare func(s, substr string) bool) func(actual, expected interface{}) bool {
+	return func(actual, expected interface{}) bool {
+		a, e, ok := strs(actual, expected)
+		return ok && compare(a, e)
+	}
+}
+
+func ordered(result func(c int) bool) func(actual, expected interface{}) bool {
+	return func(actual, expected interface{}) bool {
+		if a, e, ok := strs(actual, expected); ok {
+			return result(strings.Compare(a, e))
+		}
+		a, aok := actual.(float64)
+		e, eok := expected.(float64)
+		if !aok || !eok {
+			return false
+		}
+		switch {
+		case a < e:
+			return result(-1)
+		case a > e:
+			return result(1)
+		}
+		return result(0)
+	}
+}
+
+// attributeValues returns the values of an attribute path like emails.value, attribute names are case insensitive.
+// The values of multi-valued attributes are flattened and a complex value without sub-attribute is compared by its value.
+func attributeValues(resource map[string]interface{}, path string) []interface{} {
+	values := []interface{}{resource}
+	for _, name := range strings.Split(path, ".") {
+		next := []interface{}{}
+		for _, value := range values {
+			if complex, ok := value.(map[string]interface{}); ok {
+				next = append(next, flatten(attribute(complex, name))...)
+			}
+		}
+		values = next
+	}
+	result := []interface{}{}
+	for _, value := range values {
+		if complex, ok := value.(map[string]interface{}); ok {
+			value = attribute(complex, "value")
+		}
+		if value != nil {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func attribute(complex map[string]interface{}, name string) interface{} {
+	for key, value := range complex {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return nil
+}
+
+func flatten(value interface{}) []interface{} {
+	if value == nil {
+		return nil
+	}
+	if multi, ok := value.([]interface{}); ok {
+		return multi
+	}
+	return []interface{}{value}
+}
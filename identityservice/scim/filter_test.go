@@ -0,0 +1,66 @@
+package scim
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	user := map[string]interface{}{}
+	json.Unmarshal([]byte(`{
+		"id": "bob",
+		"userName": "bob",
+		"active": true,
+		"emails": [{"value": "Bob@Example.com", "primary": true}, {"value": "bob@work.com"}],
+		"meta": {"resourceType": "User"}
+	}`), &user)
+
+	testCases := []struct {
+		filter  string
+		matches bool
+	}{
+		{filter: `userName eq "bob"`, matches: true},
+		{filter: `USERNAME eq "BOB"`, matches: true},
+		{filter: `userName eq "alice"`, matches: false},
+		{filter: `userName ne "alice"`, matches: true},
+		{filter: `active eq true`, matches: true},
+		{filter: `active eq false`, matches: false},
+		{filter: `emails eq "bob@example.com"`, matches: true},
+		{filter: `emails.value ew "@work.com"`, matches: true},
+		{filter: `emails.value co "other"`, matches: false},
+		{filter: `userName sw "b" and active eq true`, matches: true},
+		{filter: `userName eq "alice" or meta.resourceType eq "User"`, matches: true},
+		{filter: `not (userName eq "bob")`, matches: false},
+		{filter: `(userName eq "alice" or userName eq "bob") and emails pr`, matches: true},
+		{filter: `phoneNumbers pr`, matches: false},
+		{filter: `phoneNumbers ne "123"`, matches: true},
+		{filter: `userName gt "alice"`, matches: true},
+		{filter: `userName le "alice"`, matches: false},
+	}
+	for _, test := range testCases {
+		f, err := parseFilter(test.filter)
+		if assert.NoError(t, err, test.filter) {
+			assert.Equal(t, test.matches, f(user), test.filter)
+		}
+	}
+}
+
+func TestInvalidFilter(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName is "bob"`,
+		`userName eq "bob`,
+		`userName eq bob`,
+		`(userName eq "bob"`,
+		`userName eq "bob")`,
+		`not userName eq "bob"`,
+		`emails[type eq "work"] pr`,
+	} {
+		_, err := parseFilter(filter)
+		assert.Error(t, err, filter)
+	}
+}
@@ -0,0 +1,92 @@
+package scim
+
+import (
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"github.com/itsyouonline/identityserver/identityservice/security"
+	"github.com/itsyouonline/identityserver/oauthservice"
+)
+
+// requiredScope is the scope the client credentials token of the organization needs
+const requiredScope = "organization:owner"
+
+// OrganizationTokenMiddleware only lets requests through that have an access token of the organization
+// in the path or of one of its parents, obtained with the client credentials flow.
+// SCIM clients send opaque access tokens as bearer tokens, so a bearer token that is not a JWT is looked up as an access token.
+type OrganizationTokenMiddleware struct {
+	security.OAuth2Middleware
+}
+
+// Handler return HTTP handler representation of this middleware
+func (om *OrganizationTokenMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protectedOrganization := mux.Vars(r)["globalid"]
+		var globalID, clientID, scopestring string
+
+		accessToken := om.GetAccessToken(r)
+		if parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2); accessToken == "" && len(parts) == 2 &&
+			strings.EqualFold(parts[0], "bearer") && strings.Count(parts[1], ".") != 2 {
+			accessToken = strings.TrimSpace(parts[1])
+		}
+
+		if accessToken != "" {
+			at, err := oauthservice.NewCachedManager(r).GetAccessToken(accessToken)
+			if handleServerError(w, "getting access token", err) {
+				return
+			}
+			if at == nil {
+				writeError(w, http.StatusUnauthorized, "", "invalid access token")
+				return
+			}
+			if at.Username != "" {
+				writeError(w, http.StatusForbidden, "", "the access token is not granted to an organization")
+				return
+			}
+			globalID, clientID, scopestring = at.GlobalID, at.ClientID, at.Scope
+		} else {
+			token, err := oauth2.GetValidJWT(r, security.JWTPublicKey)
+			if err != nil {
+				log.Debug("Invalid jwt: ", err)
+				writeError(w, http.StatusUnauthorized, "", "invalid access token")
+				return
+			}
+			if token == nil {
+				writeError(w, http.StatusUnauthorized, "", "no access token")
+				return
+			}
+			if username, _ := token.Claims["username"].(string); username != "" {
+				writeError(w, http.StatusForbidden, "", "the access token is not granted to an organization")
+				return
+			}
+			globalID, _ = token.Claims["globalid"].(string)
+			clientID, _ = token.Claims["azp"].(string)
+			scopestring = oauth2.GetScopestringFromJWT(token)
+		}
+
+		if globalID == "" || (globalID != protectedOrganization && !strings.HasPrefix(protectedOrganization, globalID+".")) {
+			writeError(w, http.StatusForbidden, "", "the access token is not granted to this organization")
+			return
+		}
+		if !hasScope(scopestring, requiredScope) {
+			writeError(w, http.StatusForbidden, "", "the access token misses the "+requiredScope+" scope")
+			return
+		}
+
+		context.Set(r, "client_id", clientID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasScope(scopestring, scope string) bool {
+	for _, available := range strings.Split(scopestring, ",") {
+		if strings.TrimSpace(available) == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,657 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/audit"
+	organizationdb "github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/user"
+	"github.com/itsyouonline/identityserver/identityservice/invitations"
+	"github.com/itsyouonline/identityserver/identityservice/organization"
+)
+
+const (
+	// DefaultCount is the number of resources in a page if the request has no count
+	DefaultCount = 100
+	// MaxCount is the maximum number of resources in a page
+	MaxCount = 1000
+)
+
+// API implements SCIMInterface, users are created by inviting them through the organization api
+type API struct {
+	Organizations organization.OrganizationsAPI
+}
+
+// GetServiceProviderConfig is the handler for GET /scim/v2/{globalid}/ServiceProviderConfig
+func (api API) GetServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(supported bool) map[string]bool { return map[string]bool{"supported": supported} }
+	writeResponse(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{SchemaServiceProviderConfig},
+		"patch":          supported(true),
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": MaxCount},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "An access token of the organization obtained with the client credentials flow",
+			"primary":     true,
+		}},
+	})
+}
+
+// GetResourceTypes is the handler for GET /scim/v2/{globalid}/ResourceTypes
+func (api API) GetResourceTypes(w http.ResponseWriter, r *http.Request) {
+	resourceType := func(name, endpoint, schema string) map[string]interface{} {
+		return map[string]interface{}{
+			"schemas":  []string{SchemaResourceType},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+		}
+	}
+	resources := []interface{}{resourceType("User", "/Users", SchemaUser), resourceType("Group", "/Groups", SchemaGroup)}
+	writeResponse(w, http.StatusOK, ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// ListUsers is the handler for GET /scim/v2/{globalid}/Users
+// The email addresses and phone numbers are only loaded for the users in the page, unless the filter compares them
+func (api API) ListUsers(w http.ResponseWriter, r *http.Request) {
+	q, ok := parseListQuery(w, r)
+	if !ok {
+		return
+	}
+	d, ok := loadDirectoryOrFail(w, r)
+	if !ok {
+		return
+	}
+	users := d.userList()
+	if q.filter != nil {
+		if q.uses("emails", "phoneNumbers") && handleServerError(w, "loading the contacts of the users", d.loadContacts(r, users)) {
+			return
+		}
+		matching := []*User{}
+		for _, u := range users {
+			if q.matches(u) {
+				matching = append(matching, u)
+			}
+		}
+		users = matching
+	}
+	start, end := q.bounds(len(users))
+	page := users[start:end]
+	if handleServerError(w, "loading the contacts of the users", d.loadContacts(r, page)) {
+		return
+	}
+	resources := make([]interface{}, len(page))
+	for i, u := range page {
+		resources[i] = u
+	}
+	q.write(w, len(users), resources)
+}
+
+// GetUser is the handler for GET /scim/v2/{globalid}/Users/{id}
+func (api API) GetUser(w http.ResponseWriter, r *http.Request) {
+	d, ok := loadDirectoryOrFail(w, r)
+	if !ok {
+		return
+	}
+	u, err := d.find(r, mux.Vars(r)["id"])
+	if handleServerError(w, "finding a user", err) {
+		return
+	}
+	if u == nil {
+		writeError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	writeResponse(w, http.StatusOK, u)
+}
+
+// CreateUser is the handler for POST /scim/v2/{globalid}/Users
+// The user is invited to become a member of the organization by email address or phone number.
+// The userName is the login of the user at the client, it is not used because it does not identify a user of ItsYou.online.
+func (api API) CreateUser(w http.ResponseWriter, r *http.Request) {
+	globalID := mux.Vars(r)["globalid"]
+	body := User{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorInvalidSyntax, err.Error())
+		return
+	}
+	searchString := ""
+	if len(body.Emails) > 0 {
+		searchString = body.Emails[0].Value
+	}
+	for _, email := range body.Emails {
+		if email.Primary {
+			searchString = email.Value
+			break
+		}
+	}
+	if searchString == "" && len(body.PhoneNumbers) > 0 {
+		searchString = body.PhoneNumbers[0].Value
+	}
+	if searchString == "" {
+		writeError(w, http.StatusBadRequest, ErrorInvalidValue, "the user needs an email address or a phone number")
+		return
+	}
+	if !user.ValidateEmailAddress(searchString) && !user.ValidatePhoneNumber(searchString) {
+		writeError(w, http.StatusBadRequest, ErrorInvalidValue, "invalid email address or phone number")
+		return
+	}
+
+	d, ok := loadDirectoryOrFail(w, r)
+	if !ok {
+		return
+	}
+	existing, err := d.find(r, searchString)
+	if handleServerError(w, "finding a user", err) {
+		return
+	}
+	if hasInvitation(d, existing, globalID) {
+		writeError(w, http.StatusConflict, ErrorUniqueness, "the user is already invited")
+		return
+	}
+
+	invitation, err := api.Organizations.Invite(r, globalID, searchString, invitations.RoleMember, true)
+	if !handleInviteError(w, err) {
+		return
+	}
+
+	d, ok = loadDirectoryOrFail(w, r)
+	if !ok {
+		return
+	}
+	u, err := d.find(r, invitationUserID(*invitation))
+	if handleServerError(w, "finding the invited user", err) {
+		return
+	}
+	if u == nil {
+		writeError(w, http.StatusInternalServerError, "", "the invited user is not found")
+		return
+	}
+	writeResponse(w, http.StatusCreated, u)
+}
+
+// PatchUser is the handler for PATCH /scim/v2/{globalid}/Users/{id}
+// Only active can be changed, setting it to false removes the user from the organization and its suborganizations
+func (api API) PatchUser(w http.ResponseWriter, r *http.Request) {
+	patch, ok := decodePatch(w, r)
+	if !ok {
+		return
+	}
+	deactivate := false
+	for _, operation := range patch.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "replace" && op != "add" {
+			writeError(w, http.StatusBadRequest, ErrorMutability, "only active can be replaced")
+			return
+		}
+		values := map[string]json.RawMessage{}
+		if operation.Path == "" {
+			if err := json.Unmarshal(operation.Value, &values); err != nil {
+				writeError(w, http.StatusBadRequest, ErrorInvalidValue, err.Error())
+				return
+			}
+		} else {
+			values[operation.Path] = operation.Value
+		}
+		for path, value := range values {
+			if !strings.EqualFold(path, "active") {
+				writeError(w, http.StatusBadRequest, ErrorMutability, "only active can be replaced")
+				return
+			}
+			active, err := parseBool(value)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, ErrorInvalidValue, "active must be a boolean")
+				return
+			}
+			deactivate = !active
+		}
+	}
+
+	d, ok := loadDirectoryOrFail(w, r)
+	if !ok {
+		return
+	}
+	u, err := d.find(r, mux.Vars(r)["id"])
+	if handleServerError(w, "finding a user", err) {
+		return
+	}
+	if u == nil {
+		writeError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	if deactivate {
+		if !api.deactivate(w, r, d, u) {
+			return
+		}
+		u.Active = false
+		u.Groups = nil
+	}
+	writeResponse(w, http.StatusOK, u)
+}
+
+// DeleteUser is the handler for DELETE /scim/v2/{globalid}/Users/{id}
+func (api API) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	d, ok := loadDirectoryOrFail(w, r)
+	if !ok {
+		return
+	}
+	u, err := d.find(r, mux.Vars(r)["id"])
+	if handleServerError(w, "finding a user", err) {
+		return
+	}
+	if u == nil {
+		writeError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	if !api.deactivate(w, r, d, u) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListGroups is the handler for GET /scim/v2/{globalid}/Groups
+func (api API) ListGroups(w http.ResponseWriter, r *http.Request) {
+	q, ok := parseListQuery(w, r)
+	if !ok {
+		return
+	}
+	d, ok := loadDirectoryOrFail(w, r)
+	if !ok {
+		return
+	}
+	writeList(w, q, d.groupList())
+}
+
+// GetGroup is the handler for GET /scim/v2/{globalid}/Groups/{id}
+func (api API) GetGroup(w http.ResponseWriter, r *http.Request) {
+	d, ok := loadDirectoryOrFail(w, r)
+	if !ok {
+		return
+	}
+	org := d.organization(mux.Vars(r)["id"])
+	if org == nil {
+		writeError(w, http.StatusNotFound, "", "group not found")
+		return
+	}
+	writeResponse(w, http.StatusOK, d.group(org))
+}
+
+// memberFilterPath matches the path of an operation on one member like members[value eq "bob"]
+var memberFilterPath = regexp.MustCompile(`(?i)^members\[value eq "(.*)"\]$`)
+
+// PatchGroup is the handler for PATCH /scim/v2/{globalid}/Groups/{id}
+// Added members are invited to the organization, removed members lose their role in it.
+// Members that are not a user of the organization tree are only invited by email address or phone number.
+func (api API) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	patch, ok := decodePatch(w, r)
+	if !ok {
+		return
+	}
+	d, ok := loadDirectoryOrFail(w, r)
+	if !ok {
+		return
+	}
+	org := d.organization(mux.Vars(r)["id"])
+	if org == nil {
+		writeError(w, http.StatusNotFound, "", "group not found")
+		return
+	}
+
+	// members maps the current and added members to true and the removed members to false,
+	// known users are keyed by their id so they can be referred to by email address or phone number as well
+	members := map[string]bool{}
+	set := func(value string, keep bool) bool {
+		u, err := d.find(r, value)
+		if handleServerError(w, "finding a user", err) {
+			return false
+		}
+		if u != nil {
+			value = u.ID
+		} else if keep && !user.ValidateEmailAddress(value) && !user.ValidatePhoneNumber(value) {
+			writeError(w, http.StatusBadRequest, ErrorInvalidValue, "new members are invited by email address or phone number")
+			return false
+		}
+		members[value] = keep
+		return true
+	}
+	for _, member := range d.group(org).Members {
+		members[member.Value] = true
+	}
+	for _, operation := range patch.Operations {
+		op := strings.ToLower(operation.Op)
+		values := map[string]json.RawMessage{}
+		if operation.Path == "" {
+			if err := json.Unmarshal(operation.Value, &values); err != nil {
+				writeError(w, http.StatusBadRequest, ErrorInvalidValue, err.Error())
+				return
+			}
+		} else {
+			values[operation.Path] = operation.Value
+		}
+		for path, value := range values {
+			if match := memberFilterPath.FindStringSubmatch(path); match != nil && op == "remove" {
+				if !set(match[1], false) {
+					return
+				}
+				continue
+			}
+			if !strings.EqualFold(path, "members") {
+				writeError(w, http.StatusBadRequest, ErrorMutability, "only the members of a group can be changed")
+				return
+			}
+			changed := []MultiValue{}
+			if len(value) > 0 {
+				if err := json.Unmarshal(value, &changed); err != nil {
+					writeError(w, http.StatusBadRequest, ErrorInvalidValue, err.Error())
+					return
+				}
+			}
+			switch op {
+			case "add":
+				for _, member := range changed {
+					if !set(member.Value, true) {
+						return
+					}
+				}
+			case "remove":
+				if len(changed) == 0 {
+					for member := range members {
+						members[member] = false
+					}
+				}
+				for _, member := range changed {
+					if !set(member.Value, false) {
+						return
+					}
+				}
+			case "replace":
+				for member := range members {
+					members[member] = false
+				}
+				for _, member := range changed {
+					if !set(member.Value, true) {
+						return
+					}
+				}
+			default:
+				writeError(w, http.StatusBadRequest, ErrorInvalidSyntax, "unknown operation "+operation.Op)
+				return
+			}
+		}
+	}
+
+	removed := []*User{}
+	for member, keep := range members {
+		u := d.user(member)
+		if keep || u == nil {
+			continue
+		}
+		if org.Globalid == d.root && d.isRootOwner(u.ID) {
+			writeError(w, http.StatusConflict, ErrorMutability, "the owners of the organization can not be removed")
+			return
+		}
+		removed = append(removed, u)
+	}
+	for _, u := range removed {
+		if handleServerError(w, "removing a member", api.remove(r, d, u, org.Globalid)) {
+			return
+		}
+	}
+	for member, keep := range members {
+		if u := d.user(member); !keep || (u != nil && d.roles(u.ID)[org.Globalid] != "") || hasInvitation(d, u, org.Globalid) {
+			continue
+		}
+		_, err := api.Organizations.Invite(r, org.Globalid, member, invitations.RoleMember, true)
+		if err != organization.ErrAlreadyMember && !handleInviteError(w, err) {
+			return
+		}
+	}
+
+	d, ok = loadDirectoryOrFail(w, r)
+	if !ok {
+		return
+	}
+	writeResponse(w, http.StatusOK, d.group(d.organization(org.Globalid)))
+}
+
+// deactivate removes a user from the organization and its suborganizations and writes an error if it fails
+func (api API) deactivate(w http.ResponseWriter, r *http.Request, d *directory, u *User) bool {
+	if d.isRootOwner(u.ID) {
+		writeError(w, http.StatusConflict, ErrorMutability, "the owners of the organization can not be removed")
+		return false
+	}
+	for _, org := range d.organizations {
+		if handleServerError(w, "removing a user", api.remove(r, d, u, org.Globalid)) {
+			return false
+		}
+	}
+	return true
+}
+
+// remove takes the role of a user in an organization of the tree, its authorization and its pending invitations
+func (api API) remove(r *http.Request, d *directory, u *User, globalID string) error {
+	if role := d.roles(u.ID)[globalID]; role != "" {
+		orgMgr := organizationdb.NewManager(r)
+		org := d.organization(globalID)
+		var err error
+		if role == invitations.RoleOwner {
+			err = orgMgr.RemoveOwner(org, u.ID)
+		} else {
+			err = orgMgr.RemoveMember(org, u.ID)
+		}
+		if err != nil {
+			return err
+		}
+		audit.Record(r, audit.Event{Action: audit.ActionMemberRemoved, Subject: u.ID, Organization: globalID, Detail: role})
+		if err = user.NewManager(r).DeleteAuthorization(u.ID, globalID); err != nil {
+			return err
+		}
+	}
+	invitationMgr := invitations.NewInvitationManager(r)
+	for _, invitation := range d.invitations[u.ID] {
+		if invitation.Organization != globalID {
+			continue
+		}
+		identifier := invitation.EmailAddress
+		if identifier == "" {
+			identifier = invitation.PhoneNumber
+		}
+		if identifier == "" {
+			identifier = u.ID
+		}
+		if err := invitationMgr.Remove(globalID, u.ID, identifier); err != nil && !db.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasInvitation checks if a user has a pending invitation for an organization
+func hasInvitation(d *directory, u *User, globalID string) bool {
+	if u == nil {
+		return false
+	}
+	for _, invitation := range d.invitations[u.ID] {
+		if invitation.Organization == globalID {
+			return true
+		}
+	}
+	return false
+}
+
+// handleInviteError writes the error of an invitation, it returns true if there was none
+func handleInviteError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case db.IsNotFound(err):
+		writeError(w, http.StatusNotFound, "", "organization not found")
+	case err == organization.ErrAlreadyMember:
+		writeError(w, http.StatusConflict, ErrorUniqueness, "the user is already a member")
+	case err == organization.ErrUserNotFound:
+		writeError(w, http.StatusBadRequest, ErrorInvalidValue, "the user is not found and is not an email address or phone number")
+	case err == organization.ErrMaxInvitations:
+		writeError(w, http.StatusConflict, ErrorTooMany, "the organization has too many invitations")
+	default:
+		handleServerError(w, "inviting a user", err)
+	}
+	return false
+}
+
+func loadDirectoryOrFail(w http.ResponseWriter, r *http.Request) (*directory, bool) {
+	d, err := loadDirectory(r, mux.Vars(r)["globalid"])
+	if db.IsNotFound(err) {
+		writeError(w, http.StatusNotFound, "", "organization not found")
+		return nil, false
+	}
+	if handleServerError(w, "loading the organization", err) {
+		return nil, false
+	}
+	return d, true
+}
+
+func decodePatch(w http.ResponseWriter, r *http.Request) (*PatchRequest, bool) {
+	patch := &PatchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorInvalidSyntax, err.Error())
+		return nil, false
+	}
+	if len(patch.Operations) == 0 {
+		writeError(w, http.StatusBadRequest, ErrorInvalidSyntax, "no operations")
+		return nil, false
+	}
+	return patch, true
+}
+
+// parseBool reads a boolean, some clients send booleans as strings like "False"
+func parseBool(value json.RawMessage) (b bool, err error) {
+	if err = json.Unmarshal(value, &b); err == nil {
+		return
+	}
+	var s string
+	if err = json.Unmarshal(value, &s); err != nil {
+		return
+	}
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+// listQuery holds the filter and the paging of a list request
+type listQuery struct {
+	filter filter
+	// paths holds the attribute paths the filter compares
+	paths      []string
+	startIndex int
+	count      int
+}
+
+// parseListQuery reads the filter, startIndex and count of a list request and writes an error if they are invalid
+func parseListQuery(w http.ResponseWriter, r *http.Request) (*listQuery, bool) {
+	query := r.URL.Query()
+	q := &listQuery{startIndex: 1, count: DefaultCount}
+	var err error
+	if expression := query.Get("filter"); expression != "" {
+		if q.filter, q.paths, err = parseFilterPaths(expression); err != nil {
+			writeError(w, http.StatusBadRequest, ErrorInvalidFilter, err.Error())
+			return nil, false
+		}
+	}
+	if value := query.Get("startIndex"); value != "" {
+		if q.startIndex, err = strconv.Atoi(value); err != nil {
+			writeError(w, http.StatusBadRequest, ErrorInvalidValue, "invalid startIndex")
+			return nil, false
+		}
+	}
+	if value := query.Get("count"); value != "" {
+		if q.count, err = strconv.Atoi(value); err != nil {
+			writeError(w, http.StatusBadRequest, ErrorInvalidValue, "invalid count")
+			return nil, false
+		}
+	}
+	if q.startIndex < 1 {
+		q.startIndex = 1
+	}
+	if q.count < 0 {
+		q.count = 0
+	}
+	if q.count > MaxCount {
+		q.count = MaxCount
+	}
+	return q, true
+}
+
+// uses checks if the filter compares one of the attributes or one of their sub-attributes
+func (q *listQuery) uses(attributes ...string) bool {
+	for _, path := range q.paths {
+		name := strings.SplitN(path, ".", 2)[0]
+		for _, attribute := range attributes {
+			if strings.EqualFold(name, attribute) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches checks if a resource matches the filter, all resources match if there is no filter
+func (q *listQuery) matches(resource interface{}) bool {
+	if q.filter == nil {
+		return true
+	}
+	encoded, _ := json.Marshal(resource)
+	attributes := map[string]interface{}{}
+	json.Unmarshal(encoded, &attributes)
+	return q.filter(attributes)
+}
+
+// bounds returns the slice bounds of the page in a list of total resources
+func (q *listQuery) bounds(total int) (start, end int) {
+	start = q.startIndex - 1
+	if start > total {
+		start = total
+	}
+	end = start + q.count
+	if end > total {
+		end = total
+	}
+	return
+}
+
+// write writes a page of a list of total resources
+func (q *listQuery) write(w http.ResponseWriter, total int, page []interface{}) {
+	writeResponse(w, http.StatusOK, ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   q.startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+}
+
+// writeList writes a page of the resources that match the filter of the request
+func writeList(w http.ResponseWriter, q *listQuery, resources []interface{}) {
+	matching := []interface{}{}
+	for _, resource := range resources {
+		if q.matches(resource) {
+			matching = append(matching, resource)
+		}
+	}
+	start, end := q.bounds(len(matching))
+	q.write(w, len(matching), matching[start:end])
+}
@@ -0,0 +1,256 @@
+package scim
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/db"
+	organizationdb "github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/user"
+	validationdb "github.com/itsyouonline/identityserver/db/validation"
+	"github.com/itsyouonline/identityserver/identityservice/invitations"
+	"github.com/itsyouonline/identityserver/identityservice/organization"
+	"github.com/itsyouonline/identityserver/identityservice/security"
+	"github.com/itsyouonline/identityserver/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingEmailService struct {
+	recipients []string
+}
+
+func (s *recordingEmailService) Send(recipients []string, subject string, text string, html string) error {
+	s.recipients = append(s.recipients, recipients...)
+	return nil
+}
+
+// testDirectory serves the SCIM api on the memory backend for the organization acme with the suborganization acme.dev.
+// owner owns acme, alice is a member of acme and bob of acme.dev, carol is not in the tree.
+type testDirectory struct {
+	t       *testing.T
+	handler http.Handler
+	r       *http.Request
+	key     *ecdsa.PrivateKey
+	emails  *recordingEmailService
+}
+
+func newTestDirectory(t *testing.T) (*testDirectory, func()) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := security.JWTPublicKey
+	security.JWTPublicKey = &key.PublicKey
+
+	backend := db.NewMemoryBackend()
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userMgr := user.NewManager(r)
+	valMgr := validationdb.NewManager(r)
+	for _, username := range []string{"owner", "alice", "bob", "carol"} {
+		assert.NoError(t, userMgr.Save(&user.User{Username: username}))
+		assert.NoError(t, valMgr.SaveValidatedEmailAddress(&validationdb.ValidatedEmailAddress{Username: username, EmailAddress: username + "@example.com"}))
+	}
+	orgMgr := organizationdb.NewManager(r)
+	assert.NoError(t, orgMgr.Create(&organizationdb.Organization{Globalid: "acme", Owners: []string{"owner"}, Members: []string{"alice"}}))
+	assert.NoError(t, orgMgr.Create(&organizationdb.Organization{Globalid: "acme.dev", Owners: []string{}, Members: []string{"bob"}}))
+	assert.NoError(t, orgMgr.Create(&organizationdb.Organization{Globalid: "other", Owners: []string{"carol"}, Members: []string{}}))
+
+	emails := &recordingEmailService{}
+	api := API{Organizations: organization.OrganizationsAPI{
+		EmailAddressValidationService: &validation.IYOEmailAddressValidationService{EmailService: emails},
+	}}
+	router := mux.NewRouter()
+	SCIMInterfaceRoutes(router, api)
+	d := &testDirectory{t: t, handler: db.DBMiddleware(backend)(router), r: r, key: key, emails: emails}
+	return d, func() {
+		release()
+		security.JWTPublicKey = publicKey
+	}
+}
+
+// token returns a client credentials JWT of an organization
+func (d *testDirectory) token(claims map[string]interface{}) string {
+	token := jwt.New(jwt.SigningMethodES384)
+	token.Claims["azp"] = "acme"
+	token.Claims["globalid"] = "acme"
+	token.Claims["scope"] = []string{requiredScope}
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iss"] = "itsyouonline"
+	for claim, value := range claims {
+		token.Claims[claim] = value
+	}
+	signed, err := token.SignedString(d.key)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	return signed
+}
+
+func (d *testDirectory) do(method, path, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	d.handler.ServeHTTP(w, request)
+	return w
+}
+
+func (d *testDirectory) pendingInvitations(globalID string) []invitations.JoinOrganizationInvitation {
+	pending, err := invitations.NewInvitationManager(d.r).FilterByOrganization(globalID, string(invitations.RequestPending))
+	assert.NoError(d.t, err)
+	return pending
+}
+
+func (d *testDirectory) organization(globalID string) *organizationdb.Organization {
+	org, err := organizationdb.NewManager(d.r).GetByName(globalID)
+	assert.NoError(d.t, err)
+	return org
+}
+
+func TestOrganizationTokenMiddleware(t *testing.T) {
+	d, cleanup := newTestDirectory(t)
+	defer cleanup()
+
+	testCases := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{name: "no token", path: "/scim/v2/acme/Groups", token: "", status: http.StatusUnauthorized},
+		{name: "unknown opaque token", path: "/scim/v2/acme/Groups", token: "unknown", status: http.StatusUnauthorized},
+		{name: "organization token", path: "/scim/v2/acme/Groups", token: d.token(nil), status: http.StatusOK},
+		{name: "parent organization token", path: "/scim/v2/acme.dev/Groups", token: d.token(nil), status: http.StatusOK},
+		{name: "other organization", path: "/scim/v2/other/Groups", token: d.token(nil), status: http.StatusForbidden},
+		{name: "suborganization token", path: "/scim/v2/acme/Groups", token: d.token(map[string]interface{}{"globalid": "acme.dev"}), status: http.StatusForbidden},
+		{name: "user token", path: "/scim/v2/acme/Groups", token: d.token(map[string]interface{}{"username": "alice"}), status: http.StatusForbidden},
+		{name: "missing scope", path: "/scim/v2/acme/Groups", token: d.token(map[string]interface{}{"scope": []string{"user:name"}}), status: http.StatusForbidden},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.status, d.do("GET", testCase.path, testCase.token, "").Code, testCase.name)
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	d, cleanup := newTestDirectory(t)
+	defer cleanup()
+	token := d.token(nil)
+
+	w := d.do("POST", "/scim/v2/acme/Users", token, `{"userName": "carol"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the userName of the client is not an ItsYou.online username")
+	assert.Empty(t, d.pendingInvitations("acme"))
+
+	w = d.do("POST", "/scim/v2/acme/Users", token, `{"userName": "carol", "emails": [{"value": "carol@example.com", "primary": true}]}`)
+	if assert.Equal(t, http.StatusCreated, w.Code) {
+		u := User{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&u))
+		assert.Equal(t, "carol", u.ID, "the validated email address is resolved to its user")
+		assert.False(t, u.Active)
+	}
+	assert.Equal(t, []string{"carol@example.com"}, d.emails.recipients)
+	if pending := d.pendingInvitations("acme"); assert.Len(t, pending, 1) {
+		assert.Equal(t, "carol", pending[0].User)
+	}
+
+	w = d.do("POST", "/scim/v2/acme/Users", token, `{"emails": [{"value": "carol@example.com"}]}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = d.do("POST", "/scim/v2/acme/Users", token, `{"emails": [{"value": "alice@example.com"}]}`)
+	assert.Equal(t, http.StatusConflict, w.Code, "alice is already a member")
+}
+
+func TestListUsers(t *testing.T) {
+	d, cleanup := newTestDirectory(t)
+	defer cleanup()
+	token := d.token(nil)
+
+	list := func(query string) ListResponse {
+		w := d.do("GET", "/scim/v2/acme/Users?"+query, token, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		response := ListResponse{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return response
+	}
+	page := list("startIndex=2&count=1")
+	assert.Equal(t, 3, page.TotalResults)
+	if assert.Len(t, page.Resources, 1) {
+		u := page.Resources[0].(map[string]interface{})
+		assert.Equal(t, "bob", u["id"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"value": "bob@example.com", "primary": true}}, u["emails"], "the contacts of the page are loaded")
+	}
+
+	filtered := list("filter=" + url.QueryEscape(`emails eq "owner@example.com"`))
+	if assert.Equal(t, 1, filtered.TotalResults) {
+		assert.Equal(t, "owner", filtered.Resources[0].(map[string]interface{})["id"])
+	}
+}
+
+func TestPatchGroup(t *testing.T) {
+	d, cleanup := newTestDirectory(t)
+	defer cleanup()
+	token := d.token(nil)
+	patch := func(group, operations string) int {
+		return d.do("PATCH", "/scim/v2/acme/Groups/"+group, token, `{"schemas": ["`+SchemaPatchOp+`"], "Operations": `+operations+`}`).Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, patch("acme.dev", `[{"op": "add", "path": "members", "value": [{"value": "carol"}]}]`),
+		"users outside the tree are not invited by username")
+	assert.Empty(t, d.pendingInvitations("acme.dev"))
+
+	assert.Equal(t, http.StatusOK, patch("acme.dev", `[{"op": "add", "path": "members", "value": [{"value": "carol@example.com"}, {"value": "alice"}]}]`))
+	invited := []string{}
+	for _, invitation := range d.pendingInvitations("acme.dev") {
+		invited = append(invited, invitation.User)
+	}
+	assert.Equal(t, []string{"carol"}, invited, "alice is a member of the parent organization and joins right away")
+	assert.Contains(t, d.organization("acme.dev").Members, "alice")
+
+	assert.Equal(t, http.StatusOK, patch("acme.dev", `[{"op": "remove", "path": "members[value eq \"bob@example.com\"]"}]`))
+	assert.NotContains(t, d.organization("acme.dev").Members, "bob")
+	assert.Equal(t, http.StatusOK, patch("acme.dev", `[{"op": "remove", "path": "members", "value": [{"value": "carol"}]}]`))
+	assert.Empty(t, d.pendingInvitations("acme.dev"), "the invitation of a removed user is removed")
+
+	assert.Equal(t, http.StatusOK, patch("acme.dev", `[{"op": "replace", "path": "members", "value": []}]`))
+	assert.Empty(t, d.organization("acme.dev").Members)
+
+	assert.Equal(t, http.StatusConflict, patch("acme", `[{"op": "replace", "path": "members", "value": []}]`), "the owners of the root can not be removed")
+	assert.Equal(t, []string{"owner"}, d.organization("acme").Owners)
+	assert.Equal(t, []string{"alice"}, d.organization("acme").Members, "nothing is removed when the request is refused")
+}
+
+func TestDeactivateUser(t *testing.T) {
+	d, cleanup := newTestDirectory(t)
+	defer cleanup()
+	token := d.token(nil)
+
+	w := d.do("PATCH", "/scim/v2/acme/Users/owner", token, `{"Operations": [{"op": "replace", "path": "active", "value": false}]}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, http.StatusConflict, d.do("DELETE", "/scim/v2/acme/Users/owner", token, "").Code)
+
+	w = d.do("PATCH", "/scim/v2/acme/Users/alice@example.com", token, `{"Operations": [{"op": "replace", "value": {"active": "False"}}]}`)
+	if assert.Equal(t, http.StatusOK, w.Code) {
+		u := User{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&u))
+		assert.Equal(t, "alice", u.ID)
+		assert.False(t, u.Active)
+	}
+	assert.Empty(t, d.organization("acme").Members)
+
+	assert.Equal(t, http.StatusNoContent, d.do("DELETE", "/scim/v2/acme/Users/bob", token, "").Code)
+	assert.Empty(t, d.organization("acme.dev").Members)
+	assert.Equal(t, http.StatusNotFound, d.do("GET", "/scim/v2/acme/Users/bob", token, "").Code)
+}
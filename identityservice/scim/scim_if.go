@@ -0,0 +1,53 @@
+package scim
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+)
+
+// SCIMInterface is interface for the /scim/v2/{globalid} endpoints
+type SCIMInterface interface {
+	// GetServiceProviderConfig is the handler for GET /scim/v2/{globalid}/ServiceProviderConfig
+	GetServiceProviderConfig(w http.ResponseWriter, r *http.Request)
+	// GetResourceTypes is the handler for GET /scim/v2/{globalid}/ResourceTypes
+	GetResourceTypes(w http.ResponseWriter, r *http.Request)
+	// ListUsers is the handler for GET /scim/v2/{globalid}/Users
+	// Lists the members and owners of the organization and its suborganizations and the invited users
+	ListUsers(w http.ResponseWriter, r *http.Request)
+	// CreateUser is the handler for POST /scim/v2/{globalid}/Users
+	// Invites a user to become a member of the organization
+	CreateUser(w http.ResponseWriter, r *http.Request)
+	// GetUser is the handler for GET /scim/v2/{globalid}/Users/{id}
+	GetUser(w http.ResponseWriter, r *http.Request)
+	// PatchUser is the handler for PATCH /scim/v2/{globalid}/Users/{id}
+	// Deactivating a user removes it from the organization and its suborganizations
+	PatchUser(w http.ResponseWriter, r *http.Request)
+	// DeleteUser is the handler for DELETE /scim/v2/{globalid}/Users/{id}
+	// Removes a user from the organization and its suborganizations
+	DeleteUser(w http.ResponseWriter, r *http.Request)
+	// ListGroups is the handler for GET /scim/v2/{globalid}/Groups
+	// Lists the organization and its suborganizations
+	ListGroups(w http.ResponseWriter, r *http.Request)
+	// GetGroup is the handler for GET /scim/v2/{globalid}/Groups/{id}
+	GetGroup(w http.ResponseWriter, r *http.Request)
+	// PatchGroup is the handler for PATCH /scim/v2/{globalid}/Groups/{id}
+	// Adds or removes members of an organization
+	PatchGroup(w http.ResponseWriter, r *http.Request)
+}
+
+// SCIMInterfaceRoutes is routing for the /scim/v2/{globalid} endpoints
+func SCIMInterfaceRoutes(r *mux.Router, i SCIMInterface) {
+	chain := alice.New((&OrganizationTokenMiddleware{}).Handler)
+	r.Handle("/scim/v2/{globalid}/ServiceProviderConfig", chain.Then(http.HandlerFunc(i.GetServiceProviderConfig))).Methods("GET")
+	r.Handle("/scim/v2/{globalid}/ResourceTypes", chain.Then(http.HandlerFunc(i.GetResourceTypes))).Methods("GET")
+	r.Handle("/scim/v2/{globalid}/Users", chain.Then(http.HandlerFunc(i.ListUsers))).Methods("GET")
+	r.Handle("/scim/v2/{globalid}/Users", chain.Then(http.HandlerFunc(i.CreateUser))).Methods("POST")
+	r.Handle("/scim/v2/{globalid}/Users/{id}", chain.Then(http.HandlerFunc(i.GetUser))).Methods("GET")
+	r.Handle("/scim/v2/{globalid}/Users/{id}", chain.Then(http.HandlerFunc(i.PatchUser))).Methods("PATCH")
+	r.Handle("/scim/v2/{globalid}/Users/{id}", chain.Then(http.HandlerFunc(i.DeleteUser))).Methods("DELETE")
+	r.Handle("/scim/v2/{globalid}/Groups", chain.Then(http.HandlerFunc(i.ListGroups))).Methods("GET")
+	r.Handle("/scim/v2/{globalid}/Groups/{id}", chain.Then(http.HandlerFunc(i.GetGroup))).Methods("GET")
+	r.Handle("/scim/v2/{globalid}/Groups/{id}", chain.Then(http.HandlerFunc(i.PatchGroup))).Methods("PATCH")
+}
@@ -4,43 +4,33 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/itsyouonline/identityserver/db/persistentlog"
-	"github.com/itsyouonline/identityserver/db/registration"
-
-	"github.com/itsyouonline/identityserver/db/grants"
-
 	"github.com/gorilla/mux"
 
 	"github.com/itsyouonline/identityserver/db"
-	companydb "github.com/itsyouonline/identityserver/db/company"
-	contractdb "github.com/itsyouonline/identityserver/db/contract"
-	"github.com/itsyouonline/identityserver/db/iyoid"
-	"github.com/itsyouonline/identityserver/db/keystore"
 	organizationdb "github.com/itsyouonline/identityserver/db/organization"
-	"github.com/itsyouonline/identityserver/db/see"
 	userdb "github.com/itsyouonline/identityserver/db/user"
 	validationdb "github.com/itsyouonline/identityserver/db/validation"
 	"github.com/itsyouonline/identityserver/globalconfig"
 	"github.com/itsyouonline/identityserver/identityservice/company"
 	"github.com/itsyouonline/identityserver/identityservice/contract"
 	"github.com/itsyouonline/identityserver/identityservice/organization"
+	"github.com/itsyouonline/identityserver/identityservice/scim"
 	"github.com/itsyouonline/identityserver/identityservice/user"
 	"github.com/itsyouonline/identityserver/identityservice/userorganization"
 
+	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/base64"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/itsyouonline/identityserver/communication"
-	"github.com/itsyouonline/identityserver/credentials/password"
-	"github.com/itsyouonline/identityserver/credentials/totp"
-	"github.com/itsyouonline/identityserver/db/registry"
 	"github.com/itsyouonline/identityserver/identityservice/invitations"
 	"github.com/itsyouonline/identityserver/validation"
 )
 
 //Service is the identityserver http service
 type Service struct {
+	jwtSigningKey                *ecdsa.PrivateKey
 	smsService                   communication.SMSService
 	emailService                 communication.EmailService
 	phonenumberValidationService *validation.IYOPhonenumberValidationService
@@ -57,23 +47,26 @@ func NewService(smsService communication.SMSService, emailService communication.
 	return
 }
 
+//SetJWTSigningKey sets the key used to sign the data exports, it needs to be set before the routes are added
+func (service *Service) SetJWTSigningKey(key *ecdsa.PrivateKey) {
+	service.jwtSigningKey = key
+}
+
+//ExportData creates the archives of the data exports in the background until stop is closed, the signing key needs to be set
+func (service *Service) ExportData(backend db.Backend, stop <-chan struct{}) {
+	user.ExportData(backend, service.jwtSigningKey, service.emailaddresValidationService, stop)
+}
+
 //AddRoutes registers the http routes with the router.
 func (service *Service) AddRoutes(router *mux.Router) {
 	// User API
-	user.UsersInterfaceRoutes(router, user.UsersAPI{SmsService: service.smsService, PhonenumberValidationService: service.phonenumberValidationService, EmailService: service.emailService, EmailAddressValidationService: service.emailaddresValidationService})
-	userdb.InitModels()
-	totp.InitModels()
-	see.InitModels()
-	iyoid.InitModels()
-	grants.InitModels()
+	user.UsersInterfaceRoutes(router, user.UsersAPI{SmsService: service.smsService, PhonenumberValidationService: service.phonenumberValidationService, EmailService: service.emailService, EmailAddressValidationService: service.emailaddresValidationService, JWTSigningKey: service.jwtSigningKey})
 
 	// Company API
 	company.CompaniesInterfaceRoutes(router, company.CompaniesAPI{})
-	companydb.InitModels()
 
 	//contracts API
 	contract.ContractsInterfaceRoutes(router, contract.ContractsAPI{})
-	contractdb.InitModels()
 
 	// Organization API
 	organization.OrganizationsInterfaceRoutes(router, organization.OrganizationsAPI{
@@ -81,24 +74,12 @@ func (service *Service) AddRoutes(router *mux.Router) {
 		PhonenumberValidationService:  service.phonenumberValidationService,
 	})
 	userorganization.UsersusernameorganizationsInterfaceRoutes(router, userorganization.UsersusernameorganizationsAPI{})
-	organizationdb.InitModels()
-
-	// Initialize Validation models
-	validationdb.InitModels()
-
-	// Initialize Password models
-	password.InitModels()
-
-	// Initialize registry models
-	registry.InitModels()
-
-	// Initialize keystore models
-	keystore.InitModels()
-
-	// Initialize registration models
-	registration.InitModels()
 
-	persistentlog.InitModels()
+	// SCIM API
+	scim.SCIMInterfaceRoutes(router, scim.API{Organizations: organization.OrganizationsAPI{
+		EmailAddressValidationService: service.emailaddresValidationService,
+		PhonenumberValidationService:  service.phonenumberValidationService,
+	}})
 }
 
 func generateRandomBytes(n int) ([]byte, error) {
@@ -121,40 +102,49 @@ func generateCookieSecret(s int) (string, error) {
 
 // GetCookieSecret gets the cookie secret from mongodb if it exists otherwise, generate a new one and save it
 func GetCookieSecret() string {
-	session := db.GetSession()
-	defer session.Close()
+	secret := getSecret("cookieSecret")
+
+	log.Debug("Cookie secret: ", secret)
+
+	return secret
+}
 
+// GetMagicLinkSecret gets the secret the login links are signed with like GetCookieSecret.
+// It is not the cookie secret, so one of them leaking does not allow forging the other.
+func GetMagicLinkSecret() string {
+	return getSecret("magicLinkSecret")
+}
+
+// getSecret gets a secret from the global config, or generates and saves one if it does not exist yet
+func getSecret(key string) string {
 	config := globalconfig.NewManager()
-	globalconfig.InitModels()
 
-	cookie, err := config.GetByKey("cookieSecret")
+	secretModel, err := config.GetByKey(key)
 	if err != nil {
-		log.Debug("No cookie secret found, generating a new one")
+		log.Debug("No ", key, " found, generating a new one")
 
 		secret, err := generateCookieSecret(32)
 
 		if err != nil {
-			log.Panic("Cannot generate secret cookie")
+			log.Panic("Cannot generate ", key)
 		}
 
-		cookie.Key = "cookieSecret"
-		cookie.Value = secret
+		secretModel.Key = key
+		secretModel.Value = secret
 
-		err = config.Insert(cookie)
+		err = config.Insert(secretModel)
 
 		// Key was inserted by another instance in the meantime
 		if db.IsDup(err) {
-			cookie, err = config.GetByKey("cookieSecret")
+			secretModel, err = config.GetByKey(key)
 
 			if err != nil {
-				log.Panic("Cannot retreive cookie secret")
+				log.Panic("Cannot retreive ", key)
 			}
 		}
 	}
 
-	log.Debug("Cookie secret: ", cookie.Value)
-
-	return cookie.Value
+	return secretModel.Value
 }
 
 //FilterAuthorizedScopes filters the requested scopes to the ones that are authorizated, if no authorization exists, authorizedScops is nil
@@ -227,11 +217,7 @@ func (service *Service) FilterPossibleScopes(r *http.Request, username string, r
 
 // GetOauthSecret gets the oauth secret from mongodb for a specified service. If it doesn't exist, an error gets logged.
 func GetOauthSecret(service string) (string, error) {
-	session := db.GetSession()
-	defer session.Close()
-
 	config := globalconfig.NewManager()
-	globalconfig.InitModels()
 	secretModel, err := config.GetByKey(service + "-secret")
 	if err != nil {
 		log.Errorf("No Oauth secret found for %s. Please insert it into the collection globalconfig with key %s-secret",
@@ -242,11 +228,7 @@ func GetOauthSecret(service string) (string, error) {
 
 // GetOauthClientID gets the oauth secret from mongodb for a specified service. If it doesn't exist, an error gets logged.
 func GetOauthClientID(service string) (string, error) {
-	session := db.GetSession()
-	defer session.Close()
-
 	config := globalconfig.NewManager()
-	globalconfig.InitModels()
 
 	clientIDModel, err := config.GetByKey(service + "-clientid")
 	log.Warn(clientIDModel.Value)
@@ -289,7 +271,7 @@ func userHasOrgInvitation(globalid string, username string, r *http.Request) (bo
 	return false, nil
 }
 
-func isPartOfOrgTree(globalId string, username string, orgMgr *organizationdb.Manager) (bool, error) {
+func isPartOfOrgTree(globalId string, username string, orgMgr organizationdb.Manager) (bool, error) {
 	orgs := make([]string, 0)
 	// Don't include the parent org in the checks because the caller has already verified
 	// that the user is not a member or owner there
@@ -0,0 +1,168 @@
+package user
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/credentials/password"
+	"github.com/itsyouonline/identityserver/credentials/totp"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/audit"
+	"github.com/itsyouonline/identityserver/db/dataexport"
+	"github.com/itsyouonline/identityserver/db/grants"
+	"github.com/itsyouonline/identityserver/db/iyoid"
+	"github.com/itsyouonline/identityserver/db/keystore"
+	organizationDb "github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/persistentlog"
+	"github.com/itsyouonline/identityserver/db/registry"
+	seeDb "github.com/itsyouonline/identityserver/db/see"
+	"github.com/itsyouonline/identityserver/db/smshistory"
+	"github.com/itsyouonline/identityserver/db/user"
+	"github.com/itsyouonline/identityserver/db/user/apikey"
+	validationdb "github.com/itsyouonline/identityserver/db/validation"
+	"github.com/itsyouonline/identityserver/identityservice/invitations"
+	"github.com/itsyouonline/identityserver/oauthservice"
+)
+
+const (
+	// DeletionGracePeriod is the time a user has to restore an account after requesting its deletion
+	DeletionGracePeriod = 30 * 24 * time.Hour
+	// DeletionPurgeInterval is the interval at which the accounts of which the grace period has passed are deleted
+	DeletionPurgeInterval = time.Hour
+	// deletionPostponement is the time a deletion is postponed when the user became the last owner of an organization
+	deletionPostponement = 24 * time.Hour
+)
+
+// PurgeDeletedUsers deletes the accounts of which the deletion grace period has passed and returns how many were deleted.
+// A user that could not be deleted is retried on the next run, the run stops when the context of r is cancelled.
+func PurgeDeletedUsers(r *http.Request) (deleted int, err error) {
+	userMgr := user.NewManager(r)
+	usernames, err := userMgr.GetScheduledForDeletion(time.Now())
+	if err != nil {
+		return
+	}
+	for _, username := range usernames {
+		if r.Context().Err() != nil {
+			return deleted, r.Context().Err()
+		}
+		// The user might have become the last owner of an organization during the grace period
+		lastOwnerOf, err := organizationDb.NewManager(r).LastOwnerOf(username)
+		if err != nil {
+			log.Error("Failed to check the organizations owned by ", username, ": ", err)
+			continue
+		}
+		if len(lastOwnerOf) > 0 {
+			log.Warnf("Postponing the deletion of %s, the user is the last owner of %v", username, lastOwnerOf)
+			if err = userMgr.ScheduleDeletion(username, time.Now().Add(deletionPostponement)); err != nil {
+				log.Error("Failed to postpone the deletion of ", username, ": ", err)
+			}
+			continue
+		}
+		if err = DeleteUserData(r, username); err != nil {
+			log.Error("Failed to delete ", username, ": ", err)
+			continue
+		}
+		log.Info("Deleted user ", username)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// DeleteUserData removes a user and everything that is stored about the user.
+// The user document is removed last so a failed deletion is retried on the next purge.
+func DeleteUserData(r *http.Request, username string) (err error) {
+	userMgr := user.NewManager(r)
+	userobj, err := userMgr.GetByName(username)
+	if err != nil {
+		return
+	}
+
+	// The organizations and their webhooks are told the user left, like when the user is removed by hand
+	orgMgr := organizationDb.NewManager(r)
+	organizations, err := orgMgr.AllByUser(username)
+	if err != nil {
+		return
+	}
+	if err = orgMgr.RemoveUserFromAll(username); err != nil {
+		return
+	}
+	for _, org := range organizations {
+		role := "member"
+		for _, owner := range org.Owners {
+			if owner == username {
+				role = "owner"
+			}
+		}
+		audit.Record(r, audit.Event{Action: audit.ActionMemberRemoved, Subject: username, Organization: org.Globalid, Detail: role})
+	}
+	if err = organizationDb.NewLast2FAManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = invitations.NewInvitationManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = grants.NewManager(r).DeleteAllUserGrants(username); err != nil {
+		return
+	}
+	if err = oauthservice.NewManager(r).RemoveTokensByUser(username); err != nil {
+		return
+	}
+	authorizations, err := userMgr.GetAuthorizationsByUser(username)
+	if err != nil {
+		return
+	}
+	if err = userMgr.DeleteAuthorizationsByUser(username); err != nil {
+		return
+	}
+	for _, authorization := range authorizations {
+		audit.Record(r, audit.Event{Action: audit.ActionAuthorizationRemoved, Subject: username, Organization: authorization.GrantedTo})
+	}
+	if err = dataexport.NewManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = apikey.NewManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = keystore.NewManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = seeDb.NewManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = registry.NewManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = iyoid.NewManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = validationdb.NewManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = totp.NewManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = password.NewManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	if err = persistentlog.NewManager(r).RemoveByUser(username); err != nil {
+		return
+	}
+	phonenumbers := make([]string, 0, len(userobj.Phonenumbers))
+	for _, phonenumber := range userobj.Phonenumbers {
+		phonenumbers = append(phonenumbers, phonenumber.Phonenumber)
+	}
+	if err = smshistory.NewManager(r).RemoveByPhonenumbers(phonenumbers); err != nil {
+		return
+	}
+	for _, avatar := range userobj.Avatars {
+		if !strings.Contains(avatar.Source, AvatarFilePath) {
+			continue
+		}
+		if err = userMgr.RemoveAvatarFile(getAvatarHashFromLink(avatar.Source)); err != nil && !db.IsNotFound(err) {
+			return
+		}
+	}
+	return userMgr.Delete(userobj)
+}
@@ -0,0 +1,60 @@
+package user
+
+import (
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/audit"
+	organizationDb "github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/persistentlog"
+	"github.com/itsyouonline/identityserver/db/smshistory"
+	"github.com/itsyouonline/identityserver/db/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	release, err := db.OpenBackend(db.NewMemoryBackend(), r)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+
+	userMgr := user.NewManager(r)
+	alice := &user.User{Username: "alice", Phonenumbers: []user.Phonenumber{{Label: "main", Phonenumber: "+32123456789"}}}
+	assert.NoError(t, userMgr.Save(alice))
+	assert.NoError(t, userMgr.ScheduleDeletion("alice", time.Now().Add(-time.Minute)))
+	assert.NoError(t, userMgr.Save(&user.User{Username: "bob"}))
+	assert.NoError(t, userMgr.ScheduleDeletion("bob", time.Now().Add(time.Hour)))
+	assert.NoError(t, smshistory.NewManager(r).AddSMSHistory(&smshistory.SmsHistory{Phonenumber: "+32123456789", CreatedAt: time.Now()}))
+	assert.NoError(t, persistentlog.NewManager(r).SaveLog(persistentlog.New("key", persistentlog.RegistrationFlow, "Registration finished, user created")))
+	assert.NoError(t, persistentlog.NewManager(r).SetUsername("key", "alice"))
+	assert.NoError(t, organizationDb.NewManager(r).Create(&organizationDb.Organization{Globalid: "acme", Owners: []string{"bob"}, Members: []string{"alice"}}))
+	assert.NoError(t, userMgr.UpdateAuthorization(&user.Authorization{Username: "alice", GrantedTo: "acme"}))
+
+	deleted, err := PurgeDeletedUsers(r)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	_, err = userMgr.GetByName("alice")
+	assert.True(t, db.IsNotFound(err))
+	_, err = userMgr.GetByName("bob")
+	assert.NoError(t, err, "the grace period of bob has not passed yet")
+	history, err := smshistory.NewManager(r).GetByPhonenumbers([]string{"+32123456789"})
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+
+	events, err := audit.NewManager(r).ListByOrganization("acme", audit.Query{})
+	assert.NoError(t, err)
+	actions := []string{}
+	for _, event := range events {
+		assert.Equal(t, "alice", event.Subject)
+		actions = append(actions, event.Action+" "+event.Detail)
+	}
+	sort.Strings(actions)
+	assert.Equal(t, []string{audit.ActionAuthorizationRemoved + " ", audit.ActionMemberRemoved + " member"}, actions,
+		"the organization is told the user left")
+}
@@ -0,0 +1,263 @@
+package user
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itsyouonline/identityserver/credentials/totp"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/dataexport"
+	"github.com/itsyouonline/identityserver/db/grants"
+	"github.com/itsyouonline/identityserver/db/iyoid"
+	"github.com/itsyouonline/identityserver/db/keystore"
+	organizationDb "github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/registry"
+	seeDb "github.com/itsyouonline/identityserver/db/see"
+	"github.com/itsyouonline/identityserver/db/smshistory"
+	"github.com/itsyouonline/identityserver/db/user"
+	"github.com/itsyouonline/identityserver/db/user/apikey"
+	validationdb "github.com/itsyouonline/identityserver/db/validation"
+	"github.com/itsyouonline/identityserver/identityservice/invitations"
+	"github.com/itsyouonline/identityserver/validation"
+)
+
+const (
+	// DataExportValidity is the time a data export can be downloaded
+	DataExportValidity      = 7 * 24 * time.Hour
+	dataExportDataFile      = "data.json"
+	dataExportSignatureFile = "signature.jwt"
+	// dataExportInterval is how often the pending data exports are checked
+	dataExportInterval = 5 * time.Second
+	// dataExportTimeout is how long an instance gets to create an archive before another instance retries it
+	dataExportTimeout = 10 * time.Minute
+	// dataExportAttempts is the number of times an export is tried before it fails
+	dataExportAttempts = 3
+	// dataExportBatchSize is the number of exports claimed at once
+	dataExportBatchSize = 5
+)
+
+// dataExportStale checks if a pending export can no longer become ready, like an export that was requested
+// before the exports were claimed and of which the instance creating it stopped
+func dataExportStale(export *dataexport.DataExport) bool {
+	return export.Status == dataexport.StatusPending && time.Since(export.CreatedAt) > dataExportAttempts*dataExportTimeout
+}
+
+// userData contains everything that is stored about a user
+type userData struct {
+	User                     *user.User                               `json:"user"`
+	AuthenticatorApplication bool                                     `json:"authenticatorapplication"`
+	ValidatedEmailAddresses  []validationdb.ValidatedEmailAddress     `json:"validatedemailaddresses"`
+	ValidatedPhonenumbers    []validationdb.ValidatedPhonenumber      `json:"validatedphonenumbers"`
+	Organizations            []organizationMembership                 `json:"organizations"`
+	Invitations              []invitations.JoinOrganizationInvitation `json:"invitations"`
+	Authorizations           []user.Authorization                     `json:"authorizations"`
+	Grants                   []grants.SavedGrants                     `json:"grants"`
+	APIKeys                  []exportedAPIKey                         `json:"apikeys"`
+	KeyStore                 []keystore.KeyStoreKey                   `json:"keystore"`
+	See                      []seeDb.See                              `json:"see"`
+	Registry                 []registry.RegistryEntry                 `json:"registry"`
+	IyoIDs                   []iyoid.Identifier                       `json:"iyoids"`
+	SMSHistory               []smshistory.SmsHistory                  `json:"smshistory"`
+}
+
+type organizationMembership struct {
+	Globalid string `json:"globalid"`
+	Role     string `json:"role"`
+}
+
+// exportedAPIKey is an api key without its secret
+type exportedAPIKey struct {
+	Label         string   `json:"label"`
+	ApplicationID string   `json:"applicationid"`
+	Scopes        []string `json:"scopes"`
+}
+
+// collectUserData collects everything that is stored about a user through the managers
+func collectUserData(r *http.Request, username string) (data *userData, err error) {
+	data = &userData{}
+	if data.User, err = user.NewManager(r).GetByName(username); err != nil {
+		return
+	}
+	if data.AuthenticatorApplication, err = totp.NewManager(r).HasTOTP(username); err != nil {
+		return
+	}
+	valMgr := validationdb.NewManager(r)
+	if data.ValidatedEmailAddresses, err = valMgr.GetByUsernameValidatedEmailAddress(username); err != nil {
+		return
+	}
+	if data.ValidatedPhonenumbers, err = valMgr.GetByUsernameValidatedPhonenumbers(username); err != nil {
+		return
+	}
+	organizations, err := organizationDb.NewManager(r).AllByUser(username)
+	if err != nil {
+		return
+	}
+	for _, org := range organizations {
+		role := invitations.RoleMember
+		if exists(username, org.Owners) {
+			role = invitations.RoleOwner
+		}
+		data.Organizations = append(data.Organizations, organizationMembership{Globalid: org.Globalid, Role: role})
+	}
+	if data.Invitations, err = invitations.NewInvitationManager(r).GetByUser(username); err != nil {
+		return
+	}
+	if data.Authorizations, err = user.NewManager(r).GetAuthorizationsByUser(username); err != nil {
+		return
+	}
+	if data.Grants, err = grants.NewManager(r).GetByUser(username); err != nil {
+		return
+	}
+	apikeys, err := apikey.NewManager(r).GetByUser(username)
+	if err != nil {
+		return
+	}
+	for _, key := range apikeys {
+		data.APIKeys = append(data.APIKeys, exportedAPIKey{Label: key.Label, ApplicationID: key.ApplicationID, Scopes: key.Scopes})
+	}
+	if data.KeyStore, err = keystore.NewManager(r).ListByUser(username); err != nil {
+		return
+	}
+	if data.See, err = seeDb.NewManager(r).GetSeeObjects(username); err != nil {
+		return
+	}
+	if data.Registry, err = registry.NewManager(r).ListRegistryEntries(username, ""); err != nil {
+		return
+	}
+	if data.IyoIDs, err = iyoid.NewManager(r).GetByUsername(username); err != nil {
+		return
+	}
+	phonenumbers := []string{}
+	for _, phonenumber := range data.User.Phonenumbers {
+		phonenumbers = append(phonenumbers, phonenumber.Phonenumber)
+	}
+	data.SMSHistory, err = smshistory.NewManager(r).GetByPhonenumbers(phonenumbers)
+	return
+}
+
+// createDataExportArchive creates a zip archive with the data and a jwt signed with the server key.
+// The jwt contains the sha256 hash of the data so the archive can be verified with the public key of the server.
+func createDataExportArchive(username string, data *userData, key *ecdsa.PrivateKey) ([]byte, error) {
+	serialized, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(serialized)
+
+	token := jwt.New(jwt.SigningMethodES384)
+	token.Claims["iss"] = "itsyouonline"
+	token.Claims["sub"] = username
+	token.Claims["iat"] = time.Now().Unix()
+	token.Claims["sha256"] = hex.EncodeToString(hash[:])
+	signature, err := token.SignedString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	archive := zip.NewWriter(buf)
+	for name, content := range map[string][]byte{dataExportDataFile: serialized, dataExportSignatureFile: []byte(signature)} {
+		f, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = f.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err = archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportData creates the archives of the pending data exports until stop is closed. Every instance runs it,
+// an export is claimed by one instance and retried by another one if the instance stops before the archive is ready.
+func ExportData(backend db.Backend, key *ecdsa.PrivateKey, emailService *validation.IYOEmailAddressValidationService, stop <-chan struct{}) {
+	ticker := time.NewTicker(dataExportInterval)
+	defer ticker.Stop()
+	for {
+		exportPending(backend, key, emailService)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// exportPending creates the archives of the pending exports that are not claimed by another instance
+func exportPending(backend db.Backend, key *ecdsa.PrivateKey, emailService *validation.IYOEmailAddressValidationService) {
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if err != nil {
+		log.Error("Failed to claim the data exports: ", err)
+		return
+	}
+	defer release()
+	exportMgr := dataexport.NewManager(r)
+	exports, err := exportMgr.ClaimPending(time.Now().Add(dataExportTimeout), dataExportBatchSize)
+	if err != nil {
+		log.Error("Failed to claim the data exports: ", err)
+	}
+	for i := range exports {
+		export := &exports[i]
+		if export.Attempts > dataExportAttempts {
+			log.Errorf("Giving up the data export of %s after %d attempts", export.Username, dataExportAttempts)
+			if err = exportMgr.SetFailed(export.ID); err != nil {
+				log.Error("Failed to mark the data export as failed: ", err)
+			}
+			continue
+		}
+		runDataExport(backend, export, key, emailService)
+	}
+}
+
+// runDataExport collects the data of a user and sends an email when the archive is ready
+func runDataExport(backend db.Backend, export *dataexport.DataExport, key *ecdsa.PrivateKey, emailService *validation.IYOEmailAddressValidationService) {
+	r, done, err := db.NewBackgroundRequest(backend, export.Host)
+	if err != nil {
+		log.Error("Failed to export the data of ", export.Username, ": ", err)
+		return
+	}
+	defer done()
+
+	exportMgr := dataexport.NewManager(r)
+	data, err := collectUserData(r, export.Username)
+	var archive []byte
+	if err == nil {
+		archive, err = createDataExportArchive(export.Username, data, key)
+	}
+	if err != nil {
+		log.Error("Failed to export the data of ", export.Username, ": ", err)
+		if err = exportMgr.SetFailed(export.ID); err != nil {
+			log.Error("Failed to mark the data export as failed: ", err)
+		}
+		return
+	}
+	if err = exportMgr.SetReady(export.ID, archive); err != nil {
+		log.Error("Failed to store the data export of ", export.Username, ": ", err)
+		return
+	}
+
+	emails := []string{}
+	for _, validated := range data.ValidatedEmailAddresses {
+		emails = append(emails, validated.EmailAddress)
+	}
+	if len(emails) == 0 {
+		log.Debug("No validated email address to notify ", export.Username, " of the data export")
+		return
+	}
+	link := fmt.Sprintf("https://%s/#/settings", export.Host)
+	if err = emailService.SendDataExportReadyEmail(r, export.Username, emails, link, export.Lang); err != nil {
+		log.Error("Failed to send the data export email: ", err)
+	}
+}
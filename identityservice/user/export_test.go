@@ -0,0 +1,105 @@
+package user
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/dataexport"
+	"github.com/itsyouonline/identityserver/db/user"
+	validationdb "github.com/itsyouonline/identityserver/db/validation"
+	"github.com/itsyouonline/identityserver/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateDataExportArchive(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+
+	data := &userData{User: &user.User{Username: "bob"}, APIKeys: []exportedAPIKey{{Label: "mykey"}}}
+	archive, err := createDataExportArchive("bob", data, key)
+	assert.NoError(t, err)
+
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	assert.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range reader.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		files[f.Name], err = ioutil.ReadAll(rc)
+		assert.NoError(t, err)
+		rc.Close()
+	}
+	assert.Len(t, files, 2)
+	assert.Contains(t, string(files[dataExportDataFile]), `"username": "bob"`)
+	assert.NotContains(t, string(files[dataExportDataFile]), `"apikey"`)
+
+	token, err := jwt.Parse(string(files[dataExportSignatureFile]), func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, token.Valid)
+	hash := sha256.Sum256(files[dataExportDataFile])
+	assert.Equal(t, hex.EncodeToString(hash[:]), token.Claims["sha256"])
+	assert.Equal(t, "bob", token.Claims["sub"])
+}
+
+type recordingEmailService struct {
+	recipients []string
+}
+
+func (s *recordingEmailService) Send(recipients []string, subject string, text string, html string) error {
+	s.recipients = append(s.recipients, recipients...)
+	return nil
+}
+
+func TestExportPending(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	backend := db.NewMemoryBackend()
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	assert.NoError(t, user.NewManager(r).Save(&user.User{Username: "bob"}))
+	assert.NoError(t, validationdb.NewManager(r).SaveValidatedEmailAddress(&validationdb.ValidatedEmailAddress{Username: "bob", EmailAddress: "bob@example.com"}))
+	exportMgr := dataexport.NewManager(r)
+	export := dataexport.New("bob", DataExportValidity, "itsyou.online", "en")
+	assert.NoError(t, exportMgr.Create(export))
+	abandoned := dataexport.New("bob", DataExportValidity, "itsyou.online", "en")
+	abandoned.Attempts = dataExportAttempts
+	assert.NoError(t, exportMgr.Create(abandoned))
+
+	emails := &recordingEmailService{}
+	exportPending(backend, key, &validation.IYOEmailAddressValidationService{EmailService: emails})
+
+	stored, err := exportMgr.Get("bob", export.ID.Hex())
+	if assert.NoError(t, err) {
+		assert.Equal(t, dataexport.StatusReady, stored.Status)
+		assert.NotEmpty(t, stored.Archive)
+	}
+	assert.Equal(t, []string{"bob@example.com"}, emails.recipients)
+	stored, err = exportMgr.Get("bob", abandoned.ID.Hex())
+	if assert.NoError(t, err) {
+		assert.Equal(t, dataexport.StatusFailed, stored.Status, "an export that was claimed too often fails")
+	}
+}
+
+func TestDataExportStale(t *testing.T) {
+	export := dataexport.New("bob", DataExportValidity, "itsyou.online", "en")
+	assert.False(t, dataExportStale(export))
+	export.CreatedAt = time.Now().Add(-dataExportAttempts*dataExportTimeout - time.Minute)
+	assert.True(t, dataExportStale(export), "a pending export that is not retried anymore is stale")
+	export.Status = dataexport.StatusReady
+	assert.False(t, dataExportStale(export))
+}
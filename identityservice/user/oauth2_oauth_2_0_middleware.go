@@ -50,8 +50,7 @@ func (om *Oauth2oauth_2_0Middleware) Handler(next http.Handler) http.Handler {
 			atscopestring = oauth2.GetScopestringFromJWT(token)
 
 		} else if accessToken != "" {
-			//TODO: cache
-			oauthMgr := oauthservice.NewManager(r)
+			oauthMgr := oauthservice.NewCachedManager(r)
 			at, err := oauthMgr.GetAccessToken(accessToken)
 			if err != nil {
 				log.Error(err)
@@ -103,8 +102,7 @@ func (om *Oauth2oauth_2_0Middleware) Handler(next http.Handler) http.Handler {
 
 		// atscopestring will be user:admin for user api keys, which is only valid if the api key is owned by the user being accessed off course
 		if !((protectedUsername == username && atscopestring == "user:admin") || (clientID == "itsyouonline" && atscopestring == "admin")) {
-			// todo: cache
-			userMgr := user.NewManager(r)
+			userMgr := user.NewCachedManager(r)
 			authorization, err := userMgr.GetAuthorization(protectedUsername, clientID)
 			if err != nil {
 				log.Error("Error while getting authorization: ", err)
@@ -0,0 +1,53 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserRegistryWithMemoryBackend(t *testing.T) {
+	api := UsersAPI{}
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{username}/registry", api.ListUserRegistry).Methods("GET")
+	router.HandleFunc("/users/{username}/registry", api.AddUserRegistryEntry).Methods("POST")
+	router.HandleFunc("/users/{username}/registry/{key}", api.GetUserRegistryEntry).Methods("GET")
+	router.HandleFunc("/users/{username}/registry/{key}", api.DeleteUserRegistryEntry).Methods("DELETE")
+	server := httptest.NewServer(db.DBMiddleware(db.NewMemoryBackend())(router))
+	defer server.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		assert.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := do("POST", "/users/alice/registry", `{"Key": "color", "Value": "blue"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = do("GET", "/users/alice/registry/color", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	entry := registry.RegistryEntry{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&entry))
+	assert.Equal(t, "blue", entry.Value)
+
+	resp = do("GET", "/users/bob/registry/color", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do("DELETE", "/users/alice/registry/color", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = do("GET", "/users/alice/registry", "")
+	entries := []registry.RegistryEntry{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	assert.Empty(t, entries)
+}
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"crypto/ecdsa"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -17,8 +18,11 @@ import (
 	"github.com/itsyouonline/identityserver/credentials/oauth2"
 	"github.com/itsyouonline/identityserver/credentials/password"
 	"github.com/itsyouonline/identityserver/credentials/totp"
+	"github.com/itsyouonline/identityserver/credentials/upstream"
 	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/audit"
 	contractdb "github.com/itsyouonline/identityserver/db/contract"
+	"github.com/itsyouonline/identityserver/db/dataexport"
 	"github.com/itsyouonline/identityserver/db/iyoid"
 	"github.com/itsyouonline/identityserver/db/keystore"
 	organizationDb "github.com/itsyouonline/identityserver/db/organization"
@@ -37,22 +41,28 @@ import (
 	"gopkg.in/validator.v2"
 )
 
-// label constants containing the reserved labels for avatars
+// label constants containing the reserved labels for avatars,
+// the names of the upstream identity providers are reserved as well
 var reservedAvatarLabels = []string{"facebook", "github"}
 
 const (
 	maxAvatarFileSize       = 100 << 10 // 100kb
 	maxAvatarAmount         = 5
-	avatarLink              = "https://%v/api/users/avatar/img/%v"
+	avatarLink              = "https://%v" + AvatarFilePath + "%v"
 	maxIDGenerationAttempts = 5
 )
 
+// AvatarFilePath is the path of the avatar files stored on itsyou.online, the hash of the file follows it in the source of an avatar
+const AvatarFilePath = "/api/users/avatar/img/"
+
 //UsersAPI is the actual implementation of the /users api
 type UsersAPI struct {
 	SmsService                    communication.SMSService
 	PhonenumberValidationService  *validation.IYOPhonenumberValidationService
 	EmailService                  communication.EmailService
 	EmailAddressValidationService *validation.IYOEmailAddressValidationService
+	// JWTSigningKey signs the data exports
+	JWTSigningKey *ecdsa.PrivateKey
 }
 
 func isUniquePhonenumber(user *user.User, number string, label string) (unique bool) {
@@ -416,7 +426,7 @@ func (api UsersAPI) DeleteEmailAddress(w http.ResponseWriter, r *http.Request) {
 func (api UsersAPI) DeleteGithubAccount(w http.ResponseWriter, r *http.Request) {
 	username := mux.Vars(r)["username"]
 	userMgr := user.NewManager(r)
-	err := userMgr.DeleteGithubAccount(username)
+	err := userMgr.RemoveLinkedAccount(username, "github")
 	if err != nil {
 		log.Error(err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -432,7 +442,39 @@ func (api UsersAPI) DeleteFacebookAccount(w http.ResponseWriter, r *http.Request
 	username := mux.Vars(r)["username"]
 
 	userMgr := user.NewManager(r)
-	err := userMgr.DeleteFacebookAccount(username)
+	err := userMgr.RemoveLinkedAccount(username, "facebook")
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetLinkedAccounts is the handler for GET /users/{username}/linkedaccounts
+// Get the accounts at upstream identity providers linked to this user
+func (api UsersAPI) GetLinkedAccounts(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	userMgr := user.NewManager(r)
+	userobj, err := userMgr.GetByName(username)
+	if handleServerError(w, "getting user", err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userobj.LinkedAccounts)
+}
+
+// DeleteLinkedAccount is the handler for DELETE /users/{username}/linkedaccounts/{provider}
+// Unlink the account at an upstream identity provider
+func (api UsersAPI) DeleteLinkedAccount(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	provider := mux.Vars(r)["provider"]
+
+	userMgr := user.NewManager(r)
+	err := userMgr.RemoveLinkedAccount(username, provider)
 	if err != nil {
 		log.Error(err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -454,8 +496,8 @@ func (api UsersAPI) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	userMgr := user.NewManager(r)
-	exists, err := userMgr.Exists(username)
-	if !exists || err != nil {
+	userobj, err := userMgr.GetByName(username)
+	if err != nil {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
@@ -467,17 +509,179 @@ func (api UsersAPI) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !passwordok {
+		audit.Record(r, audit.Event{Action: audit.ActionPasswordChanged, Outcome: audit.OutcomeFailure, Subject: username})
 		writeErrorResponse(w, 422, "incorrect_password")
 		return
 	}
+	if err = password.Check(body.Newpassword, password.UserInfoFromUser(userobj)); err != nil {
+		writeErrorResponse(w, 422, err.Error())
+		return
+	}
 	err = passwordMgr.Save(username, body.Newpassword)
 	if err != nil {
 		writeErrorResponse(w, 422, err.Error())
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionPasswordChanged, Subject: username})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUser is the handler for DELETE /users/{username}
+// Schedule the deletion of the account, the password is required to confirm it.
+// The account can be restored during the grace period.
+func (api UsersAPI) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	body := struct {
+		Password string `json:"password"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	userMgr := user.NewManager(r)
+	userobj, err := userMgr.GetByName(username)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	passwordok, err := password.NewManager(r).Validate(username, body.Password)
+	if handleServerError(w, "validating password", err) {
+		return
+	}
+	if !passwordok {
+		writeErrorResponse(w, 422, "incorrect_password")
+		return
+	}
+	lastOwnerOf, err := organizationDb.NewManager(r).LastOwnerOf(username)
+	if handleServerError(w, "listing the organizations of which the user is the last owner", err) {
+		return
+	}
+	if len(lastOwnerOf) > 0 {
+		response := struct {
+			Error         string   `json:"error"`
+			Organizations []string `json:"organizations"`
+		}{
+			Error:         "last_owner",
+			Organizations: lastOwnerOf,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
+	if userobj.DeletionScheduled == nil {
+		err = userMgr.ScheduleDeletion(username, time.Now().Add(DeletionGracePeriod))
+		if handleServerError(w, "scheduling the deletion of the user", err) {
+			return
+		}
+		log.Info("Scheduled the deletion of user ", username)
+	}
+	// The account can not be used during the grace period, the login offers to restore it
+	err = oauthservice.NewManager(r).RemoveTokensByUser(username)
+	if handleServerError(w, "revoking the tokens of the user", err) {
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ListDataExports is the handler for GET /users/{username}/exports
+// List the archives with the data stored about the user
+func (api UsersAPI) ListDataExports(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	exports, err := dataexport.NewManager(r).ListByUser(username)
+	if handleServerError(w, "listing data exports", err) {
+		return
+	}
+	for i := range exports {
+		if dataExportStale(&exports[i]) {
+			exports[i].Status = dataexport.StatusFailed
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&exports)
+}
+
+// CreateDataExport is the handler for POST /users/{username}/exports
+// Start collecting the data stored about the user, an email is sent when the archive is ready
+func (api UsersAPI) CreateDataExport(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	lang := r.FormValue("lang")
+	if lang == "" {
+		lang = organization.DefaultLanguage
+	}
+	exportMgr := dataexport.NewManager(r)
+	exports, err := exportMgr.ListByUser(username)
+	if handleServerError(w, "listing data exports", err) {
+		return
+	}
+	for i := range exports {
+		if dataExportStale(&exports[i]) {
+			if handleServerError(w, "failing a stale data export", exportMgr.SetFailed(exports[i].ID)) {
+				return
+			}
+			continue
+		}
+		if exports[i].Status == dataexport.StatusPending {
+			writeErrorResponse(w, http.StatusConflict, "export_pending")
+			return
+		}
+	}
+	// The archive is created in the background by ExportData
+	export := dataexport.New(username, DataExportValidity, r.Host, lang)
+	if handleServerError(w, "creating data export", exportMgr.Create(export)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(export)
+}
+
+// GetDataExport is the handler for GET /users/{username}/exports/{id}
+// Download the archive with the data stored about the user
+func (api UsersAPI) GetDataExport(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	export, err := dataexport.NewManager(r).Get(username, mux.Vars(r)["id"])
+	if db.IsNotFound(err) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if handleServerError(w, "getting data export", err) {
+		return
+	}
+	if export.Status != dataexport.StatusReady {
+		writeErrorResponse(w, http.StatusConflict, "export_not_ready")
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"itsyouonline-%s-%s.zip\"", username, export.CreatedAt.Format("20060102")))
+	w.Write(export.Archive)
+}
+
+// ListAuditLog is the handler for GET /users/{username}/auditlog
+// List the security relevant actions the user did or that are about the user, newest first.
+// The ip address and request id of the actions of others, like the owner that removed the user from an organization, are left out.
+func (api UsersAPI) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	query, err := audit.ParseQuery(r.URL.Query())
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	events, err := audit.NewManager(r).ListByUser(username, query)
+	if handleServerError(w, "listing the audit log", err) {
+		return
+	}
+	for i := range events {
+		if events[i].Actor != username {
+			events[i].IP = ""
+			events[i].RequestID = ""
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&events)
+}
+
 // GetUserInformation is the handler for GET /users/{username}/info
 func (api UsersAPI) GetUserInformation(w http.ResponseWriter, r *http.Request) {
 	username := mux.Vars(r)["username"]
@@ -1560,6 +1764,7 @@ func (api UsersAPI) GetNotifications(w http.ResponseWriter, r *http.Request) {
 		Invitations             []invitations.JoinOrganizationInvitation `json:"invitations"`
 		MissingScopes           []organizationDb.MissingScope            `json:"missingscopes"`
 		OrganizationInvitations []invitations.JoinOrganizationInvitation `json:"organizationinvitations"`
+		PasswordChangeRequired  bool                                     `json:"passwordchangerequired"`
 	}
 	var notifications NotificationList
 
@@ -1652,6 +1857,10 @@ func (api UsersAPI) GetNotifications(w http.ResponseWriter, r *http.Request) {
 	if handleServerError(w, "getting missing scopes", err) {
 		return
 	}
+	notifications.PasswordChangeRequired, err = password.NewManager(r).ChangeRequired(username)
+	if handleServerError(w, "checking if the password needs to be changed", err) {
+		return
+	}
 	w.Header().Set("Content-type", "application/json")
 	json.NewEncoder(w).Encode(&notifications)
 }
@@ -1860,6 +2069,7 @@ func (api UsersAPI) UpdateAuthorization(w http.ResponseWriter, r *http.Request)
 	if handleServerError(w, "updating authorization", err) {
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionAuthorizationGranted, Subject: username, Organization: grantedTo})
 	w.Header().Set("Content-type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(authorization)
@@ -1878,6 +2088,7 @@ func (api UsersAPI) DeleteAuthorization(w http.ResponseWriter, r *http.Request)
 	if handleServerError(w, "Delete authorization", err) {
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionAuthorizationRemoved, Subject: username, Organization: grantedTo})
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -2228,6 +2439,7 @@ func (api UsersAPI) AddAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 	apiKey := apikey.NewAPIKey(username, body.Label)
 	apikeyMgr.Save(apiKey)
+	audit.Record(r, audit.Event{Action: audit.ActionAPIKeyCreated, Subject: username, Detail: body.Label})
 	w.Header().Set("Content-type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(apiKey)
@@ -2292,6 +2504,7 @@ func (api UsersAPI) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
 	label := mux.Vars(r)["label"]
 	apikeyMgr := apikey.NewManager(r)
 	apikeyMgr.Delete(username, label)
+	audit.Record(r, audit.Event{Action: audit.ActionAPIKeyRemoved, Subject: username, Detail: label})
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -2649,27 +2862,49 @@ func (api UsersAPI) GetTwoFAMethods(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetTOTPSecret is the handler for GET /users/{username}/totp/
-// Gets the users TOTP secret, or a new one if it doesn't exist yet
+// Gets the users TOTP secret, or a new one if it doesn't exist yet.
+// The optional algorithm and digits query parameters select the parameters of a new secret.
 func (api UsersAPI) GetTOTPSecret(w http.ResponseWriter, r *http.Request) {
 	username := mux.Vars(r)["username"]
 
 	var response struct {
-		Totpsecret string `json:"totpsecret"`
-		TotpIssuer string `json:"totpissuer"`
+		Totpsecret    string         `json:"totpsecret"`
+		TotpIssuer    string         `json:"totpissuer"`
+		TotpAlgorithm totp.Algorithm `json:"totpalgorithm"`
+		TotpDigits    int            `json:"totpdigits"`
 	}
 
 	totpManager := totp.NewManager(r)
 	err, secret := totpManager.GetSecret(username)
 	// if no existing secret is found generate a new one
 	if totpManager.IsErrNotFound(err) {
+		algorithm := totp.Algorithm(strings.ToUpper(r.URL.Query().Get("algorithm")))
+		digits := 0
+		if digitsStr := r.URL.Query().Get("digits"); digitsStr != "" {
+			digits, err = strconv.Atoi(digitsStr)
+			if err != nil {
+				writeErrorResponse(w, http.StatusBadRequest, "invalid_digits")
+				return
+			}
+		}
 		var token *totp.Token
-		token, err = totp.NewToken()
+		token, err = totp.NewToken(algorithm, digits)
+		if err == totp.ErrInvalidAlgorithm {
+			writeErrorResponse(w, http.StatusBadRequest, "invalid_algorithm")
+			return
+		}
+		if err == totp.ErrInvalidDigits {
+			writeErrorResponse(w, http.StatusBadRequest, "invalid_digits")
+			return
+		}
 		if handleServerError(w, "generating a new totp secret", err) {
 			return
 		}
 
 		response.Totpsecret = token.Secret
 		response.TotpIssuer = totp.GetIssuer(r)
+		response.TotpAlgorithm = token.Algorithm
+		response.TotpDigits = token.Digits
 		// an error might be an `actual` error and not just a not found
 	} else if handleServerError(w, "get saved totp secret", err) {
 		return
@@ -2677,6 +2912,14 @@ func (api UsersAPI) GetTOTPSecret(w http.ResponseWriter, r *http.Request) {
 	} else {
 		response.TotpIssuer = totp.GetIssuer(r)
 		response.Totpsecret = secret.Secret
+		response.TotpAlgorithm = secret.Algorithm
+		response.TotpDigits = secret.Digits
+		if response.TotpAlgorithm == "" {
+			response.TotpAlgorithm = totp.DefaultAlgorithm
+		}
+		if response.TotpDigits == 0 {
+			response.TotpDigits = totp.DefaultDigits
+		}
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -2688,8 +2931,10 @@ func (api UsersAPI) GetTOTPSecret(w http.ResponseWriter, r *http.Request) {
 func (api UsersAPI) SetupTOTP(w http.ResponseWriter, r *http.Request) {
 	username := mux.Vars(r)["username"]
 	values := struct {
-		TotpSecret string `json:"totpsecret"`
-		TotpCode   string `json:"totpcode"`
+		TotpSecret    string         `json:"totpsecret"`
+		TotpCode      string         `json:"totpcode"`
+		TotpAlgorithm totp.Algorithm `json:"totpalgorithm"`
+		TotpDigits    int            `json:"totpdigits"`
 	}{}
 
 	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
@@ -2697,7 +2942,11 @@ func (api UsersAPI) SetupTOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	totpMgr := totp.NewManager(r)
-	err := totpMgr.Save(username, values.TotpSecret)
+	err := totpMgr.Save(username, values.TotpSecret, values.TotpAlgorithm, values.TotpDigits)
+	if err == totp.ErrInvalidAlgorithm || err == totp.ErrInvalidDigits {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Error(err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -2720,6 +2969,7 @@ func (api UsersAPI) SetupTOTP(w http.ResponseWriter, r *http.Request) {
 	} else {
 		userMgr := user.NewManager(r)
 		userMgr.RemoveExpireDate(username)
+		audit.Record(r, audit.Event{Action: audit.ActionTOTPSet, Subject: username})
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -2748,6 +2998,9 @@ func (api UsersAPI) RemoveTOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// if the err is an error not found, there was nothing in the first place
+	if err == nil {
+		audit.Record(r, audit.Event{Action: audit.ActionTOTPRemoved, Subject: username})
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -2793,6 +3046,7 @@ func (api UsersAPI) LeaveOrganization(w http.ResponseWriter, r *http.Request) {
 	if handleServerError(w, "removing organization scopes", err) {
 		return
 	}
+	audit.Record(r, audit.Event{Action: audit.ActionMemberRemoved, Subject: username, Organization: organizationGlobalId})
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -3002,7 +3256,8 @@ func isReservedAvatarLabel(label string) bool {
 			return true
 		}
 	}
-	return false
+	_, isProvider := upstream.Get(strings.ToLower(label))
+	return isProvider
 }
 
 // GetAvatarImage is the handler for GET /users/avatar/img/{hash}
@@ -3245,7 +3500,7 @@ func (api UsersAPI) LookupIyoID(w http.ResponseWriter, r *http.Request) {
 // an error has occurred. In this case callers must not write to the ResponseWriter
 // again.
 func validateAvatarUpdateLabels(oldLabel string, newLabel string, username string,
-	userMgr *user.Manager, w http.ResponseWriter) (*user.Avatar, bool) {
+	userMgr user.Manager, w http.ResponseWriter) (*user.Avatar, bool) {
 	// lets not change reserved labels.
 	if isReservedAvatarLabel(oldLabel) {
 		log.Debug("trying to modify reserved label")
@@ -3285,7 +3540,7 @@ func validateAvatarUpdateLabels(oldLabel string, newLabel string, username strin
 // replaceAvatar replaces an old avatar with a new one. It also removes avatar
 // files stored on the server if the link is updated or a new file is uploaded
 func replaceAvatar(w http.ResponseWriter, r *http.Request, oldAvatar *user.Avatar,
-	newAvatar *user.Avatar, username string, userMgr *user.Manager) {
+	newAvatar *user.Avatar, username string, userMgr user.Manager) {
 	var err error
 	// If the old avatar points to a file on itsyou.online, we need to remove the file stored here.
 	if strings.HasPrefix(strings.TrimPrefix(oldAvatar.Source, "https://"), r.Host) {
@@ -3320,7 +3575,7 @@ func replaceAvatar(w http.ResponseWriter, r *http.Request, oldAvatar *user.Avata
 // value indicating a possible error. If this second value is true, an error has occurred,
 // and this function will already have written the http response. In this case callers
 // must terminate and refrain from writing further responses on the writer.
-func saveMultiPartAvatarFile(w http.ResponseWriter, r *http.Request, userMgr *user.Manager) (string, bool) {
+func saveMultiPartAvatarFile(w http.ResponseWriter, r *http.Request, userMgr user.Manager) (string, bool) {
 	err := r.ParseMultipartForm(110 << 10)
 	if err != nil {
 		log.Debug("Failed to parse multi part form: ", err)
@@ -3400,12 +3655,9 @@ func saveMultiPartAvatarFile(w http.ResponseWriter, r *http.Request, userMgr *us
 // getUserAvatarCount gets the user avatar count
 func getUserAvatarCount(u *user.User) int {
 	avatarCount := 0
-countAvatars:
 	for _, avatar := range u.Avatars {
-		for _, reservedLabel := range reservedAvatarLabels {
-			if avatar.Label == reservedLabel {
-				continue countAvatars
-			}
+		if isReservedAvatarLabel(avatar.Label) {
+			continue
 		}
 		avatarCount++
 	}
@@ -1,9 +1,16 @@
 package user
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/audit"
 	"github.com/itsyouonline/identityserver/db/user"
 	"github.com/stretchr/testify/assert"
 )
@@ -48,3 +55,30 @@ func TestUsernameValidation(t *testing.T) {
 		assert.Equal(t, test.valid, user.ValidateUsername(test.username), test.username)
 	}
 }
+
+func TestListAuditLogHidesTheIPOfOthers(t *testing.T) {
+	backend := db.NewMemoryBackend()
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	auditMgr := audit.NewManager(r)
+	assert.NoError(t, auditMgr.Save(&audit.Event{Timestamp: time.Now().Add(-time.Minute), Action: audit.ActionLogin, Actor: "bob", IP: "192.0.2.1", RequestID: "own", ExpiresAt: time.Now().Add(time.Hour)}))
+	assert.NoError(t, auditMgr.Save(&audit.Event{Timestamp: time.Now(), Action: audit.ActionMemberRemoved, Actor: "alice", Subject: "bob", Organization: "acme", IP: "198.51.100.7", RequestID: "other", ExpiresAt: time.Now().Add(time.Hour)}))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{username}/auditlog", UsersAPI{}.ListAuditLog).Methods("GET")
+	w := httptest.NewRecorder()
+	db.DBMiddleware(backend)(router).ServeHTTP(w, httptest.NewRequest("GET", "/users/bob/auditlog", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	events := []audit.Event{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&events))
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "alice", events[0].Actor)
+		assert.Empty(t, events[0].IP, "the ip address of the owner that removed bob is not shown to bob")
+		assert.Empty(t, events[0].RequestID)
+		assert.Equal(t, "192.0.2.1", events[1].IP)
+		assert.Equal(t, "own", events[1].RequestID)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
-	"github.com/itsyouonline/identityserver/siteservice/middleware"
 	"github.com/justinas/alice"
 )
 
@@ -48,6 +47,21 @@ type UsersInterface interface { // Post is the handler for POST /users
 	GetNotifications(http.ResponseWriter, *http.Request)
 	// GetUser is the handler for GET /users/{username}
 	GetUser(http.ResponseWriter, *http.Request)
+	// DeleteUser is the handler for DELETE /users/{username}
+	// Schedule the deletion of the account
+	DeleteUser(http.ResponseWriter, *http.Request)
+	// ListDataExports is the handler for GET /users/{username}/exports
+	// List the archives with the data stored about the user
+	ListDataExports(http.ResponseWriter, *http.Request)
+	// CreateDataExport is the handler for POST /users/{username}/exports
+	// Start collecting the data stored about the user
+	CreateDataExport(http.ResponseWriter, *http.Request)
+	// GetDataExport is the handler for GET /users/{username}/exports/{id}
+	// Download the archive with the data stored about the user
+	GetDataExport(http.ResponseWriter, *http.Request)
+	// ListAuditLog is the handler for GET /users/{username}/auditlog
+	// List the security relevant actions of the user
+	ListAuditLog(http.ResponseWriter, *http.Request)
 	// DeleteFacebookAccount is the handler for DELETE /users/{username}/facebook
 	// Delete the associated facebook account
 	DeleteFacebookAccount(http.ResponseWriter, *http.Request)
@@ -65,6 +79,12 @@ type UsersInterface interface { // Post is the handler for POST /users
 	// DeleteGithubAccount is the handler for DELETE /users/{username}/github
 	// Unlink Github Account
 	DeleteGithubAccount(http.ResponseWriter, *http.Request)
+	// GetLinkedAccounts is the handler for GET /users/{username}/linkedaccounts
+	// Get the accounts at upstream identity providers linked to this user
+	GetLinkedAccounts(http.ResponseWriter, *http.Request)
+	// DeleteLinkedAccount is the handler for DELETE /users/{username}/linkedaccounts/{provider}
+	// Unlink the account at an upstream identity provider
+	DeleteLinkedAccount(http.ResponseWriter, *http.Request)
 	// GetUserInformation is the handler for GET /users/{username}/info
 	GetUserInformation(http.ResponseWriter, *http.Request)
 	// GetUserAddresses is the handler for GET /users/{username}/addresses
@@ -213,12 +233,17 @@ func UsersInterfaceRoutes(r *mux.Router, i UsersInterface) {
 	r.Handle("/users/{username}/phonenumbers/{label}", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin", "user:phone:{label}", "user:phone:{label}:write"}).Handler).Then(http.HandlerFunc(i.GetUserPhonenumberByLabel))).Methods("GET")
 	r.Handle("/users/{username}/phonenumbers/{label}", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin", "user:phone:{label}:write"}).Handler).Then(http.HandlerFunc(i.UpdatePhonenumber))).Methods("PUT")
 	r.Handle("/users/{username}/phonenumbers/{label}", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin", "user:phone:{label}:write"}).Handler).Then(http.HandlerFunc(i.DeletePhonenumber))).Methods("DELETE")
-	r.Handle("/users/{username}/phonenumbers/{label}/validate", alice.New(middleware.RateLimit(middleware.DefaultRateLimitPeriod, middleware.DefaultRateLimit).Handler, NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.ValidatePhoneNumber))).Methods("POST")
+	r.Handle("/users/{username}/phonenumbers/{label}/validate", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.ValidatePhoneNumber))).Methods("POST")
 	r.Handle("/users/{username}/phonenumbers/{label}/validate", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.VerifyPhoneNumber))).Methods("PUT")
 	r.Handle("/users/{username}/banks", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GetUserBankAccounts))).Methods("GET")
 	r.Handle("/users/{username}/banks", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.CreateUserBankAccount))).Methods("POST")
 	r.Handle("/users/{username}/notifications", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GetNotifications))).Methods("GET")
 	r.Handle("/users/{username}", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GetUser))).Methods("GET")
+	r.Handle("/users/{username}", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.DeleteUser))).Methods("DELETE")
+	r.Handle("/users/{username}/exports", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.ListDataExports))).Methods("GET")
+	r.Handle("/users/{username}/exports", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.CreateDataExport))).Methods("POST")
+	r.Handle("/users/{username}/exports/{id}", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GetDataExport))).Methods("GET")
+	r.Handle("/users/{username}/auditlog", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.ListAuditLog))).Methods("GET")
 	r.Handle("/users/{username}/apikeys", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.ListAPIKeys))).Methods("GET")
 	r.Handle("/users/{username}/apikeys", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.AddAPIKey))).Methods("POST")
 	r.Handle("/users/{username}/apikeys/{label}", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GetAPIKey))).Methods("GET")
@@ -239,6 +264,8 @@ func UsersInterfaceRoutes(r *mux.Router, i UsersInterface) {
 	r.Handle("/users/{username}/emailaddresses/{label}", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.DeleteEmailAddress))).Methods("DELETE")
 	r.Handle("/users/{username}/emailaddresses/{label}/validate", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.ValidateEmailAddress))).Methods("POST")
 	r.Handle("/users/{username}/github", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.DeleteGithubAccount))).Methods("DELETE")
+	r.Handle("/users/{username}/linkedaccounts", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GetLinkedAccounts))).Methods("GET")
+	r.Handle("/users/{username}/linkedaccounts/{provider}", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.DeleteLinkedAccount))).Methods("DELETE")
 	r.Handle("/users/{username}/info", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:info", "user:admin"}).Handler).Then(http.HandlerFunc(i.GetUserInformation))).Methods("GET")
 	r.Handle("/users/{username}/addresses", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GetUserAddresses))).Methods("GET")
 	r.Handle("/users/{username}/addresses", alice.New(NewUserIdentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.RegisterNewAddress))).Methods("POST")
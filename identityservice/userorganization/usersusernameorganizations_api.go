@@ -9,6 +9,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
 
+	"github.com/itsyouonline/identityserver/db/audit"
 	organizationdb "github.com/itsyouonline/identityserver/db/organization"
 	"github.com/itsyouonline/identityserver/db/validation"
 	"github.com/itsyouonline/identityserver/identityservice/invitations"
@@ -144,6 +145,7 @@ func (api UsersusernameorganizationsAPI) globalidrolesrolePost(w http.ResponseWr
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				return
 			}
+			audit.Record(r, audit.Event{Action: audit.ActionOwnerAdded, Subject: username, Organization: organization, Detail: audit.DetailInvitation})
 		} else {
 			// Accepted member role
 			if err := orgMgr.SaveMember(org, username); err != nil {
@@ -151,6 +153,7 @@ func (api UsersusernameorganizationsAPI) globalidrolesrolePost(w http.ResponseWr
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				return
 			}
+			audit.Record(r, audit.Event{Action: audit.ActionMemberAdded, Subject: username, Organization: organization, Detail: audit.DetailInvitation})
 		}
 	}
 
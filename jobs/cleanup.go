@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/contract"
+	"github.com/itsyouonline/identityserver/db/smshistory"
+	"github.com/itsyouonline/identityserver/db/user"
+	"github.com/itsyouonline/identityserver/identityservice/invitations"
+	userservice "github.com/itsyouonline/identityserver/identityservice/user"
+)
+
+// The retention of the data removed by the cleanup jobs
+var (
+	// InvitationRetention is how long an invitation can stay pending
+	InvitationRetention = 90 * 24 * time.Hour
+	// SMSHistoryRetention is how long the sent sms are kept, it is longer than the window of the sms rate limit
+	SMSHistoryRetention = 90 * 24 * time.Hour
+	// ContractRetention is how long a contract is kept after it expired
+	ContractRetention = 30 * 24 * time.Hour
+	// AvatarFileGracePeriod protects an uploaded avatar file that is not linked to the avatar of the user yet
+	AvatarFileGracePeriod = time.Hour
+)
+
+// registered lists the jobs, the scheduler runs the due jobs in this order
+var registered = []Job{
+	{
+		Name:        "expired-registrations",
+		Description: "Remove the users that did not finish their registration in time",
+		Interval:    time.Hour,
+		Run: func(r *http.Request) (int, error) {
+			return user.NewManager(r).RemoveExpiredRegistrations()
+		},
+	},
+	{
+		Name:        "stale-invitations",
+		Description: "Remove the organization invitations that are pending for too long",
+		Interval:    24 * time.Hour,
+		Run: func(r *http.Request) (int, error) {
+			return invitations.NewInvitationManager(r).RemovePendingBefore(time.Now().Add(-InvitationRetention))
+		},
+	},
+	{
+		Name:        "sms-history",
+		Description: "Remove the old history of the sent sms",
+		Interval:    24 * time.Hour,
+		Run: func(r *http.Request) (int, error) {
+			return smshistory.NewManager(r).RemoveBefore(time.Now().Add(-SMSHistoryRetention))
+		},
+	},
+	{
+		Name:        "orphaned-avatars",
+		Description: "Remove the uploaded avatar files no avatar refers to",
+		Interval:    24 * time.Hour,
+		Run:         removeOrphanedAvatarFiles,
+	},
+	{
+		Name:        "expired-contracts",
+		Description: "Remove the contracts that expired",
+		Interval:    24 * time.Hour,
+		Run: func(r *http.Request) (int, error) {
+			return contract.NewManager(r).RemoveExpired(time.Now().Add(-ContractRetention))
+		},
+	},
+	{
+		Name:        "deleted-users",
+		Description: "Delete the accounts of which the deletion grace period has passed",
+		Interval:    userservice.DeletionPurgeInterval,
+		Run:         userservice.PurgeDeletedUsers,
+	},
+}
+
+// removeOrphanedAvatarFiles removes the avatar files that are not the source of an avatar,
+// like the files of avatars that were removed while the file could not be removed
+func removeOrphanedAvatarFiles(r *http.Request) (removed int, err error) {
+	userMgr := user.NewManager(r)
+	// The files are listed before the sources, so a file uploaded in between is not listed
+	hashes, err := userMgr.GetAvatarFileHashes(time.Now().Add(-AvatarFileGracePeriod))
+	if err != nil {
+		return
+	}
+	sources, err := userMgr.GetAvatarSources()
+	if err != nil {
+		return
+	}
+	used := map[string]bool{}
+	for _, source := range sources {
+		if i := strings.Index(source, userservice.AvatarFilePath); i != -1 {
+			used[source[i+len(userservice.AvatarFilePath):]] = true
+		}
+	}
+	for _, hash := range hashes {
+		if err = r.Context().Err(); err != nil {
+			return
+		}
+		if used[hash] {
+			continue
+		}
+		err = userMgr.RemoveAvatarFile(hash)
+		if db.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		removed++
+	}
+	return removed, nil
+}
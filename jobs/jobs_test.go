@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/job"
+	"github.com/itsyouonline/identityserver/db/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDue(t *testing.T) {
+	defer func(jobs []Job) { registered = jobs }(registered)
+	runs := map[string]int{}
+	count := func(name string, err error) func(r *http.Request) (int, error) {
+		return func(r *http.Request) (int, error) {
+			runs[name]++
+			return 2, err
+		}
+	}
+	registered = []Job{
+		{Name: "hourly", Interval: time.Hour, Run: count("hourly", nil)},
+		{Name: "failing", Interval: time.Hour, Run: count("failing", errors.New("down"))},
+		{Name: "always", Interval: 0, Run: count("always", nil)},
+	}
+	backend := db.NewMemoryBackend()
+
+	runDue(backend, "a")
+	assert.Equal(t, map[string]int{"hourly": 1, "failing": 1, "always": 1}, runs)
+	runDue(backend, "a")
+	assert.Equal(t, map[string]int{"hourly": 1, "failing": 1, "always": 2}, runs, "only the jobs of which the interval passed run again")
+	runDue(backend, "b")
+	assert.Equal(t, 2, runs["always"], "another instance does not run the jobs while the lease is held")
+
+	r, release, _ := db.NewBackgroundRequest(backend, "")
+	defer release()
+	history, err := job.NewManager(r).ListRuns("failing", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "down", history[0].Error)
+		assert.Equal(t, job.TriggerSchedule, history[0].Trigger)
+		assert.Equal(t, "a", history[0].Instance)
+		assert.Equal(t, 2, history[0].Removed)
+	}
+
+	releaseLease(backend, "a")
+	runDue(backend, "b")
+	assert.Equal(t, 3, runs["always"], "the lease is taken over once it is released")
+}
+
+func TestRunDueCancelsJobWhenLeaseIsLost(t *testing.T) {
+	defer func(jobs []Job, interval time.Duration) { registered, CheckInterval = jobs, interval }(registered, CheckInterval)
+	CheckInterval = 10 * time.Millisecond
+	backend := db.NewMemoryBackend()
+	r, release, _ := db.NewBackgroundRequest(backend, "")
+	defer release()
+	mgr := job.NewManager(r)
+	started, next := make(chan struct{}), 0
+	registered = []Job{
+		{Name: "blocking", Interval: time.Hour, Run: func(jr *http.Request) (int, error) {
+			close(started)
+			<-jr.Context().Done()
+			return 0, jr.Context().Err()
+		}},
+		{Name: "next", Interval: time.Hour, Run: func(*http.Request) (int, error) {
+			next++
+			return 0, nil
+		}},
+	}
+
+	go func() {
+		<-started
+		// Another instance takes over the lease as if this instance had stopped renewing it
+		mgr.ReleaseLease(leaseName, "a")
+		mgr.AcquireLease(leaseName, "b", time.Now().Add(leaseValidity))
+	}()
+	finished := make(chan struct{})
+	go func() {
+		runDue(backend, "a")
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job was not cancelled after the lease was lost")
+	}
+	assert.Equal(t, 0, next, "the next job does not run once the lease is lost")
+	history, err := mgr.ListRuns("blocking", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, context.Canceled.Error(), history[0].Error)
+	}
+}
+
+func TestRemoveOrphanedAvatarFiles(t *testing.T) {
+	defer func(grace time.Duration) { AvatarFileGracePeriod = grace }(AvatarFileGracePeriod)
+	r, release, _ := db.NewBackgroundRequest(db.NewMemoryBackend(), "")
+	defer release()
+	userMgr := user.NewManager(r)
+	assert.NoError(t, userMgr.Save(&user.User{Username: "bob"}))
+	assert.NoError(t, userMgr.SaveAvatarFile("used", []byte("a")))
+	assert.NoError(t, userMgr.SaveAvatarFile("orphan", []byte("b")))
+	assert.NoError(t, userMgr.SaveAvatar("bob", user.Avatar{Label: "main", Source: "https://itsyou.online/api/users/avatar/img/used"}))
+
+	AvatarFileGracePeriod = time.Hour
+	removed, err := removeOrphanedAvatarFiles(r)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed, "recently uploaded files are kept")
+
+	AvatarFileGracePeriod = -time.Second
+	removed, err = removeOrphanedAvatarFiles(r)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	file, _ := userMgr.GetAvatarFile("used")
+	assert.NotNil(t, file)
+	file, _ = userMgr.GetAvatarFile("orphan")
+	assert.Nil(t, file)
+}
+
+func TestRunNowWhileJobIsRunning(t *testing.T) {
+	backend := db.NewMemoryBackend()
+	started, stop := make(chan struct{}), make(chan struct{})
+	blocking := Job{Name: "blocking", Interval: time.Hour, Run: func(*http.Request) (int, error) {
+		close(started)
+		<-stop
+		return 1, nil
+	}}
+	finished := make(chan job.Run)
+	go func() {
+		run, _ := RunNow(backend, blocking, "a")
+		finished <- run
+	}()
+	<-started
+	_, err := RunNow(backend, blocking, "b")
+	assert.Equal(t, ErrJobRunning, err, "a job does not run twice at the same time")
+	close(stop)
+	assert.Equal(t, 1, (<-finished).Removed)
+
+	once := Job{Name: "blocking", Run: func(*http.Request) (int, error) { return 2, nil }}
+	run, err := RunNow(backend, once, "b")
+	assert.NoError(t, err, "the lease of the job is released when it finished")
+	assert.Equal(t, 2, run.Removed)
+}
@@ -0,0 +1,268 @@
+// Package jobs runs the periodic maintenance jobs. Every instance runs the scheduler,
+// but only the instance that holds the lease in the database starts the jobs that are due.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/job"
+	"github.com/itsyouonline/identityserver/metrics"
+)
+
+const (
+	// leaseName is the name of the lease held by the instance that schedules the jobs
+	leaseName = "scheduler"
+	// leaseValidity is how long another instance waits before it takes over the lease of a leader that stopped
+	leaseValidity = 3 * time.Minute
+)
+
+var (
+	// CheckInterval is how often the scheduler renews its lease, also while a job runs, and checks which jobs are due
+	CheckInterval = time.Minute
+	// RunRetention is how long the runs are kept in the history
+	RunRetention = 30 * 24 * time.Hour
+)
+
+// Job is a periodic maintenance task
+type Job struct {
+	Name        string
+	Description string
+	// Interval is the time between the start of two scheduled runs
+	Interval time.Duration
+	// Run does the work with the backend opened for r and returns the number of documents it removed.
+	// A scheduled run is cancelled through the context of r when the lease can not be renewed.
+	Run func(r *http.Request) (removed int, err error)
+}
+
+// ErrJobRunning is returned when a job is run manually while it is already running
+var ErrJobRunning = errors.New("the job is already running")
+
+// leader is 1 while this instance holds the lease
+var leader int32
+
+// jobLease returns the name of the lease held while a job runs, so a manual run does not overlap a scheduled one
+func jobLease(name string) string {
+	return "job:" + name
+}
+
+func init() {
+	metrics.NewGaugeFunc("iyo_job_leader", "1 if this instance schedules the maintenance jobs", func() (float64, error) {
+		return float64(atomic.LoadInt32(&leader)), nil
+	})
+}
+
+// Registered returns the jobs in the order they are run
+func Registered() []Job {
+	return registered
+}
+
+// Find returns the registered job with a name
+func Find(name string) (Job, bool) {
+	for _, j := range registered {
+		if j.Name == name {
+			return j, true
+		}
+	}
+	return Job{}, false
+}
+
+// Instance identifies this process in the lease and the runs
+func Instance() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// Schedule runs the jobs that are due every CheckInterval while this instance holds the lease, until stop is closed.
+// The lease is released when it stops so another instance can take over right away.
+func Schedule(backend db.Backend, stop <-chan struct{}) {
+	instance := Instance()
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+	for {
+		runDue(backend, instance)
+		select {
+		case <-stop:
+			releaseLease(backend, instance)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue runs the jobs of which the interval passed since their last run, the lease is renewed before and during every job
+func runDue(backend db.Backend, instance string) {
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if err != nil {
+		log.Error("Failed to schedule the jobs: ", err)
+		return
+	}
+	defer release()
+	mgr := job.NewManager(r)
+	for _, j := range registered {
+		acquired, err := mgr.AcquireLease(leaseName, instance, time.Now().Add(leaseValidity))
+		if err != nil {
+			log.Error("Failed to acquire the job scheduler lease: ", err)
+			return
+		}
+		if !acquired {
+			if atomic.SwapInt32(&leader, 0) == 1 {
+				log.Info("Another instance took over the scheduling of the jobs")
+			}
+			return
+		}
+		if atomic.SwapInt32(&leader, 1) == 0 {
+			log.Info("This instance schedules the jobs")
+		}
+		last, err := mgr.LastRun(j.Name)
+		if err != nil && !db.IsNotFound(err) {
+			log.Errorf("Failed to get the last run of job %s: %v", j.Name, err)
+			continue
+		}
+		if err == nil && time.Since(last.StartedAt) < j.Interval {
+			continue
+		}
+		runLeased(backend, j, instance)
+	}
+}
+
+// runLeased runs a job that is due while the scheduler lease is renewed
+func runLeased(backend db.Backend, j Job, instance string) {
+	if _, err := runWithLeases(backend, j, job.TriggerSchedule, instance, leaseName); err == ErrJobRunning {
+		log.Infof("Job %s is not started, it is already running", j.Name)
+	}
+}
+
+// RunNow runs a job right away, outside of the schedule. It takes the lease of the job so it can not run
+// at the same time as a scheduled run, ErrJobRunning is returned when the job is running already.
+func RunNow(backend db.Backend, j Job, instance string) (job.Run, error) {
+	return runWithLeases(backend, j, job.TriggerManual, instance)
+}
+
+// runWithLeases takes the lease of a job and runs it while that lease and the other leases are renewed every CheckInterval.
+// The job is cancelled when a lease can not be renewed, so it does not keep running after another instance took over.
+func runWithLeases(backend db.Backend, j Job, trigger string, instance string, leases ...string) (run job.Run, err error) {
+	acquired := false
+	err = withManager(backend, func(mgr job.Manager) (err error) {
+		acquired, err = mgr.AcquireLease(jobLease(j.Name), instance, time.Now().Add(leaseValidity))
+		return
+	})
+	if err != nil {
+		log.Errorf("Failed to acquire the lease of job %s: %v", j.Name, err)
+		return
+	}
+	if !acquired {
+		return run, ErrJobRunning
+	}
+	defer func() {
+		if err := withManager(backend, func(mgr job.Manager) error {
+			return mgr.ReleaseLease(jobLease(j.Name), instance)
+		}); err != nil {
+			log.Errorf("Failed to release the lease of job %s: %v", j.Name, err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := (&http.Request{}).WithContext(ctx)
+	release, err := db.OpenBackgroundRequest(backend, r)
+	if err != nil {
+		log.Errorf("Failed to run job %s: %v", j.Name, err)
+		return
+	}
+	defer release()
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+	done := make(chan struct{})
+	defer close(done)
+	go renewLeases(backend, instance, append([]string{jobLease(j.Name)}, leases...), ticker.C, done, cancel)
+	return runAndRecord(backend, r, j, trigger, instance), nil
+}
+
+// withManager calls f with a job manager of a new background request
+func withManager(backend db.Backend, f func(mgr job.Manager) error) error {
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if err != nil {
+		return err
+	}
+	defer release()
+	return f(job.NewManager(r))
+}
+
+// renewLeases renews the leases on every tick until done is closed and calls cancel when a renewal fails
+func renewLeases(backend db.Backend, instance string, leases []string, tick <-chan time.Time, done <-chan struct{}, cancel func()) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick:
+		}
+		r, release, err := db.NewBackgroundRequest(backend, "")
+		if err != nil {
+			log.Error("Failed to renew the job leases, cancelling the running job: ", err)
+			cancel()
+			return
+		}
+		for _, name := range leases {
+			acquired, err := job.NewManager(r).AcquireLease(name, instance, time.Now().Add(leaseValidity))
+			if err != nil {
+				log.Errorf("Failed to renew the lease %s, cancelling the running job: %v", name, err)
+			} else if !acquired {
+				if name == leaseName {
+					atomic.StoreInt32(&leader, 0)
+				}
+				log.Infof("Another instance took over the lease %s, cancelling the running job", name)
+			}
+			if err != nil || !acquired {
+				release()
+				cancel()
+				return
+			}
+		}
+		release()
+	}
+}
+
+func releaseLease(backend db.Backend, instance string) {
+	atomic.StoreInt32(&leader, 0)
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if err != nil {
+		log.Error("Failed to release the job scheduler lease: ", err)
+		return
+	}
+	defer release()
+	if err = job.NewManager(r).ReleaseLease(leaseName, instance); err != nil {
+		log.Error("Failed to release the job scheduler lease: ", err)
+	}
+}
+
+// runAndRecord runs a job with the backend opened for r and records the run in the history.
+// The run is recorded with a new request since the context of r is cancelled when a lease is lost.
+func runAndRecord(backend db.Backend, r *http.Request, j Job, trigger string, instance string) job.Run {
+	run := job.Run{Job: j.Name, Trigger: trigger, Instance: instance, StartedAt: time.Now()}
+	removed, err := j.Run(r)
+	run.FinishedAt = time.Now()
+	run.Removed = removed
+	run.ExpiresAt = run.StartedAt.Add(RunRetention)
+	logger := log.WithField("job", j.Name).WithField("trigger", trigger)
+	if err != nil {
+		run.Error = err.Error()
+		logger.Error("Job failed: ", err)
+	} else {
+		logger.Infof("Job finished, removed %d", removed)
+	}
+	metrics.JobRuns.Inc(j.Name, metrics.Result(err))
+	metrics.JobRemoved.Add(float64(removed), j.Name)
+	metrics.JobDuration.Observe(run.FinishedAt.Sub(run.StartedAt).Seconds(), j.Name)
+	if err = withManager(backend, func(mgr job.Manager) error { return mgr.SaveRun(&run) }); err != nil {
+		logger.Error("Failed to record the run: ", err)
+	}
+	return run
+}
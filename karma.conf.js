@@ -71,6 +71,8 @@ module.exports = function(config) {
           'components/login/recoverAccountController.js',
           'components/login/organizationInviteController.js',
           'components/login/validateEmailController.js',
+          'components/login/magicLinkController.js',
+          'components/login/upstreamLoginController.js',
 
           // load register app and dependancies
           'components/registration/registrationApp.js',
@@ -0,0 +1,170 @@
+// Package logging adds request scoped fields to the log entries of the identity server.
+// Every request gets an id that is returned in the X-Request-ID header and added to all entries logged with FromRequest,
+// together with the user, the client and the route the request belongs to, so one login can be followed through the logs.
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/context"
+	"github.com/itsyouonline/identityserver/metrics"
+)
+
+// RequestIDHeader is the header that carries the request id, an id set by a proxy in front of the server is kept
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the ids that are accepted from the client so they can not flood the logs
+const maxRequestIDLength = 128
+
+// The log formats that can be configured
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type contextKey int
+
+const requestInfoKey contextKey = iota
+
+// requestInfo holds the fields of a request, it is filled in while the request is handled
+type requestInfo struct {
+	requestID string
+	username  string
+	clientID  string
+}
+
+// SetFormat configures the formatter of the standard logger, format is text or json
+func SetFormat(format string) error {
+	switch format {
+	case FormatText:
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	case FormatJSON:
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("Unknown log format %q", format)
+	}
+	return nil
+}
+
+// RequestIDMiddleware gives every request an id, the id of the X-Request-ID header is used if the request has a valid one
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		context.Set(r, requestInfoKey, &requestInfo{requestID: requestID})
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID accepts the printable ascii ids that are not too long
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Error("Failed to generate a request id: ", err)
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+func getRequestInfo(r *http.Request) *requestInfo {
+	if info, ok := context.Get(r, requestInfoKey).(*requestInfo); ok {
+		return info
+	}
+	return &requestInfo{}
+}
+
+// RequestID returns the id of the request, it is empty if the request did not pass RequestIDMiddleware
+func RequestID(r *http.Request) string {
+	return getRequestInfo(r).requestID
+}
+
+// SetUsername adds the user a request acts on to the entries logged for the rest of the request,
+// like the user logging in, before a session exists
+func SetUsername(r *http.Request, username string) {
+	getRequestInfo(r).username = username
+}
+
+// SetClientID adds the client of a request to the entries logged for the rest of the request
+func SetClientID(r *http.Request, clientID string) {
+	getRequestInfo(r).clientID = clientID
+}
+
+// Username returns the user a request acts on: the one set with SetUsername, the authenticated user of the api
+// or the user of the web session
+func Username(r *http.Request) string {
+	username := getRequestInfo(r).username
+	if username == "" {
+		// Set by the oauth middleware of the organization api and the web session middleware
+		username, _ = context.Get(r, "authenticateduser").(string)
+	}
+	if username == "" {
+		username, _ = context.Get(r, "webuser").(string)
+	}
+	return username
+}
+
+// ClientID returns the client of a request: the one set with SetClientID or the client of the access token
+func ClientID(r *http.Request) string {
+	clientID := getRequestInfo(r).clientID
+	if clientID == "" {
+		// Set by the oauth middleware of the api
+		clientID, _ = context.Get(r, "client_id").(string)
+	}
+	return clientID
+}
+
+// ClientIP returns the ip address of the client, the server runs behind Cloudflare or another proxy
+func ClientIP(r *http.Request) string {
+	// Cloudflare passes the address of clients that use ipv6 in a separate header
+	if ipv6 := r.Header.Get("Cf-Connecting-Ipv6"); ipv6 != "" {
+		return ipv6
+	}
+	// Account for proxies, the first address is the client
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// FromRequest returns a logger with the request id, user, client and route template of a request
+func FromRequest(r *http.Request) *log.Entry {
+	info := getRequestInfo(r)
+	fields := log.Fields{}
+	if info.requestID != "" {
+		fields["request_id"] = info.requestID
+	}
+	if username := Username(r); username != "" {
+		fields["username"] = username
+	}
+	if clientID := ClientID(r); clientID != "" {
+		fields["client_id"] = clientID
+	}
+	if route := metrics.RouteTemplate(r); route != "" {
+		fields["route"] = route
+	}
+	return log.WithFields(fields)
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/context"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve passes a request through RequestIDMiddleware and returns the response and the fields logged by the handler
+func serve(request *http.Request, handler func(r *http.Request)) (*httptest.ResponseRecorder, log.Fields) {
+	var fields log.Fields
+	w := httptest.NewRecorder()
+	RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(r)
+		fields = SecurityEvent(r, EventLoginFailed).Data
+	})).ServeHTTP(w, request)
+	context.Clear(request)
+	return w, fields
+}
+
+func TestRequestIDIsPropagated(t *testing.T) {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(RequestIDHeader, "abc-123")
+	w, fields := serve(request, func(r *http.Request) {})
+	assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+	assert.Equal(t, "abc-123", fields["request_id"])
+}
+
+func TestRequestIDIsGenerated(t *testing.T) {
+	for _, header := range []string{"", "with space", strings.Repeat("a", maxRequestIDLength+1)} {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set(RequestIDHeader, header)
+		w, _ := serve(request, func(r *http.Request) {})
+		requestID := w.Header().Get(RequestIDHeader)
+		assert.Len(t, requestID, 32, "invalid request id %q is replaced", header)
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	_, fields := serve(httptest.NewRequest("GET", "/", nil), func(r *http.Request) {
+		context.Set(r, "webuser", "alice")
+		context.Set(r, "client_id", "myorg")
+	})
+	assert.Equal(t, "alice", fields["username"])
+	assert.Equal(t, "myorg", fields["client_id"])
+	assert.Equal(t, true, fields["security"])
+	assert.Equal(t, EventLoginFailed, fields["event"])
+
+	_, fields = serve(httptest.NewRequest("GET", "/", nil), func(r *http.Request) {
+		context.Set(r, "webuser", "alice")
+		SetUsername(r, "bob")
+		SetClientID(r, "otherorg")
+	})
+	assert.Equal(t, "bob", fields["username"], "the user set by the handler wins")
+	assert.Equal(t, "otherorg", fields["client_id"])
+
+	// Requests that did not pass the middleware can still be logged
+	request := httptest.NewRequest("GET", "/", nil)
+	SetUsername(request, "alice")
+	assert.NotContains(t, FromRequest(request).Data, "request_id")
+}
+
+func TestSetFormat(t *testing.T) {
+	defer log.SetFormatter(log.StandardLogger().Formatter)
+	assert.NoError(t, SetFormat(FormatJSON))
+	assert.IsType(t, &log.JSONFormatter{}, log.StandardLogger().Formatter)
+	assert.NoError(t, SetFormat(FormatText))
+	assert.Error(t, SetFormat("xml"))
+}
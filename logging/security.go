@@ -0,0 +1,30 @@
+package logging
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// The security events, they are logged with the security field set to true so they can be forwarded to a SIEM
+const (
+	// EventLoginSucceeded is logged when a user completes the login
+	EventLoginSucceeded = "login_succeeded"
+	// EventLoginFailed is logged when a factor of the login is wrong, the method field tells which one
+	EventLoginFailed = "login_failed"
+	// EventSuspendedLogin is logged when a suspended user passes the first factor
+	EventSuspendedLogin = "suspended_login"
+	// EventTokenIssued is logged when an access token or JWT is handed out
+	EventTokenIssued = "token_issued"
+	// EventTokenRejected is logged when a client presents an invalid secret, code or refresh token
+	EventTokenRejected = "token_rejected"
+	// EventRateLimited is logged when requests of an ip address are refused by the rate limit
+	EventRateLimited = "rate_limited"
+	// EventPasswordReset is logged when a user resets the password with a reset token
+	EventPasswordReset = "password_reset"
+)
+
+// SecurityEvent returns a logger for a security event of a request, with the fields of FromRequest
+func SecurityEvent(r *http.Request, event string) *log.Entry {
+	return FromRequest(r).WithFields(log.Fields{"security": true, "event": event})
+}
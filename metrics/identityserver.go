@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/context"
+)
+
+// The metrics of the identity server, the gauges are registered by the packages that can compute them
+var (
+	// HTTPRequestDuration is labeled with the route template, not the path, to keep the number of series bounded
+	HTTPRequestDuration = NewHistogramVec("http_request_duration_seconds",
+		"Duration of the http requests by method, route template and status code",
+		DefaultBuckets, "method", "route", "code")
+	// Logins counts the login steps, method is the factor that was checked:
+	// password, totp, sms or last2fa when the second factor was skipped because it was done recently
+	Logins = NewCounterVec("iyo_logins_total",
+		"Login attempts by outcome (success or failure) and authentication method", "outcome", "method")
+	// TokensIssued counts the access tokens and JWTs handed out
+	TokensIssued = NewCounterVec("iyo_tokens_issued_total",
+		"Access tokens and JWTs issued by grant type", "grant_type")
+	// SMSSent counts the sms handed to a provider, result is success or failure
+	SMSSent = NewCounterVec("iyo_sms_sent_total",
+		"Sms sent by provider and result (success or failure)", "provider", "result")
+	// SMSStatus counts the delivery statuses the providers report to the status callbacks
+	SMSStatus = NewCounterVec("iyo_sms_status_total",
+		"Delivery statuses of sms reported by the providers, by provider and status (sent, delivered or failed)", "provider", "status")
+	// SMSRateLimited counts the sms that were not sent because too many were sent to the phone number already
+	SMSRateLimited = NewCounterVec("iyo_sms_rate_limited_total",
+		"Sms that were not sent because the rate limit of the phone number was reached")
+	// EmailsSent counts the emails handed to a provider, result is success or failure
+	EmailsSent = NewCounterVec("iyo_emails_sent_total",
+		"Emails sent by provider and result (success or failure)", "provider", "result")
+	// CacheLookups counts the lookups in the caches of the api middlewares, result is hit or miss
+	CacheLookups = NewCounterVec("iyo_cache_lookups_total",
+		"Lookups in the caches by cache and result (hit or miss)", "cache", "result")
+	// WebhookDeliveries counts the attempts to deliver an event to a webhook, result is success or failure
+	WebhookDeliveries = NewCounterVec("iyo_webhook_deliveries_total",
+		"Attempts to deliver an event to a webhook by result (success or failure)", "result")
+	// JobRuns counts the runs of the maintenance jobs, result is success or failure
+	JobRuns = NewCounterVec("iyo_job_runs_total",
+		"Runs of the maintenance jobs by job and result (success or failure)", "job", "result")
+	// JobRemoved counts the documents removed by the maintenance jobs
+	JobRemoved = NewCounterVec("iyo_job_removed_total",
+		"Documents removed by the maintenance jobs by job", "job")
+	// JobDuration measures how long the maintenance jobs take
+	JobDuration = NewHistogramVec("iyo_job_duration_seconds",
+		"Duration of the runs of the maintenance jobs by job", []float64{.1, .5, 1, 5, 10, 30, 60, 300, 900}, "job")
+)
+
+// Result returns the result label of an operation
+func Result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+type contextKey int
+
+const routeKey contextKey = iota
+
+// unmatchedRoute is the route label of the requests that do not match a route
+const unmatchedRoute = "unmatched"
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware measures the duration of the requests, the route label is set by the handlers wrapped with Route
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := unmatchedRoute
+		context.Set(r, routeKey, &route)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		HTTPRequestDuration.Observe(time.Since(start).Seconds(), r.Method, route, strconv.Itoa(recorder.status))
+	})
+}
+
+// Route wraps the handler of a route so Middleware labels the requests it handles with the route template
+func Route(template string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := context.Get(r, routeKey).(*string); ok {
+			*route = template
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RouteTemplate returns the template of the route that handles a request, it is empty before the route is matched
+func RouteTemplate(r *http.Request) string {
+	if route, ok := context.Get(r, routeKey).(*string); ok && *route != unmatchedRoute {
+		return *route
+	}
+	return ""
+}
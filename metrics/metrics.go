@@ -0,0 +1,273 @@
+// Package metrics collects the metrics of the identity server and exposes them in the Prometheus text format.
+// Only counters, histograms and gauges that are computed when they are scraped are supported,
+// that is all the identity server needs.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// collector is a metric that can write itself in the text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds the metrics that are exposed
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []collector
+}
+
+// DefaultRegistry holds the metrics created with the New functions of this package
+var DefaultRegistry = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic("metric " + c.name() + " is already registered")
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	r.mutex.Lock()
+	collectors := append([]collector{}, r.collectors...)
+	r.mutex.Unlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	var buffer bytes.Buffer
+	for _, c := range collectors {
+		c.write(&buffer)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buffer.Bytes())
+}
+
+// Handler returns the handler of the /metrics endpoint
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+// vector keeps the time series of a metric by their label values
+type vector struct {
+	metricName string
+	help       string
+	labelNames []string
+	mutex      sync.Mutex
+	values     map[string]interface{}
+}
+
+func newVector(name, help string, labelNames []string) vector {
+	return vector{metricName: name, help: help, labelNames: labelNames, values: make(map[string]interface{})}
+}
+
+func (v *vector) name() string {
+	return v.metricName
+}
+
+// get returns the value of the series with the given label values, it is created with newValue if it does not exist.
+// The caller must hold the mutex.
+func (v *vector) get(labelValues []string, newValue func() interface{}) interface{} {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.metricName, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	value, found := v.values[key]
+	if !found {
+		value = newValue()
+		v.values[key] = value
+	}
+	return value
+}
+
+// sortedKeys returns the keys of the series in a stable order. The caller must hold the mutex.
+func (v *vector) sortedKeys() []string {
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vector) writeHeader(w io.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.metricName, escapeHelp(v.help), v.metricName, metricType)
+}
+
+// labels formats the label pairs of a series, extra pairs like the le of a histogram bucket are added at the end
+func (v *vector) labels(key string, extra ...string) string {
+	var pairs []string
+	if len(v.labelNames) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", v.labelNames[i], escapeLabelValue(value)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], escapeLabelValue(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	vector
+}
+
+// NewCounterVec creates and registers a counter
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{vector: newVector(name, help, labelNames)}
+	DefaultRegistry.register(c)
+	return c
+}
+
+// Inc increments the counter of the series with the given label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a positive value to the counter of the series with the given label values
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	counter := c.get(labelValues, func() interface{} { return new(float64) }).(*float64)
+	*counter += value
+}
+
+// Value returns the current value of a series
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return *c.get(labelValues, func() interface{} { return new(float64) }).(*float64)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.writeHeader(w, "counter")
+	for _, key := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labels(key), formatFloat(*c.values[key].(*float64)))
+	}
+}
+
+// DefaultBuckets are the upper bounds in seconds of the buckets used for request durations
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramVec counts observations like request durations in buckets, partitioned by labels
+type HistogramVec struct {
+	vector
+	buckets []float64
+}
+
+type histogram struct {
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+// NewHistogramVec creates and registers a histogram, buckets are the sorted upper bounds of the buckets
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{vector: newVector(name, help, labelNames), buckets: buckets}
+	DefaultRegistry.register(h)
+	return h
+}
+
+// Observe adds an observation to the series with the given label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	series := h.get(labelValues, func() interface{} {
+		return &histogram{bucketCounts: make([]uint64, len(h.buckets))}
+	}).(*histogram)
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			series.bucketCounts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.writeHeader(w, "histogram")
+	for _, key := range h.sortedKeys() {
+		series := h.values[key].(*histogram)
+		for i, upperBound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labels(key, "le", formatFloat(upperBound)), series.bucketCounts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labels(key, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labels(key), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labels(key), series.count)
+	}
+}
+
+// GaugeFunc is a gauge that is computed when the metrics are scraped
+type GaugeFunc struct {
+	metricName string
+	help       string
+	value      func() (float64, error)
+}
+
+// NewGaugeFunc creates and registers a gauge, the gauge is left out if value returns an error
+func NewGaugeFunc(name, help string, value func() (float64, error)) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, value: value}
+	DefaultRegistry.register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string {
+	return g.metricName
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	value, err := g.value()
+	if err != nil {
+		log.Debugf("Failed to compute metric %s: %s", g.metricName, err)
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.metricName, escapeHelp(g.help), g.metricName, g.metricName, formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(r *Registry) string {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "A counter\nwith a newline", "outcome")
+	c.Inc("success")
+	c.Add(2, "success")
+	c.Inc(`fail"ure`)
+	assert.Equal(t, float64(3), c.Value("success"))
+	assert.Panics(t, func() { c.Inc() }, "the label values must match the label names")
+
+	body := scrape(DefaultRegistry)
+	assert.Contains(t, body, "# HELP test_counter_total A counter\\nwith a newline\n# TYPE test_counter_total counter\n")
+	assert.Contains(t, body, `test_counter_total{outcome="fail\"ure"} 1`)
+	assert.Contains(t, body, `test_counter_total{outcome="success"} 3`)
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "A histogram", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(5, "/a")
+
+	body := scrape(DefaultRegistry)
+	assert.Contains(t, body, `test_duration_seconds_bucket{route="/a",le="0.1"} 1`)
+	assert.Contains(t, body, `test_duration_seconds_bucket{route="/a",le="1"} 2`)
+	assert.Contains(t, body, `test_duration_seconds_bucket{route="/a",le="+Inf"} 3`)
+	assert.Contains(t, body, `test_duration_seconds_sum{route="/a"} 5.55`)
+	assert.Contains(t, body, `test_duration_seconds_count{route="/a"} 3`)
+}
+
+func TestGaugeFunc(t *testing.T) {
+	NewGaugeFunc("test_gauge", "A gauge", func() (float64, error) { return 42, nil })
+	NewGaugeFunc("test_failing_gauge", "A gauge that fails", func() (float64, error) { return 0, errors.New("down") })
+
+	body := scrape(DefaultRegistry)
+	assert.Contains(t, body, "# TYPE test_gauge gauge\ntest_gauge 42\n")
+	assert.NotContains(t, body, "test_failing_gauge", "gauges that fail are left out")
+	assert.Panics(t, func() { NewGaugeFunc("test_gauge", "Again", nil) }, "names are unique")
+}
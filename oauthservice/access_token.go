@@ -11,7 +11,10 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/user"
 	"github.com/itsyouonline/identityserver/db/user/apikey"
+	"github.com/itsyouonline/identityserver/logging"
+	"github.com/itsyouonline/identityserver/metrics"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -90,6 +93,8 @@ func (service *Service) AccessTokenHandler(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
+	logging.SetClientID(r, clientID)
+
 	//Also accept some alternatives
 	if grantType == "authorization_code" {
 		grantType = ""
@@ -118,10 +123,19 @@ func (service *Service) AccessTokenHandler(w http.ResponseWriter, r *http.Reques
 		at, httpStatusCode = convertCodeToAccessTokenHandler(code, clientID, clientSecret, redirectURI, state, mgr)
 	}
 
+	if grantType == "" {
+		grantType = "authorization_code"
+	}
 	if httpStatusCode != http.StatusOK {
+		if httpStatusCode < http.StatusInternalServerError {
+			logging.SecurityEvent(r, logging.EventTokenRejected).WithField("grant_type", grantType).Warn("Token request rejected")
+		}
 		http.Error(w, http.StatusText(httpStatusCode), httpStatusCode)
 		return
 	}
+	if at.Username != "" {
+		logging.SetUsername(r, at.Username)
+	}
 
 	// It is also possible to immediately get a JWT by specifying 'id_token' as the response type
 	// In this case, the scope parameter needs to be given to prevent consumers to accidentally handing out too powerful tokens to third party services
@@ -148,6 +162,7 @@ func (service *Service) AccessTokenHandler(w http.ResponseWriter, r *http.Reques
 
 		// if client could accept JSON we give the token as JSON string
 		// if not, in plain text with the application/jwt mime-type
+		tokenIssued(r, grantType)
 		if strings.Index(r.Header.Get("Accept"), "application/json") >= 0 {
 			w.Header().Set("Content-type", "application/json")
 			json.NewEncoder(w).Encode(map[string]string{"access_token": tokenString})
@@ -196,11 +211,18 @@ func (service *Service) AccessTokenHandler(w http.ResponseWriter, r *http.Reques
 		},
 	}
 
+	tokenIssued(r, grantType)
 	w.Header().Set("Content-type", "application/json")
 	json.NewEncoder(w).Encode(&response)
 }
 
-func clientCredentialsTokenHandler(clientID string, secret string, mgr *Manager, r *http.Request) (at *AccessToken, httpStatusCode int) {
+//tokenIssued counts an issued access token or JWT and logs it as a security event
+func tokenIssued(r *http.Request, grantType string) {
+	metrics.TokensIssued.Inc(grantType)
+	logging.SecurityEvent(r, logging.EventTokenIssued).WithField("grant_type", grantType).Info("Token issued")
+}
+
+func clientCredentialsTokenHandler(clientID string, secret string, mgr Manager, r *http.Request) (at *AccessToken, httpStatusCode int) {
 	httpStatusCode = http.StatusOK
 	var scopes string
 	username := ""
@@ -230,6 +252,17 @@ func clientCredentialsTokenHandler(clientID string, secret string, mgr *Manager,
 		scopes = strings.Join(apikey.Scopes, " ")
 		log.Info("scopes ", scopes)
 		username = apikey.Username
+		userobj, err := user.NewManager(r).GetByName(username)
+		if err != nil {
+			log.Error("Error getting the user of the api key: ", err)
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		if userobj.Suspended || userobj.DeletionScheduled != nil {
+			log.Debug("Api key of suspended or deleted user ", username)
+			httpStatusCode = http.StatusForbidden
+			return
+		}
 	} else {
 		organization = clientID
 		scopes = "organization:owner"
@@ -239,7 +272,7 @@ func clientCredentialsTokenHandler(clientID string, secret string, mgr *Manager,
 	return
 }
 
-func convertCodeToAccessTokenHandler(code string, clientID string, secret string, redirectURI string, state string, mgr *Manager) (at *AccessToken, httpStatusCode int) {
+func convertCodeToAccessTokenHandler(code string, clientID string, secret string, redirectURI string, state string, mgr Manager) (at *AccessToken, httpStatusCode int) {
 	httpStatusCode = http.StatusOK
 
 	ar, err := mgr.getAuthorizationRequest(code)
@@ -306,7 +339,7 @@ func (service *Service) createItsYouOnlineAdminToken(username string, r *http.Re
 // verifyScopes checks for a user:memberof:clientid scope. If present, check if the user
 // really is a member or owner in this organization. Should this not be the case,
 // remove the scope and add the correct memberof:childorg scopes
-func verifyScopes(scopeString string, username string, clientID string, orgMgr *organization.Manager) (string, error) {
+func verifyScopes(scopeString string, username string, clientID string, orgMgr organization.Manager) (string, error) {
 	scopes := strings.Split(scopeString, ",")
 	for i, scope := range scopes {
 		// If the scope is memberof:clientid, where clientid is the globalid of the
@@ -340,7 +373,7 @@ func verifyScopes(scopeString string, username string, clientID string, orgMgr *
 	return scopeString, nil
 }
 
-func findSuborgScopes(parentID string, username string, orgMgr *organization.Manager) ([]string, error) {
+func findSuborgScopes(parentID string, username string, orgMgr organization.Manager) ([]string, error) {
 	subOrgs, err := orgMgr.GetSubOrganizations(parentID)
 	if err != nil {
 		return nil, err
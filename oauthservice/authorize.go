@@ -158,6 +158,19 @@ func (service *Service) AuthorizeHandler(w http.ResponseWriter, request *http.Re
 		}
 	}
 
+	// The session of a user that got suspended or requested the deletion of the account does not authorize anything anymore,
+	// the login refuses the user until the account is reinstated or restored
+	userobj, err := user.NewManager(request).GetByName(username)
+	if err != nil {
+		log.Error("Failed to get the authorizing user: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if userobj.Suspended || userobj.DeletionScheduled != nil {
+		redirectToNextPage(w, request)
+		return
+	}
+
 	//Validate client and redirect_uri
 	redirectURI, err := url.QueryUnescape(request.Form.Get("redirect_uri"))
 	if err != nil {
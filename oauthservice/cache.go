@@ -0,0 +1,87 @@
+package oauthservice
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/itsyouonline/identityserver/cache"
+	"github.com/itsyouonline/identityserver/db/invalidation"
+)
+
+// accessTokenCache caches the valid access tokens by token,
+// the entries are tagged with the user, organization and client of the token
+var accessTokenCache = cache.New("accesstokens")
+
+//accessTokenTags returns the tags that invalidate the cached access token
+func accessTokenTags(at *AccessToken) []string {
+	return []string{"user:" + at.Username, "organization:" + at.GlobalID, "client:" + at.ClientID}
+}
+
+//invalidatingManager invalidates the cached access tokens when they are changed or removed
+type invalidatingManager struct {
+	Manager
+	r *http.Request
+}
+
+func (m invalidatingManager) RemoveOrganizationScopes(globalID string, username string) (err error) {
+	if err = m.Manager.RemoveOrganizationScopes(globalID, username); err == nil {
+		invalidation.Invalidate(m.r, "user:"+username)
+	}
+	return
+}
+
+func (m invalidatingManager) RemoveTokensByUser(username string) (err error) {
+	if err = m.Manager.RemoveTokensByUser(username); err == nil {
+		invalidation.Invalidate(m.r, "user:"+username)
+	}
+	return
+}
+
+func (m invalidatingManager) RemoveAllTokens() (err error) {
+	if err = m.Manager.RemoveAllTokens(); err == nil {
+		invalidation.Invalidate(m.r, "accesstokens")
+	}
+	return
+}
+
+func (m invalidatingManager) RemoveTokensByGlobalID(globalid string) (err error) {
+	if err = m.Manager.RemoveTokensByGlobalID(globalid); err == nil {
+		invalidation.Invalidate(m.r, "organization:"+globalid)
+	}
+	return
+}
+
+func (m invalidatingManager) RemoveClientsByID(clientid string) (err error) {
+	if err = m.Manager.RemoveClientsByID(clientid); err == nil {
+		invalidation.Invalidate(m.r, "client:"+clientid)
+	}
+	return
+}
+
+//cachedManager looks up the access tokens in the cache first
+type cachedManager struct {
+	Manager
+}
+
+//NewCachedManager creates a Manager that caches the access tokens for a short time.
+// Removed tokens are invalidated right away, so it can be used to authenticate the api requests.
+func NewCachedManager(r *http.Request) Manager {
+	return cachedManager{Manager: NewManager(r)}
+}
+
+//GetAccessToken returns a cached copy of the access token, nil if it does not exist or it expired
+func (m cachedManager) GetAccessToken(token string) (*AccessToken, error) {
+	if cached, found := accessTokenCache.Get(token); found {
+		at := cached.(AccessToken)
+		if !at.IsExpired() {
+			return &at, nil
+		}
+	}
+	generation := accessTokenCache.Generation()
+	at, err := m.Manager.GetAccessToken(token)
+	if err != nil || at == nil {
+		return at, err
+	}
+	accessTokenCache.Set(token, *at, generation, time.Until(at.ExpirationTime()), accessTokenTags(at)...)
+	return at, nil
+}
@@ -2,7 +2,6 @@ package oauthservice
 
 import (
 	"net/http"
-	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -19,70 +18,48 @@ const (
 	refreshTokenCollectionName = "oauth_refreshtokens"
 )
 
-//InitModels initialize models in mongo, if required.
-func InitModels() {
-	index := mgo.Index{
-		Key:    []string{"authorizationcode"},
-		Unique: true,
-	} //Do not drop duplicates since it would hijack another authorizationrequest, better to error out
-
-	db.EnsureIndex(requestsCollectionName, index)
-
-	//TODO: unique username/clientid combination
-
-	automaticExpiration := mgo.Index{
-		Key:         []string{"createdat"},
-		ExpireAfter: time.Second * 10,
-		Background:  true,
-	}
-	db.EnsureIndex(requestsCollectionName, automaticExpiration)
-
-	index = mgo.Index{
-		Key:    []string{"accesstoken"},
-		Unique: true,
-	} //Do not drop duplicates since it would hijack another authorizationrequest, better to error out
-
-	db.EnsureIndex(tokensCollectionName, index)
-
-	//TODO: unique username/clientid combination
-
-	automaticExpiration = mgo.Index{
-		Key:         []string{"createdat"},
-		ExpireAfter: AccessTokenExpiration,
-		Background:  true,
-	}
-	db.EnsureIndex(tokensCollectionName, automaticExpiration)
-
-	index = mgo.Index{
-		Key:    []string{"clientid", "label"},
-		Unique: true,
-	}
-	db.EnsureIndex(clientsCollectionName, index)
-
-	index = mgo.Index{
-		Key:    []string{"refreshtoken"},
-		Unique: true,
-	} //Do not drop duplicates since it would hijack another refreshtoken, better to error out
-
-	db.EnsureIndex(refreshTokenCollectionName, index)
-	automaticExpiration = mgo.Index{
-		Key:         []string{"lastused"},
-		ExpireAfter: time.Second * 86400 * 30,
-		Background:  true,
-	}
-	db.EnsureIndex(refreshTokenCollectionName, automaticExpiration)
-
+//Manager is used to store the oauth clients, tokens and authorization requests
+type Manager interface {
+	getAuthorizationRequest(authorizationcode string) (ar *authorizationRequest, err error)
+	saveAuthorizationRequest(ar *authorizationRequest) (err error)
+	saveAccessToken(at *AccessToken) (err error)
+	GetAccessToken(token string) (at *AccessToken, err error)
+	RemoveOrganizationScopes(globalID string, username string) error
+	RemoveTokensByUser(username string) (err error)
+	RemoveAllTokens() (err error)
+	getRefreshToken(token string) (rt *refreshToken, err error)
+	saveRefreshToken(t *refreshToken) (err error)
+	GetClientLabels(clientID string) (labels []string, err error)
+	CreateClient(client *Oauth2Client) (err error)
+	UpdateClient(clientID, oldLabel, newLabel string, callbackURL string, clientcredentialsGrantType bool) (err error)
+	DeleteClient(clientID, label string) (err error)
+	DeleteAllForOrganization(clientID string) (err error)
+	GetClient(clientID, label string) (client *Oauth2Client, err error)
+	AllByClientID(clientID string) (clients []*Oauth2Client, err error)
+	getClientByCredentials(clientID, secret string) (client *Oauth2Client, err error)
+	RemoveTokensByGlobalID(globalid string) error
+	RemoveClientsByID(clientid string) error
 }
 
-//Manager is used to store
-type Manager struct {
+//mongoManager stores the oauth data in mongo
+type mongoManager struct {
 	session *mgo.Session
 }
 
-//NewManager creates and initializes a new Manager
-func NewManager(r *http.Request) *Manager {
+//NewManager creates and initializes a new Manager, the cached access tokens are invalidated when tokens are removed
+func NewManager(r *http.Request) Manager {
+	return invalidatingManager{Manager: newManager(r), r: r}
+}
+
+func newManager(r *http.Request) Manager {
+	if memory := db.GetMemoryBackend(r); memory != nil {
+		return newMemoryManager(memory)
+	}
+	if pg := db.GetPostgres(r); pg != nil {
+		return newPostgresManager(pg)
+	}
 	session := db.GetDBSession(r)
-	return &Manager{
+	return &mongoManager{
 		session: session,
 	}
 }
@@ -94,22 +71,22 @@ type ClientManager interface {
 }
 
 //getAuthorizationRequestCollection returns the mongo collection for the authorizationRequests
-func (m *Manager) getAuthorizationRequestCollection() *mgo.Collection {
+func (m *mongoManager) getAuthorizationRequestCollection() *mgo.Collection {
 	return db.GetCollection(m.session, requestsCollectionName)
 }
 
 //getAccessTokenCollection returns the mongo collection for the accessTokens
-func (m *Manager) getAccessTokenCollection() *mgo.Collection {
+func (m *mongoManager) getAccessTokenCollection() *mgo.Collection {
 	return db.GetCollection(m.session, tokensCollectionName)
 }
 
 //getRefreshTokenCollection returns the mongo collection for the accessTokens
-func (m *Manager) getRefreshTokenCollection() *mgo.Collection {
+func (m *mongoManager) getRefreshTokenCollection() *mgo.Collection {
 	return db.GetCollection(m.session, refreshTokenCollectionName)
 }
 
 // Get an authorizationRequest by it's authorizationcode.
-func (m *Manager) getAuthorizationRequest(authorizationcode string) (ar *authorizationRequest, err error) {
+func (m *mongoManager) getAuthorizationRequest(authorizationcode string) (ar *authorizationRequest, err error) {
 	ar = &authorizationRequest{}
 
 	err = m.getAuthorizationRequestCollection().Find(bson.M{"authorizationcode": authorizationcode}).One(ar)
@@ -122,7 +99,7 @@ func (m *Manager) getAuthorizationRequest(authorizationcode string) (ar *authori
 }
 
 // saveAuthorizationRequest stores an authorizationRequest, only adding new authorizationRequests is allowed, updating is not
-func (m *Manager) saveAuthorizationRequest(ar *authorizationRequest) (err error) {
+func (m *mongoManager) saveAuthorizationRequest(ar *authorizationRequest) (err error) {
 	// TODO: Validation!
 
 	err = m.getAuthorizationRequestCollection().Insert(ar)
@@ -131,7 +108,7 @@ func (m *Manager) saveAuthorizationRequest(ar *authorizationRequest) (err error)
 }
 
 // saveAccessToken stores an accessToken, only adding new accessTokens is allowed, updating is not
-func (m *Manager) saveAccessToken(at *AccessToken) (err error) {
+func (m *mongoManager) saveAccessToken(at *AccessToken) (err error) {
 	// TODO: Validation!
 
 	err = m.getAccessTokenCollection().Insert(at)
@@ -141,7 +118,7 @@ func (m *Manager) saveAccessToken(at *AccessToken) (err error) {
 
 //GetAccessToken gets an access token by it's actual token string
 // If the token is not found or is expired, nil is returned
-func (m *Manager) GetAccessToken(token string) (at *AccessToken, err error) {
+func (m *mongoManager) GetAccessToken(token string) (at *AccessToken, err error) {
 	at = &AccessToken{}
 
 	err = m.getAccessTokenCollection().Find(bson.M{"accesstoken": token}).One(at)
@@ -163,7 +140,7 @@ func (m *Manager) GetAccessToken(token string) (at *AccessToken, err error) {
 }
 
 // RemoveOrganizationScopes removes all user:memberof:globalid scopes from all access tokens
-func (m *Manager) RemoveOrganizationScopes(globalID string, username string) error {
+func (m *mongoManager) RemoveOrganizationScopes(globalID string, username string) error {
 	var accessTokens []AccessToken
 	qry := bson.M{"username": username}
 	err := m.getAccessTokenCollection().Find(qry).All(&accessTokens)
@@ -188,6 +165,27 @@ func (m *Manager) RemoveOrganizationScopes(globalID string, username string) err
 	return nil
 }
 
+// RemoveTokensByUser removes the access tokens, refresh tokens and pending authorization requests of a user
+func (m *mongoManager) RemoveTokensByUser(username string) (err error) {
+	if _, err = m.getAccessTokenCollection().RemoveAll(bson.M{"username": username}); err != nil {
+		return
+	}
+	if _, err = m.getRefreshTokenCollection().RemoveAll(bson.M{"subject": username}); err != nil {
+		return
+	}
+	_, err = m.getAuthorizationRequestCollection().RemoveAll(bson.M{"username": username})
+	return
+}
+
+// RemoveAllTokens removes all access tokens and refresh tokens
+func (m *mongoManager) RemoveAllTokens() (err error) {
+	if _, err = m.getAccessTokenCollection().RemoveAll(nil); err != nil {
+		return
+	}
+	_, err = m.getRefreshTokenCollection().RemoveAll(nil)
+	return
+}
+
 func removeScope(scope string, scopeToRemove string) string {
 	scopes := []string{}
 	split := strings.Split(scope, ",")
@@ -201,7 +199,7 @@ func removeScope(scope string, scopeToRemove string) string {
 
 //getRefreshToken gets an refresh token by it's refresh token string
 // If the token is not found or is expired, nil is returned
-func (m *Manager) getRefreshToken(token string) (rt *refreshToken, err error) {
+func (m *mongoManager) getRefreshToken(token string) (rt *refreshToken, err error) {
 	rt = &refreshToken{}
 
 	err = m.getRefreshTokenCollection().Find(bson.M{"refreshtoken": token}).One(rt)
@@ -217,7 +215,7 @@ func (m *Manager) getRefreshToken(token string) (rt *refreshToken, err error) {
 }
 
 // saveRefreshToken stores a refreshToken
-func (m *Manager) saveRefreshToken(t *refreshToken) (err error) {
+func (m *mongoManager) saveRefreshToken(t *refreshToken) (err error) {
 	if t == nil {
 		return
 	}
@@ -228,12 +226,12 @@ func (m *Manager) saveRefreshToken(t *refreshToken) (err error) {
 }
 
 //getClientsCollection returns the mongo collection for the clients
-func (m *Manager) getClientsCollection() *mgo.Collection {
+func (m *mongoManager) getClientsCollection() *mgo.Collection {
 	return db.GetCollection(m.session, clientsCollectionName)
 }
 
 //GetClientLabels returns a list of labels for which there are apikeys registered for a specific client
-func (m *Manager) GetClientLabels(clientID string) (labels []string, err error) {
+func (m *mongoManager) GetClientLabels(clientID string) (labels []string, err error) {
 	results := []struct{ Label string }{}
 	err = m.getClientsCollection().Find(bson.M{"clientid": clientID}).Select(bson.M{"label": 1}).All(&results)
 	labels = make([]string, len(results), len(results))
@@ -244,7 +242,7 @@ func (m *Manager) GetClientLabels(clientID string) (labels []string, err error)
 }
 
 //CreateClient saves an Oauth2 client
-func (m *Manager) CreateClient(client *Oauth2Client) (err error) {
+func (m *mongoManager) CreateClient(client *Oauth2Client) (err error) {
 
 	err = m.getClientsCollection().Insert(client)
 
@@ -255,7 +253,7 @@ func (m *Manager) CreateClient(client *Oauth2Client) (err error) {
 }
 
 //UpdateClient updates the label, callbackurl and clientCredentialsGrantType properties of a client
-func (m *Manager) UpdateClient(clientID, oldLabel, newLabel string, callbackURL string, clientcredentialsGrantType bool) (err error) {
+func (m *mongoManager) UpdateClient(clientID, oldLabel, newLabel string, callbackURL string, clientcredentialsGrantType bool) (err error) {
 
 	_, err = m.getClientsCollection().UpdateAll(bson.M{"clientid": clientID, "label": oldLabel}, bson.M{"$set": bson.M{"label": newLabel, "callbackurl": callbackURL, "clientcredentialsgranttype": clientcredentialsGrantType}})
 
@@ -266,19 +264,19 @@ func (m *Manager) UpdateClient(clientID, oldLabel, newLabel string, callbackURL
 }
 
 //DeleteClient removes a client secret by it's clientID and label
-func (m *Manager) DeleteClient(clientID, label string) (err error) {
+func (m *mongoManager) DeleteClient(clientID, label string) (err error) {
 	_, err = m.getClientsCollection().RemoveAll(bson.M{"clientid": clientID, "label": label})
 	return
 }
 
 //DeleteAllForOrganization removes al client secrets for the organization
-func (m *Manager) DeleteAllForOrganization(clientID string) (err error) {
+func (m *mongoManager) DeleteAllForOrganization(clientID string) (err error) {
 	_, err = m.getClientsCollection().RemoveAll(bson.M{"clientid": clientID})
 	return
 }
 
 //GetClient retrieves a client given a clientid and a label
-func (m *Manager) GetClient(clientID, label string) (client *Oauth2Client, err error) {
+func (m *mongoManager) GetClient(clientID, label string) (client *Oauth2Client, err error) {
 	client = &Oauth2Client{}
 	err = m.getClientsCollection().Find(bson.M{"clientid": clientID, "label": label}).One(client)
 	if err == mgo.ErrNotFound {
@@ -290,7 +288,7 @@ func (m *Manager) GetClient(clientID, label string) (client *Oauth2Client, err e
 }
 
 //AllByClientID retrieves all clients with a given ID
-func (m *Manager) AllByClientID(clientID string) (clients []*Oauth2Client, err error) {
+func (m *mongoManager) AllByClientID(clientID string) (clients []*Oauth2Client, err error) {
 	clients = make([]*Oauth2Client, 0)
 
 	err = m.getClientsCollection().Find(bson.M{"clientid": clientID}).All(&clients)
@@ -298,7 +296,7 @@ func (m *Manager) AllByClientID(clientID string) (clients []*Oauth2Client, err e
 }
 
 //GetClientByCredentials retrieves a client given a clientid and a secret
-func (m *Manager) getClientByCredentials(clientID, secret string) (client *Oauth2Client, err error) {
+func (m *mongoManager) getClientByCredentials(clientID, secret string) (client *Oauth2Client, err error) {
 	client = &Oauth2Client{}
 	err = m.getClientsCollection().Find(bson.M{"clientid": clientID, "secret": secret}).One(client)
 	if err == mgo.ErrNotFound {
@@ -310,13 +308,13 @@ func (m *Manager) getClientByCredentials(clientID, secret string) (client *Oauth
 }
 
 //RemoveTokensByGlobalID removes oauth tokens by global id
-func (m *Manager) RemoveTokensByGlobalID(globalid string) error {
+func (m *mongoManager) RemoveTokensByGlobalID(globalid string) error {
 	_, err := m.getAccessTokenCollection().RemoveAll(bson.M{"globalid": globalid})
 	return err
 }
 
 //RemoveClientsByID removes oauth clients by client id
-func (m *Manager) RemoveClientsByID(clientid string) error {
+func (m *mongoManager) RemoveClientsByID(clientid string) error {
 	_, err := m.getAccessTokenCollection().RemoveAll(bson.M{"clientid": clientid})
 	return err
 }
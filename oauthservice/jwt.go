@@ -16,6 +16,7 @@ import (
 	"github.com/itsyouonline/identityserver/db/organization"
 	"github.com/itsyouonline/identityserver/db/user"
 	"github.com/itsyouonline/identityserver/db/validation"
+	"github.com/itsyouonline/identityserver/logging"
 )
 
 var errUnauthorized = errors.New("Unauthorized")
@@ -65,9 +66,14 @@ func (service *Service) JWTHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if at == nil || at.IsExpired() {
+			logging.SecurityEvent(r, logging.EventTokenRejected).WithField("grant_type", "jwt").Warn("Unknown or expired access token")
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
+		logging.SetClientID(r, at.ClientID)
+		if at.Username != "" {
+			logging.SetUsername(r, at.Username)
+		}
 
 		validity := parseValidity(r)
 
@@ -82,6 +88,7 @@ func (service *Service) JWTHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	tokenIssued(r, "jwt")
 	w.Header().Set("Content-type", "application/jwt")
 	w.Write([]byte(tokenString))
 }
@@ -130,6 +137,7 @@ func (service *Service) RefreshJWTHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	if rt == nil {
+		logging.SecurityEvent(r, logging.EventTokenRejected).WithField("grant_type", "jwt_refresh").Warn("Unknown refresh token")
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
@@ -138,6 +146,10 @@ func (service *Service) RefreshJWTHandler(w http.ResponseWriter, r *http.Request
 	orgMgr := organization.NewManager(r)
 	clientID := originalToken.Claims["azp"].(string)
 	username, isUser := originalToken.Claims["username"].(string)
+	logging.SetClientID(r, clientID)
+	if isUser {
+		logging.SetUsername(r, username)
+	}
 	// if a username is set verify the possible membership scopes.
 	scope := strings.Join(rt.Scopes, ",")
 	if isUser {
@@ -188,6 +200,7 @@ func (service *Service) RefreshJWTHandler(w http.ResponseWriter, r *http.Request
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	tokenIssued(r, "jwt_refresh")
 	w.Header().Set("Content-type", "application/jwt")
 	w.Write([]byte(tokenString))
 }
@@ -0,0 +1,279 @@
+package oauthservice
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// refreshTokenValidity is the expiration of unused refresh tokens in mongo
+const refreshTokenValidity = 30 * 24 * time.Hour
+
+type memoryStore struct {
+	sync.Mutex
+	authorizationRequests map[string]authorizationRequest
+	accessTokens          []AccessToken
+	refreshTokens         map[string]refreshToken
+	clients               []Oauth2Client
+}
+
+//memoryManager keeps the oauth data in a db.MemoryBackend
+type memoryManager struct {
+	store *memoryStore
+}
+
+func newMemoryManager(backend *db.MemoryBackend) *memoryManager {
+	store := backend.Store(tokensCollectionName, func() interface{} {
+		return &memoryStore{
+			authorizationRequests: make(map[string]authorizationRequest),
+			refreshTokens:         make(map[string]refreshToken),
+		}
+	}).(*memoryStore)
+	return &memoryManager{store: store}
+}
+
+func (m *memoryManager) getAuthorizationRequest(authorizationcode string) (*authorizationRequest, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	ar, ok := m.store.authorizationRequests[authorizationcode]
+	if !ok {
+		return nil, nil
+	}
+	return &ar, nil
+}
+
+func (m *memoryManager) saveAuthorizationRequest(ar *authorizationRequest) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if _, exists := m.store.authorizationRequests[ar.AuthorizationCode]; exists {
+		return db.ErrDuplicate
+	}
+	m.store.authorizationRequests[ar.AuthorizationCode] = *ar
+	return nil
+}
+
+func (m *memoryManager) saveAccessToken(at *AccessToken) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for _, existing := range m.store.accessTokens {
+		if existing.AccessToken == at.AccessToken {
+			return db.ErrDuplicate
+		}
+	}
+	stored := *at
+	stored.ID = bson.NewObjectId()
+	m.store.accessTokens = append(m.store.accessTokens, stored)
+	return nil
+}
+
+func (m *memoryManager) GetAccessToken(token string) (*AccessToken, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for _, at := range m.store.accessTokens {
+		if at.AccessToken == token {
+			if at.IsExpired() {
+				return nil, nil
+			}
+			return &at, nil
+		}
+	}
+	return nil, nil
+}
+
+// removeAccessTokens removes the access tokens that match, the caller holds the lock
+func (m *memoryManager) removeAccessTokens(match func(at *AccessToken) bool) {
+	remaining := []AccessToken{}
+	for _, at := range m.store.accessTokens {
+		if !match(&at) {
+			remaining = append(remaining, at)
+		}
+	}
+	m.store.accessTokens = remaining
+}
+
+func (m *memoryManager) RemoveOrganizationScopes(globalID string, username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	memberOfScope := fmt.Sprintf("user:memberof:%s", globalID)
+	for i, at := range m.store.accessTokens {
+		if at.Username == username && !at.IsExpired() && strings.Contains(at.Scope, memberOfScope) {
+			m.store.accessTokens[i].Scope = removeScope(at.Scope, memberOfScope)
+		}
+	}
+	return nil
+}
+
+func (m *memoryManager) RemoveTokensByUser(username string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.removeAccessTokens(func(at *AccessToken) bool { return at.Username == username })
+	for key, rt := range m.store.refreshTokens {
+		if rt.Subject == username {
+			delete(m.store.refreshTokens, key)
+		}
+	}
+	for key, ar := range m.store.authorizationRequests {
+		if ar.Username == username {
+			delete(m.store.authorizationRequests, key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryManager) RemoveAllTokens() error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.accessTokens = nil
+	m.store.refreshTokens = make(map[string]refreshToken)
+	return nil
+}
+
+func (m *memoryManager) getRefreshToken(token string) (*refreshToken, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	rt, ok := m.store.refreshTokens[token]
+	if !ok || time.Since(time.Time(rt.LastUsed)) > refreshTokenValidity {
+		return nil, nil
+	}
+	var copied refreshToken
+	if err := db.CopyDocument(&copied, &rt); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+func (m *memoryManager) saveRefreshToken(t *refreshToken) error {
+	if t == nil {
+		return nil
+	}
+	var stored refreshToken
+	if err := db.CopyDocument(&stored, t); err != nil {
+		return err
+	}
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.store.refreshTokens[t.RefreshToken] = stored
+	return nil
+}
+
+// findClients returns copies of the clients that match, the caller holds the lock
+func (m *memoryManager) findClients(match func(client *Oauth2Client) bool) []*Oauth2Client {
+	clients := make([]*Oauth2Client, 0)
+	for _, client := range m.store.clients {
+		if match(&client) {
+			copied := client
+			clients = append(clients, &copied)
+		}
+	}
+	return clients
+}
+
+func (m *memoryManager) GetClientLabels(clientID string) ([]string, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	clients := m.findClients(func(client *Oauth2Client) bool { return client.ClientID == clientID })
+	labels := make([]string, len(clients), len(clients))
+	for i, client := range clients {
+		labels[i] = client.Label
+	}
+	return labels, nil
+}
+
+func (m *memoryManager) CreateClient(client *Oauth2Client) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	for _, existing := range m.store.clients {
+		if existing.ClientID == client.ClientID && existing.Label == client.Label {
+			return db.ErrDuplicate
+		}
+	}
+	m.store.clients = append(m.store.clients, *client)
+	return nil
+}
+
+func (m *memoryManager) UpdateClient(clientID, oldLabel, newLabel string, callbackURL string, clientcredentialsGrantType bool) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	if oldLabel != newLabel {
+		for _, existing := range m.store.clients {
+			if existing.ClientID == clientID && existing.Label == newLabel {
+				return db.ErrDuplicate
+			}
+		}
+	}
+	for i, client := range m.store.clients {
+		if client.ClientID == clientID && client.Label == oldLabel {
+			m.store.clients[i].Label = newLabel
+			m.store.clients[i].CallbackURL = callbackURL
+			m.store.clients[i].ClientCredentialsGrantType = clientcredentialsGrantType
+		}
+	}
+	return nil
+}
+
+// removeClients removes the clients that match
+func (m *memoryManager) removeClients(match func(client *Oauth2Client) bool) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	remaining := []Oauth2Client{}
+	for _, client := range m.store.clients {
+		if !match(&client) {
+			remaining = append(remaining, client)
+		}
+	}
+	m.store.clients = remaining
+	return nil
+}
+
+func (m *memoryManager) DeleteClient(clientID, label string) error {
+	return m.removeClients(func(client *Oauth2Client) bool { return client.ClientID == clientID && client.Label == label })
+}
+
+func (m *memoryManager) DeleteAllForOrganization(clientID string) error {
+	return m.removeClients(func(client *Oauth2Client) bool { return client.ClientID == clientID })
+}
+
+func (m *memoryManager) GetClient(clientID, label string) (*Oauth2Client, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	clients := m.findClients(func(client *Oauth2Client) bool { return client.ClientID == clientID && client.Label == label })
+	if len(clients) == 0 {
+		return nil, nil
+	}
+	return clients[0], nil
+}
+
+func (m *memoryManager) AllByClientID(clientID string) ([]*Oauth2Client, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	return m.findClients(func(client *Oauth2Client) bool { return client.ClientID == clientID }), nil
+}
+
+func (m *memoryManager) getClientByCredentials(clientID, secret string) (*Oauth2Client, error) {
+	m.store.Lock()
+	defer m.store.Unlock()
+	clients := m.findClients(func(client *Oauth2Client) bool { return client.ClientID == clientID && client.Secret == secret })
+	if len(clients) == 0 {
+		return nil, nil
+	}
+	return clients[0], nil
+}
+
+func (m *memoryManager) RemoveTokensByGlobalID(globalid string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.removeAccessTokens(func(at *AccessToken) bool { return at.GlobalID == globalid })
+	return nil
+}
+
+// RemoveClientsByID removes the access tokens of a client, like the mongo implementation does
+func (m *memoryManager) RemoveClientsByID(clientid string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+	m.removeAccessTokens(func(at *AccessToken) bool { return at.ClientID == clientid })
+	return nil
+}
@@ -0,0 +1,242 @@
+package oauthservice
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+)
+
+var postgresAuthorizationRequests = &db.PostgresCollection{
+	Table: "oauth_authorizationrequests",
+	Columns: func(document interface{}) map[string]interface{} {
+		ar := document.(*authorizationRequest)
+		return map[string]interface{}{
+			"authorizationcode": ar.AuthorizationCode,
+			"username":          ar.Username,
+			"expires_at":        ar.CreatedAt.Add(time.Second * 10),
+		}
+	},
+}
+
+var postgresAccessTokens = &db.PostgresCollection{
+	Table: "oauth_accesstokens",
+	Columns: func(document interface{}) map[string]interface{} {
+		at := document.(*AccessToken)
+		return map[string]interface{}{
+			"accesstoken": at.AccessToken,
+			"username":    at.Username,
+			"globalid":    at.GlobalID,
+			"clientid":    at.ClientID,
+			"expires_at":  at.ExpirationTime(),
+		}
+	},
+}
+
+var postgresRefreshTokens = &db.PostgresCollection{
+	Table: "oauth_refreshtokens",
+	Columns: func(document interface{}) map[string]interface{} {
+		rt := document.(*refreshToken)
+		return map[string]interface{}{
+			"refreshtoken": rt.RefreshToken,
+			"subject":      rt.Subject,
+			"expires_at":   time.Time(rt.LastUsed).Add(refreshTokenValidity),
+		}
+	},
+}
+
+var postgresClients = &db.PostgresCollection{
+	Table: "oauth_clients",
+	Columns: func(document interface{}) map[string]interface{} {
+		client := document.(*Oauth2Client)
+		return map[string]interface{}{
+			"clientid": client.ClientID,
+			"label":    client.Label,
+		}
+	},
+}
+
+//postgresManager stores the oauth data in a postgres database
+type postgresManager struct {
+	db *sql.DB
+}
+
+func newPostgresManager(pg *sql.DB) *postgresManager {
+	return &postgresManager{db: pg}
+}
+
+func (m *postgresManager) getAuthorizationRequest(authorizationcode string) (*authorizationRequest, error) {
+	ar := &authorizationRequest{}
+	err := postgresAuthorizationRequests.FindOne(m.db, ar, "authorizationcode = $1", authorizationcode)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			err = nil
+		}
+		return nil, err
+	}
+	return ar, nil
+}
+
+func (m *postgresManager) saveAuthorizationRequest(ar *authorizationRequest) error {
+	return postgresAuthorizationRequests.Insert(m.db, ar)
+}
+
+func (m *postgresManager) saveAccessToken(at *AccessToken) error {
+	return postgresAccessTokens.Insert(m.db, at)
+}
+
+func (m *postgresManager) GetAccessToken(token string) (*AccessToken, error) {
+	at := &AccessToken{}
+	err := postgresAccessTokens.FindOne(m.db, at, "accesstoken = $1", token)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			err = nil
+		}
+		return nil, err
+	}
+	if at.IsExpired() {
+		return nil, nil
+	}
+	return at, nil
+}
+
+func (m *postgresManager) RemoveOrganizationScopes(globalID string, username string) error {
+	memberOfScope := fmt.Sprintf("user:memberof:%s", globalID)
+	_, err := postgresAccessTokens.Update(m.db, "username = $1", []interface{}{username},
+		func() interface{} { return &AccessToken{} },
+		func(document interface{}) error {
+			at := document.(*AccessToken)
+			if !at.IsExpired() && strings.Contains(at.Scope, memberOfScope) {
+				at.Scope = removeScope(at.Scope, memberOfScope)
+			}
+			return nil
+		})
+	return err
+}
+
+func (m *postgresManager) RemoveTokensByUser(username string) (err error) {
+	if _, err = postgresAccessTokens.Remove(m.db, "username = $1", username); err != nil {
+		return
+	}
+	if _, err = postgresRefreshTokens.Remove(m.db, "subject = $1", username); err != nil {
+		return
+	}
+	_, err = postgresAuthorizationRequests.Remove(m.db, "username = $1", username)
+	return
+}
+
+func (m *postgresManager) RemoveAllTokens() (err error) {
+	if _, err = postgresAccessTokens.Remove(m.db, ""); err != nil {
+		return
+	}
+	_, err = postgresRefreshTokens.Remove(m.db, "")
+	return
+}
+
+func (m *postgresManager) getRefreshToken(token string) (*refreshToken, error) {
+	rt := &refreshToken{}
+	err := postgresRefreshTokens.FindOne(m.db, rt, "refreshtoken = $1", token)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			err = nil
+		}
+		return nil, err
+	}
+	return rt, nil
+}
+
+func (m *postgresManager) saveRefreshToken(t *refreshToken) error {
+	if t == nil {
+		return nil
+	}
+	return postgresRefreshTokens.Upsert(m.db, "refreshtoken = $1", []interface{}{t.RefreshToken},
+		func() interface{} { return &refreshToken{} },
+		func(document interface{}) error { return db.CopyDocument(document, t) })
+}
+
+func (m *postgresManager) findClients(where string, args ...interface{}) ([]*Oauth2Client, error) {
+	var found []Oauth2Client
+	if err := postgresClients.Find(m.db, &found, where, args...); err != nil {
+		return nil, err
+	}
+	clients := make([]*Oauth2Client, len(found))
+	for i := range found {
+		clients[i] = &found[i]
+	}
+	return clients, nil
+}
+
+func (m *postgresManager) GetClientLabels(clientID string) ([]string, error) {
+	clients, err := m.findClients("clientid = $1", clientID)
+	labels := make([]string, len(clients), len(clients))
+	for i, client := range clients {
+		labels[i] = client.Label
+	}
+	return labels, err
+}
+
+func (m *postgresManager) CreateClient(client *Oauth2Client) error {
+	return postgresClients.Insert(m.db, client)
+}
+
+func (m *postgresManager) UpdateClient(clientID, oldLabel, newLabel string, callbackURL string, clientcredentialsGrantType bool) error {
+	_, err := postgresClients.Update(m.db, "clientid = $1 AND label = $2", []interface{}{clientID, oldLabel},
+		func() interface{} { return &Oauth2Client{} },
+		func(document interface{}) error {
+			client := document.(*Oauth2Client)
+			client.Label = newLabel
+			client.CallbackURL = callbackURL
+			client.ClientCredentialsGrantType = clientcredentialsGrantType
+			return nil
+		})
+	return err
+}
+
+func (m *postgresManager) DeleteClient(clientID, label string) error {
+	_, err := postgresClients.Remove(m.db, "clientid = $1 AND label = $2", clientID, label)
+	return err
+}
+
+func (m *postgresManager) DeleteAllForOrganization(clientID string) error {
+	_, err := postgresClients.Remove(m.db, "clientid = $1", clientID)
+	return err
+}
+
+func (m *postgresManager) GetClient(clientID, label string) (*Oauth2Client, error) {
+	clients, err := m.findClients("clientid = $1 AND label = $2", clientID, label)
+	if err != nil || len(clients) == 0 {
+		return nil, err
+	}
+	return clients[0], nil
+}
+
+func (m *postgresManager) AllByClientID(clientID string) ([]*Oauth2Client, error) {
+	return m.findClients("clientid = $1", clientID)
+}
+
+func (m *postgresManager) getClientByCredentials(clientID, secret string) (*Oauth2Client, error) {
+	clients, err := m.findClients("clientid = $1", clientID)
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range clients {
+		if client.Secret == secret {
+			return client, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *postgresManager) RemoveTokensByGlobalID(globalid string) error {
+	_, err := postgresAccessTokens.Remove(m.db, "globalid = $1", globalid)
+	return err
+}
+
+// RemoveClientsByID removes the access tokens of a client, like the mongo implementation does
+func (m *postgresManager) RemoveClientsByID(clientid string) error {
+	_, err := postgresAccessTokens.Remove(m.db, "clientid = $1", clientid)
+	return err
+}
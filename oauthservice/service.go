@@ -98,6 +98,4 @@ func (service *Service) AddRoutes(router *mux.Router) {
 		func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Add("Allow", "GET,POST")
 		}).Methods("OPTIONS")
-
-	InitModels()
 }
@@ -1,12 +1,51 @@
 package routes
 
 import (
+	"net"
 	"net/http"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/gorilla/handlers"
+	"github.com/itsyouonline/identityserver/logging"
 )
 
+// responseRecorder remembers the status code and size of a response for the access log
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// LoggingMiddleware logs every request with the fields of logging.FromRequest, like the request id and the user
 func LoggingMiddleware(h http.Handler) http.Handler {
-	return handlers.LoggingHandler(log.StandardLogger().Out, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(recorder, r)
+
+		remoteAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remoteAddr = r.RemoteAddr
+		}
+		logging.FromRequest(r).WithFields(log.Fields{
+			"method":      r.Method,
+			"uri":         r.URL.RequestURI(),
+			"status":      recorder.status,
+			"size":        recorder.size,
+			"duration_ms": time.Since(start).Seconds() * 1000,
+			"remote_addr": remoteAddr,
+			"user_agent":  r.UserAgent(),
+		}).Info("Request handled")
+	})
 }
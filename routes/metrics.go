@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"reflect"
+
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/metrics"
+)
+
+//instrumentRoutes wraps the route handlers so the request metrics are labeled with the route template
+func instrumentRoutes(router *mux.Router) error {
+	return router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		handler := route.GetHandler()
+		if handler == nil {
+			return nil
+		}
+		if _, subrouter := handler.(*mux.Router); subrouter {
+			return nil
+		}
+		route.Handler(metrics.Route(pathTemplate(route), handler))
+		return nil
+	})
+}
+
+//pathTemplate returns the path template of a route like /users/{username},
+// the vendored mux version has no GetPathTemplate yet so it is read from the path regexp of the route
+func pathTemplate(route *mux.Route) string {
+	group := reflect.ValueOf(route).Elem().FieldByName("regexp")
+	if !group.IsValid() || group.IsNil() {
+		return ""
+	}
+	path := group.Elem().FieldByName("path")
+	if !path.IsValid() || path.IsNil() {
+		return ""
+	}
+	return path.Elem().FieldByName("template").String()
+}
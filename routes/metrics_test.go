@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentRoutes(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/users/{username}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	api := r.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/organizations/{globalid}/members", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST")
+	assert.NoError(t, instrumentRoutes(r))
+	handler := metrics.Middleware(r)
+
+	for _, request := range []*http.Request{
+		httptest.NewRequest("GET", "/users/bob", nil),
+		httptest.NewRequest("GET", "/users/alice", nil),
+		httptest.NewRequest("POST", "/api/organizations/myorg/members", nil),
+		httptest.NewRequest("GET", "/nonexisting", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/users/{username}",code="404"} 2`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="POST",route="/api/organizations/{globalid}/members",code="200"} 1`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="unmatched",code="404"} 1`)
+}
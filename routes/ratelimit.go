@@ -0,0 +1,160 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"github.com/itsyouonline/identityserver/identityservice/security"
+	"github.com/itsyouonline/identityserver/oauthservice"
+	"github.com/itsyouonline/identityserver/siteservice/middleware"
+)
+
+//rateLimitGroup limits the requests to a group of routes together
+type rateLimitGroup struct {
+	limiter *middleware.RateLimiter
+	//templates are the route templates of the group, a template ending in /* matches all routes below it
+	templates []string
+	//methods limits the group to some methods, all methods are limited if it is empty
+	methods []string
+}
+
+func (g rateLimitGroup) matches(template string) bool {
+	for _, t := range g.templates {
+		if t == template || (strings.HasSuffix(t, "/*") && strings.HasPrefix(template, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+//rateLimitGroups declares the rate limited routes, a route belongs to the first group that matches it.
+// The limits are read when the routes are created, so they can be configured before.
+func rateLimitGroups() []rateLimitGroup {
+	return []rateLimitGroup{
+		{
+			limiter: middleware.NewRateLimiter("sms",
+				middleware.Rule{Name: "ip", Key: middleware.ByIP, Period: middleware.DefaultRateLimitPeriod, Limit: middleware.DefaultRateLimit}),
+			templates: []string{
+				"/register/resendvalidation",
+				"/login/smscode/{phoneLabel}",
+				"/login/resendsms",
+				"/login/magiclink",
+				"/api/users/{username}/phonenumbers/{label}/validate",
+			},
+		},
+		{
+			limiter: middleware.NewRateLimiter("login",
+				middleware.Rule{Name: "ip", Key: middleware.ByIP, Period: middleware.LoginRateLimitPeriod, Limit: middleware.LoginRateLimit}),
+			templates: []string{"/login", "/login/*", "/register", "/register/*"},
+			// The pages and the polling of the sms confirmation are not limited
+			methods: []string{"POST"},
+		},
+		{
+			limiter: middleware.NewRateLimiter("token",
+				middleware.Rule{Name: "client", Key: middleware.ByClientID, Period: middleware.TokenRateLimitPeriod, Limit: middleware.TokenRateLimit},
+				middleware.Rule{Name: "ip", Key: middleware.ByIP, Period: middleware.TokenRateLimitPeriod, Limit: middleware.TokenRateLimit}),
+			templates: []string{"/v1/oauth/access_token", "/v1/oauth/jwt", "/v1/oauth/jwt/refresh"},
+		},
+		{
+			// The api authenticates the requests in the handlers of the routes, after the limiter,
+			// so the user and organization rules validate the token themselves
+			limiter: middleware.NewRateLimiter("api",
+				middleware.Rule{Name: "ip", Key: middleware.ByIP, Period: middleware.APIRateLimitPeriod, Limit: middleware.APIRateLimit},
+				middleware.Rule{Name: "user", Key: byAuthenticatedUser, Period: middleware.APIRateLimitPeriod, Limit: middleware.APIRateLimit},
+				middleware.Rule{Name: "organization", Key: byAuthenticatedOrganization, Period: middleware.APIRateLimitPeriod, Limit: middleware.APIRateLimit}),
+			templates: []string{"/api/*"},
+		},
+	}
+}
+
+//byAuthenticatedUser keys the api requests by the user of the access token, jwt or website session
+func byAuthenticatedUser(r *http.Request) string {
+	username, _ := authenticatedIdentity(r)
+	return username
+}
+
+//byAuthenticatedOrganization keys the api requests an organization makes with a token of its own api key,
+// the requests an organization makes on behalf of a user are counted for the user
+func byAuthenticatedOrganization(r *http.Request) string {
+	username, clientID := authenticatedIdentity(r)
+	if username != "" {
+		return ""
+	}
+	return clientID
+}
+
+//authenticatedIdentity returns the user and client a request is authenticated as, they are empty if the token is invalid.
+// The token is validated like the oauth middleware of the api does, so the requests are not counted for
+// the user in the path or claimed by a forged token. The result is kept in the request context for the other rules.
+func authenticatedIdentity(r *http.Request) (username, clientID string) {
+	if identity, ok := context.Get(r, "ratelimit_identity").([2]string); ok {
+		return identity[0], identity[1]
+	}
+	username, clientID = validateIdentity(r)
+	context.Set(r, "ratelimit_identity", [2]string{username, clientID})
+	return
+}
+
+func validateIdentity(r *http.Request) (username, clientID string) {
+	token, err := oauth2.GetValidJWT(r, security.JWTPublicKey)
+	if err != nil {
+		return
+	}
+	if token != nil {
+		username, _ = token.Claims["username"].(string)
+		clientID, _ = token.Claims["azp"].(string)
+		return
+	}
+	om := security.OAuth2Middleware{}
+	if accessToken := om.GetAccessToken(r); accessToken != "" {
+		at, err := oauthservice.NewCachedManager(r).GetAccessToken(accessToken)
+		if err != nil || at == nil {
+			return
+		}
+		return at.Username, at.ClientID
+	}
+	if webuser, ok := context.Get(r, "webuser").(string); ok && webuser != "" {
+		return webuser, "itsyouonline"
+	}
+	return
+}
+
+//limitRoutes wraps the handlers of the routes in the rate limit groups
+func limitRoutes(router *mux.Router, groups []rateLimitGroup) error {
+	return router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		handler := route.GetHandler()
+		if handler == nil {
+			return nil
+		}
+		if _, subrouter := handler.(*mux.Router); subrouter {
+			return nil
+		}
+		template := pathTemplate(route)
+		for _, group := range groups {
+			if group.matches(template) {
+				route.Handler(limitMethods(group.methods, group.limiter.Handler(handler), handler))
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+//limitMethods passes the requests with one of the methods to limited and the others to unlimited
+func limitMethods(methods []string, limited, unlimited http.Handler) http.Handler {
+	if len(methods) == 0 {
+		return limited
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range methods {
+			if r.Method == method {
+				limited.ServeHTTP(w, r)
+				return
+			}
+		}
+		unlimited.ServeHTTP(w, r)
+	})
+}
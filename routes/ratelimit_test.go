@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/siteservice/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitRoutes(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r := mux.NewRouter()
+	r.HandleFunc("/login", ok).Methods("GET", "POST")
+	r.HandleFunc("/login/smscode/{phoneLabel}", ok).Methods("POST")
+	api := r.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/users/{username}", ok).Methods("GET")
+
+	limit := func(group string, limit int) *middleware.RateLimiter {
+		return &middleware.RateLimiter{
+			Group: group,
+			Rules: []middleware.Rule{{Name: "ip", Key: middleware.ByIP, Period: time.Minute, Limit: limit}},
+			Store: middleware.NewMemoryStore(),
+		}
+	}
+	groups := []rateLimitGroup{
+		{limiter: limit("sms", 1), templates: []string{"/login/smscode/{phoneLabel}"}},
+		{limiter: limit("login", 2), templates: []string{"/login", "/login/*"}, methods: []string{"POST"}},
+	}
+	assert.NoError(t, limitRoutes(r, groups))
+
+	status := func(method, path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, status("POST", "/login/smscode/main"))
+	assert.Equal(t, http.StatusTooManyRequests, status("POST", "/login/smscode/main"), "a route belongs to the first group that matches")
+	assert.Equal(t, http.StatusOK, status("POST", "/login"))
+	assert.Equal(t, http.StatusOK, status("POST", "/login"))
+	assert.Equal(t, http.StatusTooManyRequests, status("POST", "/login"))
+	assert.Equal(t, http.StatusOK, status("GET", "/login"), "only the methods of the group are limited")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, status("GET", "/api/users/bob"), "routes outside the groups are not limited")
+	}
+}
+
+func TestLimitAPIByAuthenticatedUser(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r := mux.NewRouter()
+	r.KeepContext = true
+	api := r.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/users/{username}", ok).Methods("GET")
+	groups := []rateLimitGroup{{
+		limiter: &middleware.RateLimiter{
+			Group: "api",
+			Rules: []middleware.Rule{
+				{Name: "user", Key: byAuthenticatedUser, Period: time.Minute, Limit: 2},
+				{Name: "organization", Key: byAuthenticatedOrganization, Period: time.Minute, Limit: 2},
+			},
+			Store: middleware.NewMemoryStore(),
+		},
+		templates: []string{"/api/*"},
+	}}
+	assert.NoError(t, limitRoutes(r, groups))
+
+	status := func(webuser, path string) int {
+		w := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", path, nil)
+		if webuser != "" {
+			context.Set(request, "webuser", webuser)
+		}
+		context.ClearHandler(r).ServeHTTP(w, request)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, status("alice", "/api/users/bob"))
+	assert.Equal(t, http.StatusOK, status("alice", "/api/users/carol"))
+	assert.Equal(t, http.StatusTooManyRequests, status("alice", "/api/users/dave"), "the requests are counted for the authenticated user, not the user in the path")
+	assert.Equal(t, http.StatusOK, status("bob", "/api/users/bob"))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, status("", "/api/users/alice"), "unauthenticated requests are not counted for the user in the path")
+	}
+}
@@ -3,11 +3,16 @@ package routes
 import (
 	"net/http"
 
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/context"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 
 	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/health"
 	"github.com/itsyouonline/identityserver/identityservice"
+	"github.com/itsyouonline/identityserver/logging"
+	"github.com/itsyouonline/identityserver/metrics"
 	"github.com/itsyouonline/identityserver/oauthservice"
 	"github.com/itsyouonline/identityserver/siteservice"
 )
@@ -15,21 +20,31 @@ import (
 //GetRouter contructs the router hierarchy and registers all handlers and middleware
 func GetRouter(sc *siteservice.Service, is *identityservice.Service, oauthsc *oauthservice.Service) http.Handler {
 	r := mux.NewRouter().StrictSlash(true)
+	// The request context is cleared by the outermost middleware instead,
+	// so the access log can still see the user and client the handlers found
+	r.KeepContext = true
 
 	sc.AddRoutes(r)
-	sc.InitModels()
 
 	apiRouter := r.PathPrefix("/api").Subrouter()
 	is.AddRoutes(apiRouter)
 	oauthsc.AddRoutes(r)
 
+	if err := limitRoutes(r, rateLimitGroups()); err != nil {
+		log.Error("Failed to rate limit the routes: ", err)
+	}
+	if err := instrumentRoutes(r); err != nil {
+		log.Error("Failed to label the request metrics with the routes: ", err)
+	}
+
 	// Add middlewares
 	router := NewRouter(r)
 
-	dbmw := db.DBMiddleware()
+	dbmw := db.DBMiddleware(db.DefaultBackend())
 	recovery := handlers.RecoveryHandler()
 
-	router.Use(recovery, LoggingMiddleware, dbmw, sc.SetWebUserMiddleWare)
+	router.Use(recovery, LoggingMiddleware, metrics.Middleware, dbmw, sc.SetWebUserMiddleWare,
+		logging.RequestIDMiddleware, context.ClearHandler, health.Middleware)
 
 	return router.Handler()
 }
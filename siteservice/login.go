@@ -11,6 +11,7 @@ import (
 
 	"github.com/gorilla/sessions"
 	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/audit"
 	"github.com/itsyouonline/identityserver/oauthservice"
 	"github.com/itsyouonline/identityserver/siteservice/website/packaged/html"
 	"gopkg.in/mgo.v2"
@@ -23,43 +24,28 @@ import (
 	"github.com/itsyouonline/identityserver/credentials/password"
 	"github.com/itsyouonline/identityserver/credentials/totp"
 	organizationdb "github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/smshistory"
 	"github.com/itsyouonline/identityserver/db/user"
 	validationdb "github.com/itsyouonline/identityserver/db/validation"
 	"github.com/itsyouonline/identityserver/identityservice/invitations"
 	"github.com/itsyouonline/identityserver/identityservice/organization"
+	"github.com/itsyouonline/identityserver/logging"
+	"github.com/itsyouonline/identityserver/metrics"
 	"github.com/itsyouonline/identityserver/tools"
 	"github.com/itsyouonline/identityserver/validation"
-	"gopkg.in/mgo.v2/bson"
 )
 
 const (
 	mongoLoginCollectionName = "loginsessions"
 )
 
-//initLoginModels initialize models in mongo
-func (service *Service) initLoginModels() {
-	index := mgo.Index{
-		Key:      []string{"sessionkey"},
-		Unique:   true,
-		DropDups: false,
-	}
-
-	db.EnsureIndex(mongoLoginCollectionName, index)
-
-	automaticExpiration := mgo.Index{
-		Key:         []string{"createdat"},
-		ExpireAfter: time.Second * 60 * 10,
-		Background:  true,
-	}
-	db.EnsureIndex(mongoLoginCollectionName, automaticExpiration)
-
-}
-
 type loginSessionInformation struct {
 	SessionKey string
 	SMSCode    string
 	Confirmed  bool
 	CreatedAt  time.Time
+	// Phonenumber the sms code was sent to, the delivery status of the sms is looked up with it
+	Phonenumber string
 }
 
 func newLoginSessionInformation() (sessionInformation *loginSessionInformation, err error) {
@@ -124,6 +110,7 @@ func (service *Service) ProcessLoginForm(w http.ResponseWriter, request *http.Re
 
 	u, err := organization.SearchUser(request, login)
 	if err == mgo.ErrNotFound {
+		loginFailed(request, "password", "Login with an unknown username, email address or phone number")
 		w.WriteHeader(422)
 		return
 	} else if err != nil {
@@ -132,6 +119,7 @@ func (service *Service) ProcessLoginForm(w http.ResponseWriter, request *http.Re
 		return
 	}
 	userexists := err != mgo.ErrNotFound
+	logging.SetUsername(request, u.Username)
 
 	var validpassword bool
 	passwdMgr := password.NewManager(request)
@@ -145,6 +133,7 @@ func (service *Service) ProcessLoginForm(w http.ResponseWriter, request *http.Re
 	// Remove last 2FA entry if an invalid password is entered
 	validcredentials := userexists && validpassword
 	if !validcredentials {
+		loginFailed(request, "password", "Invalid password")
 		if client != "" {
 			l2faMgr := organizationdb.NewLast2FAManager(request)
 			if l2faMgr.Exists(client, u.Username) {
@@ -154,26 +143,52 @@ func (service *Service) ProcessLoginForm(w http.ResponseWriter, request *http.Re
 		w.WriteHeader(422)
 		return
 	}
+	service.completeFirstFactor(w, request, u.Username)
+}
+
+//completeFirstFactor stores the user in the login session after the first factor was verified,
+// and completes the login right away if the 2FA validity of the requesting organization has not passed yet
+func (service *Service) completeFirstFactor(w http.ResponseWriter, request *http.Request, username string) {
+	userobj, err := user.NewManager(request).GetByName(username)
+	if err != nil {
+		log.Error("Failed to get the user logging in: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if userobj.Suspended {
+		logging.SecurityEvent(request, logging.EventSuspendedLogin).Warn("Suspended user tried to log in")
+		writeErrorResponse(w, "account_suspended", http.StatusUnprocessableEntity)
+		return
+	}
 	loginSession, err := service.GetSession(request, SessionLogin, "loginsession")
 	if err != nil {
 		log.Error(err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	loginSession.Values["username"] = u.Username
+	if userobj.DeletionScheduled != nil {
+		// Remember who passed the first factor so the account can be restored with RestoreAccount
+		loginSession.Values["restoreusername"] = username
+		sessions.Save(request, w)
+		writeErrorResponse(w, "account_deletion_scheduled", http.StatusUnprocessableEntity)
+		return
+	}
+	delete(loginSession.Values, "restoreusername")
+	loginSession.Values["username"] = username
+	client := request.URL.Query().Get("client_id")
 	//check if 2fa validity has passed
 	if client != "" {
 
 		// Check if we have a valid authorization
 		requestedScopes := oauth2.SplitScopeString(request.Form.Get("scope"))
-		possibleScopes, err := service.identityService.FilterPossibleScopes(request, u.Username, requestedScopes, true)
+		possibleScopes, err := service.identityService.FilterPossibleScopes(request, username, requestedScopes, true)
 		if err != nil {
 			log.Error(err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
 
-		validAuthorization, err := service.verifyExistingAuthorization(request, u.Username, client, possibleScopes)
+		validAuthorization, err := service.verifyExistingAuthorization(request, username, client, possibleScopes)
 		if err != nil {
 			log.Error("Failed to check if authorization is valid: ", err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -183,8 +198,8 @@ func (service *Service) ProcessLoginForm(w http.ResponseWriter, request *http.Re
 		// Only attempt to bypass 2fa if we have a valid authorization
 		if validAuthorization {
 			l2faMgr := organizationdb.NewLast2FAManager(request)
-			if l2faMgr.Exists(client, u.Username) {
-				timestamp, err := l2faMgr.GetLast2FA(client, u.Username)
+			if l2faMgr.Exists(client, username) {
+				timestamp, err := l2faMgr.GetLast2FA(client, username)
 				if err != nil {
 					log.Error(err)
 					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -200,7 +215,8 @@ func (service *Service) ProcessLoginForm(w http.ResponseWriter, request *http.Re
 				timeconverted := time.Time(timestamp)
 				if timeconverted.Add(time.Second * time.Duration(seconds)).After(time.Now()) {
 					log.Debug("Try to build protected session")
-					service.loginOauthUser(w, request, u.Username)
+					loginSucceeded(request, "last2fa")
+					service.loginOauthUser(w, request, username)
 					return
 				}
 			}
@@ -211,6 +227,35 @@ func (service *Service) ProcessLoginForm(w http.ResponseWriter, request *http.Re
 	w.WriteHeader(http.StatusNoContent)
 }
 
+//RestoreAccount is the handler for POST /login/restoreaccount, it cancels the scheduled deletion of the account
+// that passed the first factor of the login and continues the login like completeFirstFactor
+func (service *Service) RestoreAccount(w http.ResponseWriter, request *http.Request) {
+	if err := request.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	loginSession, err := service.GetSession(request, SessionLogin, "loginsession")
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	username, _ := loginSession.Values["restoreusername"].(string)
+	if username == "" {
+		sessions.Save(request, w)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	logging.SetUsername(request, username)
+	if err = user.NewManager(request).CancelDeletion(username); err != nil {
+		log.Error("Failed to restore the account of ", username, ": ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	log.Info("Restored the account of ", username)
+	service.completeFirstFactor(w, request, username)
+}
+
 func (service *Service) verifyExistingAuthorization(request *http.Request, username string, clientID string, possibleScopes []string) (bool, error) {
 	authorizedScopes, err := service.identityService.FilterAuthorizedScopes(request, username, clientID, possibleScopes)
 	if err != nil {
@@ -265,6 +310,7 @@ func (service *Service) GetTwoFactorAuthenticationMethods(w http.ResponseWriter,
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
+	logging.SetUsername(request, username)
 	userMgr := user.NewManager(request)
 	userFromDB, err := userMgr.GetByName(username)
 	if err != nil {
@@ -313,6 +359,9 @@ func (service *Service) getUserLoggingIn(request *http.Request) (username string
 	if savedusername != nil {
 		username, _ = savedusername.(string)
 	}
+	if username != "" {
+		logging.SetUsername(request, username)
+	}
 	return
 }
 
@@ -360,6 +409,7 @@ func (service *Service) GetSmsCode(w http.ResponseWriter, request *http.Request)
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
+	logging.SetUsername(request, username)
 	userMgr := user.NewManager(request)
 	userFromDB, err := userMgr.GetByName(username)
 	if err != nil {
@@ -373,14 +423,14 @@ func (service *Service) GetSmsCode(w http.ResponseWriter, request *http.Request)
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
+	sessionInfo.Phonenumber = phoneNumber.Phonenumber
 	loginSession.Values["sessionkey"] = sessionInfo.SessionKey
 	authClientId := loginSession.Values["auth_client_id"]
 	authenticatingOrganization := ""
 	if authClientId != nil {
 		authenticatingOrganization = authClientId.(string)
 	}
-	mgoCollection := db.GetCollection(db.GetDBSession(request), mongoLoginCollectionName)
-	mgoCollection.Insert(sessionInfo)
+	newLoginStore(request).saveLoginSession(sessionInfo)
 
 	link := fmt.Sprintf("https://%s/sc?c=%s&k=%s&l=%s", request.Host, sessionInfo.SMSCode, url.QueryEscape(sessionInfo.SessionKey), values.LangKey)
 	translationValues := make(tools.TranslationValues)
@@ -419,6 +469,7 @@ func (service *Service) GetSmsCode(w http.ResponseWriter, request *http.Request)
 	}
 
 	sessions.Save(request, w)
+	logging.FromRequest(request).WithField("phone_label", phoneLabel).Info("Sending the login sms code")
 	go service.smsService.Send(phoneNumber.Phonenumber, smsmessage)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -451,9 +502,11 @@ func (service *Service) ProcessTOTPConfirmation(w http.ResponseWriter, request *
 		return
 	}
 	if !validtotpcode { //TODO: limit to 3 failed attempts
+		loginFailed(request, "totp", "Invalid totp code")
 		w.WriteHeader(422)
 		return
 	}
+	loginSucceeded(request, "totp")
 
 	//add last 2fa date if logging in with oauth2
 	service.storeLast2FALogin(request, username)
@@ -470,13 +523,7 @@ func (service *Service) getLoginSessionInformation(request *http.Request, sessio
 		}
 	}
 
-	mgoCollection := db.GetCollection(db.GetDBSession(request), mongoLoginCollectionName)
-	sessionInfo = &loginSessionInformation{}
-	err = mgoCollection.Find(bson.M{"sessionkey": sessionKey}).One(sessionInfo)
-	if err == mgo.ErrNotFound {
-		sessionInfo = nil
-		err = nil
-	}
+	sessionInfo, err = newLoginStore(request).getLoginSession(sessionKey)
 	return
 }
 
@@ -537,9 +584,7 @@ func (service *Service) PhonenumberValidationAndLogin(w http.ResponseWriter, req
 		service.renderSMSConfirmationPage(w, request, translations["invalidlink"], "")
 		return
 	}
-	mgoCollection := db.GetCollection(db.GetDBSession(request), mongoLoginCollectionName)
-
-	_, err = mgoCollection.UpdateAll(bson.M{"sessionkey": key}, bson.M{"$set": bson.M{"confirmed": true}})
+	err = newLoginStore(request).confirmLoginSession(key)
 	if err != nil {
 		log.Error("Error while confirming sms 2fa - ", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -594,9 +639,7 @@ func (service *Service) MobileSMSConfirmation(w http.ResponseWriter, request *ht
 		service.renderSMSConfirmationPage(w, request, translations["invalidlink"], "")
 		return
 	}
-	mgoCollection := db.GetCollection(db.GetDBSession(request), mongoLoginCollectionName)
-
-	_, err = mgoCollection.UpdateAll(bson.M{"sessionkey": sessionKey}, bson.M{"$set": bson.M{"confirmed": true}})
+	err = newLoginStore(request).confirmLoginSession(sessionKey)
 	if err != nil {
 		log.Error("Error while confirming sms 2fa - ", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -613,11 +656,21 @@ func (service *Service) Check2FASMSConfirmation(w http.ResponseWriter, request *
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	response := map[string]bool{}
-	if sessionInfo == nil {
-		response["confirmed"] = false
-	} else {
-		response["confirmed"] = sessionInfo.Confirmed
+	response := struct {
+		Confirmed bool `json:"confirmed"`
+		// Delivery is the delivery status of the sms the provider reported, empty if it is unknown
+		Delivery string `json:"delivery,omitempty"`
+	}{}
+	if sessionInfo != nil {
+		response.Confirmed = sessionInfo.Confirmed
+		if !sessionInfo.Confirmed && sessionInfo.Phonenumber != "" {
+			sms, err := smshistory.NewManager(request).GetLastSince(sessionInfo.Phonenumber, sessionInfo.CreatedAt)
+			if err != nil && !db.IsNotFound(err) {
+				log.Error("Failed to get the delivery status of the login sms: ", err)
+			} else if err == nil {
+				response.Delivery = sms.Status
+			}
+		}
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -657,8 +710,8 @@ func (service *Service) Process2FASMSConfirmation(w http.ResponseWriter, request
 
 		if !validsmscode {
 			// TODO: limit to 3 failed attempts
+			loginFailed(request, "sms", "Invalid sms code")
 			w.WriteHeader(422)
-			log.Debugf("Expected code %s, got %s", sessionInfo.SMSCode, values.Smscode)
 			return
 		}
 	}
@@ -671,12 +724,12 @@ func (service *Service) Process2FASMSConfirmation(w http.ResponseWriter, request
 	validationkey, _ := loginSession.Values["phonenumbervalidationkey"].(string)
 	err = service.phonenumberValidationService.ConfirmValidation(request, validationkey, values.Smscode)
 	if err == validation.ErrInvalidCode {
-		log.Debug("Invalid code")
 		// TODO: limit to 3 failed attempts
+		loginFailed(request, "sms", "Invalid sms code")
 		w.WriteHeader(422)
-		log.Debug("invalid code")
 		return
 	}
+	loginSucceeded(request, "sms")
 	userMgr := user.NewManager(request)
 	userMgr.RemoveExpireDate(username)
 
@@ -686,6 +739,36 @@ func (service *Service) Process2FASMSConfirmation(w http.ResponseWriter, request
 	service.loginUser(w, request, username)
 }
 
+//loginSucceeded counts a completed login and logs it as a security event,
+// method is the factor that completed it: totp, sms or last2fa
+func loginSucceeded(request *http.Request, method string) {
+	metrics.Logins.Inc("success", method)
+	logging.SecurityEvent(request, logging.EventLoginSucceeded).WithField("method", method).Info("Login succeeded")
+	recordLogin(request, method, audit.OutcomeSuccess)
+}
+
+//loginFailed counts a failed login step and logs it as a security event
+func loginFailed(request *http.Request, method string, reason string) {
+	metrics.Logins.Inc("failure", method)
+	logging.SecurityEvent(request, logging.EventLoginFailed).WithField("method", method).Warn(reason)
+	recordLogin(request, method, audit.OutcomeFailure)
+}
+
+//recordLogin adds a login step to the audit log of the user, attempts for unknown users are only logged
+func recordLogin(request *http.Request, method string, outcome string) {
+	username := logging.Username(request)
+	if username == "" {
+		return
+	}
+	audit.Record(request, audit.Event{
+		Action:   audit.ActionLogin,
+		Outcome:  outcome,
+		Subject:  username,
+		ClientID: request.URL.Query().Get("client_id"),
+		Detail:   method,
+	})
+}
+
 func (service *Service) storeLast2FALogin(request *http.Request, username string) {
 	//add last 2fa date if logging in with oauth2
 	queryValues := request.URL.Query()
@@ -705,7 +788,7 @@ func (service *Service) loginUser(w http.ResponseWriter, request *http.Request,
 		return
 	}
 	sessions.Save(request, w)
-	log.Debugf("Successfull login by '%s'", username)
+	logging.FromRequest(request).Debug("Successfull login")
 	service.login(w, request, username)
 }
 
@@ -715,7 +798,7 @@ func (service *Service) loginOauthUser(w http.ResponseWriter, request *http.Requ
 		return
 	}
 	sessions.Save(request, w)
-	log.Debugf("Successfull oauth login without 2 factor authentication by '%s'", username)
+	logging.FromRequest(request).Debug("Successfull oauth login without 2 factor authentication")
 	service.login(w, request, username)
 }
 
@@ -790,11 +873,13 @@ func verifyInfoAfterLogin(request *http.Request, username string, inviteCode str
 		if err != nil {
 			return err
 		}
+		audit.Record(request, audit.Event{Action: audit.ActionMemberAdded, Subject: username, Organization: org.Globalid, Detail: audit.DetailInvitation})
 	} else if invite.Role == invitations.RoleOwner {
 		err = orgMgr.SaveOwner(org, username)
 		if err != nil {
 			return err
 		}
+		audit.Record(request, audit.Event{Action: audit.ActionOwnerAdded, Subject: username, Organization: org.Globalid, Detail: audit.DetailInvitation})
 	}
 	if invite.Method == invitations.MethodEmail {
 		// Set this email address as verified and create a new one if necessary
@@ -995,6 +1080,17 @@ func (service *Service) ResetPassword(w http.ResponseWriter, request *http.Reque
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
+	userMgr := user.NewManager(request)
+	userobj, err := userMgr.GetByName(token.Username)
+	if err != nil {
+		log.Error("Failed to load user for password reset - ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if err = password.Check(values.Password, password.UserInfoFromUser(userobj)); err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	err = pwdMngr.Save(token.Username, values.Password)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -1005,6 +1101,9 @@ func (service *Service) ResetPassword(w http.ResponseWriter, request *http.Reque
 		return
 
 	}
+	logging.SetUsername(request, token.Username)
+	logging.SecurityEvent(request, logging.EventPasswordReset).Info("Password reset with a reset token")
+	audit.Record(request, audit.Event{Action: audit.ActionPasswordReset, Subject: token.Username})
 	w.WriteHeader(http.StatusNoContent)
 	return
 }
@@ -1079,16 +1178,16 @@ func (service *Service) LoginResendPhonenumberConfirmation(w http.ResponseWriter
 	loginSession.Values["phonenumbervalidationkey"] = info.Key
 
 	sessionInfo := &loginSessionInformation{
-		Confirmed:  false,
-		CreatedAt:  time.Now(),
-		SessionKey: info.Key,
-		SMSCode:    info.SMSCode,
+		Confirmed:   false,
+		CreatedAt:   time.Now(),
+		SessionKey:  info.Key,
+		SMSCode:     info.SMSCode,
+		Phonenumber: phonenumber.Phonenumber,
 	}
 
 	loginSession.Values["sessionkey"] = sessionInfo.SessionKey
 
-	mgoCollection := db.GetCollection(db.GetDBSession(request), mongoLoginCollectionName)
-	mgoCollection.Insert(sessionInfo)
+	newLoginStore(request).saveLoginSession(sessionInfo)
 
 	TranslationValues := tools.TranslationValues{
 		"smsconfirmationandlogin": struct {
@@ -1,8 +1,12 @@
 package siteservice
 
 import (
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/user"
 	"github.com/itsyouonline/identityserver/siteservice/website/packaged/html"
 	"github.com/stretchr/testify/assert"
 )
@@ -13,3 +17,48 @@ func TestLoginHtmlAvailable(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, htmlData)
 }
+
+func TestRestoreAccount(t *testing.T) {
+	siteService := NewService("MyCookieSecret", "MyMagicLinkSecret", nil, nil, nil, "test", true)
+	backend := db.NewMemoryBackend()
+
+	login := httptest.NewRequest("POST", "/login", nil)
+	release, err := db.OpenBackend(backend, login)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	userMgr := user.NewManager(login)
+	assert.NoError(t, userMgr.Save(&user.User{Username: "alice"}))
+	assert.NoError(t, userMgr.ScheduleDeletion("alice", time.Now().Add(time.Hour)))
+
+	loginResponse := httptest.NewRecorder()
+	siteService.completeFirstFactor(loginResponse, login, "alice")
+	assert.Equal(t, 422, loginResponse.Code)
+	assert.Contains(t, loginResponse.Body.String(), "account_deletion_scheduled")
+
+	// Restoring requires the login session in which the first factor was passed
+	restore := httptest.NewRequest("POST", "/login/restoreaccount", nil)
+	w := httptest.NewRecorder()
+	siteService.RestoreAccount(w, restore)
+	assert.Equal(t, 401, w.Code)
+	userobj, err := userMgr.GetByName("alice")
+	assert.NoError(t, err)
+	assert.NotNil(t, userobj.DeletionScheduled)
+
+	restore = httptest.NewRequest("POST", "/login/restoreaccount", nil)
+	for _, cookie := range loginResponse.Result().Cookies() {
+		restore.AddCookie(cookie)
+	}
+	releaseRestore, err := db.OpenBackend(backend, restore)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer releaseRestore()
+	w = httptest.NewRecorder()
+	siteService.RestoreAccount(w, restore)
+	assert.Equal(t, 204, w.Code)
+	userobj, err = userMgr.GetByName("alice")
+	assert.NoError(t, err)
+	assert.Nil(t, userobj.DeletionScheduled)
+}
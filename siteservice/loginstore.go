@@ -0,0 +1,217 @@
+package siteservice
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// loginSessionTTL is the expiration of login sessions in mongo
+const loginSessionTTL = 10 * time.Minute
+
+// loginStore keeps the sms login sessions and magic links
+type loginStore interface {
+	saveLoginSession(sessionInfo *loginSessionInformation) error
+	// getLoginSession returns nil if the session does not exist
+	getLoginSession(sessionKey string) (*loginSessionInformation, error)
+	confirmLoginSession(sessionKey string) error
+	saveMagicLink(link *magicLink) error
+	// useMagicLink marks an unused link as used and returns it, mgo.ErrNotFound is returned if there is none
+	useMagicLink(key string, browserKey string, createdAfter time.Time) (*magicLink, error)
+}
+
+func newLoginStore(request *http.Request) loginStore {
+	if memory := db.GetMemoryBackend(request); memory != nil {
+		return memory.Store(mongoLoginCollectionName, func() interface{} {
+			return &memoryLoginStore{sessions: make(map[string]loginSessionInformation), links: make(map[string]magicLink)}
+		}).(*memoryLoginStore)
+	}
+	if pg := db.GetPostgres(request); pg != nil {
+		return &postgresLoginStore{db: pg}
+	}
+	return &mongoLoginStore{session: db.GetDBSession(request)}
+}
+
+type mongoLoginStore struct {
+	session *mgo.Session
+}
+
+func (s *mongoLoginStore) saveLoginSession(sessionInfo *loginSessionInformation) error {
+	return db.GetCollection(s.session, mongoLoginCollectionName).Insert(sessionInfo)
+}
+
+func (s *mongoLoginStore) getLoginSession(sessionKey string) (sessionInfo *loginSessionInformation, err error) {
+	sessionInfo = &loginSessionInformation{}
+	err = db.GetCollection(s.session, mongoLoginCollectionName).Find(bson.M{"sessionkey": sessionKey}).One(sessionInfo)
+	if err == mgo.ErrNotFound {
+		sessionInfo = nil
+		err = nil
+	}
+	return
+}
+
+func (s *mongoLoginStore) confirmLoginSession(sessionKey string) error {
+	_, err := db.GetCollection(s.session, mongoLoginCollectionName).UpdateAll(bson.M{"sessionkey": sessionKey}, bson.M{"$set": bson.M{"confirmed": true}})
+	return err
+}
+
+func (s *mongoLoginStore) saveMagicLink(link *magicLink) error {
+	return db.GetCollection(s.session, mongoMagicLinkCollectionName).Insert(link)
+}
+
+func (s *mongoLoginStore) useMagicLink(key string, browserKey string, createdAfter time.Time) (*magicLink, error) {
+	// Mark the link as used in the same operation that validates it, so it can only be used once
+	link := &magicLink{}
+	_, err := db.GetCollection(s.session, mongoMagicLinkCollectionName).Find(bson.M{
+		"key":        key,
+		"browserkey": browserKey,
+		"used":       false,
+		"createdat":  bson.M{"$gt": createdAfter},
+	}).Apply(mgo.Change{Update: bson.M{"$set": bson.M{"used": true}}}, link)
+	return link, err
+}
+
+// memoryLoginStore keeps the login sessions and magic links in a db.MemoryBackend
+type memoryLoginStore struct {
+	sync.Mutex
+	sessions map[string]loginSessionInformation
+	links    map[string]magicLink
+}
+
+func (s *memoryLoginStore) saveLoginSession(sessionInfo *loginSessionInformation) error {
+	s.Lock()
+	defer s.Unlock()
+	if existing, ok := s.sessions[sessionInfo.SessionKey]; ok && time.Since(existing.CreatedAt) < loginSessionTTL {
+		return db.ErrDuplicate
+	}
+	s.sessions[sessionInfo.SessionKey] = *sessionInfo
+	return nil
+}
+
+func (s *memoryLoginStore) getLoginSession(sessionKey string) (*loginSessionInformation, error) {
+	s.Lock()
+	defer s.Unlock()
+	sessionInfo, ok := s.sessions[sessionKey]
+	if !ok || time.Since(sessionInfo.CreatedAt) >= loginSessionTTL {
+		return nil, nil
+	}
+	return &sessionInfo, nil
+}
+
+func (s *memoryLoginStore) confirmLoginSession(sessionKey string) error {
+	s.Lock()
+	defer s.Unlock()
+	if sessionInfo, ok := s.sessions[sessionKey]; ok {
+		sessionInfo.Confirmed = true
+		s.sessions[sessionKey] = sessionInfo
+	}
+	return nil
+}
+
+func (s *memoryLoginStore) saveMagicLink(link *magicLink) error {
+	s.Lock()
+	defer s.Unlock()
+	if existing, ok := s.links[link.Key]; ok && time.Since(existing.CreatedAt) < magicLinkTTL {
+		return db.ErrDuplicate
+	}
+	s.links[link.Key] = *link
+	return nil
+}
+
+func (s *memoryLoginStore) useMagicLink(key string, browserKey string, createdAfter time.Time) (*magicLink, error) {
+	s.Lock()
+	defer s.Unlock()
+	link, ok := s.links[key]
+	if !ok || link.BrowserKey != browserKey || link.Used || !link.CreatedAt.After(createdAfter) {
+		return nil, mgo.ErrNotFound
+	}
+	link.Used = true
+	s.links[key] = link
+	return &link, nil
+}
+
+var postgresLoginSessions = &db.PostgresCollection{
+	Table: mongoLoginCollectionName,
+	Columns: func(document interface{}) map[string]interface{} {
+		sessionInfo := document.(*loginSessionInformation)
+		return map[string]interface{}{
+			"sessionkey": sessionInfo.SessionKey,
+			"expires_at": sessionInfo.CreatedAt.Add(loginSessionTTL),
+		}
+	},
+}
+
+var postgresMagicLinks = &db.PostgresCollection{
+	Table: mongoMagicLinkCollectionName,
+	Columns: func(document interface{}) map[string]interface{} {
+		link := document.(*magicLink)
+		return map[string]interface{}{
+			"key":        link.Key,
+			"expires_at": link.CreatedAt.Add(magicLinkTTL),
+		}
+	},
+}
+
+// errMagicLinkUnusable aborts the transaction that uses a magic link
+var errMagicLinkUnusable = errors.New("The magic link can not be used")
+
+// postgresLoginStore keeps the login sessions and magic links in a postgres database
+type postgresLoginStore struct {
+	db *sql.DB
+}
+
+func (s *postgresLoginStore) saveLoginSession(sessionInfo *loginSessionInformation) error {
+	return postgresLoginSessions.Insert(s.db, sessionInfo)
+}
+
+func (s *postgresLoginStore) getLoginSession(sessionKey string) (*loginSessionInformation, error) {
+	sessionInfo := &loginSessionInformation{}
+	err := postgresLoginSessions.FindOne(s.db, sessionInfo, "sessionkey = $1", sessionKey)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	return sessionInfo, err
+}
+
+func (s *postgresLoginStore) confirmLoginSession(sessionKey string) error {
+	_, err := postgresLoginSessions.Update(s.db, "sessionkey = $1", []interface{}{sessionKey},
+		func() interface{} { return &loginSessionInformation{} },
+		func(document interface{}) error {
+			document.(*loginSessionInformation).Confirmed = true
+			return nil
+		})
+	return err
+}
+
+func (s *postgresLoginStore) saveMagicLink(link *magicLink) error {
+	return postgresMagicLinks.Insert(s.db, link)
+}
+
+func (s *postgresLoginStore) useMagicLink(key string, browserKey string, createdAfter time.Time) (*magicLink, error) {
+	// The row is locked while the link is validated and marked as used, so it can only be used once
+	var used *magicLink
+	updated, err := postgresMagicLinks.Update(s.db, "key = $1", []interface{}{key},
+		func() interface{} { return &magicLink{} },
+		func(document interface{}) error {
+			link := document.(*magicLink)
+			if link.BrowserKey != browserKey || link.Used || !link.CreatedAt.After(createdAfter) {
+				return errMagicLinkUnusable
+			}
+			link.Used = true
+			used = link
+			return nil
+		})
+	if err == errMagicLinkUnusable || (err == nil && updated == 0) {
+		err = mgo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return used, nil
+}
@@ -0,0 +1,191 @@
+package siteservice
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/sessions"
+	"github.com/itsyouonline/identityserver/db"
+	validationdb "github.com/itsyouonline/identityserver/db/validation"
+	"github.com/itsyouonline/identityserver/tools"
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	mongoMagicLinkCollectionName = "loginmagiclinks"
+
+	// magicLinkTTL is how long a login link can be used after it was requested
+	magicLinkTTL = 10 * time.Minute
+)
+
+type magicLink struct {
+	Key      string
+	Username string
+	// BrowserKey is also stored in the magic link session of the browser that requested the link
+	BrowserKey string
+	Used       bool
+	CreatedAt  time.Time
+}
+
+//signMagicLink calculates the signature that is added to the key in the login link
+func (service *Service) signMagicLink(key string) string {
+	mac := hmac.New(sha256.New, service.magicLinkSecret)
+	mac.Write([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+//verifyMagicLinkToken checks the signature of a token from a login link and returns the key
+func (service *Service) verifyMagicLinkToken(token string) (key string, valid bool) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", false
+	}
+	key, signature := token[:i], token[i+1:]
+	expected := service.signMagicLink(key)
+	return key, hmac.Equal([]byte(signature), []byte(expected))
+}
+
+//RequestMagicLink is the handler for POST /login/magiclink
+// It sends a single use login link to a validated email address.
+// The response does not reveal if the email address is known, the address is only looked up after responding
+// so the response time does not reveal it either.
+func (service *Service) RequestMagicLink(w http.ResponseWriter, request *http.Request) {
+	values := struct {
+		Email   string `json:"email"`
+		LangKey string `json:"langkey"`
+	}{}
+
+	if err := json.NewDecoder(request.Body).Decode(&values); err != nil {
+		log.Debug("Error decoding the magic link request:", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(values.Email))
+
+	magicLinkSession, err := service.GetSession(request, SessionMagicLink, "magiclinksession")
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	// The browser key is stored for unknown email addresses as well, the cookie would reveal them otherwise
+	browserKey, err := tools.GenerateRandomString()
+	if err != nil {
+		log.Error("Failed to generate magic link browser key: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	magicLinkSession.Values["browserkey"] = browserKey
+	sessions.Save(request, w)
+	w.WriteHeader(http.StatusNoContent)
+
+	// The request is finished when the link is sent, the background request keeps what the link and the email need
+	linkRequest := &http.Request{Host: request.Host, URL: &url.URL{RawQuery: request.URL.RawQuery}}
+	release, err := db.OpenBackgroundRequest(db.GetBackend(request), linkRequest)
+	if err != nil {
+		log.Error("Failed to open the database to send a magic link: ", err)
+		return
+	}
+	go func() {
+		defer release()
+		service.sendMagicLink(linkRequest, email, browserKey, values.LangKey)
+	}()
+}
+
+//sendMagicLink creates a login link for the user the email address is validated for and sends it to the address,
+// nothing is sent to an unknown address
+func (service *Service) sendMagicLink(request *http.Request, email, browserKey, langKey string) {
+	valMgr := validationdb.NewManager(request)
+	validatedemail, err := valMgr.GetByEmailAddressValidatedEmailAddress(email)
+	if db.IsNotFound(err) {
+		log.Debug("Magic link requested for an unknown email address")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to get validated email address: ", err)
+		return
+	}
+
+	link := &magicLink{Username: validatedemail.Username, BrowserKey: browserKey, CreatedAt: time.Now()}
+	if link.Key, err = tools.GenerateRandomString(); err != nil {
+		log.Error("Failed to generate magic link key: ", err)
+		return
+	}
+	if err = newLoginStore(request).saveMagicLink(link); err != nil {
+		log.Error("Failed to save magic link: ", err)
+		return
+	}
+
+	// Keep the query parameters of the login page so an oauth flow can continue after following the link
+	token := link.Key + "." + service.signMagicLink(link.Key)
+	loginURL := fmt.Sprintf("https://%s/login?%s#/magiclink/%s", request.Host, request.URL.RawQuery, url.QueryEscape(token))
+	err = service.emailaddressValidationService.SendMagicLink(request, link.Username, validatedemail.EmailAddress, loginURL, langKey)
+	if err != nil {
+		log.Error("Failed to send magic link: ", err)
+	}
+}
+
+//ConfirmMagicLink is the handler for POST /login/magiclink/confirm
+// A valid login link completes the first factor of the login, just like a valid password does.
+func (service *Service) ConfirmMagicLink(w http.ResponseWriter, request *http.Request) {
+	err := request.ParseForm()
+	if err != nil {
+		log.Debug("ERROR parsing magic link confirmation form")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	values := struct {
+		Token string `json:"token"`
+	}{}
+
+	if err = json.NewDecoder(request.Body).Decode(&values); err != nil {
+		log.Debug("Error decoding the magic link confirmation:", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	key, valid := service.verifyMagicLinkToken(values.Token)
+	if !valid {
+		log.Debug("Invalid magic link signature")
+		writeErrorResponse(w, "invalid_link", http.StatusUnprocessableEntity)
+		return
+	}
+
+	magicLinkSession, err := service.GetSession(request, SessionMagicLink, "magiclinksession")
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	// The browser key can only be used once, also when the confirmation fails
+	browserKey, _ := magicLinkSession.Values["browserkey"].(string)
+	delete(magicLinkSession.Values, "browserkey")
+	sessions.Save(request, w)
+	if browserKey == "" {
+		log.Debug("Magic link opened in a different browser or after the session expired")
+		writeErrorResponse(w, "different_browser", http.StatusUnprocessableEntity)
+		return
+	}
+
+	link, err := newLoginStore(request).useMagicLink(key, browserKey, time.Now().Add(-magicLinkTTL))
+	if err == mgo.ErrNotFound {
+		log.Debug("Magic link is used, expired or requested in a different browser")
+		writeErrorResponse(w, "invalid_link", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to confirm magic link: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	service.completeFirstFactor(w, request, link.Username)
+}
@@ -0,0 +1,112 @@
+package siteservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/user"
+	validationdb "github.com/itsyouonline/identityserver/db/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+// channelEmailService passes the text of the sent emails to a channel
+type channelEmailService chan string
+
+func (c channelEmailService) Send(recipients []string, subject string, text string, html string) error {
+	c <- text
+	return nil
+}
+
+func TestMagicLinkToken(t *testing.T) {
+	siteService := NewService("MyCookieSecret", "MyMagicLinkSecret", nil, nil, nil, "test", true)
+
+	token := "akey." + siteService.signMagicLink("akey")
+	key, valid := siteService.verifyMagicLinkToken(token)
+	assert.True(t, valid)
+	assert.Equal(t, "akey", key)
+
+	_, valid = siteService.verifyMagicLinkToken("otherkey." + siteService.signMagicLink("akey"))
+	assert.False(t, valid)
+
+	_, valid = siteService.verifyMagicLinkToken("akey")
+	assert.False(t, valid)
+
+	otherService := NewService("OtherCookieSecret", "OtherMagicLinkSecret", nil, nil, nil, "test", true)
+	_, valid = otherService.verifyMagicLinkToken(token)
+	assert.False(t, valid)
+}
+
+func TestRequestMagicLinkUnknownEmail(t *testing.T) {
+	siteService := NewService("MyCookieSecret", "MyMagicLinkSecret", nil, nil, nil, "test", true)
+	request := httptest.NewRequest("POST", "/login/magiclink", strings.NewReader(`{"email": "nobody@example.com"}`))
+	release, err := db.OpenBackend(db.NewMemoryBackend(), request)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	w := httptest.NewRecorder()
+	siteService.RequestMagicLink(w, request)
+	assert.Equal(t, 204, w.Code)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "magiclinksession=", "the response does not reveal that the email address is unknown")
+}
+
+func TestMagicLinkIsSentAfterResponding(t *testing.T) {
+	emails := make(channelEmailService, 1)
+	siteService := NewService("MyCookieSecret", "MyMagicLinkSecret", nil, emails, nil, "test", true)
+	backend := db.NewMemoryBackend()
+	do := func(handler http.HandlerFunc, path, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("POST", path, strings.NewReader(body))
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		release, err := db.OpenBackend(backend, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+		w := httptest.NewRecorder()
+		handler(w, request)
+		return w
+	}
+
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	assert.NoError(t, user.NewManager(r).Save(&user.User{Username: "alice"}))
+	valMgr := validationdb.NewManager(r)
+	assert.NoError(t, valMgr.SaveValidatedEmailAddress(valMgr.NewValidatedEmailAddress("alice", "alice@example.com")))
+
+	w := do(siteService.RequestMagicLink, "/login/magiclink?client_id=acme", `{"email": "Alice@example.com"}`, nil)
+	assert.Equal(t, 204, w.Code)
+	var text string
+	select {
+	case text = <-emails:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the magic link was not sent")
+	}
+	match := regexp.MustCompile(`/login\?client_id=acme#/magiclink/([^\s"]+)`).FindStringSubmatch(text)
+	if !assert.Len(t, match, 2, "the link keeps the query of the login page") {
+		return
+	}
+	token, err := url.QueryUnescape(match[1])
+	assert.NoError(t, err)
+	_, valid := siteService.verifyMagicLinkToken(token)
+	assert.True(t, valid)
+
+	// A failed confirmation uses up the browser key as well
+	unknown := "unknown." + siteService.signMagicLink("unknown")
+	failed := do(siteService.ConfirmMagicLink, "/login/magiclink/confirm", `{"token": "`+unknown+`"}`, w.Result().Cookies())
+	assert.Equal(t, 422, failed.Code)
+	assert.Contains(t, failed.Body.String(), "invalid_link")
+	confirmed := do(siteService.ConfirmMagicLink, "/login/magiclink/confirm", `{"token": "`+token+`"}`, failed.Result().Cookies())
+	assert.Equal(t, 422, confirmed.Code)
+	assert.Contains(t, confirmed.Body.String(), "different_browser")
+}
@@ -1,62 +1,135 @@
 package middleware
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/ulule/limiter"
-	"github.com/ulule/limiter/drivers/middleware/stdlib"
-	"github.com/ulule/limiter/drivers/store/memory"
+	"github.com/gorilla/context"
+	"github.com/itsyouonline/identityserver/logging"
 )
 
-// RateLimiter represents an in memory rate limiter
-type RateLimiter struct {
-	*stdlib.Middleware
-}
-
-const (
+// The limits of the rate limited route groups, they can be configured before the routes are created
+var (
 	// DefaultRateLimitPeriod is the default time window to track calls
 	DefaultRateLimitPeriod = time.Minute * 10
-	// DefaultRateLimit is the default amount of allowed calls to the protected api in the time window
+	// DefaultRateLimit is the default amount of allowed calls to the protected api in the time window,
+	// it applies per ip address to the endpoints that send sms or emails
 	DefaultRateLimit = 50
+	// LoginRateLimitPeriod and LoginRateLimit apply per ip address to the login and registration forms
+	LoginRateLimitPeriod = time.Minute
+	LoginRateLimit       = 30
+	// TokenRateLimitPeriod and TokenRateLimit apply per oauth client and per ip address to the token endpoints
+	TokenRateLimitPeriod = time.Minute
+	TokenRateLimit       = 300
+	// APIRateLimitPeriod and APIRateLimit apply per ip address, per authenticated user and per authenticated organization to the api
+	APIRateLimitPeriod = time.Minute
+	APIRateLimit       = 600
 )
 
-// RateLimit creates a new rate limiting middleware with in memory store
-// the amount of maximum requests can be set as wel as the duration in which this limit
-// applies
-func RateLimit(period time.Duration, limit int) RateLimiter {
-	store := memory.NewStore()
-	rate := limiter.Rate{
-		Period: period,
-		Limit:  int64(limit),
+// KeyFunc returns the key a request is counted under, a rule does not apply to requests without a key
+type KeyFunc func(r *http.Request) string
+
+// ByIP keys the requests by the ip address of the client
+func ByIP(r *http.Request) string {
+	return logging.ClientIP(r)
+}
+
+// ByClientID keys the requests by the oauth client, as authenticated by the api middleware
+// or as passed to the token endpoints in the request or the basic auth header
+func ByClientID(r *http.Request) string {
+	if clientID, ok := context.Get(r, "client_id").(string); ok && clientID != "" {
+		return clientID
 	}
+	if clientID := r.FormValue("client_id"); clientID != "" {
+		return clientID
+	}
+	clientID, _, _ := r.BasicAuth()
+	return clientID
+}
 
-	lmt := limiter.New(store, rate)
-	middleware := stdlib.NewMiddleware(lmt, stdlib.WithForwardHeader(true))
-	middleware.OnLimitReached = func(w http.ResponseWriter, r *http.Request) {
-		// Get the clients ip address.
-		ipString := r.RemoteAddr
-		// Account for proxies.
-		if forwardString := r.Header.Get("X-Forwarded-For"); forwardString != "" {
-			ipString = forwardString
+// Rule limits the requests with the same key to Limit per Period
+type Rule struct {
+	// Name distinguishes the counters of the rules of a group, like ip or client
+	Name   string
+	Key    KeyFunc
+	Period time.Duration
+	Limit  int
+}
+
+// RateLimiter limits the requests to a group of routes, the routes of a group share the counters
+type RateLimiter struct {
+	Group string
+	Rules []Rule
+	Store Store
+}
+
+// NewRateLimiter creates a limiter for a route group that uses the DefaultStore
+func NewRateLimiter(group string, rules ...Rule) *RateLimiter {
+	return &RateLimiter{Group: group, Rules: rules, Store: DefaultStore}
+}
+
+// Handler refuses the requests over the limit of any rule with 429 Too Many Requests.
+// The X-RateLimit-* headers describe the rule with the fewest remaining requests,
+// Retry-After tells a refused client how many seconds to wait.
+func (l *RateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tightest *Rule
+		remaining := math.MaxInt32
+		var reset, retryAt time.Time
+		var exceeded []string
+		for i := range l.Rules {
+			rule := &l.Rules[i]
+			key := rule.Key(r)
+			if key == "" {
+				continue
+			}
+			count, expiresAt, err := l.Store.Increment(l.Group+":"+rule.Name+":"+key, rule.Period)
+			if err != nil {
+				// A storage problem should not make the service unavailable
+				log.Error("Failed to count the request for the rate limit: ", err)
+				continue
+			}
+			if count > rule.Limit {
+				exceeded = append(exceeded, rule.Name)
+				if expiresAt.After(retryAt) {
+					retryAt = expiresAt
+				}
+			}
+			if left := rule.Limit - count; tightest == nil || left < remaining || (left == remaining && expiresAt.After(reset)) {
+				tightest, remaining, reset = rule, left, expiresAt
+			}
+		}
+		if tightest != nil {
+			if remaining < 0 {
+				remaining = 0
+			}
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(tightest.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
 		}
-		// Cloudflare creates a special ipv6 address if the client uses ipv6,
-		// so check for the appropriate header
-		// We will rate limit on this special ipv4 address, but this is not a problem
-		// as Cloudflare maps these special addresses to the underlying ipv6 address
-		// in a one on one relationship
-		if ipv6 := r.Header.Get("Cf-Connecting-Ipv6"); ipv6 != "" {
-			ipString = ipv6
+		if len(exceeded) == 0 {
+			next.ServeHTTP(w, r)
+			return
 		}
-		log.Info("Rate limiting request from: ", ipString)
+		logging.SecurityEvent(r, logging.EventRateLimited).WithFields(log.Fields{
+			"remote_addr": ByIP(r),
+			"group":       l.Group,
+			"rules":       strings.Join(exceeded, ","),
+		}).Warn("Rate limiting request")
 
+		// All exceeded rules must have a new window before a request gets through
+		retryAfter := int(math.Ceil(time.Until(retryAt).Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
 		// Write some info back to the client
-		w.WriteHeader(http.StatusTooManyRequests)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
 		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusTooManyRequests)
 		w.Write([]byte("You have reached the maximum request limit."))
-		return
-	}
-	return RateLimiter{middleware}
-
+	})
 }
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := &RateLimiter{
+		Group: "test",
+		Rules: []Rule{
+			{Name: "ip", Key: ByIP, Period: time.Minute, Limit: 3},
+			{Name: "client", Key: ByClientID, Period: time.Hour, Limit: 2},
+		},
+		Store: NewMemoryStore(),
+	}
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(ip, clientID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/v1/oauth/access_token?client_id="+clientID, nil)
+		r.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("10.0.0.1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-RateLimit-Limit"), "the rules without a key do not apply")
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = request("10.0.0.2", "myorg")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"), "the headers describe the rule with the fewest remaining requests")
+	request("10.0.0.3", "myorg")
+
+	w = request("10.0.0.4", "myorg")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "the client is limited from every ip address")
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.True(t, retryAfter > 3500 && retryAfter <= 3600, "retry after the window of the client rule ends, got %d", retryAfter)
+
+	assert.Equal(t, http.StatusOK, request("10.0.0.4", "otherorg").Code)
+}
+
+func TestByIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "10.0.0.1", ByIP(r))
+	r.Header.Set("X-Forwarded-For", "192.0.2.1, 10.0.0.1")
+	assert.Equal(t, "192.0.2.1", ByIP(r))
+	r.Header.Set("Cf-Connecting-Ipv6", "2001:db8::1")
+	assert.Equal(t, "2001:db8::1", ByIP(r))
+}
+
+func TestByClientID(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/oauth/access_token", nil)
+	assert.Equal(t, "", ByClientID(r))
+	r.SetBasicAuth("myorg", "secret")
+	assert.Equal(t, "myorg", ByClientID(r))
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/ratelimit"
+	"github.com/ulule/limiter"
+	"github.com/ulule/limiter/drivers/store/memory"
+)
+
+// Store counts the requests per key in fixed windows
+type Store interface {
+	// Increment counts a request for the key and returns the count in the current window and when the window ends
+	Increment(key string, period time.Duration) (count int, expiresAt time.Time, err error)
+}
+
+// DefaultStore is used by the rate limiters, it can be replaced before the routes are created.
+// The memory store only limits the requests that reach this instance, use the database store when there are several.
+var DefaultStore Store = NewMemoryStore()
+
+// memoryStore keeps the counters in this instance
+type memoryStore struct {
+	cache *memory.CacheWrapper
+}
+
+// NewMemoryStore creates a store that keeps the counters in memory
+func NewMemoryStore() Store {
+	return &memoryStore{cache: memory.NewCache(limiter.DefaultCleanUpInterval)}
+}
+
+func (s *memoryStore) Increment(key string, period time.Duration) (int, time.Time, error) {
+	count, expiresAt := s.cache.Increment(key, 1, period)
+	return int(count), expiresAt, nil
+}
+
+// databaseStore keeps the counters in the database so they are shared by all instances
+type databaseStore struct{}
+
+// NewDatabaseStore creates a store that keeps the counters in the default database backend
+func NewDatabaseStore() Store {
+	return databaseStore{}
+}
+
+func (databaseStore) Increment(key string, period time.Duration) (count int, expiresAt time.Time, err error) {
+	r, release, err := db.NewBackgroundRequest(db.DefaultBackend(), "")
+	if err != nil {
+		return
+	}
+	defer release()
+	return ratelimit.NewManager(r).Increment(key, period)
+}
@@ -347,6 +347,20 @@ func (service *Service) ProcessRegistrationForm(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	// Check the password against the policy again now the username is known,
+	// before anything is stored
+	err = password.Check(values.Password, password.UserInfo{
+		Username:       username,
+		Firstname:      registeringUser.Firstname,
+		Lastname:       registeringUser.Lastname,
+		EmailAddresses: []string{registeringUser.Email},
+	})
+	if err != nil {
+		logMgr.SaveLog(persistentlog.New(sessionKey, persistentlog.RegistrationFlow, "User password invalid: "+err.Error()))
+		writeErrorResponse(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
 	// Create the user object
 	log.Debug("Creating new user with username ", username)
 	userObj := &user.User{
@@ -370,8 +384,8 @@ func (service *Service) ProcessRegistrationForm(w http.ResponseWriter, r *http.R
 	err = passwdMgr.Save(username, values.Password)
 	if err != nil {
 		log.Error("Error while saving the users password: ", err)
-		if err.Error() != "internal_error" {
-			writeErrorResponse(w, "invalid_password", http.StatusUnprocessableEntity)
+		if password.IsPolicyError(err) {
+			writeErrorResponse(w, err.Error(), http.StatusUnprocessableEntity)
 		} else {
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		}
@@ -394,6 +408,14 @@ func (service *Service) ProcessRegistrationForm(w http.ResponseWriter, r *http.R
 	}
 
 	logMgr.SaveLog(persistentlog.New(sessionKey, persistentlog.RegistrationFlow, "Registration finished, user created"))
+	// Link the logs to the user so they are removed with the account
+	if err = logMgr.SetUsername(sessionKey, username); err != nil {
+		log.Error("Failed to link the registration logs to the new user: ", err)
+	}
+	// The details of the registration are stored in the user now
+	if err = rMgr.DeleteRegisteringUser(sessionKey); err != nil {
+		log.Error("Failed to remove the finished registration: ", err)
+	}
 	log.Debug("Finished saving new user information")
 
 	// Ideally, we would remove the registration session here as registration is completed.
@@ -519,15 +541,15 @@ func (service *Service) ValidateInfo(w http.ResponseWriter, r *http.Request) {
 	registeringUser.Phonenumber = data.Phone
 
 	// Check the password
-	if err = password.Check(data.Password); err != nil {
-		if err != password.ErrInvalidPassword {
-			log.Error("Failed to verify password: ", err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
-		logMgr.SaveLog(persistentlog.New(sessionKey, persistentlog.RegistrationFlow, "User password invalid"))
-		log.Debug("User password is invalid")
-		writeErrorResponse(w, "invalid_password", http.StatusUnprocessableEntity)
+	err = password.Check(data.Password, password.UserInfo{
+		Firstname:      data.Firstname,
+		Lastname:       data.Lastname,
+		EmailAddresses: []string{data.Email},
+	})
+	if err != nil {
+		logMgr.SaveLog(persistentlog.New(sessionKey, persistentlog.RegistrationFlow, "User password invalid: "+err.Error()))
+		log.Debug("User password is invalid: ", err)
+		writeErrorResponse(w, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
 	// Storing password in plaintext is probably not such a great idea
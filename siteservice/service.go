@@ -9,14 +9,12 @@ import (
 	"github.com/gorilla/sessions"
 	"github.com/itsyouonline/identityserver/communication"
 	"github.com/itsyouonline/identityserver/siteservice/apiconsole"
-	"github.com/itsyouonline/identityserver/siteservice/middleware"
 	"github.com/itsyouonline/identityserver/siteservice/website/packaged/assets"
 	"github.com/itsyouonline/identityserver/siteservice/website/packaged/components"
 	"github.com/itsyouonline/identityserver/siteservice/website/packaged/html"
 	"github.com/itsyouonline/identityserver/siteservice/website/packaged/thirdpartyassets"
 	"github.com/itsyouonline/identityserver/specifications"
 	"github.com/itsyouonline/identityserver/validation"
-	"github.com/justinas/alice"
 
 	"encoding/json"
 
@@ -36,10 +34,11 @@ type Service struct {
 	version                       string
 	testEnv                       bool
 	identityService               *identityservice.Service
+	magicLinkSecret               []byte
 }
 
-//NewService creates and initializes a Service
-func NewService(cookieSecret string, smsService communication.SMSService, emailService communication.EmailService,
+//NewService creates and initializes a Service, the login links are signed with magicLinkSecret
+func NewService(cookieSecret string, magicLinkSecret string, smsService communication.SMSService, emailService communication.EmailService,
 	identityservice *identityservice.Service, version string, testEnv bool) (service *Service) {
 	service = &Service{smsService: smsService}
 
@@ -54,15 +53,12 @@ func NewService(cookieSecret string, smsService communication.SMSService, emailS
 
 	service.testEnv = testEnv
 
+	service.magicLinkSecret = []byte(magicLinkSecret)
+
 	service.initializeSessions(cookieSecret)
 	return
 }
 
-//InitModels initialize persistance models
-func (service *Service) InitModels() {
-	service.initLoginModels()
-}
-
 //AddRoutes registers the http routes with the router
 func (service *Service) AddRoutes(router *mux.Router) {
 	router.Methods("GET").Path("/").HandlerFunc(service.HomePage)
@@ -78,7 +74,7 @@ func (service *Service) AddRoutes(router *mux.Router) {
 	router.Methods("GET").Path("/register/emailconfirmed").HandlerFunc(service.CheckRegistrationEmailConfirmation)
 	router.Methods("POST").Path("/register/smsconfirmation").HandlerFunc(service.ProcessPhonenumberConfirmationForm)
 	router.Methods("POST").Path("/register/validation").HandlerFunc(service.ValidateInfo)
-	router.Handle("/register/resendvalidation", alice.New(middleware.RateLimit(middleware.DefaultRateLimitPeriod, middleware.DefaultRateLimit).Handler).Then(http.HandlerFunc(service.ResendValidationInfo))).Methods("POST")
+	router.Methods("POST").Path("/register/resendvalidation").HandlerFunc(service.ResendValidationInfo)
 	//Enable us to "forget" users in case we are not in production
 	router.Methods("GET").Path("/register/delete").HandlerFunc(service.ServeForgetAccountPage)
 	router.Methods("POST").Path("/register/delete").HandlerFunc(service.ForgetAccountHandler)
@@ -87,21 +83,30 @@ func (service *Service) AddRoutes(router *mux.Router) {
 	router.Methods("POST").Path("/login").HandlerFunc(service.ProcessLoginForm)
 	router.Methods("GET").Path("/login/twofamethods").HandlerFunc(service.GetTwoFactorAuthenticationMethods)
 	router.Methods("POST").Path("/login/totpconfirmation").HandlerFunc(service.ProcessTOTPConfirmation)
-	router.Handle("/login/smscode/{phoneLabel}", alice.New(middleware.RateLimit(middleware.DefaultRateLimitPeriod, middleware.DefaultRateLimit).Handler).Then(http.HandlerFunc(service.GetSmsCode))).Methods("POST")
+	router.Methods("POST").Path("/login/smscode/{phoneLabel}").HandlerFunc(service.GetSmsCode)
 	router.Methods("POST").Path("/login/smsconfirmation").HandlerFunc(service.Process2FASMSConfirmation)
-	router.Handle("/login/resendsms", alice.New(middleware.RateLimit(middleware.DefaultRateLimitPeriod, middleware.DefaultRateLimit).Handler).Then(http.HandlerFunc(service.LoginResendPhonenumberConfirmation))).Methods("POST")
+	router.Methods("POST").Path("/login/resendsms").HandlerFunc(service.LoginResendPhonenumberConfirmation)
 	router.Methods("GET").Path("/sc").HandlerFunc(service.MobileSMSConfirmation)
 	router.Methods("GET").Path("/login/smsconfirmed").HandlerFunc(service.Check2FASMSConfirmation)
 	router.Methods("POST").Path("/login/validateemail").HandlerFunc(service.ValidateEmail)
 	router.Methods("POST").Path("/login/forgotpassword").HandlerFunc(service.ForgotPassword)
 	router.Methods("POST").Path("/login/resetpassword").HandlerFunc(service.ResetPassword)
+	router.Methods("POST").Path("/login/magiclink").HandlerFunc(service.RequestMagicLink)
+	router.Methods("POST").Path("/login/magiclink/confirm").HandlerFunc(service.ConfirmMagicLink)
+	router.Methods("POST").Path("/login/upstream/confirm").HandlerFunc(service.ConfirmUpstreamLogin)
+	router.Methods("POST").Path("/login/restoreaccount").HandlerFunc(service.RestoreAccount)
 	router.Methods("GET").Path("/login/organizationinvitation/{code}").HandlerFunc(service.GetOrganizationInvitation)
+	//Delivery status of the sms, reported by the sms providers
+	router.Methods("POST").Path("/sms/callback/{provider}").HandlerFunc(service.SMSStatusCallback)
 	//Authorize form
 	router.Methods("GET").Path("/authorize").HandlerFunc(service.ShowAuthorizeForm)
-	//Facebook callback
-	router.Methods("GET").Path("/facebook_callback").HandlerFunc(service.FacebookCallback)
-	//Github callback
-	router.Methods("GET").Path("/github_callback").HandlerFunc(service.GithubCallback)
+	//Upstream identity providers
+	router.Methods("GET").Path("/upstream/providers").HandlerFunc(service.GetUpstreamProviders)
+	router.Methods("GET").Path("/upstream/{provider}/authorize").HandlerFunc(service.UpstreamAuthorize)
+	router.Methods("GET").Path("/upstream/{provider}/callback").HandlerFunc(service.UpstreamCallback)
+	//Facebook and Github callbacks registered before the generic callback existed
+	router.Methods("GET").Path("/facebook_callback").HandlerFunc(service.legacyUpstreamCallback("facebook"))
+	router.Methods("GET").Path("/github_callback").HandlerFunc(service.legacyUpstreamCallback("github"))
 	//Logout link
 	router.Methods("GET").Path("/logout").HandlerFunc(service.Logout)
 	//Error page
@@ -273,7 +278,7 @@ func (service *Service) renderEmailConfirmationPage(w http.ResponseWriter, reque
 }
 
 func (service *Service) GetConfig(w http.ResponseWriter, request *http.Request) {
-	token, err := totp.NewToken()
+	token, err := totp.NewToken(totp.DefaultAlgorithm, totp.DefaultDigits)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -286,15 +291,11 @@ func (service *Service) GetConfig(w http.ResponseWriter, request *http.Request)
 	totpsession.Values["secret"] = token.Secret
 	sessions.Save(request, w)
 	data := struct {
-		TotpIssuer       string `json:"totpissuer"`
-		TotpSecret       string `json:"totpsecret"`
-		GithubClientId   string `json:"githubclientid"`
-		FacebookClientId string `json:"facebookclientid"`
+		TotpIssuer string `json:"totpissuer"`
+		TotpSecret string `json:"totpsecret"`
 	}{
 		TotpIssuer: totp.GetIssuer(request),
 		TotpSecret: token.Secret,
 	}
-	data.GithubClientId, _ = identityservice.GetOauthClientID("github")
-	data.FacebookClientId, _ = identityservice.GetOauthClientID("facebook")
 	json.NewEncoder(w).Encode(&data)
 }
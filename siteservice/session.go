@@ -24,8 +24,21 @@ const (
 	SessionLogin SessionType = iota
 	//SessionOauth is the session during an oauth flow
 	SessionOauth SessionType = iota
+	//SessionMagicLink binds a requested login link to the browser that requested it
+	SessionMagicLink SessionType = iota
+	//SessionUpstream is the session during a login or account link at an upstream identity provider
+	SessionUpstream SessionType = iota
 )
 
+//SessionLifetimes are the maximum ages of the sessions, they can be configured before the service is created
+var SessionLifetimes = map[SessionType]time.Duration{
+	SessionForRegistration: 10 * time.Minute,
+	SessionInteractive:     10 * time.Minute,
+	SessionLogin:           5 * time.Minute,
+	SessionOauth:           10 * time.Minute,
+	SessionUpstream:        10 * time.Minute,
+}
+
 //initializeSessionStore creates a cookieStore
 // mageAge is the maximum age in seconds
 func initializeSessionStore(cookieSecret string, maxAge int) (sessionStore *sessions.CookieStore) {
@@ -40,10 +53,11 @@ func initializeSessionStore(cookieSecret string, maxAge int) (sessionStore *sess
 func (service *Service) initializeSessions(cookieSecret string) {
 	service.Sessions = make(map[SessionType]*sessions.CookieStore)
 
-	service.Sessions[SessionForRegistration] = initializeSessionStore(cookieSecret, 10*60)
-	service.Sessions[SessionInteractive] = initializeSessionStore(cookieSecret, 10*60)
-	service.Sessions[SessionLogin] = initializeSessionStore(cookieSecret, 5*60)
-	service.Sessions[SessionOauth] = initializeSessionStore(cookieSecret, 10*60)
+	for kind, lifetime := range SessionLifetimes {
+		service.Sessions[kind] = initializeSessionStore(cookieSecret, int(lifetime.Seconds()))
+	}
+	// The session has to live as long as the link it belongs to
+	service.Sessions[SessionMagicLink] = initializeSessionStore(cookieSecret, int(magicLinkTTL.Seconds()))
 
 }
 
@@ -9,7 +9,7 @@ import (
 
 func TestAvailableSessions(t *testing.T) {
 
-	siteService := NewService("MyCookieSecret", nil, nil, nil, "test", true)
+	siteService := NewService("MyCookieSecret", "MyMagicLinkSecret", nil, nil, nil, "test", true)
 	request := &http.Request{}
 
 	session, err := siteService.GetSession(request, SessionForRegistration, "akey")
@@ -20,4 +20,8 @@ func TestAvailableSessions(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, session)
 
+	session, err = siteService.GetSession(request, SessionMagicLink, "magiclinksession")
+	assert.NoError(t, err)
+	assert.NotNil(t, session)
+
 }
@@ -0,0 +1,32 @@
+package siteservice
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/communication"
+)
+
+//SMSStatusCallback is the handler for POST /sms/callback/{provider}
+// The sms providers report the delivery status of the sms they sent to it.
+func (service *Service) SMSStatusCallback(w http.ResponseWriter, request *http.Request) {
+	provider := mux.Vars(request)["provider"]
+	receiver, ok := service.smsService.(communication.SMSStatusReceiver)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	switch err := receiver.ReceiveStatus(provider, request); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case communication.ErrUnknownSMSProvider:
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case communication.ErrInvalidSignature:
+		log.Warnf("SMS: rejected a status callback of %s with an invalid signature", provider)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	default:
+		log.Error("Failed to store the status of an sms: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,245 @@
+package siteservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/itsyouonline/identityserver/credentials/upstream"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/user"
+)
+
+const (
+	upstreamActionLogin = "login"
+	upstreamActionLink  = "link"
+)
+
+//GetUpstreamProviders is the handler for GET /upstream/providers
+// It lists the upstream identity providers users can log in with or link their account to
+func (service *Service) GetUpstreamProviders(w http.ResponseWriter, request *http.Request) {
+	type upstreamProvider struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"displayname"`
+	}
+	providers := []upstreamProvider{}
+	for _, provider := range upstream.List() {
+		if provider.Available() {
+			providers = append(providers, upstreamProvider{Name: provider.Name, DisplayName: provider.DisplayName})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&providers)
+}
+
+//UpstreamAuthorize is the handler for GET /upstream/{provider}/authorize
+// It redirects to the upstream identity provider to log in (action=login) or to link an account (action=link).
+// The other query parameters are the ones of the login page, they are restored after a login.
+func (service *Service) UpstreamAuthorize(w http.ResponseWriter, request *http.Request) {
+	provider, found := upstream.Get(mux.Vars(request)["provider"])
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	queryValues := request.URL.Query()
+	action := queryValues.Get("action")
+	queryValues.Del("action")
+	if action != upstreamActionLogin && action != upstreamActionLink {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	authRequest, err := upstream.NewAuthRequest()
+	if err != nil {
+		log.Error("Failed to generate upstream authorization request: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	authorizeURL, err := provider.AuthCodeURL(provider.RedirectURI(request.Host), authRequest)
+	if err != nil {
+		log.Error("Failed to get the authorization url of ", provider.Name, ": ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	upstreamSession, err := service.GetSession(request, SessionUpstream, "upstreamsession")
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	upstreamSession.Values["state"] = authRequest.State
+	upstreamSession.Values["nonce"] = authRequest.Nonce
+	upstreamSession.Values["codeverifier"] = authRequest.CodeVerifier
+	upstreamSession.Values["provider"] = provider.Name
+	upstreamSession.Values["action"] = action
+	upstreamSession.Values["loginquery"] = queryValues.Encode()
+	delete(upstreamSession.Values, "username")
+	delete(upstreamSession.Values, "error")
+	sessions.Save(request, w)
+
+	http.Redirect(w, request, authorizeURL, http.StatusFound)
+}
+
+//UpstreamCallback is the handler for GET /upstream/{provider}/callback
+func (service *Service) UpstreamCallback(w http.ResponseWriter, request *http.Request) {
+	service.upstreamCallback(w, request, mux.Vars(request)["provider"])
+}
+
+//legacyUpstreamCallback handles the callback paths that are registered at the facebook and github applications
+func (service *Service) legacyUpstreamCallback(providerName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, request *http.Request) {
+		service.upstreamCallback(w, request, providerName)
+	}
+}
+
+func (service *Service) upstreamCallback(w http.ResponseWriter, request *http.Request, providerName string) {
+	provider, found := upstream.Get(providerName)
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	upstreamSession, err := service.GetSession(request, SessionUpstream, "upstreamsession")
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	queryValues := request.URL.Query()
+	authRequest := upstream.AuthRequest{}
+	authRequest.State, _ = upstreamSession.Values["state"].(string)
+	authRequest.Nonce, _ = upstreamSession.Values["nonce"].(string)
+	authRequest.CodeVerifier, _ = upstreamSession.Values["codeverifier"].(string)
+	sessionProvider, _ := upstreamSession.Values["provider"].(string)
+	action, _ := upstreamSession.Values["action"].(string)
+	loginQuery, _ := upstreamSession.Values["loginquery"].(string)
+	// The authorization request can only be used once, also when the callback fails
+	delete(upstreamSession.Values, "state")
+	delete(upstreamSession.Values, "nonce")
+	delete(upstreamSession.Values, "codeverifier")
+	sessions.Save(request, w)
+	if authRequest.State == "" || queryValues.Get("state") != authRequest.State || sessionProvider != provider.Name {
+		log.Debug("Invalid upstream callback state for ", provider.Name)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if upstreamError := queryValues.Get("error"); upstreamError != "" {
+		log.Debug("Upstream authorization at ", provider.Name, " failed: ", upstreamError)
+		service.finishUpstreamCallback(w, request, action, loginQuery, provider.Name)
+		return
+	}
+
+	redirectURI := provider.RedirectURI(request.Host)
+	token, err := provider.Exchange(queryValues.Get("code"), redirectURI, authRequest)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	identity, err := provider.UserInfo(token)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	userMgr := user.NewManager(request)
+	linkedUser, err := userMgr.GetByLinkedAccount(provider.Name, identity.Subject)
+	if err != nil && !db.IsNotFound(err) {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	switch action {
+	case upstreamActionLink:
+		loggedInUser, err := service.GetLoggedInUser(request, w)
+		if err != nil {
+			log.Error(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if loggedInUser == "" {
+			http.Redirect(w, request, "/login", http.StatusFound)
+			return
+		}
+		if linkedUser != nil && linkedUser.Username != loggedInUser {
+			log.Debugf("The %s account of %s is already linked to another user", provider.Name, loggedInUser)
+			http.Error(w, "This account is already linked to another user", http.StatusConflict)
+			return
+		}
+		account := user.LinkedAccount{
+			Provider: provider.Name,
+			Subject:  identity.Subject,
+			Name:     identity.Name,
+			Login:    identity.Login,
+			Email:    identity.Email,
+			Picture:  identity.Picture,
+			Link:     identity.Link,
+			LinkedAt: db.DateTime(time.Now()),
+		}
+		// Another user can link the account after the check above, the database refuses it then
+		if err = userMgr.SaveLinkedAccount(loggedInUser, account); db.IsDup(err) {
+			log.Debugf("The %s account of %s is already linked to another user", provider.Name, loggedInUser)
+			http.Error(w, "This account is already linked to another user", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Error(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	case upstreamActionLogin:
+		if linkedUser == nil {
+			upstreamSession.Values["error"] = "not_linked"
+		} else {
+			upstreamSession.Values["username"] = linkedUser.Username
+		}
+	}
+	service.finishUpstreamCallback(w, request, action, loginQuery, provider.Name)
+}
+
+//finishUpstreamCallback returns to the profile page after linking an account
+// or to the login page to continue the login flow
+func (service *Service) finishUpstreamCallback(w http.ResponseWriter, request *http.Request, action string, loginQuery string, providerName string) {
+	sessions.Save(request, w)
+	if action != upstreamActionLogin {
+		http.Redirect(w, request, "/", http.StatusFound)
+		return
+	}
+	http.Redirect(w, request, "/login?"+loginQuery+"#/upstream/"+url.QueryEscape(providerName), http.StatusFound)
+}
+
+//ConfirmUpstreamLogin is the handler for POST /login/upstream/confirm
+// A login at a linked upstream identity provider completes the first factor of the login, just like a valid password does.
+func (service *Service) ConfirmUpstreamLogin(w http.ResponseWriter, request *http.Request) {
+	err := request.ParseForm()
+	if err != nil {
+		log.Debug("ERROR parsing upstream login confirmation form")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	upstreamSession, err := service.GetSession(request, SessionUpstream, "upstreamsession")
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	username, _ := upstreamSession.Values["username"].(string)
+	upstreamError, _ := upstreamSession.Values["error"].(string)
+	delete(upstreamSession.Values, "username")
+	delete(upstreamSession.Values, "error")
+	if username == "" {
+		if upstreamError == "" {
+			upstreamError = "login_failed"
+		}
+		sessions.Save(request, w)
+		writeErrorResponse(w, upstreamError, http.StatusUnprocessableEntity)
+		return
+	}
+	service.completeFirstFactor(w, request, username)
+}
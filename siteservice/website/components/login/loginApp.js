@@ -34,6 +34,21 @@
                 controller: 'resetPasswordController',
                 controllerAs: 'vm'
             })
+            .when('/magiclink', {
+                templateUrl: 'components/login/views/magicLink.html',
+                controller: 'magicLinkController',
+                controllerAs: 'vm'
+            })
+            .when('/magiclink/:token', {
+                templateUrl: 'components/login/views/magicLinkConfirmation.html',
+                controller: 'magicLinkConfirmationController',
+                controllerAs: 'vm'
+            })
+            .when('/upstream/:provider', {
+                templateUrl: 'components/login/views/upstreamLogin.html',
+                controller: 'upstreamLoginController',
+                controllerAs: 'vm'
+            })
             .when('/resendsms', {
                 templateUrl: 'components/registration/views/registrationresendsms.html',
                 controller: 'resendSmsController',
@@ -12,6 +12,8 @@
         vm.validateUsername = validateUsername;
         vm.resetValidation = resetValidation;
         vm.loginInfoValid = loginInfoValid;
+        vm.restoreAccount = restoreAccount;
+        vm.deletionScheduled = false;
         vm.externalSite = urlParams.client_id;
         $rootScope.registrationUrl = '/register' + $window.location.search;
         vm.logo = undefined;
@@ -20,12 +22,17 @@
         vm.password = "";
         vm.description = "";
         vm.loading = false;
+        vm.upstreamProviders = [];
+        vm.upstreamLoginUrl = upstreamLoginUrl;
 
         var listener;
         activate();
 
         function activate() {
             requestRegister();
+            LoginService.getUpstreamProviders().then(function (data) {
+                vm.upstreamProviders = data;
+            });
             if (vm.externalSite) {
                 LoginService.getLogo(vm.externalSite).then(function (data) {
                     vm.logo = data.logo;
@@ -44,6 +51,12 @@
             });
         }
 
+        function upstreamLoginUrl(provider) {
+            // Pass the query parameters so the login continues after returning from the provider
+            var query = $window.location.search ? '&' + $window.location.search.substring(1) : '';
+            return '/upstream/' + encodeURIComponent(provider.name) + '/authorize?action=login' + query;
+        }
+
         // Load the correct description after the user changes language
         $rootScope.$on('$translateChangeSuccess', function () {
             loadDescription();
@@ -87,25 +100,53 @@
             $http.post(url, data).then(
                 function (data) {
                     vm.loading = false;                  
-                    if (data.data.redirecturl) {
-                        // Skip 2FA when logging in from an external site if the 2FA validity period hasn't passed
-                        $window.location.href = data.data.redirecturl;
-                    } else {
-                        // Redirect 2 factor authentication page
-                        $window.location.hash = '#/2fa';
-                    }
+                    continueLogin(data.data);
                 },
                 function (response) {
                     vm.loading = false;
                     if (response.status === 422) {
-                        $scope.loginform.password.$setValidity("invalidcredentials", false);
+                        if (response.data && response.data.error === 'account_suspended') {
+                            $scope.loginform.password.$setValidity("accountsuspended", false);
+                        } else if (response.data && response.data.error === 'account_deletion_scheduled') {
+                            vm.deletionScheduled = true;
+                        } else {
+                            $scope.loginform.password.$setValidity("invalidcredentials", false);
+                        }
                     }
                 }
             );
         }
 
+        function restoreAccount() {
+            vm.loading = true;
+            LoginService.restoreAccount($window.location.search).then(
+                function (data) {
+                    vm.loading = false;
+                    vm.deletionScheduled = false;
+                    continueLogin(data);
+                },
+                function () {
+                    vm.loading = false;
+                    vm.deletionScheduled = false;
+                    $scope.loginform.password.$setValidity("invalidcredentials", false);
+                }
+            );
+        }
+
+        function continueLogin(data) {
+            if (data.redirecturl) {
+                // Skip 2FA when logging in from an external site if the 2FA validity period hasn't passed
+                $window.location.href = data.redirecturl;
+            } else {
+                // Redirect 2 factor authentication page
+                $window.location.hash = '#/2fa';
+            }
+        }
+
         function clearValidation() {
             $scope.loginform.password.$setValidity("invalidcredentials", true);
+            $scope.loginform.password.$setValidity("accountsuspended", true);
+            vm.deletionScheduled = false;
         }
 
         function validateUsername(username) {
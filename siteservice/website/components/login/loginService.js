@@ -18,7 +18,9 @@
             submitSmsCode: submitSmsCode,
             checkSmsConfirmation: checkSmsConfirmation,
             getLogo: getLogo,
-            getDescription: getDescription
+            getDescription: getDescription,
+            getUpstreamProviders: getUpstreamProviders,
+            restoreAccount: restoreAccount
         };
 
         function genericHttpCall(httpFunction, url, data) {
@@ -89,5 +91,15 @@
             var url = '/api/organizations/' + encodeURIComponent(globalId) + '/description/' + encodeURIComponent(langKey) + '/withfallback';
             return genericHttpCall($http.get, url);
         }
+
+        function getUpstreamProviders() {
+            return genericHttpCall($http.get, '/upstream/providers');
+        }
+
+        // Cancels the deletion of the account that passed the first factor and continues the login
+        function restoreAccount(queryString) {
+            var url = apiURL + '/restoreaccount' + queryString;
+            return genericHttpCall($http.post, url, {});
+        }
     }
 })();
@@ -0,0 +1,63 @@
+(function () {
+    'use strict';
+    angular.module('loginApp')
+        .controller('magicLinkController', ['$http', '$window', magicLinkController])
+        .controller('magicLinkConfirmationController', ['$http', '$window', '$routeParams', magicLinkConfirmationController]);
+
+    function magicLinkController($http, $window) {
+        var vm = this;
+        vm.submit = submit;
+        vm.emailSend = false;
+
+        function submit() {
+            var data = {
+                email: vm.email.toLowerCase().trim(),
+                langkey: localStorage.getItem('langKey')
+            };
+            // Pass the query parameters so the link continues the same (oauth) login flow
+            $http.post('/login/magiclink' + $window.location.search, data).then(
+                function () {
+                    vm.emailSend = true;
+                }
+            );
+        }
+    }
+
+    function magicLinkConfirmationController($http, $window, $routeParams) {
+        var vm = this;
+        vm.error = undefined;
+        vm.restoreAccount = restoreAccount;
+
+        activate();
+
+        function activate() {
+            var data = {
+                token: $routeParams.token
+            };
+            $http.post('/login/magiclink/confirm' + $window.location.search, data).then(continueLogin, loginFailed);
+        }
+
+        // Cancels the deletion of the account and continues the login
+        function restoreAccount() {
+            vm.error = undefined;
+            $http.post('/login/restoreaccount' + $window.location.search, {}).then(continueLogin, loginFailed);
+        }
+
+        function continueLogin(response) {
+            if (response.data.redirecturl) {
+                // Skip 2FA when logging in from an external site if the 2FA validity period hasn't passed
+                $window.location.href = response.data.redirecturl;
+            } else {
+                $window.location.hash = '#/2fa';
+            }
+        }
+
+        function loginFailed(response) {
+            if (response.status === 422) {
+                vm.error = response.data.error;
+            } else {
+                vm.error = 'error';
+            }
+        }
+    }
+})();
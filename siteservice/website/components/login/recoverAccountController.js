@@ -1,12 +1,14 @@
 (function () {
     'use strict';
     angular.module('loginApp')
-        .controller('resetPasswordController', ['$http', '$window', '$routeParams', '$mdDialog', resetPasswordController]);
+        .controller('resetPasswordController', ['$scope', '$http', '$window', '$routeParams', '$mdDialog', resetPasswordController]);
 
-    function resetPasswordController($http, $window, $routeParams, $mdDialog) {
+    function resetPasswordController($scope, $http, $window, $routeParams, $mdDialog) {
         var vm = this;
         vm.submit = submit;
+        vm.resetValidation = resetValidation;
         var code = $routeParams.code;
+        var passwordPolicyErrors = ['password_too_short', 'password_too_long', 'password_too_weak', 'password_contains_user_info', 'password_breached'];
 
         function submit() {
             var data = {
@@ -25,11 +27,20 @@
                                 var msg = 'The password reset token was already used or was not found.';
                                 showErrorMessage(msg);
                                 break;
+                            case 422:
+                                $scope.form.password.$setValidity(response.data.error, false);
+                                break;
                         }
                     }
                 );
         }
 
+        function resetValidation() {
+            angular.forEach(passwordPolicyErrors, function (error) {
+                $scope.form.password.$setValidity(error, true);
+            });
+        }
+
         function showErrorMessage(msg) {
             $mdDialog.show($mdDialog.alert()
                 .clickOutsideToClose(true)
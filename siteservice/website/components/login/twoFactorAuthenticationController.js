@@ -14,10 +14,13 @@
         vm.login = login;
         vm.getHelpText = getHelpText;
         vm.nextStep = nextStep;
+        vm.chooseOtherMethod = chooseOtherMethod;
         vm.selectedTwoFaMethod = null;
         vm.hasMoreThanOneTwoFaMethod = false;
         vm.smshelp = '';
         vm.totphelp = '';
+        // delivery status of the sms with the code, reported by the sms provider
+        vm.smsdelivery = '';
         var steps = [STEP_CHOICE, STEP_CODE];
         vm.step = steps[0];
         var interval;
@@ -71,6 +74,14 @@
             }
         }
 
+        function chooseOtherMethod() {
+            if (interval) {
+                $interval.cancel(interval);
+            }
+            vm.smsdelivery = '';
+            vm.step = STEP_CHOICE;
+        }
+
         function getHelpText() {
             var text = '';
             if (vm.step === STEP_CODE) {
@@ -96,6 +107,7 @@
             if (interval) {
                 $interval.cancel(interval);
             }
+            vm.smsdelivery = '';
             var phoneLabel = vm.selectedTwoFaMethod.replace('sms-', '');
             LoginService
                 .sendSmsCode(phoneLabel)
@@ -137,7 +149,9 @@
                 .then(function (data) {
                     if (data.confirmed) {
                         login();
+                        return;
                     }
+                    vm.smsdelivery = data.delivery || '';
                 });
         }
 
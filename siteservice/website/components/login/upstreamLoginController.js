@@ -0,0 +1,41 @@
+(function () {
+    'use strict';
+    angular.module('loginApp')
+        .controller('upstreamLoginController', ['$http', '$window', '$routeParams', upstreamLoginController]);
+
+    function upstreamLoginController($http, $window, $routeParams) {
+        var vm = this;
+        vm.provider = $routeParams.provider;
+        vm.error = undefined;
+        vm.restoreAccount = restoreAccount;
+
+        activate();
+
+        function activate() {
+            $http.post('/login/upstream/confirm' + $window.location.search, {}).then(continueLogin, loginFailed);
+        }
+
+        // Cancels the deletion of the account and continues the login
+        function restoreAccount() {
+            vm.error = undefined;
+            $http.post('/login/restoreaccount' + $window.location.search, {}).then(continueLogin, loginFailed);
+        }
+
+        function continueLogin(response) {
+            if (response.data.redirecturl) {
+                // Skip 2FA when logging in from an external site if the 2FA validity period hasn't passed
+                $window.location.href = response.data.redirecturl;
+            } else {
+                $window.location.hash = '#/2fa';
+            }
+        }
+
+        function loginFailed(response) {
+            if (response.status === 422) {
+                vm.error = response.data.error;
+            } else {
+                vm.error = 'error';
+            }
+        }
+    }
+})();
@@ -128,6 +128,11 @@
                                     $scope.signupform.totpcode.$setValidity(err, false);
                                     break;
                                 case 'invalid_password':
+                                case 'password_too_short':
+                                case 'password_too_long':
+                                case 'password_too_weak':
+                                case 'password_contains_user_info':
+                                case 'password_breached':
                                     $scope.signupform.password.$setValidity(err, false);
                                     break;
                                 case 'invalid_email_code':
@@ -183,6 +188,14 @@
                 case 'totpcode':
                     $scope.signupform[prop].$setValidity("invalid_totpcode", true);
                     break;
+                case 'password':
+                    $scope.signupform[prop].$setValidity("invalid_password", true);
+                    $scope.signupform[prop].$setValidity("password_too_short", true);
+                    $scope.signupform[prop].$setValidity("password_too_long", true);
+                    $scope.signupform[prop].$setValidity("password_too_weak", true);
+                    $scope.signupform[prop].$setValidity("password_contains_user_info", true);
+                    $scope.signupform[prop].$setValidity("password_breached", true);
+                    break;
                 case 'twoFAMethod':
                     if ($scope.signupform.totpcode) {
                         $scope.signupform.totpcode.$setValidity("totpcode", true);
@@ -255,6 +268,11 @@
                                 $scope.signupform.totpcode.$setValidity(err, false);
                                 break;
                             case 'invalid_password':
+                            case 'password_too_short':
+                            case 'password_too_long':
+                            case 'password_too_weak':
+                            case 'password_contains_user_info':
+                            case 'password_breached':
                                 $scope.signupform.password.$setValidity(err, false);
                                 break;
                             case 'invalid_sms_code':
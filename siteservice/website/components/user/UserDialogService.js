@@ -7,9 +7,9 @@
     angular
         .module('itsyouonline.user', [])
         .factory('UserDialogService', ['$window', '$q', '$interval', '$mdMedia', '$mdDialog', '$translate',
-            'UserService', 'configService', UserDialogService]);
+            'UserService', UserDialogService]);
 
-    function UserDialogService($window, $q, $interval, $mdMedia, $mdDialog, $translate, UserService, configService) {
+    function UserDialogService($window, $q, $interval, $mdMedia, $mdDialog, $translate, UserService) {
         var vm;
         var genericDetailControllerParams = ['$scope', '$mdDialog', 'user', 'data',
             'createFunction', 'updateFunction', 'deleteFunction', 'preFilledLabels', GenericDetailDialogController];
@@ -21,10 +21,8 @@
             verifyPhone: verifyPhone,
             verifyEmailAddress: verifyEmailAddress,
             bankAccount: bankAccount,
-            facebook: facebook,
-            addFacebook: addFacebook,
-            github: github,
-            addGithub: addGithub,
+            linkedAccount: linkedAccount,
+            linkAccount: linkAccount,
             showSimpleDialog: showSimpleDialog,
             createOrganization: createOrganization,
             digitalWalletAddressDetail: digitalWalletAddressDetail,
@@ -401,64 +399,33 @@
             });
         }
 
-        function addFacebook() {
-            configService.getConfig(function (config) {
-                $window.location.href = 'https://www.facebook.com/dialog/oauth?client_id='
-                    + config.facebookclientid
-                    + '&response_type=code&redirect_uri='
-                    + $window.location.origin
-                    + '/facebook_callback';
-            });
+        function linkAccount(provider) {
+            $window.location.href = '/upstream/' + encodeURIComponent(provider.name) + '/authorize?action=link';
         }
 
-        function facebook(ev) {
+        function linkedAccount(ev, account) {
             $mdDialog.show({
                 controller: genericDetailControllerParams,
-                templateUrl: 'components/user/views/facebookDialog.html',
+                templateUrl: 'components/user/views/linkedAccountDialog.html',
                 targetEvent: ev,
                 fullscreen: $mdMedia('sm') || $mdMedia('xs'),
                 locals: {
                     user: vm.user,
-                    data: vm.user.facebook,
+                    data: account,
                     createFunction: doNothing,
                     updateFunction: doNothing,
-                    deleteFunction: UserService.deleteFacebookAccount,
+                    deleteFunction: UserService.deleteLinkedAccount,
                     preFilledLabels: []
                 }
             })
                 .then(
                     function () {
-                        vm.user.facebook = {};
-                    });
-        }
-
-        function github(ev) {
-            $mdDialog.show({
-                controller: genericDetailControllerParams,
-                templateUrl: 'components/user/views/githubDialog.html',
-                targetEvent: ev,
-                fullscreen: $mdMedia('sm') || $mdMedia('xs'),
-                locals: {
-                    user: vm.user,
-                    data: vm.user.github,
-                    createFunction: doNothing,
-                    updateFunction: doNothing,
-                    deleteFunction: UserService.deleteGithubAccount,
-                    preFilledLabels: []
-                }
-            })
-                .then(
-                    function () {
-                        vm.user.github = {};
+                        vm.user.linkedaccounts = vm.user.linkedaccounts.filter(function (linked) {
+                            return linked.provider !== account.provider;
+                        });
                     });
         }
 
-        function addGithub() {
-            configService.getConfig(function (config) {
-                $window.location.href = 'https://github.com/login/oauth/authorize/?client_id=' + config.githubclientid;
-            });
-        }
-
         /**
          *
          * @param message
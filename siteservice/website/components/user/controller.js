@@ -59,10 +59,10 @@
         vm.showAddressDetailDialog = UserDialogService.addressDetail;
         vm.showAddressDetailDialog = UserDialogService.addressDetail;
         vm.showBankAccountDialog = UserDialogService.bankAccount;
-        vm.showFacebookDialog = UserDialogService.facebook;
-        vm.showGithubDialog = UserDialogService.github;
-        vm.addFacebookAccount = UserDialogService.addFacebook;
-        vm.addGithubAccount = UserDialogService.addGithub;
+        vm.showLinkedAccountDialog = UserDialogService.linkedAccount;
+        vm.linkAccount = UserDialogService.linkAccount;
+        vm.isLinked = isLinked;
+        vm.upstreamProviders = [];
         vm.showDigitalWalletAddressDetail = UserDialogService.digitalWalletAddressDetail;
         vm.loadNotifications = loadNotifications;
         vm.loadOrganizations = loadOrganizations;
@@ -72,6 +72,10 @@
         vm.loadSettings = loadSettings;
         vm.showAuthorizationDetailDialog = showAuthorizationDetailDialog;
         vm.showChangePasswordDialog = showChangePasswordDialog;
+        vm.showDeleteAccountDialog = showDeleteAccountDialog;
+        vm.requestDataExport = requestDataExport;
+        vm.dataExportURL = dataExportURL;
+        vm.dataExports = [];
         vm.showEditNameDialog = showEditNameDialog;
         vm.verifyPhone = UserDialogService.verifyPhone;
         vm.verifyEmailAddress = UserDialogService.verifyEmailAddress;
@@ -96,6 +100,16 @@
             UserService.getUserIdentifier().then(function (userIdentifier) {
                 vm.userIdentifier = userIdentifier;
             });
+
+            UserService.getUpstreamProviders().then(function (providers) {
+                vm.upstreamProviders = providers;
+            });
+        }
+
+        function isLinked(provider) {
+            return vm.user && vm.user.linkedaccounts && vm.user.linkedaccounts.some(function (account) {
+                return account.provider === provider.name;
+            });
         }
 
         //redirect notification to right page
@@ -129,6 +143,16 @@
                                 });
                             });
                         }
+                        if (vm.notifications.passwordchangerequired) {
+                            $translate(['user.controller.passwordchangerequired']).then(function(translations){
+                                vm.notifications.security.push({
+                                    page: 'settings',
+                                    subject: 'password_change_required',
+                                    msg: translations['user.controller.passwordchangerequired'],
+                                    status: 'pending'
+                                });
+                            });
+                        }
                         updatePendingNotificationsCount();
                         vm.loaded.notifications = true;
                     }
@@ -280,6 +304,31 @@
                 .then(function (data) {
                     vm.twoFAMethods = data;
                 });
+            loadDataExports();
+        }
+
+        function loadDataExports() {
+            UserService
+                .getDataExports(vm.username)
+                .then(function (data) {
+                    vm.dataExports = data;
+                });
+        }
+
+        function requestDataExport() {
+            UserService
+                .createDataExport(vm.username)
+                .then(function (data) {
+                    vm.dataExports.unshift(data);
+                }, function (response) {
+                    if (response.status === 409) {
+                        loadDataExports();
+                    }
+                });
+        }
+
+        function dataExportURL(dataExport) {
+            return 'api/users/' + encodeURIComponent(vm.username) + '/exports/' + encodeURIComponent(dataExport.id);
         }
 
         function getPendingCount(obj) {
@@ -437,6 +486,7 @@
 
             function showPasswordDialogController($scope, $mdDialog, username, updatePassword) {
                 var ctrl = this;
+                var passwordPolicyErrors = ['password_too_short', 'password_too_long', 'password_too_weak', 'password_contains_user_info', 'password_breached'];
                 ctrl.resetValidation = resetValidation;
                 ctrl.updatePassword = updatepwd;
                 ctrl.cancel = function () {
@@ -446,6 +496,9 @@
                 function resetValidation() {
                     $scope.changepasswordform.currentPassword.$setValidity('incorrect_password', true);
                     $scope.changepasswordform.currentPassword.$setValidity('invalid_password', true);
+                    angular.forEach(passwordPolicyErrors, function (error) {
+                        $scope.changepasswordform.newPassword.$setValidity(error, true);
+                    });
                 }
 
                 function updatepwd() {
@@ -464,7 +517,11 @@
                         })
                     }, function (response) {
                         if (response.status === 422) {
-                            $scope.changepasswordform.currentPassword.$setValidity(response.data.error, false);
+                            if (passwordPolicyErrors.indexOf(response.data.error) !== -1) {
+                                $scope.changepasswordform.newPassword.$setValidity(response.data.error, false);
+                            } else {
+                                $scope.changepasswordform.currentPassword.$setValidity(response.data.error, false);
+                            }
                         }
                     });
                 }
@@ -485,6 +542,52 @@
             });
         }
 
+        function showDeleteAccountDialog(event) {
+            var useFullScreen = ($mdMedia('sm') || $mdMedia('xs'));
+
+            function DeleteAccountDialogController($scope, $mdDialog, username, deleteUser) {
+                var ctrl = this;
+                ctrl.lastOwnerOf = [];
+                ctrl.resetValidation = resetValidation;
+                ctrl.deleteAccount = deleteAccount;
+                ctrl.cancel = function () {
+                    $mdDialog.cancel();
+                };
+
+                function resetValidation() {
+                    $scope.deleteaccountform.password.$setValidity('incorrect_password', true);
+                }
+
+                function deleteAccount() {
+                    deleteUser(username, ctrl.password).then(function () {
+                        // The account can not be used anymore, it is restored by logging in again
+                        $mdDialog.hide();
+                        $window.location.href = '/logout';
+                    }, function (response) {
+                        if (response.status === 422) {
+                            $scope.deleteaccountform.password.$setValidity(response.data.error, false);
+                        } else if (response.status === 409) {
+                            ctrl.lastOwnerOf = response.data.organizations;
+                        }
+                    });
+                }
+            }
+
+            $mdDialog.show({
+                controller: ['$scope', '$mdDialog', 'username', 'deleteUser', DeleteAccountDialogController],
+                controllerAs: 'ctrl',
+                templateUrl: 'components/user/views/deleteAccountDialog.html',
+                targetEvent: event,
+                fullscreen: useFullScreen,
+                parent: angular.element(document.body),
+                clickOutsideToClose: true,
+                locals: {
+                    username: vm.username,
+                    deleteUser: UserService.deleteUser
+                }
+            });
+        }
+
         function showEditNameDialog(event) {
             var useFullScreen = ($mdMedia('sm') || $mdMedia('xs'));
 
@@ -653,12 +756,15 @@
                         .then(function (data) {
                             ctrl.totpsecret = data.totpsecret;
                             ctrl.totpissuer = encodeURIComponent(data.totpissuer);
+                            ctrl.totpalgorithm = data.totpalgorithm;
+                            ctrl.totpdigits = data.totpdigits;
                         });
                 }
 
 
                 function getQrCodeData() {
-                    return 'otpauth://totp/' + ctrl.totpissuer + ':' + vm.username + '?secret=' + ctrl.totpsecret + '&issuer=' + ctrl.totpissuer;
+                    return 'otpauth://totp/' + ctrl.totpissuer + ':' + vm.username + '?secret=' + ctrl.totpsecret + '&issuer=' + ctrl.totpissuer
+                        + '&algorithm=' + ctrl.totpalgorithm + '&digits=' + ctrl.totpdigits;
                 }
 
                 function close() {
@@ -666,7 +772,7 @@
                 }
 
                 function submit() {
-                    UserService.setAuthenticator(vm.username, ctrl.totpsecret, ctrl.totpcode)
+                    UserService.setAuthenticator(vm.username, ctrl.totpsecret, ctrl.totpcode, ctrl.totpalgorithm, ctrl.totpdigits)
                         .then(function () {
                             vm.twoFAMethods.totp = true;
                             $mdDialog.hide();
@@ -709,12 +815,15 @@
                         .then(function (data) {
                             ctrl.totpsecret = data.totpsecret;
                             ctrl.totpissuer = encodeURIComponent(data.totpissuer);
+                            ctrl.totpalgorithm = data.totpalgorithm;
+                            ctrl.totpdigits = data.totpdigits;
                         });
                 }
 
 
                 function getQrCodeData() {
-                    return 'otpauth://totp/' + ctrl.totpissuer + ':' + vm.username + '?secret=' + ctrl.totpsecret + '&issuer=' + ctrl.totpissuer;
+                    return 'otpauth://totp/' + ctrl.totpissuer + ':' + vm.username + '?secret=' + ctrl.totpsecret + '&issuer=' + ctrl.totpissuer
+                        + '&algorithm=' + ctrl.totpalgorithm + '&digits=' + ctrl.totpdigits;
                 }
 
                 function close() {
@@ -124,9 +124,10 @@
             registerNewBankAccount: registerNewBankAccount,
             updateBankAccount: updateBankAccount,
             deleteBankAccount: deleteBankAccount,
-            deleteFacebookAccount: deleteFacebookAccount,
-            deleteGithubAccount: deleteGithubAccount,
+            deleteLinkedAccount: deleteLinkedAccount,
+            getUpstreamProviders: getUpstreamProviders,
             updatePassword: updatePassword,
+            deleteUser: deleteUser,
             updateName: updateName,
             getVerifiedPhones: getVerifiedPhones,
             sendPhoneVerificationCode: sendPhoneVerificationCode,
@@ -134,6 +135,8 @@
             getVerifiedEmailAddresses: getVerifiedEmailAddresses,
             sendEmailAddressVerification: sendEmailAddressVerification,
             getAPIKeys: getAPIKeys,
+            getDataExports: getDataExports,
+            createDataExport: createDataExport,
             createAPIKey: createAPIKey,
             updateAPIKey: updateAPIKey,
             deleteAPIKey: deleteAPIKey,
@@ -350,14 +353,13 @@
             return genericHttpCall($http.get, url, null, {cache: true});
         }
 
-        function deleteFacebookAccount(username) {
-            var url = apiURL + '/' + encodeURIComponent(username) + '/facebook';
+        function deleteLinkedAccount(username, provider) {
+            var url = apiURL + '/' + encodeURIComponent(username) + '/linkedaccounts/' + encodeURIComponent(provider);
             return genericHttpCall($http.delete, url);
         }
 
-        function deleteGithubAccount(username) {
-            var url = apiURL + '/' + encodeURIComponent(username) + '/github';
-            return genericHttpCall($http.delete, url);
+        function getUpstreamProviders() {
+            return genericHttpCall($http.get, '/upstream/providers', null, {cache: true});
         }
 
         function updatePassword(username, currentPassword, newPassword) {
@@ -369,6 +371,15 @@
             return genericHttpCall($http.put, url, data);
         }
 
+        function deleteUser(username, password) {
+            var url = apiURL + '/' + encodeURIComponent(username);
+            var config = {
+                data: {password: password},
+                headers: {'Content-Type': 'application/json'}
+            };
+            return genericHttpCall($http.delete, url, null, config);
+        }
+
         function updateName(username, firstname, lastname) {
             var url = apiURL + '/' + encodeURIComponent(username) + '/name';
             var data = {
@@ -417,6 +428,17 @@
             return genericHttpCall($http.post, url);
         }
 
+        function getDataExports(username) {
+            var url = apiURL + '/' + encodeURIComponent(username) + '/exports';
+            return genericHttpCall($http.get, url);
+        }
+
+        function createDataExport(username) {
+            var lang = localStorage.getItem('langKey');
+            var url = apiURL + '/' + encodeURIComponent(username) + '/exports?lang=' + lang;
+            return genericHttpCall($http.post, url);
+        }
+
         function getAPIKeys(username) {
             var url = apiURL + '/' + encodeURIComponent(username) + '/apikeys';
             return genericHttpCall($http.get, url);
@@ -476,11 +498,13 @@
             return genericHttpCall($http.get, url);
         }
 
-        function setAuthenticator(username, secret, code) {
+        function setAuthenticator(username, secret, code, algorithm, digits) {
             var url = apiURL + '/' + encodeURIComponent(username) + '/totp';
             var data = {
                 totpsecret: secret,
-                totpcode: code
+                totpcode: code,
+                totpalgorithm: algorithm,
+                totpdigits: digits
             };
             return genericHttpCall($http.post, url, data);
         }
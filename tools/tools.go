@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"html/template"
+	texttemplate "text/template"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/itsyouonline/identityserver/templates/packaged"
@@ -45,3 +46,23 @@ func RenderTemplate(templateName string, data interface{}) (message string, err
 	message = buf.String()
 	return
 }
+
+// RenderTextTemplate renders a plain text template, the values are not html escaped
+func RenderTextTemplate(templateName string, data interface{}) (message string, err error) {
+	textData, err := templates.Asset(templateName)
+	if err != nil {
+		log.Error("Could not get email asset: ", err)
+		return
+	}
+	templateEngine, err := texttemplate.New("template").Parse(string(textData))
+	if err != nil {
+		log.Error("Could not parse template: ", err)
+		return
+	}
+	buf := new(bytes.Buffer)
+	if err = templateEngine.Execute(buf, data); err != nil {
+		return
+	}
+	message = buf.String()
+	return
+}
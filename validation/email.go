@@ -13,7 +13,8 @@ import (
 )
 
 const (
-	emailWithButtonTemplateName = "emailwithbutton.html"
+	emailWithButtonTemplateName     = "emailwithbutton.html"
+	emailWithButtonTextTemplateName = "emailwithbutton.txt"
 )
 
 type EmailWithButtonTemplateParams struct {
@@ -29,7 +30,16 @@ type EmailWithButtonTemplateParams struct {
 
 //EmailService is the interface for an email communication channel, should be used by the IYOEmailAddressValidationService
 type EmailService interface {
-	Send(recipients []string, subject string, message string) (err error)
+	Send(recipients []string, subject string, text string, html string) (err error)
+}
+
+//renderEmailWithButton renders the plain text and the html body of an email with a button
+func renderEmailWithButton(params EmailWithButtonTemplateParams) (text string, html string, err error) {
+	if html, err = tools.RenderTemplate(emailWithButtonTemplateName, params); err != nil {
+		return
+	}
+	text, err = tools.RenderTextTemplate(emailWithButtonTextTemplateName, params)
+	return
 }
 
 //IYOEmailAddressValidationService is the itsyou.online implementation of a EmailAddressValidationService
@@ -77,12 +87,14 @@ func (service *IYOEmailAddressValidationService) RequestValidation(request *http
 		Reason:     translations["emailvalidation_reason"],
 		LogoUrl:    fmt.Sprintf("https://%s/assets/img/its-you-online.png", request.Host),
 	}
-	message, err := tools.RenderTemplate(emailWithButtonTemplateName, templateParameters)
+	text, html, err := renderEmailWithButton(templateParameters)
 	if err != nil {
 		return
 	}
 
-	go service.EmailService.Send([]string{email}, translations["emailvalidation_subject"], message)
+	if err = service.EmailService.Send([]string{email}, translations["emailvalidation_subject"], text, html); err != nil {
+		return
+	}
 	key = info.Key
 	return
 }
@@ -124,15 +136,87 @@ func (service *IYOEmailAddressValidationService) RequestPasswordReset(request *h
 		Reason:     translations["passwordreset_reason"],
 		LogoUrl:    fmt.Sprintf("https://%s/assets/img/its-you-online.png", request.Host),
 	}
-	message, err := tools.RenderTemplate(emailWithButtonTemplateName, templateParameters)
+	text, html, err := renderEmailWithButton(templateParameters)
 	if err != nil {
 		return
 	}
-	go service.EmailService.Send(emails, translations["passwordreset_subject"], message)
+	if err = service.EmailService.Send(emails, translations["passwordreset_subject"], text, html); err != nil {
+		return
+	}
 	key = token.Token
 	return
 }
 
+//SendMagicLink sends an email with a link that logs the user in without a password
+func (service *IYOEmailAddressValidationService) SendMagicLink(request *http.Request, username string, email string, link string, langKey string) (err error) {
+	translationValues := tools.TranslationValues{
+		"magiclink_title":      nil,
+		"magiclink_text":       nil,
+		"magiclink_buttontext": nil,
+		"magiclink_reason":     nil,
+		"magiclink_subject":    nil,
+		"magiclink_urlcaption": nil,
+	}
+
+	translations, err := tools.ParseTranslations(langKey, translationValues)
+	if err != nil {
+		log.Error("Failed to parse translations: ", err)
+		return
+	}
+
+	templateParameters := EmailWithButtonTemplateParams{
+		UrlCaption: translations["magiclink_urlcaption"],
+		Url:        link,
+		Username:   username,
+		Title:      translations["magiclink_title"],
+		Text:       translations["magiclink_text"],
+		ButtonText: translations["magiclink_buttontext"],
+		Reason:     translations["magiclink_reason"],
+		LogoUrl:    fmt.Sprintf("https://%s/assets/img/its-you-online.png", request.Host),
+	}
+	text, html, err := renderEmailWithButton(templateParameters)
+	if err != nil {
+		return
+	}
+	err = service.EmailService.Send([]string{email}, translations["magiclink_subject"], text, html)
+	return
+}
+
+//SendDataExportReadyEmail notifies a user that the archive with the data stored about the user can be downloaded
+func (service *IYOEmailAddressValidationService) SendDataExportReadyEmail(request *http.Request, username string, emails []string, link string, langKey string) (err error) {
+	translationValues := tools.TranslationValues{
+		"dataexport_title":      nil,
+		"dataexport_text":       nil,
+		"dataexport_buttontext": nil,
+		"dataexport_reason":     nil,
+		"dataexport_subject":    nil,
+		"dataexport_urlcaption": nil,
+	}
+
+	translations, err := tools.ParseTranslations(langKey, translationValues)
+	if err != nil {
+		log.Error("Failed to parse translations: ", err)
+		return
+	}
+
+	templateParameters := EmailWithButtonTemplateParams{
+		UrlCaption: translations["dataexport_urlcaption"],
+		Url:        link,
+		Username:   username,
+		Title:      translations["dataexport_title"],
+		Text:       translations["dataexport_text"],
+		ButtonText: translations["dataexport_buttontext"],
+		Reason:     translations["dataexport_reason"],
+		LogoUrl:    fmt.Sprintf("https://%s/assets/img/its-you-online.png", request.Host),
+	}
+	text, html, err := renderEmailWithButton(templateParameters)
+	if err != nil {
+		return
+	}
+	err = service.EmailService.Send(emails, translations["dataexport_subject"], text, html)
+	return
+}
+
 //SendOrganizationInviteEmail Sends an organization invite email
 func (service *IYOEmailAddressValidationService) SendOrganizationInviteEmail(request *http.Request, invite *invitations.JoinOrganizationInvitation) (err error) {
 	InviteURL := fmt.Sprintf(invitations.InviteURL, request.Host, url.QueryEscape(invite.Code))
@@ -145,13 +229,13 @@ func (service *IYOEmailAddressValidationService) SendOrganizationInviteEmail(req
 		Reason:     "You’re receiving this email because someone invited you to an organization at ItsYou.Online. If you think this was a mistake please ignore this email.",
 		LogoUrl:    fmt.Sprintf("https://%s/assets/img/its-you-online.png", request.Host),
 	}
-	message, err := tools.RenderTemplate(emailWithButtonTemplateName, templateParameters)
+	text, html, err := renderEmailWithButton(templateParameters)
 	if err != nil {
 		return
 	}
 	subject := fmt.Sprintf("You have been invited to the %s organization", invite.Organization)
 	recipients := []string{invite.EmailAddress}
-	go service.EmailService.Send(recipients, subject, message)
+	err = service.EmailService.Send(recipients, subject, text, html)
 	return
 }
 
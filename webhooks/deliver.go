@@ -0,0 +1,241 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/webhook"
+	"github.com/itsyouonline/identityserver/metrics"
+)
+
+// The headers of a delivery
+const (
+	// SignatureHeader is sha256= followed by the hex encoded HMAC-SHA256 of the timestamp, a dot and the body
+	// with the secret of the webhook
+	SignatureHeader = "X-Iyo-Signature"
+	// TimestampHeader is the unix time the attempt was sent at, it is signed so a captured delivery can not be replayed later
+	TimestampHeader = "X-Iyo-Timestamp"
+	EventHeader     = "X-Iyo-Event"
+	DeliveryHeader  = "X-Iyo-Delivery"
+)
+
+const (
+	// DeliveryInterval is how often the outbox is checked for due deliveries
+	DeliveryInterval = 5 * time.Second
+	// MaxAttempts is the number of times a delivery is sent before it fails
+	MaxAttempts = 10
+	// retryDelay is the delay after the first failed attempt, it doubles after every attempt up to maxRetryDelay
+	retryDelay    = time.Minute
+	maxRetryDelay = 6 * time.Hour
+	// deliveryTimeout is how long a webhook gets to respond
+	deliveryTimeout = 10 * time.Second
+	// batchSize is the number of deliveries claimed at once
+	batchSize = 20
+	// maxConcurrentWebhooks is the number of webhooks the deliveries of a batch are sent to at the same time
+	maxConcurrentWebhooks = 5
+)
+
+// errConnectionFailed is stored for a delivery that did not get a response, the cause is only logged
+// so the deliveries can not be used to find out which hosts and ports exist on the network of the server
+var errConnectionFailed = errors.New("connection failed")
+
+// client does not follow redirects, a webhook has to respond itself.
+// It does not use a proxy either, the dialer checks every address it connects to so a host name
+// that resolves to a private address, also after the webhook was validated, is refused.
+var client = &http.Client{
+	Timeout: deliveryTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: deliveryTimeout,
+			Control: refuseNonPublicAddress,
+		}).DialContext,
+		TLSHandshakeTimeout: deliveryTimeout,
+		IdleConnTimeout:     time.Minute,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// refuseNonPublicAddress is the Control of the dialer, it runs for the resolved address right before connecting
+func refuseNonPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !webhook.IsPublicIP(net.ParseIP(host)) {
+		return fmt.Errorf("Refusing to connect to the non-public address %s", host)
+	}
+	return nil
+}
+
+// Deliver sends the due deliveries of the outbox until stop is closed
+func Deliver(backend db.Backend, stop <-chan struct{}) {
+	ticker := time.NewTicker(DeliveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			deliverDue(backend)
+		}
+	}
+}
+
+// deliverDue sends the deliveries that are due until none are left.
+// The deliveries of a batch are sent to the webhooks concurrently, so a slow webhook does not delay the others.
+func deliverDue(backend db.Backend) {
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if err != nil {
+		log.Error("Failed to deliver the webhooks: ", err)
+		return
+	}
+	defer release()
+	mgr := webhook.NewManager(r)
+	for {
+		// The claimed deliveries are postponed for longer than sending them can take,
+		// they are sent again if this instance stops before it stored the result
+		deliveries, err := mgr.ClaimDeliveries(time.Now().Add(batchSize*deliveryTimeout+time.Minute), batchSize)
+		if err != nil {
+			log.Error("Failed to claim the due webhook deliveries: ", err)
+			return
+		}
+		byWebhook := make(map[string][]*webhook.Delivery)
+		var order []string
+		for i := range deliveries {
+			id := deliveries[i].WebhookID.Hex()
+			if _, found := byWebhook[id]; !found {
+				order = append(order, id)
+			}
+			byWebhook[id] = append(byWebhook[id], &deliveries[i])
+		}
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, maxConcurrentWebhooks)
+		for _, id := range order {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(deliveries []*webhook.Delivery) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				deliverToWebhook(backend, deliveries)
+			}(byWebhook[id])
+		}
+		wg.Wait()
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// deliverToWebhook sends the claimed deliveries of one webhook in order. After a failed attempt the others are not sent,
+// they stay claimed and are sent once the claim expires instead of waiting for a webhook that is down again.
+func deliverToWebhook(backend db.Backend, deliveries []*webhook.Delivery) {
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if err != nil {
+		log.Error("Failed to deliver the webhooks: ", err)
+		return
+	}
+	defer release()
+	mgr := webhook.NewManager(r)
+	hook, err := mgr.Get(deliveries[0].Globalid, deliveries[0].WebhookID.Hex())
+	if db.IsNotFound(err) {
+		// The webhook was removed after the deliveries were claimed
+		return
+	}
+	if err != nil {
+		log.Error("Failed to get the webhook of delivery ", deliveries[0].ID.Hex(), ": ", err)
+		return
+	}
+	for _, delivery := range deliveries {
+		attempt(hook, delivery)
+		if err = mgr.UpdateDelivery(delivery); err != nil {
+			log.Error("Failed to store the result of webhook delivery ", delivery.ID.Hex(), ": ", err)
+		}
+		if delivery.Status != webhook.StatusDelivered {
+			return
+		}
+	}
+}
+
+// attempt sends a delivery and updates it with the result, a failed delivery is retried with a growing delay
+func attempt(hook *webhook.Webhook, delivery *webhook.Delivery) {
+	delivery.Attempts++
+	status, err := send(hook, delivery)
+	delivery.ResponseStatus = status
+	metrics.WebhookDeliveries.Inc(metrics.Result(err))
+	if err == nil {
+		delivery.Status = webhook.StatusDelivered
+		delivery.LastError = ""
+		return
+	}
+	delivery.LastError = err.Error()
+	log.WithFields(log.Fields{"organization": hook.Globalid, "webhook": hook.ID.Hex(), "delivery": delivery.ID.Hex()}).
+		Debug("Webhook delivery failed: ", err)
+	if delivery.Attempts >= MaxAttempts {
+		delivery.Status = webhook.StatusFailed
+		return
+	}
+	delivery.NextAttempt = time.Now().Add(backoff(delivery.Attempts))
+}
+
+// backoff returns the delay before the next attempt after a number of failed attempts
+func backoff(attempts int) time.Duration {
+	delay := retryDelay << uint(attempts-1)
+	if delay <= 0 || delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// send posts the payload of a delivery to a webhook, a response other than 2xx is an error
+func send(hook *webhook.Webhook, delivery *webhook.Delivery) (status int, err error) {
+	request, err := http.NewRequest(http.MethodPost, hook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "ItsYouOnline-Webhooks")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, delivery.ID.Hex())
+	timestamp := time.Now().Unix()
+	request.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(SignatureHeader, Sign(hook.Secret, timestamp, []byte(delivery.Payload)))
+	response, err := client.Do(request)
+	if err != nil {
+		log.WithFields(log.Fields{"organization": hook.Globalid, "webhook": hook.ID.Hex(), "delivery": delivery.ID.Hex()}).
+			Debug("Webhook delivery could not connect: ", err)
+		return 0, errConnectionFailed
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("The webhook responded with %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// Sign returns the signature of a payload sent at a unix timestamp: sha256= followed by the hex encoded HMAC-SHA256
+// of the timestamp, a dot and the payload with the secret
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
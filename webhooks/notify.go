@@ -0,0 +1,115 @@
+// Package webhooks forwards the events of organizations to the webhooks they registered.
+// The events are taken from the audit log and queued in an outbox, Deliver sends them and retries the failed ones.
+package webhooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db/audit"
+	"github.com/itsyouonline/identityserver/db/webhook"
+	"github.com/itsyouonline/identityserver/logging"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DeliveryRetention is how long a delivery is kept in the delivery log
+const DeliveryRetention = 30 * 24 * time.Hour
+
+// Payload is the body posted to a webhook
+type Payload struct {
+	// ID is the id of the delivery, it is the same for all attempts so receivers can ignore duplicates
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	// Action is the action of the audit log that caused the event, like grant_added for a grant_changed event
+	Action       string    `json:"action"`
+	Timestamp    time.Time `json:"timestamp"`
+	Organization string    `json:"organization"`
+	// User is the user the event is about
+	User string `json:"user,omitempty"`
+	// MemberOrganization is the organization that joined, left or changed its role in the organization
+	MemberOrganization string `json:"memberorganization,omitempty"`
+	// Actor is the user that did the action
+	Actor  string `json:"actor,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// webhookEvents returns the webhook events of a recorded audit event
+func webhookEvents(event audit.Event) []string {
+	if event.Outcome != audit.OutcomeSuccess || event.Organization == "" {
+		return nil
+	}
+	switch event.Action {
+	case audit.ActionMemberAdded, audit.ActionOwnerAdded:
+		if event.Detail == audit.DetailInvitation {
+			return []string{webhook.EventMemberAdded, webhook.EventInvitationAccepted}
+		}
+		return []string{webhook.EventMemberAdded}
+	case audit.ActionMemberRemoved:
+		return []string{webhook.EventMemberRemoved}
+	case audit.ActionRoleChanged:
+		return []string{webhook.EventRoleChanged}
+	case audit.ActionGrantAdded, audit.ActionGrantUpdated, audit.ActionGrantRemoved:
+		return []string{webhook.EventGrantChanged}
+	case audit.ActionAuthorizationRemoved:
+		return []string{webhook.EventAuthorizationRevoked}
+	case audit.ActionAPIKeyCreated, audit.ActionAPIKeyRemoved:
+		return []string{webhook.EventAPIKeyRotated}
+	}
+	return nil
+}
+
+// Notify queues a delivery of a recorded audit event for every webhook of the organization that subscribed to it.
+// It is subscribed to the audit log, failures are logged and do not fail the request.
+func Notify(r *http.Request, event audit.Event) {
+	events := webhookEvents(event)
+	if len(events) == 0 {
+		return
+	}
+	log := logging.FromRequest(r).WithField("organization", event.Organization)
+	mgr := webhook.NewManager(r)
+	webhooks, err := mgr.ListByOrganization(event.Organization)
+	if err != nil {
+		log.Error("Failed to list the webhooks: ", err)
+		return
+	}
+	for _, hook := range webhooks {
+		for _, name := range events {
+			if !hook.Subscribes(name) {
+				continue
+			}
+			delivery := newDelivery(&hook, name, event)
+			if err = mgr.SaveDelivery(delivery); err != nil {
+				log.WithField("webhook", hook.ID.Hex()).Error("Failed to queue the webhook delivery: ", err)
+			}
+		}
+	}
+}
+
+// newDelivery creates a pending delivery of an event that is due right away
+func newDelivery(hook *webhook.Webhook, name string, event audit.Event) *webhook.Delivery {
+	now := time.Now()
+	id := bson.NewObjectId()
+	payload, _ := json.Marshal(&Payload{
+		ID:                 id.Hex(),
+		Event:              name,
+		Action:             event.Action,
+		Timestamp:          event.Timestamp,
+		Organization:       event.Organization,
+		User:               event.Subject,
+		MemberOrganization: event.MemberOrganization,
+		Actor:              event.Actor,
+		Detail:             event.Detail,
+	})
+	return &webhook.Delivery{
+		ID:          id,
+		WebhookID:   hook.ID,
+		Globalid:    hook.Globalid,
+		Event:       name,
+		Payload:     string(payload),
+		Status:      webhook.StatusPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(DeliveryRetention),
+	}
+}
@@ -0,0 +1,145 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/audit"
+	"github.com/itsyouonline/identityserver/db/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookEvents(t *testing.T) {
+	assert.Equal(t, []string{webhook.EventMemberAdded, webhook.EventInvitationAccepted},
+		webhookEvents(audit.Event{Action: audit.ActionOwnerAdded, Outcome: audit.OutcomeSuccess, Organization: "myorg", Detail: audit.DetailInvitation}))
+	assert.Equal(t, []string{webhook.EventGrantChanged},
+		webhookEvents(audit.Event{Action: audit.ActionGrantRemoved, Outcome: audit.OutcomeSuccess, Organization: "myorg"}))
+	assert.Empty(t, webhookEvents(audit.Event{Action: audit.ActionAPIKeyCreated, Outcome: audit.OutcomeSuccess}),
+		"the api keys of users are not about an organization")
+	assert.Empty(t, webhookEvents(audit.Event{Action: audit.ActionLogin, Outcome: audit.OutcomeSuccess, Organization: "myorg"}))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, backoff(1))
+	assert.Equal(t, 4*time.Minute, backoff(3))
+	assert.Equal(t, maxRetryDelay, backoff(MaxAttempts))
+	assert.Equal(t, maxRetryDelay, backoff(100))
+}
+
+func TestDeliver(t *testing.T) {
+	responseStatus := http.StatusInternalServerError
+	var received *http.Request
+	var body []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(responseStatus)
+	}))
+	defer server.Close()
+	defaultClient := client
+	client = server.Client()
+	defer func() { client = defaultClient }()
+
+	backend := db.NewMemoryBackend()
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	mgr := webhook.NewManager(r)
+	hook := &webhook.Webhook{Globalid: "myorg", URL: server.URL, Events: []string{webhook.EventMemberRemoved}, Secret: "secret"}
+	assert.NoError(t, mgr.Create(hook))
+
+	Notify(r, audit.Event{Action: audit.ActionRoleChanged, Outcome: audit.OutcomeSuccess, Organization: "myorg"})
+	Notify(r, audit.Event{Action: audit.ActionMemberRemoved, Outcome: audit.OutcomeSuccess, Organization: "myorg", Subject: "bob"})
+	deliveries, err := mgr.ListDeliveries("myorg", hook.ID.Hex(), 10)
+	assert.NoError(t, err)
+	if !assert.Len(t, deliveries, 1, "only the subscribed events are delivered") {
+		return
+	}
+
+	deliverDue(backend)
+	if !assert.NotNil(t, received) {
+		return
+	}
+	assert.Equal(t, webhook.EventMemberRemoved, received.Header.Get(EventHeader))
+	timestamp, err := strconv.ParseInt(received.Header.Get(TimestampHeader), 10, 64)
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Now().Unix(), timestamp, 60)
+	assert.Equal(t, Sign("secret", timestamp, body), received.Header.Get(SignatureHeader))
+	assert.NotEqual(t, Sign("secret", timestamp+1, body), received.Header.Get(SignatureHeader), "the timestamp is signed")
+	payload := Payload{}
+	assert.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, "bob", payload.User)
+	assert.Equal(t, deliveries[0].ID.Hex(), payload.ID)
+
+	deliveries, _ = mgr.ListDeliveries("myorg", hook.ID.Hex(), 10)
+	assert.Equal(t, webhook.StatusPending, deliveries[0].Status, "a failed delivery is retried")
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[0].ResponseStatus)
+	assert.True(t, deliveries[0].NextAttempt.After(time.Now()))
+
+	responseStatus = http.StatusNoContent
+	attempt(hook, &deliveries[0])
+	assert.Equal(t, webhook.StatusDelivered, deliveries[0].Status)
+	assert.Empty(t, deliveries[0].LastError)
+}
+
+func TestDeliverDoesNotWaitForSlowWebhook(t *testing.T) {
+	unblock := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer slow.Close()
+	defer close(unblock)
+	fastReceived := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastReceived <- struct{}{}
+	}))
+	defer fast.Close()
+	defaultClient := client
+	client = &http.Client{}
+	defer func() { client = defaultClient }()
+
+	backend := db.NewMemoryBackend()
+	r, release, err := db.NewBackgroundRequest(backend, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer release()
+	mgr := webhook.NewManager(r)
+	for _, url := range []string{slow.URL, fast.URL} {
+		hook := &webhook.Webhook{Globalid: "myorg", URL: url, Events: []string{webhook.EventMemberRemoved}, Secret: "secret"}
+		assert.NoError(t, mgr.Create(hook))
+	}
+	Notify(r, audit.Event{Action: audit.ActionMemberRemoved, Outcome: audit.OutcomeSuccess, Organization: "myorg", Subject: "bob"})
+
+	go deliverDue(backend)
+	select {
+	case <-fastReceived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delivery to a webhook waits for a slow webhook")
+	}
+}
+
+func TestSendRefusesNonPublicAddress(t *testing.T) {
+	called := false
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	hook := &webhook.Webhook{Globalid: "myorg", URL: server.URL, Secret: "secret"}
+	delivery := &webhook.Delivery{Event: webhook.EventMemberAdded, Payload: "{}", Status: webhook.StatusPending}
+	attempt(hook, delivery)
+	assert.False(t, called, "the server listens on a loopback address")
+	assert.Equal(t, webhook.StatusPending, delivery.Status)
+	assert.Equal(t, 0, delivery.ResponseStatus)
+	assert.Equal(t, "connection failed", delivery.LastError, "the cause is not stored")
+}